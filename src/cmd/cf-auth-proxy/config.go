@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"time"
 
 	"code.cloudfoundry.org/go-envstruct"
@@ -11,6 +12,13 @@ type CAPI struct {
 	Addr       string `env:"CAPI_ADDR,        required, report"`
 	CAPath     string `env:"CAPI_CA_PATH,               report"`
 	CommonName string `env:"CAPI_COMMON_NAME,           report"`
+
+	// BreakerThreshold is the number of consecutive failed CAPI requests
+	// after which requests are short-circuited for BreakerCooldown. A value
+	// of 0 disables the circuit breaker.
+	BreakerThreshold int           `env:"CAPI_BREAKER_THRESHOLD, report"`
+	BreakerCooldown  time.Duration `env:"CAPI_BREAKER_COOLDOWN,  report"`
+	BreakerFailOpen  bool          `env:"CAPI_BREAKER_FAIL_OPEN, report"`
 }
 
 type UAA struct {
@@ -18,6 +26,10 @@ type UAA struct {
 	ClientSecret string `env:"UAA_CLIENT_SECRET,"`
 	Addr         string `env:"UAA_ADDR,          required, report"`
 	CAPath       string `env:"UAA_CA_PATH,                 report"`
+
+	// MaxTokenAge is how long after they were issued tokens are rejected,
+	// even if they have not expired yet. A value of 0 disables the limit.
+	MaxTokenAge time.Duration `env:"UAA_MAX_TOKEN_AGE, report"`
 }
 
 type Config struct {
@@ -32,6 +44,11 @@ type Config struct {
 	SecurityEventLog        string        `env:"SECURITY_EVENT_LOG,               report"`
 	TokenPruningInterval    time.Duration `env:"TOKEN_PRUNING_INTERVAL,           report"`
 	CacheExpirationInterval time.Duration `env:"CACHE_EXPIRATION_INTERVAL,        report"`
+	MaxQuerySourceIDs       int           `env:"MAX_QUERY_SOURCE_IDS,             report"`
+
+	// SecurityEventLogSampleRate is the fraction (0 to 1) of requests
+	// written to the security event log. Auth failures are always written.
+	SecurityEventLogSampleRate float64 `env:"SECURITY_EVENT_LOG_SAMPLE_RATE, report"`
 
 	CAPI          CAPI
 	UAA           UAA
@@ -47,6 +64,11 @@ func LoadConfig() (*Config, error) {
 		InternalIP:              "0.0.0.0",
 		LogCacheGatewayAddr:     "localhost:8081",
 		CacheExpirationInterval: time.Minute,
+
+		SecurityEventLogSampleRate: 1,
+		CAPI: CAPI{
+			BreakerCooldown: 30 * time.Second,
+		},
 		MetricsServer: config.MetricsServer{
 			Port: 6065,
 		},
@@ -57,5 +79,9 @@ func LoadConfig() (*Config, error) {
 		return nil, err
 	}
 
+	if cfg.SecurityEventLogSampleRate < 0 || cfg.SecurityEventLogSampleRate > 1 {
+		return nil, fmt.Errorf("SECURITY_EVENT_LOG_SAMPLE_RATE must be between 0 and 1, got %v", cfg.SecurityEventLogSampleRate)
+	}
+
 	return &cfg, nil
 }
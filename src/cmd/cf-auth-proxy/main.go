@@ -15,8 +15,6 @@ import (
 	"os"
 	"time"
 
-	metrics "code.cloudfoundry.org/go-metric-registry"
-
 	"crypto/x509"
 
 	"code.cloudfoundry.org/go-envstruct"
@@ -51,20 +49,13 @@ func main() {
 	if err != nil {
 		log.Printf("Failed to print a report of the from environment: %s\n", err)
 	}
-	metricServerOption := metrics.WithTLSServer(
-		int(cfg.MetricsServer.Port),
-		cfg.MetricsServer.CertFile,
-		cfg.MetricsServer.KeyFile,
-		cfg.MetricsServer.CAFile,
-	)
-	if cfg.MetricsServer.CAFile == "" {
-		metricServerOption = metrics.WithPublicServer(int(cfg.MetricsServer.Port))
+	metrics, err := cfg.MetricsServer.NewRegistry(loggr)
+	if err != nil {
+		if cfg.MetricsServer.FatalOnBindFailure {
+			loggr.Fatalf("failed to start metrics server: %s", err)
+		}
+		loggr.Printf("METRICS SERVER FAILED TO START, METRICS ARE NOT SERVED: %s", err)
 	}
-
-	metrics := metrics.NewRegistry(
-		loggr,
-		metricServerOption,
-	)
 	if cfg.MetricsServer.DebugMetrics {
 		metrics.RegisterDebugMetrics()
 		pprofServer := &http.Server{
@@ -79,6 +70,9 @@ func main() {
 	if cfg.UAA.ClientID != "" && cfg.UAA.ClientSecret != "" {
 		options = append(options, auth.WithBasicAuth(cfg.UAA.ClientID, cfg.UAA.ClientSecret))
 	}
+	if cfg.UAA.MaxTokenAge > 0 {
+		options = append(options, auth.WithMaxTokenAge(cfg.UAA.MaxTokenAge))
+	}
 	uaaClient := auth.NewUAAClient(
 		cfg.UAA.Addr,
 		buildUAAClient(cfg, loggr),
@@ -92,12 +86,20 @@ func main() {
 		loggr.Fatalf("failed to parse gateway address: %s", err)
 	}
 
+	capiOptions := []auth.CAPIOption{
+		auth.WithCacheExpirationInterval(cfg.CacheExpirationInterval),
+		auth.WithCircuitBreaker(cfg.CAPI.BreakerThreshold, cfg.CAPI.BreakerCooldown),
+	}
+	if cfg.CAPI.BreakerFailOpen {
+		capiOptions = append(capiOptions, auth.WithCircuitBreakerFailOpen())
+	}
+
 	capiClient := auth.NewCAPIClient(
 		cfg.CAPI.Addr,
 		buildCAPIClient(cfg, loggr),
 		metrics,
 		loggr,
-		auth.WithCacheExpirationInterval(cfg.CacheExpirationInterval),
+		capiOptions...,
 	)
 
 	// Calls to /api/v1/meta get sent to the gateway, but not through the
@@ -123,6 +125,7 @@ func main() {
 		metaFetcher,
 		promql.ExtractSourceIds,
 		capiClient,
+		auth.WithMaxQuerySourceIDs(cfg.MaxQuerySourceIDs),
 	)
 
 	proxyOptions := []CFAuthProxyOption{
@@ -168,7 +171,12 @@ func main() {
 		}
 
 		accessLogger := auth.NewAccessLogger(accessLog)
-		accessMiddleware := auth.NewAccessMiddleware(accessLogger, cfg.InternalIP, localPort)
+		accessMiddleware := auth.NewAccessMiddleware(
+			accessLogger,
+			cfg.InternalIP,
+			localPort,
+			auth.WithAccessLogSampling(cfg.SecurityEventLogSampleRate),
+		)
 		WithAccessMiddleware(accessMiddleware)(proxy)
 	}
 
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"fmt"
+	"time"
+
 	envstruct "code.cloudfoundry.org/go-envstruct"
 	"code.cloudfoundry.org/log-cache/internal/config"
 	"code.cloudfoundry.org/log-cache/internal/tls"
@@ -16,6 +19,46 @@ type Config struct {
 	ProxyKeyPath  string `env:"PROXY_KEY_PATH,           report"`
 	Version       string `env:"-,                        report"`
 
+	// MaxConcurrentQueries limits the number of PromQL queries served at
+	// once. Default is 0 (unlimited)
+	MaxConcurrentQueries int `env:"MAX_CONCURRENT_QUERIES, report"`
+
+	// QueryTimeout is the PromQL query timeout of Log Cache, which the
+	// info endpoint reports. Default is 0 (not reported)
+	QueryTimeout time.Duration `env:"QUERY_TIMEOUT, report"`
+
+	// MaxPointsPerSeries is the number of points a range query may return
+	// for a series. Range queries beyond it are rejected. Default is 0
+	// (unlimited)
+	MaxPointsPerSeries int `env:"MAX_POINTS_PER_SERIES, report"`
+
+	// DefaultReadLookback is how far back a Read without a start_time
+	// reads. Default is 0 (read from the beginning of the cache)
+	DefaultReadLookback time.Duration `env:"DEFAULT_READ_LOOKBACK, report"`
+
+	// CORSAllowedOrigins are the origins browsers may call the read and
+	// query endpoints from. "*" allows every origin. Default is none
+	CORSAllowedOrigins []string `env:"CORS_ALLOWED_ORIGINS, report"`
+
+	// BackendHealthCheckInterval is how often the connection to Log Cache
+	// is checked. After BackendHealthCheckFailures failed checks in a row
+	// it is redialed. Default is 10s and 3 failures; an interval of 0
+	// disables the checks
+	BackendHealthCheckInterval time.Duration `env:"BACKEND_HEALTH_CHECK_INTERVAL, report"`
+	BackendHealthCheckFailures int           `env:"BACKEND_HEALTH_CHECK_FAILURES, report"`
+
+	// Compression gzips requests to Log Cache, which makes it gzip its
+	// responses too. Default is false
+	Compression bool `env:"LOG_CACHE_COMPRESSION, report"`
+
+	// WriteEnabled serves /api/v1/write, which sends posted envelopes to
+	// Log Cache. Default is false
+	WriteEnabled bool `env:"WRITE_ENABLED, report"`
+
+	// HTTPMetrics records the duration and status code of read, meta,
+	// query and query_range requests. Default is false
+	HTTPMetrics bool `env:"HTTP_METRICS, report"`
+
 	TLS           tls.TLS
 	MetricsServer config.MetricsServer
 	UseRFC339     bool `env:"USE_RFC339"`
@@ -26,6 +69,10 @@ func LoadConfig() (*Config, error) {
 	c := Config{
 		Addr:         ":8081",
 		LogCacheAddr: "localhost:8080",
+
+		BackendHealthCheckInterval: 10 * time.Second,
+		BackendHealthCheckFailures: 3,
+
 		MetricsServer: config.MetricsServer{
 			Port: 6063,
 		},
@@ -35,6 +82,14 @@ func LoadConfig() (*Config, error) {
 		return nil, err
 	}
 
+	if c.MaxPointsPerSeries < 0 {
+		return nil, fmt.Errorf("MAX_POINTS_PER_SERIES must not be negative, got %d", c.MaxPointsPerSeries)
+	}
+
+	if c.BackendHealthCheckInterval > 0 && c.BackendHealthCheckFailures < 1 {
+		return nil, fmt.Errorf("BACKEND_HEALTH_CHECK_FAILURES must be at least 1, got %d", c.BackendHealthCheckFailures)
+	}
+
 	c.Version = buildVersion
 
 	err := envstruct.WriteReport(&c)
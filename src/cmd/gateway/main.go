@@ -6,7 +6,6 @@ import (
 	"os"
 	"time"
 
-	metrics "code.cloudfoundry.org/go-metric-registry"
 	"code.cloudfoundry.org/tlsconfig"
 
 	"net/http"
@@ -44,19 +43,13 @@ func main() {
 	log.Print("Starting Log Cache Gateway...")
 	defer log.Print("Closing Log Cache Gateway.")
 
-	metricServerOption := metrics.WithTLSServer(
-		int(cfg.MetricsServer.Port),
-		cfg.MetricsServer.CertFile,
-		cfg.MetricsServer.KeyFile,
-		cfg.MetricsServer.CAFile,
-	)
-	if cfg.MetricsServer.CAFile == "" {
-		metricServerOption = metrics.WithPublicServer(int(cfg.MetricsServer.Port))
+	m, err := cfg.MetricsServer.NewRegistry(metricsLoggr)
+	if err != nil {
+		if cfg.MetricsServer.FatalOnBindFailure {
+			log.Fatalf("failed to start metrics server: %s", err)
+		}
+		log.Printf("METRICS SERVER FAILED TO START, METRICS ARE NOT SERVED: %s", err)
 	}
-	m := metrics.NewRegistry(
-		metricsLoggr,
-		metricServerOption,
-	)
 	if cfg.MetricsServer.DebugMetrics {
 		m.RegisterDebugMetrics()
 		pprofServer := &http.Server{
@@ -71,8 +64,23 @@ func main() {
 		WithGatewayLogger(gatewayLoggr),
 		WithGatewayVersion(cfg.Version),
 		WithGatewayBlock(),
+		WithGatewayMaxConcurrentQueries(cfg.MaxConcurrentQueries),
+		WithGatewayQueryTimeout(cfg.QueryTimeout),
+		WithGatewayMaxPointsPerSeries(cfg.MaxPointsPerSeries),
+		WithGatewayDefaultReadLookback(cfg.DefaultReadLookback),
+		WithGatewayCORS(cfg.CORSAllowedOrigins),
+		WithGatewayBackendHealthCheck(cfg.BackendHealthCheckInterval, cfg.BackendHealthCheckFailures),
 	}
 
+	if cfg.Compression {
+		gatewayOptions = append(gatewayOptions, WithGatewayCompression())
+	}
+	if cfg.WriteEnabled {
+		gatewayOptions = append(gatewayOptions, WithGatewayWrite())
+	}
+	if cfg.HTTPMetrics {
+		gatewayOptions = append(gatewayOptions, WithGatewayHTTPMetrics(m))
+	}
 	if cfg.ProxyCertPath != "" || cfg.ProxyKeyPath != "" {
 		gatewayOptions = append(gatewayOptions, WithGatewayTLSServer(cfg.ProxyCertPath, cfg.ProxyKeyPath))
 	}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	"code.cloudfoundry.org/tlsconfig"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/encoding/protodelim"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"code.cloudfoundry.org/log-cache/pkg/client"
+)
+
+// log-cache-export writes every envelope Log Cache holds for a source ID to
+// a file for offline analysis. It talks to the admin service, so the target
+// node must run with admin enabled.
+func main() {
+	addr := flag.String("addr", "localhost:8080", "address of a Log Cache node")
+	sourceID := flag.String("source-id", "", "source ID to export (required)")
+	since := flag.Duration("since", time.Hour, "how far back to export")
+	until := flag.Duration("until", 0, "how far back the export ends, 0 for now")
+	format := flag.String("format", "json", "output format: json (newline delimited) or proto (length delimited)")
+	output := flag.String("output", "", "file to write to, stdout if empty")
+	caPath := flag.String("ca", "/var/vcap/jobs/log-cache/config/certs/ca.crt", "CA certificate, leave empty to disable TLS")
+	certPath := flag.String("cert", "/var/vcap/jobs/log-cache/config/certs/log_cache.crt", "client certificate")
+	keyPath := flag.String("key", "/var/vcap/jobs/log-cache/config/certs/log_cache.key", "client key")
+	flag.Parse()
+
+	if *sourceID == "" {
+		log.Fatal("-source-id is required")
+	}
+
+	write, err := writer(*format)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	transport := grpc.WithTransportCredentials(insecure.NewCredentials())
+	if *caPath != "" {
+		tlsConfig, err := tlsconfig.Build(
+			tlsconfig.WithInternalServiceDefaults(),
+			tlsconfig.WithIdentityFromFile(*certPath, *keyPath),
+		).Client(
+			tlsconfig.WithAuthorityFromFile(*caPath),
+			tlsconfig.WithServerName("log-cache"),
+		)
+		if err != nil {
+			log.Fatalf("failed to build TLS config: %s", err)
+		}
+		transport = grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig))
+	}
+
+	conn, err := grpc.NewClient(*addr, transport)
+	if err != nil {
+		log.Fatalf("failed to dial %s: %s", *addr, err)
+	}
+	defer conn.Close()
+
+	out := io.Writer(os.Stdout)
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			log.Fatalf("failed to create %s: %s", *output, err)
+		}
+		defer f.Close()
+		out = f
+	}
+	buf := bufio.NewWriter(out)
+	defer buf.Flush()
+
+	now := time.Now()
+	var end time.Time
+	if *until > 0 {
+		end = now.Add(-*until)
+	}
+
+	stream, err := client.NewAdminClient(conn).ExportSourceID(context.Background(), *sourceID, now.Add(-*since), end)
+	if err != nil {
+		log.Fatalf("failed to start export: %s", err)
+	}
+
+	var exported int
+	for {
+		e, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			log.Fatalf("export failed after %d envelopes: %s", exported, err)
+		}
+
+		if err := write(buf, e); err != nil {
+			log.Fatalf("failed to write envelope: %s", err)
+		}
+		exported++
+	}
+
+	log.Printf("exported %d envelopes for %s", exported, *sourceID)
+}
+
+func writer(format string) (func(io.Writer, *loggregator_v2.Envelope) error, error) {
+	switch format {
+	case "json":
+		return func(w io.Writer, e *loggregator_v2.Envelope) error {
+			b, err := protojson.Marshal(e)
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Fprintf(w, "%s\n", b)
+			return err
+		}, nil
+	case "proto":
+		return func(w io.Writer, e *loggregator_v2.Envelope) error {
+			_, err := protodelim.MarshalTo(w, e)
+			return err
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown format %q, expected json or proto", format)
+	}
+}
@@ -1,12 +1,16 @@
 package main
 
 import (
+	"crypto/tls"
+	"fmt"
+	"log/slog"
 	"time"
 
 	"code.cloudfoundry.org/log-cache/internal/config"
+	"code.cloudfoundry.org/log-cache/internal/plumbing"
 
 	envstruct "code.cloudfoundry.org/go-envstruct"
-	"code.cloudfoundry.org/log-cache/internal/tls"
+	lctls "code.cloudfoundry.org/log-cache/internal/tls"
 )
 
 // Config is the configuration for a LogCache.
@@ -17,6 +21,29 @@ type Config struct {
 	// Smaller timeouts are recommended.
 	QueryTimeout time.Duration `env:"QUERY_TIMEOUT, report"`
 
+	// QuerySourceIDConcurrency sets how many source IDs a single PromQL
+	// query reads in parallel. Default is 10.
+	QuerySourceIDConcurrency int `env:"QUERY_SOURCE_ID_CONCURRENCY, report"`
+
+	// QueryCacheTTL sets how long instant PromQL query results are cached
+	// for repeated identical queries.
+	// Default is 0 (disabled)
+	QueryCacheTTL time.Duration `env:"QUERY_CACHE_TTL, report"`
+
+	// QueryCacheMaxEntries sets how many instant PromQL query results are
+	// cached. Default is 1000.
+	QueryCacheMaxEntries int `env:"QUERY_CACHE_MAX_ENTRIES, report"`
+
+	// SanitizeExemptMetricNames are metric names that PromQL queries match
+	// as they are instead of sanitizing them, e.g. names with colons.
+	// Default is none
+	SanitizeExemptMetricNames []string `env:"SANITIZE_EXEMPT_METRIC_NAMES, report"`
+
+	// SlowQueryThreshold sets how long a PromQL query may take before it is
+	// logged with its source IDs and elapsed time.
+	// Default is 0 (disabled)
+	SlowQueryThreshold time.Duration `env:"SLOW_QUERY_THRESHOLD, report"`
+
 	// MemoryLimitPercent sets the percentage of total system memory to use for the
 	// cache. If exceeded, the cache will prune. Default is 50%.
 	MemoryLimitPercent uint `env:"MEMORY_LIMIT_PERCENT, report"`
@@ -31,6 +58,12 @@ type Config struct {
 	// minute. Default is 100000.
 	MaxPerSource int `env:"MAX_PER_SOURCE, report"`
 
+	// MaxSourceIDs sets the maximum number of distinct source IDs stored.
+	// When a new source ID would exceed it, the least recently written
+	// source ID is evicted with all of its envelopes.
+	// Default is 0 (unlimited)
+	MaxSourceIDs int `env:"MAX_SOURCE_IDS, report"`
+
 	// TruncationInterval sets the delay between invocations of the
 	// truncation loop. This is where log-cache checks if memory utilization
 	// has gone above MemoryLimitPercent and evicts envelopes if it has.
@@ -45,6 +78,172 @@ type Config struct {
 	// Default is 3
 	PrunesPerGC int64 `env:"PRUNES_PER_GC, report"`
 
+	// HeapBuildParallelism sets how many goroutines read the oldest
+	// timestamp of every source ID when a truncation cycle builds its
+	// expiration heap. Raising it shortens truncation on nodes with many
+	// source IDs.
+	// Default is 1
+	HeapBuildParallelism int `env:"HEAP_BUILD_PARALLELISM, report"`
+
+	// TruncationBehindThreshold sets the number of envelopes above which
+	// the store is considered to be falling behind after a truncation cycle
+	// has pruned. When exceeded, the log_cache_truncation_behind metric is
+	// set and a warning is logged.
+	// Default is 0 (disabled)
+	TruncationBehindThreshold int64 `env:"TRUNCATION_BEHIND_THRESHOLD, report"`
+
+	// BackpressureThreshold sets the fraction (0 to 1) of the store that a
+	// truncation cycle has to prune for Send responses to ask writers to
+	// slow down with the log-cache-backpressure header.
+	// Default is 0 (disabled)
+	BackpressureThreshold float64 `env:"BACKPRESSURE_THRESHOLD, report"`
+
+	// MinRetention sets the age below which envelopes are never pruned by
+	// the truncation loop, even if that means briefly exceeding the memory
+	// limit.
+	// Default is 0 (disabled)
+	MinRetention time.Duration `env:"MIN_RETENTION, report"`
+
+	// TargetCachePeriod sets the cache period the truncation loop aims for
+	// while under memory pressure. Envelopes older than it are pruned more
+	// aggressively and, while the cache period is shorter, fewer envelopes
+	// are pruned.
+	// Default is 0 (disabled)
+	TargetCachePeriod time.Duration `env:"TARGET_CACHE_PERIOD, report"`
+
+	// SpilloverDir and SpilloverMaxBytes configure a ring buffer on disk
+	// that envelopes pruned by the truncation loop are written to instead
+	// of being dropped. Reads only return spilled envelopes when asked to.
+	// Default is 0 bytes (disabled)
+	SpilloverDir      string `env:"SPILLOVER_DIR, report"`
+	SpilloverMaxBytes int64  `env:"SPILLOVER_MAX_BYTES, report"`
+
+	// TopIngressSources sets how many of the source IDs with the most
+	// ingress are logged every TopIngressInterval. With debug metrics the
+	// last report is also served at /debug/top-ingress on the pprof port.
+	// Default is 0 (disabled)
+	TopIngressSources  int           `env:"TOP_INGRESS_SOURCES, report"`
+	TopIngressInterval time.Duration `env:"TOP_INGRESS_INTERVAL, report"`
+
+	// SelfMetricsSourceID sets the source ID under which the store's own
+	// metrics are written every SelfMetricsInterval, so that they can be
+	// read like any other source.
+	// Default is "" (disabled)
+	SelfMetricsSourceID string        `env:"SELF_METRICS_SOURCE_ID, report"`
+	SelfMetricsInterval time.Duration `env:"SELF_METRICS_INTERVAL, report"`
+
+	// MaxReadWindow sets the longest time range a single Read may cover.
+	// Longer reads are rejected with an InvalidArgument error.
+	// Default is 0 (disabled)
+	MaxReadWindow time.Duration `env:"MAX_READ_WINDOW, report"`
+
+	// TimestampFudge sets how far, in nanoseconds, the timestamp of an
+	// envelope may be moved forward to avoid colliding with a stored
+	// envelope from the same source. A value of 0 disables fudging.
+	// Default is 4000
+	TimestampFudge int64 `env:"TIMESTAMP_FUDGE, report"`
+
+	// RejectTimestampCollisions drops envelopes whose timestamp can not be
+	// fudged to a free value instead of replacing the stored envelope.
+	// Default is false
+	RejectTimestampCollisions bool `env:"REJECT_TIMESTAMP_COLLISIONS, report"`
+
+	// IngressLockTimeout is how long ingress waits for a contended source
+	// lock before dropping the envelope. A value of 0 always waits.
+	// Default is 0
+	IngressLockTimeout time.Duration `env:"INGRESS_LOCK_TIMEOUT, report"`
+
+	// MaxFutureSkew drops envelopes whose timestamp is further than this
+	// ahead of now. A value of 0 accepts any timestamp.
+	// Default is 0
+	MaxFutureSkew time.Duration `env:"MAX_FUTURE_SKEW, report"`
+
+	// DeduplicationWindow drops envelopes identical to one written for the
+	// same source ID within this window, such as those delivered by both
+	// nozzles of an HA pair. A value of 0 disables deduplication.
+	// Default is 0
+	DeduplicationWindow time.Duration `env:"DEDUPLICATION_WINDOW, report"`
+
+	// DeduplicationMaxEntries bounds the number of envelopes remembered for
+	// deduplication, and with it the memory it uses.
+	// Default is 100000
+	DeduplicationMaxEntries int `env:"DEDUPLICATION_MAX_ENTRIES, report"`
+
+	// EventSeverityTag is the tag holding the severity of event envelopes.
+	// Reads with a minimum severity only return events whose tag has at
+	// least that severity.
+	// Default is "severity"
+	EventSeverityTag string `env:"EVENT_SEVERITY_TAG, report"`
+
+	// EgressMetricsSourceIDs lists the source IDs that get their own
+	// log_cache_source_egress counter. Reads for all other source IDs are
+	// counted under "other".
+	// Default is empty (disabled)
+	EgressMetricsSourceIDs []string `env:"EGRESS_METRICS_SOURCE_IDS, report"`
+
+	// ProfilerLabelSourceIDs lists the source IDs whose reads and writes
+	// are labeled with their source ID in CPU profiles. It only applies
+	// when debug metrics are enabled.
+	// Default is empty (disabled)
+	ProfilerLabelSourceIDs []string `env:"PROFILER_LABEL_SOURCE_IDS, report"`
+
+	// AdminEnabled serves the admin gRPC service, which allows operators to
+	// purge all envelopes for a source ID or temporarily stop storing them.
+	// Default is false
+	AdminEnabled bool `env:"ADMIN_ENABLED, report"`
+
+	// CompressResponses gzips Read and Meta responses for every client
+	// that accepts gzip.
+	// Default is false
+	CompressResponses bool `env:"COMPRESS_RESPONSES, report"`
+
+	// InstanceIDSharding routes envelopes by source ID and instance ID
+	// instead of source ID alone. Reads then fan out to every node. All
+	// nodes must use the same setting.
+	// Default is false
+	InstanceIDSharding bool `env:"INSTANCE_ID_SHARDING, report"`
+
+	// RoutingTag routes envelopes that have this tag, e.g. a tenant ID, by
+	// its value instead of their source ID so that they are stored on the
+	// same node. Reads then fan out to every node. All nodes must use the
+	// same setting.
+	// Default is empty (disabled)
+	RoutingTag string `env:"ROUTING_TAG, report"`
+
+	// PeerOpTimeout bounds how long a Meta, or a Read with instance ID
+	// sharding, waits for each node. Nodes that do not respond in time are
+	// left out of the response.
+	// Default is 0 (wait for every node)
+	PeerOpTimeout time.Duration `env:"PEER_OP_TIMEOUT, report"`
+
+	// MetaCacheDuration is how long the meta gathered from every node is
+	// cached. Concurrent Meta requests share one round of requests to the
+	// nodes either way.
+	// Default is 1s, 0 disables the cache
+	MetaCacheDuration time.Duration `env:"META_CACHE_DURATION, report"`
+
+	// PeerWriteRetries is how many times a batch of envelopes that failed
+	// to send to the node that owns them is retried, each attempt timing
+	// out after PeerWriteTimeout. A batch that still fails is stored
+	// locally instead of being dropped, where only reads served by every
+	// node return it.
+	// Default is 0 (drop after one attempt) and 500ms
+	PeerWriteRetries int           `env:"PEER_WRITE_RETRIES, report"`
+	PeerWriteTimeout time.Duration `env:"PEER_WRITE_TIMEOUT, report"`
+
+	// RoutingSalt salts the source ID hash used to route envelopes between
+	// nodes. All nodes must use the same salt.
+	// Default is empty (no salt)
+	RoutingSalt string `env:"ROUTING_SALT, report"`
+
+	// WarmupPeerAddrs are replica LogCache addresses that are used to seed
+	// the store with recent envelopes on start. The node does not serve
+	// requests until warmup completes or WarmupTimeout elapses.
+	// Default is empty (disabled)
+	WarmupPeerAddrs []string      `env:"WARMUP_PEER_ADDRS, report"`
+	WarmupWindow    time.Duration `env:"WARMUP_WINDOW, report"`
+	WarmupTimeout   time.Duration `env:"WARMUP_TIMEOUT, report"`
+
 	// NodeIndex determines what data the node stores. It splits up the range
 	// of 0 - 18446744073709551615 evenly. If data falls out of range of the
 	// given node, it will be routed to theh correct one.
@@ -57,20 +256,50 @@ type Config struct {
 	// assumed that the current node is the only one.
 	NodeAddrs []string `env:"NODE_ADDRS, report"`
 
-	TLS           tls.TLS
+	TLS lctls.TLS
+
+	// TLSMinVersion sets the minimum TLS version the gRPC server accepts,
+	// either "1.2" or "1.3".
+	// Default is empty (TLS 1.2)
+	TLSMinVersion string `env:"TLS_MIN_VERSION, report"`
+
+	// TLSCipherSuites overrides the TLS 1.2 cipher suites the gRPC server
+	// accepts, using the names from the crypto/tls package such as
+	// TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256.
+	// Default is empty (the internal service defaults)
+	TLSCipherSuites []string `env:"TLS_CIPHER_SUITES, report"`
+
 	MetricsServer config.MetricsServer
 	UseRFC339     bool `env:"USE_RFC339"`
+
+	// LogLevel sets the lowest level that is logged: debug, info, warn or
+	// error.
+	// Default is info
+	LogLevel string `env:"LOG_LEVEL, report"`
 }
 
 // LoadConfig creates Config object from environment variables
 func LoadConfig() (*Config, error) {
 	c := Config{
-		Addr:               ":8080",
-		QueryTimeout:       10 * time.Second,
-		MemoryLimitPercent: 50,
-		MaxPerSource:       100000,
-		TruncationInterval: 1 * time.Second,
-		PrunesPerGC:        int64(3),
+		Addr:                     ":8080",
+		QueryTimeout:             10 * time.Second,
+		QuerySourceIDConcurrency: 10,
+		QueryCacheMaxEntries:     1000,
+		MemoryLimitPercent:       50,
+		MaxPerSource:             100000,
+		TruncationInterval:       1 * time.Second,
+		PrunesPerGC:              int64(3),
+		HeapBuildParallelism:     1,
+		TimestampFudge:           4000,
+		EventSeverityTag:         "severity",
+		DeduplicationMaxEntries:  100000,
+		PeerWriteTimeout:         500 * time.Millisecond,
+		MetaCacheDuration:        time.Second,
+		WarmupWindow:             15 * time.Minute,
+		WarmupTimeout:            30 * time.Second,
+		LogLevel:                 "info",
+		TopIngressInterval:       time.Minute,
+		SelfMetricsInterval:      time.Minute,
 		MetricsServer: config.MetricsServer{
 			Port: 6060,
 		},
@@ -80,5 +309,84 @@ func LoadConfig() (*Config, error) {
 		return nil, err
 	}
 
+	if _, err := c.MinTLSVersion(); err != nil {
+		return nil, err
+	}
+	if _, err := c.CipherSuites(); err != nil {
+		return nil, err
+	}
+	if _, err := c.Level(); err != nil {
+		return nil, err
+	}
+	if c.BackpressureThreshold < 0 || c.BackpressureThreshold > 1 {
+		return nil, fmt.Errorf("BACKPRESSURE_THRESHOLD must be between 0 and 1, got %g", c.BackpressureThreshold)
+	}
+	if c.TopIngressSources > 0 && c.TopIngressInterval <= 0 {
+		return nil, fmt.Errorf("TOP_INGRESS_INTERVAL must be positive, got %s", c.TopIngressInterval)
+	}
+	if c.HeapBuildParallelism < 1 {
+		return nil, fmt.Errorf("HEAP_BUILD_PARALLELISM must be at least 1, got %d", c.HeapBuildParallelism)
+	}
+	if c.DeduplicationWindow > 0 && c.DeduplicationMaxEntries < 1 {
+		return nil, fmt.Errorf("DEDUPLICATION_MAX_ENTRIES must be at least 1, got %d", c.DeduplicationMaxEntries)
+	}
+	if c.MetaCacheDuration < 0 {
+		return nil, fmt.Errorf("META_CACHE_DURATION must not be negative, got %s", c.MetaCacheDuration)
+	}
+	if c.PeerWriteRetries < 0 {
+		return nil, fmt.Errorf("PEER_WRITE_RETRIES must not be negative, got %d", c.PeerWriteRetries)
+	}
+	if c.PeerWriteRetries > 0 && c.PeerWriteTimeout <= 0 {
+		return nil, fmt.Errorf("PEER_WRITE_TIMEOUT must be positive, got %s", c.PeerWriteTimeout)
+	}
+	if c.SelfMetricsSourceID != "" && c.SelfMetricsInterval <= 0 {
+		return nil, fmt.Errorf("SELF_METRICS_INTERVAL must be positive, got %s", c.SelfMetricsInterval)
+	}
+
 	return &c, nil
 }
+
+// MinTLSVersion returns the crypto/tls version for TLSMinVersion, or 0 if
+// it is not set.
+func (c *Config) MinTLSVersion() (uint16, error) {
+	switch c.TLSMinVersion {
+	case "":
+		return 0, nil
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("TLS_MIN_VERSION must be 1.2 or 1.3, got %q", c.TLSMinVersion)
+	}
+}
+
+// CipherSuites returns the crypto/tls IDs for TLSCipherSuites. Insecure
+// cipher suites are rejected.
+func (c *Config) CipherSuites() ([]uint16, error) {
+	var ids []uint16
+	for _, name := range c.TLSCipherSuites {
+		id, ok := cipherSuiteID(name)
+		if !ok {
+			return nil, fmt.Errorf("TLS_CIPHER_SUITES contains unknown or insecure cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+func cipherSuiteID(name string) (uint16, bool) {
+	for _, s := range tls.CipherSuites() {
+		if s.Name == name {
+			return s.ID, true
+		}
+	}
+
+	return 0, false
+}
+
+// Level returns the slog level for LogLevel.
+func (c *Config) Level() (slog.Level, error) {
+	return plumbing.ParseLogLevel(c.LogLevel)
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 
 	//nolint:gosec
@@ -19,27 +20,24 @@ import (
 	"code.cloudfoundry.org/go-envstruct"
 	. "code.cloudfoundry.org/log-cache/internal/cache"
 	"code.cloudfoundry.org/log-cache/internal/plumbing"
+	lctls "code.cloudfoundry.org/log-cache/internal/tls"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
 )
 
 func main() {
-	var logger *log.Logger
-
 	cfg, err := LoadConfig()
 	if err != nil {
 		log.Fatalf("invalid configuration: %s", err)
 	}
 
-	if cfg.UseRFC339 {
-		logger = log.New(new(plumbing.LogWriter), "", 0)
-		log.SetOutput(new(plumbing.LogWriter))
-		log.SetFlags(0)
-	} else {
-		logger = log.New(os.Stderr, "", log.LstdFlags)
-		log.SetFlags(log.LstdFlags | log.Lmicroseconds)
-	}
+	level, _ := cfg.Level()
+	logger := plumbing.NewLogger(os.Stderr, level, cfg.UseRFC339)
+	// Route the standard logger through the same handler so that every
+	// line has the same format.
+	slog.SetDefault(logger)
+	stdLogger := slog.NewLogLogger(logger.Handler(), slog.LevelInfo)
 
 	log.Print("Starting Log Cache...")
 	defer log.Print("Closing Log Cache.")
@@ -49,21 +47,13 @@ func main() {
 		log.Printf("Failed to write a report of the from environment: %s\n", err)
 	}
 
-	metricServerOption := metrics.WithTLSServer(
-		int(cfg.MetricsServer.Port),
-		cfg.MetricsServer.CertFile,
-		cfg.MetricsServer.KeyFile,
-		cfg.MetricsServer.CAFile,
-	)
-
-	if cfg.MetricsServer.CAFile == "" {
-		metricServerOption = metrics.WithPublicServer(int(cfg.MetricsServer.Port))
+	m, err := cfg.MetricsServer.NewRegistry(stdLogger)
+	if err != nil {
+		if cfg.MetricsServer.FatalOnBindFailure {
+			log.Fatalf("failed to start metrics server: %s", err)
+		}
+		logger.Error("metrics server failed to start, metrics are not served", "error", err)
 	}
-
-	m := metrics.NewRegistry(
-		logger,
-		metricServerOption,
-	)
 	if cfg.MetricsServer.DebugMetrics {
 		m.RegisterDebugMetrics()
 		pprofServer := &http.Server{
@@ -71,7 +61,7 @@ func main() {
 			Handler:           http.DefaultServeMux,
 			ReadHeaderTimeout: 2 * time.Second,
 		}
-		go func() { logger.Println("PPROF SERVER STOPPED " + pprofServer.ListenAndServe().Error()) }()
+		go func() { logger.Error("pprof server stopped", "error", pprofServer.ListenAndServe()) }()
 	}
 
 	uptimeFn := m.NewGauge(
@@ -94,9 +84,33 @@ func main() {
 		WithMemoryLimitPercent(float64(cfg.MemoryLimitPercent)),
 		WithMemoryLimit(cfg.MemoryLimit),
 		WithMaxPerSource(cfg.MaxPerSource),
+		WithMaxSourceIDs(cfg.MaxSourceIDs),
 		WithQueryTimeout(cfg.QueryTimeout),
+		WithQuerySourceIDConcurrency(cfg.QuerySourceIDConcurrency),
+		WithQueryCache(cfg.QueryCacheTTL, cfg.QueryCacheMaxEntries),
+		WithSanitizeExemptMetricNames(cfg.SanitizeExemptMetricNames),
+		WithSlowQueryThreshold(cfg.SlowQueryThreshold),
 		WithTruncationInterval(cfg.TruncationInterval),
 		WithPrunesPerGC(cfg.PrunesPerGC),
+		WithHeapBuildParallelism(cfg.HeapBuildParallelism),
+		WithTruncationBehindThreshold(cfg.TruncationBehindThreshold),
+		WithBackpressureThreshold(cfg.BackpressureThreshold),
+		WithMinRetention(cfg.MinRetention),
+		WithTargetCachePeriod(cfg.TargetCachePeriod),
+		WithMaxReadWindow(cfg.MaxReadWindow),
+		WithPerSourceEgressMetrics(cfg.EgressMetricsSourceIDs),
+		WithTimestampFudge(cfg.TimestampFudge),
+		WithMetaCacheDuration(cfg.MetaCacheDuration),
+	}
+	if cfg.TopIngressSources > 0 {
+		logCacheOptions = append(logCacheOptions, WithTopIngressReport(cfg.TopIngressSources, cfg.TopIngressInterval))
+	}
+
+	if cfg.SelfMetricsSourceID != "" {
+		logCacheOptions = append(logCacheOptions, WithSelfMetrics(cfg.SelfMetricsSourceID, cfg.SelfMetricsInterval))
+	}
+	if cfg.SpilloverDir != "" && cfg.SpilloverMaxBytes > 0 {
+		logCacheOptions = append(logCacheOptions, WithSpillover(cfg.SpilloverDir, cfg.SpilloverMaxBytes))
 	}
 	var transport grpc.DialOption
 	if cfg.TLS.HasAnyCredential() {
@@ -110,6 +124,13 @@ func main() {
 		if err != nil {
 			panic(err)
 		}
+		// Serve and present the certificate from disk on every handshake
+		// so rotated files are picked up without a restart.
+		certReloader, err := lctls.NewCertReloader(cfg.TLS.CertPath, cfg.TLS.KeyPath, stdLogger)
+		if err != nil {
+			panic(err)
+		}
+		certReloader.Apply(tlsConfigClient)
 		transport = grpc.WithTransportCredentials(
 			credentials.NewTLS(tlsConfigClient),
 		)
@@ -122,7 +143,15 @@ func main() {
 		if err != nil {
 			panic(err)
 		}
-		logCacheOptions = append(logCacheOptions, WithServerOpts(grpc.Creds(credentials.NewTLS(tlsConfigServer)), grpc.MaxRecvMsgSize(50*1024*1024)))
+		certReloader.Apply(tlsConfigServer)
+		minTLSVersion, _ := cfg.MinTLSVersion()
+		cipherSuites, _ := cfg.CipherSuites()
+		logCacheOptions = append(logCacheOptions,
+			WithServerTLS(tlsConfigServer),
+			WithMinTLSVersion(minTLSVersion),
+			WithCipherSuites(cipherSuites...),
+			WithServerOpts(grpc.MaxRecvMsgSize(50*1024*1024)),
+		)
 	} else {
 		transport = grpc.WithTransportCredentials(insecure.NewCredentials())
 	}
@@ -133,11 +162,68 @@ func main() {
 		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(50*1024*1024)),
 	))
 
+	if cfg.RejectTimestampCollisions {
+		logCacheOptions = append(logCacheOptions, WithRejectTimestampCollisions())
+	}
+
+	if cfg.IngressLockTimeout > 0 {
+		logCacheOptions = append(logCacheOptions, WithIngressLockTimeout(cfg.IngressLockTimeout))
+	}
+
+	if cfg.MaxFutureSkew > 0 {
+		logCacheOptions = append(logCacheOptions, WithMaxFutureSkew(cfg.MaxFutureSkew))
+	}
+
+	if cfg.DeduplicationWindow > 0 {
+		logCacheOptions = append(logCacheOptions, WithDeduplication(cfg.DeduplicationWindow, cfg.DeduplicationMaxEntries))
+	}
+
+	if cfg.EventSeverityTag != "" {
+		logCacheOptions = append(logCacheOptions, WithEventSeverityTag(cfg.EventSeverityTag))
+	}
+
+	if cfg.MetricsServer.DebugMetrics && len(cfg.ProfilerLabelSourceIDs) > 0 {
+		logCacheOptions = append(logCacheOptions, WithProfilerLabels(cfg.ProfilerLabelSourceIDs))
+	}
+
+	if cfg.AdminEnabled {
+		logCacheOptions = append(logCacheOptions, WithAdminEnabled())
+	}
+
+	if cfg.CompressResponses {
+		logCacheOptions = append(logCacheOptions, WithResponseCompression())
+	}
+
+	if cfg.PeerOpTimeout > 0 {
+		logCacheOptions = append(logCacheOptions, WithPeerOpTimeout(cfg.PeerOpTimeout))
+	}
+
+	if cfg.PeerWriteRetries > 0 {
+		logCacheOptions = append(logCacheOptions, WithPeerWriteRetries(cfg.PeerWriteRetries, cfg.PeerWriteTimeout))
+	}
+	if cfg.InstanceIDSharding {
+		logCacheOptions = append(logCacheOptions, WithInstanceIDSharding())
+	}
+	if cfg.RoutingTag != "" {
+		logCacheOptions = append(logCacheOptions, WithTagRouting(cfg.RoutingTag))
+	}
+
+	if cfg.RoutingSalt != "" {
+		logCacheOptions = append(logCacheOptions, WithRoutingSalt(cfg.RoutingSalt))
+	}
+
+	if len(cfg.WarmupPeerAddrs) > 0 {
+		logCacheOptions = append(logCacheOptions, WithWarmup(cfg.WarmupPeerAddrs, cfg.WarmupWindow, cfg.WarmupTimeout))
+	}
+
 	cache := New(
 		m,
 		logger,
 		logCacheOptions...,
 	)
+	if cfg.MetricsServer.DebugMetrics && cfg.TopIngressSources > 0 {
+		http.Handle("/debug/top-ingress", cache.TopIngressHandler())
+	}
 
 	cache.Start()
 	waitForTermination()
@@ -1,10 +1,12 @@
 package main
 
 import (
+	"log/slog"
 	"time"
 
 	envstruct "code.cloudfoundry.org/go-envstruct"
 	"code.cloudfoundry.org/log-cache/internal/config"
+	"code.cloudfoundry.org/log-cache/internal/plumbing"
 	"code.cloudfoundry.org/log-cache/internal/tls"
 )
 
@@ -19,13 +21,27 @@ type Config struct {
 	SyslogTLSKeyPath  string `env:"SYSLOG_TLS_KEY_PATH, report"`
 
 	SyslogIdleTimeout           time.Duration `env:"SYSLOG_IDLE_TIMEOUT, report"`
+	SyslogMaxConnectionLifetime time.Duration `env:"SYSLOG_MAX_CONNECTION_LIFETIME, report"`
 	SyslogMaxMessageLength      int           `env:"SYSLOG_MAX_MESSAGE_LENGTH, report"`
 	SyslogTrimMessageWhitespace bool          `env:"SYSLOG_TRIM_MESSAGE_WHITESPACE, report"`
+	SyslogMaxConnections        int           `env:"SYSLOG_MAX_CONNECTIONS, report"`
 
 	SyslogClientTrustedCAFile string `env:"SYSLOG_CLIENT_TRUSTED_CA_FILE,  report"`
 
+	// DeadLetterPath is a file that a sample of the envelopes that fail to
+	// be written to Log Cache is appended to. At most DeadLetterRate
+	// envelopes are written each second.
+	// Default is empty (disabled)
+	DeadLetterPath string `env:"DEAD_LETTER_PATH, report"`
+	DeadLetterRate int    `env:"DEAD_LETTER_RATE, report"`
+
 	MetricsServer config.MetricsServer
 	UseRFC339     bool `env:"USE_RFC339"`
+
+	// LogLevel sets the lowest level that is logged: debug, info, warn or
+	// error. Rejected syslog messages are logged at debug.
+	// Default is info
+	LogLevel string `env:"LOG_LEVEL, report"`
 }
 
 // LoadConfig creates Config object from environment variables
@@ -39,11 +55,22 @@ func LoadConfig() (*Config, error) {
 		},
 		SyslogMaxMessageLength:      65 * 1024, // Diego should never send logs bigger than 64Kib
 		SyslogTrimMessageWhitespace: true,
+		DeadLetterRate:              10,
+		LogLevel:                    "info",
 	}
 
 	if err := envstruct.Load(&c); err != nil {
 		return nil, err
 	}
 
+	if _, err := c.Level(); err != nil {
+		return nil, err
+	}
+
 	return &c, nil
 }
+
+// Level returns the slog level for LogLevel.
+func (c *Config) Level() (slog.Level, error) {
+	return plumbing.ParseLogLevel(c.LogLevel)
+}
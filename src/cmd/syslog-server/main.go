@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 
 	//nolint:gosec
@@ -12,7 +13,6 @@ import (
 	"time"
 
 	"code.cloudfoundry.org/go-envstruct"
-	metrics "code.cloudfoundry.org/go-metric-registry"
 	. "code.cloudfoundry.org/log-cache/internal/nozzle"
 	"code.cloudfoundry.org/log-cache/internal/plumbing"
 	"code.cloudfoundry.org/log-cache/internal/syslog"
@@ -23,21 +23,16 @@ import (
 )
 
 func main() {
-	var loggr *log.Logger
-
 	cfg, err := LoadConfig()
 	if err != nil {
 		log.Fatalf("invalid configuration: %s", err)
 	}
 
-	if cfg.UseRFC339 {
-		loggr = log.New(new(plumbing.LogWriter), "[LOGGR] ", 0)
-		log.SetOutput(new(plumbing.LogWriter))
-		log.SetFlags(0)
-	} else {
-		loggr = log.New(os.Stderr, "[LOGGR] ", log.LstdFlags)
-		log.SetFlags(log.LstdFlags | log.Lmicroseconds)
-	}
+	level, _ := cfg.Level()
+	loggr := plumbing.NewLogger(os.Stderr, level, cfg.UseRFC339)
+	// Route the standard logger through the same handler so that every
+	// line has the same format.
+	slog.SetDefault(loggr)
 
 	log.Print("Starting Syslog Server...")
 	defer log.Print("Closing Syslog Server.")
@@ -47,20 +42,13 @@ func main() {
 		log.Printf("Failed to print a report of the from environment: %s\n", err)
 	}
 
-	metricServerOption := metrics.WithTLSServer(
-		int(cfg.MetricsServer.Port),
-		cfg.MetricsServer.CertFile,
-		cfg.MetricsServer.KeyFile,
-		cfg.MetricsServer.CAFile,
-	)
-	if cfg.MetricsServer.CAFile == "" {
-		metricServerOption = metrics.WithPublicServer(int(cfg.MetricsServer.Port))
+	m, err := cfg.MetricsServer.NewRegistry(slog.NewLogLogger(loggr.Handler(), slog.LevelInfo))
+	if err != nil {
+		if cfg.MetricsServer.FatalOnBindFailure {
+			log.Fatalf("failed to start metrics server: %s", err)
+		}
+		loggr.Error("metrics server failed to start, metrics are not served", "error", err)
 	}
-
-	m := metrics.NewRegistry(
-		loggr,
-		metricServerOption,
-	)
 	if cfg.MetricsServer.DebugMetrics {
 		m.RegisterDebugMetrics()
 		pprofServer := &http.Server{
@@ -68,14 +56,16 @@ func main() {
 			Handler:           http.DefaultServeMux,
 			ReadHeaderTimeout: 2 * time.Second,
 		}
-		go func() { loggr.Println("PPROF SERVER STOPPED " + pprofServer.ListenAndServe().Error()) }()
+		go func() { loggr.Error("pprof server stopped", "error", pprofServer.ListenAndServe()) }()
 	}
 
 	serverOptions := []syslog.ServerOption{
 		syslog.WithServerPort(cfg.SyslogPort),
 		syslog.WithIdleTimeout(cfg.SyslogIdleTimeout),
+		syslog.WithMaxConnectionLifetime(cfg.SyslogMaxConnectionLifetime),
 		syslog.WithServerMaxMessageLength(cfg.SyslogMaxMessageLength),
 		syslog.WithServerTrimMessageWhitespace(cfg.SyslogTrimMessageWhitespace),
+		syslog.WithMaxConnections(cfg.SyslogMaxConnections),
 	}
 	if cfg.SyslogTLSCertPath != "" || cfg.SyslogTLSKeyPath != "" {
 		serverOptions = append(serverOptions, syslog.WithServerTLS(cfg.SyslogTLSCertPath, cfg.SyslogTLSKeyPath))
@@ -109,6 +99,15 @@ func main() {
 		nozzleOptions = append(nozzleOptions, WithDialOpts(grpc.WithTransportCredentials(insecure.NewCredentials())))
 	}
 
+	if cfg.DeadLetterPath != "" {
+		f, err := os.OpenFile(cfg.DeadLetterPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+		if err != nil {
+			log.Fatalf("failed to open dead-letter log: %s", err)
+		}
+		defer f.Close()
+		nozzleOptions = append(nozzleOptions, WithDeadLetterLog(f, cfg.DeadLetterRate))
+	}
+
 	nozzle := NewNozzle(
 		server,
 		cfg.LogCacheAddr,
@@ -2,12 +2,13 @@ package auth
 
 import (
 	"log"
+	"math/rand"
 	"net/http"
 )
 
-func NewAccessMiddleware(accessLogger AccessLogger, host, port string) func(http.Handler) *AccessHandler {
+func NewAccessMiddleware(accessLogger AccessLogger, host, port string, opts ...AccessHandlerOption) func(http.Handler) *AccessHandler {
 	return func(handler http.Handler) *AccessHandler {
-		return NewAccessHandler(handler, accessLogger, host, port)
+		return NewAccessHandler(handler, accessLogger, host, port, opts...)
 	}
 }
 
@@ -16,6 +17,7 @@ func NewNullAccessMiddleware() func(http.Handler) *AccessHandler {
 		return &AccessHandler{
 			handler:      handler,
 			accessLogger: NewNullAccessLogger(),
+			sampleRate:   1,
 		}
 	}
 }
@@ -29,21 +31,75 @@ type AccessHandler struct {
 	accessLogger AccessLogger
 	host         string
 	port         string
+	sampleRate   float64
 }
 
-func NewAccessHandler(handler http.Handler, accessLogger AccessLogger, host, port string) *AccessHandler {
-	return &AccessHandler{
+// AccessHandlerOption configures an AccessHandler.
+type AccessHandlerOption func(h *AccessHandler)
+
+// WithAccessLogSampling returns an AccessHandlerOption that only logs the
+// given fraction (0 to 1) of requests, chosen at random. Requests that are
+// rejected as unauthorized (401) or forbidden (403) are always logged, so a
+// rate of 0 only logs auth failures. Defaults to 1, which logs every
+// request.
+func WithAccessLogSampling(rate float64) AccessHandlerOption {
+	return func(h *AccessHandler) {
+		h.sampleRate = rate
+	}
+}
+
+func NewAccessHandler(handler http.Handler, accessLogger AccessLogger, host, port string, opts ...AccessHandlerOption) *AccessHandler {
+	h := &AccessHandler{
 		handler:      handler,
 		accessLogger: accessLogger,
 		host:         host,
 		port:         port,
+		sampleRate:   1,
 	}
+
+	for _, o := range opts {
+		o(h)
+	}
+
+	return h
 }
 
 func (h *AccessHandler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if h.sampleRate >= 1 {
+		h.logAccess(req)
+		h.handler.ServeHTTP(rw, req)
+		return
+	}
+
+	// Whether a sampled out request is logged depends on its response, so
+	// it is only logged once it has been handled.
+	sr := &statusRecorder{ResponseWriter: rw, status: http.StatusOK}
+	h.handler.ServeHTTP(sr, req)
+
+	if sr.status == http.StatusUnauthorized || sr.status == http.StatusForbidden || rand.Float64() < h.sampleRate {
+		h.logAccess(req)
+	}
+}
+
+func (h *AccessHandler) logAccess(req *http.Request) {
 	if err := h.accessLogger.LogAccess(req, h.host, h.port); err != nil {
 		log.Printf("access handler: %s", err)
 	}
+}
+
+// statusRecorder records the status code written to a ResponseWriter.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
 
-	h.handler.ServeHTTP(rw, req)
+// Unwrap lets the reverse proxy still flush streamed responses, such as
+// NDJSON reads, through the recorder.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
 }
@@ -45,25 +45,72 @@ var _ = Describe("AccessHandler", func() {
 			Expect(spyLogger.port).To(Equal(port))
 		})
 	})
+
+	Context("with sampling", func() {
+		serve := func(status int) {
+			handler.status = status
+			req, err := testing.NewServerRequest("GET", "https://foo.bar/baz", nil)
+			Expect(err).ToNot(HaveOccurred())
+			resp := httptest.NewRecorder()
+
+			accessHandler.ServeHTTP(resp, req)
+			Expect(resp.Code).To(Equal(status))
+		}
+
+		It("samples out successful requests but always logs auth failures", func() {
+			accessHandler = auth.NewAccessMiddleware(spyLogger, host, port, auth.WithAccessLogSampling(0))(handler)
+
+			for i := 0; i < 100; i++ {
+				serve(http.StatusOK)
+			}
+			Expect(spyLogger.calls).To(Equal(0))
+
+			serve(http.StatusUnauthorized)
+			serve(http.StatusForbidden)
+			Expect(spyLogger.calls).To(Equal(2))
+		})
+
+		It("logs about the given fraction of requests", func() {
+			accessHandler = auth.NewAccessMiddleware(spyLogger, host, port, auth.WithAccessLogSampling(0.1))(handler)
+
+			for i := 0; i < 1000; i++ {
+				serve(http.StatusOK)
+			}
+			Expect(spyLogger.calls).To(BeNumerically("~", 100, 60))
+		})
+
+		It("logs every request by default", func() {
+			for i := 0; i < 10; i++ {
+				serve(http.StatusOK)
+			}
+			Expect(spyLogger.calls).To(Equal(10))
+		})
+	})
 })
 
 type spyHandler struct {
 	response http.ResponseWriter
 	request  *http.Request
+	status   int
 }
 
 func (s *spyHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
 	s.response = resp
 	s.request = req
+	if s.status != 0 {
+		resp.WriteHeader(s.status)
+	}
 }
 
 type spyAccessLogger struct {
 	request *http.Request
 	host    string
 	port    string
+	calls   int
 }
 
 func (s *spyAccessLogger) LogAccess(req *http.Request, host, port string) error {
+	s.calls++
 	s.request = req
 	s.host = host
 	s.port = port
@@ -21,6 +21,11 @@ type CAPIClient struct {
 	cacheExpirationInterval time.Duration
 	log                     *log.Logger
 
+	breakerThreshold int
+	breakerCooldown  time.Duration
+	breakerFailOpen  bool
+	breaker          *circuitBreaker
+
 	storeAppsLatency                 metrics.Gauge
 	storeListServiceInstancesLatency metrics.Gauge
 	storeAppsByNameLatency           metrics.Gauge
@@ -68,6 +73,10 @@ func NewCAPIClient(
 		opt(c)
 	}
 
+	if c.breakerThreshold > 0 {
+		c.breaker = newCircuitBreaker(c.breakerThreshold, c.breakerCooldown, m)
+	}
+
 	go c.pruneTokens()
 
 	return c
@@ -81,6 +90,27 @@ func WithCacheExpirationInterval(interval time.Duration) CAPIOption {
 	}
 }
 
+// WithCircuitBreaker configures the CAPIClient to stop sending requests to
+// CAPI for the cooldown period after threshold consecutive requests have
+// failed. A request fails if it errors or CAPI responds with a 5xx status.
+// While the breaker is open authorization is denied, unless
+// WithCircuitBreakerFailOpen is also given. A threshold of 0 disables the
+// breaker, which is the default.
+func WithCircuitBreaker(threshold int, cooldown time.Duration) CAPIOption {
+	return func(c *CAPIClient) {
+		c.breakerThreshold = threshold
+		c.breakerCooldown = cooldown
+	}
+}
+
+// WithCircuitBreakerFailOpen configures the CAPIClient to authorize every
+// request while the circuit breaker is open.
+func WithCircuitBreakerFailOpen() CAPIOption {
+	return func(c *CAPIClient) {
+		c.breakerFailOpen = true
+	}
+}
+
 func (c *CAPIClient) IsAuthorized(sourceId string, clientToken string) bool {
 	_, ok := c.tokenCache.Load(clientToken + sourceId)
 	if ok {
@@ -92,6 +122,10 @@ func (c *CAPIClient) IsAuthorized(sourceId string, clientToken string) bool {
 		return true
 	}
 
+	if c.breakerFailOpen && c.breaker.isOpen() {
+		return true
+	}
+
 	return false
 }
 
@@ -287,10 +321,15 @@ func (c *CAPIClient) pruneTokens() {
 }
 
 func (c *CAPIClient) doRequest(req *http.Request, authToken string, reporter metrics.Gauge) (*http.Response, error) {
+	if !c.breaker.allow() {
+		return nil, errCircuitOpen
+	}
+
 	req.Header.Set("Authorization", authToken)
 	start := time.Now()
 	resp, err := c.client.Do(req)
 	reporter.Set(float64(time.Since(start)))
+	c.breaker.record(err != nil || resp.StatusCode >= http.StatusInternalServerError)
 
 	if err != nil {
 		c.log.Printf("CAPI request (%s) failed: %s", req.URL.EscapedPath(), err)
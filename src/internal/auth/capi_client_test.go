@@ -240,6 +240,89 @@ var _ = Describe("CAPIClient", func() {
 		})
 	})
 
+	Describe("circuit breaker", func() {
+		failures := func(n int) []response {
+			var resps []response
+			for i := 0; i < n; i++ {
+				resps = append(resps, response{err: errors.New("connection refused")})
+			}
+			return resps
+		}
+
+		It("opens after the configured number of consecutive failures", func() {
+			tc := setup(auth.WithCircuitBreaker(4, time.Hour))
+			tc.capiClient.resps = failures(4)
+
+			Expect(tc.client.IsAuthorized("source-1", "some-token")).To(BeFalse())
+			Expect(tc.metrics.GetMetricValue("cf_auth_proxy_capi_circuit_breaker_state", nil)).To(BeZero())
+			Expect(tc.client.IsAuthorized("source-1", "some-token")).To(BeFalse())
+			Expect(tc.capiClient.requests).To(HaveLen(4))
+			Expect(tc.metrics.GetMetricValue("cf_auth_proxy_capi_circuit_breaker_state", nil)).To(Equal(1.0))
+
+			tc.capiClient.resps = []response{newCapiResp(http.StatusOK)}
+			Expect(tc.client.IsAuthorized("source-1", "some-token")).To(BeFalse())
+			Expect(tc.capiClient.requests).To(HaveLen(4))
+			Expect(tc.metrics.GetMetricValue("cf_auth_proxy_capi_short_circuited", nil)).To(Equal(2.0))
+		})
+
+		It("does not count denied authorizations as failures", func() {
+			tc := setup(auth.WithCircuitBreaker(2, time.Hour))
+			tc.capiClient.resps = []response{
+				newCapiResp(http.StatusNotFound),
+				newCapiResp(http.StatusForbidden),
+				newCapiResp(http.StatusOK),
+			}
+
+			Expect(tc.client.IsAuthorized("source-1", "some-token")).To(BeFalse())
+			Expect(tc.client.IsAuthorized("source-2", "some-token")).To(BeTrue())
+			Expect(tc.metrics.GetMetricValue("cf_auth_proxy_capi_circuit_breaker_state", nil)).To(BeZero())
+		})
+
+		It("half-opens after the cooldown and closes on success", func() {
+			tc := setup(auth.WithCircuitBreaker(2, 50*time.Millisecond))
+			tc.capiClient.resps = []response{
+				newCapiResp(http.StatusInternalServerError),
+				newCapiResp(http.StatusBadGateway),
+			}
+
+			Expect(tc.client.IsAuthorized("source-1", "some-token")).To(BeFalse())
+			Expect(tc.metrics.GetMetricValue("cf_auth_proxy_capi_circuit_breaker_state", nil)).To(Equal(1.0))
+
+			time.Sleep(100 * time.Millisecond)
+
+			tc.capiClient.resps = []response{newCapiResp(http.StatusOK)}
+			Expect(tc.client.IsAuthorized("source-1", "some-token")).To(BeTrue())
+			Expect(tc.capiClient.requests).To(HaveLen(3))
+			Expect(tc.metrics.GetMetricValue("cf_auth_proxy_capi_circuit_breaker_state", nil)).To(BeZero())
+		})
+
+		It("reopens when the half-open trial request fails", func() {
+			tc := setup(auth.WithCircuitBreaker(2, 50*time.Millisecond))
+			tc.capiClient.resps = failures(3)
+
+			Expect(tc.client.IsAuthorized("source-1", "some-token")).To(BeFalse())
+
+			time.Sleep(100 * time.Millisecond)
+
+			Expect(tc.client.IsAuthorized("source-1", "some-token")).To(BeFalse())
+			Expect(tc.capiClient.requests).To(HaveLen(3))
+			Expect(tc.metrics.GetMetricValue("cf_auth_proxy_capi_circuit_breaker_state", nil)).To(Equal(1.0))
+		})
+
+		It("authorizes requests while open when configured to fail open", func() {
+			tc := setup(
+				auth.WithCircuitBreaker(2, time.Hour),
+				auth.WithCircuitBreakerFailOpen(),
+			)
+			tc.capiClient.resps = failures(2)
+
+			Expect(tc.client.IsAuthorized("source-1", "some-token")).To(BeTrue())
+			Expect(tc.client.IsAuthorized("source-2", "some-token")).To(BeTrue())
+			Expect(tc.capiClient.requests).To(HaveLen(2))
+			Expect(tc.client.TokenCacheSize()).To(BeZero())
+		})
+	})
+
 	Describe("AvailableSourceIDs", func() {
 		It("returns the available app and service instance IDs", func() {
 			tc := setup()
@@ -2,7 +2,9 @@ package auth
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
 	"log"
@@ -15,6 +17,7 @@ import (
 
 	//TODO: why is this calling log-cache. use go-log-cache?
 	"code.cloudfoundry.org/log-cache/internal/promql"
+	"code.cloudfoundry.org/log-cache/pkg/client"
 )
 
 type CFAuthMiddlewareProvider struct {
@@ -23,6 +26,8 @@ type CFAuthMiddlewareProvider struct {
 	metaFetcher             MetaFetcher
 	promQLSourceIdExtractor PromQLSourceIdExtractor
 	appNameTranslator       AppNameTranslator
+
+	maxQuerySourceIDs int
 }
 
 type Oauth2ClientContext struct {
@@ -55,14 +60,33 @@ func NewCFAuthMiddlewareProvider(
 	logAuthorizer LogAuthorizer,
 	metaFetcher MetaFetcher,
 	promQLSourceIdExtractor PromQLSourceIdExtractor, appNameTranslator AppNameTranslator,
+	opts ...CFAuthMiddlewareOption,
 ) CFAuthMiddlewareProvider {
-	return CFAuthMiddlewareProvider{
+	m := CFAuthMiddlewareProvider{
 		oauth2Reader:            oauth2Reader,
 		logAuthorizer:           logAuthorizer,
 		metaFetcher:             metaFetcher,
 		promQLSourceIdExtractor: promQLSourceIdExtractor,
 		appNameTranslator:       appNameTranslator,
 	}
+
+	for _, o := range opts {
+		o(&m)
+	}
+
+	return m
+}
+
+// CFAuthMiddlewareOption configures a CFAuthMiddlewareProvider.
+type CFAuthMiddlewareOption func(m *CFAuthMiddlewareProvider)
+
+// WithMaxQuerySourceIDs rejects PromQL queries that read more than n source
+// IDs once their source IDs are expanded to all related source IDs. It
+// defaults to 0, which does not limit queries.
+func WithMaxQuerySourceIDs(n int) CFAuthMiddlewareOption {
+	return func(m *CFAuthMiddlewareProvider) {
+		m.maxQuerySourceIDs = n
+	}
 }
 
 type promqlErrorBody struct {
@@ -110,37 +134,19 @@ func (m CFAuthMiddlewareProvider) Middleware(h http.Handler) http.Handler {
 			return
 		}
 
-		query := r.URL.Query().Get("query")
+		query := m.resolveSourceIdPatterns(r.Context(), r.URL.Query().Get("query"), authToken)
 		sourceIds, err := m.promQLSourceIdExtractor(query)
 		if err != nil {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusBadRequest)
-
-			err = json.NewEncoder(w).Encode(&promqlErrorBody{
-				Status:    "error",
-				ErrorType: "bad_data",
-				Error:     err.Error(),
-			})
-			if err != nil {
-				log.Printf("bad data: %v\n", err)
-			}
-
+			writeBadData(w, err.Error())
 			return
 		}
 
 		if len(sourceIds) == 0 {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusBadRequest)
-
-			err = json.NewEncoder(w).Encode(&promqlErrorBody{
-				Status:    "error",
-				ErrorType: "bad_data",
-				Error:     "query does not request any source_ids",
-			})
-			if err != nil {
-				log.Println("bad_data: query does not request any source_ids")
-			}
+			writeBadData(w, "query does not request any source_ids")
+			return
+		}
 
+		if m.exceedsMaxQuerySourceIDs(w, len(sourceIds)) {
 			return
 		}
 
@@ -157,6 +163,7 @@ func (m CFAuthMiddlewareProvider) Middleware(h http.Handler) http.Handler {
 			return
 		}
 
+		var expanded int
 		for _, sourceId := range sourceIds {
 			sourceIdSet := append(relatedSourceIds[sourceId], sourceId)
 
@@ -170,6 +177,11 @@ func (m CFAuthMiddlewareProvider) Middleware(h http.Handler) http.Handler {
 			}
 
 			relatedSourceIds[sourceId] = sourceIdSet
+			expanded += len(sourceIdSet)
+		}
+
+		if m.exceedsMaxQuerySourceIDs(w, expanded) {
+			return
 		}
 
 		modifiedQuery, err := promql.ReplaceSourceIdSets(query, relatedSourceIds)
@@ -186,6 +198,61 @@ func (m CFAuthMiddlewareProvider) Middleware(h http.Handler) http.Handler {
 		h.ServeHTTP(w, r)
 	})
 
+	// Series selectors are not expanded to related source IDs, so a
+	// non-admin must be authorized for every source ID they name.
+	router.HandleFunc("/api/v1/series", func(w http.ResponseWriter, r *http.Request) {
+		authToken := r.Header.Get("Authorization")
+		if authToken == "" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if err := r.ParseForm(); err != nil {
+			writeBadData(w, err.Error())
+			return
+		}
+
+		var sourceIds []string
+		for _, selector := range r.Form["match[]"] {
+			ids, err := m.promQLSourceIdExtractor(selector)
+			if err != nil {
+				writeBadData(w, err.Error())
+				return
+			}
+			sourceIds = append(sourceIds, ids...)
+		}
+
+		if len(sourceIds) == 0 {
+			writeBadData(w, "series selectors do not request any source_ids")
+			return
+		}
+
+		if m.exceedsMaxQuerySourceIDs(w, len(sourceIds)) {
+			return
+		}
+
+		c, err := m.oauth2Reader.Read(authToken)
+		if err != nil {
+			log.Printf("failed to read from Oauth2 server: %s", err)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if !c.IsAdmin && len(m.authorizeSourceIds(sourceIds, c)) != len(sourceIds) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		// ParseForm consumed a form body, so pass on the authorized
+		// selectors as the query.
+		r.URL.RawQuery = r.Form.Encode()
+		r.Body = http.NoBody
+		r.ContentLength = 0
+		r.Header.Del("Content-Type")
+
+		h.ServeHTTP(w, r)
+	})
+
 	router.HandleFunc("/api/v1/meta", func(w http.ResponseWriter, r *http.Request) {
 		authToken := r.Header.Get("Authorization")
 		if authToken == "" {
@@ -207,21 +274,113 @@ func (m CFAuthMiddlewareProvider) Middleware(h http.Handler) http.Handler {
 			return
 		}
 
-		// We don't care if writing to the client fails. They can come back and ask again.
-		msg, _ := protojson.Marshal(&rpc.MetaResponse{
+		resp := &rpc.MetaResponse{
 			Meta: m.onlyAuthorized(authToken, meta, c),
-		})
+		}
+		msg, _ := protojson.Marshal(resp)
+		if retention, _ := strconv.ParseBool(r.URL.Query().Get(client.EffectiveRetentionParam)); retention {
+			msg, err = client.AddEffectiveRetention(msg, resp, time.Now())
+			if err != nil {
+				log.Printf("failed to add effective retention: %s", err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+		}
+
+		// We don't care if writing to the client fails. They can come back and ask again.
 		//nolint:errcheck
 		w.Write(msg)
 		//nolint:errcheck
 		w.Write([]byte("\n"))
 	})
 
+	// Writes can add envelopes to any source ID, so only admins may make
+	// them.
+	router.HandleFunc("/api/v1/write", func(w http.ResponseWriter, r *http.Request) {
+		authToken := r.Header.Get("Authorization")
+		if authToken == "" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		c, err := m.oauth2Reader.Read(authToken)
+		if err != nil {
+			log.Printf("failed to read from Oauth2 server: %s", err)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if !c.IsAdmin {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+
 	router.HandleFunc("/api/v1/info", h.ServeHTTP)
 
 	return router
 }
 
+// exceedsMaxQuerySourceIDs writes a bad_data error and returns true if a
+// query reading n source IDs is over the configured maximum.
+func (m CFAuthMiddlewareProvider) exceedsMaxQuerySourceIDs(w http.ResponseWriter, n int) bool {
+	if m.maxQuerySourceIDs <= 0 || n <= m.maxQuerySourceIDs {
+		return false
+	}
+
+	writeBadData(w, fmt.Sprintf("query reads %d source_ids, more than the maximum of %d", n, m.maxQuerySourceIDs))
+
+	return true
+}
+
+// writeBadData writes a PromQL bad_data error with the message msg.
+func writeBadData(w http.ResponseWriter, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+
+	err := json.NewEncoder(w).Encode(&promqlErrorBody{
+		Status:    "error",
+		ErrorType: "bad_data",
+		Error:     msg,
+	})
+	if err != nil {
+		log.Printf("failed to write bad_data error: %v", err)
+	}
+}
+
+// resolveSourceIdPatterns replaces source_id patterns in the query with the
+// source IDs in Log Cache that match them and the client may read. If that
+// fails the query is returned as is and its patterns are taken as source
+// IDs.
+func (m CFAuthMiddlewareProvider) resolveSourceIdPatterns(ctx context.Context, query, authToken string) string {
+	resolved, err := promql.ResolveSourceIdPatterns(query, func() ([]string, error) {
+		c, err := m.oauth2Reader.Read(authToken)
+		if err != nil {
+			return nil, err
+		}
+
+		meta, err := m.metaFetcher.Meta(ctx)
+		if err != nil {
+			log.Printf("failed to fetch meta information to resolve source ID patterns: %s", err)
+			return nil, err
+		}
+
+		var sourceIds []string
+		for sourceId := range m.onlyAuthorized(authToken, meta, c) {
+			sourceIds = append(sourceIds, sourceId)
+		}
+
+		return sourceIds, nil
+	})
+	if err != nil {
+		return query
+	}
+
+	return resolved
+}
+
 func (m CFAuthMiddlewareProvider) authorizeSourceIds(sourceIds []string, c Oauth2ClientContext) []string {
 	var authorizedSourceIds []string
 
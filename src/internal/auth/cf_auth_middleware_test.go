@@ -1,11 +1,16 @@
 package auth_test
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"code.cloudfoundry.org/log-cache/internal/auth"
 	"google.golang.org/protobuf/encoding/protojson"
@@ -34,7 +39,7 @@ type testContext struct {
 	authHandler        http.Handler
 }
 
-func setup(requestPath string) *testContext {
+func setup(requestPath string, opts ...auth.CFAuthMiddlewareOption) *testContext {
 	spyOauth2ClientReader := newAdminChecker()
 	spyLogAuthorizer := newSpyLogAuthorizer()
 	spyMetaFetcher := newSpyMetaFetcher()
@@ -47,6 +52,7 @@ func setup(requestPath string) *testContext {
 		spyMetaFetcher,
 		spyPromQLParser.ExtractSourceIds,
 		spyAppNameTranslator,
+		opts...,
 	)
 
 	request := httptest.NewRequest(http.MethodGet, requestPath, nil)
@@ -202,6 +208,26 @@ var _ = Describe("CfAuthMiddleware", func() {
 			Expect(tc.spyMetaFetcher.ctx.Done()).To(BeClosed())
 		})
 
+		It("adds the effective retention of each source ID when asked to", func() {
+			tc := setup("/api/v1/meta?effective_retention=true")
+			tc.spyMetaFetcher.result = map[string]*rpc.MetaInfo{
+				"source-0": {OldestTimestamp: time.Now().Add(-time.Minute).UnixNano()},
+			}
+			tc.spyOauth2ClientReader.isAdminResult = true
+
+			tc.invokeAuthHandler()
+
+			Expect(tc.recorder.Code).To(Equal(http.StatusOK))
+			var body struct {
+				Meta map[string]map[string]interface{} `json:"meta"`
+			}
+			Expect(json.Unmarshal(tc.recorder.Body.Bytes(), &body)).To(Succeed())
+
+			retention, err := strconv.ParseInt(body.Meta["source-0"]["effective_retention_ms"].(string), 10, 64)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(retention).To(BeNumerically("~", time.Minute.Milliseconds(), 5000))
+		})
+
 		It("appends a newline to the response", func() {
 			tc := setup("/api/v1/meta")
 			tc.spyMetaFetcher.result = map[string]*rpc.MetaInfo{}
@@ -301,6 +327,63 @@ var _ = Describe("CfAuthMiddleware", func() {
 			Expect(tc.spyLogAuthorizer.sourceIDsCalledWith).To(HaveKey("app-guid-1"))
 		})
 
+		It("expands a source ID prefix to the source IDs known to Meta", func() {
+			tc := setup(`/api/v1/query?query=metric{source_id=~"app-.*"}`)
+			tc.spyOauth2ClientReader.isAdminResult = true
+			tc.spyMetaFetcher.result = map[string]*rpc.MetaInfo{
+				"app-2":        {},
+				"app-1":        {},
+				"other":        {},
+				"not-an-app-3": {},
+			}
+			tc.spyPromQLParser.sourceIDs = []string{"app-1", "app-2"}
+
+			tc.invokeAuthHandler()
+
+			Expect(tc.recorder.Code).To(Equal(http.StatusOK))
+			Expect(tc.spyPromQLParser.query).To(Equal(`metric{source_id=~"app-1|app-2"}`))
+			Expect(tc.baseHandlerRequest.URL.Query().Get("query")).To(
+				Equal(`metric{source_id=~"app-1|app-2"}`),
+			)
+		})
+
+		It("only expands a source ID prefix to source IDs a non-admin may read", func() {
+			tc := setup(`/api/v1/query?query=metric{source_id=~"app-.*"}`)
+			tc.spyMetaFetcher.result = map[string]*rpc.MetaInfo{
+				"app-1": {},
+				"app-2": {},
+			}
+			tc.spyLogAuthorizer.available = []string{"app-2"}
+			tc.spyPromQLParser.sourceIDs = []string{"app-2"}
+
+			tc.invokeAuthHandler()
+
+			Expect(tc.spyPromQLParser.query).To(Equal(`metric{source_id=~"app-2"}`))
+			Expect(tc.baseHandlerRequest.URL.Query().Get("query")).To(
+				Equal(`metric{source_id="app-2"}`),
+			)
+		})
+
+		It("does not fetch Meta for queries without a source ID pattern", func() {
+			tc := setup(`/api/v1/query?query=metric{source_id=~"some-id|other.id"}`)
+			tc.spyOauth2ClientReader.isAdminResult = true
+
+			tc.invokeAuthHandler()
+
+			Expect(tc.spyMetaFetcher.called).To(BeZero())
+			Expect(tc.spyPromQLParser.query).To(Equal(`metric{source_id=~"some-id|other.id"}`))
+		})
+
+		It("leaves a source ID pattern as it is if Meta fails", func() {
+			tc := setup(`/api/v1/query?query=metric{source_id=~"app-.*"}`)
+			tc.spyOauth2ClientReader.isAdminResult = true
+			tc.spyMetaFetcher.err = errors.New("expected")
+
+			tc.invokeAuthHandler()
+
+			Expect(tc.spyPromQLParser.query).To(Equal(`metric{source_id=~"app-.*"}`))
+		})
+
 		It("returns 400 Bad Request if a query doesn't have a source_id", func() {
 			tc := setup(`/api/v1/query?query=metric{source_id="some-id"}`)
 			tc.spyPromQLParser.sourceIDs = nil
@@ -316,6 +399,49 @@ var _ = Describe("CfAuthMiddleware", func() {
 			Expect(tc.baseHandlerCalled).To(BeFalse())
 		})
 
+		It("returns 400 Bad Request if a query reads more than the maximum source IDs", func() {
+			tc := setup(`/api/v1/query?query=metric{source_id=~"a|b|c"}`, auth.WithMaxQuerySourceIDs(2))
+			tc.spyPromQLParser.sourceIDs = []string{"a", "b", "c"}
+			tc.spyOauth2ClientReader.isAdminResult = true
+
+			tc.invokeAuthHandler()
+
+			Expect(tc.recorder.Code).To(Equal(http.StatusBadRequest))
+			Expect(tc.recorder.Body.String()).To(unmarshalledmatchers.ContainUnorderedJSON(`{
+				"status": "error",
+				"errorType": "bad_data",
+				"error": "query reads 3 source_ids, more than the maximum of 2"
+			}`))
+			Expect(tc.spyAppNameTranslator.calledWith).To(BeEmpty())
+			Expect(tc.baseHandlerCalled).To(BeFalse())
+		})
+
+		It("returns 400 Bad Request if related source IDs expand a query past the maximum", func() {
+			tc := setup(`/api/v1/query?query=metric{source_id="some-id"}`, auth.WithMaxQuerySourceIDs(2))
+			tc.spyAppNameTranslator.relatedIds = map[string][]string{"some-id": {"app-guid-1", "app-guid-2"}}
+			tc.spyOauth2ClientReader.isAdminResult = true
+
+			tc.invokeAuthHandler()
+
+			Expect(tc.recorder.Code).To(Equal(http.StatusBadRequest))
+			Expect(tc.recorder.Body.String()).To(unmarshalledmatchers.ContainUnorderedJSON(`{
+				"status": "error",
+				"errorType": "bad_data"
+			}`))
+			Expect(tc.baseHandlerCalled).To(BeFalse())
+		})
+
+		It("forwards a query at the maximum source IDs", func() {
+			tc := setup(`/api/v1/query?query=metric{source_id="some-id"}`, auth.WithMaxQuerySourceIDs(2))
+			tc.spyAppNameTranslator.relatedIds = map[string][]string{"some-id": {"app-guid-1"}}
+			tc.spyOauth2ClientReader.isAdminResult = true
+
+			tc.invokeAuthHandler()
+
+			Expect(tc.recorder.Code).To(Equal(http.StatusOK))
+			Expect(tc.baseHandlerCalled).To(BeTrue())
+		})
+
 		It("returns 400 Bad Request for an invalid query", func() {
 			tc := setup(`/api/v1/query?query=wrong{source_id=some-id}`)
 			tc.spyPromQLParser.err = errors.New("some-error")
@@ -378,6 +504,126 @@ var _ = Describe("CfAuthMiddleware", func() {
 		})
 	})
 
+	Describe("/api/v1/series", func() {
+		It("forwards the request to the handler if user is an admin", func() {
+			tc := setup(`/api/v1/series?match[]=metric{source_id="some-id"}`)
+			tc.spyOauth2ClientReader.isAdminResult = true
+
+			tc.invokeAuthHandler()
+
+			Expect(tc.recorder.Code).To(Equal(http.StatusOK))
+			Expect(tc.baseHandlerCalled).To(BeTrue())
+			Expect(tc.spyPromQLParser.query).To(Equal(`metric{source_id="some-id"}`))
+		})
+
+		It("forwards the request to the handler if non-admin user has log access", func() {
+			tc := setup(`/api/v1/series?match[]=metric{source_id="some-id"}&match[]=other{source_id="other-id"}`)
+			tc.spyPromQLParser.sourceIDs = []string{"some-id", "other-id"}
+
+			tc.invokeAuthHandler()
+
+			Expect(tc.recorder.Code).To(Equal(http.StatusOK))
+			Expect(tc.baseHandlerCalled).To(BeTrue())
+			Expect(tc.spyLogAuthorizer.token).To(Equal("bearer valid-token"))
+			Expect(tc.spyLogAuthorizer.sourceIDsCalledWith).To(HaveKey("some-id"))
+			Expect(tc.spyLogAuthorizer.sourceIDsCalledWith).To(HaveKey("other-id"))
+		})
+
+		It("returns 404 Not Found if user is not authorized for a source ID", func() {
+			tc := setup(`/api/v1/series?match[]=metric{source_id="some-id"}&match[]=other{source_id="other-id"}`)
+			tc.spyPromQLParser.sourceIDs = []string{"some-id", "other-id"}
+			tc.spyLogAuthorizer.unauthorizedSourceIds["other-id"] = struct{}{}
+
+			tc.invokeAuthHandler()
+
+			Expect(tc.recorder.Code).To(Equal(http.StatusNotFound))
+			Expect(tc.baseHandlerCalled).To(BeFalse())
+		})
+
+		It("authorizes selectors sent as a form", func() {
+			tc := setup(`/api/v1/series`)
+			tc.request = httptest.NewRequest(http.MethodPost, "/api/v1/series", strings.NewReader(
+				url.Values{"match[]": {`metric{source_id="some-id"}`}}.Encode(),
+			))
+			tc.request.Header.Set("Authorization", "bearer valid-token")
+			tc.request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+			tc.invokeAuthHandler()
+
+			Expect(tc.recorder.Code).To(Equal(http.StatusOK))
+			Expect(tc.spyLogAuthorizer.sourceIDsCalledWith).To(HaveKey("some-id"))
+			Expect(tc.baseHandlerRequest.URL.Query()["match[]"]).To(ConsistOf(`metric{source_id="some-id"}`))
+		})
+
+		It("returns 400 Bad Request without a selector", func() {
+			tc := setup(`/api/v1/series`)
+			tc.spyOauth2ClientReader.isAdminResult = true
+
+			tc.invokeAuthHandler()
+
+			Expect(tc.recorder.Code).To(Equal(http.StatusBadRequest))
+			Expect(tc.baseHandlerCalled).To(BeFalse())
+		})
+
+		It("returns 400 Bad Request for an invalid selector", func() {
+			tc := setup(`/api/v1/series?match[]=wrong{source_id=some-id}`)
+			tc.spyPromQLParser.err = errors.New("some-error")
+
+			tc.invokeAuthHandler()
+
+			Expect(tc.recorder.Code).To(Equal(http.StatusBadRequest))
+			Expect(tc.recorder.Body.String()).To(unmarshalledmatchers.ContainUnorderedJSON(`{
+				"status": "error",
+				"errorType": "bad_data"
+			}`))
+			Expect(tc.baseHandlerCalled).To(BeFalse())
+		})
+	})
+
+	Describe("/api/v1/write", func() {
+		It("forwards the request to the handler if user is an admin", func() {
+			tc := setup("/api/v1/write")
+			tc.spyOauth2ClientReader.isAdminResult = true
+
+			tc.invokeAuthHandler()
+
+			Expect(tc.recorder.Code).To(Equal(http.StatusOK))
+			Expect(tc.baseHandlerCalled).To(BeTrue())
+			Expect(tc.spyOauth2ClientReader.token).To(Equal("bearer valid-token"))
+		})
+
+		It("returns 404 Not Found if user is not an admin", func() {
+			tc := setup("/api/v1/write")
+
+			tc.invokeAuthHandler()
+
+			Expect(tc.recorder.Code).To(Equal(http.StatusNotFound))
+			Expect(tc.baseHandlerCalled).To(BeFalse())
+		})
+
+		It("returns 404 Not Found if there's no authorization header present", func() {
+			tc := setup("/api/v1/write")
+			tc.request.Header.Del("Authorization")
+			tc.spyOauth2ClientReader.isAdminResult = true
+
+			tc.invokeAuthHandler()
+
+			Expect(tc.recorder.Code).To(Equal(http.StatusNotFound))
+			Expect(tc.baseHandlerCalled).To(BeFalse())
+		})
+
+		It("returns 404 Not Found if Oauth2ClientReader returns an error", func() {
+			tc := setup("/api/v1/write")
+			tc.spyOauth2ClientReader.isAdminResult = true
+			tc.spyOauth2ClientReader.err = errors.New("some-error")
+
+			tc.invokeAuthHandler()
+
+			Expect(tc.recorder.Code).To(Equal(http.StatusNotFound))
+			Expect(tc.baseHandlerCalled).To(BeFalse())
+		})
+	})
+
 	Describe("/api/v1/info", func() {
 		It("forwards the request to the handler without requiring authentication", func() {
 			tc := setup(`/api/v1/info`)
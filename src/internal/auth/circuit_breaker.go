@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	metrics "code.cloudfoundry.org/go-metric-registry"
+)
+
+var errCircuitOpen = errors.New("CAPI circuit breaker is open")
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+// circuitBreaker stops requests to CAPI after a number of consecutive
+// failures. Once the cooldown has elapsed a single trial request is let
+// through (half-open); its outcome either closes the breaker or opens it
+// for another cooldown. A nil circuitBreaker allows every request.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    circuitState
+	failures int
+	openedAt time.Time
+
+	stateGauge     metrics.Gauge
+	shortCircuited metrics.Counter
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration, m Metrics) *circuitBreaker {
+	return &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		stateGauge: m.NewGauge(
+			"cf_auth_proxy_capi_circuit_breaker_state",
+			"State of the CAPI circuit breaker: 0 is closed, 1 is open and 2 is half-open.",
+		),
+		shortCircuited: m.NewCounter(
+			"cf_auth_proxy_capi_short_circuited",
+			"Total number of CAPI requests rejected because the circuit breaker was open.",
+		),
+	}
+}
+
+// allow reports whether a request may be sent to CAPI.
+func (b *circuitBreaker) allow() bool {
+	if b == nil {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case circuitOpen:
+		if time.Since(b.openedAt) >= b.cooldown {
+			b.setState(circuitHalfOpen)
+			return true
+		}
+	case circuitHalfOpen:
+		// The trial request is still in flight.
+	default:
+		return true
+	}
+
+	b.shortCircuited.Add(1)
+	return false
+}
+
+// record reports the outcome of a request that allow let through.
+func (b *circuitBreaker) record(failed bool) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !failed {
+		b.failures = 0
+		b.setState(circuitClosed)
+		return
+	}
+
+	b.failures++
+	if b.state == circuitHalfOpen || b.failures >= b.threshold {
+		b.openedAt = time.Now()
+		b.setState(circuitOpen)
+	}
+}
+
+// isOpen reports whether requests are currently being short-circuited.
+func (b *circuitBreaker) isOpen() bool {
+	if b == nil {
+		return false
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state != circuitClosed
+}
+
+func (b *circuitBreaker) setState(s circuitState) {
+	b.state = s
+	b.stateGauge.Set(float64(s))
+}
@@ -23,6 +23,7 @@ import (
 )
 
 type Metrics interface {
+	NewCounter(name, helpText string, opts ...metrics.MetricOption) metrics.Counter
 	NewGauge(name, helpText string, opts ...metrics.MetricOption) metrics.Gauge
 }
 
@@ -39,6 +40,7 @@ type UAAClient struct {
 	username               string
 	password               string
 	lastQueryTime          int64
+	maxTokenAge            time.Duration
 }
 
 func NewUAAClient(
@@ -85,6 +87,16 @@ func WithBasicAuth(username, password string) UAAOption {
 	}
 }
 
+// WithMaxTokenAge rejects tokens issued more than maxAge ago, according to
+// their iat claim, even if they have not expired yet. Tokens without an iat
+// claim are rejected as well. It defaults to 0, which only rejects expired
+// tokens.
+func WithMaxTokenAge(maxAge time.Duration) UAAOption {
+	return func(c *UAAClient) {
+		c.maxTokenAge = maxAge
+	}
+}
+
 func (c *UAAClient) RefreshTokenKeys() error {
 	lastQueryTime := atomic.LoadInt64(&c.lastQueryTime)
 	nextAllowedRefreshTime := time.Unix(0, lastQueryTime).Add(c.minimumRefreshInterval)
@@ -232,6 +244,21 @@ func (c *UAAClient) Read(token string) (Oauth2ClientContext, error) {
 		return Oauth2ClientContext{}, fmt.Errorf("token is expired, exp = %s", decodedToken.ExpTime)
 	}
 
+	expiresAt := decodedToken.ExpTime
+	if c.maxTokenAge > 0 {
+		if decodedToken.Iat == 0 {
+			return Oauth2ClientContext{}, errors.New("token has no iat claim")
+		}
+
+		maxAgeTime := decodedToken.IatTime.Add(c.maxTokenAge)
+		if time.Now().After(maxAgeTime) {
+			return Oauth2ClientContext{}, fmt.Errorf("token is older than the maximum age of %s, iat = %s", c.maxTokenAge, decodedToken.IatTime)
+		}
+		if maxAgeTime.Before(expiresAt) {
+			expiresAt = maxAgeTime
+		}
+	}
+
 	var isAdmin bool
 	for _, scope := range decodedToken.Scope {
 		if scope == "doppler.firehose" || scope == "logs.admin" {
@@ -242,7 +269,7 @@ func (c *UAAClient) Read(token string) (Oauth2ClientContext, error) {
 	return Oauth2ClientContext{
 		IsAdmin:   isAdmin,
 		Token:     token,
-		ExpiresAt: decodedToken.ExpTime,
+		ExpiresAt: expiresAt,
 	}, err
 }
 
@@ -293,6 +320,8 @@ type decodedToken struct {
 	Scope   []string  `json:"scope"`
 	Exp     float64   `json:"exp"`
 	ExpTime time.Time `json:"-"`
+	Iat     float64   `json:"iat"`
+	IatTime time.Time `json:"-"`
 }
 
 func decodeToken(r io.Reader) (decodedToken, error) {
@@ -302,6 +331,7 @@ func decodeToken(r io.Reader) (decodedToken, error) {
 	}
 
 	dt.ExpTime = time.Unix(int64(dt.Exp), 0)
+	dt.IatTime = time.Unix(int64(dt.Iat), 0)
 
 	return dt, nil
 }
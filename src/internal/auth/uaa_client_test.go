@@ -127,6 +127,58 @@ var _ = Describe("UAAClient", func() {
 			Expect(err.Error()).To(ContainSubstring("token is expired"))
 		})
 
+		Context("with a maximum token age", func() {
+			BeforeEach(func() {
+				tc = uaaSetup(true, auth.WithMaxTokenAge(time.Hour))
+				tc.PrimePublicKeyCache(true)
+			})
+
+			It("rejects a token with a distant exp but an old iat", func() {
+				payload := fmt.Sprintf(
+					`{"scope":["logs.admin"], "exp":%d, "iat":%d}`,
+					time.Now().Add(24*time.Hour).Unix(),
+					time.Now().Add(-2*time.Hour).Unix(),
+				)
+				token := tc.CreateSignedToken(payload)
+
+				_, err := tc.uaaClient.Read(withBearer(token))
+				Expect(err).To(MatchError(ContainSubstring("token is older than the maximum age of 1h0m0s")))
+			})
+
+			It("accepts a recently issued token and expires it at the maximum age", func() {
+				iat := time.Now().Add(-time.Minute).Truncate(time.Second)
+				payload := fmt.Sprintf(
+					`{"scope":["logs.admin"], "exp":%d, "iat":%d}`,
+					time.Now().Add(24*time.Hour).Unix(),
+					iat.Unix(),
+				)
+				token := tc.CreateSignedToken(payload)
+
+				c, err := tc.uaaClient.Read(withBearer(token))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(c.ExpiresAt).To(Equal(iat.Add(time.Hour)))
+			})
+
+			It("rejects a token without an iat claim", func() {
+				token := tc.CreateSignedToken(tc.BuildValidPayload("logs.admin"))
+
+				_, err := tc.uaaClient.Read(withBearer(token))
+				Expect(err).To(MatchError("token has no iat claim"))
+			})
+		})
+
+		It("accepts a token with an old iat without a maximum token age", func() {
+			payload := fmt.Sprintf(
+				`{"scope":["logs.admin"], "exp":%d, "iat":%d}`,
+				time.Now().Add(time.Hour).Unix(),
+				time.Now().Add(-48*time.Hour).Unix(),
+			)
+			token := tc.CreateSignedToken(payload)
+
+			_, err := tc.uaaClient.Read(withBearer(token))
+			Expect(err).ToNot(HaveOccurred())
+		})
+
 		It("returns an error when token is blank", func() {
 			_, err := tc.uaaClient.Read("")
 			Expect(err).To(HaveOccurred())
@@ -1,8 +1,11 @@
 package cache
 
 import (
+	"crypto/tls"
 	"log"
+	"log/slog"
 	"net"
+	"net/http"
 	"strconv"
 	"sync/atomic"
 	"time"
@@ -11,24 +14,29 @@ import (
 
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
 
 	client "code.cloudfoundry.org/go-log-cache/v3"
 	"code.cloudfoundry.org/go-log-cache/v3/rpc/logcache_v1"
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
 	"code.cloudfoundry.org/log-cache/internal/cache/store"
+	"code.cloudfoundry.org/log-cache/internal/plumbing"
 	"code.cloudfoundry.org/log-cache/internal/promql"
 	"code.cloudfoundry.org/log-cache/internal/promql/data_reader"
 	"code.cloudfoundry.org/log-cache/internal/routing"
+	lcclient "code.cloudfoundry.org/log-cache/pkg/client"
 )
 
 type Metrics interface {
 	NewCounter(name, helpText string, opts ...metrics.MetricOption) metrics.Counter
 	NewGauge(name, helpText string, opts ...metrics.MetricOption) metrics.Gauge
+	NewHistogram(name, helpText string, buckets []float64, opts ...metrics.MetricOption) metrics.Histogram
 }
 
 // LogCache is a in memory cache for Loggregator envelopes.
 type LogCache struct {
-	log *log.Logger
+	log *slog.Logger
 
 	lis    net.Listener
 	server *grpc.Server
@@ -37,12 +45,60 @@ type LogCache struct {
 	metrics    Metrics
 	closing    int64
 
+	serverTLS     *tls.Config
+	minTLSVersion uint16
+	cipherSuites  []uint16
+
 	maxPerSource       int
+	maxSourceIDs       int
 	memoryLimitPercent float64
 	memoryLimit        uint64
 	queryTimeout       time.Duration
+	queryConcurrency   int
+	queryCacheTTL      time.Duration
+	queryCacheSize     int
+	sanitizeExempt     []string
+	slowQuery          time.Duration
 	truncationInterval time.Duration
 	prunesPerGC        int64
+	heapParallelism    int
+
+	truncationBehindThreshold int64
+	minRetention              time.Duration
+	targetCachePeriod         time.Duration
+	spillDir                  string
+	spillMaxBytes             int64
+	topIngress                *store.TopIngress
+	topIngressInterval        time.Duration
+	selfMetricsSourceID       string
+	selfMetricsInterval       time.Duration
+	maxReadWindow             time.Duration
+	egressAllowlist           []string
+	profiledSources           []string
+	timestampFudge            int64
+	rejectTimestampCollisions bool
+	ingressLockTimeout        time.Duration
+	maxFutureSkew             time.Duration
+	dedupWindow               time.Duration
+	dedupMaxEntries           int
+	eventSeverityTag          string
+	backpressureThreshold     float64
+
+	adminEnabled       bool
+	compressResponses  bool
+	instanceIDSharding bool
+	routingTag         string
+	peerOpTimeout      time.Duration
+	metaCacheDuration  time.Duration
+	peerWriteRetries   int
+	peerWriteTimeout   time.Duration
+	routingSalt        string
+
+	ingressTransformer func(*loggregator_v2.Envelope) *loggregator_v2.Envelope
+
+	warmupPeers   []string
+	warmupWindow  time.Duration
+	warmupTimeout time.Duration
 
 	// Cluster Properties
 	addr     string
@@ -58,15 +114,20 @@ type LogCache struct {
 }
 
 // NewLogCache creates a new LogCache.
-func New(m Metrics, logger *log.Logger, opts ...LogCacheOption) *LogCache {
+func New(m Metrics, logger *slog.Logger, opts ...LogCacheOption) *LogCache {
 	cache := &LogCache{
 		log:                logger,
 		metrics:            m,
 		maxPerSource:       100000,
+		timestampFudge:     4000,
 		memoryLimitPercent: 50,
 		queryTimeout:       10 * time.Second,
+		queryConcurrency:   10,
 		truncationInterval: 1 * time.Second,
 		prunesPerGC:        int64(3),
+		heapParallelism:    1,
+		warmupTimeout:      30 * time.Second,
+		metaCacheDuration:  time.Second,
 
 		addr:     ":8080",
 		dialOpts: []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())},
@@ -95,6 +156,16 @@ func WithMaxPerSource(size int) LogCacheOption {
 	}
 }
 
+// WithMaxSourceIDs returns a LogCacheOption that limits the number of
+// distinct source IDs in the store. The least recently written source ID
+// is evicted to make room for a new one. Defaults to 0, which does not
+// limit the number of source IDs.
+func WithMaxSourceIDs(n int) LogCacheOption {
+	return func(c *LogCache) {
+		c.maxSourceIDs = n
+	}
+}
+
 // WithTruncationInterval returns a LogCacheOption that configures the
 // interval in ms on the store's truncation loop. Defaults to 1s.
 func WithTruncationInterval(interval time.Duration) LogCacheOption {
@@ -113,6 +184,282 @@ func WithPrunesPerGC(consecutivePrunes int64) LogCacheOption {
 	}
 }
 
+// WithHeapBuildParallelism returns a LogCacheOption that configures how
+// many goroutines read the oldest timestamp of every source ID when the
+// store builds its expiration heap. Defaults to 1.
+func WithHeapBuildParallelism(n int) LogCacheOption {
+	return func(c *LogCache) {
+		c.heapParallelism = n
+	}
+}
+
+// WithTruncationBehindThreshold returns a LogCacheOption that configures the
+// number of envelopes above which the store is considered to be falling
+// behind after a truncation cycle. Defaults to 0, which disables the check.
+func WithTruncationBehindThreshold(threshold int64) LogCacheOption {
+	return func(c *LogCache) {
+		c.truncationBehindThreshold = threshold
+	}
+}
+
+// WithMinRetention returns a LogCacheOption that prevents the store from
+// pruning envelopes newer than the given duration, even under memory
+// pressure. Defaults to 0, which disables the guarantee.
+func WithMinRetention(d time.Duration) LogCacheOption {
+	return func(c *LogCache) {
+		c.minRetention = d
+	}
+}
+
+// WithTargetCachePeriod returns a LogCacheOption that makes the store aim
+// for keeping roughly d worth of envelopes while under memory pressure.
+// Defaults to 0, which disables the target.
+func WithTargetCachePeriod(d time.Duration) LogCacheOption {
+	return func(c *LogCache) {
+		c.targetCachePeriod = d
+	}
+}
+
+// WithSpillover returns a LogCacheOption that makes the store write pruned
+// envelopes to a ring buffer of at most maxBytes in dir instead of dropping
+// them. Defaults to no spillover.
+func WithSpillover(dir string, maxBytes int64) LogCacheOption {
+	return func(c *LogCache) {
+		c.spillDir = dir
+		c.spillMaxBytes = maxBytes
+	}
+}
+
+// WithTopIngressReport returns a LogCacheOption that logs the n source IDs
+// with the most ingress every interval. The last report is also served by
+// TopIngressHandler. Defaults to no report.
+func WithTopIngressReport(n int, interval time.Duration) LogCacheOption {
+	return func(c *LogCache) {
+		c.topIngress = store.NewTopIngress(n)
+		c.topIngressInterval = interval
+	}
+}
+
+// WithSelfMetrics returns a LogCacheOption that writes the store's own
+// metrics as a gauge envelope under sourceID every interval, so that they
+// can be read and queried like any other source. The envelopes are routed
+// like any other, so every node's metrics end up under the same source ID,
+// told apart by their instance ID. Defaults to not writing them.
+func WithSelfMetrics(sourceID string, interval time.Duration) LogCacheOption {
+	return func(c *LogCache) {
+		c.selfMetricsSourceID = sourceID
+		c.selfMetricsInterval = interval
+	}
+}
+
+// WithMaxReadWindow returns a LogCacheOption that rejects Read requests whose
+// time range, after defaulting EndTime to now, is longer than d. This keeps
+// a client that passes StartTime=0 from walking the whole store. PromQL
+// range queries and exports read through the same path and are limited as
+// well. Defaults to 0 (disabled).
+func WithMaxReadWindow(d time.Duration) LogCacheOption {
+	return func(c *LogCache) {
+		c.maxReadWindow = d
+	}
+}
+
+// WithTimestampFudge returns a LogCacheOption that sets how far, in
+// nanoseconds, a colliding envelope timestamp may be moved forward. A value
+// of 0 disables fudging. Defaults to 4000.
+func WithTimestampFudge(max int64) LogCacheOption {
+	return func(c *LogCache) {
+		c.timestampFudge = max
+	}
+}
+
+// WithRejectTimestampCollisions returns a LogCacheOption that drops
+// envelopes whose timestamp can not be fudged to a free value, instead of
+// replacing the stored envelope.
+func WithRejectTimestampCollisions() LogCacheOption {
+	return func(c *LogCache) {
+		c.rejectTimestampCollisions = true
+	}
+}
+
+// WithIngressLockTimeout returns a LogCacheOption that drops an envelope
+// when the lock for its source can not be acquired within d, instead of
+// blocking ingress. Defaults to 0, which waits for the lock.
+func WithIngressLockTimeout(d time.Duration) LogCacheOption {
+	return func(c *LogCache) {
+		c.ingressLockTimeout = d
+	}
+}
+
+// WithMaxFutureSkew returns a LogCacheOption that drops envelopes whose
+// timestamp is more than d ahead of now. Defaults to 0, which accepts any
+// timestamp.
+func WithMaxFutureSkew(d time.Duration) LogCacheOption {
+	return func(c *LogCache) {
+		c.maxFutureSkew = d
+	}
+}
+
+// WithDeduplication returns a LogCacheOption that drops an envelope when
+// an identical envelope was written for the same source ID within the
+// window, remembering at most maxEntries envelopes. Defaults to no
+// deduplication.
+func WithDeduplication(window time.Duration, maxEntries int) LogCacheOption {
+	return func(c *LogCache) {
+		c.dedupWindow = window
+		c.dedupMaxEntries = maxEntries
+	}
+}
+
+// WithEventSeverityTag returns a LogCacheOption that sets the tag holding
+// the severity of event envelopes, which Reads with a minimum severity
+// filter on. Defaults to "severity".
+func WithEventSeverityTag(tag string) LogCacheOption {
+	return func(c *LogCache) {
+		c.eventSeverityTag = tag
+	}
+}
+
+// WithPerSourceEgressMetrics returns a LogCacheOption that emits a labeled
+// egress counter for each of the given source IDs. All other source IDs are
+// counted together under "other". Defaults to no per-source metrics.
+func WithPerSourceEgressMetrics(allowlist []string) LogCacheOption {
+	return func(c *LogCache) {
+		c.egressAllowlist = allowlist
+	}
+}
+
+// WithProfilerLabels returns a LogCacheOption that labels the store work
+// for each of the given source IDs in CPU profiles. Defaults to no labels.
+func WithProfilerLabels(sourceIDs []string) LogCacheOption {
+	return func(c *LogCache) {
+		c.profiledSources = sourceIDs
+	}
+}
+
+// WithWarmup returns a LogCacheOption that seeds the store on start with
+// envelopes from the last window, read from the first of the given replica
+// addresses that responds. Only source IDs owned by this node are copied.
+// The node does not serve requests until warmup completes or the timeout
+// elapses. Replicas are dialed with the cluster dial options. Defaults to no
+// warmup.
+func WithWarmup(peerAddrs []string, window, timeout time.Duration) LogCacheOption {
+	return func(c *LogCache) {
+		c.warmupPeers = peerAddrs
+		c.warmupWindow = window
+		c.warmupTimeout = timeout
+	}
+}
+
+// WithAdminEnabled returns a LogCacheOption that registers the admin gRPC
+// service, which allows purging all data for a source ID or pausing its
+// ingestion. The service is protected by the same credentials as the rest
+// of the gRPC server. It is disabled by default.
+func WithAdminEnabled() LogCacheOption {
+	return func(c *LogCache) {
+		c.adminEnabled = true
+	}
+}
+
+// WithResponseCompression returns a LogCacheOption that gzips Read and Meta
+// responses for every client that accepts gzip, instead of only for clients
+// that compress their requests. Large Read responses shrink several times
+// at the cost of CPU on both ends. It is disabled by default.
+func WithResponseCompression() LogCacheOption {
+	return func(c *LogCache) {
+		c.compressResponses = true
+	}
+}
+
+// WithInstanceIDSharding returns a LogCacheOption that routes envelopes by
+// source ID and instance ID instead of source ID alone. This spreads large
+// sources across the cluster at the cost of every Read fanning out to all
+// nodes. Every node in the cluster must be configured the same way. It is
+// disabled by default.
+func WithInstanceIDSharding() LogCacheOption {
+	return func(c *LogCache) {
+		c.instanceIDSharding = true
+	}
+}
+
+// WithTagRouting returns a LogCacheOption that routes envelopes with the
+// given tag by its value instead of their source ID, e.g. to keep all of a
+// tenant's sources on one node. Envelopes without the tag are routed as
+// before. Every Read fans out to all nodes. Every node in the cluster must
+// be configured the same way. It is disabled by default.
+func WithTagRouting(tag string) LogCacheOption {
+	return func(c *LogCache) {
+		c.routingTag = tag
+	}
+}
+
+// WithBackpressureThreshold returns a LogCacheOption that sets the
+// client.BackpressureHeader on Send responses while the last truncation
+// cycle pruned at least the given fraction (0 to 1) of the store. Defaults
+// to 0, which never sets it.
+func WithBackpressureThreshold(fraction float64) LogCacheOption {
+	return func(c *LogCache) {
+		c.backpressureThreshold = fraction
+	}
+}
+
+// WithPeerOpTimeout returns a LogCacheOption that bounds how long a Read or
+// Meta that gathers data from every node waits for each of them. Nodes that
+// do not respond in time are left out of the response. Defaults to 0, which
+// waits for every node.
+func WithPeerOpTimeout(d time.Duration) LogCacheOption {
+	return func(c *LogCache) {
+		c.peerOpTimeout = d
+	}
+}
+
+// WithMetaCacheDuration returns a LogCacheOption that sets how long the
+// meta gathered from every node is cached. Concurrent Meta requests share
+// one round of requests to the nodes either way. Defaults to 1s; 0
+// disables the cache.
+func WithMetaCacheDuration(d time.Duration) LogCacheOption {
+	return func(c *LogCache) {
+		c.metaCacheDuration = d
+	}
+}
+
+// WithPeerWriteRetries returns a LogCacheOption that retries a batch of
+// envelopes that failed to send to the node that owns them up to retries
+// times, giving each attempt timeout to complete. A batch that still fails
+// is stored locally instead of being dropped. This node does not own those
+// envelopes, so Reads, which are routed to the owning nodes, do not return
+// them. Only Reads served by every node, as with WithInstanceIDSharding or
+// WithTagRouting, see them. Defaults to 0, which drops the batch after one
+// attempt.
+func WithPeerWriteRetries(retries int, timeout time.Duration) LogCacheOption {
+	return func(c *LogCache) {
+		c.peerWriteRetries = retries
+		c.peerWriteTimeout = timeout
+	}
+}
+
+// WithRoutingSalt returns a LogCacheOption that salts the source ID hash
+// used to route envelopes, so that identical source IDs in different
+// deployments are spread independently. Every node in the cluster must use
+// the same salt. It defaults to no salt.
+func WithRoutingSalt(salt string) LogCacheOption {
+	return func(c *LogCache) {
+		c.routingSalt = salt
+	}
+}
+
+// WithIngressTransformer returns a LogCacheOption that passes every envelope
+// through f before it is stored, e.g. to redact log payloads or add tags.
+// Returning nil drops the envelope. f runs on the node that stores the
+// envelope, after routing, so changing the source ID does not move the
+// envelope to another node. It is called for every ingested envelope,
+// including those copied from a replica during warmup, and must be fast and
+// safe for concurrent use.
+func WithIngressTransformer(f func(*loggregator_v2.Envelope) *loggregator_v2.Envelope) LogCacheOption {
+	return func(c *LogCache) {
+		c.ingressTransformer = f
+	}
+}
+
 // WithAddr configures the address to listen for gRPC requests. It defaults to
 // :8080.
 func WithAddr(addr string) LogCacheOption {
@@ -129,6 +476,34 @@ func WithServerOpts(opts ...grpc.ServerOption) LogCacheOption {
 	}
 }
 
+// WithServerTLS configures the TLS config used to serve gRPC requests. The
+// config is cloned before WithMinTLSVersion and WithCipherSuites are applied
+// to it. It is an alternative to passing grpc.Creds to WithServerOpts.
+func WithServerTLS(cfg *tls.Config) LogCacheOption {
+	return func(c *LogCache) {
+		c.serverTLS = cfg
+	}
+}
+
+// WithMinTLSVersion sets the minimum TLS version the gRPC server accepts,
+// e.g. tls.VersionTLS13. It only applies when WithServerTLS is used and
+// defaults to the MinVersion of that config.
+func WithMinTLSVersion(version uint16) LogCacheOption {
+	return func(c *LogCache) {
+		c.minTLSVersion = version
+	}
+}
+
+// WithCipherSuites overrides the cipher suites the gRPC server accepts. It
+// only applies when WithServerTLS is used and defaults to the CipherSuites
+// of that config. Go does not allow configuring TLS 1.3 cipher suites, so
+// the override only affects TLS 1.2 connections.
+func WithCipherSuites(suites ...uint16) LogCacheOption {
+	return func(c *LogCache) {
+		c.cipherSuites = suites
+	}
+}
+
 // WithMemoryLimitPercent sets the percentage of total system memory to use for the
 // cache. If exceeded, the cache will prune. Default is 50%.
 func WithMemoryLimitPercent(memoryPercent float64) LogCacheOption {
@@ -154,6 +529,40 @@ func WithQueryTimeout(queryTimeout time.Duration) LogCacheOption {
 	}
 }
 
+// WithQuerySourceIDConcurrency sets how many source IDs a single PromQL
+// query reads in parallel. The default is 10.
+func WithQuerySourceIDConcurrency(n int) LogCacheOption {
+	return func(c *LogCache) {
+		c.queryConcurrency = n
+	}
+}
+
+// WithQueryCache caches instant PromQL query results for ttl, holding at
+// most maxEntries results. It is disabled by default.
+func WithQueryCache(ttl time.Duration, maxEntries int) LogCacheOption {
+	return func(c *LogCache) {
+		c.queryCacheTTL = ttl
+		c.queryCacheSize = maxEntries
+	}
+}
+
+// WithSanitizeExemptMetricNames makes PromQL queries match envelopes with
+// the given metric names by their name as is instead of their sanitized
+// name. It defaults to no exemptions.
+func WithSanitizeExemptMetricNames(names []string) LogCacheOption {
+	return func(c *LogCache) {
+		c.sanitizeExempt = names
+	}
+}
+
+// WithSlowQueryThreshold logs PromQL queries that take longer than d. It
+// is disabled by default.
+func WithSlowQueryThreshold(d time.Duration) LogCacheOption {
+	return func(c *LogCache) {
+		c.slowQuery = d
+	}
+}
+
 // WithClustered enables the LogCache to route data to peer nodes. It hashes
 // each envelope by SourceId and routes data that does not belong on the node
 // to the correct node. NodeAddrs is a slice of node addresses where the slice
@@ -178,7 +587,44 @@ func (c *LogCache) Start() {
 		analyzer = NewMemoryAnalyzer(c.metrics)
 	}
 	p := store.NewPruneConsultant(2, c.memoryLimitPercent, analyzer)
-	store := store.NewStore(c.maxPerSource, c.truncationInterval, c.prunesPerGC, p, c.metrics)
+	storeOpts := []store.StoreOption{
+		store.WithLogger(c.log),
+		store.WithTruncationBehindThreshold(c.truncationBehindThreshold),
+		store.WithMinRetention(c.minRetention),
+		store.WithTargetCachePeriod(c.targetCachePeriod),
+		store.WithPerSourceEgressMetrics(c.egressAllowlist),
+		store.WithTimestampFudge(c.timestampFudge),
+		store.WithLockTimeout(c.ingressLockTimeout),
+		store.WithMaxFutureSkew(c.maxFutureSkew),
+		store.WithDeduplication(c.dedupWindow, c.dedupMaxEntries),
+		store.WithBackpressureThreshold(c.backpressureThreshold),
+		store.WithMaxSourceIDs(c.maxSourceIDs),
+		store.WithHeapBuildParallelism(c.heapParallelism),
+	}
+	if c.rejectTimestampCollisions {
+		storeOpts = append(storeOpts, store.WithRejectTimestampCollisions())
+	}
+	if len(c.profiledSources) > 0 {
+		storeOpts = append(storeOpts, store.WithProfilerLabels(c.profiledSources))
+	}
+	if c.spillDir != "" {
+		storeOpts = append(storeOpts, store.WithSpillover(c.spillDir, c.spillMaxBytes))
+	}
+	if c.eventSeverityTag != "" {
+		storeOpts = append(storeOpts, store.WithEventSeverityTag(c.eventSeverityTag))
+	}
+	if c.topIngress != nil {
+		storeOpts = append(storeOpts, store.WithTopIngress(c.topIngress))
+		go c.reportTopIngress()
+	}
+	store := store.NewStore(
+		c.maxPerSource,
+		c.truncationInterval,
+		c.prunesPerGC,
+		p,
+		c.metrics,
+		storeOpts...,
+	)
 	c.setupRouting(store)
 }
 
@@ -189,6 +635,37 @@ func (c *LogCache) Close() error {
 	return nil
 }
 
+// TopIngressHandler returns a handler that serves the last top ingress
+// report as JSON. It responds with 404 if the report is not enabled.
+func (c *LogCache) TopIngressHandler() http.Handler {
+	if c.topIngress == nil {
+		return http.NotFoundHandler()
+	}
+
+	return c.topIngress
+}
+
+// reportTopIngress logs the source IDs with the most ingress at the end of
+// every interval until the LogCache is closed.
+func (c *LogCache) reportTopIngress() {
+	t := time.NewTicker(c.topIngressInterval)
+	defer t.Stop()
+
+	for range t.C {
+		if atomic.LoadInt64(&c.closing) > 0 {
+			return
+		}
+
+		report := c.topIngress.Rotate()
+		attrs := make([]any, 0, len(report)+1)
+		attrs = append(attrs, "interval", c.topIngressInterval)
+		for i, s := range report {
+			attrs = append(attrs, slog.Group(strconv.Itoa(i+1), "source_id", s.SourceID, "count", s.Count))
+		}
+		c.log.Info("top ingress sources", attrs...)
+	}
+}
+
 func (c *LogCache) setupRouting(s *store.Store) {
 	// gRPC
 	lis, err := net.Listen("tcp", c.addr)
@@ -196,13 +673,13 @@ func (c *LogCache) setupRouting(s *store.Store) {
 		log.Fatalf("failed to listen: %v", err)
 	}
 	c.lis = lis
-	c.log.Printf("listening on %s...", c.Addr())
+	c.log.Info("listening", "addr", c.Addr())
 
 	if c.extAddr == "" {
 		c.extAddr = c.lis.Addr().String()
 	}
 
-	lookup, err := routing.NewRoutingTable(c.nodeAddrs, 1)
+	lookup, err := routing.NewRoutingTable(c.nodeAddrs, 1, routing.WithRoutingSalt(c.routingSalt))
 	if err != nil {
 		log.Fatalf("failed to build routing table: %s", err)
 	}
@@ -210,17 +687,42 @@ func (c *LogCache) setupRouting(s *store.Store) {
 	var (
 		ingressClients []logcache_v1.IngressClient
 		egressClients  []logcache_v1.EgressClient
+		adminClients   []routing.AdminClient
+		namesClients   []routing.MetricNamesClient
 		localIdx       int
 	)
 
-	lcr := routing.NewLocalStoreReader(s)
+	lcr := routing.NewLocalStoreReader(s, routing.WithMaxReadWindow(c.maxReadWindow))
+
+	// The routing and PromQL packages log unleveled lines.
+	stdLog := slog.NewLogLogger(c.log.Handler(), slog.LevelInfo)
+
+	storeLocally := routing.IngressClientFunc(func(ctx context.Context, r *logcache_v1.SendRequest, opts ...grpc.CallOption) (*logcache_v1.SendResponse, error) {
+		c.log.Debug("storing envelopes", "count", len(r.GetEnvelopes().GetBatch()))
+		for _, e := range r.GetEnvelopes().GetBatch() {
+			c.put(s, e)
+		}
+
+		return &logcache_v1.SendResponse{}, nil
+	})
+
+	var peerWriteOpts []routing.BatchedIngressClientOption
+	if c.peerWriteRetries > 0 {
+		peerWriteOpts = append(peerWriteOpts,
+			routing.WithSendRetries(c.peerWriteRetries, c.peerWriteTimeout),
+			routing.WithSendFallback(storeLocally, c.metrics.NewCounter(
+				"log_cache_peer_write_fallback",
+				"Total envelopes stored locally because they could not be sent to the node that owns them.",
+			)),
+		)
+	}
 
 	// Register peers and current node
 	for i, addr := range c.nodeAddrs {
 		if i != c.nodeIndex {
 			conn, err := grpc.NewClient(addr, c.dialOpts...)
 			if err != nil {
-				log.Printf("failed to dial %s: %s", addr, err)
+				c.log.Error("failed to dial node", "addr", addr, "error", err)
 				continue
 			}
 
@@ -238,49 +740,168 @@ func (c *LogCache) setupRouting(s *store.Store) {
 					"Total number of envelope batches that failed to send to other log-cache nodes.",
 					metrics.WithMetricLabels(map[string]string{"sender": "batched_ingress_client"}),
 				),
-				c.log,
+				stdLog,
+				peerWriteOpts...,
 			)
 
 			ingressClients = append(ingressClients, bw)
 			egressClients = append(egressClients, logcache_v1.NewEgressClient(conn))
+			adminClients = append(adminClients, lcclient.NewAdminClient(conn))
+			namesClients = append(namesClients, lcclient.NewMetricNamesClient(conn))
 
 			continue
 		}
 
 		localIdx = i
-		ingressClients = append(ingressClients, routing.IngressClientFunc(func(ctx context.Context, r *logcache_v1.SendRequest, opts ...grpc.CallOption) (*logcache_v1.SendResponse, error) {
-			for _, e := range r.GetEnvelopes().GetBatch() {
-				s.Put(e, e.GetSourceId())
-			}
-
-			return &logcache_v1.SendResponse{}, nil
-		}))
+		ingressClients = append(ingressClients, storeLocally)
 		egressClients = append(egressClients, lcr)
+		adminClients = append(adminClients, nil)
+		namesClients = append(namesClients, nil)
 	}
 
-	ingressReverseProxy := routing.NewIngressReverseProxy(lookup.Lookup, ingressClients, localIdx, c.log)
-	egressReverseProxy := routing.NewEgressReverseProxy(lookup.Lookup, egressClients, localIdx, c.log)
+	var ingressOpts []routing.IngressReverseProxyOption
+	egressOpts := []routing.EgressReverseProxyOption{
+		routing.WithRoutingFallback(c.metrics.NewCounter(
+			"log_cache_routing_fallback",
+			"Total number of reads served locally because no node could be resolved for the source ID.",
+		)),
+		routing.WithMetaCacheDuration(c.metaCacheDuration),
+	}
+	if c.backpressureThreshold > 0 {
+		ingressOpts = append(ingressOpts, routing.WithIngressBackpressure(s.UnderPressure))
+	}
+	if c.peerOpTimeout > 0 {
+		egressOpts = append(egressOpts, routing.WithPeerOpTimeout(c.peerOpTimeout))
+	}
+	if c.instanceIDSharding {
+		ingressOpts = append(ingressOpts, routing.WithIngressInstanceIDSharding())
+		egressOpts = append(egressOpts, routing.WithEgressInstanceIDSharding())
+	}
+	if c.routingTag != "" {
+		ingressOpts = append(ingressOpts, routing.WithIngressTagRouting(c.routingTag))
+		egressOpts = append(egressOpts, routing.WithEgressTagRouting())
+	}
+	ownersLookup := lookup.Lookup
+	if c.instanceIDSharding || c.routingTag != "" {
+		// Any node may hold envelopes for a source ID, so purges and metric
+		// name lookups have to reach all of them.
+		ownersLookup = func(string) []int {
+			idxs := make([]int, len(c.nodeAddrs))
+			for i := range idxs {
+				idxs[i] = i
+			}
+			return idxs
+		}
+	}
+
+	ingressReverseProxy := routing.NewIngressReverseProxy(lookup.Lookup, ingressClients, localIdx, stdLog, ingressOpts...)
+	if c.selfMetricsSourceID != "" {
+		go c.writeSelfMetrics(s, ingressReverseProxy)
+	}
+	egressReverseProxy := routing.NewEgressReverseProxy(lookup.Lookup, egressClients, localIdx, stdLog, egressOpts...)
 
 	promQL := promql.New(
 		data_reader.NewWalkingDataReader(
 			client.NewClient(c.Addr(), client.WithViaGRPC(c.dialOpts...)).Read,
 		),
 		c.metrics,
-		c.log,
+		stdLog,
 		c.queryTimeout,
+		promql.WithSourceIDReadConcurrency(c.queryConcurrency),
+		promql.WithQueryCache(c.queryCacheTTL, c.queryCacheSize),
+		promql.WithSanitizeExemptMetricNames(c.sanitizeExempt),
+		promql.WithSlowQueryThreshold(c.slowQuery),
+	)
+	serverMetrics := NewServerMetrics(c.metrics)
+	interceptors := []grpc.UnaryServerInterceptor{serverMetrics.UnaryInterceptor()}
+	if c.compressResponses {
+		interceptors = append(interceptors, plumbing.CompressResponses(
+			logcache_v1.Egress_Read_FullMethodName,
+			logcache_v1.Egress_Meta_FullMethodName,
+		))
+	}
+	serverOpts := append(
+		[]grpc.ServerOption{grpc.ChainUnaryInterceptor(interceptors...)},
+		c.serverOpts...,
 	)
-	c.server = grpc.NewServer(c.serverOpts...)
+	if c.serverTLS != nil {
+		serverOpts = append(serverOpts, grpc.Creds(credentials.NewTLS(c.buildServerTLS())))
+	}
+	c.server = grpc.NewServer(serverOpts...)
+
+	if len(c.warmupPeers) > 0 {
+		c.warm(s, lookup.Lookup)
+	}
 
 	go func() {
-		logcache_v1.RegisterIngressServer(c.server, ingressReverseProxy)
+		routing.RegisterIngressServer(c.server, ingressReverseProxy)
 		logcache_v1.RegisterEgressServer(c.server, egressReverseProxy)
-		logcache_v1.RegisterPromQLQuerierServer(c.server, promQL)
+		promql.RegisterPromQLQuerierServer(c.server, promQL)
+		routing.RegisterAggregationServer(c.server, routing.NewAggregator(egressReverseProxy, stdLog))
+		routing.RegisterMetricNamesServer(c.server, routing.NewMetricNamesReverseProxy(ownersLookup, namesClients, localIdx, s, stdLog))
+		if c.adminEnabled {
+			routing.RegisterAdminServer(c.server, routing.NewAdminReverseProxy(ownersLookup, adminClients, localIdx, s, egressReverseProxy, stdLog))
+		}
 		if err := c.server.Serve(lis); err != nil && atomic.LoadInt64(&c.closing) == 0 {
-			c.log.Fatalf("failed to serve gRPC ingress server: %s %#v", err, err)
+			log.Fatalf("failed to serve gRPC ingress server: %s %#v", err, err)
 		}
 	}()
 }
 
+// put stores an envelope under its source ID after passing it through the
+// ingress transformer, which may drop it.
+func (c *LogCache) put(s *store.Store, e *loggregator_v2.Envelope) {
+	if c.ingressTransformer != nil {
+		if e = c.ingressTransformer(e); e == nil {
+			return
+		}
+	}
+	s.Put(e, e.GetSourceId())
+}
+
+func (c *LogCache) warm(s *store.Store, lookup func(sourceID string) []int) {
+	var peers []logcache_v1.EgressClient
+	for _, addr := range c.warmupPeers {
+		conn, err := grpc.NewClient(addr, c.dialOpts...)
+		if err != nil {
+			c.log.Error("failed to dial warmup peer", "addr", addr, "error", err)
+			continue
+		}
+		defer conn.Close()
+
+		peers = append(peers, logcache_v1.NewEgressClient(conn))
+	}
+
+	owns := func(sourceID string) bool {
+		for _, idx := range lookup(sourceID) {
+			if idx == c.nodeIndex {
+				return true
+			}
+		}
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.warmupTimeout)
+	defer cancel()
+
+	start := time.Now()
+	put := func(e *loggregator_v2.Envelope, _ string) { c.put(s, e) }
+	n := NewWarmer(peers, owns, put, c.warmupWindow, c.log).Warm(ctx)
+	c.log.Info("warmed store", "envelopes", n, "duration", time.Since(start))
+}
+
+func (c *LogCache) buildServerTLS() *tls.Config {
+	cfg := c.serverTLS.Clone()
+	if c.minTLSVersion != 0 {
+		cfg.MinVersion = c.minTLSVersion
+	}
+	if len(c.cipherSuites) > 0 {
+		cfg.CipherSuites = c.cipherSuites
+	}
+
+	return cfg
+}
+
 // Addr returns the address that the LogCache is listening on. This is only
 // valid after Start has been invoked.
 func (c *LogCache) Addr() string {
@@ -1,30 +1,41 @@
 package cache_test
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
 	"errors"
+	"fmt"
 	"io"
-	"log"
+	"log/slog"
+	"strconv"
+	"sync"
 	"time"
 
 	"code.cloudfoundry.org/go-metric-registry/testhelpers"
 	"code.cloudfoundry.org/tlsconfig"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 
 	rpc "code.cloudfoundry.org/go-log-cache/v3/rpc/logcache_v1"
 	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
 	. "code.cloudfoundry.org/log-cache/internal/cache"
+	"code.cloudfoundry.org/log-cache/internal/routing"
 
 	"code.cloudfoundry.org/log-cache/internal/testing"
+	lcclient "code.cloudfoundry.org/log-cache/pkg/client"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 )
 
-func tlsLogCacheTestSetup() (*LogCache, *testing.SpyLogCache, *testhelpers.SpyMetricsRegistry, *tls.Config) {
+func tlsLogCacheTestSetup(opts ...LogCacheOption) (*LogCache, *testing.SpyLogCache, *testhelpers.SpyMetricsRegistry, *tls.Config) {
 	clientTlsConfig, err := tlsconfig.Build(
 		tlsconfig.WithInternalServiceDefaults(),
 		tlsconfig.WithIdentityFromFile(testing.LogCacheTestCerts.Cert("log-cache"), testing.LogCacheTestCerts.Key("log-cache")),
@@ -47,14 +58,14 @@ func tlsLogCacheTestSetup() (*LogCache, *testing.SpyLogCache, *testhelpers.SpyMe
 
 	cache := New(
 		spyMetrics,
-		log.New(io.Discard, "", 0),
-		WithAddr("127.0.0.1:0"),
-		WithClustered(0, []string{"my-addr", peerAddr},
-			grpc.WithTransportCredentials(credentials.NewTLS(clientTlsConfig)),
-		),
-		WithServerOpts(
-			grpc.Creds(credentials.NewTLS(tlsConfig)),
-		),
+		slog.New(slog.NewTextHandler(io.Discard, nil)),
+		append([]LogCacheOption{
+			WithAddr("127.0.0.1:0"),
+			WithClustered(0, []string{"my-addr", peerAddr},
+				grpc.WithTransportCredentials(credentials.NewTLS(clientTlsConfig)),
+			),
+			WithServerTLS(tlsConfig),
+		}, opts...)...,
 	)
 	cache.Start()
 	return cache, peer, spyMetrics, clientTlsConfig
@@ -70,7 +81,7 @@ func logCacheTestSetup() (*LogCache, *testing.SpyLogCache, *testhelpers.SpyMetri
 
 	cache := New(
 		spyMetrics,
-		log.New(io.Discard, "", 0),
+		slog.New(slog.NewTextHandler(io.Discard, nil)),
 		WithAddr("127.0.0.1:0"),
 		WithClustered(0, []string{"my-addr", peerAddr},
 			grpc.WithTransportCredentials(insecure.NewCredentials()),
@@ -163,6 +174,61 @@ var _ = Describe("LogCache", func() {
 			Entry("supported cipher ECDHE_RSA_WITH_AES_128_GCM_SHA256", tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, true),
 			Entry("supported cipher ECDHE_RSA_WITH_AES_256_GCM_SHA384", tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384, true),
 		)
+
+		DescribeTable("allows only TLS 1.3 when configured", func(clientTLSVersion uint16, serverAllows bool) {
+			cache, _, _, tlsConfig := tlsLogCacheTestSetup(WithMinTLSVersion(tls.VersionTLS13))
+			defer cache.Close()
+			clientTlsConfig := tlsConfig.Clone()
+			clientTlsConfig.MaxVersion = clientTLSVersion
+
+			conn, err := grpc.NewClient(
+				cache.Addr(),
+				grpc.WithTransportCredentials(
+					credentials.NewTLS(clientTlsConfig),
+				),
+			)
+			Expect(err).NotTo(HaveOccurred())
+			defer conn.Close()
+
+			_, err = rpc.NewEgressClient(conn).Meta(context.Background(), &rpc.MetaRequest{})
+
+			if serverAllows {
+				Expect(err).NotTo(HaveOccurred())
+			} else {
+				Expect(err).To(HaveOccurred())
+			}
+		},
+			Entry("unsupported TLS 1.2", uint16(tls.VersionTLS12), false),
+			Entry("supported TLS 1.3", uint16(tls.VersionTLS13), true),
+		)
+
+		DescribeTable("allows only the configured cipher suites", func(clientCipherSuite uint16, serverAllows bool) {
+			cache, _, _, tlsConfig := tlsLogCacheTestSetup(WithCipherSuites(tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256))
+			defer cache.Close()
+			clientTlsConfig := tlsConfig.Clone()
+			clientTlsConfig.MaxVersion = tls.VersionTLS12
+			clientTlsConfig.CipherSuites = []uint16{clientCipherSuite}
+
+			conn, err := grpc.NewClient(
+				cache.Addr(),
+				grpc.WithTransportCredentials(
+					credentials.NewTLS(clientTlsConfig),
+				),
+			)
+			Expect(err).NotTo(HaveOccurred())
+			defer conn.Close()
+
+			_, err = rpc.NewEgressClient(conn).Meta(context.Background(), &rpc.MetaRequest{})
+
+			if serverAllows {
+				Expect(err).NotTo(HaveOccurred())
+			} else {
+				Expect(err).To(HaveOccurred())
+			}
+		},
+			Entry("unsupported cipher ECDHE_RSA_WITH_AES_256_GCM_SHA384", tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384, false),
+			Entry("supported cipher ECDHE_RSA_WITH_AES_128_GCM_SHA256", tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, true),
+		)
 	})
 
 	It("returns tail of data filtered by source ID", func() {
@@ -218,6 +284,41 @@ var _ = Describe("LogCache", func() {
 		}).Should(Equal(2.0))
 	})
 
+	It("returns the newest envelopes in ascending order when asked to", func() {
+		cache, _, _, tlsConfig := tlsLogCacheTestSetup()
+		defer cache.Close()
+		writeEnvelopes(cache.Addr(), []*loggregator_v2.Envelope{
+			{Timestamp: 1, SourceId: "src-zero"},
+			{Timestamp: 2, SourceId: "src-zero"},
+			{Timestamp: 3, SourceId: "src-zero"},
+			{Timestamp: 4, SourceId: "src-zero"},
+		})
+
+		conn, err := grpc.NewClient(cache.Addr(),
+			grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)),
+		)
+		Expect(err).ToNot(HaveOccurred())
+		defer conn.Close()
+		client := rpc.NewEgressClient(conn)
+
+		ctx := lcclient.AppendNewest(context.Background())
+		Eventually(func() ([]int64, error) {
+			resp, err := client.Read(ctx, &rpc.ReadRequest{
+				SourceId: "src-zero",
+				Limit:    2,
+			})
+			if err != nil {
+				return nil, err
+			}
+
+			var timestamps []int64
+			for _, e := range resp.Envelopes.Batch {
+				timestamps = append(timestamps, e.Timestamp)
+			}
+			return timestamps, nil
+		}).Should(Equal([]int64{3, 4}))
+	})
+
 	It("queries data via PromQL Instant Queries", func() {
 		cache, _, _, tlsConfig := tlsLogCacheTestSetup()
 		defer cache.Close()
@@ -322,6 +423,35 @@ var _ = Describe("LogCache", func() {
 		Expect(peer.GetLocalOnlyValues()).ToNot(ContainElement(false))
 	})
 
+	It("routes sources sharing a routing tag to the same node", func() {
+		cache, peer, _, _ := tlsLogCacheTestSetup(WithTagRouting("tenant"))
+		defer cache.Close()
+
+		// Find a tenant that routes to the peer (node 1)
+		table, err := routing.NewRoutingTable([]string{"my-addr", "peer-addr"}, 1)
+		Expect(err).ToNot(HaveOccurred())
+		var tenant string
+		for i := 0; tenant == ""; i++ {
+			if t := fmt.Sprintf("tenant-%d", i); table.Lookup(routing.TagShardKey("tenant", t))[0] == 1 {
+				tenant = t
+			}
+		}
+
+		writeEnvelopes(cache.Addr(), []*loggregator_v2.Envelope{
+			// src-zero hashes to 6727955504463301110 (route to node 0)
+			{Timestamp: 1, SourceId: "src-zero", Tags: map[string]string{"tenant": tenant}},
+			// other-src hashes to 2416040688038506749 (route to node 1)
+			{Timestamp: 2, SourceId: "other-src", Tags: map[string]string{"tenant": tenant}},
+			{Timestamp: 3, SourceId: "src-zero"},
+		})
+
+		Eventually(peer.GetEnvelopes).Should(HaveLen(2))
+		Expect(peer.GetEnvelopes()[0].SourceId).To(Equal("src-zero"))
+		Expect(peer.GetEnvelopes()[0].Timestamp).To(Equal(int64(1)))
+		Expect(peer.GetEnvelopes()[1].SourceId).To(Equal("other-src"))
+		Consistently(peer.GetEnvelopes).Should(HaveLen(2))
+	})
+
 	It("routes envelopes to peers without tls", func() {
 		cache, peer, _ := logCacheTestSetup()
 		defer cache.Close()
@@ -411,6 +541,681 @@ var _ = Describe("LogCache", func() {
 		Expect(req.EnvelopeTypes).To(ConsistOf(rpc.EnvelopeType_LOG))
 	})
 
+	It("serves data warmed from a replica immediately after start", func() {
+		now := time.Now().UnixNano()
+		replica := testing.NewSpyLogCache(nil)
+		replica.MetaResponses = map[string]*rpc.MetaInfo{
+			"src-zero": {Count: 2},
+		}
+		replica.ReadEnvelopes["src-zero"] = func() []*loggregator_v2.Envelope {
+			return []*loggregator_v2.Envelope{
+				{SourceId: "src-zero", Timestamp: now - 1},
+				{SourceId: "src-zero", Timestamp: now - 2},
+			}
+		}
+		replicaAddr := replica.Start()
+
+		cache := New(
+			testhelpers.NewMetricsRegistry(),
+			slog.New(slog.NewTextHandler(io.Discard, nil)),
+			WithAddr("127.0.0.1:0"),
+			WithClustered(0, []string{"my-addr"},
+				grpc.WithTransportCredentials(insecure.NewCredentials()),
+			),
+			WithWarmup([]string{replicaAddr}, time.Minute, 5*time.Second),
+		)
+		cache.Start()
+		defer cache.Close()
+
+		Expect(replica.GetReadRequests()).ToNot(BeEmpty())
+		req := replica.GetReadRequests()[0]
+		Expect(req.SourceId).To(Equal("src-zero"))
+		Expect(req.Descending).To(BeTrue())
+
+		conn, err := grpc.NewClient(cache.Addr(),
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+		)
+		Expect(err).ToNot(HaveOccurred())
+		defer conn.Close()
+
+		resp, err := rpc.NewEgressClient(conn).Read(context.Background(), &rpc.ReadRequest{
+			SourceId:  "src-zero",
+			StartTime: now - int64(time.Minute),
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.Envelopes.Batch).To(HaveLen(2))
+	})
+
+	It("passes warmed envelopes through the ingress transformer", func() {
+		now := time.Now().UnixNano()
+		replica := testing.NewSpyLogCache(nil)
+		replica.MetaResponses = map[string]*rpc.MetaInfo{
+			"src-zero": {Count: 1},
+		}
+		replica.ReadEnvelopes["src-zero"] = func() []*loggregator_v2.Envelope {
+			return []*loggregator_v2.Envelope{
+				{SourceId: "src-zero", Timestamp: now - 1},
+			}
+		}
+		replicaAddr := replica.Start()
+
+		cache := New(
+			testhelpers.NewMetricsRegistry(),
+			slog.New(slog.NewTextHandler(io.Discard, nil)),
+			WithAddr("127.0.0.1:0"),
+			WithClustered(0, []string{"my-addr"},
+				grpc.WithTransportCredentials(insecure.NewCredentials()),
+			),
+			WithWarmup([]string{replicaAddr}, time.Minute, 5*time.Second),
+			WithIngressTransformer(func(e *loggregator_v2.Envelope) *loggregator_v2.Envelope {
+				e.Tags = map[string]string{"transformed": "true"}
+				return e
+			}),
+		)
+		cache.Start()
+		defer cache.Close()
+
+		conn, err := grpc.NewClient(cache.Addr(),
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+		)
+		Expect(err).ToNot(HaveOccurred())
+		defer conn.Close()
+
+		resp, err := rpc.NewEgressClient(conn).Read(context.Background(), &rpc.ReadRequest{
+			SourceId:  "src-zero",
+			StartTime: now - int64(time.Minute),
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.Envelopes.Batch).To(HaveLen(1))
+		Expect(resp.Envelopes.Batch[0].GetTags()).To(HaveKeyWithValue("transformed", "true"))
+	})
+
+	It("reports the oldest available timestamp for reads from before it", func() {
+		cache := New(
+			testhelpers.NewMetricsRegistry(),
+			slog.New(slog.NewTextHandler(io.Discard, nil)),
+			WithAddr("127.0.0.1:0"),
+		)
+		cache.Start()
+		defer cache.Close()
+
+		conn, err := grpc.NewClient(cache.Addr(),
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+		)
+		Expect(err).ToNot(HaveOccurred())
+		defer conn.Close()
+
+		_, err = rpc.NewIngressClient(conn).Send(context.Background(), &rpc.SendRequest{
+			Envelopes: &loggregator_v2.EnvelopeBatch{
+				Batch: []*loggregator_v2.Envelope{
+					{SourceId: "src-zero", Timestamp: 100},
+					{SourceId: "src-zero", Timestamp: 200},
+				},
+			},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		egressClient := rpc.NewEgressClient(conn)
+
+		var trailer metadata.MD
+		resp, err := egressClient.Read(context.Background(), &rpc.ReadRequest{
+			SourceId:  "src-zero",
+			StartTime: 1,
+		}, grpc.Trailer(&trailer))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.Envelopes.Batch).To(HaveLen(2))
+
+		oldest, ok := lcclient.OldestTimestamp(trailer)
+		Expect(ok).To(BeTrue())
+		Expect(oldest).To(Equal(int64(100)))
+
+		trailer = nil
+		_, err = egressClient.Read(context.Background(), &rpc.ReadRequest{
+			SourceId:  "src-zero",
+			StartTime: 100,
+		}, grpc.Trailer(&trailer))
+		Expect(err).ToNot(HaveOccurred())
+
+		_, ok = lcclient.OldestTimestamp(trailer)
+		Expect(ok).To(BeFalse())
+	})
+
+	It("pages through envelopes that share timestamps with a cursor", func() {
+		cache := New(
+			testhelpers.NewMetricsRegistry(),
+			slog.New(slog.NewTextHandler(io.Discard, nil)),
+			WithAddr("127.0.0.1:0"),
+		)
+		cache.Start()
+		defer cache.Close()
+
+		conn, err := grpc.NewClient(cache.Addr(),
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+		)
+		Expect(err).ToNot(HaveOccurred())
+		defer conn.Close()
+
+		var (
+			batch []*loggregator_v2.Envelope
+			ids   []string
+		)
+		for i, ts := range []int64{100, 100, 100, 200, 200, 200, 200, 300, 300, 400} {
+			id := strconv.Itoa(i)
+			batch = append(batch, &loggregator_v2.Envelope{SourceId: "src-zero", InstanceId: id, Timestamp: ts})
+			ids = append(ids, id)
+		}
+		_, err = rpc.NewIngressClient(conn).Send(context.Background(), &rpc.SendRequest{
+			Envelopes: &loggregator_v2.EnvelopeBatch{Batch: batch},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		egressClient := rpc.NewEgressClient(conn)
+
+		var read []string
+		ctx := context.Background()
+		for pages := 0; ; pages++ {
+			Expect(pages).To(BeNumerically("<", len(ids)))
+
+			var trailer metadata.MD
+			resp, err := egressClient.Read(ctx, &rpc.ReadRequest{
+				SourceId: "src-zero",
+				Limit:    2,
+			}, grpc.Trailer(&trailer))
+			Expect(err).ToNot(HaveOccurred())
+
+			for _, e := range resp.Envelopes.Batch {
+				read = append(read, e.GetInstanceId())
+			}
+
+			cursor, ok := lcclient.NextCursor(trailer)
+			if !ok {
+				break
+			}
+			ctx = lcclient.AppendCursor(context.Background(), cursor)
+		}
+
+		Expect(read).To(ConsistOf(ids))
+	})
+
+	It("stores every batch written over SendStream", func() {
+		cache := New(
+			testhelpers.NewMetricsRegistry(),
+			slog.New(slog.NewTextHandler(io.Discard, nil)),
+			WithAddr("127.0.0.1:0"),
+		)
+		cache.Start()
+		defer cache.Close()
+
+		conn, err := grpc.NewClient(cache.Addr(),
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+		)
+		Expect(err).ToNot(HaveOccurred())
+		defer conn.Close()
+
+		stream, err := lcclient.NewIngressStreamClient(conn).SendStream(context.Background())
+		Expect(err).ToNot(HaveOccurred())
+
+		for i := int64(1); i <= 3; i++ {
+			err := stream.Send(&rpc.SendRequest{
+				Envelopes: &loggregator_v2.EnvelopeBatch{
+					Batch: []*loggregator_v2.Envelope{
+						{SourceId: "src-zero", Timestamp: i},
+					},
+				},
+			})
+			Expect(err).ToNot(HaveOccurred())
+		}
+		Expect(stream.CloseSend()).To(Succeed())
+
+		var acks []int64
+		for {
+			written, err := stream.Recv()
+			if err == io.EOF {
+				break
+			}
+			Expect(err).ToNot(HaveOccurred())
+			acks = append(acks, written)
+		}
+		Expect(acks).To(Equal([]int64{1, 2, 3}))
+
+		resp, err := rpc.NewEgressClient(conn).Read(context.Background(), &rpc.ReadRequest{SourceId: "src-zero"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.Envelopes.Batch).To(HaveLen(3))
+	})
+
+	It("does not store envelopes dropped by the ingress transformer", func() {
+		cache := New(
+			testhelpers.NewMetricsRegistry(),
+			slog.New(slog.NewTextHandler(io.Discard, nil)),
+			WithAddr("127.0.0.1:0"),
+			WithIngressTransformer(func(e *loggregator_v2.Envelope) *loggregator_v2.Envelope {
+				if bytes.Contains(e.GetLog().GetPayload(), []byte("SECRET")) {
+					return nil
+				}
+				return e
+			}),
+		)
+		cache.Start()
+		defer cache.Close()
+
+		conn, err := grpc.NewClient(cache.Addr(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+		Expect(err).ToNot(HaveOccurred())
+		defer conn.Close()
+
+		logEnvelope := func(ts int64, payload string) *loggregator_v2.Envelope {
+			return &loggregator_v2.Envelope{
+				SourceId:  "src-zero",
+				Timestamp: ts,
+				Message: &loggregator_v2.Envelope_Log{
+					Log: &loggregator_v2.Log{Payload: []byte(payload)},
+				},
+			}
+		}
+		_, err = rpc.NewIngressClient(conn).Send(context.Background(), &rpc.SendRequest{
+			Envelopes: &loggregator_v2.EnvelopeBatch{
+				Batch: []*loggregator_v2.Envelope{
+					logEnvelope(1, "hello"),
+					logEnvelope(2, "password=SECRET"),
+					logEnvelope(3, "goodbye"),
+				},
+			},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		resp, err := rpc.NewEgressClient(conn).Read(context.Background(), &rpc.ReadRequest{SourceId: "src-zero"})
+		Expect(err).ToNot(HaveOccurred())
+
+		var payloads []string
+		for _, e := range resp.Envelopes.Batch {
+			payloads = append(payloads, string(e.GetLog().GetPayload()))
+		}
+		Expect(payloads).To(Equal([]string{"hello", "goodbye"}))
+	})
+
+	It("writes its own metrics under the self metrics source ID", func() {
+		cache := New(
+			testhelpers.NewMetricsRegistry(),
+			slog.New(slog.NewTextHandler(io.Discard, nil)),
+			WithAddr("127.0.0.1:0"),
+			WithSelfMetrics("log-cache-self", 10*time.Millisecond),
+		)
+		cache.Start()
+		defer cache.Close()
+
+		conn, err := grpc.NewClient(cache.Addr(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+		Expect(err).ToNot(HaveOccurred())
+		defer conn.Close()
+
+		_, err = rpc.NewIngressClient(conn).Send(context.Background(), &rpc.SendRequest{
+			Envelopes: &loggregator_v2.EnvelopeBatch{
+				Batch: []*loggregator_v2.Envelope{
+					{SourceId: "src-zero", Timestamp: time.Now().Add(-time.Minute).UnixNano()},
+				},
+			},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		egress := rpc.NewEgressClient(conn)
+		var metrics map[string]*loggregator_v2.GaugeValue
+		Eventually(func() map[string]*loggregator_v2.GaugeValue {
+			resp, err := egress.Read(context.Background(), &rpc.ReadRequest{
+				SourceId:   "log-cache-self",
+				Descending: true,
+				Limit:      1,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			if len(resp.Envelopes.Batch) == 0 {
+				return nil
+			}
+
+			e := resp.Envelopes.Batch[0]
+			Expect(e.GetInstanceId()).To(Equal("0"))
+			metrics = e.GetGauge().GetMetrics()
+			return metrics
+		}).Should(HaveKey("log_cache_store_size"))
+
+		Expect(metrics).To(HaveKey("log_cache_expired"))
+		Expect(metrics["log_cache_store_size"].GetValue()).To(BeNumerically(">=", 1))
+		Expect(metrics["log_cache_cache_period"].GetValue()).To(BeNumerically(">=", float64(time.Minute/time.Millisecond)))
+	})
+
+	It("aggregates counters by tag", func() {
+		cache := New(
+			testhelpers.NewMetricsRegistry(),
+			slog.New(slog.NewTextHandler(io.Discard, nil)),
+			WithAddr("127.0.0.1:0"),
+		)
+		cache.Start()
+		defer cache.Close()
+
+		counter := func(ts int64, name, az string, total uint64) *loggregator_v2.Envelope {
+			return &loggregator_v2.Envelope{
+				SourceId:  "src-zero",
+				Timestamp: ts,
+				Tags:      map[string]string{"az": az},
+				Message: &loggregator_v2.Envelope_Counter{
+					Counter: &loggregator_v2.Counter{Name: name, Total: total},
+				},
+			}
+		}
+
+		conn, err := grpc.NewClient(cache.Addr(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+		Expect(err).ToNot(HaveOccurred())
+		defer conn.Close()
+
+		_, err = rpc.NewIngressClient(conn).Send(context.Background(), &rpc.SendRequest{
+			Envelopes: &loggregator_v2.EnvelopeBatch{
+				Batch: []*loggregator_v2.Envelope{
+					counter(1, "requests", "z1", 10),
+					counter(2, "requests", "z2", 3),
+					counter(3, "requests", "z1", 15),
+					counter(4, "requests_total", "z1", 100),
+					counter(5, "requests", "z2", 4),
+				},
+			},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		Eventually(func() []lcclient.AggregateGroup {
+			groups, err := lcclient.NewAggregationClient(conn).Aggregate(context.Background(), "src-zero", "requests", "az", time.Unix(0, 0), time.Time{})
+			Expect(err).ToNot(HaveOccurred())
+			return groups
+		}).Should(Equal([]lcclient.AggregateGroup{
+			{Value: "z1", Sum: 5, Avg: 5, Count: 1},
+			{Value: "z2", Sum: 1, Avg: 1, Count: 1},
+		}))
+	})
+
+	It("lists the distinct metric names of a source ID", func() {
+		cache := New(
+			testhelpers.NewMetricsRegistry(),
+			slog.New(slog.NewTextHandler(io.Discard, nil)),
+			WithAddr("127.0.0.1:0"),
+		)
+		cache.Start()
+		defer cache.Close()
+
+		writeEnvelopesNoTLS(cache.Addr(), []*loggregator_v2.Envelope{
+			{
+				SourceId:  "src-zero",
+				Timestamp: 1,
+				Message: &loggregator_v2.Envelope_Counter{
+					Counter: &loggregator_v2.Counter{Name: "requests", Total: 1},
+				},
+			},
+			{
+				SourceId:  "src-zero",
+				Timestamp: 2,
+				Message: &loggregator_v2.Envelope_Gauge{
+					Gauge: &loggregator_v2.Gauge{
+						Metrics: map[string]*loggregator_v2.GaugeValue{"cpu": {Value: 0.5}},
+					},
+				},
+			},
+			{
+				SourceId:  "src-zero",
+				Timestamp: 3,
+				Message: &loggregator_v2.Envelope_Timer{
+					Timer: &loggregator_v2.Timer{Name: "latency", Start: 1, Stop: 2},
+				},
+			},
+			{
+				SourceId:  "src-zero",
+				Timestamp: 4,
+				Message: &loggregator_v2.Envelope_Counter{
+					Counter: &loggregator_v2.Counter{Name: "requests", Total: 2},
+				},
+			},
+			{
+				SourceId:  "src-zero",
+				Timestamp: 5,
+				Message: &loggregator_v2.Envelope_Log{
+					Log: &loggregator_v2.Log{Payload: []byte("hello")},
+				},
+			},
+		})
+
+		conn, err := grpc.NewClient(cache.Addr(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+		Expect(err).ToNot(HaveOccurred())
+		defer conn.Close()
+
+		Eventually(func() []lcclient.MetricName {
+			names, err := lcclient.NewMetricNamesClient(conn).MetricNames(context.Background(), "src-zero", time.Unix(0, 0), time.Time{}, 0)
+			Expect(err).ToNot(HaveOccurred())
+			return names
+		}).Should(Equal([]lcclient.MetricName{
+			{Name: "requests", Timestamp: 4},
+			{Name: "latency", Timestamp: 3},
+			{Name: "cpu", Timestamp: 2},
+		}))
+	})
+
+	DescribeTable("gzips read responses when configured to", func(opts []LogCacheOption, compressed bool) {
+		cache := New(
+			testhelpers.NewMetricsRegistry(),
+			slog.New(slog.NewTextHandler(io.Discard, nil)),
+			append([]LogCacheOption{WithAddr("127.0.0.1:0")}, opts...)...,
+		)
+		cache.Start()
+		defer cache.Close()
+
+		var es []*loggregator_v2.Envelope
+		for i := int64(1); i <= 100; i++ {
+			es = append(es, &loggregator_v2.Envelope{
+				SourceId:  "src-zero",
+				Timestamp: i,
+				Message: &loggregator_v2.Envelope_Log{
+					Log: &loggregator_v2.Log{Payload: bytes.Repeat([]byte("some-log-line "), 20)},
+				},
+			})
+		}
+		writeEnvelopesNoTLS(cache.Addr(), es)
+
+		payloads := &spyPayloadStats{}
+		conn, err := grpc.NewClient(cache.Addr(),
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+			grpc.WithStatsHandler(payloads),
+		)
+		Expect(err).ToNot(HaveOccurred())
+		defer conn.Close()
+
+		var resp *rpc.ReadResponse
+		Eventually(func() []*loggregator_v2.Envelope {
+			resp, err = rpc.NewEgressClient(conn).Read(context.Background(), &rpc.ReadRequest{
+				SourceId: "src-zero",
+			})
+			Expect(err).ToNot(HaveOccurred())
+			return resp.GetEnvelopes().GetBatch()
+		}).Should(HaveLen(100))
+
+		for i, e := range resp.GetEnvelopes().GetBatch() {
+			Expect(proto.Equal(e, es[i])).To(BeTrue())
+		}
+
+		in := payloads.last()
+		if compressed {
+			Expect(in.CompressedLength).To(BeNumerically("<", in.Length/10))
+		} else {
+			Expect(in.CompressedLength).To(Equal(in.Length))
+		}
+	},
+		Entry("enabled", []LogCacheOption{WithResponseCompression()}, true),
+		Entry("disabled", nil, false),
+	)
+
+	Describe("admin", func() {
+		sendEnvelopes := func(addr string) *grpc.ClientConn {
+			conn, err := grpc.NewClient(addr,
+				grpc.WithTransportCredentials(insecure.NewCredentials()),
+			)
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = rpc.NewIngressClient(conn).Send(context.Background(), &rpc.SendRequest{
+				Envelopes: &loggregator_v2.EnvelopeBatch{
+					Batch: []*loggregator_v2.Envelope{
+						{SourceId: "src-zero", Timestamp: 1},
+						{SourceId: "src-zero", Timestamp: 2},
+					},
+				},
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			return conn
+		}
+
+		It("purges a source ID", func() {
+			cache := New(
+				testhelpers.NewMetricsRegistry(),
+				slog.New(slog.NewTextHandler(io.Discard, nil)),
+				WithAddr("127.0.0.1:0"),
+				WithAdminEnabled(),
+			)
+			cache.Start()
+			defer cache.Close()
+
+			conn := sendEnvelopes(cache.Addr())
+			defer conn.Close()
+			egressClient := rpc.NewEgressClient(conn)
+
+			Eventually(func() map[string]*rpc.MetaInfo {
+				resp, err := egressClient.Meta(context.Background(), &rpc.MetaRequest{LocalOnly: true})
+				Expect(err).ToNot(HaveOccurred())
+				return resp.Meta
+			}).Should(HaveKey("src-zero"))
+
+			purged, err := lcclient.NewAdminClient(conn).PurgeSourceID(context.Background(), "src-zero")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(purged).To(Equal(int64(2)))
+
+			resp, err := egressClient.Read(context.Background(), &rpc.ReadRequest{SourceId: "src-zero"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.Envelopes.Batch).To(BeEmpty())
+
+			Eventually(func() map[string]*rpc.MetaInfo {
+				resp, err := egressClient.Meta(context.Background(), &rpc.MetaRequest{LocalOnly: true})
+				Expect(err).ToNot(HaveOccurred())
+				return resp.Meta
+			}, 3).ShouldNot(HaveKey("src-zero"))
+		})
+
+		It("pauses a source ID", func() {
+			spyMetrics := testhelpers.NewMetricsRegistry()
+			cache := New(
+				spyMetrics,
+				slog.New(slog.NewTextHandler(io.Discard, nil)),
+				WithAddr("127.0.0.1:0"),
+				WithAdminEnabled(),
+			)
+			cache.Start()
+			defer cache.Close()
+
+			conn, err := grpc.NewClient(cache.Addr(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+			Expect(err).ToNot(HaveOccurred())
+			defer conn.Close()
+
+			resume, err := lcclient.NewAdminClient(conn).PauseSourceID(context.Background(), "src-zero", 500*time.Millisecond)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resume).To(BeTemporally("~", time.Now().Add(500*time.Millisecond), 250*time.Millisecond))
+
+			sendEnvelopes(cache.Addr()).Close()
+			Eventually(func() float64 {
+				return spyMetrics.GetMetric("log_cache_paused_dropped", nil).Value()
+			}).Should(Equal(2.0))
+
+			egressClient := rpc.NewEgressClient(conn)
+			resp, err := egressClient.Read(context.Background(), &rpc.ReadRequest{SourceId: "src-zero"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.Envelopes.Batch).To(BeEmpty())
+
+			time.Sleep(time.Until(resume))
+			sendEnvelopes(cache.Addr()).Close()
+			Eventually(func() []*loggregator_v2.Envelope {
+				resp, err := egressClient.Read(context.Background(), &rpc.ReadRequest{SourceId: "src-zero"})
+				Expect(err).ToNot(HaveOccurred())
+				return resp.Envelopes.Batch
+			}).Should(HaveLen(2))
+		})
+
+		It("exports a source ID", func() {
+			cache := New(
+				testhelpers.NewMetricsRegistry(),
+				slog.New(slog.NewTextHandler(io.Discard, nil)),
+				WithAddr("127.0.0.1:0"),
+				WithAdminEnabled(),
+			)
+			cache.Start()
+			defer cache.Close()
+
+			conn := sendEnvelopes(cache.Addr())
+			defer conn.Close()
+
+			Eventually(func() int {
+				stream, err := lcclient.NewAdminClient(conn).ExportSourceID(context.Background(), "src-zero", time.Unix(0, 0), time.Time{})
+				Expect(err).ToNot(HaveOccurred())
+
+				var exported int
+				for {
+					_, err := stream.Recv()
+					if err == io.EOF {
+						return exported
+					}
+					Expect(err).ToNot(HaveOccurred())
+					exported++
+				}
+			}).Should(Equal(2))
+		})
+
+		It("lists the source IDs holding the most envelopes first in its diagnostics", func() {
+			cache := New(
+				testhelpers.NewMetricsRegistry(),
+				slog.New(slog.NewTextHandler(io.Discard, nil)),
+				WithAddr("127.0.0.1:0"),
+				WithAdminEnabled(),
+			)
+			cache.Start()
+			defer cache.Close()
+
+			conn := sendEnvelopes(cache.Addr())
+			defer conn.Close()
+
+			_, err := rpc.NewIngressClient(conn).Send(context.Background(), &rpc.SendRequest{
+				Envelopes: &loggregator_v2.EnvelopeBatch{
+					Batch: []*loggregator_v2.Envelope{
+						{SourceId: "src-one", Timestamp: 3},
+						{SourceId: "src-one", Timestamp: 4},
+						{SourceId: "src-one", Timestamp: 5},
+					},
+				},
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			Eventually(func() []lcclient.SourceDiagnostics {
+				diagnostics, err := lcclient.NewAdminClient(conn).Diagnostics(context.Background(), 0)
+				Expect(err).ToNot(HaveOccurred())
+				return diagnostics
+			}).Should(Equal([]lcclient.SourceDiagnostics{
+				{SourceID: "src-one", Size: 3, Depth: 2, OldestTimestamp: 3, NewestTimestamp: 5},
+				{SourceID: "src-zero", Size: 2, Depth: 2, OldestTimestamp: 1, NewestTimestamp: 2},
+			}))
+		})
+
+		It("does not serve the admin service by default", func() {
+			cache := New(
+				testhelpers.NewMetricsRegistry(),
+				slog.New(slog.NewTextHandler(io.Discard, nil)),
+				WithAddr("127.0.0.1:0"),
+			)
+			cache.Start()
+			defer cache.Close()
+
+			conn := sendEnvelopes(cache.Addr())
+			defer conn.Close()
+
+			_, err := lcclient.NewAdminClient(conn).PurgeSourceID(context.Background(), "src-zero")
+			Expect(status.Code(err)).To(Equal(codes.Unimplemented))
+		})
+	})
+
 	It("prunes envelopes against a static limit", func() {
 		var err error
 		Expect(err).ToNot(HaveOccurred())
@@ -421,7 +1226,7 @@ var _ = Describe("LogCache", func() {
 
 		cache := New(
 			spyMetrics,
-			log.New(io.Discard, "", 0),
+			slog.New(slog.NewTextHandler(io.Discard, nil)),
 			WithAddr("127.0.0.1:0"),
 			WithClustered(0, []string{"my-addr", peerAddr},
 				grpc.WithTransportCredentials(insecure.NewCredentials()),
@@ -550,6 +1355,7 @@ func writeEnvelopes(addr string, es []*loggregator_v2.Envelope) {
 			Timestamp: e.Timestamp,
 			SourceId:  e.SourceId,
 			Message:   e.Message,
+			Tags:      e.Tags,
 		})
 	}
 
@@ -590,3 +1396,32 @@ func writeEnvelopesNoTLS(addr string, es []*loggregator_v2.Envelope) {
 		panic(err)
 	}
 }
+
+type spyPayloadStats struct {
+	mu       sync.Mutex
+	payloads []*stats.InPayload
+}
+
+func (s *spyPayloadStats) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (s *spyPayloadStats) HandleRPC(_ context.Context, rs stats.RPCStats) {
+	if p, ok := rs.(*stats.InPayload); ok {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.payloads = append(s.payloads, p)
+	}
+}
+
+func (s *spyPayloadStats) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (s *spyPayloadStats) HandleConn(context.Context, stats.ConnStats) {}
+
+func (s *spyPayloadStats) last() *stats.InPayload {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.payloads[len(s.payloads)-1]
+}
@@ -0,0 +1,61 @@
+package cache
+
+import (
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"code.cloudfoundry.org/go-log-cache/v3/rpc/logcache_v1"
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	"code.cloudfoundry.org/log-cache/internal/cache/store"
+)
+
+// writeSelfMetrics sends the stats of s as a gauge envelope to the ingress
+// proxy every interval until the LogCache is closed.
+func (c *LogCache) writeSelfMetrics(s *store.Store, ingress logcache_v1.IngressServer) {
+	t := time.NewTicker(c.selfMetricsInterval)
+	defer t.Stop()
+
+	for range t.C {
+		if atomic.LoadInt64(&c.closing) > 0 {
+			return
+		}
+
+		_, err := ingress.Send(context.Background(), &logcache_v1.SendRequest{
+			Envelopes: &loggregator_v2.EnvelopeBatch{
+				Batch: []*loggregator_v2.Envelope{c.selfMetricsEnvelope(s.Stats())},
+			},
+		})
+		if err != nil {
+			c.log.Error("failed to write self metrics", "source_id", c.selfMetricsSourceID, "error", err)
+		}
+	}
+}
+
+func (c *LogCache) selfMetricsEnvelope(stats store.Stats) *loggregator_v2.Envelope {
+	return &loggregator_v2.Envelope{
+		SourceId:   c.selfMetricsSourceID,
+		InstanceId: strconv.Itoa(c.nodeIndex),
+		Timestamp:  time.Now().UnixNano(),
+		Message: &loggregator_v2.Envelope_Gauge{
+			Gauge: &loggregator_v2.Gauge{
+				Metrics: map[string]*loggregator_v2.GaugeValue{
+					"log_cache_expired": {
+						Unit:  "envelopes",
+						Value: float64(stats.Expired),
+					},
+					"log_cache_store_size": {
+						Unit:  "entries",
+						Value: float64(stats.Size),
+					},
+					"log_cache_cache_period": {
+						Unit:  "milliseconds",
+						Value: float64(stats.CachePeriod / time.Millisecond),
+					},
+				},
+			},
+		},
+	}
+}
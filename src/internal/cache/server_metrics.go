@@ -0,0 +1,98 @@
+package cache
+
+import (
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/go-log-cache/v3/rpc/logcache_v1"
+	metrics "code.cloudfoundry.org/go-metric-registry"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// ServerMetrics records the duration and errors of unary RPCs handled by the
+// LogCache gRPC server, labelled by method, and the size of Read responses.
+type ServerMetrics struct {
+	m                Metrics
+	readResponseSize metrics.Histogram
+
+	mu         sync.Mutex
+	durations  map[string]metrics.Histogram
+	errorCount map[string]metrics.Counter
+}
+
+// NewServerMetrics creates and returns a new ServerMetrics.
+func NewServerMetrics(m Metrics) *ServerMetrics {
+	return &ServerMetrics{
+		m: m,
+		// Clients reject messages over 50MB, so the buckets are finest
+		// close to that limit.
+		readResponseSize: m.NewHistogram(
+			"log_cache_read_response_size",
+			"Size of serialized Read responses in bytes.",
+			[]float64{1 << 10, 10 << 10, 100 << 10, 1 << 20, 5 << 20, 10 << 20, 25 << 20, 40 << 20, 50 << 20},
+			metrics.WithMetricLabels(map[string]string{"unit": "bytes"}),
+		),
+		durations:  make(map[string]metrics.Histogram),
+		errorCount: make(map[string]metrics.Counter),
+	}
+}
+
+// UnaryInterceptor returns a grpc.UnaryServerInterceptor that records the
+// duration of every RPC and counts the ones that return an error. The size
+// of every Read response is recorded too.
+func (s *ServerMetrics) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		s.duration(info.FullMethod).Observe(time.Since(start).Seconds())
+
+		if err != nil {
+			s.errors(info.FullMethod, status.Code(err).String()).Add(1)
+		}
+
+		if r, ok := resp.(*logcache_v1.ReadResponse); ok {
+			s.readResponseSize.Observe(float64(proto.Size(r)))
+		}
+
+		return resp, err
+	}
+}
+
+func (s *ServerMetrics) duration(method string) metrics.Histogram {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	h, ok := s.durations[method]
+	if !ok {
+		h = s.m.NewHistogram(
+			"log_cache_grpc_server_request_duration",
+			"Duration of gRPC requests handled by the log cache server in seconds.",
+			[]float64{.001, .005, .01, .05, .1, .5, 1, 5, 10},
+			metrics.WithMetricLabels(map[string]string{"method": method, "unit": "seconds"}),
+		)
+		s.durations[method] = h
+	}
+
+	return h
+}
+
+func (s *ServerMetrics) errors(method, code string) metrics.Counter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := method + ":" + code
+	c, ok := s.errorCount[key]
+	if !ok {
+		c = s.m.NewCounter(
+			"log_cache_grpc_server_request_errors",
+			"Total number of gRPC requests handled by the log cache server that returned an error.",
+			metrics.WithMetricLabels(map[string]string{"method": method, "code": code}),
+		)
+		s.errorCount[key] = c
+	}
+
+	return c
+}
@@ -0,0 +1,155 @@
+package cache_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+
+	"code.cloudfoundry.org/go-log-cache/v3/rpc/logcache_v1"
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metrics "code.cloudfoundry.org/go-metric-registry"
+	"code.cloudfoundry.org/go-metric-registry/testhelpers"
+	"google.golang.org/grpc"
+
+	. "code.cloudfoundry.org/log-cache/internal/cache"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ServerMetrics", func() {
+	var (
+		spyMetrics  *testhelpers.SpyMetricsRegistry
+		interceptor grpc.UnaryServerInterceptor
+		info        *grpc.UnaryServerInfo
+	)
+
+	BeforeEach(func() {
+		spyMetrics = testhelpers.NewMetricsRegistry()
+		interceptor = NewServerMetrics(spyMetrics).UnaryInterceptor()
+		info = &grpc.UnaryServerInfo{FullMethod: "/logcache.v1.Egress/Read"}
+	})
+
+	It("records the duration of a successful request", func() {
+		resp, err := interceptor(context.Background(), "req", info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return "resp", nil
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp).To(Equal("resp"))
+
+		Expect(spyMetrics.HasMetric("log_cache_grpc_server_request_duration", map[string]string{
+			"method": "/logcache.v1.Egress/Read",
+			"unit":   "seconds",
+		})).To(BeTrue())
+		Expect(spyMetrics.HasMetric("log_cache_grpc_server_request_errors", map[string]string{
+			"method": "/logcache.v1.Egress/Read",
+			"code":   "Unknown",
+		})).To(BeFalse())
+	})
+
+	It("records the duration and an error for a failing request", func() {
+		_, err := interceptor(context.Background(), "req", info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return nil, errors.New("some-error")
+		})
+		Expect(err).To(MatchError("some-error"))
+
+		Expect(spyMetrics.HasMetric("log_cache_grpc_server_request_duration", map[string]string{
+			"method": "/logcache.v1.Egress/Read",
+			"unit":   "seconds",
+		})).To(BeTrue())
+		Expect(spyMetrics.GetMetricValue("log_cache_grpc_server_request_errors", map[string]string{
+			"method": "/logcache.v1.Egress/Read",
+			"code":   "Unknown",
+		})).To(Equal(1.0))
+	})
+
+	It("records the size of Read responses in buckets", func() {
+		m := &bucketMetrics{SpyMetricsRegistry: testhelpers.NewMetricsRegistry()}
+		interceptor = NewServerMetrics(m).UnaryInterceptor()
+
+		read := func(payload int) {
+			_, err := interceptor(context.Background(), "req", info, func(ctx context.Context, req interface{}) (interface{}, error) {
+				return &logcache_v1.ReadResponse{
+					Envelopes: &loggregator_v2.EnvelopeBatch{
+						Batch: []*loggregator_v2.Envelope{{
+							SourceId: "some-id",
+							Message: &loggregator_v2.Envelope_Log{
+								Log: &loggregator_v2.Log{Payload: []byte(strings.Repeat("x", payload))},
+							},
+						}},
+					},
+				}, nil
+			})
+			Expect(err).ToNot(HaveOccurred())
+		}
+
+		read(10)
+		read(2 << 20)
+
+		h := m.histogram("log_cache_read_response_size")
+		Expect(h.observations()).To(HaveLen(2))
+		Expect(h.bucket(h.observations()[1])).To(BeNumerically(">", h.bucket(h.observations()[0])))
+	})
+})
+
+// bucketMetrics keeps the buckets and observations of histograms, which the
+// spy registry does not.
+type bucketMetrics struct {
+	*testhelpers.SpyMetricsRegistry
+
+	mu         sync.Mutex
+	histograms map[string]*bucketHistogram
+}
+
+func (m *bucketMetrics) NewHistogram(name, helpText string, buckets []float64, opts ...metrics.MetricOption) metrics.Histogram {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.histograms == nil {
+		m.histograms = make(map[string]*bucketHistogram)
+	}
+	h := &bucketHistogram{buckets: buckets}
+	m.histograms[name] = h
+
+	return h
+}
+
+func (m *bucketMetrics) histogram(name string) *bucketHistogram {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.histograms[name]
+}
+
+type bucketHistogram struct {
+	buckets []float64
+
+	mu     sync.Mutex
+	values []float64
+}
+
+func (h *bucketHistogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.values = append(h.values, v)
+}
+
+func (h *bucketHistogram) observations() []float64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return append([]float64(nil), h.values...)
+}
+
+// bucket returns the index of the first bucket that holds v.
+func (h *bucketHistogram) bucket(v float64) int {
+	for i, b := range h.buckets {
+		if v <= b {
+			return i
+		}
+	}
+
+	return len(h.buckets)
+}
@@ -0,0 +1,102 @@
+package store
+
+import (
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	"google.golang.org/protobuf/proto"
+)
+
+// deduplicator remembers a hash of every envelope it has seen within a
+// sliding window so that envelopes delivered more than once, for example by
+// both nozzles of an HA pair, are only stored once. It remembers at most
+// maxEntries hashes; once full, the oldest hash is forgotten early. All
+// functions are thread safe.
+type deduplicator struct {
+	window time.Duration
+
+	mu   sync.Mutex
+	seen map[uint64]struct{}
+
+	// ring holds the remembered hashes oldest first, starting at head.
+	ring []dedupEntry
+	head int
+	size int
+
+	bufs sync.Pool
+}
+
+type dedupEntry struct {
+	hash uint64
+	seen int64
+}
+
+func newDeduplicator(window time.Duration, maxEntries int) *deduplicator {
+	return &deduplicator{
+		window: window,
+		seen:   make(map[uint64]struct{}, maxEntries),
+		ring:   make([]dedupEntry, maxEntries),
+		bufs: sync.Pool{
+			New: func() interface{} { return new([]byte) },
+		},
+	}
+}
+
+// duplicate reports whether an identical envelope was seen for the source
+// ID within the window, and remembers the envelope if not.
+func (d *deduplicator) duplicate(e *loggregator_v2.Envelope, sourceId string, now time.Time) bool {
+	h, err := d.hash(e, sourceId)
+	if err != nil {
+		// An envelope that can not be hashed is never a duplicate.
+		return false
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	cutoff := now.Add(-d.window).UnixNano()
+	for d.size > 0 && d.ring[d.head].seen < cutoff {
+		d.forgetOldest()
+	}
+
+	if _, ok := d.seen[h]; ok {
+		return true
+	}
+
+	if d.size == len(d.ring) {
+		d.forgetOldest()
+	}
+	d.ring[(d.head+d.size)%len(d.ring)] = dedupEntry{hash: h, seen: now.UnixNano()}
+	d.size++
+	d.seen[h] = struct{}{}
+
+	return false
+}
+
+func (d *deduplicator) forgetOldest() {
+	delete(d.seen, d.ring[d.head].hash)
+	d.head = (d.head + 1) % len(d.ring)
+	d.size--
+}
+
+// hash hashes the source ID with the envelope, which holds its timestamp
+// and message. The envelope is marshaled deterministically so that equal
+// envelopes always hash the same.
+func (d *deduplicator) hash(e *loggregator_v2.Envelope, sourceId string) (uint64, error) {
+	buf := d.bufs.Get().(*[]byte)
+	defer d.bufs.Put(buf)
+
+	var err error
+	*buf, err = proto.MarshalOptions{Deterministic: true}.MarshalAppend((*buf)[:0], e)
+	if err != nil {
+		return 0, err
+	}
+
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(sourceId))
+	_, _ = h.Write(*buf)
+
+	return h.Sum64(), nil
+}
@@ -0,0 +1,42 @@
+package store
+
+import "container/heap"
+
+// LockSource takes the write lock of the storage for an existing source ID
+// and returns a function that releases it.
+func (store *Store) LockSource(sourceID string) (unlock func()) {
+	s, _ := store.getOrInitializeStorage(sourceID)
+	s.Lock()
+
+	return s.Unlock
+}
+
+// BuildExpirationHeapByPush builds the expiration heap by pushing the
+// oldest timestamp of each source ID onto it while ranging over them, as
+// truncation did before the heap build was parallelized.
+func (store *Store) BuildExpirationHeapByPush() *ExpirationHeap {
+	expirationHeap := &ExpirationHeap{}
+	heap.Init(expirationHeap)
+
+	store.storageIndex.Range(func(sourceId interface{}, tree interface{}) bool {
+		tree.(*storage).RLock()
+		oldestTimestamp := tree.(*storage).Left().Key.(int64)
+		heap.Push(expirationHeap, storageExpiration{timestamp: oldestTimestamp, sourceId: sourceId.(string), tree: tree.(*storage)})
+		tree.(*storage).RUnlock()
+
+		return true
+	})
+
+	return expirationHeap
+}
+
+// PopSourceIDs empties the heap and returns the source IDs in the order
+// truncation would prune them.
+func (h *ExpirationHeap) PopSourceIDs() []string {
+	var sourceIDs []string
+	for h.Len() > 0 {
+		sourceIDs = append(sourceIDs, heap.Pop(h).(storageExpiration).sourceId)
+	}
+
+	return sourceIDs
+}
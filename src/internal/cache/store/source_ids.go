@@ -0,0 +1,89 @@
+package store
+
+import (
+	"container/list"
+	"sync/atomic"
+)
+
+// sourceIDs tracks the number of source IDs in the store and, with a
+// maximum, the order in which they were last written so that the least
+// recently written one can be evicted.
+type sourceIDs struct {
+	count int64
+
+	// lru is ordered from most to least recently written. It is nil
+	// without a maximum.
+	lru *list.List
+}
+
+// addSource records a new source ID in the index. If that takes the
+// store beyond the maximum number of source IDs, the least recently
+// written source ID is returned to be evicted. It must be called with the
+// initializationMutex held.
+func (store *Store) addSource(s *storage) *storage {
+	n := atomic.AddInt64(&store.sourceIDs.count, 1)
+	store.metrics.sourceIDCount.Set(float64(n))
+
+	if store.sourceIDs.lru == nil {
+		return nil
+	}
+
+	store.lruMu.Lock()
+	defer store.lruMu.Unlock()
+
+	s.lru = store.sourceIDs.lru.PushFront(s)
+	if int(n) <= store.maxSourceIDs {
+		return nil
+	}
+
+	return store.sourceIDs.lru.Back().Value.(*storage)
+}
+
+// removeSource removes the storage of a source ID from the index, unless
+// it was already replaced or removed. It reports whether it was removed.
+func (store *Store) removeSource(s *storage) bool {
+	if !store.storageIndex.CompareAndDelete(s.sourceId, s) {
+		return false
+	}
+
+	n := atomic.AddInt64(&store.sourceIDs.count, -1)
+	store.metrics.sourceIDCount.Set(float64(n))
+
+	if store.sourceIDs.lru != nil {
+		store.lruMu.Lock()
+		if s.lru != nil {
+			store.sourceIDs.lru.Remove(s.lru)
+			s.lru = nil
+		}
+		store.lruMu.Unlock()
+	}
+
+	return true
+}
+
+// touchSource marks a source ID as the most recently written.
+func (store *Store) touchSource(s *storage) {
+	if store.sourceIDs.lru == nil {
+		return
+	}
+
+	store.lruMu.Lock()
+	if s.lru != nil {
+		store.sourceIDs.lru.MoveToFront(s.lru)
+	}
+	store.lruMu.Unlock()
+}
+
+// evictSource drops every envelope of a source ID that was pushed out by
+// a new one.
+func (store *Store) evictSource(s *storage) {
+	if !store.removeSource(s) {
+		return
+	}
+
+	n := s.discard()
+	remaining := atomic.AddInt64(&store.count, -int64(n))
+	store.metrics.storeSize.Set(float64(remaining))
+	store.metrics.sourceIDsEvicted.Add(1)
+	store.log.Debug("evicted least recently written source ID", "source_id", s.sourceId, "envelopes", n)
+}
@@ -0,0 +1,271 @@
+package store
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	"google.golang.org/protobuf/proto"
+)
+
+// spillSegments is the number of segment files the spillover is split
+// into. When every segment is full the oldest one is deleted, so at most
+// 1/spillSegments of the spilled envelopes are dropped at once.
+const spillSegments = 4
+
+// spillover is an on-disk ring buffer of envelopes that were pruned from
+// memory. Envelopes are appended to the newest of up to spillSegments
+// segment files. Once it is full, the oldest segment is deleted to make
+// room, keeping the total size within maxBytes.
+type spillover struct {
+	dir          string
+	segmentBytes int64
+
+	mu       sync.RWMutex
+	segments []*spillSegment
+	active   *os.File
+	next     int
+}
+
+// spillSegment is a segment file and the time range of the envelopes it
+// holds for each source ID, so that reads only open segments that may
+// hold matching envelopes.
+type spillSegment struct {
+	path    string
+	size    int64
+	sources map[string]spillRange
+}
+
+type spillRange struct {
+	oldest int64
+	newest int64
+}
+
+// newSpillover creates a spillover in dir. Segments left behind by a
+// previous process are removed because they are not indexed.
+func newSpillover(dir string, maxBytes int64) (*spillover, error) {
+	if maxBytes < spillSegments {
+		return nil, fmt.Errorf("spillover size must be at least %d bytes, got %d", spillSegments, maxBytes)
+	}
+
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, err
+	}
+
+	stale, err := filepath.Glob(filepath.Join(dir, "spill-*.seg"))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range stale {
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	return &spillover{
+		dir:          dir,
+		segmentBytes: maxBytes / spillSegments,
+	}, nil
+}
+
+// write appends the envelopes to the spillover. It returns how many were
+// written; envelopes larger than a segment are skipped.
+func (s *spillover) write(envelopes []*loggregator_v2.Envelope) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var (
+		written int
+		buf     []byte
+	)
+	for _, e := range envelopes {
+		data, err := proto.Marshal(e)
+		if err != nil {
+			return written, err
+		}
+
+		record := binary.AppendUvarint(nil, uint64(len(data)))
+		record = append(record, data...)
+		if int64(len(record)) > s.segmentBytes {
+			continue
+		}
+
+		if s.active == nil || s.current().size+int64(len(buf)+len(record)) > s.segmentBytes {
+			if err := s.flush(buf); err != nil {
+				return written, err
+			}
+			buf = buf[:0]
+
+			if err := s.rotate(); err != nil {
+				return written, err
+			}
+		}
+
+		buf = append(buf, record...)
+		s.current().add(e)
+		written++
+	}
+
+	return written, s.flush(buf)
+}
+
+func (s *spillover) current() *spillSegment {
+	return s.segments[len(s.segments)-1]
+}
+
+// flush writes buf to the active segment. It must be called with mu held.
+func (s *spillover) flush(buf []byte) error {
+	if len(buf) == 0 {
+		return nil
+	}
+
+	n, err := s.active.Write(buf)
+	s.current().size += int64(n)
+
+	return err
+}
+
+// rotate starts a new segment, deleting the oldest one if every segment
+// is in use. It must be called with mu held.
+func (s *spillover) rotate() error {
+	if s.active != nil {
+		if err := s.active.Close(); err != nil {
+			return err
+		}
+		s.active = nil
+	}
+
+	if len(s.segments) >= spillSegments {
+		if err := os.Remove(s.segments[0].path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		s.segments = s.segments[1:]
+	}
+
+	path := filepath.Join(s.dir, fmt.Sprintf("spill-%020d.seg", s.next))
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0640)
+	if err != nil {
+		return err
+	}
+	s.next++
+
+	s.active = f
+	s.segments = append(s.segments, &spillSegment{
+		path:    path,
+		sources: make(map[string]spillRange),
+	})
+
+	return nil
+}
+
+func (seg *spillSegment) add(e *loggregator_v2.Envelope) {
+	r, ok := seg.sources[e.GetSourceId()]
+	if !ok {
+		r = spillRange{oldest: e.GetTimestamp(), newest: e.GetTimestamp()}
+	}
+	r.oldest = min(r.oldest, e.GetTimestamp())
+	r.newest = max(r.newest, e.GetTimestamp())
+
+	seg.sources[e.GetSourceId()] = r
+}
+
+// size returns the total size of the segments in bytes.
+func (s *spillover) size() int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var size int64
+	for _, seg := range s.segments {
+		size += seg.size
+	}
+
+	return size
+}
+
+// purge makes the envelopes of the source ID unreadable. They are removed
+// from disk when their segment is deleted.
+func (s *spillover) purge(sourceID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, seg := range s.segments {
+		delete(seg.sources, sourceID)
+	}
+}
+
+// traverse calls f with each spilled envelope of the source ID in
+// [start..end), in ascending or descending order of timestamp, until f
+// returns true.
+func (s *spillover) traverse(sourceID string, start, end int64, descending bool, f func(e *loggregator_v2.Envelope) bool) error {
+	s.mu.RLock()
+	var envelopes []*loggregator_v2.Envelope
+	for _, seg := range s.segments {
+		r, ok := seg.sources[sourceID]
+		if !ok || r.newest < start || r.oldest >= end {
+			continue
+		}
+
+		err := seg.read(func(e *loggregator_v2.Envelope) {
+			if e.GetSourceId() == sourceID && e.GetTimestamp() >= start && e.GetTimestamp() < end {
+				envelopes = append(envelopes, e)
+			}
+		})
+		if err != nil {
+			s.mu.RUnlock()
+			return err
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.SliceStable(envelopes, func(i, j int) bool {
+		if descending {
+			return envelopes[i].GetTimestamp() > envelopes[j].GetTimestamp()
+		}
+		return envelopes[i].GetTimestamp() < envelopes[j].GetTimestamp()
+	})
+
+	for _, e := range envelopes {
+		if f(e) {
+			break
+		}
+	}
+
+	return nil
+}
+
+// read decodes every envelope written to the segment so far.
+func (seg *spillSegment) read(f func(e *loggregator_v2.Envelope)) error {
+	file, err := os.Open(seg.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(io.LimitReader(file, seg.size))
+	for {
+		n, err := binary.ReadUvarint(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		data := make([]byte, n)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return err
+		}
+
+		var e loggregator_v2.Envelope
+		if err := proto.Unmarshal(data, &e); err != nil {
+			return err
+		}
+		f(&e)
+	}
+}
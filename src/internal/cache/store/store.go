@@ -2,8 +2,16 @@ package store
 
 import (
 	"container/heap"
+	"container/list"
+	"context"
+	"io"
+	"log/slog"
+	"math"
 	"regexp"
 	"runtime"
+	"runtime/pprof"
+	"sort"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -14,6 +22,8 @@ import (
 	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
 	"github.com/emirpasic/gods/trees/avltree"
 	"github.com/emirpasic/gods/utils"
+
+	"code.cloudfoundry.org/log-cache/internal/severity"
 )
 
 type MetricsRegistry interface {
@@ -41,10 +51,20 @@ type Store struct {
 
 	// count is incremented/decremented atomically during Put
 	count           int64
+	expired         int64
 	oldestTimestamp int64
 
-	maxPerSource      int
-	maxTimestampFudge int64
+	maxPerSource              int
+	maxTimestampFudge         int64
+	rejectTimestampCollisions bool
+	lockTimeout               time.Duration
+	maxFutureSkew             time.Duration
+	severityTag               string
+	dedup                     *deduplicator
+
+	// paused maps the source IDs whose envelopes are dropped to the time,
+	// in nanoseconds, at which they are stored again.
+	paused sync.Map
 
 	metrics Metrics
 	mc      MemoryConsultant
@@ -55,6 +75,35 @@ type Store struct {
 	prunesPerGC int64
 
 	consecutiveTruncation int64
+
+	truncationBehindThreshold int64
+	truncationFallingBehind   bool
+	minRetention              time.Duration
+	targetCachePeriod         time.Duration
+
+	egressAllowlist []string
+	profiledSources map[string]bool
+	sourceEgress    map[string]metrics.Counter
+	otherEgress     metrics.Counter
+
+	spillDir      string
+	spillMaxBytes int64
+	spill         *spillover
+	spilled       metrics.Counter
+	spillSize     metrics.Gauge
+
+	topIngress *TopIngress
+
+	maxSourceIDs int
+	sourceIDs    sourceIDs
+	lruMu        sync.Mutex
+
+	backpressureThreshold float64
+	underPressure         atomic.Bool
+
+	heapBuildParallelism int
+
+	log *slog.Logger
 }
 
 type Metrics struct {
@@ -63,15 +112,222 @@ type Metrics struct {
 	ingress            metrics.Counter
 	egress             metrics.Counter
 	storeSize          metrics.Gauge
+	rejected           metrics.Counter
+	lockDropped        metrics.Counter
+	futureRejected     metrics.Counter
+	duplicatesDropped  metrics.Counter
+	pausedDropped      metrics.Counter
+	sourceIDCount      metrics.Gauge
+	sourceIDsEvicted   metrics.Counter
+	sourceCreated      metrics.Counter
+	sourceDestroyed    metrics.Counter
 	truncationDuration metrics.Gauge
+	truncationBehind   metrics.Gauge
 	memoryUtilization  metrics.Gauge
+	newestEnvelopeAge  metrics.Gauge
 }
 
-func NewStore(maxPerSource int, truncationInterval time.Duration, prunesPerGC int64, mc MemoryConsultant, m MetricsRegistry) *Store {
+// StoreOption configures a Store.
+type StoreOption func(*Store)
+
+// WithLogger returns a StoreOption that configures the logger used by the
+// Store. It defaults to no logging.
+func WithLogger(l *slog.Logger) StoreOption {
+	return func(s *Store) {
+		s.log = l
+	}
+}
+
+// WithTruncationBehindThreshold returns a StoreOption that sets the number
+// of envelopes above which the store is still considered under pressure
+// after a truncation cycle has pruned. When this happens the
+// log_cache_truncation_behind gauge is set and a warning is logged. It
+// defaults to 0, which disables the check.
+func WithTruncationBehindThreshold(threshold int64) StoreOption {
+	return func(s *Store) {
+		s.truncationBehindThreshold = threshold
+	}
+}
+
+// WithMinRetention returns a StoreOption that prevents truncation from
+// evicting envelopes newer than the given duration, even when memory
+// pressure asks for more to be pruned. The store will temporarily exceed its
+// memory target instead. It defaults to 0, which disables the guarantee.
+func WithMinRetention(d time.Duration) StoreOption {
+	return func(s *Store) {
+		s.minRetention = d
+	}
+}
+
+// WithTargetCachePeriod returns a StoreOption that steers truncation toward
+// keeping roughly d worth of envelopes while under memory pressure. If the
+// cache period is longer than d, every envelope older than d is pruned, even
+// beyond what the MemoryConsultant asked for. If it is shorter, fewer
+// envelopes are pruned, in proportion to how far it is below d but never
+// less than half of what the MemoryConsultant asked for. It defaults to 0,
+// which disables the target.
+func WithTargetCachePeriod(d time.Duration) StoreOption {
+	return func(s *Store) {
+		s.targetCachePeriod = d
+	}
+}
+
+// WithPerSourceEgressMetrics returns a StoreOption that emits a
+// log_cache_source_egress counter labeled by source ID for each source ID in
+// the allowlist. Reads for any other source ID are counted under the "other"
+// label, keeping the metric's cardinality bounded. It defaults to no
+// per-source metrics.
+func WithPerSourceEgressMetrics(allowlist []string) StoreOption {
+	return func(s *Store) {
+		s.egressAllowlist = allowlist
+	}
+}
+
+// WithProfilerLabels returns a StoreOption that runs Put and Get for each
+// of the given source IDs with a source_id pprof label, so that CPU
+// profiles attribute time spent in the store to them. Other source IDs are
+// not labeled, keeping the number of profile labels bounded. It is meant
+// for debugging and defaults to no labels.
+func WithProfilerLabels(sourceIDs []string) StoreOption {
+	return func(s *Store) {
+		s.profiledSources = make(map[string]bool, len(sourceIDs))
+		for _, sourceID := range sourceIDs {
+			s.profiledSources[sourceID] = true
+		}
+	}
+}
+
+// WithTimestampFudge returns a StoreOption that sets how far, in
+// nanoseconds, the timestamp of an envelope may be moved forward to avoid
+// colliding with an envelope already stored for the same source. When no
+// free timestamp is found, the stored envelope is replaced. A value of 0
+// disables fudging so that timestamps are returned exactly as written. It
+// defaults to 4000.
+func WithTimestampFudge(max int64) StoreOption {
+	return func(s *Store) {
+		s.maxTimestampFudge = max
+	}
+}
+
+// WithRejectTimestampCollisions returns a StoreOption that drops an
+// envelope, instead of replacing the stored one, when no free timestamp is
+// found for it. Dropped envelopes are counted by
+// log_cache_timestamp_collisions_rejected.
+func WithRejectTimestampCollisions() StoreOption {
+	return func(s *Store) {
+		s.rejectTimestampCollisions = true
+	}
+}
+
+// WithLockTimeout returns a StoreOption that bounds how long Put waits for
+// the lock of a source ID. If the lock can not be taken in time, e.g.
+// because a chatty source is being read or written heavily, the envelope
+// is dropped and counted by log_cache_lock_contention_dropped instead of
+// blocking ingress. It defaults to 0, which waits indefinitely.
+func WithLockTimeout(d time.Duration) StoreOption {
+	return func(s *Store) {
+		s.lockTimeout = d
+	}
+}
+
+// WithMaxFutureSkew returns a StoreOption that drops an envelope in Put
+// when its timestamp is more than d ahead of now, so that a misconfigured
+// emitter can not push the newest timestamp of its source into the future.
+// Dropped envelopes are counted by log_cache_future_timestamp_rejected. It
+// defaults to 0, which accepts any timestamp.
+func WithMaxFutureSkew(d time.Duration) StoreOption {
+	return func(s *Store) {
+		s.maxFutureSkew = d
+	}
+}
+
+// WithDeduplication returns a StoreOption that drops an envelope in Put
+// when an identical envelope was written for the same source ID within the
+// window. At most maxEntries envelopes are remembered, so a duplicate that
+// arrives after that many other envelopes may still be stored. Dropped
+// envelopes are counted by log_cache_duplicates_dropped. It defaults to no
+// deduplication.
+func WithDeduplication(window time.Duration, maxEntries int) StoreOption {
+	return func(s *Store) {
+		if window > 0 && maxEntries > 0 {
+			s.dedup = newDeduplicator(window, maxEntries)
+		}
+	}
+}
+
+// WithEventSeverityTag returns a StoreOption that sets the tag holding the
+// severity of event envelopes. Reads with a minimum severity only return
+// events whose tag has at least that severity. It defaults to "severity".
+func WithEventSeverityTag(tag string) StoreOption {
+	return func(s *Store) {
+		s.severityTag = tag
+	}
+}
+
+// WithSpillover returns a StoreOption that writes envelopes pruned by
+// truncation to a ring buffer in dir instead of dropping them. The ring
+// buffer uses at most maxBytes of disk; once it is full the oldest spilled
+// envelopes are dropped. Spilled envelopes are only returned by Get when it
+// is asked to include them. Any files in dir left behind by a previous
+// process are removed. It defaults to no spillover.
+func WithSpillover(dir string, maxBytes int64) StoreOption {
+	return func(s *Store) {
+		s.spillDir = dir
+		s.spillMaxBytes = maxBytes
+	}
+}
+
+// WithTopIngress returns a StoreOption that counts every Put in t, so that
+// the source IDs with the most ingress can be reported. It defaults to not
+// counting.
+func WithTopIngress(t *TopIngress) StoreOption {
+	return func(s *Store) {
+		s.topIngress = t
+	}
+}
+
+// WithMaxSourceIDs returns a StoreOption that limits the number of distinct
+// source IDs in the store. When a new source ID would exceed n, the source
+// ID that was least recently written is evicted with all of its envelopes
+// and counted by log_cache_source_ids_evicted. This bounds the memory a
+// writer can take by spraying source IDs. It defaults to 0, which does not
+// limit the number of source IDs.
+func WithMaxSourceIDs(n int) StoreOption {
+	return func(s *Store) {
+		s.maxSourceIDs = n
+	}
+}
+
+// WithBackpressureThreshold returns a StoreOption that reports the store
+// as under pressure, see UnderPressure, while the last truncation cycle
+// pruned at least the given fraction (0 to 1) of the stored envelopes.
+// Envelopes written then are likely to be evicted soon after. It defaults
+// to 0, which never reports pressure.
+func WithBackpressureThreshold(fraction float64) StoreOption {
+	return func(s *Store) {
+		s.backpressureThreshold = fraction
+	}
+}
+
+// WithHeapBuildParallelism returns a StoreOption that reads the oldest
+// timestamp of every source ID with n goroutines when truncation builds its
+// expiration heap. On nodes with many source IDs this shortens each
+// truncation cycle. It defaults to 1, which reads them on the truncation
+// goroutine.
+func WithHeapBuildParallelism(n int) StoreOption {
+	return func(s *Store) {
+		s.heapBuildParallelism = n
+	}
+}
+
+func NewStore(maxPerSource int, truncationInterval time.Duration, prunesPerGC int64, mc MemoryConsultant, m MetricsRegistry, opts ...StoreOption) *Store {
 	store := &Store{
 		maxPerSource:      maxPerSource,
 		maxTimestampFudge: 4000,
 		oldestTimestamp:   MIN_INT64,
+		severityTag:       "severity",
+
+		heapBuildParallelism: 1,
 
 		metrics: registerMetrics(m),
 
@@ -80,6 +336,30 @@ func NewStore(maxPerSource int, truncationInterval time.Duration, prunesPerGC in
 
 		truncationInterval: truncationInterval,
 		prunesPerGC:        prunesPerGC,
+
+		log: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	for _, o := range opts {
+		o(store)
+	}
+
+	if len(store.egressAllowlist) > 0 {
+		store.registerSourceEgressMetrics(m)
+	}
+
+	if store.maxSourceIDs > 0 {
+		store.sourceIDs.lru = list.New()
+	}
+
+	if store.spillDir != "" {
+		spill, err := newSpillover(store.spillDir, store.spillMaxBytes)
+		if err != nil {
+			store.log.Error("failed to create spillover, pruned envelopes will be dropped", "dir", store.spillDir, "error", err)
+		} else {
+			store.spill = spill
+			store.registerSpilloverMetrics(m)
+		}
 	}
 
 	store.mc.SetMemoryReporter(store.metrics.memoryUtilization)
@@ -113,6 +393,42 @@ func registerMetrics(m MetricsRegistry) Metrics {
 			"Current number of envelopes in the store.",
 			metrics.WithMetricLabels(map[string]string{"unit": "entries"}),
 		),
+		rejected: m.NewCounter(
+			"log_cache_timestamp_collisions_rejected",
+			"Total envelopes dropped because their timestamp collided with a stored envelope.",
+		),
+		lockDropped: m.NewCounter(
+			"log_cache_lock_contention_dropped",
+			"Total envelopes dropped because the lock for their source ID could not be taken within the lock timeout.",
+		),
+		futureRejected: m.NewCounter(
+			"log_cache_future_timestamp_rejected",
+			"Total envelopes dropped because their timestamp was further in the future than the max future skew.",
+		),
+		duplicatesDropped: m.NewCounter(
+			"log_cache_duplicates_dropped",
+			"Total envelopes dropped because an identical envelope was written for the same source ID within the deduplication window.",
+		),
+		pausedDropped: m.NewCounter(
+			"log_cache_paused_dropped",
+			"Total envelopes dropped because their source ID was paused.",
+		),
+		sourceIDCount: m.NewGauge(
+			"log_cache_source_id_count",
+			"Current number of distinct source IDs in the store.",
+		),
+		sourceIDsEvicted: m.NewCounter(
+			"log_cache_source_ids_evicted",
+			"Total source IDs evicted with all of their envelopes to stay within the maximum number of source IDs.",
+		),
+		sourceCreated: m.NewCounter(
+			"log_cache_source_created",
+			"Total source IDs added to the store by their first envelope.",
+		),
+		sourceDestroyed: m.NewCounter(
+			"log_cache_source_destroyed",
+			"Total source IDs removed from the store because all of their envelopes were pruned.",
+		),
 
 		//TODO convert to histogram
 		truncationDuration: m.NewGauge(
@@ -120,19 +436,84 @@ func registerMetrics(m MetricsRegistry) Metrics {
 			"Duration of last truncation in milliseconds.",
 			metrics.WithMetricLabels(map[string]string{"unit": "milliseconds"}),
 		),
+		truncationBehind: m.NewGauge(
+			"log_cache_truncation_behind",
+			"Set to 1 when the store size is still above the pressure threshold after a truncation cycle.",
+		),
 		memoryUtilization: m.NewGauge(
 			"log_cache_memory_utilization",
 			"Percentage of system memory in use by log cache. Calculated as heap memory in use divided by system memory.",
 			metrics.WithMetricLabels(map[string]string{"unit": "percentage"}),
 		),
+		newestEnvelopeAge: m.NewGauge(
+			"log_cache_newest_envelope_age",
+			"Age of the newest envelope in the store in milliseconds. A climbing value indicates ingress has stopped.",
+			metrics.WithMetricLabels(map[string]string{"unit": "milliseconds"}),
+		),
+	}
+}
+
+func (store *Store) registerSourceEgressMetrics(m MetricsRegistry) {
+	newCounter := func(sourceID string) metrics.Counter {
+		return m.NewCounter(
+			"log_cache_source_egress",
+			"Total envelopes retrieved from the store for an allowlisted source ID.",
+			metrics.WithMetricLabels(map[string]string{"source_id": sourceID}),
+		)
+	}
+
+	store.sourceEgress = make(map[string]metrics.Counter, len(store.egressAllowlist))
+	for _, sourceID := range store.egressAllowlist {
+		store.sourceEgress[sourceID] = newCounter(sourceID)
+	}
+	store.otherEgress = newCounter("other")
+}
+
+func (store *Store) recordSourceEgress(sourceID string, n int) {
+	if store.sourceEgress == nil {
+		return
+	}
+
+	if c, ok := store.sourceEgress[sourceID]; ok {
+		c.Add(float64(n))
+		return
+	}
+	store.otherEgress.Add(float64(n))
+}
+
+func (store *Store) registerSpilloverMetrics(m MetricsRegistry) {
+	store.spilled = m.NewCounter(
+		"log_cache_spilled",
+		"Total envelopes written to the spillover instead of being dropped by truncation.",
+	)
+	store.spillSize = m.NewGauge(
+		"log_cache_spillover_size",
+		"Current size of the spillover on disk.",
+		metrics.WithMetricLabels(map[string]string{"unit": "bytes"}),
+	)
+}
+
+// spillEnvelopes writes envelopes pruned by truncation to the spillover.
+func (store *Store) spillEnvelopes(envelopes []*loggregator_v2.Envelope) {
+	if len(envelopes) == 0 {
+		return
+	}
+
+	n, err := store.spill.write(envelopes)
+	store.spilled.Add(float64(n))
+	store.spillSize.Set(float64(store.spill.size()))
+	if err != nil {
+		store.log.Error("failed to write to spillover", "error", err)
 	}
 }
 
 func (store *Store) getOrInitializeStorage(sourceId string) (*storage, bool) {
-	var newStorage bool
+	var (
+		newStorage bool
+		evicted    *storage
+	)
 
 	store.initializationMutex.Lock()
-	defer store.initializationMutex.Unlock()
 
 	envelopeStorage, existingSourceId := store.storageIndex.Load(sourceId)
 
@@ -142,37 +523,101 @@ func (store *Store) getOrInitializeStorage(sourceId string) (*storage, bool) {
 			Tree:     avltree.NewWith(utils.Int64Comparator),
 		}
 		store.storageIndex.Store(sourceId, envelopeStorage.(*storage))
+		evicted = store.addSource(envelopeStorage.(*storage))
 		newStorage = true
+		store.metrics.sourceCreated.Add(1)
+		store.log.Debug("storing new source ID", "source_id", sourceId)
+	}
+
+	store.initializationMutex.Unlock()
+
+	if evicted != nil {
+		store.evictSource(evicted)
 	}
 
 	return envelopeStorage.(*storage), newStorage
 }
 
-func (storage *storage) insertOrSwap(store *Store, e *loggregator_v2.Envelope) {
-	storage.Lock()
-	defer storage.Unlock()
+// timestampKey returns the key an envelope with the given timestamp is
+// stored under. Taken timestamps are moved forward by up to maxFudge
+// nanoseconds. If every candidate is taken, the last one is returned and
+// collided is true. It must be called with the storage locked.
+func (storage *storage) timestampKey(timestamp, maxFudge int64) (key int64, collided bool) {
+	var timestampFudge int64
+	for timestampFudge = 0; timestampFudge < maxFudge; timestampFudge++ {
+		if _, exists := storage.Get(timestamp + timestampFudge); !exists {
+			return timestamp + timestampFudge, false
+		}
+	}
+
+	_, exists := storage.Get(timestamp + timestampFudge)
+	return timestamp + timestampFudge, exists
+}
+
+// lockWithin tries to take the write lock for up to d and reports whether
+// it succeeded.
+func (storage *storage) lockWithin(d time.Duration) bool {
+	if storage.TryLock() {
+		return true
+	}
+
+	deadline := time.Now().Add(d)
+	backoff := 10 * time.Microsecond
+	for time.Now().Before(deadline) {
+		time.Sleep(backoff)
+		if storage.TryLock() {
+			return true
+		}
+		if backoff < time.Millisecond {
+			backoff *= 2
+		}
+	}
+
+	return false
+}
 
-	// If we're at our maximum capacity, remove an envelope before inserting
-	if storage.Size() >= store.maxPerSource {
-		oldestTimestamp := storage.Left().Key.(int64)
-		storage.Remove(oldestTimestamp)
-		storage.meta.Expired++
-		store.metrics.expired.Add(1)
+// insertOrSwap stores the envelope in the storage. It returns false
+// without storing the envelope if the storage was removed from the store in
+// the meantime, in which case the caller has to look up the storage of the
+// source ID again.
+func (storage *storage) insertOrSwap(store *Store, e *loggregator_v2.Envelope) bool {
+	if store.lockTimeout > 0 {
+		if !storage.lockWithin(store.lockTimeout) {
+			store.metrics.lockDropped.Add(1)
+			store.log.Debug("dropped envelope, source lock is contended", "source_id", storage.sourceId)
+			return true
+		}
 	} else {
-		atomic.AddInt64(&store.count, 1)
-		store.metrics.storeSize.Set(float64(atomic.LoadInt64(&store.count)))
+		storage.Lock()
 	}
+	defer storage.Unlock()
 
-	var timestampFudge int64
-	for timestampFudge = 0; timestampFudge < store.maxTimestampFudge; timestampFudge++ {
-		_, exists := storage.Get(e.Timestamp + timestampFudge)
+	if storage.removed {
+		return false
+	}
 
-		if !exists {
-			break
+	key, collided := storage.timestampKey(e.Timestamp, store.maxTimestampFudge)
+	if collided && store.rejectTimestampCollisions {
+		store.metrics.rejected.Add(1)
+		store.log.Debug("rejected envelope with colliding timestamp", "source_id", storage.sourceId, "timestamp", e.Timestamp)
+		return true
+	}
+
+	if !collided {
+		// If we're at our maximum capacity, remove an envelope before inserting
+		if storage.Size() >= store.maxPerSource {
+			oldestTimestamp := storage.Left().Key.(int64)
+			storage.Remove(oldestTimestamp)
+			storage.meta.Expired++
+			atomic.AddInt64(&store.expired, 1)
+			store.metrics.expired.Add(1)
+		} else {
+			atomic.AddInt64(&store.count, 1)
+			store.metrics.storeSize.Set(float64(atomic.LoadInt64(&store.count)))
 		}
 	}
 
-	storage.Put(e.Timestamp+timestampFudge, e)
+	storage.Put(key, e)
 
 	if e.Timestamp > storage.meta.NewestTimestamp {
 		storage.meta.NewestTimestamp = e.Timestamp
@@ -189,6 +634,21 @@ func (storage *storage) insertOrSwap(store *Store, e *loggregator_v2.Envelope) {
 
 	cachePeriod := calculateCachePeriod(storeOldestTimestamp)
 	store.metrics.cachePeriod.Set(float64(cachePeriod))
+
+	return true
+}
+
+// discard marks the storage as removed from the store and clears it. It
+// returns how many envelopes were cleared.
+func (storage *storage) discard() int {
+	storage.Lock()
+	defer storage.Unlock()
+
+	storage.removed = true
+	n := storage.Size()
+	storage.Clear()
+
+	return n
 }
 
 func (store *Store) WaitForTruncationToComplete() bool {
@@ -216,30 +676,117 @@ func (store *Store) truncationLoop(runInterval time.Duration) {
 		store.truncate()
 		t.Reset(runInterval)
 		store.metrics.truncationDuration.Set(float64(time.Since(startTime) / time.Millisecond))
+		store.reportNewestEnvelopeAge()
+	}
+}
+
+// reportNewestEnvelopeAge sets the newest envelope age gauge from the newest
+// timestamp across all sources. It is left untouched while the store is
+// empty.
+func (store *Store) reportNewestEnvelopeAge() {
+	newest := int64(math.MinInt64)
+	store.storageIndex.Range(func(_ interface{}, s interface{}) bool {
+		s.(*storage).RLock()
+		if ts := s.(*storage).meta.NewestTimestamp; ts > newest {
+			newest = ts
+		}
+		s.(*storage).RUnlock()
+
+		return true
+	})
+
+	if newest == math.MinInt64 {
+		return
 	}
+
+	store.metrics.newestEnvelopeAge.Set(float64(calculateCachePeriod(newest)))
 }
 
 func (store *Store) Put(envelope *loggregator_v2.Envelope, sourceId string) {
 	store.metrics.ingress.Add(1)
+	if store.topIngress != nil {
+		store.topIngress.Add(sourceId)
+	}
 
-	envelopeStorage, _ := store.getOrInitializeStorage(sourceId)
-	envelopeStorage.insertOrSwap(store, envelope)
+	if store.maxFutureSkew > 0 && envelope.GetTimestamp() > time.Now().Add(store.maxFutureSkew).UnixNano() {
+		store.metrics.futureRejected.Add(1)
+		return
+	}
+
+	if store.isPaused(sourceId) {
+		store.metrics.pausedDropped.Add(1)
+		return
+	}
+
+	if store.dedup != nil && store.dedup.duplicate(envelope, sourceId, time.Now()) {
+		store.metrics.duplicatesDropped.Add(1)
+		return
+	}
+
+	store.withProfilerLabels(sourceId, func() {
+		for {
+			envelopeStorage, _ := store.getOrInitializeStorage(sourceId)
+			if envelopeStorage.insertOrSwap(store, envelope) {
+				store.touchSource(envelopeStorage)
+				return
+			}
+		}
+	})
 }
 
-func (store *Store) BuildExpirationHeap() *ExpirationHeap {
-	expirationHeap := &ExpirationHeap{}
-	heap.Init(expirationHeap)
+// withProfilerLabels runs f with a source_id pprof label if the source ID
+// is one of the profiled sources.
+func (store *Store) withProfilerLabels(sourceID string, f func()) {
+	if !store.profiledSources[sourceID] {
+		f()
+		return
+	}
 
-	store.storageIndex.Range(func(sourceId interface{}, tree interface{}) bool {
-		tree.(*storage).RLock()
-		oldestTimestamp := tree.(*storage).Left().Key.(int64)
-		heap.Push(expirationHeap, storageExpiration{timestamp: oldestTimestamp, sourceId: sourceId.(string), tree: tree.(*storage)})
-		tree.(*storage).RUnlock()
+	pprof.Do(context.Background(), pprof.Labels("source_id", sourceID), func(context.Context) {
+		f()
+	})
+}
+
+// BuildExpirationHeap returns a heap of the oldest timestamp of every
+// source ID. The timestamps are read by heapBuildParallelism goroutines,
+// each taking the read locks of its share of the source IDs, and the heap
+// is then built from them at once.
+func (store *Store) BuildExpirationHeap() *ExpirationHeap {
+	var trees []*storage
+	store.storageIndex.Range(func(_ interface{}, tree interface{}) bool {
+		trees = append(trees, tree.(*storage))
 
 		return true
 	})
 
-	return expirationHeap
+	expirationHeap := make(ExpirationHeap, len(trees))
+	readOldest := func(from, to int) {
+		for i := from; i < to; i++ {
+			trees[i].RLock()
+			expirationHeap[i] = storageExpiration{timestamp: trees[i].Left().Key.(int64), sourceId: trees[i].sourceId, tree: trees[i]}
+			trees[i].RUnlock()
+		}
+	}
+
+	workers := min(store.heapBuildParallelism, len(trees))
+	if workers <= 1 {
+		readOldest(0, len(trees))
+	} else {
+		var wg sync.WaitGroup
+		share := (len(trees) + workers - 1) / workers
+		for from := 0; from < len(trees); from += share {
+			wg.Add(1)
+			go func(from, to int) {
+				defer wg.Done()
+				readOldest(from, to)
+			}(from, min(from+share, len(trees)))
+		}
+		wg.Wait()
+	}
+
+	heap.Init(&expirationHeap)
+
+	return &expirationHeap
 }
 
 // truncate removes the n oldest envelopes across all trees
@@ -249,6 +796,8 @@ func (store *Store) truncate() {
 	numberToPrune := store.mc.GetQuantityToPrune(storeCount)
 
 	if numberToPrune == 0 {
+		store.underPressure.Store(false)
+		store.reportTruncationBehind(0)
 		store.sendTruncationCompleted(false)
 		atomic.CompareAndSwapInt64(&store.consecutiveTruncation, store.consecutiveTruncation, 0)
 		return
@@ -260,19 +809,54 @@ func (store *Store) truncate() {
 	}
 
 	expirationHeap := store.BuildExpirationHeap()
+	now := time.Now()
+	retentionCutoff := now.Add(-store.minRetention).UnixNano()
+	targetCutoff := now.Add(-store.targetCachePeriod).UnixNano()
+	numberToPrune = store.adjustForTargetCachePeriod(expirationHeap, numberToPrune, now)
 
 	// Remove envelopes one at a time, popping state from the expirationHeap
-	for i := 0; i < numberToPrune; i++ {
+	var (
+		pruned  int
+		spilled []*loggregator_v2.Envelope
+	)
+	for ; pruned < numberToPrune || store.beyondTargetCachePeriod(expirationHeap, targetCutoff); pruned++ {
+		if store.withinMinRetention(expirationHeap, retentionCutoff) {
+			if pruned < numberToPrune {
+				store.log.Warn(
+					"minimum retention prevented pruning",
+					"min_retention", store.minRetention,
+					"envelopes", numberToPrune-pruned,
+				)
+			}
+			break
+		}
+
 		oldest := heap.Pop(expirationHeap)
-		newOldestTimestamp, valid := store.removeOldestEnvelope(oldest.(storageExpiration).tree, oldest.(storageExpiration).sourceId)
+		removed, newOldestTimestamp, valid := store.removeOldestEnvelope(oldest.(storageExpiration).tree, oldest.(storageExpiration).sourceId)
+		if removed != nil && store.spill != nil {
+			spilled = append(spilled, removed)
+		}
 		if valid {
 			heap.Push(expirationHeap, storageExpiration{timestamp: newOldestTimestamp, sourceId: oldest.(storageExpiration).sourceId, tree: oldest.(storageExpiration).tree})
 		}
 	}
 
+	// Spill outside of the storage locks so that disk writes do not block
+	// ingress.
+	if store.spill != nil {
+		store.spillEnvelopes(spilled)
+	}
+
+	store.underPressure.Store(
+		store.backpressureThreshold > 0 && float64(pruned) >= store.backpressureThreshold*float64(storeCount),
+	)
+
 	// Always update our store size metric and close out the channel when we return
 	defer func() {
-		store.metrics.storeSize.Set(float64(atomic.LoadInt64(&store.count)))
+		remaining := atomic.LoadInt64(&store.count)
+		store.log.Debug("truncated store", "pruned", pruned, "remaining", remaining)
+		store.metrics.storeSize.Set(float64(remaining))
+		store.reportTruncationBehind(remaining)
 		store.sendTruncationCompleted(true)
 	}()
 
@@ -299,24 +883,140 @@ func (store *Store) truncate() {
 	}
 }
 
-func (store *Store) removeOldestEnvelope(treeToPrune *storage, sourceId string) (int64, bool) {
+// UnderPressure reports whether the last truncation cycle pruned enough of
+// the store to exceed the backpressure threshold. Writers should slow down
+// while it is true.
+func (store *Store) UnderPressure() bool {
+	return store.underPressure.Load()
+}
+
+// Stats is a snapshot of the store's own metrics.
+type Stats struct {
+	// Expired is the total number of envelopes removed to make room for
+	// newer ones.
+	Expired int64
+
+	// Size is the number of envelopes in the store.
+	Size int64
+
+	// CachePeriod is the age of the oldest envelope in the store. It is 0
+	// while the store is empty.
+	CachePeriod time.Duration
+}
+
+// Stats returns the store's own metrics, the same values that are reported
+// as log_cache_expired, log_cache_store_size and log_cache_cache_period.
+func (store *Store) Stats() Stats {
+	stats := Stats{
+		Expired: atomic.LoadInt64(&store.expired),
+		Size:    atomic.LoadInt64(&store.count),
+	}
+	if oldest := atomic.LoadInt64(&store.oldestTimestamp); oldest != MIN_INT64 {
+		stats.CachePeriod = time.Since(time.Unix(0, oldest))
+	}
+
+	return stats
+}
+
+// withinMinRetention reports whether the oldest envelope left on the heap is
+// protected by the minimum retention window.
+func (store *Store) withinMinRetention(h *ExpirationHeap, cutoff int64) bool {
+	if store.minRetention <= 0 || h.Len() == 0 {
+		return false
+	}
+
+	return (*h)[0].timestamp >= cutoff
+}
+
+// adjustForTargetCachePeriod scales down the number of envelopes to prune
+// while the cache period is shorter than the target cache period.
+func (store *Store) adjustForTargetCachePeriod(h *ExpirationHeap, numberToPrune int, now time.Time) int {
+	if store.targetCachePeriod <= 0 || h.Len() == 0 {
+		return numberToPrune
+	}
+
+	cachePeriod := now.Sub(time.Unix(0, (*h)[0].timestamp))
+	if cachePeriod >= store.targetCachePeriod {
+		return numberToPrune
+	}
+
+	adjusted := int(float64(numberToPrune) * float64(cachePeriod) / float64(store.targetCachePeriod))
+	if floor := numberToPrune / 2; adjusted < floor {
+		adjusted = floor
+	}
+
+	return adjusted
+}
+
+// beyondTargetCachePeriod reports whether the oldest envelope left on the
+// heap is older than the target cache period.
+func (store *Store) beyondTargetCachePeriod(h *ExpirationHeap, cutoff int64) bool {
+	if store.targetCachePeriod <= 0 || h.Len() == 0 {
+		return false
+	}
+
+	return (*h)[0].timestamp < cutoff
+}
+
+// reportTruncationBehind flags a truncation cycle that could not bring the
+// store back under the configured pressure threshold. The gauge is set on
+// every cycle, but only the transitions are logged so that a store under
+// sustained pressure does not log on every cycle. It is only called from the
+// truncation loop.
+func (store *Store) reportTruncationBehind(remaining int64) {
+	behind := store.truncationBehindThreshold > 0 && remaining > store.truncationBehindThreshold
+	if behind {
+		store.metrics.truncationBehind.Set(1)
+	} else {
+		store.metrics.truncationBehind.Set(0)
+	}
+
+	if behind == store.truncationFallingBehind {
+		return
+	}
+	store.truncationFallingBehind = behind
+
+	if behind {
+		store.log.Warn(
+			"truncation is falling behind",
+			"remaining", remaining,
+			"threshold", store.truncationBehindThreshold,
+		)
+		return
+	}
+	store.log.Info(
+		"truncation caught up",
+		"remaining", remaining,
+		"threshold", store.truncationBehindThreshold,
+	)
+}
+
+// removeOldestEnvelope removes the oldest envelope of the tree and returns
+// it along with the timestamp of the new oldest envelope. The returned bool
+// is false once the tree is empty.
+func (store *Store) removeOldestEnvelope(treeToPrune *storage, sourceId string) (*loggregator_v2.Envelope, int64, bool) {
 	treeToPrune.Lock()
 	defer treeToPrune.Unlock()
 
 	if treeToPrune.Size() == 0 {
-		return 0, false
+		return nil, 0, false
 	}
 
 	atomic.AddInt64(&store.count, -1)
+	atomic.AddInt64(&store.expired, 1)
 	store.metrics.expired.Add(1)
 
 	oldestEnvelope := treeToPrune.Left()
+	removed := oldestEnvelope.Value.(*loggregator_v2.Envelope)
 
 	treeToPrune.Remove(oldestEnvelope.Key.(int64))
 
 	if treeToPrune.Size() == 0 {
-		store.storageIndex.Delete(sourceId)
-		return 0, false
+		if store.removeSource(treeToPrune) {
+			treeToPrune.removed = true
+			store.metrics.sourceDestroyed.Add(1)
+		}
+		return removed, 0, false
 	}
 
 	newOldestEnvelope := treeToPrune.Left()
@@ -325,38 +1025,257 @@ func (store *Store) removeOldestEnvelope(treeToPrune *storage, sourceId string)
 	treeToPrune.meta.Expired++
 	treeToPrune.meta.OldestTimestamp = oldestTimestampAfterRemoval
 
-	return oldestTimestampAfterRemoval, true
+	return removed, oldestTimestampAfterRemoval, true
 }
 
-// Get fetches envelopes from the store based on the source ID, start and end
-// time. Start is inclusive while end is not: [start..end).
-func (store *Store) Get(
-	index string,
-	start time.Time,
-	end time.Time,
-	envelopeTypes []logcache_v1.EnvelopeType,
-	nameFilter *regexp.Regexp,
-	limit int,
-	descending bool,
-) []*loggregator_v2.Envelope {
-	tree, ok := store.storageIndex.Load(index)
+// Purge removes every envelope stored for the source ID and returns how many
+// were removed. Spilled envelopes of the source ID are no longer returned
+// but are not counted.
+func (store *Store) Purge(sourceId string) int {
+	if store.spill != nil {
+		store.spill.purge(sourceId)
+	}
+
+	store.initializationMutex.Lock()
+	tree, ok := store.storageIndex.Load(sourceId)
+	if ok {
+		ok = store.removeSource(tree.(*storage))
+	}
+	store.initializationMutex.Unlock()
 	if !ok {
-		return nil
+		return 0
 	}
 
-	tree.(*storage).RLock()
-	defer tree.(*storage).RUnlock()
+	n := tree.(*storage).discard()
+	remaining := atomic.AddInt64(&store.count, -int64(n))
+	store.metrics.storeSize.Set(float64(remaining))
+
+	return n
+}
 
-	traverser := store.treeAscTraverse
-	if descending {
-		traverser = store.treeDescTraverse
+// Pause drops every envelope written for the source ID for the duration d
+// and returns the time at which envelopes are stored again. Envelopes
+// already stored are kept. Pausing a paused source ID replaces its resume
+// time, so a d of 0 resumes it right away. Pauses do not survive restarts.
+func (store *Store) Pause(sourceId string, d time.Duration) time.Time {
+	resume := time.Now().Add(d)
+	if d <= 0 {
+		store.paused.Delete(sourceId)
+		return resume
 	}
 
-	var res []*loggregator_v2.Envelope
-	traverser(tree.(*storage).Root, start.UnixNano(), end.UnixNano(), func(e *loggregator_v2.Envelope) bool {
-		e = store.filterByName(e, nameFilter)
+	store.paused.Store(sourceId, resume.UnixNano())
+	store.log.Info("paused source", "source_id", sourceId, "until", resume)
+
+	return resume
+}
+
+// isPaused reports whether envelopes for the source ID are dropped,
+// forgetting the pause once it is over.
+func (store *Store) isPaused(sourceId string) bool {
+	resume, ok := store.paused.Load(sourceId)
+	if !ok {
+		return false
+	}
+
+	if time.Now().UnixNano() < resume.(int64) {
+		return true
+	}
+
+	store.paused.CompareAndDelete(sourceId, resume)
+	return false
+}
+
+// Query selects the envelopes of a source ID that Get returns.
+type Query struct {
+	// Start and End bound the timestamps of the envelopes. Start is
+	// inclusive while End is not: [Start..End).
+	Start time.Time
+	End   time.Time
+
+	// EnvelopeTypes only returns envelopes of the given types. Every type
+	// is returned if it is empty.
+	EnvelopeTypes []logcache_v1.EnvelopeType
+
+	// NameFilter only returns counters and timers with a matching name and
+	// the matching metrics of gauges.
+	NameFilter *regexp.Regexp
+
+	// TagFilters only returns envelopes with a matching value for every
+	// tag.
+	TagFilters map[string]*regexp.Regexp
+
+	// UnitFilter only returns the gauge metrics with that unit.
+	UnitFilter string
+
+	// MinSeverity only returns events with at least that severity level, as
+	// parsed by severity.Parse, if it is positive.
+	MinSeverity int
+
+	// Limit is the most envelopes that are returned.
+	Limit int
+
+	// LimitPerType returns up to Limit envelopes of each of the
+	// EnvelopeTypes instead of up to Limit envelopes in total.
+	LimitPerType bool
+
+	// IncludeSpilled returns the envelopes that truncation wrote to the
+	// spillover as well.
+	IncludeSpilled bool
+
+	// LatestPerSeries only returns the newest envelope of each series. A
+	// series is the envelopes that share a type, metric names, instance ID
+	// and tags. Limit applies to the number of series. It needs Descending.
+	LatestPerSeries bool
+
+	// Descending returns the newest envelopes first.
+	Descending bool
+
+	// Cursor only returns envelopes stored after the cursor, in the order of
+	// the read, if it is set. A cursor is the key an envelope is stored
+	// under, so envelopes that share a timestamp are neither skipped nor
+	// repeated. It is only meaningful for the source ID on this node and
+	// can not be combined with LimitPerType, IncludeSpilled or
+	// LatestPerSeries.
+	Cursor *int64
+}
+
+// Get fetches the envelopes of the source ID selected by q. It also returns
+// the cursor of the last envelope it looked at, which the next page of a
+// read resumes after.
+func (store *Store) Get(index string, q Query) ([]*loggregator_v2.Envelope, int64) {
+	var (
+		res  []*loggregator_v2.Envelope
+		next int64
+	)
+	store.withProfilerLabels(index, func() {
+		res, next = store.get(index, q)
+	})
+
+	return res, next
+}
+
+func (store *Store) get(index string, q Query) ([]*loggregator_v2.Envelope, int64) {
+	includeSpilled := q.IncludeSpilled && store.spill != nil
+
+	tree, ok := store.storageIndex.Load(index)
+	if !ok && !includeSpilled {
+		return nil, 0
+	}
+
+	var seen map[string]struct{}
+	if q.LatestPerSeries {
+		seen = make(map[string]struct{})
+	}
+
+	filter := func(e *loggregator_v2.Envelope) *loggregator_v2.Envelope {
+		if !matchesTags(e, q.TagFilters) {
+			return nil
+		}
+
+		e = store.filterByName(e, q.NameFilter)
 		if e == nil {
-			return false
+			return nil
+		}
+
+		e = filterByUnit(e, q.UnitFilter)
+		if e == nil {
+			return nil
+		}
+
+		if !store.hasSeverity(e, q.MinSeverity) {
+			return nil
+		}
+
+		if seen != nil {
+			// The traversal is newest first, so the first envelope of a
+			// series is its latest.
+			key := seriesKey(e)
+			if _, ok := seen[key]; ok {
+				return nil
+			}
+			seen[key] = struct{}{}
+		}
+
+		return e
+	}
+
+	var (
+		res  []*loggregator_v2.Envelope
+		last int64
+	)
+	if ok {
+		traverser := store.treeAscTraverse
+		bound := int64(math.MinInt64)
+		if q.Descending {
+			traverser = store.treeDescTraverse
+			bound = math.MaxInt64
+		}
+		if q.Cursor != nil {
+			bound = *q.Cursor
+		}
+
+		tree.(*storage).RLock()
+		res = store.collect(q.EnvelopeTypes, q.Limit, q.LimitPerType, filter, func(f func(*loggregator_v2.Envelope) bool) {
+			traverser(tree.(*storage).Root, bound, q.Start.UnixNano(), q.End.UnixNano(), func(key int64, e *loggregator_v2.Envelope) bool {
+				last = key
+				return f(e)
+			})
+		})
+		tree.(*storage).RUnlock()
+	}
+
+	if includeSpilled {
+		var err error
+		spilled := store.collect(q.EnvelopeTypes, q.Limit, q.LimitPerType, filter, func(f func(*loggregator_v2.Envelope) bool) {
+			err = store.spill.traverse(index, q.Start.UnixNano(), q.End.UnixNano(), q.Descending, f)
+		})
+		if err != nil {
+			store.log.Error("failed to read from spillover", "source_id", index, "error", err)
+		}
+
+		// Both results are already limited, so limiting their merge
+		// gives the same result as limiting all the envelopes at once.
+		inMemory := res
+		res = store.collect(q.EnvelopeTypes, q.Limit, q.LimitPerType, nil, func(f func(*loggregator_v2.Envelope) bool) {
+			mergeEnvelopes(inMemory, spilled, q.Descending, f)
+		})
+	}
+
+	store.metrics.egress.Add(float64(len(res)))
+	store.recordSourceEgress(index, len(res))
+	return res, last
+}
+
+// collect keeps the envelopes visited by traverse that pass filter, up to
+// limit in total or, with limitPerType, up to limit of each envelope type.
+// A nil filter keeps every envelope.
+func (store *Store) collect(
+	envelopeTypes []logcache_v1.EnvelopeType,
+	limit int,
+	limitPerType bool,
+	filter func(*loggregator_v2.Envelope) *loggregator_v2.Envelope,
+	traverse func(f func(*loggregator_v2.Envelope) bool),
+) []*loggregator_v2.Envelope {
+	var perType map[logcache_v1.EnvelopeType]int
+	if limitPerType && len(envelopeTypes) > 0 {
+		perType = make(map[logcache_v1.EnvelopeType]int, len(envelopeTypes))
+		for _, t := range envelopeTypes {
+			perType[t] = 0
+		}
+	}
+
+	var res []*loggregator_v2.Envelope
+	traverse(func(e *loggregator_v2.Envelope) bool {
+		if filter != nil {
+			e = filter(e)
+			if e == nil {
+				return false
+			}
+		}
+
+		if perType != nil {
+			return store.appendPerType(&res, e, perType, limit)
 		}
 
 		if store.validEnvelopeType(e, envelopeTypes) {
@@ -367,10 +1286,95 @@ func (store *Store) Get(
 		return len(res) >= limit
 	})
 
-	store.metrics.egress.Add(float64(len(res)))
 	return res
 }
 
+// mergeEnvelopes calls f with the envelopes of a and b, which are both
+// sorted in the given order, in that order until f returns true.
+func mergeEnvelopes(a, b []*loggregator_v2.Envelope, descending bool, f func(*loggregator_v2.Envelope) bool) {
+	for len(a) > 0 || len(b) > 0 {
+		var next *loggregator_v2.Envelope
+		switch {
+		case len(b) == 0:
+			next, a = a[0], a[1:]
+		case len(a) == 0:
+			next, b = b[0], b[1:]
+		case (a[0].GetTimestamp() <= b[0].GetTimestamp()) != descending:
+			next, a = a[0], a[1:]
+		default:
+			next, b = b[0], b[1:]
+		}
+
+		if f(next) {
+			return
+		}
+	}
+}
+
+// seriesKey identifies the series of an envelope by its type, metric
+// names, instance ID and tags.
+func seriesKey(e *loggregator_v2.Envelope) string {
+	var b strings.Builder
+	switch m := e.GetMessage().(type) {
+	case *loggregator_v2.Envelope_Counter:
+		b.WriteString("counter:" + m.Counter.GetName())
+	case *loggregator_v2.Envelope_Gauge:
+		names := make([]string, 0, len(m.Gauge.GetMetrics()))
+		for name := range m.Gauge.GetMetrics() {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		b.WriteString("gauge:" + strings.Join(names, ","))
+	case *loggregator_v2.Envelope_Timer:
+		b.WriteString("timer:" + m.Timer.GetName())
+	case *loggregator_v2.Envelope_Event:
+		b.WriteString("event:")
+	case *loggregator_v2.Envelope_Log:
+		b.WriteString("log:")
+	}
+	b.WriteString("\x00" + e.GetInstanceId())
+
+	tags := make([]string, 0, len(e.GetTags()))
+	for tag := range e.GetTags() {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	for _, tag := range tags {
+		b.WriteString("\x00" + tag + "=" + e.GetTags()[tag])
+	}
+
+	return b.String()
+}
+
+// matchesTags reports whether every tag filter matches the value of the
+// corresponding envelope tag. An envelope without the tag does not match.
+func matchesTags(e *loggregator_v2.Envelope, tagFilters map[string]*regexp.Regexp) bool {
+	for tag, filter := range tagFilters {
+		value, ok := e.GetTags()[tag]
+		if !ok || !filter.MatchString(value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// hasSeverity reports whether e is an event whose severity tag is at least
+// minSeverity. Every envelope has the severity when minSeverity is not
+// positive.
+func (store *Store) hasSeverity(e *loggregator_v2.Envelope, minSeverity int) bool {
+	if minSeverity <= 0 {
+		return true
+	}
+
+	if e.GetEvent() == nil {
+		return false
+	}
+
+	level, err := severity.Parse(e.GetTags()[store.severityTag])
+	return err == nil && level >= minSeverity
+}
+
 func (store *Store) filterByName(envelope *loggregator_v2.Envelope, nameFilter *regexp.Regexp) *loggregator_v2.Envelope {
 	if nameFilter == nil {
 		return envelope
@@ -382,32 +1386,10 @@ func (store *Store) filterByName(envelope *loggregator_v2.Envelope, nameFilter *
 			return envelope
 		}
 
-	// TODO: refactor?
 	case *loggregator_v2.Envelope_Gauge:
-		filteredMetrics := make(map[string]*loggregator_v2.GaugeValue)
-		envelopeMetrics := envelope.GetGauge().GetMetrics()
-		for metricName, gaugeValue := range envelopeMetrics {
-			if !nameFilter.MatchString(metricName) {
-				continue
-			}
-			filteredMetrics[metricName] = gaugeValue
-		}
-
-		if len(filteredMetrics) > 0 {
-			return &loggregator_v2.Envelope{
-				Timestamp:      envelope.Timestamp,
-				SourceId:       envelope.SourceId,
-				InstanceId:     envelope.InstanceId,
-				DeprecatedTags: envelope.DeprecatedTags,
-				Tags:           envelope.Tags,
-				Message: &loggregator_v2.Envelope_Gauge{
-					Gauge: &loggregator_v2.Gauge{
-						Metrics: filteredMetrics,
-					},
-				},
-			}
-
-		}
+		return filterGaugeMetrics(envelope, func(name string, _ *loggregator_v2.GaugeValue) bool {
+			return nameFilter.MatchString(name)
+		})
 
 	case *loggregator_v2.Envelope_Timer:
 		if nameFilter.MatchString(envelope.GetTimer().GetName()) {
@@ -418,6 +1400,51 @@ func (store *Store) filterByName(envelope *loggregator_v2.Envelope, nameFilter *
 	return nil
 }
 
+// filterByUnit removes gauge metrics whose unit is not unitFilter. Only
+// gauges carry units, so every other envelope is dropped.
+func filterByUnit(envelope *loggregator_v2.Envelope, unitFilter string) *loggregator_v2.Envelope {
+	if unitFilter == "" {
+		return envelope
+	}
+
+	if envelope.GetGauge() == nil {
+		return nil
+	}
+
+	return filterGaugeMetrics(envelope, func(_ string, v *loggregator_v2.GaugeValue) bool {
+		return v.GetUnit() == unitFilter
+	})
+}
+
+// filterGaugeMetrics returns a copy of a gauge envelope with only the
+// metrics keep returns true for, or nil if there are none. The stored
+// envelope is not modified.
+func filterGaugeMetrics(envelope *loggregator_v2.Envelope, keep func(string, *loggregator_v2.GaugeValue) bool) *loggregator_v2.Envelope {
+	filteredMetrics := make(map[string]*loggregator_v2.GaugeValue)
+	for metricName, gaugeValue := range envelope.GetGauge().GetMetrics() {
+		if keep(metricName, gaugeValue) {
+			filteredMetrics[metricName] = gaugeValue
+		}
+	}
+
+	if len(filteredMetrics) == 0 {
+		return nil
+	}
+
+	return &loggregator_v2.Envelope{
+		Timestamp:      envelope.Timestamp,
+		SourceId:       envelope.SourceId,
+		InstanceId:     envelope.InstanceId,
+		DeprecatedTags: envelope.DeprecatedTags,
+		Tags:           envelope.Tags,
+		Message: &loggregator_v2.Envelope_Gauge{
+			Gauge: &loggregator_v2.Gauge{
+				Metrics: filteredMetrics,
+			},
+		},
+	}
+}
+
 func (s *Store) validEnvelopeType(e *loggregator_v2.Envelope, types []logcache_v1.EnvelopeType) bool {
 	if types == nil {
 		return true
@@ -430,11 +1457,35 @@ func (s *Store) validEnvelopeType(e *loggregator_v2.Envelope, types []logcache_v
 	return false
 }
 
+// appendPerType appends e to res if it is of one of the types in perType
+// that has fewer than limit envelopes so far. It returns true once every
+// type has reached the limit.
+func (s *Store) appendPerType(
+	res *[]*loggregator_v2.Envelope,
+	e *loggregator_v2.Envelope,
+	perType map[logcache_v1.EnvelopeType]int,
+	limit int,
+) bool {
+	for t, n := range perType {
+		if n < limit && s.checkEnvelopeType(e, t) {
+			perType[t]++
+			*res = append(*res, e)
+			break
+		}
+	}
+
+	return len(*res) >= limit*len(perType)
+}
+
+// treeAscTraverse calls f with the key and envelope of the nodes stored
+// under a key greater than after with a timestamp in [start, end), in
+// ascending order, until f returns true.
 func (s *Store) treeAscTraverse(
 	n *avltree.Node,
+	after int64,
 	start int64,
 	end int64,
-	f func(e *loggregator_v2.Envelope) bool,
+	f func(key int64, e *loggregator_v2.Envelope) bool,
 ) bool {
 	if n == nil {
 		return false
@@ -442,18 +1493,19 @@ func (s *Store) treeAscTraverse(
 
 	e := n.Value.(*loggregator_v2.Envelope)
 	t := e.GetTimestamp()
+	key := n.Key.(int64)
 
-	if t >= start {
-		if s.treeAscTraverse(n.Children[0], start, end, f) {
+	if t >= start && key > after {
+		if s.treeAscTraverse(n.Children[0], after, start, end, f) {
 			return true
 		}
 
-		if (t >= end || f(e)) && !isNodeAFudgeSequenceMember(n, 1) {
+		if (t >= end || f(key, e)) && !isNodeAFudgeSequenceMember(n, 1) {
 			return true
 		}
 	}
 
-	return s.treeAscTraverse(n.Children[1], start, end, f)
+	return s.treeAscTraverse(n.Children[1], after, start, end, f)
 }
 
 func isNodeAFudgeSequenceMember(node *avltree.Node, nextChildIndex int) bool {
@@ -479,11 +1531,15 @@ func isNodeAFudgeSequenceMember(node *avltree.Node, nextChildIndex int) bool {
 	return (nextEnvelope.GetTimestamp() != nextChild.Key.(int64))
 }
 
+// treeDescTraverse calls f with the key and envelope of the nodes stored
+// under a key less than before with a timestamp in [start, end), in
+// descending order, until f returns true.
 func (s *Store) treeDescTraverse(
 	n *avltree.Node,
+	before int64,
 	start int64,
 	end int64,
-	f func(e *loggregator_v2.Envelope) bool,
+	f func(key int64, e *loggregator_v2.Envelope) bool,
 ) bool {
 	if n == nil {
 		return false
@@ -491,18 +1547,19 @@ func (s *Store) treeDescTraverse(
 
 	e := n.Value.(*loggregator_v2.Envelope)
 	t := e.GetTimestamp()
+	key := n.Key.(int64)
 
-	if t < end {
-		if s.treeDescTraverse(n.Children[1], start, end, f) {
+	if t < end && key < before {
+		if s.treeDescTraverse(n.Children[1], before, start, end, f) {
 			return true
 		}
 
-		if (t < start || f(e)) && !isNodeAFudgeSequenceMember(n, 0) {
+		if (t < start || f(key, e)) && !isNodeAFudgeSequenceMember(n, 0) {
 			return true
 		}
 	}
 
-	return s.treeDescTraverse(n.Children[0], start, end, f)
+	return s.treeDescTraverse(n.Children[0], before, start, end, f)
 }
 
 func (s *Store) checkEnvelopeType(e *loggregator_v2.Envelope, t logcache_v1.EnvelopeType) bool {
@@ -528,6 +1585,24 @@ func (s *Store) checkEnvelopeType(e *loggregator_v2.Envelope, t logcache_v1.Enve
 	}
 }
 
+// OldestTimestamp returns the timestamp of the oldest envelope stored for
+// the source ID.
+func (store *Store) OldestTimestamp(sourceId string) (int64, bool) {
+	tree, ok := store.storageIndex.Load(sourceId)
+	if !ok {
+		return 0, false
+	}
+
+	tree.(*storage).RLock()
+	defer tree.(*storage).RUnlock()
+
+	if tree.(*storage).Size() == 0 {
+		return 0, false
+	}
+
+	return tree.(*storage).Left().Key.(int64), true
+}
+
 // Meta returns each source ID tracked in the store.
 func (store *Store) Meta() map[string]logcache_v1.MetaInfo {
 	metaReport := make(map[string]logcache_v1.MetaInfo)
@@ -548,7 +1623,11 @@ func (store *Store) Meta() map[string]logcache_v1.MetaInfo {
 	// Range over our local copy of metaReport
 	// TODO - shouldn't we just maintain Count on metaReport..?!
 	for sourceId := range metaReport {
-		tree, _ := store.storageIndex.Load(sourceId)
+		tree, ok := store.storageIndex.Load(sourceId)
+		if !ok {
+			delete(metaReport, sourceId)
+			continue
+		}
 
 		tree.(*storage).RLock()
 		metaReport[sourceId] = logcache_v1.MetaInfo{
@@ -562,10 +1641,148 @@ func (store *Store) Meta() map[string]logcache_v1.MetaInfo {
 	return metaReport
 }
 
+// SourceDiagnostics describes the tree of the envelopes of a source ID.
+type SourceDiagnostics struct {
+	SourceID string
+
+	// Size is the number of envelopes in the tree.
+	Size int
+
+	// Depth is the depth of the tree.
+	Depth int
+
+	OldestTimestamp int64
+	NewestTimestamp int64
+}
+
+// Diagnostics returns the size, depth and time range of the trees of the
+// limit source IDs holding the most envelopes, largest first. Depths are
+// only computed for the returned trees since that requires walking them.
+func (store *Store) Diagnostics(limit int) []SourceDiagnostics {
+	var diagnostics []SourceDiagnostics
+	trees := make(map[string]*storage)
+
+	store.storageIndex.Range(func(sourceId interface{}, tree interface{}) bool {
+		tree.(*storage).RLock()
+		defer tree.(*storage).RUnlock()
+
+		if tree.(*storage).Size() == 0 {
+			return true
+		}
+
+		diagnostics = append(diagnostics, SourceDiagnostics{
+			SourceID:        sourceId.(string),
+			Size:            tree.(*storage).Size(),
+			OldestTimestamp: tree.(*storage).Left().Key.(int64),
+			NewestTimestamp: tree.(*storage).Right().Key.(int64),
+		})
+		trees[sourceId.(string)] = tree.(*storage)
+
+		return true
+	})
+
+	sort.Slice(diagnostics, func(i, j int) bool {
+		if diagnostics[i].Size != diagnostics[j].Size {
+			return diagnostics[i].Size > diagnostics[j].Size
+		}
+
+		return diagnostics[i].SourceID < diagnostics[j].SourceID
+	})
+	if len(diagnostics) > limit {
+		diagnostics = diagnostics[:limit]
+	}
+
+	for i := range diagnostics {
+		tree := trees[diagnostics[i].SourceID]
+		tree.RLock()
+		diagnostics[i].Depth = depth(tree.Root)
+		tree.RUnlock()
+	}
+
+	return diagnostics
+}
+
+// MetricName is the name of a counter, gauge metric or timer and the
+// timestamp of the newest envelope it was seen in.
+type MetricName struct {
+	Name      string
+	Timestamp int64
+}
+
+// MetricNames returns up to limit distinct names of the counters, gauge
+// metrics and timers stored for the source ID with a timestamp in
+// [start, end), most recently seen first, from a single traversal of its
+// tree. Spilled envelopes are not included.
+func (store *Store) MetricNames(sourceId string, start, end time.Time, limit int) []MetricName {
+	tree, ok := store.storageIndex.Load(sourceId)
+	if !ok {
+		return nil
+	}
+
+	var names []MetricName
+	seen := make(map[string]bool)
+	add := func(name string, timestamp int64) {
+		if seen[name] {
+			return
+		}
+		seen[name] = true
+		names = append(names, MetricName{Name: name, Timestamp: timestamp})
+	}
+
+	tree.(*storage).RLock()
+	defer tree.(*storage).RUnlock()
+
+	store.treeDescTraverse(tree.(*storage).Root, math.MaxInt64, start.UnixNano(), end.UnixNano(), func(_ int64, e *loggregator_v2.Envelope) bool {
+		switch m := e.Message.(type) {
+		case *loggregator_v2.Envelope_Counter:
+			add(m.Counter.GetName(), e.GetTimestamp())
+		case *loggregator_v2.Envelope_Timer:
+			add(m.Timer.GetName(), e.GetTimestamp())
+		case *loggregator_v2.Envelope_Gauge:
+			gauges := make([]string, 0, len(m.Gauge.GetMetrics()))
+			for name := range m.Gauge.GetMetrics() {
+				gauges = append(gauges, name)
+			}
+			sort.Strings(gauges)
+
+			for _, name := range gauges {
+				add(name, e.GetTimestamp())
+			}
+		}
+
+		// Return true to stop traversing
+		return len(names) >= limit
+	})
+
+	if len(names) > limit {
+		names = names[:limit]
+	}
+
+	return names
+}
+
+// depth returns the number of nodes on the longest path from n to a leaf.
+func depth(n *avltree.Node) int {
+	if n == nil {
+		return 0
+	}
+
+	return 1 + max(depth(n.Children[0]), depth(n.Children[1]))
+}
+
 type storage struct {
 	sourceId string
 	meta     logcache_v1.MetaInfo
 
+	// removed is set once the storage was removed from the store's index.
+	// Envelopes must no longer be stored in it. It is guarded by the
+	// storage's lock.
+	removed bool
+
+	// lru is the element of the source ID in the store's least recently
+	// written list. It is guarded by the store's lruMu.
+	lru *list.Element
+
 	*avltree.Tree
 	sync.RWMutex
 }
@@ -578,9 +1795,18 @@ type storageExpiration struct {
 	tree      *storage
 }
 
-func (h ExpirationHeap) Len() int           { return len(h) }
-func (h ExpirationHeap) Less(i, j int) bool { return h[i].timestamp < h[j].timestamp }
-func (h ExpirationHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h ExpirationHeap) Len() int      { return len(h) }
+func (h ExpirationHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+// Less orders source IDs with the same oldest timestamp by source ID, so
+// that which one is pruned first does not depend on how the heap was built.
+func (h ExpirationHeap) Less(i, j int) bool {
+	if h[i].timestamp != h[j].timestamp {
+		return h[i].timestamp < h[j].timestamp
+	}
+
+	return h[i].sourceId < h[j].sourceId
+}
 
 func (h *ExpirationHeap) Push(x interface{}) {
 	*h = append(*h, x.(storageExpiration))
@@ -74,7 +74,7 @@ func BenchmarkStoreGetTime5MinRange(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		results = s.Get(sourceIDs[i%len(sourceIDs)], fiveMinAgo, now, nil, nil, b.N, false)
+		results, _ = s.Get(sourceIDs[i%len(sourceIDs)], store.Query{Start: fiveMinAgo, End: now, Limit: b.N})
 	}
 }
 
@@ -90,7 +90,7 @@ func BenchmarkStoreGetLogType(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		results = s.Get(sourceIDs[i%len(sourceIDs)], MinTime, MaxTime, logType, nil, b.N, false)
+		results, _ = s.Get(sourceIDs[i%len(sourceIDs)], store.Query{Start: MinTime, End: MaxTime, EnvelopeTypes: logType, Limit: b.N})
 	}
 }
 
@@ -140,7 +140,7 @@ func BenchmarkMetaWhileReading(b *testing.B) {
 	go func() {
 		close(ready)
 		for i := 0; i < b.N; i++ {
-			results = s.Get(sourceIDs[i%len(sourceIDs)], fiveMinAgo, now, nil, nil, b.N, false)
+			results, _ = s.Get(sourceIDs[i%len(sourceIDs)], store.Query{Start: fiveMinAgo, End: now, Limit: b.N})
 		}
 	}()
 	<-ready
@@ -151,6 +151,37 @@ func BenchmarkMetaWhileReading(b *testing.B) {
 	}
 }
 
+func BenchmarkBuildExpirationHeap(b *testing.B) {
+	newStore := func(opts ...store.StoreOption) *store.Store {
+		s := store.NewStore(MaxPerSource, TruncationInterval, PrunesPerGC, &staticPruner{}, nopMetrics{}, opts...)
+		for i := 0; i < 20000; i++ {
+			e := benchBuildLog(fmt.Sprintf("source-%d", i), int64(i))
+			s.Put(e, e.GetSourceId())
+		}
+		return s
+	}
+
+	b.Run("push", func(b *testing.B) {
+		s := newStore()
+
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			s.BuildExpirationHeapByPush()
+		}
+	})
+
+	for _, parallelism := range []int{1, 4, 8} {
+		b.Run(fmt.Sprintf("parallelism %d", parallelism), func(b *testing.B) {
+			s := newStore(store.WithHeapBuildParallelism(parallelism))
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				s.BuildExpirationHeap()
+			}
+		})
+	}
+}
+
 func randEnvGen() func() *loggregator_v2.Envelope {
 	var s []*loggregator_v2.Envelope
 	fiveMinAgo := time.Now().Add(-5 * time.Minute)
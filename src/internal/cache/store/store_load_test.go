@@ -72,7 +72,7 @@ var _ = Describe("store under high concurrent load", func() {
 			case <-done:
 				return
 			default:
-				envelopes := s.Get("index-9", start, time.Now(), nil, nil, 100000, false)
+				envelopes, _ := s.Get("index-9", store.Query{Start: start, End: time.Now(), Limit: 100000})
 				Expect(len(envelopes)).Should(BeNumerically("<=", 2500))
 				time.Sleep(time.Duration(time.Millisecond * 10))
 			}
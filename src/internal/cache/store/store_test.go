@@ -1,9 +1,16 @@
 package store_test
 
 import (
+	"bytes"
+	"log/slog"
+	"os"
 	"regexp"
+	"runtime/pprof"
+	"slices"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	metrics "code.cloudfoundry.org/go-metric-registry"
@@ -12,6 +19,7 @@ import (
 	"code.cloudfoundry.org/go-log-cache/v3/rpc/logcache_v1"
 	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
 	"code.cloudfoundry.org/log-cache/internal/cache/store"
+	"code.cloudfoundry.org/log-cache/internal/severity"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -43,7 +51,7 @@ var _ = Describe("Store", func() {
 
 		start := time.Unix(0, 0)
 		end := time.Unix(0, 4)
-		envelopes := s.Get("a", start, end, nil, nil, 10, false)
+		envelopes, _ := s.Get("a", store.Query{Start: start, End: end, Limit: 10})
 		Expect(envelopes).To(HaveLen(2))
 
 		for _, e := range envelopes {
@@ -69,7 +77,7 @@ var _ = Describe("Store", func() {
 
 		start := time.Unix(0, 0)
 		end := time.Unix(0, 9999)
-		envelopes := s.Get("a", start, end, nil, nil, 3, false)
+		envelopes, _ := s.Get("a", store.Query{Start: start, End: end, Limit: 3})
 		Expect(envelopes).To(HaveLen(3))
 		Expect(envelopes[0].GetTimestamp()).To(Equal(int64(1)))
 		Expect(envelopes[1].GetTimestamp()).To(Equal(int64(2)))
@@ -102,7 +110,7 @@ var _ = Describe("Store", func() {
 
 			start := time.Unix(0, 1)
 			end := time.Unix(0, 3)
-			envelopes := s.Get("a", start, end, nil, nil, 5, false)
+			envelopes, _ := s.Get("a", store.Query{Start: start, End: end, Limit: 5})
 			Expect(envelopes).To(HaveLen(4))
 			Expect(envelopes[0].GetTimestamp()).To(Equal(int64(1)))
 			Expect(envelopes[1].GetTimestamp()).To(Equal(int64(1)))
@@ -122,7 +130,7 @@ var _ = Describe("Store", func() {
 
 			start := time.Unix(0, 0)
 			end := time.Unix(0, 2)
-			envelopes := s.Get("a", start, end, nil, nil, 2, false)
+			envelopes, _ := s.Get("a", store.Query{Start: start, End: end, Limit: 2})
 			Expect(envelopes).To(HaveLen(3))
 			Expect(envelopes[0].GetTimestamp()).To(Equal(int64(0)))
 			Expect(envelopes[1].GetTimestamp()).To(Equal(int64(1)))
@@ -156,7 +164,7 @@ var _ = Describe("Store", func() {
 
 			start := time.Unix(0, 1)
 			end := time.Unix(0, 3)
-			envelopes := s.Get("a", start, end, nil, nil, 5, true)
+			envelopes, _ := s.Get("a", store.Query{Start: start, End: end, Limit: 5, Descending: true})
 			Expect(envelopes).To(HaveLen(4))
 			Expect(envelopes[0].GetTimestamp()).To(Equal(int64(2)))
 			Expect(envelopes[1].GetTimestamp()).To(Equal(int64(2)))
@@ -176,7 +184,7 @@ var _ = Describe("Store", func() {
 
 			start := time.Unix(0, 0)
 			end := time.Unix(0, 2)
-			envelopes := s.Get("a", start, end, nil, nil, 2, true)
+			envelopes, _ := s.Get("a", store.Query{Start: start, End: end, Limit: 2, Descending: true})
 			Expect(envelopes).To(HaveLen(3))
 			Expect(envelopes[0].GetTimestamp()).To(Equal(int64(1)))
 			Expect(envelopes[1].GetTimestamp()).To(Equal(int64(0)))
@@ -198,7 +206,7 @@ var _ = Describe("Store", func() {
 
 		start := time.Unix(0, 0)
 		end := time.Unix(0, 9999)
-		envelopes := s.Get("a", start, end, nil, nil, 3, true)
+		envelopes, _ := s.Get("a", store.Query{Start: start, End: end, Limit: 3, Descending: true})
 		Expect(envelopes).To(HaveLen(3))
 		Expect(envelopes[0].GetTimestamp()).To(Equal(int64(4)))
 		Expect(envelopes[1].GetTimestamp()).To(Equal(int64(3)))
@@ -221,6 +229,81 @@ var _ = Describe("Store", func() {
 		Expect(m).To(Equal(int64(4)))
 	})
 
+	Describe("paging with a cursor", func() {
+		var ids []string
+
+		BeforeEach(func() {
+			s = store.NewStore(50, TruncationInterval, PrunesPerGC, sp, sm)
+
+			ids = nil
+			for i, ts := range []int64{1, 1, 1, 2, 2, 3, 5, 5, 5} {
+				e := buildEnvelope(ts, "a")
+				e.InstanceId = strconv.Itoa(i)
+				s.Put(e, e.GetSourceId())
+				ids = append(ids, e.InstanceId)
+			}
+		})
+
+		readAll := func(limit int, descending bool) ([]string, []int64) {
+			var (
+				read       []string
+				timestamps []int64
+				cursor     *int64
+			)
+			for pages := 0; pages < 20; pages++ {
+				envelopes, next := s.Get("a", store.Query{Start: time.Unix(0, 0), End: time.Unix(0, 9999), Limit: limit, Descending: descending, Cursor: cursor})
+				for _, e := range envelopes {
+					read = append(read, e.GetInstanceId())
+					timestamps = append(timestamps, e.GetTimestamp())
+				}
+				if len(envelopes) < limit {
+					return read, timestamps
+				}
+				cursor = &next
+			}
+
+			Fail("paging did not finish")
+			return nil, nil
+		}
+
+		DescribeTable("returns every envelope exactly once, in order", func(limit int, descending bool) {
+			read, timestamps := readAll(limit, descending)
+			Expect(read).To(ConsistOf(ids))
+
+			if descending {
+				slices.Reverse(timestamps)
+			}
+			Expect(slices.IsSorted(timestamps)).To(BeTrue())
+		},
+			Entry("ascending", 2, false),
+			Entry("ascending one at a time", 1, false),
+			Entry("descending", 2, true),
+			Entry("descending one at a time", 1, true),
+		)
+
+		It("returns the same envelopes as Get for the first page", func() {
+			envelopes, _ := s.Get("a", store.Query{Start: time.Unix(0, 0), End: time.Unix(0, 9999), Limit: 4})
+			Expect(envelopes).To(Equal(getEnvelopes(s, "a", store.Query{Start: time.Unix(0, 0), End: time.Unix(0, 9999), Limit: 4})))
+		})
+
+		It("does not return envelopes skipped by its filters on the next page", func() {
+			s = store.NewStore(50, TruncationInterval, PrunesPerGC, sp, sm)
+			s.Put(buildTypedEnvelope(1, "a", &loggregator_v2.Counter{}), "a")
+			s.Put(buildTypedEnvelope(2, "a", &loggregator_v2.Log{}), "a")
+			s.Put(buildTypedEnvelope(3, "a", &loggregator_v2.Counter{}), "a")
+			s.Put(buildTypedEnvelope(4, "a", &loggregator_v2.Log{}), "a")
+
+			envelopes, next := s.Get("a", store.Query{Start: time.Unix(0, 0), End: time.Unix(0, 9999), EnvelopeTypes: []logcache_v1.EnvelopeType{logcache_v1.EnvelopeType_LOG}, Limit: 1})
+			Expect(envelopes).To(HaveLen(1))
+			Expect(envelopes[0].GetTimestamp()).To(Equal(int64(2)))
+
+			envelopes, _ = s.Get("a", store.Query{Start: time.Unix(0, 0), End: time.Unix(0, 9999), Limit: 10, Cursor: &next})
+			Expect(envelopes).To(HaveLen(2))
+			Expect(envelopes[0].GetTimestamp()).To(Equal(int64(3)))
+			Expect(envelopes[1].GetTimestamp()).To(Equal(int64(4)))
+		})
+	})
+
 	DescribeTable("fetches data based on envelope type",
 		func(envelopeType logcache_v1.EnvelopeType, envelopeWrapper interface{}) {
 			s = store.NewStore(5, TruncationInterval, PrunesPerGC, sp, sm)
@@ -238,12 +321,12 @@ var _ = Describe("Store", func() {
 
 			start := time.Unix(0, 0)
 			end := time.Unix(0, 9999)
-			envelopes := s.Get("a", start, end, []logcache_v1.EnvelopeType{envelopeType}, nil, 5, false)
+			envelopes, _ := s.Get("a", store.Query{Start: start, End: end, EnvelopeTypes: []logcache_v1.EnvelopeType{envelopeType}, Limit: 5})
 			Expect(envelopes).To(HaveLen(1))
 			Expect(envelopes[0].Message).To(BeAssignableToTypeOf(envelopeWrapper))
 
 			// No Filter
-			envelopes = s.Get("a", start, end, nil, nil, 10, false)
+			envelopes, _ = s.Get("a", store.Query{Start: start, End: end, Limit: 10})
 			Expect(envelopes).To(HaveLen(5))
 		},
 
@@ -254,6 +337,77 @@ var _ = Describe("Store", func() {
 		Entry("Event", logcache_v1.EnvelopeType_EVENT, &loggregator_v2.Envelope_Event{}),
 	)
 
+	Describe("limit per envelope type", func() {
+		var types []logcache_v1.EnvelopeType
+
+		BeforeEach(func() {
+			s = store.NewStore(100, TruncationInterval, PrunesPerGC, sp, sm)
+			types = []logcache_v1.EnvelopeType{logcache_v1.EnvelopeType_LOG, logcache_v1.EnvelopeType_COUNTER}
+
+			// Logs come first and far outnumber the counters.
+			for i := int64(1); i <= 20; i++ {
+				e := buildTypedEnvelope(i, "a", &loggregator_v2.Log{})
+				s.Put(e, e.GetSourceId())
+			}
+			for i := int64(21); i <= 25; i++ {
+				e := buildTypedEnvelope(i, "a", &loggregator_v2.Counter{})
+				s.Put(e, e.GetSourceId())
+			}
+			e := buildTypedEnvelope(26, "a", &loggregator_v2.Gauge{})
+			s.Put(e, e.GetSourceId())
+		})
+
+		countTypes := func(envelopes []*loggregator_v2.Envelope) (logs, counters int) {
+			for _, e := range envelopes {
+				switch e.Message.(type) {
+				case *loggregator_v2.Envelope_Log:
+					logs++
+				case *loggregator_v2.Envelope_Counter:
+					counters++
+				default:
+					Fail("unexpected envelope type")
+				}
+			}
+			return logs, counters
+		}
+
+		It("lets one type crowd out another without it", func() {
+			envelopes, _ := s.Get("a", store.Query{Start: time.Unix(0, 0), End: time.Unix(0, 9999), EnvelopeTypes: types, Limit: 4})
+
+			logs, counters := countTypes(envelopes)
+			Expect(logs).To(Equal(4))
+			Expect(counters).To(BeZero())
+		})
+
+		It("returns up to limit envelopes of each type in ascending order", func() {
+			envelopes, _ := s.Get("a", store.Query{Start: time.Unix(0, 0), End: time.Unix(0, 9999), EnvelopeTypes: types, Limit: 4, LimitPerType: true})
+
+			logs, counters := countTypes(envelopes)
+			Expect(logs).To(Equal(4))
+			Expect(counters).To(Equal(4))
+			Expect(envelopes[0].GetTimestamp()).To(Equal(int64(1)))
+			Expect(envelopes[4].GetTimestamp()).To(Equal(int64(21)))
+		})
+
+		It("returns up to limit envelopes of each type in descending order", func() {
+			envelopes, _ := s.Get("a", store.Query{Start: time.Unix(0, 0), End: time.Unix(0, 9999), EnvelopeTypes: types, Limit: 3, LimitPerType: true, Descending: true})
+
+			logs, counters := countTypes(envelopes)
+			Expect(logs).To(Equal(3))
+			Expect(counters).To(Equal(3))
+			Expect(envelopes[0].GetTimestamp()).To(Equal(int64(25)))
+			Expect(envelopes[3].GetTimestamp()).To(Equal(int64(20)))
+		})
+
+		It("returns every envelope of a type with fewer than limit", func() {
+			envelopes, _ := s.Get("a", store.Query{Start: time.Unix(0, 0), End: time.Unix(0, 9999), EnvelopeTypes: types, Limit: 10, LimitPerType: true})
+
+			logs, counters := countTypes(envelopes)
+			Expect(logs).To(Equal(10))
+			Expect(counters).To(Equal(5))
+		})
+	})
+
 	DescribeTable("fetches data based on metric name",
 		func(nameFilter, expectedName string) {
 			s = store.NewStore(5, TruncationInterval, PrunesPerGC, sp, sm)
@@ -269,7 +423,7 @@ var _ = Describe("Store", func() {
 
 			start := time.Unix(0, 0)
 			end := time.Unix(0, 9999)
-			envelopes := s.Get("source-id", start, end, nil, filter, 5, false)
+			envelopes, _ := s.Get("source-id", store.Query{Start: start, End: end, NameFilter: filter, Limit: 5})
 			Expect(envelopes).To(HaveLen(1))
 
 			targetEnvelope := envelopes[0]
@@ -285,7 +439,7 @@ var _ = Describe("Store", func() {
 			}
 
 			// No Filter
-			envelopes = s.Get("source-id", start, end, nil, nil, 10, false)
+			envelopes, _ = s.Get("source-id", store.Query{Start: start, End: end, Limit: 10})
 			Expect(envelopes).To(HaveLen(3))
 		},
 
@@ -294,6 +448,596 @@ var _ = Describe("Store", func() {
 		Entry("Timer", "timer-metric-name", "timer-metric-name"),
 	)
 
+	DescribeTable("fetches data based on tags",
+		func(tagFilters map[string]*regexp.Regexp, expectedTimestamps []int64) {
+			s = store.NewStore(5, TruncationInterval, PrunesPerGC, sp, sm)
+
+			for i, tags := range []map[string]string{
+				{"deployment": "cf", "job": "router"},
+				{"deployment": "cf", "job": "diego-cell"},
+				{"deployment": "cf-mysql"},
+			} {
+				e := buildEnvelope(int64(i+1), "a")
+				e.Tags = tags
+				s.Put(e, e.GetSourceId())
+			}
+
+			envelopes, _ := s.Get("a", store.Query{Start: time.Unix(0, 0), End: time.Unix(0, 9999), TagFilters: tagFilters, Limit: 5})
+
+			var timestamps []int64
+			for _, e := range envelopes {
+				timestamps = append(timestamps, e.Timestamp)
+			}
+			Expect(timestamps).To(Equal(expectedTimestamps))
+		},
+
+		Entry("no filter", nil, []int64{1, 2, 3}),
+		Entry("matching values", map[string]*regexp.Regexp{"deployment": regexp.MustCompile("^cf$")}, []int64{1, 2}),
+		Entry("all filters match", map[string]*regexp.Regexp{
+			"deployment": regexp.MustCompile("^cf"),
+			"job":        regexp.MustCompile("router|cell"),
+		}, []int64{1, 2}),
+		Entry("non-matching values", map[string]*regexp.Regexp{"job": regexp.MustCompile("^uaa$")}, nil),
+		Entry("missing tag", map[string]*regexp.Regexp{"job": regexp.MustCompile(".*")}, []int64{1, 2}),
+		Entry("tag present with any value", map[string]*regexp.Regexp{"deployment": regexp.MustCompile("")}, []int64{1, 2, 3}),
+		Entry("tag absent from some envelopes", map[string]*regexp.Regexp{"job": regexp.MustCompile("")}, []int64{1, 2}),
+		Entry("tag absent from every envelope", map[string]*regexp.Regexp{"trace_id": regexp.MustCompile("")}, nil),
+	)
+
+	Describe("latest per series", func() {
+		counter := func(ts int64, name string, tags map[string]string) *loggregator_v2.Envelope {
+			e := buildEnvelope(ts, "a")
+			e.Tags = tags
+			e.Message = &loggregator_v2.Envelope_Counter{
+				Counter: &loggregator_v2.Counter{Name: name, Total: uint64(ts)},
+			}
+			return e
+		}
+
+		BeforeEach(func() {
+			s = store.NewStore(20, TruncationInterval, PrunesPerGC, sp, sm)
+
+			for _, e := range []*loggregator_v2.Envelope{
+				counter(1, "requests", map[string]string{"job": "router"}),
+				counter(2, "requests", map[string]string{"job": "cell"}),
+				counter(3, "requests", map[string]string{"job": "router"}),
+				counter(4, "errors", map[string]string{"job": "router"}),
+				counter(5, "requests", map[string]string{"job": "cell"}),
+				counter(6, "requests", map[string]string{"job": "router", "az": "z1"}),
+				counter(7, "requests", map[string]string{"job": "router"}),
+			} {
+				s.Put(e, e.GetSourceId())
+			}
+		})
+
+		timestamps := func(envelopes []*loggregator_v2.Envelope) []int64 {
+			var ts []int64
+			for _, e := range envelopes {
+				ts = append(ts, e.GetTimestamp())
+			}
+			return ts
+		}
+
+		It("returns the newest envelope of each series, newest first", func() {
+			envelopes, _ := s.Get("a", store.Query{Start: time.Unix(0, 0), End: time.Unix(0, 9999), Limit: 10, LatestPerSeries: true, Descending: true})
+			Expect(timestamps(envelopes)).To(Equal([]int64{7, 6, 5, 4}))
+		})
+
+		It("only considers envelopes in the time range", func() {
+			envelopes, _ := s.Get("a", store.Query{Start: time.Unix(0, 0), End: time.Unix(0, 4), Limit: 10, LatestPerSeries: true, Descending: true})
+			Expect(timestamps(envelopes)).To(Equal([]int64{3, 2}))
+		})
+
+		It("limits the number of series", func() {
+			envelopes, _ := s.Get("a", store.Query{Start: time.Unix(0, 0), End: time.Unix(0, 9999), Limit: 2, LatestPerSeries: true, Descending: true})
+			Expect(timestamps(envelopes)).To(Equal([]int64{7, 6}))
+		})
+
+		It("applies the filters before picking the newest envelope", func() {
+			tagFilters := map[string]*regexp.Regexp{"job": regexp.MustCompile("^cell$")}
+			envelopes, _ := s.Get("a", store.Query{Start: time.Unix(0, 0), End: time.Unix(0, 9999), TagFilters: tagFilters, Limit: 10, LatestPerSeries: true, Descending: true})
+			Expect(timestamps(envelopes)).To(Equal([]int64{5}))
+		})
+
+		It("keeps series of different envelope types apart", func() {
+			e := buildEnvelope(8, "a")
+			e.Tags = map[string]string{"job": "router"}
+			e.Message = &loggregator_v2.Envelope_Log{Log: &loggregator_v2.Log{}}
+			s.Put(e, e.GetSourceId())
+
+			envelopes, _ := s.Get("a", store.Query{Start: time.Unix(0, 0), End: time.Unix(0, 9999), Limit: 10, LatestPerSeries: true, Descending: true})
+			Expect(timestamps(envelopes)).To(Equal([]int64{8, 7, 6, 5, 4}))
+
+			envelopes, _ = s.Get("a", store.Query{Start: time.Unix(0, 0), End: time.Unix(0, 9999), EnvelopeTypes: []logcache_v1.EnvelopeType{logcache_v1.EnvelopeType_COUNTER}, Limit: 10, LatestPerSeries: true, Descending: true})
+			Expect(timestamps(envelopes)).To(Equal([]int64{7, 6, 5, 4}))
+		})
+	})
+
+	DescribeTable("fetches gauge metrics based on unit",
+		func(unitFilter string, nameFilter *regexp.Regexp, expected map[int64][]string) {
+			s = store.NewStore(5, TruncationInterval, PrunesPerGC, sp, sm)
+
+			for i, metrics := range []map[string]*loggregator_v2.GaugeValue{
+				{
+					"memory": {Unit: "bytes", Value: 1024},
+					"cpu":    {Unit: "percentage", Value: 12},
+				},
+				{
+					"disk": {Unit: "bytes", Value: 2048},
+				},
+				{
+					"cpu": {Unit: "percentage", Value: 13},
+				},
+			} {
+				e := buildEnvelope(int64(i+1), "a")
+				e.Message = &loggregator_v2.Envelope_Gauge{
+					Gauge: &loggregator_v2.Gauge{Metrics: metrics},
+				}
+				s.Put(e, e.GetSourceId())
+			}
+			c := buildTypedEnvelope(4, "a", &loggregator_v2.Counter{})
+			s.Put(c, c.GetSourceId())
+
+			envelopes, _ := s.Get("a", store.Query{Start: time.Unix(0, 0), End: time.Unix(0, 9999), NameFilter: nameFilter, UnitFilter: unitFilter, Limit: 10})
+
+			got := make(map[int64][]string)
+			for _, e := range envelopes {
+				got[e.Timestamp] = nil
+				for name := range e.GetGauge().GetMetrics() {
+					got[e.Timestamp] = append(got[e.Timestamp], name)
+				}
+			}
+			Expect(got).To(HaveLen(len(expected)))
+			for ts, names := range expected {
+				Expect(got).To(HaveKey(ts))
+				Expect(got[ts]).To(ConsistOf(names))
+			}
+
+			// The stored envelopes are not modified.
+			all, _ := s.Get("a", store.Query{Start: time.Unix(0, 0), End: time.Unix(0, 9999), Limit: 10})
+			Expect(all).To(HaveLen(4))
+			Expect(all[0].GetGauge().GetMetrics()).To(HaveLen(2))
+		},
+
+		Entry("bytes", "bytes", nil, map[int64][]string{1: {"memory"}, 2: {"disk"}}),
+		Entry("percentage", "percentage", nil, map[int64][]string{1: {"cpu"}, 3: {"cpu"}}),
+		Entry("unknown unit", "seconds", nil, map[int64][]string{}),
+		Entry("combined with a name filter", "bytes", regexp.MustCompile("^disk$"), map[int64][]string{2: {"disk"}}),
+	)
+
+	DescribeTable("fetches events based on severity",
+		func(severityTag string, minSeverity string, expected []int64) {
+			var opts []store.StoreOption
+			if severityTag != "severity" {
+				opts = append(opts, store.WithEventSeverityTag(severityTag))
+			}
+			s = store.NewStore(10, TruncationInterval, PrunesPerGC, sp, sm, opts...)
+
+			for i, severity := range []string{"debug", "info", "warning", "ERROR", "critical", "unknown", ""} {
+				e := buildTypedEnvelope(int64(i+1), "a", &loggregator_v2.Event{})
+				if severity != "" {
+					e.Tags = map[string]string{severityTag: severity}
+				}
+				s.Put(e, e.GetSourceId())
+			}
+			c := buildTypedEnvelope(8, "a", &loggregator_v2.Counter{})
+			c.Tags = map[string]string{severityTag: "critical"}
+			s.Put(c, c.GetSourceId())
+
+			level := 0
+			if minSeverity != "" {
+				var err error
+				level, err = severity.Parse(minSeverity)
+				Expect(err).ToNot(HaveOccurred())
+			}
+
+			envelopes, _ := s.Get("a", store.Query{Start: time.Unix(0, 0), End: time.Unix(0, 9999), MinSeverity: level, Limit: 10})
+
+			var timestamps []int64
+			for _, e := range envelopes {
+				timestamps = append(timestamps, e.Timestamp)
+			}
+			Expect(timestamps).To(Equal(expected))
+		},
+
+		Entry("no minimum", "severity", "", []int64{1, 2, 3, 4, 5, 6, 7, 8}),
+		Entry("debug", "severity", "debug", []int64{1, 2, 3, 4, 5}),
+		Entry("warning", "severity", "warning", []int64{3, 4, 5}),
+		Entry("critical", "severity", "critical", []int64{5}),
+		Entry("a custom severity tag", "level", "error", []int64{4, 5}),
+	)
+
+	DescribeTable("logs ingress and truncation at debug level",
+		func(level slog.Level, expectDebug bool) {
+			buf := &syncBuffer{}
+			logger := slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{Level: level}))
+			s = store.NewStore(5, TruncationInterval, PrunesPerGC, sp, sm, store.WithLogger(logger))
+
+			e := buildEnvelope(1, "a")
+			s.Put(e, e.GetSourceId())
+			sp.SetNumberToPrune(1)
+			Eventually(s.WaitForTruncationToComplete).Should(BeTrue())
+
+			if expectDebug {
+				Expect(buf.String()).To(ContainSubstring(`msg="storing new source ID" source_id=a`))
+				Expect(buf.String()).To(ContainSubstring(`msg="truncated store" pruned=1 remaining=0`))
+				return
+			}
+			Expect(buf.String()).To(BeEmpty())
+		},
+		Entry("debug", slog.LevelDebug, true),
+		Entry("info", slog.LevelInfo, false),
+	)
+
+	Describe("profiler labels", func() {
+		goroutineProfile := func() string {
+			var buf bytes.Buffer
+			Expect(pprof.Lookup("goroutine").WriteTo(&buf, 1)).To(Succeed())
+			return buf.String()
+		}
+
+		// blockedGet starts a Get for the source ID that blocks until the
+		// returned function is called.
+		blockedGet := func(sourceID string) func() {
+			e := buildEnvelope(1, sourceID)
+			s.Put(e, e.GetSourceId())
+
+			unlock := s.LockSource(sourceID)
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				s.Get(sourceID, store.Query{Start: time.Unix(0, 0), End: time.Unix(0, 9999), Limit: 10})
+			}()
+
+			return func() {
+				unlock()
+				Eventually(done).Should(BeClosed())
+			}
+		}
+
+		It("labels a Get for an allowlisted source ID", func() {
+			s = store.NewStore(5, TruncationInterval, PrunesPerGC, sp, sm, store.WithProfilerLabels([]string{"allowed"}))
+
+			release := blockedGet("allowed")
+			defer release()
+
+			Eventually(goroutineProfile).Should(ContainSubstring(`"source_id":"allowed"`))
+		})
+
+		It("does not label a Get for any other source ID", func() {
+			s = store.NewStore(5, TruncationInterval, PrunesPerGC, sp, sm, store.WithProfilerLabels([]string{"allowed"}))
+
+			release := blockedGet("other")
+			defer release()
+
+			Consistently(goroutineProfile, 100*time.Millisecond).ShouldNot(ContainSubstring(`"source_id"`))
+		})
+	})
+
+	Describe("lock contention", func() {
+		It("drops envelopes when the source lock is not taken within the lock timeout", func() {
+			s = store.NewStore(5, TruncationInterval, PrunesPerGC, sp, sm, store.WithLockTimeout(10*time.Millisecond))
+			e1 := buildEnvelope(1, "a")
+			s.Put(e1, e1.GetSourceId())
+
+			unlock := s.LockSource("a")
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				e2 := buildEnvelope(2, "a")
+				s.Put(e2, e2.GetSourceId())
+			}()
+			Eventually(done).Should(BeClosed())
+			unlock()
+
+			Expect(sm.GetMetric("log_cache_lock_contention_dropped", nil).Value()).To(Equal(1.0))
+			Expect(getEnvelopes(s, "a", store.Query{Start: time.Unix(0, 0), End: time.Unix(0, 9999), Limit: 10})).To(HaveLen(1))
+
+			e3 := buildEnvelope(3, "a")
+			s.Put(e3, e3.GetSourceId())
+			Expect(getEnvelopes(s, "a", store.Query{Start: time.Unix(0, 0), End: time.Unix(0, 9999), Limit: 10})).To(HaveLen(2))
+		})
+
+		It("waits for the source lock without a lock timeout", func() {
+			s = store.NewStore(5, TruncationInterval, PrunesPerGC, sp, sm)
+			e1 := buildEnvelope(1, "a")
+			s.Put(e1, e1.GetSourceId())
+
+			unlock := s.LockSource("a")
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				e2 := buildEnvelope(2, "a")
+				s.Put(e2, e2.GetSourceId())
+			}()
+			Consistently(done, 100*time.Millisecond).ShouldNot(BeClosed())
+			unlock()
+			Eventually(done).Should(BeClosed())
+
+			Expect(sm.GetMetric("log_cache_lock_contention_dropped", nil).Value()).To(Equal(0.0))
+			Expect(getEnvelopes(s, "a", store.Query{Start: time.Unix(0, 0), End: time.Unix(0, 9999), Limit: 10})).To(HaveLen(2))
+		})
+	})
+
+	Context("with a max number of source IDs", func() {
+		read := func(sourceID string) []*loggregator_v2.Envelope {
+			return getEnvelopes(s, sourceID, store.Query{Start: time.Unix(0, 0), End: time.Unix(0, 9999), Limit: 10})
+		}
+
+		It("evicts the least recently written source ID for a new one", func() {
+			s = store.NewStore(5, TruncationInterval, PrunesPerGC, sp, sm, store.WithMaxSourceIDs(2))
+			for _, e := range []*loggregator_v2.Envelope{
+				buildEnvelope(1, "a"),
+				buildEnvelope(2, "a"),
+				buildEnvelope(3, "b"),
+				// Writing to a again makes b the least recently written
+				buildEnvelope(4, "a"),
+				buildEnvelope(5, "c"),
+			} {
+				s.Put(e, e.GetSourceId())
+			}
+
+			Expect(read("a")).To(HaveLen(3))
+			Expect(read("b")).To(BeEmpty())
+			Expect(read("c")).To(HaveLen(1))
+			Expect(s.Meta()).ToNot(HaveKey("b"))
+
+			Expect(sm.GetMetric("log_cache_source_ids_evicted", nil).Value()).To(Equal(1.0))
+			Expect(sm.GetMetric("log_cache_source_id_count", nil).Value()).To(Equal(2.0))
+			Expect(sm.GetMetric("log_cache_store_size", map[string]string{"unit": "entries"}).Value()).To(Equal(4.0))
+		})
+
+		It("does not evict while within the max", func() {
+			s = store.NewStore(5, TruncationInterval, PrunesPerGC, sp, sm, store.WithMaxSourceIDs(2))
+			for _, e := range []*loggregator_v2.Envelope{
+				buildEnvelope(1, "a"),
+				buildEnvelope(2, "b"),
+			} {
+				s.Put(e, e.GetSourceId())
+			}
+			s.Purge("a")
+
+			e := buildEnvelope(3, "c")
+			s.Put(e, e.GetSourceId())
+
+			Expect(read("b")).To(HaveLen(1))
+			Expect(read("c")).To(HaveLen(1))
+			Expect(sm.GetMetric("log_cache_source_ids_evicted", nil).Value()).To(Equal(0.0))
+		})
+	})
+
+	It("reports the number of source IDs", func() {
+		s = store.NewStore(5, TruncationInterval, PrunesPerGC, sp, sm)
+		for _, e := range []*loggregator_v2.Envelope{
+			buildEnvelope(1, "a"),
+			buildEnvelope(2, "b"),
+			buildEnvelope(3, "c"),
+		} {
+			s.Put(e, e.GetSourceId())
+		}
+		Expect(sm.GetMetric("log_cache_source_id_count", nil).Value()).To(Equal(3.0))
+
+		s.Purge("b")
+		Expect(sm.GetMetric("log_cache_source_id_count", nil).Value()).To(Equal(2.0))
+
+		// Truncating every envelope of a source ID removes it too
+		sp.SetNumberToPrune(1)
+		Eventually(s.WaitForTruncationToComplete).Should(BeTrue())
+		sp.SetNumberToPrune(0)
+		Expect(sm.GetMetric("log_cache_source_id_count", nil).Value()).To(Equal(1.0))
+	})
+
+	It("counts source IDs created and destroyed by pruning", func() {
+		s = store.NewStore(5, TruncationInterval, PrunesPerGC, sp, sm)
+		for _, e := range []*loggregator_v2.Envelope{
+			buildEnvelope(1, "a"),
+			buildEnvelope(2, "b"),
+			buildEnvelope(3, "b"),
+		} {
+			s.Put(e, e.GetSourceId())
+		}
+		Expect(sm.GetMetric("log_cache_source_created", nil).Value()).To(Equal(2.0))
+		Expect(sm.GetMetric("log_cache_source_destroyed", nil).Value()).To(Equal(0.0))
+
+		sp.SetNumberToPrune(1)
+		Eventually(s.WaitForTruncationToComplete).Should(BeTrue())
+		sp.SetNumberToPrune(0)
+		Expect(sm.GetMetric("log_cache_source_destroyed", nil).Value()).To(Equal(1.0))
+
+		// Writing to the pruned source ID creates it again
+		e := buildEnvelope(4, "a")
+		s.Put(e, e.GetSourceId())
+		Expect(sm.GetMetric("log_cache_source_created", nil).Value()).To(Equal(3.0))
+
+		// Purged source IDs are not counted as destroyed
+		s.Purge("b")
+		Expect(sm.GetMetric("log_cache_source_destroyed", nil).Value()).To(Equal(1.0))
+	})
+
+	Context("with heap build parallelism", func() {
+		putSources := func(s *store.Store) {
+			// Timestamps repeat across source IDs so that ties have to be
+			// broken the same way.
+			for i := 0; i < 200; i++ {
+				sourceID := "source-" + strconv.Itoa(i)
+				for j := int64(0); j < 3; j++ {
+					e := buildEnvelope(int64(i%17)+j*100, sourceID)
+					s.Put(e, e.GetSourceId())
+				}
+			}
+		}
+
+		It("builds the same expiration heap as pushing each source ID", func() {
+			s = store.NewStore(5, TruncationInterval, PrunesPerGC, sp, sm, store.WithHeapBuildParallelism(8))
+			putSources(s)
+
+			expected := s.BuildExpirationHeapByPush().PopSourceIDs()
+			Expect(expected).To(HaveLen(200))
+			Expect(s.BuildExpirationHeap().PopSourceIDs()).To(Equal(expected))
+		})
+
+		It("prunes the same envelopes as without parallelism", func() {
+			sequentialPruner := newSpyPruner()
+			sequential := store.NewStore(5, TruncationInterval, PrunesPerGC, sequentialPruner, testhelpers.NewMetricsRegistry())
+			s = store.NewStore(5, TruncationInterval, PrunesPerGC, sp, sm, store.WithHeapBuildParallelism(8))
+			putSources(sequential)
+			putSources(s)
+
+			sequentialPruner.SetNumberToPrune(250)
+			sp.SetNumberToPrune(250)
+			Eventually(sequential.WaitForTruncationToComplete).Should(BeTrue())
+			sequentialPruner.SetNumberToPrune(0)
+			Eventually(s.WaitForTruncationToComplete).Should(BeTrue())
+			sp.SetNumberToPrune(0)
+
+			remaining := func(s *store.Store) map[string][]int64 {
+				r := make(map[string][]int64)
+				meta := s.Meta()
+				for sourceID := range meta {
+					r[sourceID] = []int64{meta[sourceID].Count, meta[sourceID].OldestTimestamp}
+				}
+				return r
+			}
+			Expect(remaining(s)).To(Equal(remaining(sequential)))
+
+			var count int64
+			for _, r := range remaining(s) {
+				count += r[0]
+			}
+			Expect(count).To(Equal(int64(600 - 250)))
+		})
+	})
+
+	Context("with a max future skew", func() {
+		It("drops envelopes further in the future than the skew", func() {
+			s = store.NewStore(5, TruncationInterval, PrunesPerGC, sp, sm, store.WithMaxFutureSkew(time.Minute))
+			now := time.Now()
+			within := buildEnvelope(now.Add(30*time.Second).UnixNano(), "a")
+			beyond := buildEnvelope(now.Add(time.Hour).UnixNano(), "a")
+
+			s.Put(within, within.GetSourceId())
+			s.Put(beyond, beyond.GetSourceId())
+
+			envelopes, _ := s.Get("a", store.Query{Start: time.Unix(0, 0), End: now.Add(2 * time.Hour), Limit: 10})
+			Expect(envelopes).To(HaveLen(1))
+			Expect(envelopes[0].GetTimestamp()).To(Equal(within.GetTimestamp()))
+			Expect(sm.GetMetric("log_cache_future_timestamp_rejected", nil).Value()).To(Equal(1.0))
+		})
+
+		It("keeps future envelopes without a max future skew", func() {
+			s = store.NewStore(5, TruncationInterval, PrunesPerGC, sp, sm)
+			now := time.Now()
+			e := buildEnvelope(now.Add(time.Hour).UnixNano(), "a")
+
+			s.Put(e, e.GetSourceId())
+
+			Expect(getEnvelopes(s, "a", store.Query{Start: time.Unix(0, 0), End: now.Add(2 * time.Hour), Limit: 10})).To(HaveLen(1))
+			Expect(sm.GetMetric("log_cache_future_timestamp_rejected", nil).Value()).To(Equal(0.0))
+		})
+	})
+
+	It("drops envelopes for a paused source ID until the pause is over", func() {
+		s = store.NewStore(10, TruncationInterval, PrunesPerGC, sp, sm)
+
+		resume := s.Pause("a", 100*time.Millisecond)
+		Expect(resume).To(BeTemporally("~", time.Now().Add(100*time.Millisecond), 50*time.Millisecond))
+
+		s.Put(buildEnvelope(1, "a"), "a")
+		s.Put(buildEnvelope(1, "b"), "b")
+		Expect(getEnvelopes(s, "a", store.Query{Start: time.Unix(0, 0), End: time.Unix(0, 10), Limit: 10})).To(BeEmpty())
+		Expect(getEnvelopes(s, "b", store.Query{Start: time.Unix(0, 0), End: time.Unix(0, 10), Limit: 10})).To(HaveLen(1))
+		Expect(sm.GetMetric("log_cache_paused_dropped", nil).Value()).To(Equal(1.0))
+
+		time.Sleep(150 * time.Millisecond)
+		s.Put(buildEnvelope(2, "a"), "a")
+		Expect(getEnvelopes(s, "a", store.Query{Start: time.Unix(0, 0), End: time.Unix(0, 10), Limit: 10})).To(HaveLen(1))
+		Expect(sm.GetMetric("log_cache_paused_dropped", nil).Value()).To(Equal(1.0))
+	})
+
+	It("resumes a paused source ID when paused for no time", func() {
+		s = store.NewStore(10, TruncationInterval, PrunesPerGC, sp, sm)
+
+		s.Pause("a", time.Hour)
+		s.Pause("a", 0)
+
+		s.Put(buildEnvelope(1, "a"), "a")
+		Expect(getEnvelopes(s, "a", store.Query{Start: time.Unix(0, 0), End: time.Unix(0, 10), Limit: 10})).To(HaveLen(1))
+	})
+
+	Context("with deduplication", func() {
+		logEnvelope := func(timestamp int64, sourceID, payload string) *loggregator_v2.Envelope {
+			return &loggregator_v2.Envelope{
+				Timestamp: timestamp,
+				SourceId:  sourceID,
+				Message: &loggregator_v2.Envelope_Log{
+					Log: &loggregator_v2.Log{Payload: []byte(payload)},
+				},
+			}
+		}
+
+		It("drops an exact duplicate within the window and keeps distinct envelopes", func() {
+			s = store.NewStore(10, TruncationInterval, PrunesPerGC, sp, sm, store.WithDeduplication(time.Minute, 100))
+
+			s.Put(logEnvelope(1, "a", "hello"), "a")
+			s.Put(logEnvelope(1, "a", "hello"), "a")
+			s.Put(logEnvelope(1, "a", "goodbye"), "a")
+			s.Put(logEnvelope(2, "a", "hello"), "a")
+			s.Put(logEnvelope(1, "b", "hello"), "b")
+
+			Expect(getEnvelopes(s, "a", store.Query{Start: time.Unix(0, 0), End: time.Unix(0, 10), Limit: 10})).To(HaveLen(3))
+			Expect(getEnvelopes(s, "b", store.Query{Start: time.Unix(0, 0), End: time.Unix(0, 10), Limit: 10})).To(HaveLen(1))
+			Expect(sm.GetMetric("log_cache_duplicates_dropped", nil).Value()).To(Equal(1.0))
+		})
+
+		It("keeps a duplicate that arrives after the window", func() {
+			s = store.NewStore(10, TruncationInterval, PrunesPerGC, sp, sm, store.WithDeduplication(50*time.Millisecond, 100))
+
+			s.Put(logEnvelope(1, "a", "hello"), "a")
+			time.Sleep(100 * time.Millisecond)
+			s.Put(logEnvelope(1, "a", "hello"), "a")
+
+			Expect(getEnvelopes(s, "a", store.Query{Start: time.Unix(0, 0), End: time.Unix(0, 10), Limit: 10})).To(HaveLen(2))
+			Expect(sm.GetMetric("log_cache_duplicates_dropped", nil).Value()).To(Equal(0.0))
+		})
+
+		It("forgets the oldest envelopes beyond the maximum number of entries", func() {
+			s = store.NewStore(10, TruncationInterval, PrunesPerGC, sp, sm, store.WithDeduplication(time.Minute, 1))
+
+			s.Put(logEnvelope(1, "a", "hello"), "a")
+			s.Put(logEnvelope(2, "a", "goodbye"), "a")
+			s.Put(logEnvelope(1, "a", "hello"), "a")
+			s.Put(logEnvelope(1, "a", "hello"), "a")
+
+			Expect(getEnvelopes(s, "a", store.Query{Start: time.Unix(0, 0), End: time.Unix(0, 10), Limit: 10})).To(HaveLen(3))
+			Expect(sm.GetMetric("log_cache_duplicates_dropped", nil).Value()).To(Equal(1.0))
+		})
+
+		It("stores duplicates without deduplication", func() {
+			s = store.NewStore(10, TruncationInterval, PrunesPerGC, sp, sm)
+
+			s.Put(logEnvelope(1, "a", "hello"), "a")
+			s.Put(logEnvelope(1, "a", "hello"), "a")
+
+			Expect(getEnvelopes(s, "a", store.Query{Start: time.Unix(0, 0), End: time.Unix(0, 10), Limit: 10})).To(HaveLen(2))
+		})
+	})
+
+	It("reports its own metrics as stats", func() {
+		s = store.NewStore(2, TruncationInterval, PrunesPerGC, sp, sm)
+		Expect(s.Stats()).To(Equal(store.Stats{}))
+
+		oldest := time.Now().Add(-time.Minute)
+		for i := 0; i < 3; i++ {
+			e := buildEnvelope(oldest.Add(time.Duration(i)*time.Second).UnixNano(), "a")
+			s.Put(e, e.GetSourceId())
+		}
+
+		stats := s.Stats()
+		Expect(stats.Expired).To(Equal(int64(1)))
+		Expect(stats.Size).To(Equal(int64(2)))
+		Expect(stats.CachePeriod).To(BeNumerically(">=", 58*time.Second))
+	})
+
 	It("is thread safe", func() {
 		s = store.NewStore(5, TruncationInterval, PrunesPerGC, sp, sm)
 		var wg sync.WaitGroup
@@ -314,7 +1058,7 @@ var _ = Describe("Store", func() {
 		start := time.Unix(0, 0)
 		end := time.Unix(9999, 0)
 
-		Eventually(func() int { return len(s.Get("a", start, end, nil, nil, 10, false)) }).Should(Equal(1))
+		Eventually(func() int { return len(getEnvelopes(s, "a", store.Query{Start: start, End: end, Limit: 10})) }).Should(Equal(1))
 	})
 
 	It("survives being over pruned", func() {
@@ -360,7 +1104,7 @@ var _ = Describe("Store", func() {
 
 		start := time.Unix(0, 0)
 		end := time.Unix(0, 9999)
-		envelopes := s.Get("a", start, end, nil, nil, 10, false)
+		envelopes, _ := s.Get("a", store.Query{Start: start, End: end, Limit: 10})
 		Expect(envelopes).To(HaveLen(5))
 
 		for _, e := range envelopes {
@@ -397,12 +1141,12 @@ var _ = Describe("Store", func() {
 
 		start := time.Unix(0, 0)
 		end := time.Unix(0, 9999)
-		envelopes := s.Get("a", start, end, nil, nil, 10, false)
+		envelopes, _ := s.Get("a", store.Query{Start: start, End: end, Limit: 10})
 		Expect(envelopes).To(HaveLen(2))
 		Expect(envelopes[0].Timestamp).To(Equal(int64(3)))
 		Expect(envelopes[1].Timestamp).To(Equal(int64(4)))
 
-		envelopes = s.Get("b", start, end, nil, nil, 10, false)
+		envelopes, _ = s.Get("b", store.Query{Start: start, End: end, Limit: 10})
 		Expect(envelopes).To(HaveLen(1))
 
 		Eventually(func() float64 {
@@ -426,7 +1170,7 @@ var _ = Describe("Store", func() {
 		start := time.Unix(0, 0)
 		end := time.Unix(0, 9999)
 
-		envelopes := s.Get("some-id", start, end, nil, nil, 10, false)
+		envelopes, _ := s.Get("some-id", store.Query{Start: start, End: end, Limit: 10})
 		Expect(envelopes).To(HaveLen(1))
 	})
 
@@ -508,7 +1252,7 @@ var _ = Describe("Store", func() {
 		}
 
 		Consistently(func() int64 {
-			envelopes := loadStore.Get("9", start, time.Now(), nil, nil, 100000, false)
+			envelopes, _ := loadStore.Get("9", store.Query{Start: start, End: time.Now(), Limit: 100000})
 			time.Sleep(1 * time.Second)
 			return int64(len(envelopes))
 		}).Should(BeNumerically("<=", 10000))
@@ -547,6 +1291,459 @@ var _ = Describe("Store", func() {
 		Expect(s.GetConsecutiveTruncations()).To(Equal(int64(0)))
 	})
 
+	Context("with timestamp fudging disabled", func() {
+		It("replaces an envelope with the same timestamp", func() {
+			s = store.NewStore(5, TruncationInterval, PrunesPerGC, sp, sm, store.WithTimestampFudge(0))
+			first := buildTypedEnvelope(1, "a", &loggregator_v2.Log{})
+			second := buildTypedEnvelope(1, "a", &loggregator_v2.Counter{})
+			s.Put(first, "a")
+			s.Put(second, "a")
+
+			envelopes, _ := s.Get("a", store.Query{Start: time.Unix(0, 0), End: time.Unix(0, 10), Limit: 10})
+			Expect(envelopes).To(HaveLen(1))
+			Expect(envelopes[0].Timestamp).To(Equal(int64(1)))
+			Expect(envelopes[0].GetCounter()).ToNot(BeNil())
+			Expect(sm.GetMetricValue("log_cache_store_size", map[string]string{"unit": "entries"})).To(Equal(1.0))
+		})
+
+		It("rejects an envelope with the same timestamp when configured", func() {
+			s = store.NewStore(5, TruncationInterval, PrunesPerGC, sp, sm,
+				store.WithTimestampFudge(0),
+				store.WithRejectTimestampCollisions(),
+			)
+			s.Put(buildTypedEnvelope(1, "a", &loggregator_v2.Log{}), "a")
+			s.Put(buildTypedEnvelope(1, "a", &loggregator_v2.Counter{}), "a")
+			s.Put(buildTypedEnvelope(2, "a", &loggregator_v2.Counter{}), "a")
+
+			envelopes, _ := s.Get("a", store.Query{Start: time.Unix(0, 0), End: time.Unix(0, 10), Limit: 10})
+			Expect(envelopes).To(HaveLen(2))
+			Expect(envelopes[0].Timestamp).To(Equal(int64(1)))
+			Expect(envelopes[0].GetLog()).ToNot(BeNil())
+			Expect(envelopes[1].Timestamp).To(Equal(int64(2)))
+			Expect(sm.GetMetricValue("log_cache_timestamp_collisions_rejected", nil)).To(Equal(1.0))
+			Expect(sm.GetMetricValue("log_cache_store_size", map[string]string{"unit": "entries"})).To(Equal(2.0))
+		})
+
+		It("fudges timestamps by at most the configured amount", func() {
+			s = store.NewStore(5, TruncationInterval, PrunesPerGC, sp, sm, store.WithTimestampFudge(1))
+			s.Put(buildTypedEnvelope(1, "a", &loggregator_v2.Log{}), "a")
+			s.Put(buildTypedEnvelope(1, "a", &loggregator_v2.Log{}), "a")
+			s.Put(buildTypedEnvelope(1, "a", &loggregator_v2.Counter{}), "a")
+
+			envelopes, _ := s.Get("a", store.Query{Start: time.Unix(0, 0), End: time.Unix(0, 10), Limit: 10})
+			Expect(envelopes).To(HaveLen(2))
+			Expect(envelopes[1].GetCounter()).ToNot(BeNil())
+		})
+	})
+
+	It("purges all envelopes for a source ID", func() {
+		s = store.NewStore(5, TruncationInterval, PrunesPerGC, sp, sm)
+		s.Put(buildTypedEnvelope(1, "a", &loggregator_v2.Log{}), "a")
+		s.Put(buildTypedEnvelope(2, "a", &loggregator_v2.Log{}), "a")
+		s.Put(buildTypedEnvelope(3, "b", &loggregator_v2.Log{}), "b")
+
+		Expect(s.Purge("a")).To(Equal(2))
+		Expect(s.Purge("a")).To(Equal(0))
+
+		Expect(getEnvelopes(s, "a", store.Query{Start: time.Unix(0, 0), End: time.Unix(0, 10), Limit: 10})).To(BeEmpty())
+		Expect(s.Meta()).ToNot(HaveKey("a"))
+		Expect(s.Meta()).To(HaveKey("b"))
+		Expect(sm.GetMetricValue("log_cache_store_size", map[string]string{"unit": "entries"})).To(Equal(1.0))
+	})
+
+	It("does not lose envelopes written while their source ID is purged", func() {
+		s = store.NewStore(100000, TruncationInterval, PrunesPerGC, sp, sm)
+
+		var (
+			writers sync.WaitGroup
+			purged  int64
+		)
+		for w := int64(0); w < 8; w++ {
+			writers.Add(1)
+			go func(w int64) {
+				defer writers.Done()
+				for i := int64(0); i < 2500; i++ {
+					s.Put(buildEnvelope(1+w*2500+i, "a"), "a")
+				}
+			}(w)
+		}
+
+		done := make(chan struct{})
+		purgerDone := make(chan struct{})
+		go func() {
+			defer close(purgerDone)
+			for {
+				select {
+				case <-done:
+					return
+				default:
+					atomic.AddInt64(&purged, int64(s.Purge("a")))
+				}
+			}
+		}()
+		writers.Wait()
+		close(done)
+		<-purgerDone
+
+		stored := getEnvelopes(s, "a", store.Query{Start: time.Unix(0, 0), End: time.Unix(0, 20001), Limit: 20000})
+		Expect(purged + int64(len(stored))).To(Equal(int64(20000)))
+		Expect(s.Stats().Size).To(Equal(int64(len(stored))))
+	})
+
+	It("lists the source IDs holding the most envelopes first in its diagnostics", func() {
+		s = store.NewStore(20, TruncationInterval, PrunesPerGC, sp, sm)
+		for i := int64(1); i <= 7; i++ {
+			s.Put(buildEnvelope(i, "b"), "b")
+		}
+		for i := int64(1); i <= 3; i++ {
+			s.Put(buildEnvelope(i+10, "a"), "a")
+		}
+		s.Put(buildEnvelope(20, "c"), "c")
+
+		diagnostics := s.Diagnostics(2)
+		Expect(diagnostics).To(Equal([]store.SourceDiagnostics{
+			{SourceID: "b", Size: 7, Depth: 3, OldestTimestamp: 1, NewestTimestamp: 7},
+			{SourceID: "a", Size: 3, Depth: 2, OldestTimestamp: 11, NewestTimestamp: 13},
+		}))
+
+		Expect(s.Diagnostics(10)).To(HaveLen(3))
+	})
+
+	It("lists the distinct metric names of a source ID, most recently seen first", func() {
+		s = store.NewStore(20, TruncationInterval, PrunesPerGC, sp, sm)
+		s.Put(buildTypedEnvelopeWithName(1, "requests", &loggregator_v2.Counter{}), "source-id")
+		s.Put(buildTypedEnvelopeWithName(2, "latency", &loggregator_v2.Timer{}), "source-id")
+		s.Put(buildTypedEnvelopeWithName(3, "requests", &loggregator_v2.Counter{}), "source-id")
+		s.Put(buildTypedEnvelope(4, "source-id", &loggregator_v2.Log{}), "source-id")
+		s.Put(&loggregator_v2.Envelope{
+			Timestamp: 5,
+			SourceId:  "source-id",
+			Message: &loggregator_v2.Envelope_Gauge{
+				Gauge: &loggregator_v2.Gauge{
+					Metrics: map[string]*loggregator_v2.GaugeValue{"cpu": {Value: 1}},
+				},
+			},
+		}, "source-id")
+		s.Put(buildTypedEnvelopeWithName(6, "latency", &loggregator_v2.Timer{}), "source-id")
+
+		Expect(s.MetricNames("source-id", time.Unix(0, 0), time.Unix(0, 10), 10)).To(Equal([]store.MetricName{
+			{Name: "latency", Timestamp: 6},
+			{Name: "cpu", Timestamp: 5},
+			{Name: "requests", Timestamp: 3},
+		}))
+
+		Expect(s.MetricNames("source-id", time.Unix(0, 0), time.Unix(0, 5), 10)).To(Equal([]store.MetricName{
+			{Name: "requests", Timestamp: 3},
+			{Name: "latency", Timestamp: 2},
+		}))
+		Expect(s.MetricNames("source-id", time.Unix(0, 0), time.Unix(0, 10), 2)).To(HaveLen(2))
+		Expect(s.MetricNames("unknown", time.Unix(0, 0), time.Unix(0, 10), 10)).To(BeEmpty())
+	})
+
+	It("counts egress per allowlisted source ID and rolls up the rest", func() {
+		s = store.NewStore(10, TruncationInterval, PrunesPerGC, sp, sm, store.WithPerSourceEgressMetrics([]string{"a"}))
+
+		s.Put(buildTypedEnvelope(1, "a", &loggregator_v2.Log{}), "a")
+		s.Put(buildTypedEnvelope(2, "a", &loggregator_v2.Log{}), "a")
+		s.Put(buildTypedEnvelope(3, "b", &loggregator_v2.Log{}), "b")
+		s.Put(buildTypedEnvelope(4, "c", &loggregator_v2.Log{}), "c")
+
+		start := time.Unix(0, 0)
+		end := time.Unix(0, 10)
+		s.Get("a", store.Query{Start: start, End: end, Limit: 10})
+		s.Get("b", store.Query{Start: start, End: end, Limit: 10})
+		s.Get("c", store.Query{Start: start, End: end, Limit: 10})
+
+		Expect(sm.GetMetricValue("log_cache_source_egress", map[string]string{"source_id": "a"})).To(Equal(2.0))
+		Expect(sm.GetMetricValue("log_cache_source_egress", map[string]string{"source_id": "other"})).To(Equal(2.0))
+		Expect(sm.HasMetric("log_cache_source_egress", map[string]string{"source_id": "b"})).To(BeFalse())
+		Expect(sm.GetMetricValue("log_cache_egress", nil)).To(Equal(4.0))
+	})
+
+	It("keeps envelopes within the minimum retention during a large prune", func() {
+		s = store.NewStore(10, TruncationInterval, PrunesPerGC, sp, sm, store.WithMinRetention(time.Minute))
+
+		old := time.Now().Add(-time.Hour).UnixNano()
+		recent := time.Now().UnixNano()
+		s.Put(buildTypedEnvelope(old, "a", &loggregator_v2.Log{}), "a")
+		s.Put(buildTypedEnvelope(old+1, "b", &loggregator_v2.Log{}), "b")
+		s.Put(buildTypedEnvelope(recent, "a", &loggregator_v2.Log{}), "a")
+		s.Put(buildTypedEnvelope(recent+1, "b", &loggregator_v2.Log{}), "b")
+
+		sp.SetNumberToPrune(1000)
+		s.WaitForTruncationToComplete()
+
+		start := time.Unix(0, 0)
+		end := time.Now().Add(time.Minute)
+		envelopes, _ := s.Get("a", store.Query{Start: start, End: end, Limit: 10})
+		Expect(envelopes).To(HaveLen(1))
+		Expect(envelopes[0].Timestamp).To(Equal(recent))
+
+		envelopes, _ = s.Get("b", store.Query{Start: start, End: end, Limit: 10})
+		Expect(envelopes).To(HaveLen(1))
+		Expect(envelopes[0].Timestamp).To(Equal(recent + 1))
+	})
+
+	It("converges the cache period toward the target cache period under steady load", func() {
+		target := 2 * time.Minute
+		s = store.NewStore(10000, TruncationInterval, PrunesPerGC, sp, sm, store.WithTargetCachePeriod(target))
+
+		start := time.Now().Add(-10 * time.Minute)
+		for i := 0; i < 600; i++ {
+			e := buildTypedEnvelope(start.Add(time.Duration(i)*time.Second).UnixNano(), "a", &loggregator_v2.Log{})
+			s.Put(e, e.GetSourceId())
+		}
+
+		// A constant trickle of memory pressure alone would take hundreds of
+		// cycles to get near the target.
+		sp.SetNumberToPrune(1)
+		Eventually(s.WaitForTruncationToComplete).Should(BeTrue())
+
+		var periods []float64
+		for i := 0; i < 3; i++ {
+			e := buildTypedEnvelope(time.Now().UnixNano(), "a", &loggregator_v2.Log{})
+			s.Put(e, e.GetSourceId())
+
+			s.WaitForTruncationToComplete()
+			periods = append(periods, sm.GetMetricValue("log_cache_cache_period", map[string]string{"unit": "milliseconds"}))
+		}
+
+		for _, p := range periods {
+			Expect(p).To(BeNumerically("~", float64(target/time.Millisecond), float64(5*time.Second/time.Millisecond)))
+		}
+	})
+
+	It("prunes less than asked while the cache period is below the target cache period", func() {
+		s = store.NewStore(100, TruncationInterval, PrunesPerGC, sp, sm, store.WithTargetCachePeriod(time.Hour))
+
+		now := time.Now()
+		for i := 0; i < 20; i++ {
+			e := buildTypedEnvelope(now.Add(-time.Duration(i)*time.Second).UnixNano(), "a", &loggregator_v2.Log{})
+			s.Put(e, e.GetSourceId())
+		}
+
+		sp.SetNumberToPrune(10)
+		Eventually(s.WaitForTruncationToComplete).Should(BeTrue())
+		sp.SetNumberToPrune(0)
+
+		// The cache period is far below the target, so only half of the
+		// requested envelopes are pruned.
+		envelopes, _ := s.Get("a", store.Query{Start: time.Unix(0, 0), End: time.Now().Add(time.Minute), Limit: 100})
+		Expect(envelopes).To(HaveLen(15))
+	})
+
+	Describe("spillover", func() {
+		var dir string
+
+		BeforeEach(func() {
+			dir = GinkgoT().TempDir()
+		})
+
+		timestamps := func(envelopes []*loggregator_v2.Envelope) []int64 {
+			var res []int64
+			for _, e := range envelopes {
+				res = append(res, e.GetTimestamp())
+			}
+			return res
+		}
+
+		get := func(limit int, includeSpilled, descending bool) []int64 {
+			return timestamps(getEnvelopes(s, "a", store.Query{Start: time.Unix(0, 0), End: time.Unix(0, 100), Limit: limit, IncludeSpilled: includeSpilled, Descending: descending}))
+		}
+
+		It("returns pruned envelopes from disk when asked to", func() {
+			s = store.NewStore(10, TruncationInterval, PrunesPerGC, sp, sm, store.WithSpillover(dir, 1<<20))
+			for i := int64(1); i <= 5; i++ {
+				s.Put(buildTypedEnvelope(i, "a", &loggregator_v2.Log{}), "a")
+			}
+
+			sp.SetNumberToPrune(3)
+			Eventually(s.WaitForTruncationToComplete).Should(BeTrue())
+			sp.SetNumberToPrune(0)
+
+			Expect(get(10, false, false)).To(Equal([]int64{4, 5}))
+			Expect(get(10, true, false)).To(Equal([]int64{1, 2, 3, 4, 5}))
+			Expect(get(2, true, false)).To(Equal([]int64{1, 2}))
+			Expect(get(3, true, true)).To(Equal([]int64{5, 4, 3}))
+			Expect(sm.GetMetricValue("log_cache_spilled", nil)).To(Equal(3.0))
+			Expect(sm.GetMetricValue("log_cache_spillover_size", map[string]string{"unit": "bytes"})).To(BeNumerically(">", 0))
+		})
+
+		It("applies filters to spilled envelopes", func() {
+			s = store.NewStore(10, TruncationInterval, PrunesPerGC, sp, sm, store.WithSpillover(dir, 1<<20))
+			s.Put(buildTypedEnvelope(1, "a", &loggregator_v2.Log{}), "a")
+			s.Put(buildTypedEnvelope(2, "a", &loggregator_v2.Counter{}), "a")
+			s.Put(buildTypedEnvelope(3, "a", &loggregator_v2.Log{}), "a")
+
+			sp.SetNumberToPrune(3)
+			Eventually(s.WaitForTruncationToComplete).Should(BeTrue())
+			sp.SetNumberToPrune(0)
+
+			envelopes, _ := s.Get("a", store.Query{Start: time.Unix(0, 0), End: time.Unix(0, 3), EnvelopeTypes: []logcache_v1.EnvelopeType{logcache_v1.EnvelopeType_LOG}, Limit: 10, IncludeSpilled: true})
+			Expect(timestamps(envelopes)).To(Equal([]int64{1}))
+		})
+
+		It("drops the oldest spilled envelopes to stay within the size cap", func() {
+			maxBytes := int64(2000)
+			s = store.NewStore(100, TruncationInterval, PrunesPerGC, sp, sm, store.WithSpillover(dir, maxBytes))
+			for i := int64(1); i <= 50; i++ {
+				e := buildTypedEnvelope(i, "a", &loggregator_v2.Log{})
+				e.GetLog().Payload = bytes.Repeat([]byte("x"), 100)
+				s.Put(e, "a")
+			}
+
+			sp.SetNumberToPrune(50)
+			Eventually(s.WaitForTruncationToComplete).Should(BeTrue())
+			sp.SetNumberToPrune(0)
+
+			entries, err := os.ReadDir(dir)
+			Expect(err).ToNot(HaveOccurred())
+			var size int64
+			for _, entry := range entries {
+				info, err := entry.Info()
+				Expect(err).ToNot(HaveOccurred())
+				size += info.Size()
+			}
+			Expect(size).To(BeNumerically("<=", maxBytes))
+			Expect(sm.GetMetricValue("log_cache_spillover_size", map[string]string{"unit": "bytes"})).To(Equal(float64(size)))
+
+			spilled := get(100, true, false)
+			Expect(spilled).ToNot(BeEmpty())
+			Expect(len(spilled)).To(BeNumerically("<", 50))
+			Expect(spilled).ToNot(ContainElement(int64(1)))
+			Expect(spilled[len(spilled)-1]).To(Equal(int64(50)))
+		})
+
+		It("does not return spilled envelopes of a purged source ID", func() {
+			s = store.NewStore(10, TruncationInterval, PrunesPerGC, sp, sm, store.WithSpillover(dir, 1<<20))
+			s.Put(buildTypedEnvelope(1, "a", &loggregator_v2.Log{}), "a")
+
+			sp.SetNumberToPrune(1)
+			Eventually(s.WaitForTruncationToComplete).Should(BeTrue())
+			sp.SetNumberToPrune(0)
+
+			Expect(get(10, true, false)).To(Equal([]int64{1}))
+			s.Purge("a")
+			Expect(get(10, true, false)).To(BeEmpty())
+		})
+	})
+
+	It("sets the truncation behind gauge when pruning leaves the store above the threshold", func() {
+		s = store.NewStore(10, TruncationInterval, PrunesPerGC, sp, sm, store.WithTruncationBehindThreshold(2))
+
+		for i := int64(0); i < 5; i++ {
+			e := buildTypedEnvelope(i, "a", &loggregator_v2.Log{})
+			s.Put(e, e.GetSourceId())
+		}
+
+		// Prune far fewer envelopes than needed to get under the threshold
+		sp.SetNumberToPrune(1)
+		s.WaitForTruncationToComplete()
+
+		Eventually(func() float64 {
+			return sm.GetMetricValue("log_cache_truncation_behind", nil)
+		}).Should(Equal(1.0))
+
+		// Prune enough to get back under the threshold
+		sp.SetNumberToPrune(3)
+		s.WaitForTruncationToComplete()
+
+		Eventually(func() float64 {
+			return sm.GetMetricValue("log_cache_truncation_behind", nil)
+		}).Should(Equal(0.0))
+	})
+
+	It("only logs when truncation starts and stops falling behind", func() {
+		buf := &syncBuffer{}
+		logger := slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{Level: slog.LevelInfo}))
+		s = store.NewStore(20, TruncationInterval, PrunesPerGC, sp, sm,
+			store.WithTruncationBehindThreshold(2),
+			store.WithLogger(logger),
+		)
+
+		for i := int64(0); i < 20; i++ {
+			e := buildTypedEnvelope(i, "a", &loggregator_v2.Log{})
+			s.Put(e, e.GetSourceId())
+		}
+
+		sp.SetNumberToPrune(1)
+		for i := 0; i < 3; i++ {
+			Eventually(s.WaitForTruncationToComplete).Should(BeTrue())
+		}
+		Expect(strings.Count(buf.String(), "truncation is falling behind")).To(Equal(1))
+
+		sp.SetNumberToPrune(0)
+		Eventually(s.WaitForTruncationToComplete).Should(BeFalse())
+		Expect(strings.Count(buf.String(), "truncation is falling behind")).To(Equal(1))
+		Expect(buf.String()).To(ContainSubstring("truncation caught up"))
+	})
+
+	It("reports pressure while truncation prunes more than the backpressure threshold", func() {
+		s = store.NewStore(10, TruncationInterval, PrunesPerGC, sp, sm, store.WithBackpressureThreshold(0.5))
+		Expect(s.UnderPressure()).To(BeFalse())
+
+		for i := int64(0); i < 10; i++ {
+			e := buildTypedEnvelope(i, "a", &loggregator_v2.Log{})
+			s.Put(e, e.GetSourceId())
+		}
+
+		// Prune less than the threshold
+		sp.SetNumberToPrune(2)
+		Eventually(s.WaitForTruncationToComplete).Should(BeTrue())
+		Expect(s.UnderPressure()).To(BeFalse())
+
+		// Prune more than the threshold
+		sp.SetNumberToPrune(6)
+		Eventually(s.WaitForTruncationToComplete).Should(BeTrue())
+		Expect(s.UnderPressure()).To(BeTrue())
+
+		sp.SetNumberToPrune(0)
+		Eventually(s.WaitForTruncationToComplete).Should(BeFalse())
+		Expect(s.UnderPressure()).To(BeFalse())
+	})
+
+	It("does not report pressure without a backpressure threshold", func() {
+		s = store.NewStore(10, TruncationInterval, PrunesPerGC, sp, sm)
+
+		for i := int64(0); i < 10; i++ {
+			e := buildTypedEnvelope(i, "a", &loggregator_v2.Log{})
+			s.Put(e, e.GetSourceId())
+		}
+
+		sp.SetNumberToPrune(10)
+		Eventually(s.WaitForTruncationToComplete).Should(BeTrue())
+		Expect(s.UnderPressure()).To(BeFalse())
+	})
+
+	It("sets the newest envelope age gauge", func() {
+		s = store.NewStore(10, TruncationInterval, PrunesPerGC, sp, sm)
+
+		e := buildTypedEnvelope(time.Now().Add(-time.Minute).UnixNano(), "a", &loggregator_v2.Log{})
+		s.Put(e, e.GetSourceId())
+		e = buildTypedEnvelope(time.Now().Add(-time.Hour).UnixNano(), "b", &loggregator_v2.Log{})
+		s.Put(e, e.GetSourceId())
+
+		Eventually(func() float64 {
+			return sm.GetMetricValue("log_cache_newest_envelope_age", map[string]string{"unit": "milliseconds"})
+		}, 3).Should(BeNumerically("~", float64(time.Minute/time.Millisecond), 2000))
+	})
+
+	It("does not set the truncation behind gauge without a threshold", func() {
+		s = store.NewStore(10, TruncationInterval, PrunesPerGC, sp, sm)
+
+		for i := int64(0); i < 5; i++ {
+			e := buildTypedEnvelope(i, "a", &loggregator_v2.Log{})
+			s.Put(e, e.GetSourceId())
+		}
+
+		sp.SetNumberToPrune(1)
+		s.WaitForTruncationToComplete()
+
+		Consistently(func() float64 {
+			return sm.GetMetricValue("log_cache_truncation_behind", nil)
+		}).Should(Equal(0.0))
+	})
+
 	It("doesn't call garbage collect if for less than prunes_per_gc consecutive truncations", func() {
 
 		// Set PrunesPerGC to 2
@@ -584,6 +1781,11 @@ var _ = Describe("Store", func() {
 	})
 })
 
+func getEnvelopes(s *store.Store, index string, q store.Query) []*loggregator_v2.Envelope {
+	envelopes, _ := s.Get(index, q)
+	return envelopes
+}
+
 func buildEnvelope(timestamp int64, sourceID string) *loggregator_v2.Envelope {
 	return &loggregator_v2.Envelope{
 		Timestamp: timestamp,
@@ -680,3 +1882,22 @@ func (sp *spyPruner) GetQuantityToPrune(int64) int {
 }
 
 func (sp *spyPruner) SetMemoryReporter(metrics.Gauge) {}
+
+// syncBuffer is a bytes.Buffer that is safe to write to from the
+// truncation loop while a test reads it.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
@@ -0,0 +1,154 @@
+package store
+
+import (
+	"container/heap"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// topIngressCapacity is how many source IDs a TopIngress tracks for each
+// source ID it reports. More tracked source IDs make the counts of the
+// reported ones more accurate.
+const topIngressCapacity = 10
+
+// TopIngress estimates which source IDs had the most envelopes written
+// over an interval. It uses the Space-Saving algorithm, which tracks a
+// fixed number of source IDs no matter how many are written, so a source
+// ID that dominates ingress is always reported while memory stays bounded.
+// All functions are thread safe.
+type TopIngress struct {
+	n int
+
+	mu      sync.Mutex
+	sketch  ingressSketch
+	tracked map[string]*ingressCount
+	report  []SourceIngress
+}
+
+// SourceIngress is the estimated number of envelopes written for a source
+// ID. Count overestimates the actual number by at most Error.
+type SourceIngress struct {
+	SourceID string `json:"source_id"`
+	Count    int64  `json:"count"`
+	Error    int64  `json:"error"`
+}
+
+// NewTopIngress creates a TopIngress that reports the n source IDs with
+// the most ingress.
+func NewTopIngress(n int) *TopIngress {
+	return &TopIngress{
+		n:       n,
+		tracked: make(map[string]*ingressCount),
+	}
+}
+
+// Add counts an envelope written for the source ID.
+func (t *TopIngress) Add(sourceID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if c, ok := t.tracked[sourceID]; ok {
+		c.count++
+		heap.Fix(&t.sketch, c.index)
+		return
+	}
+
+	if len(t.sketch) < t.n*topIngressCapacity {
+		c := &ingressCount{sourceID: sourceID, count: 1}
+		heap.Push(&t.sketch, c)
+		t.tracked[sourceID] = c
+		return
+	}
+
+	// Replace the source ID with the lowest count. Its count is an upper
+	// bound for how many envelopes of the new source ID were missed.
+	c := t.sketch[0]
+	delete(t.tracked, c.sourceID)
+	c.sourceID = sourceID
+	c.err = c.count
+	c.count++
+	heap.Fix(&t.sketch, 0)
+	t.tracked[sourceID] = c
+}
+
+// Rotate ends the current interval. The top source IDs of the interval
+// become the report and counting starts over.
+func (t *TopIngress) Rotate() []SourceIngress {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	report := make([]SourceIngress, 0, len(t.sketch))
+	for _, c := range t.sketch {
+		report = append(report, SourceIngress{SourceID: c.sourceID, Count: c.count, Error: c.err})
+	}
+	sort.Slice(report, func(i, j int) bool {
+		if report[i].Count != report[j].Count {
+			return report[i].Count > report[j].Count
+		}
+		return report[i].SourceID < report[j].SourceID
+	})
+	if len(report) > t.n {
+		report = report[:t.n]
+	}
+
+	t.report = report
+	t.sketch = nil
+	t.tracked = make(map[string]*ingressCount)
+
+	return report
+}
+
+// Report returns the top source IDs of the last interval.
+func (t *TopIngress) Report() []SourceIngress {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.report
+}
+
+// ServeHTTP writes the top source IDs of the last interval as JSON.
+func (t *TopIngress) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	report := t.Report()
+	if report == nil {
+		report = []SourceIngress{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	//nolint:errcheck
+	json.NewEncoder(w).Encode(report)
+}
+
+type ingressCount struct {
+	sourceID string
+	count    int64
+	err      int64
+	index    int
+}
+
+// ingressSketch is a min-heap of the tracked source IDs by count.
+type ingressSketch []*ingressCount
+
+func (s ingressSketch) Len() int           { return len(s) }
+func (s ingressSketch) Less(i, j int) bool { return s[i].count < s[j].count }
+func (s ingressSketch) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+	s[i].index = i
+	s[j].index = j
+}
+
+func (s *ingressSketch) Push(x interface{}) {
+	c := x.(*ingressCount)
+	c.index = len(*s)
+	*s = append(*s, c)
+}
+
+func (s *ingressSketch) Pop() interface{} {
+	old := *s
+	n := len(old)
+	c := old[n-1]
+	*s = old[0 : n-1]
+
+	return c
+}
@@ -0,0 +1,89 @@
+package store_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	"code.cloudfoundry.org/log-cache/internal/cache/store"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("TopIngress", func() {
+	sourceIDs := func(report []store.SourceIngress) []string {
+		var ids []string
+		for _, s := range report {
+			ids = append(ids, s.SourceID)
+		}
+		return ids
+	}
+
+	It("reports a dominant source ID among many others", func() {
+		t := store.NewTopIngress(3)
+
+		// Far more source IDs than are tracked, interleaved with the
+		// dominant one so that it is evicted if the sketch is wrong.
+		for i := 0; i < 5000; i++ {
+			t.Add(fmt.Sprintf("noise-%d", i))
+			if i%4 == 0 {
+				t.Add("dominant")
+			}
+		}
+
+		report := t.Rotate()
+		Expect(report).To(HaveLen(3))
+		Expect(report[0].SourceID).To(Equal("dominant"))
+		Expect(report[0].Count - report[0].Error).To(BeNumerically("<=", 1250))
+		Expect(report[0].Count).To(BeNumerically(">=", 1250))
+	})
+
+	It("orders the report by count", func() {
+		t := store.NewTopIngress(2)
+		for i := 0; i < 3; i++ {
+			t.Add("a")
+		}
+		for i := 0; i < 5; i++ {
+			t.Add("b")
+		}
+		t.Add("c")
+
+		Expect(sourceIDs(t.Rotate())).To(Equal([]string{"b", "a"}))
+	})
+
+	It("starts counting over every interval", func() {
+		t := store.NewTopIngress(2)
+		t.Add("a")
+		Expect(sourceIDs(t.Rotate())).To(Equal([]string{"a"}))
+
+		t.Add("b")
+		Expect(sourceIDs(t.Report())).To(Equal([]string{"a"}))
+		Expect(sourceIDs(t.Rotate())).To(Equal([]string{"b"}))
+	})
+
+	It("serves the last report as JSON", func() {
+		t := store.NewTopIngress(2)
+		t.Add("a")
+		t.Rotate()
+
+		rec := httptest.NewRecorder()
+		t.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/top-ingress", nil))
+
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		var report []store.SourceIngress
+		Expect(json.Unmarshal(rec.Body.Bytes(), &report)).To(Succeed())
+		Expect(report).To(Equal([]store.SourceIngress{{SourceID: "a", Count: 1}}))
+	})
+
+	It("counts envelopes written to a store", func() {
+		t := store.NewTopIngress(1)
+		s := store.NewStore(10, TruncationInterval, PrunesPerGC, newSpyPruner(), nopMetrics{}, store.WithTopIngress(t))
+		s.Put(buildEnvelope(1, "a"), "a")
+		s.Put(buildEnvelope(2, "a"), "a")
+		s.Put(buildEnvelope(3, "b"), "b")
+
+		Expect(t.Rotate()).To(Equal([]store.SourceIngress{{SourceID: "a", Count: 2}}))
+	})
+})
@@ -0,0 +1,100 @@
+package cache
+
+import (
+	"log/slog"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"code.cloudfoundry.org/go-log-cache/v3/rpc/logcache_v1"
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+)
+
+const warmupReadLimit = 1000
+
+// Warmer seeds an empty store with recent envelopes read from a replica so
+// that a restarted node does not serve empty reads while it refills.
+type Warmer struct {
+	peers  []logcache_v1.EgressClient
+	owns   func(sourceID string) bool
+	put    func(e *loggregator_v2.Envelope, sourceID string)
+	window time.Duration
+	log    *slog.Logger
+}
+
+// NewWarmer creates a new Warmer. Only source IDs for which owns returns true
+// are copied, and each envelope is written with put.
+func NewWarmer(
+	peers []logcache_v1.EgressClient,
+	owns func(sourceID string) bool,
+	put func(e *loggregator_v2.Envelope, sourceID string),
+	window time.Duration,
+	log *slog.Logger,
+) *Warmer {
+	return &Warmer{
+		peers:  peers,
+		owns:   owns,
+		put:    put,
+		window: window,
+		log:    log,
+	}
+}
+
+// Warm copies envelopes newer than the window from the first peer that
+// answers. It returns the number of envelopes written.
+func (w *Warmer) Warm(ctx context.Context) int {
+	for _, peer := range w.peers {
+		meta, err := peer.Meta(ctx, &logcache_v1.MetaRequest{})
+		if err != nil {
+			w.log.Error("failed to read meta from warmup peer", "error", err)
+			continue
+		}
+
+		var total int
+		for sourceID := range meta.GetMeta() {
+			if !w.owns(sourceID) {
+				continue
+			}
+
+			n, err := w.warmSource(ctx, peer, sourceID)
+			total += n
+			if err != nil {
+				w.log.Error("failed to warm source", "source_id", sourceID, "error", err)
+			}
+		}
+
+		return total
+	}
+
+	return 0
+}
+
+func (w *Warmer) warmSource(ctx context.Context, peer logcache_v1.EgressClient, sourceID string) (int, error) {
+	end := time.Now().UnixNano()
+	start := end - w.window.Nanoseconds()
+
+	var total int
+	for {
+		resp, err := peer.Read(ctx, &logcache_v1.ReadRequest{
+			SourceId:   sourceID,
+			StartTime:  start,
+			EndTime:    end,
+			Limit:      warmupReadLimit,
+			Descending: true,
+		})
+		if err != nil {
+			return total, err
+		}
+
+		batch := resp.GetEnvelopes().GetBatch()
+		for _, e := range batch {
+			w.put(e, sourceID)
+		}
+		total += len(batch)
+
+		if len(batch) < warmupReadLimit {
+			return total, nil
+		}
+		end = batch[len(batch)-1].GetTimestamp()
+	}
+}
@@ -1,5 +1,14 @@
 package config
 
+import (
+	"fmt"
+	"log"
+	"net"
+
+	metrics "code.cloudfoundry.org/go-metric-registry"
+	"code.cloudfoundry.org/tlsconfig"
+)
+
 // MetricsServer stores the configuration for the metrics server
 type MetricsServer struct {
 	Port         uint16 `env:"METRICS_PORT, report"`
@@ -8,4 +17,54 @@ type MetricsServer struct {
 	KeyFile      string `env:"METRICS_KEY_FILE_PATH, report"`
 	DebugMetrics bool   `env:"DEBUG_METRICS, report"`
 	PprofPort    uint16 `env:"PPROF_PORT, report"`
+
+	// FatalOnBindFailure makes a metrics server that cannot be started
+	// stop the process instead of only being logged.
+	FatalOnBindFailure bool `env:"METRICS_FATAL_ON_BIND_FAILURE, report"`
+}
+
+// NewRegistry creates a metrics registry that serves its metrics on the
+// configured port, over mutual TLS when a CA is configured. If the server
+// cannot be started the error says why, and the registry is still
+// returned without a server so that the metrics can be recorded.
+func (c MetricsServer) NewRegistry(logger *log.Logger) (*metrics.Registry, error) {
+	if err := c.check(); err != nil {
+		return metrics.NewRegistry(logger), err
+	}
+
+	if c.CAFile == "" {
+		return metrics.NewRegistry(logger, metrics.WithPublicServer(int(c.Port))), nil
+	}
+
+	return metrics.NewRegistry(
+		logger,
+		metrics.WithTLSServer(int(c.Port), c.CertFile, c.KeyFile, c.CAFile),
+	), nil
+}
+
+// check reports whether the registry would fail to start the server. The
+// registry exits the process on such failures itself, so they have to be
+// caught beforehand.
+func (c MetricsServer) check() error {
+	addr := fmt.Sprintf("0.0.0.0:%d", c.Port)
+	if c.CAFile != "" {
+		addr = fmt.Sprintf("127.0.0.1:%d", c.Port)
+
+		_, err := tlsconfig.Build(
+			tlsconfig.WithInternalServiceDefaults(),
+			tlsconfig.WithIdentityFromFile(c.CertFile, c.KeyFile),
+		).Server(
+			tlsconfig.WithClientAuthenticationFromFile(c.CAFile),
+		)
+		if err != nil {
+			return fmt.Errorf("invalid metrics server TLS config: %w", err)
+		}
+	}
+
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("unable to bind metrics server to %s: %w", addr, err)
+	}
+
+	return lis.Close()
 }
@@ -0,0 +1,49 @@
+package config_test
+
+import (
+	"io"
+	"log"
+	"net"
+
+	"code.cloudfoundry.org/log-cache/internal/config"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("MetricsServer", func() {
+	var logger *log.Logger
+
+	BeforeEach(func() {
+		logger = log.New(io.Discard, "", 0)
+	})
+
+	It("starts the metrics server", func() {
+		m, err := config.MetricsServer{}.NewRegistry(logger)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(m.Port()).ToNot(BeEmpty())
+	})
+
+	It("reports a port that is already bound", func() {
+		lis, err := net.Listen("tcp", "0.0.0.0:0")
+		Expect(err).ToNot(HaveOccurred())
+		defer lis.Close()
+		port := lis.Addr().(*net.TCPAddr).Port
+
+		m, err := config.MetricsServer{Port: uint16(port)}.NewRegistry(logger)
+		Expect(err).To(MatchError(ContainSubstring("unable to bind metrics server")))
+
+		By("still returning a registry to record metrics with")
+		Expect(m).ToNot(BeNil())
+		m.NewCounter("some_counter", "some help").Add(1)
+	})
+
+	It("reports an invalid TLS config", func() {
+		_, err := config.MetricsServer{
+			CAFile:   "/does/not/exist/ca.crt",
+			CertFile: "/does/not/exist/metrics.crt",
+			KeyFile:  "/does/not/exist/metrics.key",
+		}.NewRegistry(logger)
+		Expect(err).To(MatchError(ContainSubstring("invalid metrics server TLS config")))
+	})
+})
@@ -3,7 +3,7 @@ package end2end_test
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"time"
 
 	metrics "code.cloudfoundry.org/go-metric-registry"
@@ -40,8 +40,8 @@ var _ = Describe("LogCache", func() {
 			fmt.Sprintf("127.0.0.1:%d", 10000+(run*runIncBy)),
 		}
 
-		logger := log.New(GinkgoWriter, "", 0)
-		m := metrics.NewRegistry(logger)
+		logger := slog.New(slog.NewTextHandler(GinkgoWriter, nil))
+		m := metrics.NewRegistry(slog.NewLogLogger(logger.Handler(), slog.LevelInfo))
 		node1 = cache.New(
 			m,
 			logger,
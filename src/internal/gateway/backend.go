@@ -0,0 +1,114 @@
+package gateway
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+)
+
+// backendConn is the gRPC connection to Log Cache. It can replace its
+// underlying connection with a freshly dialed one, e.g. when the node it
+// is connected to was removed from the cluster, instead of leaving gRPC to
+// retry it with an ever longer backoff.
+type backendConn struct {
+	addr     string
+	dialOpts []grpc.DialOption
+	log      *log.Logger
+
+	mu   sync.RWMutex
+	conn *grpc.ClientConn
+}
+
+func newBackendConn(addr string, dialOpts []grpc.DialOption, log *log.Logger) (*backendConn, error) {
+	conn, err := grpc.NewClient(addr, dialOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &backendConn{
+		addr:     addr,
+		dialOpts: dialOpts,
+		log:      log,
+		conn:     conn,
+	}, nil
+}
+
+// Invoke implements grpc.ClientConnInterface.
+func (b *backendConn) Invoke(ctx context.Context, method string, args, reply interface{}, opts ...grpc.CallOption) error {
+	return b.current().Invoke(ctx, method, args, reply, opts...)
+}
+
+// NewStream implements grpc.ClientConnInterface.
+func (b *backendConn) NewStream(ctx context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	return b.current().NewStream(ctx, desc, method, opts...)
+}
+
+func (b *backendConn) current() *grpc.ClientConn {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.conn
+}
+
+// healthCheck checks the connection every interval and redials it once it
+// has failed failureThreshold checks in a row. It never returns.
+func (b *backendConn) healthCheck(interval time.Duration, failureThreshold int) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	var failures int
+	for range t.C {
+		if b.healthy() {
+			failures = 0
+			continue
+		}
+
+		failures++
+		if failures < failureThreshold {
+			continue
+		}
+
+		b.log.Printf("redialing Log Cache at %s after %d failed health checks", b.addr, failures)
+		failures = 0
+		b.redial()
+	}
+}
+
+// healthy reports whether the connection is connected or idle. An idle
+// connection is asked to connect so that the next check tells whether it
+// can.
+func (b *backendConn) healthy() bool {
+	conn := b.current()
+	switch conn.GetState() {
+	case connectivity.Ready:
+		return true
+	case connectivity.Idle:
+		conn.Connect()
+		return true
+	default:
+		return false
+	}
+}
+
+// redial replaces the connection with a new one and closes the old one.
+func (b *backendConn) redial() {
+	conn, err := grpc.NewClient(b.addr, b.dialOpts...)
+	if err != nil {
+		b.log.Printf("failed to redial Log Cache: %s", err)
+		return
+	}
+	conn.Connect()
+
+	b.mu.Lock()
+	old := b.conn
+	b.conn = conn
+	b.mu.Unlock()
+
+	if err := old.Close(); err != nil {
+		b.log.Printf("failed to close Log Cache connection: %s", err)
+	}
+}
@@ -0,0 +1,69 @@
+package gateway
+
+import (
+	"net/http"
+	"strings"
+)
+
+// corsMaxAge is how long, in seconds, browsers may cache a preflight
+// response.
+const corsMaxAge = "600"
+
+// cors adds CORS headers to the read and query endpoints for requests
+// from an allowed origin and answers their OPTIONS preflight requests.
+// Preflight requests from other origins are rejected with a 403; other
+// requests from them are served without CORS headers, so browsers do not
+// expose the response.
+func (g *Gateway) cors(next http.Handler) http.Handler {
+	if len(g.corsOrigins) == 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" || !isCORSPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		w.Header().Add("Vary", "Origin")
+		if !g.corsOriginAllowed(origin) {
+			if preflight {
+				http.Error(w, "origin not allowed", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		if !preflight {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+		w.Header().Add("Vary", "Access-Control-Request-Headers")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+		if headers := r.Header.Get("Access-Control-Request-Headers"); headers != "" {
+			w.Header().Set("Access-Control-Allow-Headers", headers)
+		}
+		w.Header().Set("Access-Control-Max-Age", corsMaxAge)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func (g *Gateway) corsOriginAllowed(origin string) bool {
+	for _, o := range g.corsOrigins {
+		if o == "*" || strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isCORSPath(path string) bool {
+	return strings.HasPrefix(path, "/api/v1/read/") || isQueryPath(path)
+}
@@ -1,21 +1,33 @@
 package gateway
 
 import (
+	"crypto/tls"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
 	"github.com/shirou/gopsutil/v4/host"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/encoding/protojson"
 
+	logcache "code.cloudfoundry.org/go-log-cache/v3"
 	"code.cloudfoundry.org/go-log-cache/v3/rpc/logcache_v1"
+	"code.cloudfoundry.org/log-cache/internal/plumbing"
+	"code.cloudfoundry.org/log-cache/internal/promql"
+	"code.cloudfoundry.org/log-cache/internal/promql/data_reader"
+	lctls "code.cloudfoundry.org/log-cache/internal/tls"
+	logcacheclient "code.cloudfoundry.org/log-cache/pkg/client"
 	logcacheMarshaler "code.cloudfoundry.org/log-cache/pkg/marshaler"
 )
 
@@ -31,8 +43,24 @@ type Gateway struct {
 	lis              net.Listener
 	blockOnStart     bool
 	logCacheDialOpts []grpc.DialOption
+	compression      bool
 	certPath         string
 	keyPath          string
+
+	querySlots         chan struct{}
+	queryTimeout       time.Duration
+	maxPointsPerSeries int
+
+	defaultReadLookback time.Duration
+
+	corsOrigins []string
+
+	healthCheckInterval      time.Duration
+	healthCheckFailThreshold int
+
+	httpMetrics *httpMetrics
+
+	writeEnabled bool
 }
 
 // NewGateway creates a new Gateway. It will listen on the gatewayAddr and
@@ -81,6 +109,15 @@ func WithGatewayLogCacheDialOpts(opts ...grpc.DialOption) GatewayOption {
 	}
 }
 
+// WithGatewayCompression returns a GatewayOption that gzips the requests
+// to Log Cache, which makes Log Cache gzip its responses as well. It
+// defaults to no compression.
+func WithGatewayCompression() GatewayOption {
+	return func(g *Gateway) {
+		g.compression = true
+	}
+}
+
 // WithGatewayVersion returns a GatewayOption that sets the log-cache
 // version returned by the info endpoint.
 func WithGatewayVersion(version string) GatewayOption {
@@ -97,6 +134,9 @@ func WithGatewayVMUptimeFn(uptimeFn func() int64) GatewayOption {
 	}
 }
 
+// WithGatewayTLSServer returns a GatewayOption that serves HTTPS with the
+// certificate and key at the given paths. The files are reloaded when they
+// change, so rotated certificates are used without a restart.
 func WithGatewayTLSServer(certPath, keyPath string) GatewayOption {
 	return func(g *Gateway) {
 		g.keyPath = keyPath
@@ -104,6 +144,84 @@ func WithGatewayTLSServer(certPath, keyPath string) GatewayOption {
 	}
 }
 
+// WithGatewayMaxConcurrentQueries returns a GatewayOption that limits the
+// number of PromQL queries served at once. Queries beyond the limit are
+// rejected with a 429. It defaults to no limit.
+func WithGatewayMaxConcurrentQueries(n int) GatewayOption {
+	return func(g *Gateway) {
+		if n > 0 {
+			g.querySlots = make(chan struct{}, n)
+		}
+	}
+}
+
+// WithGatewayQueryTimeout returns a GatewayOption that sets the PromQL
+// query timeout of Log Cache, which the info endpoint reports. It does not
+// change the timeout. It defaults to 0, which is not reported.
+func WithGatewayQueryTimeout(d time.Duration) GatewayOption {
+	return func(g *Gateway) {
+		g.queryTimeout = d
+	}
+}
+
+// WithGatewayMaxPointsPerSeries returns a GatewayOption that rejects range
+// queries whose range divided by their step exceeds n with a 400 before
+// they are sent to Log Cache. It defaults to 0 (no limit).
+func WithGatewayMaxPointsPerSeries(n int) GatewayOption {
+	return func(g *Gateway) {
+		g.maxPointsPerSeries = n
+	}
+}
+
+// WithGatewayDefaultReadLookback returns a GatewayOption that makes a Read
+// without a start_time return the last d of data instead of everything
+// since the beginning of the cache. It defaults to 0 (disabled).
+func WithGatewayDefaultReadLookback(d time.Duration) GatewayOption {
+	return func(g *Gateway) {
+		g.defaultReadLookback = d
+	}
+}
+
+// WithGatewayCORS returns a GatewayOption that lets browsers on the given
+// origins call the read and query endpoints by adding CORS headers and
+// answering preflight requests. An origin of "*" allows every origin. It
+// defaults to no CORS headers.
+func WithGatewayCORS(allowedOrigins []string) GatewayOption {
+	return func(g *Gateway) {
+		g.corsOrigins = allowedOrigins
+	}
+}
+
+// WithGatewayBackendHealthCheck returns a GatewayOption that checks the
+// connection to Log Cache every interval and redials it after
+// failureThreshold failed checks in a row. A connection that is neither
+// connected nor idle fails a check. It defaults to no health checks.
+func WithGatewayBackendHealthCheck(interval time.Duration, failureThreshold int) GatewayOption {
+	return func(g *Gateway) {
+		g.healthCheckInterval = interval
+		g.healthCheckFailThreshold = failureThreshold
+	}
+}
+
+// WithGatewayHTTPMetrics returns a GatewayOption that records the duration
+// and status code of read, meta, query and query_range requests in m. It
+// defaults to no HTTP metrics.
+func WithGatewayHTTPMetrics(m MetricsRegistry) GatewayOption {
+	return func(g *Gateway) {
+		g.httpMetrics = newHTTPMetrics(m)
+	}
+}
+
+// WithGatewayWrite returns a GatewayOption that serves /api/v1/write, which
+// sends the envelopes of a posted SendRequest to Log Cache. The gateway does
+// not authenticate writes itself, so it must only be reachable through a
+// proxy that does. It defaults to no write endpoint.
+func WithGatewayWrite() GatewayOption {
+	return func(g *Gateway) {
+		g.writeEnabled = true
+	}
+}
+
 // Start starts the gateway to start receiving and forwarding requests. It
 // does not block unless WithGatewayBlock was set.
 func (g *Gateway) Start() {
@@ -133,18 +251,28 @@ func (g *Gateway) listenAndServe() {
 		runtime.WithMarshalerOption(
 			runtime.MIMEWildcard, logcacheMarshaler.NewPromqlMarshaler(&runtime.JSONPb{MarshalOptions: protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true}}),
 		),
+		runtime.WithMarshalerOption(protobufMIME, &protobufMarshaler{}),
 		runtime.WithErrorHandler(g.httpErrorHandler),
 	)
 
-	conn, err := grpc.NewClient(g.logCacheAddr, g.logCacheDialOpts...)
+	dialOpts := g.logCacheDialOpts
+	if g.compression {
+		dialOpts = append(slices.Clip(dialOpts), grpc.WithDefaultCallOptions(grpc.UseCompressor(plumbing.GzipCompressor)))
+	}
+
+	conn, err := newBackendConn(g.logCacheAddr, dialOpts, g.log)
 	if err != nil {
 		g.log.Fatalf("failed to dial Log Cache: %s", err)
 	}
+	if g.healthCheckInterval > 0 {
+		go conn.healthCheck(g.healthCheckInterval, g.healthCheckFailThreshold)
+	}
 
+	egressClient := logcache_v1.NewEgressClient(conn)
 	err = logcache_v1.RegisterEgressHandlerClient(
 		context.Background(),
 		mux,
-		logcache_v1.NewEgressClient(conn),
+		egressClient,
 	)
 	if err != nil {
 		g.log.Fatalf("failed to register LogCache handler: %s", err)
@@ -160,15 +288,37 @@ func (g *Gateway) listenAndServe() {
 	}
 
 	topLevelMux := http.NewServeMux()
+	seriesReader := data_reader.NewWalkingDataReader(
+		logcache.NewClient(g.logCacheAddr, logcache.WithViaGRPC(dialOpts...)).Read,
+	)
+
 	topLevelMux.HandleFunc("/api/v1/info", g.handleInfoEndpoint)
-	topLevelMux.Handle("/", mux)
+	if g.writeEnabled {
+		topLevelMux.Handle("/api/v1/write", g.handleWrite(logcache_v1.NewIngressClient(conn), mux))
+	}
+	topLevelMux.Handle("/api/v1/series", g.limitQueries(g.handleSeries(seriesReader)))
+	topLevelMux.Handle("/", g.limitRangePoints(g.limitQueries(g.defaultStartTime(readFilters(g.ndjsonReads(egressClient, mux, g.metaWithRetention(egressClient, mux, mux)))))))
+
+	var handler http.Handler = g.cors(topLevelMux)
+	if g.httpMetrics != nil {
+		handler = g.httpMetrics.middleware(handler)
+	}
 
 	server := &http.Server{
-		Handler:           topLevelMux,
+		Handler:           handler,
 		ReadHeaderTimeout: 2 * time.Second,
 	}
 	if g.certPath != "" || g.keyPath != "" {
-		if err := server.ServeTLS(g.lis, g.certPath, g.keyPath); err != nil {
+		reloader, err := lctls.NewCertReloader(g.certPath, g.keyPath, g.log)
+		if err != nil {
+			g.log.Fatalf("failed to load TLS certificate: %s", err)
+		}
+		server.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: reloader.GetCertificate,
+		}
+
+		if err := server.ServeTLS(g.lis, "", ""); err != nil {
 			g.log.Fatalf("failed to serve HTTPS endpoint: %s", err)
 		}
 	} else {
@@ -178,9 +328,178 @@ func (g *Gateway) listenAndServe() {
 	}
 }
 
+func (g *Gateway) limitQueries(next http.Handler) http.Handler {
+	if g.querySlots == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isQueryPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		select {
+		case g.querySlots <- struct{}{}:
+			defer func() { <-g.querySlots }()
+			next.ServeHTTP(w, r)
+		default:
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "too many concurrent queries", http.StatusTooManyRequests)
+		}
+	})
+}
+
+// limitRangePoints rejects range queries that would return more than
+// maxPointsPerSeries points for a series. Requests whose start, end or step
+// can not be parsed are passed on so that Log Cache reports the error.
+func (g *Gateway) limitRangePoints(next http.Handler) http.Handler {
+	if g.maxPointsPerSeries <= 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/query_range" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		q := r.URL.Query()
+		start, err := promql.ParseTime(q.Get("start"))
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		end, err := promql.ParseTime(q.Get("end"))
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		step, err := promql.ParseStep(q.Get("step"))
+		if err != nil || step <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if end.Sub(start)/step > time.Duration(g.maxPointsPerSeries) {
+			g.writeSeriesError(w, http.StatusBadRequest, fmt.Errorf(
+				"exceeded maximum resolution of %d points per timeseries. Try decreasing the query resolution (?step=XX)",
+				g.maxPointsPerSeries,
+			))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (g *Gateway) defaultStartTime(next http.Handler) http.Handler {
+	if g.defaultReadLookback <= 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/v1/read/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		q := r.URL.Query()
+		if q.Get("start_time") == "" {
+			q.Set("start_time", strconv.FormatInt(time.Now().Add(-g.defaultReadLookback).UnixNano(), 10))
+			r.URL.RawQuery = q.Encode()
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// logCacheMetadataHeaderPrefix is the lower case prefix of the headers that
+// grpc-gateway passes to Log Cache as metadata with a log-cache- key.
+var logCacheMetadataHeaderPrefix = strings.ToLower(runtime.MetadataHeaderPrefix) + "log-cache-"
+
+// readFilterParams maps the Read filter query parameters to the gRPC
+// metadata keys that carry them.
+var readFilterParams = logcacheclient.ReadParamMetadata()
+
+// readFilters moves the Read filter query parameters, such as tag_filter or
+// cursor, into gRPC metadata because the ReadRequest has no field for them. Log Cache
+// metadata set by the client as Grpc-Metadata headers is dropped from every
+// request first, so that clients can not set metadata such as the local
+// only mark of the nodes.
+func readFilters(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for k := range r.Header {
+			if strings.HasPrefix(strings.ToLower(k), logCacheMetadataHeaderPrefix) {
+				r.Header.Del(k)
+			}
+		}
+
+		if !strings.HasPrefix(r.URL.Path, "/api/v1/read/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		q := r.URL.Query()
+		var moved bool
+		for param, key := range readFilterParams {
+			for _, f := range q[param] {
+				r.Header.Add(runtime.MetadataHeaderPrefix+key, f)
+				moved = true
+			}
+			q.Del(param)
+		}
+		if moved {
+			r.URL.RawQuery = q.Encode()
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func isQueryPath(path string) bool {
+	return path == "/api/v1/query" || path == "/api/v1/query_range" || path == "/api/v1/series"
+}
+
+type info struct {
+	Version  string `json:"version"`
+	VMUptime string `json:"vm_uptime"`
+
+	PromQLLimits promQLLimits `json:"promql_limits"`
+}
+
+// promQLLimits are the limits PromQL queries run under, so that clients can
+// keep their queries within them.
+type promQLLimits struct {
+	MaxSamples    int `json:"max_samples"`
+	MaxConcurrent int `json:"max_concurrent"`
+
+	// MaxConcurrentQueries is the number of queries the gateway serves at
+	// once. 0 means no limit.
+	MaxConcurrentQueries int `json:"max_concurrent_queries"`
+
+	// MaxPointsPerSeries is the number of points a range query may return
+	// for a series. 0 means no limit.
+	MaxPointsPerSeries int    `json:"max_points_per_series"`
+	QueryTimeout       string `json:"query_timeout,omitempty"`
+}
+
 func (g *Gateway) handleInfoEndpoint(w http.ResponseWriter, r *http.Request) {
-	_, err := w.Write([]byte(fmt.Sprintf(`{"version":"%s","vm_uptime":"%d"}`+"\n", g.logCacheVersion, g.uptimeFn())))
-	if err != nil {
+	body := info{
+		Version:  g.logCacheVersion,
+		VMUptime: strconv.FormatInt(g.uptimeFn(), 10),
+		PromQLLimits: promQLLimits{
+			MaxSamples:           promql.EngineMaxSamples,
+			MaxConcurrent:        promql.EngineMaxConcurrent,
+			MaxConcurrentQueries: cap(g.querySlots),
+			MaxPointsPerSeries:   g.maxPointsPerSeries,
+		},
+	}
+	if g.queryTimeout > 0 {
+		body.PromQLLimits.QueryTimeout = g.queryTimeout.String()
+	}
+
+	if err := json.NewEncoder(w).Encode(body); err != nil {
 		g.log.Println("Cannot send result for the info endpoint")
 	}
 }
@@ -190,6 +509,18 @@ func uptimeInSeconds() int64 {
 	return int64(hostStats.Uptime) //#nosec G115
 }
 
+const protobufMIME = "application/x-protobuf"
+
+// protobufMarshaler serializes responses as binary protobuf for clients that
+// send an Accept header of application/x-protobuf.
+type protobufMarshaler struct {
+	runtime.ProtoMarshaller
+}
+
+func (*protobufMarshaler) ContentType(_ interface{}) string {
+	return protobufMIME
+}
+
 type errorBody struct {
 	Status    string `json:"status"`
 	ErrorType string `json:"errorType"`
@@ -204,7 +535,7 @@ func (g *Gateway) httpErrorHandler(
 	r *http.Request,
 	err error,
 ) {
-	if r.URL.Path != "/api/v1/query" && r.URL.Path != "/api/v1/query_range" {
+	if !isQueryPath(r.URL.Path) {
 		runtime.DefaultHTTPErrorHandler(ctx, mux, marshaler, w, r, err)
 		return
 	}
@@ -214,10 +545,12 @@ func (g *Gateway) httpErrorHandler(
 	w.Header().Del("Trailer")
 	w.Header().Set("Content-Type", marshaler.ContentType(nil))
 
+	st := status.Convert(err)
+	errorType, code := prometheusError(st.Code())
 	body := &errorBody{
 		Status:    "error",
-		ErrorType: "internal",
-		Error:     status.Convert(err).Message(),
+		ErrorType: errorType,
+		Error:     st.Message(),
 	}
 
 	buf, merr := marshaler.Marshal(body)
@@ -230,8 +563,32 @@ func (g *Gateway) httpErrorHandler(
 		return
 	}
 
-	w.WriteHeader(runtime.HTTPStatusFromCode(status.Code(err)))
+	w.WriteHeader(code)
 	if _, err := w.Write(buf); err != nil {
 		g.log.Printf("Failed to write response: %v", err)
 	}
 }
+
+// statusClientClosedRequest is the non-standard status Prometheus uses for
+// canceled queries.
+const statusClientClosedRequest = 499
+
+// prometheusError returns the Prometheus API error type and HTTP status for
+// a gRPC code returned by a PromQL query. Codes without a Prometheus
+// equivalent are reported as internal errors with grpc-gateway's status.
+func prometheusError(c codes.Code) (string, int) {
+	switch c {
+	case codes.InvalidArgument:
+		return "bad_data", http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return "timeout", http.StatusServiceUnavailable
+	case codes.Canceled:
+		return "canceled", statusClientClosedRequest
+	case codes.Aborted:
+		return "execution", http.StatusUnprocessableEntity
+	case codes.Unavailable:
+		return "unavailable", http.StatusServiceUnavailable
+	default:
+		return "internal", runtime.HTTPStatusFromCode(c)
+	}
+}
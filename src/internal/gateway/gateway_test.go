@@ -1,18 +1,34 @@
 package gateway_test
 
 import (
+	"bytes"
+	"context"
 	"crypto/tls"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	rpc "code.cloudfoundry.org/go-log-cache/v3/rpc/logcache_v1"
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	"code.cloudfoundry.org/go-metric-registry/testhelpers"
 	. "code.cloudfoundry.org/log-cache/internal/gateway"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
 
 	"code.cloudfoundry.org/log-cache/internal/testing"
 	. "github.com/onsi/ginkgo/v2"
@@ -87,6 +103,416 @@ var _ = Describe("Gateway", func() {
 		Entry("with dash", "some-source-id", "some-source-id"),
 	)
 
+	It("serves rotated certificates without a restart", func() {
+		certs := testing.GenerateCerts("localhost-ca")
+		dir := GinkgoT().TempDir()
+		certPath := filepath.Join(dir, "gateway.crt")
+		keyPath := filepath.Join(dir, "gateway.key")
+		install := func(commonName string, mod time.Time) {
+			for src, dst := range map[string]string{certs.Cert(commonName): certPath, certs.Key(commonName): keyPath} {
+				b, err := os.ReadFile(src)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(os.WriteFile(dst, b, 0600)).To(Succeed())
+				Expect(os.Chtimes(dst, mod, mod)).To(Succeed())
+			}
+		}
+		install("localhost", time.Now().Add(-time.Minute))
+
+		spyLogCache := testing.NewSpyLogCache(nil)
+		gw := NewGateway(
+			spyLogCache.Start(),
+			"localhost:0",
+			WithGatewayTLSServer(certPath, keyPath),
+			WithGatewayLogCacheDialOpts(grpc.WithTransportCredentials(insecure.NewCredentials())),
+			WithGatewayVersion("1.2.3"),
+			WithGatewayVMUptimeFn(testing.StubUptimeFn),
+		)
+		gw.Start()
+
+		servedCommonName := func() string {
+			resp, err := makeTLSReq(gw.Addr() + "/api/v1/info")
+			Expect(err).ToNot(HaveOccurred())
+			defer resp.Body.Close()
+			return resp.TLS.PeerCertificates[0].Subject.CommonName
+		}
+		Expect(servedCommonName()).To(Equal("localhost"))
+
+		install("rotated.localhost", time.Now())
+		Expect(servedCommonName()).To(Equal("rotated.localhost"))
+	})
+
+	It("passes tag filters to LogCache as metadata", func() {
+		gw, spyLogCache := tlsGatewayTestSetup()
+		URL := fmt.Sprintf("%s/api/v1/read/some-source-id?start_time=99&tag_filter=deployment:%%5Ecf%%24&tag_filter=job:router", gw.Addr())
+
+		resp, err := makeTLSReq(URL)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+		reqs := spyLogCache.GetReadRequests()
+		Expect(reqs).To(HaveLen(1))
+		Expect(reqs[0].StartTime).To(Equal(int64(99)))
+
+		md := spyLogCache.GetReadMetadata()
+		Expect(md).To(HaveLen(1))
+		Expect(md[0].Get("log-cache-tag-filter")).To(ConsistOf("deployment:^cf$", "job:router"))
+	})
+
+	It("drops Log Cache metadata set by the client", func() {
+		gw, spyLogCache := tlsGatewayTestSetup()
+		URL := fmt.Sprintf("%s/api/v1/read/some-source-id?start_time=99&tag_filter=job:router", gw.Addr())
+
+		resp, err := makeTLSReq(URL,
+			"Grpc-Metadata-log-cache-local-only", "x",
+			"Grpc-Metadata-Log-Cache-Tag-Filter", "deployment:cf",
+			"Grpc-Metadata-other", "kept",
+		)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+		md := spyLogCache.GetReadMetadata()
+		Expect(md).To(HaveLen(1))
+		Expect(md[0].Get("log-cache-local-only")).To(BeEmpty())
+		Expect(md[0].Get("log-cache-tag-filter")).To(ConsistOf("job:router"))
+		Expect(md[0].Get("other")).To(ConsistOf("kept"))
+	})
+
+	It("passes the has tags filter to LogCache as metadata", func() {
+		gw, spyLogCache := tlsGatewayTestSetup()
+		URL := fmt.Sprintf("%s/api/v1/read/some-source-id?start_time=99&has_tags=trace_id,span_id", gw.Addr())
+
+		resp, err := makeTLSReq(URL)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+		md := spyLogCache.GetReadMetadata()
+		Expect(md).To(HaveLen(1))
+		Expect(md[0].Get("log-cache-has-tags")).To(ConsistOf("trace_id,span_id"))
+	})
+
+	It("passes the unit filter to LogCache as metadata", func() {
+		gw, spyLogCache := tlsGatewayTestSetup()
+		URL := fmt.Sprintf("%s/api/v1/read/some-source-id?start_time=99&unit_filter=bytes", gw.Addr())
+
+		resp, err := makeTLSReq(URL)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+		md := spyLogCache.GetReadMetadata()
+		Expect(md).To(HaveLen(1))
+		Expect(md[0].Get("log-cache-unit-filter")).To(ConsistOf("bytes"))
+	})
+
+	It("passes the limit per type to LogCache as metadata", func() {
+		gw, spyLogCache := tlsGatewayTestSetup()
+		URL := fmt.Sprintf("%s/api/v1/read/some-source-id?envelope_types=LOG&envelope_types=COUNTER&limit=5&limit_per_type=true", gw.Addr())
+
+		resp, err := makeTLSReq(URL)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+		reqs := spyLogCache.GetReadRequests()
+		Expect(reqs).To(HaveLen(1))
+		Expect(reqs[0].Limit).To(Equal(int64(5)))
+
+		md := spyLogCache.GetReadMetadata()
+		Expect(md).To(HaveLen(1))
+		Expect(md[0].Get("log-cache-limit-per-type")).To(ConsistOf("true"))
+	})
+
+	It("passes the minimum severity to LogCache as metadata", func() {
+		gw, spyLogCache := tlsGatewayTestSetup()
+		URL := fmt.Sprintf("%s/api/v1/read/some-source-id?envelope_types=EVENT&min_severity=warning", gw.Addr())
+
+		resp, err := makeTLSReq(URL)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+		md := spyLogCache.GetReadMetadata()
+		Expect(md).To(HaveLen(1))
+		Expect(md[0].Get("log-cache-min-severity")).To(ConsistOf("warning"))
+	})
+
+	It("passes the counter rate option to LogCache as metadata", func() {
+		gw, spyLogCache := tlsGatewayTestSetup()
+		URL := fmt.Sprintf("%s/api/v1/read/some-source-id?envelope_types=COUNTER&counter_rate=true", gw.Addr())
+
+		resp, err := makeTLSReq(URL)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+		md := spyLogCache.GetReadMetadata()
+		Expect(md).To(HaveLen(1))
+		Expect(md[0].Get("log-cache-counter-rate")).To(ConsistOf("true"))
+	})
+
+	It("passes the newest option to LogCache as metadata", func() {
+		gw, spyLogCache := tlsGatewayTestSetup()
+		URL := fmt.Sprintf("%s/api/v1/read/some-source-id?limit=10&newest=true", gw.Addr())
+
+		resp, err := makeTLSReq(URL)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+		md := spyLogCache.GetReadMetadata()
+		Expect(md).To(HaveLen(1))
+		Expect(md[0].Get("log-cache-newest")).To(ConsistOf("true"))
+	})
+
+	It("passes the latest per series option to LogCache as metadata", func() {
+		gw, spyLogCache := tlsGatewayTestSetup()
+		URL := fmt.Sprintf("%s/api/v1/read/some-source-id?limit=10&latest_per_series=true", gw.Addr())
+
+		resp, err := makeTLSReq(URL)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+		md := spyLogCache.GetReadMetadata()
+		Expect(md).To(HaveLen(1))
+		Expect(md[0].Get("log-cache-latest-per-series")).To(ConsistOf("true"))
+	})
+
+	It("passes the include spilled option to LogCache as metadata", func() {
+		gw, spyLogCache := tlsGatewayTestSetup()
+		URL := fmt.Sprintf("%s/api/v1/read/some-source-id?include_spilled=true", gw.Addr())
+
+		resp, err := makeTLSReq(URL)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+		md := spyLogCache.GetReadMetadata()
+		Expect(md).To(HaveLen(1))
+		Expect(md[0].Get("log-cache-include-spilled")).To(ConsistOf("true"))
+	})
+
+	It("passes the rebase to option to LogCache as metadata", func() {
+		gw, spyLogCache := tlsGatewayTestSetup()
+		URL := fmt.Sprintf("%s/api/v1/read/some-source-id?rebase_to=other-source-id", gw.Addr())
+
+		resp, err := makeTLSReq(URL)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+		md := spyLogCache.GetReadMetadata()
+		Expect(md).To(HaveLen(1))
+		Expect(md[0].Get("log-cache-rebase-to")).To(ConsistOf("other-source-id"))
+	})
+
+	It("passes the match exact option to LogCache as metadata", func() {
+		gw, spyLogCache := tlsGatewayTestSetup()
+		URL := fmt.Sprintf("%s/api/v1/read/some-source-id?name_filter=cpu&match_exact=true", gw.Addr())
+
+		resp, err := makeTLSReq(URL)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+		reqs := spyLogCache.GetReadRequests()
+		Expect(reqs).To(HaveLen(1))
+		Expect(reqs[0].NameFilter).To(Equal("cpu"))
+
+		md := spyLogCache.GetReadMetadata()
+		Expect(md).To(HaveLen(1))
+		Expect(md[0].Get("log-cache-match-exact")).To(ConsistOf("true"))
+	})
+
+	It("passes the cursor to LogCache as metadata", func() {
+		gw, spyLogCache := tlsGatewayTestSetup()
+		URL := fmt.Sprintf("%s/api/v1/read/some-source-id?cursor=AAAAAAAAAAc&limit=10", gw.Addr())
+
+		resp, err := makeTLSReq(URL)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+		reqs := spyLogCache.GetReadRequests()
+		Expect(reqs).To(HaveLen(1))
+		Expect(reqs[0].Limit).To(Equal(int64(10)))
+
+		md := spyLogCache.GetReadMetadata()
+		Expect(md).To(HaveLen(1))
+		Expect(md[0].Get("log-cache-cursor")).To(ConsistOf("AAAAAAAAAAc"))
+	})
+
+	It("serves protobuf read responses that match the JSON responses", func() {
+		gw, spyLogCache := tlsGatewayTestSetup()
+		spyLogCache.ReadEnvelopes["some-source-id"] = func() []*loggregator_v2.Envelope {
+			return []*loggregator_v2.Envelope{
+				{SourceId: "some-source-id", Timestamp: 99, Message: &loggregator_v2.Envelope_Log{Log: &loggregator_v2.Log{Payload: []byte("hi")}}},
+				{SourceId: "some-source-id", Timestamp: 100},
+			}
+		}
+		URL := fmt.Sprintf("%s/api/v1/read/some-source-id", gw.Addr())
+
+		resp, err := makeTLSReq(URL, "Accept", "application/x-protobuf")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(resp.Header.Get("Content-Type")).To(Equal("application/x-protobuf"))
+		body, err := io.ReadAll(resp.Body)
+		Expect(err).ToNot(HaveOccurred())
+		var protoResp rpc.ReadResponse
+		Expect(proto.Unmarshal(body, &protoResp)).To(Succeed())
+
+		resp, err = makeTLSReq(URL)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		body, err = io.ReadAll(resp.Body)
+		Expect(err).ToNot(HaveOccurred())
+		var jsonResp rpc.ReadResponse
+		Expect(protojson.Unmarshal(body, &jsonResp)).To(Succeed())
+
+		Expect(protoResp.Envelopes.Batch).To(HaveLen(2))
+		Expect(proto.Equal(&protoResp, &jsonResp)).To(BeTrue())
+	})
+
+	It("streams ndjson read responses that match the JSON responses", func() {
+		gw, spyLogCache := tlsGatewayTestSetup()
+		spyLogCache.ReadEnvelopes["some-source-id"] = func() []*loggregator_v2.Envelope {
+			return []*loggregator_v2.Envelope{
+				{SourceId: "some-source-id", Timestamp: 99, Message: &loggregator_v2.Envelope_Log{Log: &loggregator_v2.Log{Payload: []byte("hi")}}},
+				{SourceId: "some-source-id", Timestamp: 100, Tags: map[string]string{"a": "b"}},
+				{SourceId: "some-source-id", Timestamp: 101, Message: &loggregator_v2.Envelope_Counter{Counter: &loggregator_v2.Counter{Name: "c", Total: 5}}},
+			}
+		}
+		URL := fmt.Sprintf("%s/api/v1/read/some-source-id", gw.Addr())
+
+		resp, err := makeTLSReq(URL, "Accept", "application/x-ndjson")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(resp.Header.Get("Content-Type")).To(Equal("application/x-ndjson"))
+		body, err := io.ReadAll(resp.Body)
+		Expect(err).ToNot(HaveOccurred())
+		lines := strings.Split(strings.TrimSuffix(string(body), "\n"), "\n")
+		var ndjsonEnvelopes []*loggregator_v2.Envelope
+		for _, line := range lines {
+			var e loggregator_v2.Envelope
+			Expect(protojson.Unmarshal([]byte(line), &e)).To(Succeed())
+			ndjsonEnvelopes = append(ndjsonEnvelopes, &e)
+		}
+
+		resp, err = makeTLSReq(URL)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		body, err = io.ReadAll(resp.Body)
+		Expect(err).ToNot(HaveOccurred())
+		var jsonResp rpc.ReadResponse
+		Expect(protojson.Unmarshal(body, &jsonResp)).To(Succeed())
+
+		Expect(ndjsonEnvelopes).To(HaveLen(3))
+		Expect(ndjsonEnvelopes).To(HaveLen(len(jsonResp.Envelopes.Batch)))
+		for i, e := range ndjsonEnvelopes {
+			Expect(proto.Equal(e, jsonResp.Envelopes.Batch[i])).To(BeTrue())
+		}
+	})
+
+	It("streams an empty ndjson response when there are no envelopes", func() {
+		gw, _ := tlsGatewayTestSetup()
+
+		resp, err := makeTLSReq(fmt.Sprintf("%s/api/v1/read/some-source-id", gw.Addr()), "Accept", "application/x-ndjson")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		body, err := io.ReadAll(resp.Body)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(body).To(BeEmpty())
+	})
+
+	It("passes the parameters of an ndjson read to LogCache", func() {
+		gw, spyLogCache := tlsGatewayTestSetup()
+		path := "api/v1/read/some-source%2Fid?start_time=99&end_time=101&limit=103&envelope_types=LOG&tag_filter=a:b"
+
+		resp, err := makeTLSReq(fmt.Sprintf("%s/%s", gw.Addr(), path), "Accept", "application/x-ndjson")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+		reqs := spyLogCache.GetReadRequests()
+		Expect(reqs).To(HaveLen(1))
+		Expect(reqs[0].SourceId).To(Equal("some-source/id"))
+		Expect(reqs[0].StartTime).To(Equal(int64(99)))
+		Expect(reqs[0].EndTime).To(Equal(int64(101)))
+		Expect(reqs[0].Limit).To(Equal(int64(103)))
+		Expect(reqs[0].EnvelopeTypes).To(ConsistOf(rpc.EnvelopeType_LOG))
+
+		md := spyLogCache.GetReadMetadata()
+		Expect(md).To(HaveLen(1))
+		Expect(md[0].Get("log-cache-tag-filter")).To(ConsistOf("a:b"))
+	})
+
+	It("rejects an ndjson read with invalid parameters", func() {
+		gw, spyLogCache := tlsGatewayTestSetup()
+
+		resp, err := makeTLSReq(fmt.Sprintf("%s/api/v1/read/some-source-id?limit=many", gw.Addr()), "Accept", "application/x-ndjson")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+		Expect(spyLogCache.GetReadRequests()).To(BeEmpty())
+	})
+
+	It("serves protobuf meta responses", func() {
+		gw, spyLogCache := tlsGatewayTestSetup()
+		spyLogCache.MetaResponses = map[string]*rpc.MetaInfo{
+			"some-source-id": {Count: 2, OldestTimestamp: 99, NewestTimestamp: 100},
+		}
+
+		resp, err := makeTLSReq(fmt.Sprintf("%s/api/v1/meta", gw.Addr()), "Accept", "application/x-protobuf")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		body, err := io.ReadAll(resp.Body)
+		Expect(err).ToNot(HaveOccurred())
+
+		var metaResp rpc.MetaResponse
+		Expect(proto.Unmarshal(body, &metaResp)).To(Succeed())
+		Expect(metaResp.Meta).To(HaveKey("some-source-id"))
+		Expect(metaResp.Meta["some-source-id"].Count).To(Equal(int64(2)))
+	})
+
+	It("adds the effective retention of each source ID to JSON meta responses when asked to", func() {
+		gw, spyLogCache := tlsGatewayTestSetup()
+		spyLogCache.MetaResponses = map[string]*rpc.MetaInfo{
+			"some-source-id":  {Count: 2, OldestTimestamp: time.Now().Add(-time.Hour).UnixNano(), NewestTimestamp: time.Now().UnixNano()},
+			"empty-source-id": {},
+		}
+
+		resp, err := makeTLSReq(fmt.Sprintf("%s/api/v1/meta?effective_retention=true", gw.Addr()))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+		var body struct {
+			Meta map[string]struct {
+				Count                string `json:"count"`
+				EffectiveRetentionMS string `json:"effective_retention_ms"`
+			} `json:"meta"`
+		}
+		Expect(json.NewDecoder(resp.Body).Decode(&body)).To(Succeed())
+		Expect(body.Meta["some-source-id"].Count).To(Equal("2"))
+
+		retention, err := strconv.ParseInt(body.Meta["some-source-id"].EffectiveRetentionMS, 10, 64)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(retention).To(BeNumerically("~", time.Hour.Milliseconds(), 5000))
+		Expect(body.Meta["empty-source-id"].EffectiveRetentionMS).To(Equal("0"))
+	})
+
+	It("only adds the effective retention to meta responses when asked to", func() {
+		gw, spyLogCache := tlsGatewayTestSetup()
+		spyLogCache.MetaResponses = map[string]*rpc.MetaInfo{
+			"some-source-id": {Count: 2, OldestTimestamp: 99},
+		}
+
+		resp, err := makeTLSReq(fmt.Sprintf("%s/api/v1/meta", gw.Addr()))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		body, err := io.ReadAll(resp.Body)
+		Expect(err).ToNot(HaveOccurred())
+
+		var metaResp rpc.MetaResponse
+		Expect(protojson.Unmarshal(body, &metaResp)).To(Succeed())
+		Expect(metaResp.Meta).To(HaveKey("some-source-id"))
+	})
+
+	It("rejects an invalid effective retention parameter", func() {
+		gw, _ := tlsGatewayTestSetup()
+
+		resp, err := makeTLSReq(fmt.Sprintf("%s/api/v1/meta?effective_retention=sometimes", gw.Addr()))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+	})
+
 	It("adds newlines to the end of HTTPS responses", func() {
 		gw, _ := tlsGatewayTestSetup()
 		path := `api/v1/meta`
@@ -170,11 +596,51 @@ var _ = Describe("Gateway", func() {
 		Expect(respBytes).To(MatchJSON(
 			`{
 			"version":"1.2.3",
-			"vm_uptime":"789"
+			"vm_uptime":"789",
+			"promql_limits":{
+				"max_samples":50000000,
+				"max_concurrent":10,
+				"max_concurrent_queries":0,
+				"max_points_per_series":0
+			}
 		}`))
 		Expect(strings.HasSuffix(string(respBytes), "\n")).To(BeTrue())
 	})
 
+	It("reports the configured PromQL limits from the info endpoint", func() {
+		spyLogCache := testing.NewSpyLogCache(nil)
+		gw := NewGateway(
+			spyLogCache.Start(),
+			"localhost:0",
+			WithGatewayLogCacheDialOpts(grpc.WithTransportCredentials(insecure.NewCredentials())),
+			WithGatewayVersion("1.2.3"),
+			WithGatewayVMUptimeFn(testing.StubUptimeFn),
+			WithGatewayMaxConcurrentQueries(4),
+			WithGatewayQueryTimeout(30*time.Second),
+			WithGatewayMaxPointsPerSeries(11000),
+		)
+		gw.Start()
+
+		resp, err := makeReq(fmt.Sprintf("%s/api/v1/info", gw.Addr()))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+		respBytes, err := io.ReadAll(resp.Body)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(respBytes).To(MatchJSON(
+			`{
+			"version":"1.2.3",
+			"vm_uptime":"789",
+			"promql_limits":{
+				"max_samples":50000000,
+				"max_concurrent":10,
+				"max_concurrent_queries":4,
+				"max_points_per_series":11000,
+				"query_timeout":"30s"
+			}
+		}`))
+	})
+
 	It("does not accept unencrypted connections", func() {
 		gw, _ := tlsGatewayTestSetup()
 		resp, err := makeReq(fmt.Sprintf("%s/api/v1/info", gw.Addr()))
@@ -182,6 +648,453 @@ var _ = Describe("Gateway", func() {
 		Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
 	})
 
+	Context("with a default read lookback", func() {
+		var (
+			gw          *Gateway
+			spyLogCache *testing.SpyLogCache
+		)
+
+		BeforeEach(func() {
+			spyLogCache = testing.NewSpyLogCache(nil)
+			gw = NewGateway(
+				spyLogCache.Start(),
+				"localhost:0",
+				WithGatewayDefaultReadLookback(5*time.Minute),
+				WithGatewayLogCacheDialOpts(
+					grpc.WithTransportCredentials(insecure.NewCredentials()),
+				),
+			)
+			gw.Start()
+		})
+
+		It("reads the last lookback of data when no start time is given", func() {
+			resp, err := makeReq(fmt.Sprintf("%s/api/v1/read/some-source-id?limit=10", gw.Addr()))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+			reqs := spyLogCache.GetReadRequests()
+			Expect(reqs).To(HaveLen(1))
+			Expect(reqs[0].SourceId).To(Equal("some-source-id"))
+			Expect(reqs[0].Limit).To(Equal(int64(10)))
+			Expect(reqs[0].StartTime).To(BeNumerically("~", time.Now().Add(-5*time.Minute).UnixNano(), int64(5*time.Second)))
+		})
+
+		It("uses the given start time", func() {
+			resp, err := makeReq(fmt.Sprintf("%s/api/v1/read/some-source-id?start_time=99", gw.Addr()))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+			reqs := spyLogCache.GetReadRequests()
+			Expect(reqs).To(HaveLen(1))
+			Expect(reqs[0].StartTime).To(Equal(int64(99)))
+		})
+	})
+
+	Context("with CORS", func() {
+		var (
+			gw          *Gateway
+			spyLogCache *testing.SpyLogCache
+		)
+
+		BeforeEach(func() {
+			spyLogCache = testing.NewSpyLogCache(nil)
+			gw = NewGateway(
+				spyLogCache.Start(),
+				"localhost:0",
+				WithGatewayCORS([]string{"https://dashboard.example.com"}),
+				WithGatewayLogCacheDialOpts(
+					grpc.WithTransportCredentials(insecure.NewCredentials()),
+				),
+			)
+			gw.Start()
+		})
+
+		corsReq := func(method, path, origin string, headers ...string) *http.Response {
+			req, err := http.NewRequest(method, fmt.Sprintf("http://%s/%s", gw.Addr(), path), nil)
+			Expect(err).ToNot(HaveOccurred())
+			req.Header.Set("Origin", origin)
+			for i := 0; i+1 < len(headers); i += 2 {
+				req.Header.Set(headers[i], headers[i+1])
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			Expect(err).ToNot(HaveOccurred())
+			return resp
+		}
+
+		It("answers a preflight request from an allowed origin", func() {
+			resp := corsReq(http.MethodOptions, "api/v1/read/some-source-id", "https://dashboard.example.com",
+				"Access-Control-Request-Method", "GET",
+				"Access-Control-Request-Headers", "Authorization",
+			)
+
+			Expect(resp.StatusCode).To(Equal(http.StatusNoContent))
+			Expect(resp.Header.Get("Access-Control-Allow-Origin")).To(Equal("https://dashboard.example.com"))
+			Expect(resp.Header.Get("Access-Control-Allow-Methods")).To(ContainSubstring("GET"))
+			Expect(resp.Header.Get("Access-Control-Allow-Headers")).To(Equal("Authorization"))
+			Expect(resp.Header.Get("Access-Control-Max-Age")).ToNot(BeEmpty())
+			Expect(spyLogCache.GetReadRequests()).To(BeEmpty())
+		})
+
+		It("rejects a preflight request from another origin", func() {
+			resp := corsReq(http.MethodOptions, "api/v1/query", "https://evil.example.com",
+				"Access-Control-Request-Method", "GET",
+			)
+
+			Expect(resp.StatusCode).To(Equal(http.StatusForbidden))
+			Expect(resp.Header.Get("Access-Control-Allow-Origin")).To(BeEmpty())
+		})
+
+		It("adds CORS headers to reads and queries from an allowed origin", func() {
+			resp := corsReq(http.MethodGet, "api/v1/read/some-source-id", "https://dashboard.example.com")
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			Expect(resp.Header.Get("Access-Control-Allow-Origin")).To(Equal("https://dashboard.example.com"))
+			Expect(resp.Header.Values("Vary")).To(ContainElement("Origin"))
+
+			resp = corsReq(http.MethodGet, `api/v1/query?query=metric{source_id="some-id"}&time=1234`, "https://dashboard.example.com")
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			Expect(resp.Header.Get("Access-Control-Allow-Origin")).To(Equal("https://dashboard.example.com"))
+		})
+
+		It("serves requests from another origin without CORS headers", func() {
+			resp := corsReq(http.MethodGet, "api/v1/read/some-source-id", "https://evil.example.com")
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			Expect(resp.Header.Get("Access-Control-Allow-Origin")).To(BeEmpty())
+		})
+
+		It("does not add CORS headers to other endpoints", func() {
+			resp := corsReq(http.MethodGet, "api/v1/info", "https://dashboard.example.com")
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			Expect(resp.Header.Get("Access-Control-Allow-Origin")).To(BeEmpty())
+		})
+	})
+
+	It("does not add CORS headers by default", func() {
+		gw, _ := gatewayTestSetup()
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://%s/api/v1/read/some-source-id", gw.Addr()), nil)
+		Expect(err).ToNot(HaveOccurred())
+		req.Header.Set("Origin", "https://dashboard.example.com")
+
+		resp, err := http.DefaultClient.Do(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(resp.Header.Get("Access-Control-Allow-Origin")).To(BeEmpty())
+	})
+
+	Context("with backend health checks", func() {
+		var (
+			spyLogCache *testing.SpyLogCache
+			dials       int64
+			dialOpts    []grpc.DialOption
+		)
+
+		BeforeEach(func() {
+			spyLogCache = testing.NewSpyLogCache(nil)
+			atomic.StoreInt64(&dials, 0)
+			dialOpts = []grpc.DialOption{
+				grpc.WithTransportCredentials(insecure.NewCredentials()),
+				// The first dial fails, as if the node was gone, and gRPC
+				// would not retry it within the test.
+				grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+					if atomic.AddInt64(&dials, 1) == 1 {
+						return nil, errors.New("node removed")
+					}
+					return (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+				}),
+				grpc.WithConnectParams(grpc.ConnectParams{
+					Backoff:           backoff.Config{BaseDelay: time.Hour, Multiplier: 1, MaxDelay: time.Hour},
+					MinConnectTimeout: time.Second,
+				}),
+			}
+		})
+
+		It("redials a connection that fails health checks past the threshold", func() {
+			gw := NewGateway(
+				spyLogCache.Start(),
+				"localhost:0",
+				WithGatewayLogCacheDialOpts(dialOpts...),
+				WithGatewayBackendHealthCheck(10*time.Millisecond, 3),
+			)
+			gw.Start()
+			URL := fmt.Sprintf("%s/api/v1/read/some-source-id", gw.Addr())
+
+			resp, err := makeReq(URL)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.StatusCode).ToNot(Equal(http.StatusOK))
+
+			Eventually(func() int {
+				resp, err := makeReq(URL)
+				Expect(err).ToNot(HaveOccurred())
+				return resp.StatusCode
+			}).Should(Equal(http.StatusOK))
+			Expect(atomic.LoadInt64(&dials)).To(BeNumerically(">=", 2))
+		})
+
+		It("keeps a failing connection without health checks", func() {
+			gw := NewGateway(
+				spyLogCache.Start(),
+				"localhost:0",
+				WithGatewayLogCacheDialOpts(dialOpts...),
+			)
+			gw.Start()
+			URL := fmt.Sprintf("%s/api/v1/read/some-source-id", gw.Addr())
+
+			Consistently(func() int {
+				resp, err := makeReq(URL)
+				Expect(err).ToNot(HaveOccurred())
+				return resp.StatusCode
+			}, 200*time.Millisecond).ShouldNot(Equal(http.StatusOK))
+			Expect(atomic.LoadInt64(&dials)).To(Equal(int64(1)))
+		})
+	})
+
+	It("rejects queries beyond the concurrency limit", func() {
+		spyLogCache := testing.NewSpyLogCache(nil)
+		spyLogCache.QueryBlock = make(chan struct{})
+		gw := NewGateway(
+			spyLogCache.Start(),
+			"localhost:0",
+			WithGatewayMaxConcurrentQueries(2),
+			WithGatewayLogCacheDialOpts(
+				grpc.WithTransportCredentials(insecure.NewCredentials()),
+			),
+		)
+		gw.Start()
+		URL := fmt.Sprintf("%s/api/v1/query?query=metric{source_id=\"some-id\"}&time=1234", gw.Addr())
+
+		statuses := make(chan int, 2)
+		for i := 0; i < 2; i++ {
+			go func() {
+				defer GinkgoRecover()
+				resp, err := makeReq(URL)
+				Expect(err).ToNot(HaveOccurred())
+				statuses <- resp.StatusCode
+			}()
+		}
+		Eventually(spyLogCache.GetQueryRequests).Should(HaveLen(2))
+
+		resp, err := makeReq(URL)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusTooManyRequests))
+		Expect(resp.Header.Get("Retry-After")).To(Equal("1"))
+
+		close(spyLogCache.QueryBlock)
+		Eventually(statuses).Should(Receive(Equal(http.StatusOK)))
+		Eventually(statuses).Should(Receive(Equal(http.StatusOK)))
+
+		resp, err = makeReq(URL)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+	})
+
+	Context("with a maximum number of points per series", func() {
+		var (
+			gw          *Gateway
+			spyLogCache *testing.SpyLogCache
+		)
+
+		BeforeEach(func() {
+			spyLogCache = testing.NewSpyLogCache(nil)
+			gw = NewGateway(
+				spyLogCache.Start(),
+				"localhost:0",
+				WithGatewayMaxPointsPerSeries(100),
+				WithGatewayLogCacheDialOpts(
+					grpc.WithTransportCredentials(insecure.NewCredentials()),
+				),
+			)
+			gw.Start()
+		})
+
+		It("rejects a range query with more points than the maximum", func() {
+			resp, err := makeReq(fmt.Sprintf("%s/api/v1/query_range?query=metric{source_id=\"some-id\"}&start=0&end=3030&step=30s", gw.Addr()))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+
+			body, _ := io.ReadAll(resp.Body)
+			Expect(body).To(MatchJSON(`{
+				"status": "error",
+				"errorType": "bad_data",
+				"error": "exceeded maximum resolution of 100 points per timeseries. Try decreasing the query resolution (?step=XX)"
+			}`))
+			Expect(spyLogCache.GetRangeQueryRequests()).To(BeEmpty())
+		})
+
+		It("serves a range query within the maximum", func() {
+			resp, err := makeReq(fmt.Sprintf("%s/api/v1/query_range?query=metric{source_id=\"some-id\"}&start=0&end=3000&step=30s", gw.Addr()))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+			Expect(spyLogCache.GetRangeQueryRequests()).To(HaveLen(1))
+		})
+
+		It("passes on a range query that can not be parsed", func() {
+			resp, err := makeReq(fmt.Sprintf("%s/api/v1/query_range?query=metric{source_id=\"some-id\"}&start=potato&end=3030&step=1s", gw.Addr()))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+			Expect(spyLogCache.GetRangeQueryRequests()).To(HaveLen(1))
+		})
+
+		It("does not limit instant queries", func() {
+			resp, err := makeReq(fmt.Sprintf("%s/api/v1/query?query=metric{source_id=\"some-id\"}[1h]&time=3030", gw.Addr()))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		})
+	})
+
+	Context("with HTTP metrics", func() {
+		var (
+			gw          *Gateway
+			spyMetrics  *testhelpers.SpyMetricsRegistry
+			spyLogCache *testing.SpyLogCache
+		)
+
+		BeforeEach(func() {
+			spyMetrics = testhelpers.NewMetricsRegistry()
+			spyLogCache = testing.NewSpyLogCache(nil)
+			gw = NewGateway(
+				spyLogCache.Start(),
+				"localhost:0",
+				WithGatewayHTTPMetrics(spyMetrics),
+				WithGatewayMaxPointsPerSeries(100),
+				WithGatewayLogCacheDialOpts(
+					grpc.WithTransportCredentials(insecure.NewCredentials()),
+				),
+			)
+			gw.Start()
+		})
+
+		It("records a query in the query histogram with its status code", func() {
+			resp, err := makeReq(fmt.Sprintf("%s/api/v1/query?query=metric{source_id=\"some-id\"}&time=1", gw.Addr()))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+			tags := map[string]string{"endpoint": "query", "status": "200", "unit": "seconds"}
+			Expect(spyMetrics.HasMetric("log_cache_gateway_request_duration", tags)).To(BeTrue())
+			Expect(spyMetrics.GetMetricValue("log_cache_gateway_request_duration", tags)).To(BeNumerically(">", 0))
+			Expect(spyMetrics.GetMetricValue("log_cache_gateway_requests", map[string]string{"endpoint": "query", "status": "200"})).To(Equal(1.0))
+		})
+
+		It("records a rejected request with the status code it was rejected with", func() {
+			resp, err := makeReq(fmt.Sprintf("%s/api/v1/query_range?query=metric{source_id=\"some-id\"}&start=0&end=3030&step=30s", gw.Addr()))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+
+			Expect(spyMetrics.HasMetric("log_cache_gateway_request_duration", map[string]string{"endpoint": "query_range", "status": "400", "unit": "seconds"})).To(BeTrue())
+			Expect(spyMetrics.GetMetricValue("log_cache_gateway_requests", map[string]string{"endpoint": "query_range", "status": "400"})).To(Equal(1.0))
+		})
+
+		It("records reads and meta requests", func() {
+			_, err := makeReq(fmt.Sprintf("%s/api/v1/read/some-id", gw.Addr()))
+			Expect(err).ToNot(HaveOccurred())
+			_, err = makeReq(fmt.Sprintf("%s/api/v1/meta", gw.Addr()))
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(spyMetrics.GetMetricValue("log_cache_gateway_requests", map[string]string{"endpoint": "read", "status": "200"})).To(Equal(1.0))
+			Expect(spyMetrics.GetMetricValue("log_cache_gateway_requests", map[string]string{"endpoint": "meta", "status": "200"})).To(Equal(1.0))
+		})
+
+		It("does not record requests to other endpoints", func() {
+			_, err := makeReq(fmt.Sprintf("%s/api/v1/info", gw.Addr()))
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(spyMetrics.Metrics).To(BeEmpty())
+		})
+	})
+
+	Context("with writes", func() {
+		var (
+			gw          *Gateway
+			spyLogCache *testing.SpyLogCache
+		)
+
+		BeforeEach(func() {
+			spyLogCache = testing.NewSpyLogCache(nil)
+			gw = NewGateway(
+				spyLogCache.Start(),
+				"localhost:0",
+				WithGatewayWrite(),
+				WithGatewayLogCacheDialOpts(
+					grpc.WithTransportCredentials(insecure.NewCredentials()),
+				),
+			)
+			gw.Start()
+		})
+
+		post := func(contentType string, body []byte) *http.Response {
+			resp, err := http.Post(fmt.Sprintf("http://%s/api/v1/write", gw.Addr()), contentType, bytes.NewReader(body))
+			Expect(err).ToNot(HaveOccurred())
+			return resp
+		}
+
+		It("sends a posted JSON batch to Log Cache", func() {
+			resp := post("application/json", []byte(`{
+				"envelopes": {"batch": [
+					{"source_id": "some-source-id", "timestamp": "1", "log": {"payload": "aGk="}},
+					{"source_id": "other-source-id", "timestamp": "2", "counter": {"name": "some-counter", "total": "3"}}
+				]},
+				"local_only": true
+			}`))
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+			Eventually(spyLogCache.GetEnvelopes).Should(HaveLen(2))
+			envelopes := spyLogCache.GetEnvelopes()
+			Expect(envelopes[0].GetSourceId()).To(Equal("some-source-id"))
+			Expect(envelopes[0].GetLog().GetPayload()).To(Equal([]byte("hi")))
+			Expect(envelopes[1].GetCounter().GetTotal()).To(Equal(uint64(3)))
+			Expect(spyLogCache.GetLocalOnlyValues()).To(ConsistOf(false))
+		})
+
+		It("sends a posted protobuf batch to Log Cache", func() {
+			body, err := proto.Marshal(&rpc.SendRequest{
+				Envelopes: &loggregator_v2.EnvelopeBatch{
+					Batch: []*loggregator_v2.Envelope{{SourceId: "some-source-id", Timestamp: 1}},
+				},
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			resp := post("application/x-protobuf", body)
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+			Eventually(spyLogCache.GetEnvelopes).Should(HaveLen(1))
+			Expect(spyLogCache.GetEnvelopes()[0].GetSourceId()).To(Equal("some-source-id"))
+		})
+
+		It("rejects a write without envelopes", func() {
+			resp := post("application/json", []byte(`{}`))
+			Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+			Expect(spyLogCache.GetEnvelopes()).To(BeEmpty())
+		})
+
+		It("rejects a write that can not be decoded", func() {
+			resp := post("application/json", []byte(`{"envelopes": 1}`))
+			Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+		})
+
+		It("returns an error when Log Cache fails to store the batch", func() {
+			spyLogCache.FailNextSends(1)
+
+			resp := post("application/json", []byte(`{"envelopes": {"batch": [{"source_id": "some-source-id"}]}}`))
+			Expect(resp.StatusCode).To(Equal(http.StatusInternalServerError))
+		})
+
+		It("only accepts POST requests", func() {
+			resp, err := makeReq(fmt.Sprintf("%s/api/v1/write", gw.Addr()))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.StatusCode).To(Equal(http.StatusMethodNotAllowed))
+		})
+	})
+
+	It("does not serve writes by default", func() {
+		gw, spyLogCache := gatewayTestSetup()
+
+		resp, err := http.Post(fmt.Sprintf("http://%s/api/v1/write", gw.Addr()), "application/json", strings.NewReader(`{"envelopes": {"batch": [{"source_id": "some-source-id"}]}}`))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+		Expect(spyLogCache.GetEnvelopes()).To(BeEmpty())
+	})
+
 	Context("errors", func() {
 		It("passes through content-type correctly on errors", func() {
 			gw, spyLogCache := tlsGatewayTestSetup()
@@ -213,12 +1126,69 @@ var _ = Describe("Gateway", func() {
 				"error": "expected error"
 			}`))
 		})
+
+		It("reports a malformed query as bad_data", func() {
+			gw, spyLogCache := tlsGatewayTestSetup()
+			path := `api/v1/query?query=metric{source_id="some-id"}&time=1234`
+			spyLogCache.QueryError = status.Error(codes.InvalidArgument, `parse error at char 7: unexpected "."`)
+			URL := fmt.Sprintf("%s/%s", gw.Addr(), path)
+
+			resp, err := makeTLSReq(URL)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+
+			body, _ := io.ReadAll(resp.Body)
+			Expect(body).To(MatchJSON(`{
+				"status": "error",
+				"errorType": "bad_data",
+				"error": "parse error at char 7: unexpected \".\""
+			}`))
+		})
+
+		It("reports a backend timeout as timeout", func() {
+			gw, spyLogCache := tlsGatewayTestSetup()
+			path := `api/v1/query_range?query=metric{source_id="some-id"}&start=1234&end=5678&step=30s`
+			spyLogCache.QueryError = status.Error(codes.DeadlineExceeded, "query timed out in query execution")
+			URL := fmt.Sprintf("%s/%s", gw.Addr(), path)
+
+			resp, err := makeTLSReq(URL)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.StatusCode).To(Equal(http.StatusServiceUnavailable))
+
+			body, _ := io.ReadAll(resp.Body)
+			Expect(body).To(MatchJSON(`{
+				"status": "error",
+				"errorType": "timeout",
+				"error": "query timed out in query execution"
+			}`))
+		})
+
+		It("reports an evaluation failure as execution", func() {
+			gw, spyLogCache := tlsGatewayTestSetup()
+			path := `api/v1/query?query=metric{source_id="some-id"}&time=1234`
+			spyLogCache.QueryError = status.Error(codes.Aborted, "query processing would load too many samples into memory")
+			URL := fmt.Sprintf("%s/%s", gw.Addr(), path)
+
+			resp, err := makeTLSReq(URL)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.StatusCode).To(Equal(http.StatusUnprocessableEntity))
+
+			body, _ := io.ReadAll(resp.Body)
+			Expect(body).To(MatchJSON(`{
+				"status": "error",
+				"errorType": "execution",
+				"error": "query processing would load too many samples into memory"
+			}`))
+		})
 	})
 })
 
-func makeTLSReq(addr string) (*http.Response, error) {
+func makeTLSReq(addr string, headers ...string) (*http.Response, error) {
 	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("https://%s", addr), nil)
 	Expect(err).ToNot(HaveOccurred())
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
 
 	//nolint:gosec
 	tr := &http.Transport{
@@ -0,0 +1,145 @@
+package gateway
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	metrics "code.cloudfoundry.org/go-metric-registry"
+)
+
+// MetricsRegistry creates the metrics the Gateway records.
+type MetricsRegistry interface {
+	NewCounter(name, helpText string, opts ...metrics.MetricOption) metrics.Counter
+	NewHistogram(name, helpText string, buckets []float64, opts ...metrics.MetricOption) metrics.Histogram
+}
+
+// httpMetrics records the duration and status code of the read, meta, query
+// and query_range requests served by the Gateway, labelled by endpoint and
+// status code.
+type httpMetrics struct {
+	m MetricsRegistry
+
+	mu        sync.Mutex
+	durations map[string]metrics.Histogram
+	requests  map[string]metrics.Counter
+}
+
+func newHTTPMetrics(m MetricsRegistry) *httpMetrics {
+	return &httpMetrics{
+		m:         m,
+		durations: make(map[string]metrics.Histogram),
+		requests:  make(map[string]metrics.Counter),
+	}
+}
+
+// middleware records every request to a known endpoint once next has
+// served it. Requests rejected by other middleware, such as the query
+// limits, are recorded with the status code they were rejected with.
+func (h *httpMetrics) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		endpoint, ok := metricsEndpoint(r.URL.Path)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		sw := &statusResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r)
+
+		status := strconv.Itoa(sw.status)
+		h.duration(endpoint, status).Observe(time.Since(start).Seconds())
+		h.counter(endpoint, status).Add(1)
+	})
+}
+
+func (h *httpMetrics) duration(endpoint, status string) metrics.Histogram {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	key := endpoint + ":" + status
+	d, ok := h.durations[key]
+	if !ok {
+		d = h.m.NewHistogram(
+			"log_cache_gateway_request_duration",
+			"Duration of HTTP requests served by the log cache gateway in seconds.",
+			[]float64{.001, .005, .01, .05, .1, .5, 1, 5, 10, 30},
+			metrics.WithMetricLabels(map[string]string{"endpoint": endpoint, "status": status, "unit": "seconds"}),
+		)
+		h.durations[key] = d
+	}
+
+	return d
+}
+
+func (h *httpMetrics) counter(endpoint, status string) metrics.Counter {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	key := endpoint + ":" + status
+	c, ok := h.requests[key]
+	if !ok {
+		c = h.m.NewCounter(
+			"log_cache_gateway_requests",
+			"Total number of HTTP requests served by the log cache gateway.",
+			metrics.WithMetricLabels(map[string]string{"endpoint": endpoint, "status": status}),
+		)
+		h.requests[key] = c
+	}
+
+	return c
+}
+
+// metricsEndpoint returns the endpoint label of a request path. Paths of
+// other endpoints are not recorded, which keeps the number of labels
+// bounded.
+func metricsEndpoint(path string) (string, bool) {
+	switch {
+	case strings.HasPrefix(path, "/api/v1/read/"):
+		return "read", true
+	case path == "/api/v1/meta":
+		return "meta", true
+	case path == "/api/v1/query":
+		return "query", true
+	case path == "/api/v1/query_range":
+		return "query_range", true
+	default:
+		return "", false
+	}
+}
+
+// statusResponseWriter remembers the status code written to the wrapped
+// http.ResponseWriter.
+type statusResponseWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (w *statusResponseWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.status = code
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusResponseWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush keeps streamed ndjson reads flushing through the wrapper.
+func (w *statusResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the wrapped writer.
+func (w *statusResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
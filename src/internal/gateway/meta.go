@@ -0,0 +1,109 @@
+package gateway
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/utilities"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"code.cloudfoundry.org/go-log-cache/v3/rpc/logcache_v1"
+	logcacheclient "code.cloudfoundry.org/log-cache/pkg/client"
+)
+
+// metaFilter keeps the effective_retention query parameter out of the
+// MetaRequest.
+var metaFilter = utilities.NewDoubleArray([][]string{{logcacheclient.EffectiveRetentionParam}})
+
+// metaWithRetention serves a JSON Meta with the effective_retention query
+// parameter set, adding the effective retention of every source ID to the
+// response. MetaInfo is generated in go-log-cache and has no field for it.
+// Every other request is passed to next.
+func (g *Gateway) metaWithRetention(client logcache_v1.EgressClient, mux *runtime.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/api/v1/meta" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		_, outbound := runtime.MarshalerForRequest(mux, r)
+		retention, err := effectiveRetentionParam(r)
+		if err != nil {
+			runtime.HTTPError(r.Context(), mux, outbound, w, r, status.Error(codes.InvalidArgument, err.Error()))
+			return
+		}
+		if _, ok := outbound.(*protobufMarshaler); ok || !retention {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, err := runtime.AnnotateContext(r.Context(), mux, r, "/logcache.v1.Egress/Meta")
+		if err != nil {
+			runtime.HTTPError(r.Context(), mux, outbound, w, r, err)
+			return
+		}
+
+		req := &logcache_v1.MetaRequest{}
+		if err := runtime.PopulateQueryParameters(req, r.URL.Query(), metaFilter); err != nil {
+			runtime.HTTPError(ctx, mux, outbound, w, r, status.Errorf(codes.InvalidArgument, "%v", err))
+			return
+		}
+
+		var header, trailer metadata.MD
+		resp, err := client.Meta(ctx, req, grpc.Header(&header), grpc.Trailer(&trailer))
+		if err != nil {
+			runtime.HTTPError(ctx, mux, outbound, w, r, err)
+			return
+		}
+
+		body, err := outbound.Marshal(resp)
+		if err == nil {
+			body, err = logcacheclient.AddEffectiveRetention(body, resp, time.Now())
+		}
+		if err != nil {
+			runtime.HTTPError(ctx, mux, outbound, w, r, status.Error(codes.Internal, err.Error()))
+			return
+		}
+
+		forwardMetadata(w, header, trailer)
+		w.Header().Set("Content-Type", outbound.ContentType(resp))
+		w.Write(append(body, '\n')) //nolint:errcheck
+	})
+}
+
+// effectiveRetentionParam reports whether the effective_retention query
+// parameter of r is true.
+func effectiveRetentionParam(r *http.Request) (bool, error) {
+	v := r.URL.Query().Get(logcacheclient.EffectiveRetentionParam)
+	if v == "" {
+		return false, nil
+	}
+
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("%s must be true or false, got %q", logcacheclient.EffectiveRetentionParam, v)
+	}
+
+	return b, nil
+}
+
+// forwardMetadata writes the gRPC header and trailer of a response as HTTP
+// headers the way grpc-gateway does.
+func forwardMetadata(w http.ResponseWriter, header, trailer metadata.MD) {
+	for k, vs := range header {
+		for _, v := range vs {
+			w.Header().Add(runtime.MetadataHeaderPrefix+k, v)
+		}
+	}
+	for k, vs := range trailer {
+		for _, v := range vs {
+			w.Header().Add(runtime.MetadataTrailerPrefix+k, v)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package gateway
+
+import (
+	"bufio"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/utilities"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"code.cloudfoundry.org/go-log-cache/v3/rpc/logcache_v1"
+)
+
+const ndjsonMIME = "application/x-ndjson"
+
+// ndjsonFlushBytes is how much of an ndjson response is buffered before it
+// is flushed to the client.
+const ndjsonFlushBytes = 32 * 1024
+
+// ndjsonReadFilter keeps the source_id query parameter from overriding the
+// source ID in the path, as the generated Read handler does.
+var ndjsonReadFilter = utilities.NewDoubleArray([][]string{{"source_id"}})
+
+// ndjsonReads serves a Read with an Accept header of application/x-ndjson
+// as one JSON envelope per line instead of a single JSON object. Each
+// envelope is written as soon as it is marshaled, so the response is
+// never held in memory as a whole. Every other request is passed to next.
+func (g *Gateway) ndjsonReads(client logcache_v1.EgressClient, mux *runtime.ServeMux, next http.Handler) http.Handler {
+	marshaler := protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || !strings.HasPrefix(r.URL.Path, "/api/v1/read/") || !acceptsNDJSON(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, err := runtime.AnnotateContext(r.Context(), mux, r, "/logcache.v1.Egress/Read")
+		if err != nil {
+			g.ndjsonError(mux, w, r, err)
+			return
+		}
+
+		req := &logcache_v1.ReadRequest{
+			SourceId: strings.TrimPrefix(r.URL.Path, "/api/v1/read/"),
+		}
+		if err := runtime.PopulateQueryParameters(req, r.URL.Query(), ndjsonReadFilter); err != nil {
+			g.ndjsonError(mux, w, r, status.Errorf(codes.InvalidArgument, "%v", err))
+			return
+		}
+
+		var header, trailer metadata.MD
+		resp, err := client.Read(ctx, req, grpc.Header(&header), grpc.Trailer(&trailer))
+		if err != nil {
+			g.ndjsonError(mux, w, r, err)
+			return
+		}
+
+		forwardMetadata(w, header, trailer)
+		w.Header().Set("Content-Type", ndjsonMIME)
+		w.WriteHeader(http.StatusOK)
+
+		bw := bufio.NewWriterSize(w, ndjsonFlushBytes)
+		flusher, _ := w.(http.Flusher)
+		batch := resp.GetEnvelopes().GetBatch()
+		for i, e := range batch {
+			line, err := marshaler.Marshal(e)
+			if err != nil {
+				g.log.Printf("Failed to marshal envelope: %v", err)
+				return
+			}
+			// Drop the envelope so it can be collected while the rest of
+			// the batch is written.
+			batch[i] = nil
+
+			bw.Write(line)     //nolint:errcheck
+			bw.WriteByte('\n') //nolint:errcheck
+			if bw.Buffered() >= ndjsonFlushBytes/2 {
+				if err := bw.Flush(); err != nil {
+					g.log.Printf("Failed to write response: %v", err)
+					return
+				}
+				if flusher != nil {
+					flusher.Flush()
+				}
+			}
+		}
+
+		if err := bw.Flush(); err != nil {
+			g.log.Printf("Failed to write response: %v", err)
+		}
+	})
+}
+
+// ndjsonError writes err the same way grpc-gateway writes errors for a
+// JSON Read.
+func (g *Gateway) ndjsonError(mux *runtime.ServeMux, w http.ResponseWriter, r *http.Request, err error) {
+	_, marshaler := runtime.MarshalerForRequest(mux, r)
+	runtime.HTTPError(r.Context(), mux, marshaler, w, r, err)
+}
+
+// acceptsNDJSON reports whether any of the media types in the Accept
+// header of r is application/x-ndjson.
+func acceptsNDJSON(r *http.Request) bool {
+	for _, accept := range r.Header.Values("Accept") {
+		for _, t := range strings.Split(accept, ",") {
+			mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(t))
+			if err == nil && mediaType == ndjsonMIME {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,94 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"code.cloudfoundry.org/log-cache/internal/promql"
+)
+
+// seriesBody is the response of the Prometheus /api/v1/series endpoint.
+type seriesBody struct {
+	Status string              `json:"status"`
+	Data   []map[string]string `json:"data"`
+}
+
+// handleSeries serves the Prometheus /api/v1/series endpoint. Every match[]
+// selector must have a source_id label; the matching source IDs are read
+// between start and end, which default to the beginning of the cache and
+// now.
+func (g *Gateway) handleSeries(r promql.DataReader) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if err := req.ParseForm(); err != nil {
+			g.writeSeriesError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		selectors := req.Form["match[]"]
+		if len(selectors) == 0 {
+			g.writeSeriesError(w, http.StatusBadRequest, fmt.Errorf("no match[] parameter provided"))
+			return
+		}
+		for _, s := range selectors {
+			sourceIDs, err := promql.ExtractSourceIds(s)
+			if err != nil {
+				g.writeSeriesError(w, http.StatusBadRequest, err)
+				return
+			}
+			if len(sourceIDs) == 0 {
+				g.writeSeriesError(w, http.StatusBadRequest, fmt.Errorf("selector %q must have a source_id label", s))
+				return
+			}
+		}
+
+		start := time.Unix(0, 0)
+		end := time.Now()
+		var err error
+		if v := req.Form.Get("start"); v != "" {
+			if start, err = promql.ParseTime(v); err != nil {
+				g.writeSeriesError(w, http.StatusBadRequest, err)
+				return
+			}
+		}
+		if v := req.Form.Get("end"); v != "" {
+			if end, err = promql.ParseTime(v); err != nil {
+				g.writeSeriesError(w, http.StatusBadRequest, err)
+				return
+			}
+		}
+
+		series, err := promql.Series(req.Context(), r, selectors, start, end)
+		if err != nil {
+			g.writeSeriesError(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+
+		g.writeSeriesJSON(w, http.StatusOK, &seriesBody{
+			Status: "success",
+			Data:   series,
+		})
+	}
+}
+
+func (g *Gateway) writeSeriesError(w http.ResponseWriter, code int, err error) {
+	errorType := "bad_data"
+	if code != http.StatusBadRequest {
+		errorType = "execution"
+	}
+
+	g.writeSeriesJSON(w, code, &errorBody{
+		Status:    "error",
+		ErrorType: errorType,
+		Error:     err.Error(),
+	})
+}
+
+func (g *Gateway) writeSeriesJSON(w http.ResponseWriter, code int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		g.log.Printf("Failed to write response: %v", err)
+	}
+}
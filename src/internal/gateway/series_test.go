@@ -0,0 +1,99 @@
+package gateway_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Series", func() {
+	// once returns the envelopes for the first read only, as a walk keeps
+	// reading until it gets an empty batch.
+	once := func(envelopes ...*loggregator_v2.Envelope) func() []*loggregator_v2.Envelope {
+		var o sync.Once
+		return func() []*loggregator_v2.Envelope {
+			var batch []*loggregator_v2.Envelope
+			o.Do(func() { batch = envelopes })
+			return batch
+		}
+	}
+
+	gauge := func(ts int64, sourceID, name string, tags map[string]string) *loggregator_v2.Envelope {
+		return &loggregator_v2.Envelope{
+			SourceId:  sourceID,
+			Timestamp: ts,
+			Tags:      tags,
+			Message: &loggregator_v2.Envelope_Gauge{
+				Gauge: &loggregator_v2.Gauge{
+					Metrics: map[string]*loggregator_v2.GaugeValue{
+						name: {Value: 1},
+					},
+				},
+			},
+		}
+	}
+
+	seriesURL := func(addr string, selectors ...string) string {
+		q := url.Values{"match[]": selectors}
+		return fmt.Sprintf("%s/api/v1/series?%s", addr, q.Encode())
+	}
+
+	It("returns the label sets of the matching series", func() {
+		gw, spyLogCache := tlsGatewayTestSetup()
+		ts := time.Now().Add(-time.Minute).UnixNano()
+		spyLogCache.ReadEnvelopes["some-id"] = once(
+			gauge(ts, "some-id", "cpu", map[string]string{"job": "router"}),
+			gauge(ts+1, "some-id", "cpu", map[string]string{"job": "router"}),
+			gauge(ts+2, "some-id", "cpu", map[string]string{"job": "cell"}),
+			gauge(ts+3, "some-id", "memory", map[string]string{"job": "router"}),
+		)
+		spyLogCache.ReadEnvelopes["other-id"] = once(
+			gauge(ts, "other-id", "cpu", nil),
+		)
+
+		resp, err := makeTLSReq(seriesURL(gw.Addr(), `cpu{source_id=~"some-id|other-id"}`))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+		var body struct {
+			Status string              `json:"status"`
+			Data   []map[string]string `json:"data"`
+		}
+		Expect(json.NewDecoder(resp.Body).Decode(&body)).To(Succeed())
+		Expect(body.Status).To(Equal("success"))
+		Expect(body.Data).To(ConsistOf(
+			map[string]string{"__name__": "cpu", "source_id": "some-id", "job": "router"},
+			map[string]string{"__name__": "cpu", "source_id": "some-id", "job": "cell"},
+			map[string]string{"__name__": "cpu", "source_id": "other-id"},
+		))
+	})
+
+	It("returns an error for a selector without a source_id", func() {
+		gw, _ := tlsGatewayTestSetup()
+
+		resp, err := makeTLSReq(seriesURL(gw.Addr(), `cpu{job="router"}`))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+
+		var body map[string]string
+		Expect(json.NewDecoder(resp.Body).Decode(&body)).To(Succeed())
+		Expect(body["errorType"]).To(Equal("bad_data"))
+		Expect(body["error"]).To(ContainSubstring("source_id"))
+	})
+
+	It("returns an error without a match[] parameter", func() {
+		gw, _ := tlsGatewayTestSetup()
+
+		resp, err := makeTLSReq(fmt.Sprintf("%s/api/v1/series", gw.Addr()))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+	})
+})
@@ -0,0 +1,61 @@
+package gateway
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"code.cloudfoundry.org/go-log-cache/v3/rpc/logcache_v1"
+)
+
+// writeMaxBytes bounds the body of a write. Log Cache rejects gRPC messages
+// over 4MB, so larger batches could not be sent on anyway.
+const writeMaxBytes = 4 << 20
+
+// handleWrite serves /api/v1/write, which accepts a SendRequest as JSON or,
+// with a Content-Type of application/x-protobuf, as binary protobuf and
+// sends it to the Ingress of Log Cache. The envelopes are routed to the
+// nodes that own their source IDs like every other write.
+func (g *Gateway) handleWrite(client logcache_v1.IngressClient, mux *runtime.ServeMux) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		inbound, outbound := runtime.MarshalerForRequest(mux, r)
+		ctx, err := runtime.AnnotateContext(r.Context(), mux, r, logcache_v1.Ingress_Send_FullMethodName)
+		if err != nil {
+			runtime.HTTPError(r.Context(), mux, outbound, w, r, err)
+			return
+		}
+
+		var req logcache_v1.SendRequest
+		err = inbound.NewDecoder(http.MaxBytesReader(w, r.Body, writeMaxBytes)).Decode(&req)
+		if err != nil && !errors.Is(err, io.EOF) {
+			runtime.HTTPError(ctx, mux, outbound, w, r, status.Errorf(codes.InvalidArgument, "%v", err))
+			return
+		}
+		if len(req.GetEnvelopes().GetBatch()) == 0 {
+			runtime.HTTPError(ctx, mux, outbound, w, r, status.Error(codes.InvalidArgument, "no envelopes to write"))
+			return
+		}
+		req.LocalOnly = false
+
+		var md runtime.ServerMetadata
+		resp, err := client.Send(ctx, &req, grpc.Header(&md.HeaderMD), grpc.Trailer(&md.TrailerMD))
+		if err != nil {
+			runtime.HTTPError(ctx, mux, outbound, w, r, err)
+			return
+		}
+
+		ctx = runtime.NewServerMetadataContext(ctx, md)
+		runtime.ForwardResponseMessage(ctx, mux, outbound, w, r, resp)
+	}
+}
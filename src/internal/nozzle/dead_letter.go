@@ -0,0 +1,66 @@
+package nozzle
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+)
+
+// deadLetterLog records a sample of the envelopes that could not be written
+// to LogCache. At most perSecond entries are written each second so that a
+// persistent failure can not fill the disk. A nil deadLetterLog records
+// nothing.
+type deadLetterLog struct {
+	w         io.Writer
+	perSecond int
+	now       func() time.Time
+
+	mu          sync.Mutex
+	windowStart time.Time
+	written     int
+}
+
+func newDeadLetterLog(w io.Writer, perSecond int) *deadLetterLog {
+	return &deadLetterLog{
+		w:         w,
+		perSecond: perSecond,
+		now:       time.Now,
+	}
+}
+
+// record writes a line with the source ID and type of each envelope and the
+// error that failed the write, until the rate limit is reached.
+func (d *deadLetterLog) record(envelopes []*loggregator_v2.Envelope, err error) {
+	if d == nil {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	if now.Sub(d.windowStart) >= time.Second {
+		d.windowStart = now
+		d.written = 0
+	}
+
+	for _, e := range envelopes {
+		if d.written >= d.perSecond {
+			return
+		}
+
+		// A failing writer has nowhere to report to; the envelopes are
+		// already counted by nozzle_err.
+		//nolint:errcheck
+		fmt.Fprintf(d.w, "%s source_id=%q type=%q error=%q\n",
+			now.UTC().Format(time.RFC3339Nano),
+			e.GetSourceId(),
+			envelopeType(e),
+			err.Error(),
+		)
+		d.written++
+	}
+}
@@ -0,0 +1,149 @@
+package nozzle
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/go-log-cache/v3/rpc/logcache_v1"
+	metrics "code.cloudfoundry.org/go-metric-registry"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	lcclient "code.cloudfoundry.org/log-cache/pkg/client"
+)
+
+// ingressStream writes batches to LogCache over a single SendStream. When the
+// stream fails, every batch that was not yet acknowledged is resent with the
+// unary Send and a new stream is opened for the next batch. If LogCache does
+// not support SendStream, all further batches use Send.
+type ingressStream struct {
+	streams *lcclient.IngressStreamClient
+	unary   logcache_v1.IngressClient
+	log     *slog.Logger
+
+	egressCounter   metrics.Counter
+	errCounter      metrics.Counter
+	fallbackCounter metrics.Counter
+	deadLetters     *deadLetterLog
+
+	mu       sync.Mutex
+	stream   *lcclient.IngressSendStream
+	cancel   context.CancelFunc
+	pending  []*logcache_v1.SendRequest
+	acked    int64
+	disabled bool
+}
+
+// Send writes the batch to the open stream, opening one if necessary.
+func (s *ingressStream) Send(req *logcache_v1.SendRequest) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.disabled {
+		s.sendUnary(req)
+		return
+	}
+
+	if s.stream == nil {
+		if err := s.open(); err != nil {
+			s.log.Error("failed to open ingress stream", "error", err)
+			s.sendUnary(req)
+			return
+		}
+	}
+
+	s.pending = append(s.pending, req)
+	if err := s.stream.Send(req); err != nil {
+		s.fallback(err)
+	}
+}
+
+func (s *ingressStream) open() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := s.streams.SendStream(ctx)
+	if err != nil {
+		cancel()
+		return err
+	}
+
+	s.stream = stream
+	s.cancel = cancel
+	s.acked = 0
+
+	go s.readAcks(stream)
+
+	return nil
+}
+
+func (s *ingressStream) readAcks(stream *lcclient.IngressSendStream) {
+	for {
+		written, err := stream.Recv()
+
+		s.mu.Lock()
+		if s.stream != stream {
+			s.mu.Unlock()
+			return
+		}
+
+		if err != nil {
+			if status.Code(err) == codes.Unimplemented {
+				s.log.Warn("log cache does not support SendStream, falling back to Send")
+				s.disabled = true
+			}
+			s.fallback(err)
+			s.mu.Unlock()
+			return
+		}
+
+		s.ack(written)
+		s.mu.Unlock()
+	}
+}
+
+// ack drops the batches acknowledged since the last ack from pending. It
+// must be called with mu held.
+func (s *ingressStream) ack(written int64) {
+	n := int(written - s.acked)
+	if n <= 0 || n > len(s.pending) {
+		return
+	}
+
+	for _, req := range s.pending[:n] {
+		s.egressCounter.Add(float64(len(req.GetEnvelopes().GetBatch())))
+	}
+	s.pending = s.pending[n:]
+	s.acked = written
+}
+
+// fallback closes the current stream and resends every unacknowledged batch
+// with Send. It must be called with mu held.
+func (s *ingressStream) fallback(err error) {
+	s.fallbackCounter.Add(1)
+	if !s.disabled {
+		s.log.Error("ingress stream failed, resending batches", "count", len(s.pending), "error", err)
+	}
+
+	s.cancel()
+	s.stream = nil
+
+	pending := s.pending
+	s.pending = nil
+	for _, req := range pending {
+		s.sendUnary(req)
+	}
+}
+
+func (s *ingressStream) sendUnary(req *logcache_v1.SendRequest) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if _, err := s.unary.Send(ctx, req); err != nil {
+		s.errCounter.Add(1)
+		s.deadLetters.record(req.GetEnvelopes().GetBatch(), err)
+		return
+	}
+
+	s.egressCounter.Add(float64(len(req.GetEnvelopes().GetBatch())))
+}
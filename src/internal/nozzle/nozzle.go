@@ -1,7 +1,9 @@
 package nozzle
 
 import (
+	"io"
 	"log"
+	"log/slog"
 	"runtime"
 	"time"
 
@@ -11,6 +13,7 @@ import (
 	diodes "code.cloudfoundry.org/go-diodes"
 	"code.cloudfoundry.org/go-log-cache/v3/rpc/logcache_v1"
 	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	lcclient "code.cloudfoundry.org/log-cache/pkg/client"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
@@ -23,7 +26,7 @@ type Metrics interface {
 
 // Nozzle reads envelopes and writes them to LogCache.
 type Nozzle struct {
-	log          *log.Logger
+	log          *slog.Logger
 	s            StreamConnector
 	metrics      Metrics
 	shardId      string
@@ -34,9 +37,29 @@ type Nozzle struct {
 	egressCounter  metrics.Counter
 	errCounter     metrics.Counter
 
+	secondaryDroppedCounter metrics.Counter
+	streamFallbackCounter   metrics.Counter
+	reconnectCounter        metrics.Counter
+
+	// Reconnect backoff for the logs provider stream. Reconnecting is
+	// disabled if reconnectInitial is 0.
+	reconnectInitial time.Duration
+	reconnectMax     time.Duration
+
+	sourceIDSuffixes map[string]string
+
+	deadLetters *deadLetterLog
+
 	// LogCache
 	addr string
 	opts []grpc.DialOption
+
+	// useIngressStream writes batches over SendStream instead of Send.
+	useIngressStream bool
+
+	// Secondary LogCache
+	secondaryAddr string
+	secondaryOpts []grpc.DialOption
 }
 
 const (
@@ -51,7 +74,7 @@ type StreamConnector interface {
 }
 
 // NewNozzle creates a new Nozzle.
-func NewNozzle(c StreamConnector, logCacheAddr string, m Metrics, logger *log.Logger, opts ...NozzleOption) *Nozzle {
+func NewNozzle(c StreamConnector, logCacheAddr string, m Metrics, logger *slog.Logger, opts ...NozzleOption) *Nozzle {
 	n := &Nozzle{
 		s:         c,
 		addr:      logCacheAddr,
@@ -66,7 +89,7 @@ func NewNozzle(c StreamConnector, logCacheAddr string, m Metrics, logger *log.Lo
 	}
 
 	n.streamBuffer = diodes.NewOneToOne(100000, diodes.AlertFunc(func(missed int) {
-		n.log.Printf("stream buffer dropped %d points", missed)
+		n.log.Warn("stream buffer dropped points", "count", missed)
 	}))
 
 	return n
@@ -95,10 +118,68 @@ func WithSelectors(selectors ...string) NozzleOption {
 	}
 }
 
+// WithSecondaryLogCache returns a NozzleOption that configures a second
+// LogCache that every batch is also written to. Failures writing to the
+// secondary are counted but do not affect writes to the primary. It defaults
+// to no secondary.
+func WithSecondaryLogCache(addr string, opts ...grpc.DialOption) NozzleOption {
+	return func(n *Nozzle) {
+		n.secondaryAddr = addr
+		n.secondaryOpts = opts
+	}
+}
+
+// WithSourceIDSuffix returns a NozzleOption that appends the given suffix to
+// the source ID of every envelope of the given types before it is written to
+// LogCache. Envelope types use the same names as selectors (e.g. "log",
+// "counter", "gauge"). Other envelopes keep their original source ID.
+func WithSourceIDSuffix(suffix string, envelopeTypes ...string) NozzleOption {
+	return func(n *Nozzle) {
+		if n.sourceIDSuffixes == nil {
+			n.sourceIDSuffixes = make(map[string]string)
+		}
+
+		for _, t := range envelopeTypes {
+			n.sourceIDSuffixes[t] = suffix
+		}
+	}
+}
+
+// WithIngressStream returns a NozzleOption that writes batches to LogCache
+// over a long lived SendStream instead of a Send call per batch. Batches
+// that are not acknowledged when a stream fails are resent with Send. It
+// defaults to Send.
+func WithIngressStream() NozzleOption {
+	return func(n *Nozzle) {
+		n.useIngressStream = true
+	}
+}
+
+// WithReconnectBackoff returns a NozzleOption that reconnects to the logs
+// provider when its stream ends. The first reconnect waits initial and each
+// consecutive one waits twice as long as the last, up to max. The wait is
+// reset once a batch is read. It defaults to no reconnects.
+func WithReconnectBackoff(initial, max time.Duration) NozzleOption {
+	return func(n *Nozzle) {
+		n.reconnectInitial = initial
+		n.reconnectMax = max
+	}
+}
+
+// WithDeadLetterLog returns a NozzleOption that writes the source ID and
+// type of envelopes that fail to be written to LogCache, along with the
+// error, to w. At most perSecond envelopes are written each second. It
+// defaults to no dead-letter log.
+func WithDeadLetterLog(w io.Writer, perSecond int) NozzleOption {
+	return func(n *Nozzle) {
+		n.deadLetters = newDeadLetterLog(w, perSecond)
+	}
+}
+
 // Start starts reading envelopes from the logs provider and writes them to
 // LogCache. It blocks indefinitely.
 func (n *Nozzle) Start() {
-	rx := n.s.Stream(context.Background(), n.buildBatchReq())
+	rx, cancel := n.openStream()
 
 	conn, err := grpc.NewClient(n.addr, n.opts...)
 	if err != nil {
@@ -106,6 +187,15 @@ func (n *Nozzle) Start() {
 	}
 	client := logcache_v1.NewIngressClient(conn)
 
+	var secondary logcache_v1.IngressClient
+	if n.secondaryAddr != "" {
+		secondaryConn, err := grpc.NewClient(n.secondaryAddr, n.secondaryOpts...)
+		if err != nil {
+			log.Fatalf("failed to dial %s: %s", n.secondaryAddr, err)
+		}
+		secondary = logcache_v1.NewIngressClient(secondaryConn)
+	}
+
 	n.ingressCounter = n.metrics.NewCounter(
 		"nozzle_ingress",
 		"Total envelopes ingressed.",
@@ -118,14 +208,30 @@ func (n *Nozzle) Start() {
 		"nozzle_err",
 		"Total errors while egressing to log cache.",
 	)
+	n.secondaryDroppedCounter = n.metrics.NewCounter(
+		"nozzle_secondary_dropped",
+		"Total envelopes that failed to be written to the secondary log cache.",
+	)
+	n.streamFallbackCounter = n.metrics.NewCounter(
+		"nozzle_stream_fallbacks",
+		"Total times a failed ingress stream fell back to unary writes.",
+	)
+	n.reconnectCounter = n.metrics.NewCounter(
+		"nozzle_stream_reconnects",
+		"Total reconnects to the logs provider stream.",
+	)
 
-	go n.envelopeReader(rx)
+	go n.envelopeReader(rx, cancel)
 
 	ch := make(chan []*loggregator_v2.Envelope, BATCH_CHANNEL_SIZE)
 
-	log.Printf("Starting %d workers...", 2*runtime.NumCPU())
+	n.log.Info("starting workers", "count", 2*runtime.NumCPU())
 	for i := 0; i < 2*runtime.NumCPU(); i++ {
-		go n.envelopeWriter(ch, client)
+		if n.useIngressStream {
+			go n.envelopeStreamWriter(ch, n.newIngressStream(conn, client), secondary)
+			continue
+		}
+		go n.envelopeWriter(ch, client, secondary)
 	}
 
 	// The batcher will block indefinitely.
@@ -173,19 +279,25 @@ func (n *Nozzle) envelopeBatcher(ch chan []*loggregator_v2.Envelope) {
 	}
 }
 
-func (n *Nozzle) envelopeWriter(ch chan []*loggregator_v2.Envelope, client logcache_v1.IngressClient) {
+func (n *Nozzle) envelopeWriter(ch chan []*loggregator_v2.Envelope, client, secondary logcache_v1.IngressClient) {
 	for {
 		envelopes := <-ch
-
-		ctx, _ := context.WithTimeout(context.Background(), 3*time.Second)
-		_, err := client.Send(ctx, &logcache_v1.SendRequest{
+		req := &logcache_v1.SendRequest{
 			Envelopes: &loggregator_v2.EnvelopeBatch{
 				Batch: envelopes,
 			},
-		})
+		}
+
+		if secondary != nil {
+			go n.writeSecondary(secondary, req)
+		}
+
+		ctx, _ := context.WithTimeout(context.Background(), 3*time.Second)
+		_, err := client.Send(ctx, req)
 
 		if err != nil {
 			n.errCounter.Add(1)
+			n.deadLetters.record(envelopes, err)
 			continue
 		}
 
@@ -193,16 +305,106 @@ func (n *Nozzle) envelopeWriter(ch chan []*loggregator_v2.Envelope, client logca
 	}
 }
 
-func (n *Nozzle) envelopeReader(rx loggregator.EnvelopeStream) {
+func (n *Nozzle) newIngressStream(conn *grpc.ClientConn, client logcache_v1.IngressClient) *ingressStream {
+	return &ingressStream{
+		streams:         lcclient.NewIngressStreamClient(conn),
+		unary:           client,
+		log:             n.log,
+		egressCounter:   n.egressCounter,
+		errCounter:      n.errCounter,
+		fallbackCounter: n.streamFallbackCounter,
+		deadLetters:     n.deadLetters,
+	}
+}
+
+func (n *Nozzle) envelopeStreamWriter(ch chan []*loggregator_v2.Envelope, stream *ingressStream, secondary logcache_v1.IngressClient) {
+	for {
+		envelopes := <-ch
+		req := &logcache_v1.SendRequest{
+			Envelopes: &loggregator_v2.EnvelopeBatch{
+				Batch: envelopes,
+			},
+		}
+
+		if secondary != nil {
+			go n.writeSecondary(secondary, req)
+		}
+
+		stream.Send(req)
+	}
+}
+
+func (n *Nozzle) writeSecondary(client logcache_v1.IngressClient, req *logcache_v1.SendRequest) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := client.Send(ctx, req)
+	if err != nil {
+		n.secondaryDroppedCounter.Add(float64(len(req.GetEnvelopes().GetBatch())))
+	}
+}
+
+func (n *Nozzle) openStream() (loggregator.EnvelopeStream, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	return n.s.Stream(ctx, n.buildBatchReq()), cancel
+}
+
+func (n *Nozzle) envelopeReader(rx loggregator.EnvelopeStream, cancel context.CancelFunc) {
+	backoff := n.reconnectInitial
 	for {
 		envelopeBatch := rx()
+
+		// A stream only returns an empty batch once it has given up, e.g.
+		// because the logs provider went away.
+		if len(envelopeBatch) == 0 && n.reconnectInitial > 0 {
+			cancel()
+			n.log.Info("logs provider stream ended, reconnecting", "backoff", backoff)
+			time.Sleep(backoff)
+			backoff = min(2*backoff, n.reconnectMax)
+
+			n.reconnectCounter.Add(1)
+			rx, cancel = n.openStream()
+			continue
+		}
+		if len(envelopeBatch) > 0 {
+			backoff = n.reconnectInitial
+		}
+
 		for _, envelope := range envelopeBatch {
+			n.rewriteSourceID(envelope)
 			n.streamBuffer.Set(diodes.GenericDataType(envelope))
 			n.ingressCounter.Add(1)
 		}
 	}
 }
 
+func (n *Nozzle) rewriteSourceID(e *loggregator_v2.Envelope) {
+	if len(n.sourceIDSuffixes) == 0 {
+		return
+	}
+
+	if suffix, ok := n.sourceIDSuffixes[envelopeType(e)]; ok {
+		e.SourceId += suffix
+	}
+}
+
+func envelopeType(e *loggregator_v2.Envelope) string {
+	switch e.GetMessage().(type) {
+	case *loggregator_v2.Envelope_Log:
+		return "log"
+	case *loggregator_v2.Envelope_Gauge:
+		return "gauge"
+	case *loggregator_v2.Envelope_Counter:
+		return "counter"
+	case *loggregator_v2.Envelope_Timer:
+		return "timer"
+	case *loggregator_v2.Envelope_Event:
+		return "event"
+	default:
+		return ""
+	}
+}
+
 var selectorTypes = map[string]*loggregator_v2.Selector{
 	"log": {
 		Message: &loggregator_v2.Selector_Log{
@@ -1,8 +1,12 @@
 package nozzle_test
 
 import (
-	"log"
+	"bytes"
+	"log/slog"
+	"net"
+	"strings"
 	"sync"
+	"time"
 
 	"code.cloudfoundry.org/go-metric-registry/testhelpers"
 
@@ -25,14 +29,14 @@ var _ = Describe("Nozzle", func() {
 		streamConnector *spyStreamConnector
 		logCache        *testing.SpyLogCache
 		spyMetrics      *testhelpers.SpyMetricsRegistry
-		logger          *log.Logger
+		logger          *slog.Logger
 	)
 	Context("Without tls", func() {
 		BeforeEach(func() {
 			streamConnector = newSpyStreamConnector()
 			spyMetrics = testhelpers.NewMetricsRegistry()
 			logCache = testing.NewSpyLogCache(nil)
-			logger = log.New(GinkgoWriter, "", log.LstdFlags)
+			logger = slog.New(slog.NewTextHandler(GinkgoWriter, nil))
 			addr := logCache.Start()
 
 			n = NewNozzle(streamConnector, addr, spyMetrics, logger,
@@ -55,6 +59,234 @@ var _ = Describe("Nozzle", func() {
 		})
 	})
 
+	Context("With a reconnect backoff", func() {
+		BeforeEach(func() {
+			streamConnector = newSpyStreamConnector()
+			spyMetrics = testhelpers.NewMetricsRegistry()
+			logCache = testing.NewSpyLogCache(nil)
+			logger = slog.New(slog.NewTextHandler(GinkgoWriter, nil))
+
+			// The spy stream returns an empty batch, i.e. ends, whenever it
+			// has no envelopes.
+			n = NewNozzle(streamConnector, logCache.Start(), spyMetrics, logger,
+				WithDialOpts(grpc.WithTransportCredentials(insecure.NewCredentials())),
+				WithReconnectBackoff(10*time.Millisecond, 80*time.Millisecond),
+			)
+			go n.Start()
+		})
+
+		It("grows the delay between reconnects up to the max", func() {
+			Eventually(streamConnector.reconnectDelays, 5).Should(HaveLen(6))
+
+			delays := streamConnector.reconnectDelays()
+			Expect(delays[0]).To(BeNumerically(">=", 10*time.Millisecond))
+			Expect(delays[1]).To(BeNumerically(">=", 20*time.Millisecond))
+			Expect(delays[2]).To(BeNumerically(">=", 40*time.Millisecond))
+			Expect(delays[3]).To(BeNumerically(">=", 80*time.Millisecond))
+			Expect(delays[5]).To(BeNumerically("<", 160*time.Millisecond))
+
+			Eventually(func() float64 {
+				return spyMetrics.GetMetricValue("nozzle_stream_reconnects", nil)
+			}).Should(BeNumerically(">=", 6))
+		})
+
+		It("resets the delay once a batch is read", func() {
+			Eventually(streamConnector.reconnectDelays, 5).Should(HaveLen(4))
+			addEnvelope(1, "some-source-id", streamConnector)
+			Eventually(logCache.GetEnvelopes, 5).Should(HaveLen(1))
+
+			// Without a reset every delay after the first four would be 80ms.
+			Expect(streamConnector.reconnectDelays()[4:]).To(
+				ContainElement(BeNumerically("<", 40*time.Millisecond)),
+			)
+		})
+	})
+
+	Context("With a dead-letter log", func() {
+		var deadLetters *syncBuffer
+
+		BeforeEach(func() {
+			streamConnector = newSpyStreamConnector()
+			spyMetrics = testhelpers.NewMetricsRegistry()
+			logCache = testing.NewSpyLogCache(nil)
+			logger = slog.New(slog.NewTextHandler(GinkgoWriter, nil))
+			deadLetters = &syncBuffer{}
+
+			n = NewNozzle(streamConnector, logCache.Start(), spyMetrics, logger,
+				WithDialOpts(grpc.WithTransportCredentials(insecure.NewCredentials())),
+				WithDeadLetterLog(deadLetters, 2),
+			)
+			go n.Start()
+		})
+
+		It("writes failed envelopes up to the rate limit", func() {
+			logCache.FailNextSends(100)
+			for i := int64(1); i <= 5; i++ {
+				addEnvelope(i, "some-source-id", streamConnector)
+			}
+
+			Eventually(func() float64 {
+				return spyMetrics.GetMetricValue("nozzle_err", nil)
+			}, 5).ShouldNot(BeZero())
+			Eventually(deadLetters.lines).Should(HaveLen(2))
+			Consistently(deadLetters.lines, 500*time.Millisecond).Should(HaveLen(2))
+
+			Expect(deadLetters.lines()[0]).To(ContainSubstring(`source_id="some-source-id"`))
+			Expect(deadLetters.lines()[0]).To(ContainSubstring(`error="rpc error: code = Unknown desc = send failure"`))
+		})
+
+		It("does not write envelopes that were written to LogCache", func() {
+			addEnvelope(1, "some-source-id", streamConnector)
+
+			Eventually(logCache.GetEnvelopes, 5).Should(HaveLen(1))
+			Expect(deadLetters.lines()).To(BeEmpty())
+		})
+	})
+
+	Context("With a secondary log cache", func() {
+		var secondary *testing.SpyLogCache
+
+		It("writes each envelope to both log caches", func() {
+			streamConnector = newSpyStreamConnector()
+			spyMetrics = testhelpers.NewMetricsRegistry()
+			logCache = testing.NewSpyLogCache(nil)
+			secondary = testing.NewSpyLogCache(nil)
+			logger = slog.New(slog.NewTextHandler(GinkgoWriter, nil))
+
+			n = NewNozzle(streamConnector, logCache.Start(), spyMetrics, logger,
+				WithDialOpts(grpc.WithTransportCredentials(insecure.NewCredentials())),
+				WithSecondaryLogCache(secondary.Start(), grpc.WithTransportCredentials(insecure.NewCredentials())),
+			)
+			go n.Start()
+
+			addEnvelope(1, "some-source-id", streamConnector)
+			addEnvelope(2, "some-source-id", streamConnector)
+
+			Eventually(logCache.GetEnvelopes, 5).Should(HaveLen(2))
+			Eventually(secondary.GetEnvelopes, 5).Should(HaveLen(2))
+			Expect(spyMetrics.GetMetricValue("nozzle_secondary_dropped", nil)).To(BeZero())
+		})
+
+		It("still writes to the primary when the secondary fails", func() {
+			streamConnector = newSpyStreamConnector()
+			spyMetrics = testhelpers.NewMetricsRegistry()
+			logCache = testing.NewSpyLogCache(nil)
+			logger = slog.New(slog.NewTextHandler(GinkgoWriter, nil))
+
+			lis, err := net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).ToNot(HaveOccurred())
+			unreachableAddr := lis.Addr().String()
+			lis.Close()
+
+			n = NewNozzle(streamConnector, logCache.Start(), spyMetrics, logger,
+				WithDialOpts(grpc.WithTransportCredentials(insecure.NewCredentials())),
+				WithSecondaryLogCache(unreachableAddr, grpc.WithTransportCredentials(insecure.NewCredentials())),
+			)
+			go n.Start()
+
+			addEnvelope(1, "some-source-id", streamConnector)
+			addEnvelope(2, "some-source-id", streamConnector)
+
+			Eventually(logCache.GetEnvelopes, 5).Should(HaveLen(2))
+			Eventually(func() float64 {
+				return spyMetrics.GetMetricValue("nozzle_secondary_dropped", nil)
+			}, 5).Should(Equal(2.0))
+			Eventually(func() float64 {
+				return spyMetrics.GetMetricValue("nozzle_egress", nil)
+			}).Should(Equal(2.0))
+			Expect(spyMetrics.GetMetricValue("nozzle_err", nil)).To(BeZero())
+		})
+	})
+
+	Context("With an ingress stream", func() {
+		BeforeEach(func() {
+			streamConnector = newSpyStreamConnector()
+			spyMetrics = testhelpers.NewMetricsRegistry()
+			logCache = testing.NewSpyLogCache(nil)
+			logger = slog.New(slog.NewTextHandler(GinkgoWriter, nil))
+		})
+
+		It("writes every streamed batch to the LogCache", func() {
+			n = NewNozzle(streamConnector, logCache.Start(), spyMetrics, logger,
+				WithDialOpts(grpc.WithTransportCredentials(insecure.NewCredentials())),
+				WithIngressStream(),
+			)
+			go n.Start()
+
+			addEnvelope(1, "some-source-id", streamConnector)
+			Eventually(logCache.GetEnvelopes, 5).Should(HaveLen(1))
+			addEnvelope(2, "some-source-id", streamConnector)
+			addEnvelope(3, "some-source-id", streamConnector)
+
+			Eventually(logCache.GetEnvelopes, 5).Should(HaveLen(3))
+			Eventually(func() float64 {
+				return spyMetrics.GetMetricValue("nozzle_egress", nil)
+			}).Should(Equal(3.0))
+			Expect(spyMetrics.GetMetricValue("nozzle_stream_fallbacks", nil)).To(BeZero())
+		})
+
+		It("resends unacknowledged batches after a mid-stream error", func() {
+			logCache.FailNextSends(1)
+			n = NewNozzle(streamConnector, logCache.Start(), spyMetrics, logger,
+				WithDialOpts(grpc.WithTransportCredentials(insecure.NewCredentials())),
+				WithIngressStream(),
+			)
+			go n.Start()
+
+			addEnvelope(1, "some-source-id", streamConnector)
+			Eventually(func() float64 {
+				return spyMetrics.GetMetricValue("nozzle_stream_fallbacks", nil)
+			}, 5).Should(Equal(1.0))
+			Eventually(logCache.GetEnvelopes, 5).Should(HaveLen(1))
+
+			addEnvelope(2, "some-source-id", streamConnector)
+			Eventually(logCache.GetEnvelopes, 5).Should(HaveLen(2))
+			Eventually(func() float64 {
+				return spyMetrics.GetMetricValue("nozzle_egress", nil)
+			}).Should(Equal(2.0))
+			Expect(spyMetrics.GetMetricValue("nozzle_stream_fallbacks", nil)).To(Equal(1.0))
+			Expect(spyMetrics.GetMetricValue("nozzle_err", nil)).To(BeZero())
+		})
+	})
+
+	Context("With source ID suffixes", func() {
+		BeforeEach(func() {
+			streamConnector = newSpyStreamConnector()
+			spyMetrics = testhelpers.NewMetricsRegistry()
+			logCache = testing.NewSpyLogCache(nil)
+			logger = slog.New(slog.NewTextHandler(GinkgoWriter, nil))
+
+			n = NewNozzle(streamConnector, logCache.Start(), spyMetrics, logger,
+				WithDialOpts(grpc.WithTransportCredentials(insecure.NewCredentials())),
+				WithSourceIDSuffix(".metrics", "counter", "gauge"),
+			)
+			go n.Start()
+		})
+
+		It("rewrites the source ID of matching envelope types only", func() {
+			streamConnector.envelopes <- []*loggregator_v2.Envelope{
+				{
+					Timestamp: 1,
+					SourceId:  "some-source-id",
+					Message: &loggregator_v2.Envelope_Counter{
+						Counter: &loggregator_v2.Counter{Name: "some-counter"},
+					},
+				},
+				{
+					Timestamp: 2,
+					SourceId:  "some-source-id",
+					Message: &loggregator_v2.Envelope_Log{
+						Log: &loggregator_v2.Log{Payload: []byte("some-log")},
+					},
+				},
+			}
+
+			Eventually(logCache.GetEnvelopes, 5).Should(HaveLen(2))
+			Expect(logCache.GetEnvelopes()[0].SourceId).To(Equal("some-source-id.metrics"))
+			Expect(logCache.GetEnvelopes()[1].SourceId).To(Equal("some-source-id"))
+		})
+	})
+
 	Context("With custom envelope selectors", func() {
 		BeforeEach(func() {
 			tlsConfig, err := testing.NewTLSConfig(
@@ -67,7 +299,7 @@ var _ = Describe("Nozzle", func() {
 			streamConnector = newSpyStreamConnector()
 			spyMetrics = testhelpers.NewMetricsRegistry()
 			logCache = testing.NewSpyLogCache(tlsConfig)
-			logger = log.New(GinkgoWriter, "", log.LstdFlags)
+			logger = slog.New(slog.NewTextHandler(GinkgoWriter, nil))
 			addr := logCache.Start()
 
 			n = NewNozzle(streamConnector, addr, spyMetrics, logger,
@@ -116,7 +348,7 @@ var _ = Describe("Nozzle", func() {
 			streamConnector = newSpyStreamConnector()
 			spyMetrics = testhelpers.NewMetricsRegistry()
 			logCache = testing.NewSpyLogCache(tlsConfig)
-			logger = log.New(GinkgoWriter, "", log.LstdFlags)
+			logger = slog.New(slog.NewTextHandler(GinkgoWriter, nil))
 			addr := logCache.Start()
 
 			n = NewNozzle(streamConnector, addr, spyMetrics, logger,
@@ -200,6 +432,26 @@ var _ = Describe("Nozzle", func() {
 	})
 })
 
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) lines() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.buf.Len() == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(b.buf.String(), "\n"), "\n")
+}
+
 func addEnvelope(timestamp int64, sourceID string, c *spyStreamConnector) {
 	c.envelopes <- []*loggregator_v2.Envelope{
 		{
@@ -210,9 +462,10 @@ func addEnvelope(timestamp int64, sourceID string, c *spyStreamConnector) {
 }
 
 type spyStreamConnector struct {
-	mu        sync.Mutex
-	requests_ []*loggregator_v2.EgressBatchRequest
-	envelopes chan []*loggregator_v2.Envelope
+	mu          sync.Mutex
+	requests_   []*loggregator_v2.EgressBatchRequest
+	streamTimes []time.Time
+	envelopes   chan []*loggregator_v2.Envelope
 }
 
 func newSpyStreamConnector() *spyStreamConnector {
@@ -225,6 +478,7 @@ func (s *spyStreamConnector) Stream(ctx context.Context, req *loggregator_v2.Egr
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.requests_ = append(s.requests_, req)
+	s.streamTimes = append(s.streamTimes, time.Now())
 
 	return func() []*loggregator_v2.Envelope {
 		select {
@@ -236,6 +490,19 @@ func (s *spyStreamConnector) Stream(ctx context.Context, req *loggregator_v2.Egr
 	}
 }
 
+// reconnectDelays returns the time between consecutive Stream calls.
+func (s *spyStreamConnector) reconnectDelays() []time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var delays []time.Duration
+	for i := 1; i < len(s.streamTimes); i++ {
+		delays = append(delays, s.streamTimes[i].Sub(s.streamTimes[i-1]))
+	}
+
+	return delays
+}
+
 func (s *spyStreamConnector) requests() []*loggregator_v2.EgressBatchRequest {
 	s.mu.Lock()
 	defer s.mu.Unlock()
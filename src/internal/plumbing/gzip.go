@@ -0,0 +1,71 @@
+package plumbing
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"slices"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+)
+
+// GzipCompressor is the name of the gzip gRPC compressor. It is the same
+// name the compressor in grpc/encoding/gzip registers, so peers that use
+// that one can talk to peers that use this one.
+const GzipCompressor = "gzip"
+
+func init() {
+	encoding.RegisterCompressor(&gzipCompressor{})
+}
+
+type gzipCompressor struct {
+	writers sync.Pool
+}
+
+func (c *gzipCompressor) Name() string {
+	return GzipCompressor
+}
+
+func (c *gzipCompressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	z, ok := c.writers.Get().(*gzip.Writer)
+	if !ok {
+		return &pooledGzipWriter{Writer: gzip.NewWriter(w), pool: &c.writers}, nil
+	}
+	z.Reset(w)
+
+	return &pooledGzipWriter{Writer: z, pool: &c.writers}, nil
+}
+
+func (c *gzipCompressor) Decompress(r io.Reader) (io.Reader, error) {
+	return gzip.NewReader(r)
+}
+
+// pooledGzipWriter returns its writer to the pool once it is closed.
+type pooledGzipWriter struct {
+	*gzip.Writer
+	pool *sync.Pool
+}
+
+func (w *pooledGzipWriter) Close() error {
+	defer w.pool.Put(w.Writer)
+	return w.Writer.Close()
+}
+
+// CompressResponses returns a grpc.UnaryServerInterceptor that gzips the
+// responses of the given methods for clients that accept gzip, even if
+// their requests were not compressed.
+func CompressResponses(methods ...string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if slices.Contains(methods, info.FullMethod) {
+			accepted, err := grpc.ClientSupportedCompressors(ctx)
+			if err == nil && slices.Contains(accepted, GzipCompressor) {
+				// The response is only sent uncompressed if this fails.
+				_ = grpc.SetSendCompressor(ctx, GzipCompressor)
+			}
+		}
+
+		return handler(ctx, req)
+	}
+}
@@ -0,0 +1,34 @@
+package plumbing
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+)
+
+// NewLogger returns a structured logger that writes entries at or above
+// level to w. With rfc3339 set, times are written in UTC in the same format
+// as LogWriter.
+func NewLogger(w io.Writer, level slog.Level, rfc3339 bool) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: level}
+	if rfc3339 {
+		opts.ReplaceAttr = func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey && len(groups) == 0 {
+				a.Value = slog.StringValue(a.Value.Time().UTC().Format(rfc3339Format))
+			}
+			return a
+		}
+	}
+
+	return slog.New(slog.NewTextHandler(w, opts))
+}
+
+// ParseLogLevel parses a log level of debug, info, warn or error.
+func ParseLogLevel(level string) (slog.Level, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return 0, fmt.Errorf("log level must be debug, info, warn or error, got %q", level)
+	}
+
+	return l, nil
+}
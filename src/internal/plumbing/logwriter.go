@@ -6,10 +6,14 @@ import (
 	"time"
 )
 
+// rfc3339Format is the UTC timestamp format used when RFC3339 logging is
+// enabled.
+const rfc3339Format = "2006-01-02T15:04:05.000000000Z"
+
 type LogWriter struct {
 }
 
 func (writer LogWriter) Write(bytes []byte) (int, error) {
-	str := time.Now().UTC().Format("2006-01-02T15:04:05.000000000Z") + " " + string(bytes)
+	str := time.Now().UTC().Format(rfc3339Format) + " " + string(bytes)
 	return io.WriteString(os.Stderr, str)
 }
@@ -2,11 +2,13 @@ package promql
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"regexp"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	metrics "code.cloudfoundry.org/go-metric-registry"
@@ -16,6 +18,18 @@ import (
 	"github.com/prometheus/prometheus/pkg/labels"
 	"github.com/prometheus/prometheus/promql"
 	"github.com/prometheus/prometheus/storage"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// EngineMaxConcurrent is the number of queries a PromQL engine runs
+	// at once.
+	EngineMaxConcurrent = 10
+
+	// EngineMaxSamples is the number of samples a single query may load
+	// into memory before it fails.
+	EngineMaxSamples = 50000000
 )
 
 type PromQL struct {
@@ -23,9 +37,17 @@ type PromQL struct {
 	log          *log.Logger
 	queryTimeout time.Duration
 
+	readConcurrency  int
+	rangeStreamSteps int
+	cache            *queryCache
+	sanitizeExempt   map[string]struct{}
+	slowQuery        time.Duration
+
 	failureCounter    metrics.Counter
 	instantQueryTimer metrics.Gauge
 	rangeQueryTimer   metrics.Gauge
+	resultSeries      metrics.Gauge
+	resultSamples     metrics.Gauge
 
 	result int64
 
@@ -46,11 +68,14 @@ func New(
 	m Metrics,
 	log *log.Logger,
 	queryTimeout time.Duration,
+	opts ...PromQLOption,
 ) *PromQL {
 	q := &PromQL{
-		r:            r,
-		log:          log,
-		queryTimeout: queryTimeout,
+		r:                r,
+		log:              log,
+		queryTimeout:     queryTimeout,
+		readConcurrency:  10,
+		rangeStreamSteps: 250,
 		failureCounter: m.NewCounter(
 			"log_cache_promql_timeout",
 			"Total number of errors while executing queries.",
@@ -67,13 +92,93 @@ func New(
 			"Duration of last range query in milliseconds.",
 			metrics.WithMetricLabels(map[string]string{"unit": "milliseconds"}),
 		),
+		resultSeries: m.NewGauge(
+			"log_cache_promql_result_series",
+			"Number of series returned by the last query.",
+		),
+		resultSamples: m.NewGauge(
+			"log_cache_promql_result_samples",
+			"Number of samples returned by the last query.",
+		),
 		result: 1,
 	}
 
+	for _, o := range opts {
+		o(q)
+	}
+
+	if q.readConcurrency < 1 {
+		q.readConcurrency = 1
+	}
+
+	if q.rangeStreamSteps < 1 {
+		q.rangeStreamSteps = 1
+	}
+
 	return q
 }
 
+// PromQLOption configures a PromQL.
+type PromQLOption func(*PromQL)
+
+// WithQueryCache caches instant query results, keyed by the normalized query
+// and evaluation time, for ttl so that repeated identical queries do not read
+// the store again. At most maxEntries results are held. Range queries are
+// never cached. It is disabled by default.
+func WithQueryCache(ttl time.Duration, maxEntries int) PromQLOption {
+	return func(q *PromQL) {
+		if ttl <= 0 || maxEntries <= 0 {
+			q.cache = nil
+			return
+		}
+		q.cache = newQueryCache(ttl, maxEntries)
+	}
+}
+
+// WithSourceIDReadConcurrency sets how many source IDs a single query reads
+// in parallel. It defaults to 10.
+func WithSourceIDReadConcurrency(n int) PromQLOption {
+	return func(q *PromQL) {
+		q.readConcurrency = n
+	}
+}
+
+// WithRangeStreamSteps sets how many steps each sub-window of a streamed
+// range query covers. It defaults to 250.
+func WithRangeStreamSteps(n int) PromQLOption {
+	return func(q *PromQL) {
+		q.rangeStreamSteps = n
+	}
+}
+
+// WithSanitizeExemptMetricNames makes queries match envelopes with the
+// given metric names by their name as is. Other names are sanitized with
+// SanitizeMetricName, which also rewrites valid Prometheus names that
+// contain a colon. It defaults to no exemptions.
+func WithSanitizeExemptMetricNames(names []string) PromQLOption {
+	return func(q *PromQL) {
+		q.sanitizeExempt = make(map[string]struct{}, len(names))
+		for _, n := range names {
+			q.sanitizeExempt[n] = struct{}{}
+		}
+	}
+}
+
+// WithSlowQueryThreshold logs every query whose evaluation takes longer
+// than d with its query string, source IDs and elapsed time. It is disabled
+// by default.
+func WithSlowQueryThreshold(d time.Duration) PromQLOption {
+	return func(q *PromQL) {
+		q.slowQuery = d
+	}
+}
+
 func (q *PromQL) InstantQuery(ctx context.Context, req *logcache_v1.PromQL_InstantQueryRequest) (*logcache_v1.PromQL_InstantQueryResult, error) {
+	result, err := q.instantQuery(ctx, req)
+	return result, queryError(err)
+}
+
+func (q *PromQL) instantQuery(ctx context.Context, req *logcache_v1.PromQL_InstantQueryRequest) (*logcache_v1.PromQL_InstantQueryResult, error) {
 	var closureErr error
 	interval := time.Second
 	lcq := &logCacheQueryable{
@@ -81,14 +186,17 @@ func (q *PromQL) InstantQuery(ctx context.Context, req *logcache_v1.PromQL_Insta
 		interval:   interval,
 		dataReader: q.r,
 
+		readConcurrency: q.readConcurrency,
+		sanitizeExempt:  q.sanitizeExempt,
+
 		// Prometheus does not hand us back the error the way you might
 		// expect.  Therefore, we have to propagate the error back up
 		// manually.
 		errf: func(e error) { closureErr = e },
 	}
 	queryable := promql.NewEngine(promql.EngineOpts{
-		MaxConcurrent: 10,
-		MaxSamples:    50000000,
+		MaxConcurrent: EngineMaxConcurrent,
+		MaxSamples:    EngineMaxSamples,
 		Timeout:       q.queryTimeout,
 	})
 
@@ -99,7 +207,15 @@ func (q *PromQL) InstantQuery(ctx context.Context, req *logcache_v1.PromQL_Insta
 	} else {
 		requestTime, err = ParseTime(req.Time)
 		if err != nil {
-			return nil, err
+			return nil, status.Errorf(codes.InvalidArgument, "couldn't parse time: %s", err)
+		}
+	}
+
+	var cacheKey string
+	if q.cache != nil {
+		cacheKey = queryCacheKey(req.Query, requestTime)
+		if result, ok := q.cache.get(cacheKey); ok {
+			return result, nil
 		}
 	}
 
@@ -110,14 +226,21 @@ func (q *PromQL) InstantQuery(ctx context.Context, req *logcache_v1.PromQL_Insta
 
 	queryStartTime := time.Now()
 	r := qq.Exec(ctx)
-	q.instantQueryTimer.Set(float64(time.Since(queryStartTime) / time.Millisecond))
+	elapsed := time.Since(queryStartTime)
+	q.instantQueryTimer.Set(float64(elapsed / time.Millisecond))
+	q.logSlowQuery("instant", req.Query, elapsed)
 
 	if closureErr != nil {
 		q.failureCounter.Add(1)
 		return nil, closureErr
 	}
 
-	return q.toInstantQueryResult(r)
+	result, err := q.toInstantQueryResult(r)
+	if err == nil && q.cache != nil {
+		q.cache.set(cacheKey, result)
+	}
+
+	return result, err
 }
 
 func (q *PromQL) toInstantQueryResult(r *promql.Result) (*logcache_v1.PromQL_InstantQueryResult, error) {
@@ -128,6 +251,7 @@ func (q *PromQL) toInstantQueryResult(r *promql.Result) (*logcache_v1.PromQL_Ins
 	switch r.Value.Type() {
 	case promql.ValueTypeScalar:
 		s := r.Value.(promql.Scalar)
+		q.recordResultSize(1, 1)
 		return &logcache_v1.PromQL_InstantQueryResult{
 			Result: &logcache_v1.PromQL_InstantQueryResult_Scalar{
 				Scalar: &logcache_v1.PromQL_Scalar{
@@ -139,7 +263,7 @@ func (q *PromQL) toInstantQueryResult(r *promql.Result) (*logcache_v1.PromQL_Ins
 
 	case promql.ValueTypeVector:
 		var samples []*logcache_v1.PromQL_Sample
-		for _, s := range r.Value.(promql.Vector) {
+		for _, s := range sortVector(r.Value.(promql.Vector)) {
 			metric := make(map[string]string)
 			for _, m := range s.Metric {
 				metric[m.Name] = m.Value
@@ -152,6 +276,7 @@ func (q *PromQL) toInstantQueryResult(r *promql.Result) (*logcache_v1.PromQL_Ins
 				},
 			})
 		}
+		q.recordResultSize(len(samples), len(samples))
 
 		return &logcache_v1.PromQL_InstantQueryResult{
 			Result: &logcache_v1.PromQL_InstantQueryResult_Vector{
@@ -162,8 +287,11 @@ func (q *PromQL) toInstantQueryResult(r *promql.Result) (*logcache_v1.PromQL_Ins
 		}, nil
 
 	case promql.ValueTypeMatrix:
-		var series []*logcache_v1.PromQL_Series
-		for _, s := range r.Value.(promql.Matrix) {
+		var (
+			series      []*logcache_v1.PromQL_Series
+			sampleCount int
+		)
+		for _, s := range sortMatrix(r.Value.(promql.Matrix)) {
 			metric := make(map[string]string)
 			for _, m := range s.Metric {
 				metric[m.Name] = m.Value
@@ -175,12 +303,14 @@ func (q *PromQL) toInstantQueryResult(r *promql.Result) (*logcache_v1.PromQL_Ins
 					Value: p.V,
 				})
 			}
+			sampleCount += len(points)
 
 			series = append(series, &logcache_v1.PromQL_Series{
 				Metric: metric,
 				Points: points,
 			})
 		}
+		q.recordResultSize(len(series), sampleCount)
 
 		return &logcache_v1.PromQL_InstantQueryResult{
 			Result: &logcache_v1.PromQL_InstantQueryResult_Matrix{
@@ -197,12 +327,58 @@ func (q *PromQL) toInstantQueryResult(r *promql.Result) (*logcache_v1.PromQL_Ins
 }
 
 func (q *PromQL) RangeQuery(ctx context.Context, req *logcache_v1.PromQL_RangeQueryRequest) (*logcache_v1.PromQL_RangeQueryResult, error) {
+	result, err := q.rangeQuery(ctx, req, time.Time{})
+	return result, queryError(err)
+}
+
+// queryError converts an error from evaluating a query into a gRPC status
+// so that the gateway can report it with the matching Prometheus error type.
+// Malformed queries are InvalidArgument, timeouts DeadlineExceeded and any
+// other failure during evaluation Aborted.
+func queryError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	switch err.(type) {
+	case *promql.ParseErr:
+		return status.Error(codes.InvalidArgument, err.Error())
+	case promql.ErrQueryTimeout:
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	case promql.ErrQueryCanceled:
+		return status.Error(codes.Canceled, err.Error())
+	}
+
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	}
+
+	return status.Error(codes.Aborted, err.Error())
+}
+
+// rangeQuery evaluates the range query. When readEnd is set, envelopes are
+// read up to it rather than up to the end of the query.
+func (q *PromQL) rangeQuery(
+	ctx context.Context,
+	req *logcache_v1.PromQL_RangeQueryRequest,
+	readEnd time.Time,
+) (*logcache_v1.PromQL_RangeQueryResult, error) {
 	var closureErr error
 	interval := time.Second
 	lcq := &logCacheQueryable{
 		log:        q.log,
 		interval:   interval,
 		dataReader: q.r,
+		readEnd:    readEnd,
+
+		readConcurrency: q.readConcurrency,
+		sanitizeExempt:  q.sanitizeExempt,
 
 		// Prometheus does not hand us back the error the way you might
 		// expect.  Therefore, we have to propagate the error back up
@@ -210,25 +386,25 @@ func (q *PromQL) RangeQuery(ctx context.Context, req *logcache_v1.PromQL_RangeQu
 		errf: func(e error) { closureErr = e },
 	}
 	queryable := promql.NewEngine(promql.EngineOpts{
-		MaxConcurrent: 10,
-		MaxSamples:    50000000,
+		MaxConcurrent: EngineMaxConcurrent,
+		MaxSamples:    EngineMaxSamples,
 		Timeout:       q.queryTimeout,
 	})
 
 	step, err := ParseStep(req.Step)
 	if err != nil {
-		return nil, fmt.Errorf("couldn't parse step: %s", err)
+		return nil, status.Errorf(codes.InvalidArgument, "couldn't parse step: %s", err)
 	}
 
 	// TODO: Should there be some boundary checking on Start and End?
 	startTime, err := ParseTime(req.Start)
 	if err != nil {
-		return nil, fmt.Errorf("couldn't parse start: %s", err)
+		return nil, status.Errorf(codes.InvalidArgument, "couldn't parse start: %s", err)
 	}
 
 	endTime, err := ParseTime(req.End)
 	if err != nil {
-		return nil, fmt.Errorf("couldn't parse end: %s", err)
+		return nil, status.Errorf(codes.InvalidArgument, "couldn't parse end: %s", err)
 	}
 
 	qq, err := queryable.NewRangeQuery(lcq, req.Query, startTime, endTime, step)
@@ -238,7 +414,9 @@ func (q *PromQL) RangeQuery(ctx context.Context, req *logcache_v1.PromQL_RangeQu
 
 	queryStartTime := time.Now()
 	r := qq.Exec(ctx)
-	q.rangeQueryTimer.Set(float64(time.Since(queryStartTime) / time.Millisecond))
+	elapsed := time.Since(queryStartTime)
+	q.rangeQueryTimer.Set(float64(elapsed / time.Millisecond))
+	q.logSlowQuery("range", req.Query, elapsed)
 
 	if closureErr != nil {
 		q.failureCounter.Add(1)
@@ -255,8 +433,11 @@ func (q *PromQL) toRangeQueryResult(r *promql.Result) (*logcache_v1.PromQL_Range
 
 	switch r.Value.Type() {
 	case promql.ValueTypeMatrix:
-		var series []*logcache_v1.PromQL_Series
-		for _, s := range r.Value.(promql.Matrix) {
+		var (
+			series      []*logcache_v1.PromQL_Series
+			sampleCount int
+		)
+		for _, s := range sortMatrix(r.Value.(promql.Matrix)) {
 			metric := make(map[string]string)
 			for _, m := range s.Metric {
 				metric[m.Name] = m.Value
@@ -268,12 +449,14 @@ func (q *PromQL) toRangeQueryResult(r *promql.Result) (*logcache_v1.PromQL_Range
 					Value: p.V,
 				})
 			}
+			sampleCount += len(points)
 
 			series = append(series, &logcache_v1.PromQL_Series{
 				Metric: metric,
 				Points: points,
 			})
 		}
+		q.recordResultSize(len(series), sampleCount)
 
 		return &logcache_v1.PromQL_RangeQueryResult{
 			Result: &logcache_v1.PromQL_RangeQueryResult_Matrix{
@@ -289,22 +472,69 @@ func (q *PromQL) toRangeQueryResult(r *promql.Result) (*logcache_v1.PromQL_Range
 	}
 }
 
+// logSlowQuery logs the query if evaluating it took longer than the slow
+// query threshold.
+func (q *PromQL) logSlowQuery(kind, query string, elapsed time.Duration) {
+	if q.slowQuery <= 0 || elapsed <= q.slowQuery {
+		return
+	}
+
+	sourceIDs, _ := ExtractSourceIds(query)
+	sort.Strings(sourceIDs)
+	q.log.Printf("slow %s query took %s: query=%q source_ids=%v", kind, elapsed, query, sourceIDs)
+}
+
+// recordResultSize reports how many series and samples the last query
+// returned, to help find queries with high cardinality.
+func (q *PromQL) recordResultSize(series, samples int) {
+	q.resultSeries.Set(float64(series))
+	q.resultSamples.Set(float64(samples))
+}
+
+// sortVector orders samples by their labels so that identical queries
+// return samples in the same order.
+func sortVector(v promql.Vector) promql.Vector {
+	sort.Slice(v, func(i, j int) bool {
+		return labels.Compare(v[i].Metric, v[j].Metric) < 0
+	})
+	return v
+}
+
+// sortMatrix orders series by their labels so that identical queries return
+// series in the same order.
+func sortMatrix(m promql.Matrix) promql.Matrix {
+	sort.Sort(m)
+	return m
+}
+
 type logCacheQueryable struct {
 	log        *log.Logger
 	interval   time.Duration
 	dataReader DataReader
 	errf       func(error)
+	readEnd    time.Time
+
+	readConcurrency int
+	sanitizeExempt  map[string]struct{}
 }
 
 func (l *logCacheQueryable) Querier(ctx context.Context, mint int64, maxt int64) (storage.Querier, error) {
+	end := time.Unix(0, maxt*int64(time.Millisecond))
+	if !l.readEnd.IsZero() {
+		end = l.readEnd
+	}
+
 	return &LogCacheQuerier{
 		log:        l.log,
 		ctx:        ctx,
 		start:      time.Unix(0, mint*int64(time.Millisecond)),
-		end:        time.Unix(0, maxt*int64(time.Millisecond)),
+		end:        end,
 		interval:   l.interval,
 		dataReader: l.dataReader,
 		errf:       l.errf,
+
+		readConcurrency: l.readConcurrency,
+		sanitizeExempt:  l.sanitizeExempt,
 	}, nil
 }
 
@@ -316,6 +546,9 @@ type LogCacheQuerier struct {
 	interval   time.Duration
 	dataReader DataReader
 	errf       func(error)
+
+	readConcurrency int
+	sanitizeExempt  map[string]struct{}
 }
 
 func (l *LogCacheQuerier) Select(params *storage.SelectParams, ll ...*labels.Matcher) (storage.SeriesSet, storage.Warnings, error) {
@@ -347,89 +580,152 @@ func (l *LogCacheQuerier) Select(params *storage.SelectParams, ll ...*labels.Mat
 
 	builder := newSeriesBuilder()
 
-	for sourceID := range sourceIDs {
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-		envelopeBatch, err := l.dataReader.Read(ctx, &logcache_v1.ReadRequest{
-			SourceId:  sourceID,
-			StartTime: l.start.Add(-time.Second).UnixNano(),
-			EndTime:   l.end.UnixNano(),
-			EnvelopeTypes: []logcache_v1.EnvelopeType{
-				logcache_v1.EnvelopeType_GAUGE,
-				logcache_v1.EnvelopeType_COUNTER,
-				logcache_v1.EnvelopeType_TIMER,
-			},
-		})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-		if err != nil {
-			l.errf(err)
-			return nil, nil, err
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	slots := make(chan struct{}, l.readConcurrency)
+	for sourceID := range sourceIDs {
+		slots <- struct{}{}
+		if ctx.Err() != nil {
+			break
 		}
 
-		for _, e := range envelopeBatch.GetEnvelopes().GetBatch() {
-			if !l.hasLabels(e.GetTags(), ls) {
-				continue
+		wg.Add(1)
+		go func(sourceID string) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+
+			err := l.readSourceID(ctx, sourceID, metric, ls, func(tags map[string]string, p point) {
+				mu.Lock()
+				defer mu.Unlock()
+				builder.add(tags, p)
+			})
+			if err != nil {
+				mu.Lock()
+				defer mu.Unlock()
+				if firstErr == nil {
+					firstErr = err
+					cancel()
+				}
 			}
+		}(sourceID)
+	}
+	wg.Wait()
 
-			var f float64
-			switch e.Message.(type) {
-			case *loggregator_v2.Envelope_Counter:
-				if SanitizeMetricName(e.GetCounter().GetName()) != metric {
-					continue
-				}
+	if firstErr != nil {
+		l.errf(firstErr)
+		return nil, nil, firstErr
+	}
 
-				f = float64(e.GetCounter().GetTotal())
-			case *loggregator_v2.Envelope_Gauge:
-				value := checkMapForSanitizedMetricName(e.GetGauge(), metric)
+	return builder.buildSeriesSet(), nil, nil
+}
 
-				if value == nil {
-					continue
-				}
+// readSourceID reads the envelopes for a single source ID and passes every
+// point that matches the metric and labels to add.
+func (l *LogCacheQuerier) readSourceID(
+	ctx context.Context,
+	sourceID string,
+	metric string,
+	ls []labels.Label,
+	add func(tags map[string]string, p point),
+) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	envelopeBatch, err := l.dataReader.Read(ctx, &logcache_v1.ReadRequest{
+		SourceId:  sourceID,
+		StartTime: l.start.Add(-time.Second).UnixNano(),
+		EndTime:   l.end.UnixNano(),
+		EnvelopeTypes: []logcache_v1.EnvelopeType{
+			logcache_v1.EnvelopeType_GAUGE,
+			logcache_v1.EnvelopeType_COUNTER,
+			logcache_v1.EnvelopeType_TIMER,
+		},
+	})
 
-				f = value.GetValue()
-			case *loggregator_v2.Envelope_Timer:
-				if SanitizeMetricName(e.GetTimer().GetName()) != metric {
-					continue
-				}
+	if err != nil {
+		return err
+	}
+
+	for _, e := range envelopeBatch.GetEnvelopes().GetBatch() {
+		if !l.hasLabels(e.GetTags(), ls) {
+			continue
+		}
 
-				timer := e.GetTimer()
-				f = float64(timer.GetStop() - timer.GetStart())
-			default:
+		var f float64
+		switch e.Message.(type) {
+		case *loggregator_v2.Envelope_Counter:
+			if l.metricName(e.GetCounter().GetName()) != metric {
 				continue
 			}
 
-			e.Timestamp = time.Unix(0, e.GetTimestamp()).Truncate(l.interval).UnixNano()
+			f = float64(e.GetCounter().GetTotal())
+		case *loggregator_v2.Envelope_Gauge:
+			value := l.gaugeValue(e.GetGauge(), metric)
 
-			tags := e.GetTags()
-			if tags == nil {
-				tags = make(map[string]string)
+			if value == nil {
+				continue
 			}
 
-			tags["source_id"] = e.SourceId
-			if e.InstanceId != "" {
-				tags["instance_id"] = e.InstanceId
+			f = value.GetValue()
+		case *loggregator_v2.Envelope_Timer:
+			if l.metricName(e.GetTimer().GetName()) != metric {
+				continue
 			}
 
-			builder.add(tags, point{
-				t: e.GetTimestamp() / int64(time.Millisecond),
-				v: f,
-			})
+			timer := e.GetTimer()
+			f = float64(timer.GetStop() - timer.GetStart())
+		default:
+			continue
+		}
+
+		e.Timestamp = time.Unix(0, e.GetTimestamp()).Truncate(l.interval).UnixNano()
+
+		tags := e.GetTags()
+		if tags == nil {
+			tags = make(map[string]string)
+		}
+
+		tags["source_id"] = e.SourceId
+		if e.InstanceId != "" {
+			tags["instance_id"] = e.InstanceId
 		}
+
+		add(tags, point{
+			t: e.GetTimestamp() / int64(time.Millisecond),
+			v: f,
+		})
 	}
 
-	return builder.buildSeriesSet(), nil, nil
+	return nil
 }
 
-func checkMapForSanitizedMetricName(gauge *loggregator_v2.Gauge, metric string) *loggregator_v2.GaugeValue {
+func (l *LogCacheQuerier) gaugeValue(gauge *loggregator_v2.Gauge, metric string) *loggregator_v2.GaugeValue {
 	metricsMap := gauge.GetMetrics()
 	for k, v := range metricsMap {
-		if SanitizeMetricName(k) == metric {
+		if l.metricName(k) == metric {
 			return v
 		}
 	}
 	return nil
 }
 
+// metricName returns the name an envelope metric is queried by: the name
+// as is if it is exempt from sanitizing, or else the sanitized name.
+func (l *LogCacheQuerier) metricName(name string) string {
+	if _, ok := l.sanitizeExempt[name]; ok {
+		return name
+	}
+
+	return SanitizeMetricName(name)
+}
+
 func SanitizeMetricName(name string) string {
 	// Forcefully convert all invalid separators to underscores
 	// First character: Match the if it's NOT A-z or underscore ^[^A-z_]
@@ -773,6 +1069,101 @@ func (s *sourceIdReplacementVisitor) replaceSourceIdsInRegexpMatcher(labelMatche
 	labelMatcher.Value = strings.Join(expansions, "|")
 }
 
+// ResolveSourceIdPatterns replaces source_id regexp matchers that are
+// patterns, such as source_id=~"app-.*", rather than a list of source IDs
+// with the list of the known source IDs they match, so that they can be
+// authorized and expanded like any other source IDs. Known source IDs are
+// only fetched if the query has a pattern. Patterns that match no known
+// source ID are left as they are.
+func ResolveSourceIdPatterns(query string, knownSourceIds func() ([]string, error)) (string, error) {
+	expr, err := promql.ParseExpr(query)
+	if err != nil {
+		return "", err
+	}
+
+	visitor := &sourceIdPatternVisitor{knownSourceIds: knownSourceIds}
+	err = promql.Walk(
+		visitor,
+		expr,
+		nil,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	if !visitor.resolved {
+		return query, nil
+	}
+
+	return expr.String(), nil
+}
+
+type sourceIdPatternVisitor struct {
+	knownSourceIds func() ([]string, error)
+	known          []string
+	fetched        bool
+	resolved       bool
+}
+
+func (s *sourceIdPatternVisitor) Visit(node promql.Node, _ []promql.Node) (promql.Visitor, error) {
+	if node == nil {
+		return nil, nil
+	}
+
+	var err error
+	switch selector := node.(type) {
+	case *promql.VectorSelector:
+		err = s.resolveInMatchers(selector.LabelMatchers)
+	case *promql.MatrixSelector:
+		err = s.resolveInMatchers(selector.LabelMatchers)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *sourceIdPatternVisitor) resolveInMatchers(labelMatchers []*labels.Matcher) error {
+	for _, labelMatcher := range labelMatchers {
+		if labelMatcher.Name != "source_id" || labelMatcher.Type != labels.MatchRegexp || !isSourceIdPattern(labelMatcher.Value) {
+			continue
+		}
+
+		if !s.fetched {
+			known, err := s.knownSourceIds()
+			if err != nil {
+				return err
+			}
+			sort.Strings(known)
+			s.known = known
+			s.fetched = true
+		}
+
+		var matches []string
+		for _, sourceId := range s.known {
+			if labelMatcher.Matches(sourceId) {
+				matches = append(matches, sourceId)
+			}
+		}
+		if len(matches) == 0 {
+			continue
+		}
+
+		labelMatcher.Value = strings.Join(matches, "|")
+		s.resolved = true
+	}
+
+	return nil
+}
+
+// isSourceIdPattern reports whether a source_id regexp matcher value uses
+// regexp syntax other than alternation. Dots are common in source IDs and
+// do not make a value a pattern on their own.
+func isSourceIdPattern(value string) bool {
+	return strings.ContainsAny(value, `*+?[](){}^$\`)
+}
+
 func formatPromqlTime(timeInMillis int64) string {
 	return fmt.Sprintf("%.3f", float64(timeInMillis)/1000)
 }
@@ -1,10 +1,13 @@
 package promql_test
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"log"
+	"strings"
 	"sync"
 	"time"
 
@@ -13,10 +16,13 @@ import (
 	"code.cloudfoundry.org/go-log-cache/v3/rpc/logcache_v1"
 	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
 	"code.cloudfoundry.org/log-cache/internal/promql"
+	"code.cloudfoundry.org/log-cache/pkg/marshaler"
 
 	"code.cloudfoundry.org/log-cache/internal/testing"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 var _ = Describe("PromQL", func() {
@@ -161,6 +167,119 @@ var _ = Describe("PromQL", func() {
 		})
 	})
 
+	Context("ResolveSourceIdPatterns", func() {
+		known := func(sourceIds ...string) func() ([]string, error) {
+			return func() ([]string, error) {
+				return sourceIds, nil
+			}
+		}
+
+		It("expands a prefix to the known source IDs it matches", func() {
+			query := `metric{source_id=~"app-.*"} + avg_over_time(gauge_example{source_id=~"app-1|b"}[10m])`
+			resolvedQuery, err := promql.ResolveSourceIdPatterns(query, known("app-2", "b", "app-1", "my-app-3"))
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resolvedQuery).To(
+				Equal(`metric{source_id=~"app-1|app-2"} + avg_over_time(gauge_example{source_id=~"app-1|b"}[10m])`),
+			)
+		})
+
+		It("does not fetch known source IDs without a pattern", func() {
+			query := `metric{source_id=~"a|b.c"}`
+			resolvedQuery, err := promql.ResolveSourceIdPatterns(query, func() ([]string, error) {
+				Fail("known source IDs were fetched")
+				return nil, nil
+			})
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resolvedQuery).To(Equal(query))
+		})
+
+		It("leaves patterns that match no known source ID", func() {
+			query := `metric{source_id=~"app-.*"}`
+			resolvedQuery, err := promql.ResolveSourceIdPatterns(query, known("other"))
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resolvedQuery).To(Equal(query))
+		})
+
+		It("returns an error if the known source IDs can't be fetched", func() {
+			_, err := promql.ResolveSourceIdPatterns(`metric{source_id=~"app-.*"}`, func() ([]string, error) {
+				return nil, errors.New("some-error")
+			})
+			Expect(err).To(MatchError("some-error"))
+		})
+
+		It("returns an error for an invalid query", func() {
+			_, err := promql.ResolveSourceIdPatterns(`invalid.query`, known())
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("result ordering", func() {
+		envelopes := func(now time.Time) []*loggregator_v2.Envelope {
+			var batch []*loggregator_v2.Envelope
+			for i, tag := range []string{"d", "b", "e", "a", "c"} {
+				batch = append(batch, &loggregator_v2.Envelope{
+					SourceId:  "some-id",
+					Timestamp: now.UnixNano() + int64(i),
+					Message: &loggregator_v2.Envelope_Counter{
+						Counter: &loggregator_v2.Counter{Name: "metric", Total: uint64(i)},
+					},
+					Tags: map[string]string{"tag": tag},
+				})
+			}
+			return batch
+		}
+
+		It("returns instant query samples in a stable order", func() {
+			now := time.Now().Add(-time.Minute)
+			for n := 0; n < 10; n++ {
+				spyDataReader.readResults = [][]*loggregator_v2.Envelope{envelopes(now)}
+				spyDataReader.readErrs = []error{nil}
+
+				r, err := q.InstantQuery(
+					context.Background(),
+					&logcache_v1.PromQL_InstantQueryRequest{
+						Query: `metric{source_id="some-id"}`,
+					},
+				)
+				Expect(err).NotTo(HaveOccurred())
+
+				var tags []string
+				for _, sample := range r.GetVector().GetSamples() {
+					tags = append(tags, sample.Metric["tag"])
+				}
+				Expect(tags).To(Equal([]string{"a", "b", "c", "d", "e"}))
+			}
+		})
+
+		It("returns range query series in a stable order", func() {
+			now := time.Now().Add(-time.Minute)
+			for n := 0; n < 10; n++ {
+				spyDataReader.readResults = [][]*loggregator_v2.Envelope{envelopes(now)}
+				spyDataReader.readErrs = []error{nil}
+
+				r, err := q.RangeQuery(
+					context.Background(),
+					&logcache_v1.PromQL_RangeQueryRequest{
+						Query: `metric{source_id="some-id"}`,
+						Start: testing.FormatTimeWithDecimalMillis(now),
+						End:   testing.FormatTimeWithDecimalMillis(now.Add(time.Second)),
+						Step:  "1s",
+					},
+				)
+				Expect(err).NotTo(HaveOccurred())
+
+				var tags []string
+				for _, series := range r.GetMatrix().GetSeries() {
+					tags = append(tags, series.Metric["tag"])
+				}
+				Expect(tags).To(Equal([]string{"a", "b", "c", "d", "e"}))
+			}
+		})
+	})
+
 	It("a query against data with invalid envelope types returns only the valid metrics", func() {
 		now := time.Now().Add(-time.Minute)
 		spyDataReader.readResults = [][]*loggregator_v2.Envelope{
@@ -248,6 +367,134 @@ var _ = Describe("PromQL", func() {
 		)
 	})
 
+	Context("reading many source IDs", func() {
+		var sourceIDs []string
+
+		BeforeEach(func() {
+			sourceIDs = nil
+			for i := 0; i < 25; i++ {
+				sourceIDs = append(sourceIDs, fmt.Sprintf("source-%d", i))
+			}
+		})
+
+		It("returns a sample for every source ID", func() {
+			reader := newConcurrentDataReader(0)
+			q = promql.New(reader, spyMetrics, log.New(io.Discard, "", 0), 5*time.Second)
+
+			r, err := q.InstantQuery(context.Background(), &logcache_v1.PromQL_InstantQueryRequest{
+				Query: fmt.Sprintf(`metric{source_id=~"%s"}`, strings.Join(sourceIDs, "|")),
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			var got []string
+			for _, s := range r.GetVector().GetSamples() {
+				got = append(got, s.GetMetric()["source_id"])
+				Expect(s.GetPoint().GetValue()).To(Equal(99.0))
+			}
+			Expect(got).To(ConsistOf(sourceIDs))
+		})
+
+		It("caps the number of concurrent reads", func() {
+			reader := newConcurrentDataReader(10 * time.Millisecond)
+			q = promql.New(reader, spyMetrics, log.New(io.Discard, "", 0), 5*time.Second,
+				promql.WithSourceIDReadConcurrency(4),
+			)
+
+			_, err := q.InstantQuery(context.Background(), &logcache_v1.PromQL_InstantQueryRequest{
+				Query: fmt.Sprintf(`metric{source_id=~"%s"}`, strings.Join(sourceIDs, "|")),
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(reader.reads()).To(Equal(int64(25)))
+			Expect(reader.maxInFlight()).To(BeNumerically("<=", 4))
+			Expect(reader.maxInFlight()).To(BeNumerically(">", 1))
+		})
+
+		It("returns the error from a failed read", func() {
+			reader := newConcurrentDataReader(0)
+			reader.failSourceID = "source-7"
+			q = promql.New(reader, spyMetrics, log.New(io.Discard, "", 0), 5*time.Second)
+
+			_, err := q.InstantQuery(context.Background(), &logcache_v1.PromQL_InstantQueryRequest{
+				Query: fmt.Sprintf(`metric{source_id=~"%s"}`, strings.Join(sourceIDs, "|")),
+			})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("with a query cache", func() {
+		var (
+			reader *concurrentDataReader
+			now    string
+		)
+
+		BeforeEach(func() {
+			reader = newConcurrentDataReader(0)
+			q = promql.New(reader, spyMetrics, log.New(io.Discard, "", 0), 5*time.Second,
+				promql.WithQueryCache(200*time.Millisecond, 10),
+			)
+			now = fmt.Sprint(time.Now().Unix())
+		})
+
+		It("does not read again for an identical instant query within the TTL", func() {
+			first, err := q.InstantQuery(context.Background(), &logcache_v1.PromQL_InstantQueryRequest{
+				Query: `metric{source_id="some-id-1"}`,
+				Time:  now,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(reader.reads()).To(Equal(int64(1)))
+
+			second, err := q.InstantQuery(context.Background(), &logcache_v1.PromQL_InstantQueryRequest{
+				Query: `metric{ source_id = "some-id-1" }`,
+				Time:  now,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(reader.reads()).To(Equal(int64(1)))
+			Expect(second.GetVector().GetSamples()).To(Equal(first.GetVector().GetSamples()))
+		})
+
+		It("reads again once the TTL has passed", func() {
+			req := &logcache_v1.PromQL_InstantQueryRequest{Query: `metric{source_id="some-id-1"}`, Time: now}
+			_, err := q.InstantQuery(context.Background(), req)
+			Expect(err).ToNot(HaveOccurred())
+
+			time.Sleep(250 * time.Millisecond)
+
+			_, err = q.InstantQuery(context.Background(), req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(reader.reads()).To(Equal(int64(2)))
+		})
+
+		It("reads again for a different evaluation time", func() {
+			_, err := q.InstantQuery(context.Background(), &logcache_v1.PromQL_InstantQueryRequest{
+				Query: `metric{source_id="some-id-1"}`,
+				Time:  now,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = q.InstantQuery(context.Background(), &logcache_v1.PromQL_InstantQueryRequest{
+				Query: `metric{source_id="some-id-1"}`,
+				Time:  fmt.Sprint(time.Now().Unix() - 1),
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(reader.reads()).To(Equal(int64(2)))
+		})
+
+		It("does not cache range queries", func() {
+			req := &logcache_v1.PromQL_RangeQueryRequest{
+				Query: `metric{source_id="some-id-1"}`,
+				Start: fmt.Sprint(time.Now().Add(-time.Minute).Unix()),
+				End:   now,
+				Step:  "15s",
+			}
+			_, err := q.RangeQuery(context.Background(), req)
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = q.RangeQuery(context.Background(), req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(reader.reads()).To(Equal(int64(2)))
+		})
+	})
+
 	Context("when metric names contain unsupported characters", func() {
 		It("converts counter metric names to proper promql format", func() {
 			now := time.Now()
@@ -441,6 +688,132 @@ var _ = Describe("PromQL", func() {
 		})
 	})
 
+	Context("with a slow query threshold", func() {
+		var logs *bytes.Buffer
+
+		BeforeEach(func() {
+			logs = &bytes.Buffer{}
+		})
+
+		It("logs an instant query that takes longer than the threshold", func() {
+			q = promql.New(newConcurrentDataReader(50*time.Millisecond), spyMetrics, log.New(logs, "", 0), 5*time.Second,
+				promql.WithSlowQueryThreshold(10*time.Millisecond),
+			)
+
+			_, err := q.InstantQuery(context.Background(), &logcache_v1.PromQL_InstantQueryRequest{
+				Query: `metric{source_id=~"source-2|source-1"}`,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(logs.String()).To(ContainSubstring("slow instant query took"))
+			Expect(logs.String()).To(ContainSubstring(`query="metric{source_id=~\"source-2|source-1\"}"`))
+			Expect(logs.String()).To(ContainSubstring("source_ids=[source-1 source-2]"))
+		})
+
+		It("logs a range query that takes longer than the threshold", func() {
+			q = promql.New(newConcurrentDataReader(50*time.Millisecond), spyMetrics, log.New(logs, "", 0), 5*time.Second,
+				promql.WithSlowQueryThreshold(10*time.Millisecond),
+			)
+
+			_, err := q.RangeQuery(context.Background(), &logcache_v1.PromQL_RangeQueryRequest{
+				Query: `metric{source_id="source-1"}`,
+				Start: "1",
+				End:   "2",
+				Step:  "1s",
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(logs.String()).To(ContainSubstring("slow range query took"))
+			Expect(logs.String()).To(ContainSubstring("source_ids=[source-1]"))
+		})
+
+		It("does not log a query that is faster than the threshold", func() {
+			q = promql.New(newConcurrentDataReader(0), spyMetrics, log.New(logs, "", 0), 5*time.Second,
+				promql.WithSlowQueryThreshold(time.Minute),
+			)
+
+			_, err := q.InstantQuery(context.Background(), &logcache_v1.PromQL_InstantQueryRequest{
+				Query: `metric{source_id="source-1"}`,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(logs.String()).To(BeEmpty())
+		})
+
+		It("does not log slow queries by default", func() {
+			q = promql.New(newConcurrentDataReader(50*time.Millisecond), spyMetrics, log.New(logs, "", 0), 5*time.Second)
+
+			_, err := q.InstantQuery(context.Background(), &logcache_v1.PromQL_InstantQueryRequest{
+				Query: `metric{source_id="source-1"}`,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(logs.String()).To(BeEmpty())
+		})
+	})
+
+	Context("with metric names exempt from sanitizing", func() {
+		BeforeEach(func() {
+			q = promql.New(
+				spyDataReader,
+				spyMetrics,
+				log.New(io.Discard, "", 0),
+				5*time.Second,
+				promql.WithSanitizeExemptMetricNames([]string{"http:requests:total", "cpu:usage"}),
+			)
+
+			spyDataReader.readResults = [][]*loggregator_v2.Envelope{{
+				{
+					SourceId:  "some-id-1",
+					Timestamp: time.Now().UnixNano(),
+					Message: &loggregator_v2.Envelope_Counter{
+						Counter: &loggregator_v2.Counter{Name: "http:requests:total", Total: 104},
+					},
+				},
+				{
+					SourceId:  "some-id-1",
+					Timestamp: time.Now().UnixNano(),
+					Message: &loggregator_v2.Envelope_Gauge{
+						Gauge: &loggregator_v2.Gauge{
+							Metrics: map[string]*loggregator_v2.GaugeValue{
+								"cpu:usage":    {Value: 99},
+								"memory:usage": {Value: 42},
+							},
+						},
+					},
+				},
+			}}
+			spyDataReader.readErrs = []error{nil}
+		})
+
+		DescribeTable("matches an exempt name without sanitizing it", func(query string, expected float64) {
+			r, err := q.InstantQuery(context.Background(), &logcache_v1.PromQL_InstantQueryRequest{Query: query})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(r.GetVector().GetSamples()).To(HaveLen(1))
+			Expect(r.GetVector().GetSamples()[0].Point.Value).To(Equal(expected))
+		},
+			Entry("counter", `http:requests:total{source_id="some-id-1"}`, 104.0),
+			Entry("gauge", `cpu:usage{source_id="some-id-1"}`, 99.0),
+		)
+
+		It("does not match an exempt name by its sanitized name", func() {
+			r, err := q.InstantQuery(context.Background(), &logcache_v1.PromQL_InstantQueryRequest{
+				Query: `http_requests_total{source_id="some-id-1"}`,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(r.GetVector().GetSamples()).To(BeEmpty())
+		})
+
+		It("still sanitizes names that are not exempt", func() {
+			r, err := q.InstantQuery(context.Background(), &logcache_v1.PromQL_InstantQueryRequest{
+				Query: `memory_usage{source_id="some-id-1"}`,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(r.GetVector().GetSamples()).To(HaveLen(1))
+			Expect(r.GetVector().GetSamples()[0].Point.Value).To(Equal(42.0))
+		})
+	})
+
 	Context("When using an InstantQuery", func() {
 		It("returns a scalar", func() {
 			r, err := q.InstantQuery(context.Background(), &logcache_v1.PromQL_InstantQueryRequest{Query: `7*9`})
@@ -571,6 +944,71 @@ var _ = Describe("PromQL", func() {
 			)
 		})
 
+		It("returns an empty vector for a metric that does not exist", func() {
+			r, err := q.InstantQuery(
+				context.Background(),
+				&logcache_v1.PromQL_InstantQueryRequest{Query: `nonexistent{source_id="some-id-1"}`},
+			)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(r.GetVector()).ToNot(BeNil())
+			Expect(r.GetVector().GetSamples()).To(BeEmpty())
+
+			result, err := marshaler.NewPromqlMarshaler(nil).Marshal(r)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result).To(MatchJSON(`{"status":"success","data":{"resultType":"vector","result":[]}}`))
+		})
+
+		It("returns an empty vector for an aggregation of a metric that does not exist", func() {
+			r, err := q.InstantQuery(
+				context.Background(),
+				&logcache_v1.PromQL_InstantQueryRequest{Query: `sum(rate(nonexistent{source_id="some-id-1"}[5m]))`},
+			)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(r.GetVector()).ToNot(BeNil())
+			Expect(r.GetVector().GetSamples()).To(BeEmpty())
+		})
+
+		It("returns a sample from absent() for a metric that does not exist", func() {
+			r, err := q.InstantQuery(
+				context.Background(),
+				&logcache_v1.PromQL_InstantQueryRequest{Query: `absent(nonexistent{source_id="some-id-1"})`},
+			)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(r.GetVector().GetSamples()).To(HaveLen(1))
+			Expect(r.GetVector().GetSamples()[0].GetMetric()).To(Equal(map[string]string{
+				"source_id": "some-id-1",
+			}))
+			Expect(r.GetVector().GetSamples()[0].GetPoint().GetValue()).To(Equal(1.0))
+		})
+
+		It("returns an empty vector from absent() for a metric that exists", func() {
+			spyDataReader.readErrs = []error{nil}
+			spyDataReader.readResults = [][]*loggregator_v2.Envelope{
+				{{
+					SourceId:  "some-id-1",
+					Timestamp: time.Now().Add(-time.Minute).UnixNano(),
+					Message: &loggregator_v2.Envelope_Counter{
+						Counter: &loggregator_v2.Counter{
+							Name:  "metric",
+							Total: 99,
+						},
+					},
+				}},
+			}
+
+			r, err := q.InstantQuery(
+				context.Background(),
+				&logcache_v1.PromQL_InstantQueryRequest{Query: `absent(metric{source_id="some-id-1"})`},
+			)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(r.GetVector()).ToNot(BeNil())
+			Expect(r.GetVector().GetSamples()).To(BeEmpty())
+		})
+
 		It("filters for correct counter metric name and label", func() {
 			now := time.Now()
 			spyDataReader.readErrs = []error{nil}
@@ -742,6 +1180,49 @@ var _ = Describe("PromQL", func() {
 			}).ShouldNot(BeZero())
 		})
 
+		It("captures the size of a vector result as metrics", func() {
+			now := time.Now()
+			spyDataReader.readErrs = []error{nil, nil}
+			spyDataReader.readResults = [][]*loggregator_v2.Envelope{
+				{
+					{
+						SourceId:  "some-id-1",
+						Timestamp: now.UnixNano(),
+						Message: &loggregator_v2.Envelope_Gauge{
+							Gauge: &loggregator_v2.Gauge{
+								Metrics: map[string]*loggregator_v2.GaugeValue{
+									"metric": {Unit: "thing", Value: 99},
+								},
+							},
+						},
+					},
+				},
+				{
+					{
+						SourceId:  "some-id-2",
+						Timestamp: now.UnixNano(),
+						Message: &loggregator_v2.Envelope_Gauge{
+							Gauge: &loggregator_v2.Gauge{
+								Metrics: map[string]*loggregator_v2.GaugeValue{
+									"metric": {Unit: "thing", Value: 101},
+								},
+							},
+						},
+					},
+				},
+			}
+
+			r, err := q.InstantQuery(
+				context.Background(),
+				&logcache_v1.PromQL_InstantQueryRequest{Query: `metric{source_id=~"some-id-1|some-id-2"}`},
+			)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(r.GetVector().GetSamples()).To(HaveLen(2))
+
+			Expect(spyMetrics.GetMetricValue("log_cache_promql_result_series", nil)).To(Equal(2.0))
+			Expect(spyMetrics.GetMetricValue("log_cache_promql_result_samples", nil)).To(Equal(2.0))
+		})
+
 		It("expands requests filtered for multiple source IDs", func() {
 			now := time.Now()
 			spyDataReader.readErrs = []error{nil, nil}
@@ -802,6 +1283,20 @@ var _ = Describe("PromQL", func() {
 				&logcache_v1.PromQL_InstantQueryRequest{Query: `invalid.query`},
 			)
 			Expect(err).To(HaveOccurred())
+			Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+		})
+
+		// The pinned Prometheus engine predates the @ modifier, so anchored
+		// selectors must be rejected instead of silently evaluating at the
+		// query time.
+		It("returns an error for a query using the @ modifier", func() {
+			_, err := q.InstantQuery(
+				context.Background(),
+				&logcache_v1.PromQL_InstantQueryRequest{Query: `metric{source_id="some-id-1"} @ 1609459200`},
+			)
+			Expect(err).To(HaveOccurred())
+			Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+			Expect(spyDataReader.ReadSourceIDs()).To(BeEmpty())
 		})
 
 		It("returns an error for an invalid time", func() {
@@ -810,6 +1305,7 @@ var _ = Describe("PromQL", func() {
 				&logcache_v1.PromQL_InstantQueryRequest{Query: `metric{source_id="some-id-1"}`, Time: "409l"},
 			)
 			Expect(err).To(HaveOccurred())
+			Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
 		})
 
 		It("returns an error if a metric does not have a source ID", func() {
@@ -818,6 +1314,7 @@ var _ = Describe("PromQL", func() {
 				&logcache_v1.PromQL_InstantQueryRequest{Query: `metric{source_id="some-id-1"} + metric`},
 			)
 			Expect(err).To(HaveOccurred())
+			Expect(status.Code(err)).To(Equal(codes.Aborted))
 		})
 
 		It("returns an error if the data reader fails", func() {
@@ -1207,11 +1704,29 @@ var _ = Describe("PromQL", func() {
 				},
 			}))
 
+			Expect(spyMetrics.GetMetricValue("log_cache_promql_result_series", nil)).To(Equal(2.0))
+			Expect(spyMetrics.GetMetricValue("log_cache_promql_result_samples", nil)).To(Equal(11.0))
+
 			Eventually(spyDataReader.ReadSourceIDs).Should(
 				ConsistOf("some-id-1"),
 			)
 		})
 
+		It("returns an empty matrix for a metric that does not exist", func() {
+			r, err := q.RangeQuery(
+				context.Background(),
+				&logcache_v1.PromQL_RangeQueryRequest{Query: `nonexistent{source_id="some-id-1"}`, Start: "1", End: "600", Step: "1m"},
+			)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(r.GetMatrix()).ToNot(BeNil())
+			Expect(r.GetMatrix().GetSeries()).To(BeEmpty())
+
+			result, err := marshaler.NewPromqlMarshaler(nil).Marshal(r)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result).To(MatchJSON(`{"status":"success","data":{"resultType":"matrix","result":[]}}`))
+		})
+
 		It("accepts RFC3339 start and end times", func() {
 			_, err := q.RangeQuery(
 				context.Background(),
@@ -1299,6 +1814,70 @@ var _ = Describe("PromQL", func() {
 
 })
 
+// concurrentDataReader returns a counter envelope for every source ID it is
+// asked for and tracks how many reads are in flight at once.
+type concurrentDataReader struct {
+	delay        time.Duration
+	failSourceID string
+
+	mu       sync.Mutex
+	inFlight int64
+	max      int64
+	total    int64
+}
+
+func newConcurrentDataReader(delay time.Duration) *concurrentDataReader {
+	return &concurrentDataReader{delay: delay}
+}
+
+func (r *concurrentDataReader) Read(ctx context.Context, req *logcache_v1.ReadRequest) (*logcache_v1.ReadResponse, error) {
+	r.mu.Lock()
+	r.inFlight++
+	r.total++
+	if r.inFlight > r.max {
+		r.max = r.inFlight
+	}
+	r.mu.Unlock()
+
+	defer func() {
+		r.mu.Lock()
+		r.inFlight--
+		r.mu.Unlock()
+	}()
+
+	time.Sleep(r.delay)
+
+	if req.SourceId == r.failSourceID {
+		return nil, errors.New("some-error")
+	}
+
+	return &logcache_v1.ReadResponse{
+		Envelopes: &loggregator_v2.EnvelopeBatch{
+			Batch: []*loggregator_v2.Envelope{
+				{
+					SourceId:  req.SourceId,
+					Timestamp: time.Now().Add(-time.Second).UnixNano(),
+					Message: &loggregator_v2.Envelope_Counter{
+						Counter: &loggregator_v2.Counter{Name: "metric", Total: 99},
+					},
+				},
+			},
+		},
+	}, nil
+}
+
+func (r *concurrentDataReader) maxInFlight() int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.max
+}
+
+func (r *concurrentDataReader) reads() int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.total
+}
+
 type spyDataReader struct {
 	mu            sync.Mutex
 	readSourceIDs []string
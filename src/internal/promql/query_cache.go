@@ -0,0 +1,99 @@
+package promql
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/go-log-cache/v3/rpc/logcache_v1"
+	"github.com/prometheus/prometheus/promql"
+)
+
+// queryCache holds instant query results for a short time so that
+// dashboards refreshing the same query do not read the store every time.
+type queryCache struct {
+	ttl        time.Duration
+	maxEntries int
+	now        func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]queryCacheEntry
+}
+
+type queryCacheEntry struct {
+	result  *logcache_v1.PromQL_InstantQueryResult
+	expires time.Time
+}
+
+func newQueryCache(ttl time.Duration, maxEntries int) *queryCache {
+	return &queryCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		now:        time.Now,
+		entries:    make(map[string]queryCacheEntry),
+	}
+}
+
+// queryCacheKey normalizes the query so that formatting differences such
+// as whitespace do not cause misses. Queries that do not parse are keyed
+// as is; they are never stored.
+func queryCacheKey(query string, t time.Time) string {
+	if expr, err := promql.ParseExpr(query); err == nil {
+		query = expr.String()
+	}
+
+	return strconv.FormatInt(t.UnixNano(), 10) + " " + query
+}
+
+func (c *queryCache) get(key string) (*logcache_v1.PromQL_InstantQueryResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if !c.now().Before(e.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+
+	return e.result, true
+}
+
+func (c *queryCache) set(key string, result *logcache_v1.PromQL_InstantQueryResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= c.maxEntries {
+		c.evict(now)
+	}
+
+	c.entries[key] = queryCacheEntry{
+		result:  result,
+		expires: now.Add(c.ttl),
+	}
+}
+
+// evict removes expired entries, or the entry closest to expiring if none
+// have expired. It must be called with mu held.
+func (c *queryCache) evict(now time.Time) {
+	var (
+		oldestKey string
+		oldest    time.Time
+	)
+	for k, e := range c.entries {
+		if !now.Before(e.expires) {
+			delete(c.entries, k)
+			continue
+		}
+		if oldestKey == "" || e.expires.Before(oldest) {
+			oldestKey, oldest = k, e.expires
+		}
+	}
+
+	if len(c.entries) >= c.maxEntries {
+		delete(c.entries, oldestKey)
+	}
+}
@@ -0,0 +1,99 @@
+package promql
+
+import (
+	"context"
+	"time"
+
+	"code.cloudfoundry.org/go-log-cache/v3/rpc/logcache_v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"code.cloudfoundry.org/log-cache/pkg/client"
+)
+
+// RegisterPromQLQuerierServer registers q on the given gRPC server.
+// Alongside InstantQuery and RangeQuery, it serves RangeQueryStream, which
+// evaluates a range query one sub-window at a time and streams the result
+// of each.
+func RegisterPromQLQuerierServer(s *grpc.Server, q *PromQL) {
+	s.RegisterService(&promQLQuerierServiceDesc, q)
+}
+
+var promQLQuerierServiceDesc = grpc.ServiceDesc{
+	ServiceName: logcache_v1.PromQLQuerier_ServiceDesc.ServiceName,
+	HandlerType: (*logcache_v1.PromQLQuerierServer)(nil),
+	Methods:     logcache_v1.PromQLQuerier_ServiceDesc.Methods,
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    client.RangeQueryStreamDesc.StreamName,
+			Handler:       rangeQueryStreamHandler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: logcache_v1.PromQLQuerier_ServiceDesc.Metadata,
+}
+
+func rangeQueryStreamHandler(srv interface{}, stream grpc.ServerStream) error {
+	req := &logcache_v1.PromQL_RangeQueryRequest{}
+	if err := stream.RecvMsg(req); err != nil {
+		return err
+	}
+
+	return srv.(*PromQL).streamRangeQuery(stream.Context(), req, func(r *logcache_v1.PromQL_RangeQueryResult) error {
+		return stream.SendMsg(r)
+	})
+}
+
+// streamRangeQuery splits the range of the query into sub-windows of
+// rangeStreamSteps steps and passes the result of each to send, in order.
+// Every sub-window is evaluated at the same steps, and reads envelopes up to
+// the same end, as the whole range would, so the chunks add up to the result
+// of RangeQuery.
+func (q *PromQL) streamRangeQuery(
+	ctx context.Context,
+	req *logcache_v1.PromQL_RangeQueryRequest,
+	send func(*logcache_v1.PromQL_RangeQueryResult) error,
+) error {
+	step, err := ParseStep(req.Step)
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "couldn't parse step: %s", err)
+	}
+	if step <= 0 {
+		return status.Errorf(codes.InvalidArgument, "step must be positive, got %s", req.Step)
+	}
+
+	startTime, err := ParseTime(req.Start)
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "couldn't parse start: %s", err)
+	}
+
+	endTime, err := ParseTime(req.End)
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "couldn't parse end: %s", err)
+	}
+
+	window := step * time.Duration(q.rangeStreamSteps)
+	for chunkStart := startTime; !chunkStart.After(endTime); chunkStart = chunkStart.Add(window) {
+		chunkEnd := chunkStart.Add(window - step)
+		if chunkEnd.After(endTime) {
+			chunkEnd = endTime
+		}
+
+		result, err := q.rangeQuery(ctx, &logcache_v1.PromQL_RangeQueryRequest{
+			Query: req.Query,
+			Start: chunkStart.Format(time.RFC3339Nano),
+			End:   chunkEnd.Format(time.RFC3339Nano),
+			Step:  req.Step,
+		}, endTime)
+		if err != nil {
+			return queryError(err)
+		}
+
+		if err := send(result); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,148 @@
+package promql_test
+
+import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"time"
+
+	"code.cloudfoundry.org/go-log-cache/v3/rpc/logcache_v1"
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	"code.cloudfoundry.org/go-metric-registry/testhelpers"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"code.cloudfoundry.org/log-cache/internal/promql"
+	"code.cloudfoundry.org/log-cache/pkg/client"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RangeQueryStream", func() {
+	var (
+		q      *promql.PromQL
+		server *grpc.Server
+		c      *client.PromQLStreamClient
+		req    *logcache_v1.PromQL_RangeQueryRequest
+	)
+
+	BeforeEach(func() {
+		start := time.Unix(1700000000, 0)
+
+		var envelopes []*loggregator_v2.Envelope
+		for i := 0; i < 60; i++ {
+			for _, job := range []string{"api", "router"} {
+				envelopes = append(envelopes, &loggregator_v2.Envelope{
+					SourceId:  "some-id",
+					Timestamp: start.Add(time.Duration(i) * time.Second).UnixNano(),
+					Tags:      map[string]string{"job": job},
+					Message: &loggregator_v2.Envelope_Counter{
+						Counter: &loggregator_v2.Counter{Name: "requests", Total: uint64(i)},
+					},
+				})
+			}
+		}
+
+		q = promql.New(
+			&windowDataReader{envelopes: envelopes},
+			testhelpers.NewMetricsRegistry(),
+			log.New(io.Discard, "", 0),
+			5*time.Second,
+			promql.WithRangeStreamSteps(4),
+		)
+
+		server = grpc.NewServer()
+		promql.RegisterPromQLQuerierServer(server, q)
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		go server.Serve(lis) //nolint:errcheck
+
+		conn, err := grpc.Dial(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+		Expect(err).ToNot(HaveOccurred())
+		DeferCleanup(conn.Close)
+		c = client.NewPromQLStreamClient(conn)
+
+		req = &logcache_v1.PromQL_RangeQueryRequest{
+			Query: `requests{source_id="some-id"}`,
+			Start: strconv.FormatInt(start.Unix(), 10),
+			End:   strconv.FormatInt(start.Add(57*time.Second).Unix(), 10),
+			Step:  "3s",
+		}
+	})
+
+	AfterEach(func() {
+		server.Stop()
+	})
+
+	It("reassembles to the same result as a range query", func() {
+		expected, err := q.RangeQuery(context.Background(), req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(expected.GetMatrix().GetSeries()).To(HaveLen(2))
+
+		result, err := c.RangeQuery(context.Background(), req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(proto.Equal(result, expected)).To(BeTrue())
+	})
+
+	It("streams the range in sub-windows", func() {
+		var chunks []*logcache_v1.PromQL_Matrix
+		err := c.StreamRangeQuery(context.Background(), req, func(m *logcache_v1.PromQL_Matrix) bool {
+			chunks = append(chunks, m)
+			return true
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		// 20 steps of 3s in windows of 4 steps.
+		Expect(chunks).To(HaveLen(5))
+		for _, m := range chunks {
+			for _, s := range m.GetSeries() {
+				Expect(s.GetPoints()).To(HaveLen(4))
+			}
+		}
+	})
+
+	It("stops when the callback returns false", func() {
+		var chunks int
+		err := c.StreamRangeQuery(context.Background(), req, func(m *logcache_v1.PromQL_Matrix) bool {
+			chunks++
+			return false
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(chunks).To(Equal(1))
+	})
+
+	It("returns an error for a step that is not positive", func() {
+		req.Step = "0s"
+
+		_, err := c.RangeQuery(context.Background(), req)
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+	})
+})
+
+// windowDataReader returns the envelopes that fall within the requested
+// time range.
+type windowDataReader struct {
+	envelopes []*loggregator_v2.Envelope
+}
+
+func (r *windowDataReader) Read(
+	ctx context.Context,
+	req *logcache_v1.ReadRequest,
+) (*logcache_v1.ReadResponse, error) {
+	var batch []*loggregator_v2.Envelope
+	for _, e := range r.envelopes {
+		if e.Timestamp >= req.StartTime && (req.EndTime == 0 || e.Timestamp < req.EndTime) {
+			batch = append(batch, e)
+		}
+	}
+
+	return &logcache_v1.ReadResponse{
+		Envelopes: &loggregator_v2.EnvelopeBatch{Batch: batch},
+	}, nil
+}
@@ -0,0 +1,68 @@
+package promql
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/promql"
+)
+
+// Series returns the distinct label sets of the series that match any of the
+// selectors between start and end, as served by the Prometheus
+// /api/v1/series endpoint. Each selector must name a metric and have a
+// source_id label.
+func Series(
+	ctx context.Context,
+	r DataReader,
+	selectors []string,
+	start time.Time,
+	end time.Time,
+) ([]map[string]string, error) {
+	seen := make(map[string]struct{})
+	series := []map[string]string{}
+	for _, selector := range selectors {
+		matchers, err := promql.ParseMetricSelector(selector)
+		if err != nil {
+			return nil, err
+		}
+
+		var metric string
+		for _, m := range matchers {
+			if m.Name == labels.MetricName && m.Type == labels.MatchEqual {
+				metric = m.Value
+			}
+		}
+		if metric == "" {
+			return nil, fmt.Errorf("selector %q must select a metric name", selector)
+		}
+
+		q := &LogCacheQuerier{
+			log:             log.New(io.Discard, "", 0),
+			ctx:             ctx,
+			start:           start,
+			end:             end,
+			dataReader:      r,
+			errf:            func(error) {},
+			readConcurrency: 10,
+		}
+		set, _, err := q.Select(nil, matchers...)
+		if err != nil {
+			return nil, err
+		}
+
+		for set.Next() {
+			ls := labels.NewBuilder(set.At().Labels()).Set(labels.MetricName, metric).Labels()
+			if _, ok := seen[ls.String()]; ok {
+				continue
+			}
+			seen[ls.String()] = struct{}{}
+			series = append(series, ls.Map())
+		}
+	}
+
+	return series, nil
+}
@@ -0,0 +1,66 @@
+package promql_test
+
+import (
+	"context"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	"code.cloudfoundry.org/log-cache/internal/promql"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Series", func() {
+	var spyDataReader *spyDataReader
+
+	BeforeEach(func() {
+		spyDataReader = newSpyDataReader()
+	})
+
+	It("returns each distinct label set once with its metric name", func() {
+		now := time.Now()
+		spyDataReader.readErrs = []error{nil}
+		spyDataReader.readResults = [][]*loggregator_v2.Envelope{{
+			{
+				SourceId:  "some-id",
+				Timestamp: now.UnixNano(),
+				Tags:      map[string]string{"job": "router"},
+				Message: &loggregator_v2.Envelope_Counter{
+					Counter: &loggregator_v2.Counter{Name: "requests", Total: 1},
+				},
+			},
+			{
+				SourceId:  "some-id",
+				Timestamp: now.Add(time.Second).UnixNano(),
+				Tags:      map[string]string{"job": "router"},
+				Message: &loggregator_v2.Envelope_Counter{
+					Counter: &loggregator_v2.Counter{Name: "requests", Total: 2},
+				},
+			},
+		}}
+
+		series, err := promql.Series(
+			context.Background(),
+			spyDataReader,
+			[]string{`requests{source_id="some-id"}`},
+			now.Add(-time.Minute),
+			now.Add(time.Minute),
+		)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(series).To(ConsistOf(
+			map[string]string{"__name__": "requests", "source_id": "some-id", "job": "router"},
+		))
+	})
+
+	It("returns an error for a selector without a metric name", func() {
+		_, err := promql.Series(
+			context.Background(),
+			spyDataReader,
+			[]string{`{source_id="some-id"}`},
+			time.Unix(0, 0),
+			time.Now(),
+		)
+		Expect(err).To(MatchError(ContainSubstring("metric name")))
+	})
+})
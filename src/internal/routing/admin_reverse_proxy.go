@@ -0,0 +1,354 @@
+package routing
+
+import (
+	"context"
+	"log"
+	"time"
+
+	rpc "code.cloudfoundry.org/go-log-cache/v3/rpc/logcache_v1"
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"code.cloudfoundry.org/log-cache/internal/cache/store"
+	"code.cloudfoundry.org/log-cache/pkg/client"
+	"code.cloudfoundry.org/log-cache/pkg/rpc/logcachepb"
+)
+
+// AdminServer is the server API for the admin service.
+type AdminServer interface {
+	PurgeSourceId(context.Context, *wrapperspb.StringValue) (*wrapperspb.Int64Value, error)
+	ExportSourceId(*rpc.ReadRequest, AdminExportServer) error
+	Diagnostics(context.Context, *wrapperspb.UInt32Value) (*logcachepb.DiagnosticsResponse, error)
+	PauseSourceId(context.Context, *logcachepb.PauseSourceIdRequest) (*timestamppb.Timestamp, error)
+}
+
+// AdminExportServer is the server side of an ExportSourceId stream.
+type AdminExportServer interface {
+	Send(*loggregator_v2.Envelope) error
+	grpc.ServerStream
+}
+
+type adminExportServer struct {
+	grpc.ServerStream
+}
+
+func (s *adminExportServer) Send(e *loggregator_v2.Envelope) error {
+	return s.SendMsg(e)
+}
+
+// RegisterAdminServer registers the admin service on the given gRPC server.
+func RegisterAdminServer(s *grpc.Server, srv AdminServer) {
+	s.RegisterService(&adminServiceDesc, srv)
+}
+
+var adminServiceDesc = grpc.ServiceDesc{
+	ServiceName: client.AdminServiceName,
+	HandlerType: (*AdminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "PurgeSourceId",
+			Handler:    purgeSourceIDHandler,
+		},
+		{
+			MethodName: "Diagnostics",
+			Handler:    diagnosticsHandler,
+		},
+		{
+			MethodName: "PauseSourceId",
+			Handler:    pauseSourceIDHandler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    client.ExportSourceIDDesc.StreamName,
+			Handler:       exportSourceIDHandler,
+			ServerStreams: true,
+		},
+	},
+}
+
+func exportSourceIDHandler(srv interface{}, stream grpc.ServerStream) error {
+	in := new(rpc.ReadRequest)
+	if err := stream.RecvMsg(in); err != nil {
+		return err
+	}
+	return srv.(AdminServer).ExportSourceId(in, &adminExportServer{stream})
+}
+
+func purgeSourceIDHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(wrapperspb.StringValue)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).PurgeSourceId(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: client.PurgeSourceIDMethod,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).PurgeSourceId(ctx, req.(*wrapperspb.StringValue))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func diagnosticsHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(wrapperspb.UInt32Value)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).Diagnostics(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: client.DiagnosticsMethod,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).Diagnostics(ctx, req.(*wrapperspb.UInt32Value))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func pauseSourceIDHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(logcachepb.PauseSourceIdRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).PauseSourceId(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: client.PauseSourceIDMethod,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).PauseSourceId(ctx, req.(*logcachepb.PauseSourceIdRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// AdminClient purges or pauses a source ID on a remote node.
+type AdminClient interface {
+	PurgeSourceID(ctx context.Context, sourceID string, opts ...grpc.CallOption) (int64, error)
+	PauseSourceID(ctx context.Context, sourceID string, d time.Duration, opts ...grpc.CallOption) (time.Time, error)
+}
+
+// LocalStore is the local store the admin service works on.
+type LocalStore interface {
+	// Purge removes all data for a source ID.
+	Purge(sourceID string) int
+
+	// Diagnostics describes the limit source IDs holding the most
+	// envelopes, largest first.
+	Diagnostics(limit int) []store.SourceDiagnostics
+
+	// Pause drops the envelopes written for a source ID for a duration
+	// and returns the time at which they are stored again.
+	Pause(sourceID string, d time.Duration) time.Time
+}
+
+// Reader reads envelopes for a source ID from wherever they are stored.
+type Reader interface {
+	Read(ctx context.Context, in *rpc.ReadRequest) (*rpc.ReadResponse, error)
+}
+
+const (
+	// defaultDiagnosticsLimit is the number of source IDs diagnostics
+	// reports on when the request does not say.
+	defaultDiagnosticsLimit = 10
+
+	// maxDiagnosticsLimit bounds the size of a diagnostics response.
+	maxDiagnosticsLimit = 100
+)
+
+// AdminReverseProxy routes admin requests to the node that owns the source
+// ID.
+type AdminReverseProxy struct {
+	l        Lookup
+	clients  []AdminClient
+	localIdx int
+	local    LocalStore
+	reader   Reader
+	log      *log.Logger
+}
+
+// NewAdminReverseProxy returns a new AdminReverseProxy. The client at
+// localIdx is ignored; requests for the local node go to the LocalStore
+// instead.
+// Exports page through the given Reader, which is expected to route reads
+// itself.
+func NewAdminReverseProxy(
+	l Lookup,
+	clients []AdminClient,
+	localIdx int,
+	local LocalStore,
+	reader Reader,
+	log *log.Logger,
+) *AdminReverseProxy {
+	return &AdminReverseProxy{
+		l:        l,
+		clients:  clients,
+		localIdx: localIdx,
+		local:    local,
+		reader:   reader,
+		log:      log,
+	}
+}
+
+// PurgeSourceId removes all data for the source ID from every node that owns
+// it and returns the number of envelopes removed.
+func (a *AdminReverseProxy) PurgeSourceId(ctx context.Context, in *wrapperspb.StringValue) (*wrapperspb.Int64Value, error) {
+	sourceID := in.GetValue()
+	if sourceID == "" {
+		return nil, status.Error(codes.InvalidArgument, "source ID is required")
+	}
+
+	if localOnly(ctx) {
+		return wrapperspb.Int64(int64(a.local.Purge(sourceID))), nil
+	}
+
+	idx := a.l(sourceID)
+	if len(idx) == 0 {
+		return nil, status.Errorf(codes.Unavailable, "failed to find route for request. please try again")
+	}
+
+	remoteCtx := metadata.AppendToOutgoingContext(ctx, localOnlyKey, "true")
+
+	var purged int64
+	for _, i := range idx {
+		if i == a.localIdx {
+			purged += int64(a.local.Purge(sourceID))
+			continue
+		}
+
+		n, err := a.clients[i].PurgeSourceID(remoteCtx, sourceID)
+		if err != nil {
+			a.log.Printf("failed to purge %s on node %d: %s", sourceID, i, err)
+			return nil, err
+		}
+		purged += n
+	}
+
+	a.log.Printf("purged %d envelopes for source %s", purged, sourceID)
+	return wrapperspb.Int64(purged), nil
+}
+
+// PauseSourceId drops the envelopes written for the source ID on every node
+// that owns it for the requested duration and returns the time at which
+// they are all stored again. A missing or 0 duration resumes the source ID.
+func (a *AdminReverseProxy) PauseSourceId(ctx context.Context, in *logcachepb.PauseSourceIdRequest) (*timestamppb.Timestamp, error) {
+	sourceID := in.GetSourceId()
+	if sourceID == "" {
+		return nil, status.Error(codes.InvalidArgument, "source ID is required")
+	}
+
+	var d time.Duration
+	if in.GetDuration() != nil {
+		if err := in.GetDuration().CheckValid(); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid duration: %s", err)
+		}
+		d = in.GetDuration().AsDuration()
+	}
+	if d < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "duration must not be negative, got %s", d)
+	}
+
+	if localOnly(ctx) {
+		return timestamppb.New(a.local.Pause(sourceID, d)), nil
+	}
+
+	idx := a.l(sourceID)
+	if len(idx) == 0 {
+		return nil, status.Errorf(codes.Unavailable, "failed to find route for request. please try again")
+	}
+
+	remoteCtx := metadata.AppendToOutgoingContext(ctx, localOnlyKey, "true")
+
+	var resume time.Time
+	for _, i := range idx {
+		var (
+			r   time.Time
+			err error
+		)
+		if i == a.localIdx {
+			r = a.local.Pause(sourceID, d)
+		} else {
+			r, err = a.clients[i].PauseSourceID(remoteCtx, sourceID, d)
+			if err != nil {
+				a.log.Printf("failed to pause %s on node %d: %s", sourceID, i, err)
+				return nil, err
+			}
+		}
+
+		if r.After(resume) {
+			resume = r
+		}
+	}
+
+	a.log.Printf("paused source %s for %s", sourceID, d)
+	return timestamppb.New(resume), nil
+}
+
+// ExportSourceId streams every envelope for the source ID between the start
+// and end time of the request, oldest first. The request's limit and
+// envelope types are ignored.
+func (a *AdminReverseProxy) ExportSourceId(in *rpc.ReadRequest, stream AdminExportServer) error {
+	if in.GetSourceId() == "" {
+		return status.Error(codes.InvalidArgument, "source ID is required")
+	}
+
+	var exported int
+	err := readPages(stream.Context(), a.reader, &rpc.ReadRequest{
+		SourceId:  in.GetSourceId(),
+		StartTime: in.GetStartTime(),
+		EndTime:   in.GetEndTime(),
+	}, func(batch []*loggregator_v2.Envelope) error {
+		for _, e := range batch {
+			if err := stream.Send(e); err != nil {
+				return err
+			}
+		}
+		exported += len(batch)
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	a.log.Printf("exported %d envelopes for source %s", exported, in.GetSourceId())
+	return nil
+}
+
+// Diagnostics reports the source IDs holding the most envelopes on this
+// node, largest first, to help find the sources behind skew between nodes.
+// Unlike the other admin requests it is not routed: each node only reports
+// on its own store.
+func (a *AdminReverseProxy) Diagnostics(ctx context.Context, in *wrapperspb.UInt32Value) (*logcachepb.DiagnosticsResponse, error) {
+	limit := int(in.GetValue())
+	if limit == 0 {
+		limit = defaultDiagnosticsLimit
+	}
+	limit = min(limit, maxDiagnosticsLimit)
+
+	resp := &logcachepb.DiagnosticsResponse{}
+	for _, d := range a.local.Diagnostics(limit) {
+		resp.Sources = append(resp.Sources, &logcachepb.SourceDiagnostics{
+			SourceId:        d.SourceID,
+			Size:            int64(d.Size),
+			Depth:           int64(d.Depth),
+			OldestTimestamp: d.OldestTimestamp,
+			NewestTimestamp: d.NewestTimestamp,
+		})
+	}
+
+	return resp, nil
+}
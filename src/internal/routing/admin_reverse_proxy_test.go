@@ -0,0 +1,385 @@
+package routing_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"strconv"
+	"time"
+
+	rpc "code.cloudfoundry.org/go-log-cache/v3/rpc/logcache_v1"
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"code.cloudfoundry.org/log-cache/internal/cache/store"
+	"code.cloudfoundry.org/log-cache/internal/routing"
+	"code.cloudfoundry.org/log-cache/pkg/rpc/logcachepb"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("AdminReverseProxy", func() {
+	var (
+		lookup     *spyLookup
+		local      *spyLocalStore
+		reader     *spyPagedReader
+		spyRemote1 *spyAdminClient
+		spyRemote2 *spyAdminClient
+		p          *routing.AdminReverseProxy
+	)
+
+	BeforeEach(func() {
+		lookup = newSpyLookup()
+		local = &spyLocalStore{purged: 3}
+		spyRemote1 = &spyAdminClient{purged: 5}
+		spyRemote2 = &spyAdminClient{purged: 7}
+		reader = &spyPagedReader{}
+		p = routing.NewAdminReverseProxy(
+			lookup.Lookup,
+			[]routing.AdminClient{nil, spyRemote1, spyRemote2},
+			0,
+			local,
+			reader,
+			log.New(io.Discard, "", 0),
+		)
+	})
+
+	It("purges locally owned source IDs from the local store", func() {
+		lookup.results["a"] = []int{0}
+
+		resp, err := p.PurgeSourceId(context.Background(), wrapperspb.String("a"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.GetValue()).To(Equal(int64(3)))
+		Expect(local.sourceIDs).To(ConsistOf("a"))
+		Expect(spyRemote1.sourceIDs).To(BeEmpty())
+	})
+
+	It("forwards remote source IDs to every owning node", func() {
+		lookup.results["b"] = []int{1, 2}
+
+		resp, err := p.PurgeSourceId(context.Background(), wrapperspb.String("b"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.GetValue()).To(Equal(int64(12)))
+		Expect(local.sourceIDs).To(BeEmpty())
+		Expect(spyRemote1.sourceIDs).To(ConsistOf("b"))
+		Expect(spyRemote2.sourceIDs).To(ConsistOf("b"))
+	})
+
+	It("only purges the local store for a forwarded request", func() {
+		lookup.results["b"] = []int{1, 2}
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("log-cache-local-only", "true"))
+
+		resp, err := p.PurgeSourceId(ctx, wrapperspb.String("b"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.GetValue()).To(Equal(int64(3)))
+		Expect(local.sourceIDs).To(ConsistOf("b"))
+		Expect(spyRemote1.sourceIDs).To(BeEmpty())
+		Expect(spyRemote2.sourceIDs).To(BeEmpty())
+	})
+
+	It("returns an error when a remote purge fails", func() {
+		lookup.results["b"] = []int{1}
+		spyRemote1.err = errors.New("some-error")
+
+		_, err := p.PurgeSourceId(context.Background(), wrapperspb.String("b"))
+		Expect(err).To(MatchError("some-error"))
+	})
+
+	It("rejects an empty source ID", func() {
+		_, err := p.PurgeSourceId(context.Background(), wrapperspb.String(""))
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+	})
+
+	Describe("PauseSourceId", func() {
+		pauseRequest := func(sourceID string, d *durationpb.Duration) *logcachepb.PauseSourceIdRequest {
+			return &logcachepb.PauseSourceIdRequest{
+				SourceId: sourceID,
+				Duration: d,
+			}
+		}
+
+		It("pauses the source ID on every owning node and returns the latest resume time", func() {
+			lookup.results["b"] = []int{0, 1, 2}
+			local.resume = time.Unix(100, 0)
+			spyRemote1.resume = time.Unix(300, 0)
+			spyRemote2.resume = time.Unix(200, 0)
+
+			resp, err := p.PauseSourceId(context.Background(), pauseRequest("b", durationpb.New(5*time.Minute)))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.AsTime()).To(BeTemporally("==", time.Unix(300, 0)))
+
+			Expect(local.paused).To(ConsistOf("b"))
+			Expect(local.durations).To(ConsistOf(5 * time.Minute))
+			Expect(spyRemote1.paused).To(ConsistOf("b"))
+			Expect(spyRemote1.durations).To(ConsistOf(5 * time.Minute))
+			Expect(spyRemote2.paused).To(ConsistOf("b"))
+		})
+
+		It("only pauses the local store for a forwarded request", func() {
+			lookup.results["b"] = []int{1, 2}
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("log-cache-local-only", "true"))
+
+			_, err := p.PauseSourceId(ctx, pauseRequest("b", durationpb.New(time.Minute)))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(local.paused).To(ConsistOf("b"))
+			Expect(spyRemote1.paused).To(BeEmpty())
+			Expect(spyRemote2.paused).To(BeEmpty())
+		})
+
+		It("returns an error when a remote pause fails", func() {
+			lookup.results["b"] = []int{1}
+			spyRemote1.err = errors.New("some-error")
+
+			_, err := p.PauseSourceId(context.Background(), pauseRequest("b", durationpb.New(time.Minute)))
+			Expect(err).To(MatchError("some-error"))
+		})
+
+		It("validates the request", func() {
+			_, err := p.PauseSourceId(context.Background(), pauseRequest("", durationpb.New(time.Minute)))
+			Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+
+			_, err = p.PauseSourceId(context.Background(), pauseRequest("b", &durationpb.Duration{Seconds: 1, Nanos: -1}))
+			Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+
+			_, err = p.PauseSourceId(context.Background(), pauseRequest("b", durationpb.New(-time.Minute)))
+			Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+		})
+	})
+
+	Describe("Diagnostics", func() {
+		It("reports on the local store", func() {
+			local.diagnostics = []store.SourceDiagnostics{
+				{SourceID: "b", Size: 7, Depth: 3, OldestTimestamp: 1, NewestTimestamp: 1700000000000000001},
+				{SourceID: "a", Size: 3, Depth: 2, OldestTimestamp: 11, NewestTimestamp: 13},
+			}
+
+			resp, err := p.Diagnostics(context.Background(), wrapperspb.UInt32(2))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(local.limits).To(ConsistOf(2))
+
+			Expect(resp.GetSources()).To(HaveLen(2))
+			largest := resp.GetSources()[0]
+			Expect(largest.GetSourceId()).To(Equal("b"))
+			Expect(largest.GetSize()).To(Equal(int64(7)))
+			Expect(largest.GetDepth()).To(Equal(int64(3)))
+			Expect(largest.GetOldestTimestamp()).To(Equal(int64(1)))
+			Expect(largest.GetNewestTimestamp()).To(Equal(int64(1700000000000000001)))
+			Expect(resp.GetSources()[1].GetSourceId()).To(Equal("a"))
+
+			Expect(spyRemote1.sourceIDs).To(BeEmpty())
+		})
+
+		It("defaults and bounds the number of source IDs", func() {
+			_, err := p.Diagnostics(context.Background(), wrapperspb.UInt32(0))
+			Expect(err).ToNot(HaveOccurred())
+			_, err = p.Diagnostics(context.Background(), wrapperspb.UInt32(5000))
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(local.limits).To(Equal([]int{10, 100}))
+		})
+	})
+
+	Describe("ExportSourceId", func() {
+		BeforeEach(func() {
+			for i := int64(0); i < 2500; i++ {
+				reader.envelopes = append(reader.envelopes, &loggregator_v2.Envelope{
+					SourceId:  "a",
+					Timestamp: i,
+				})
+			}
+		})
+
+		It("streams the full window across multiple reads", func() {
+			stream := &spyExportServer{ctx: context.Background()}
+
+			err := p.ExportSourceId(&rpc.ReadRequest{
+				SourceId:  "a",
+				StartTime: 0,
+				EndTime:   2500,
+			}, stream)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(stream.envelopes).To(HaveLen(2500))
+			for i, e := range stream.envelopes {
+				Expect(e.Timestamp).To(Equal(int64(i)))
+			}
+			Expect(reader.reqs).To(HaveLen(3))
+			Expect(reader.reqs[1].StartTime).To(Equal(int64(999)))
+			Expect(reader.reqs[2].StartTime).To(Equal(int64(1998)))
+		})
+
+		It("streams envelopes of different nodes sharing the timestamp of a page boundary", func() {
+			reader.envelopes = append(reader.envelopes[:999:999],
+				&loggregator_v2.Envelope{SourceId: "a", InstanceId: "0", Timestamp: 999},
+				&loggregator_v2.Envelope{SourceId: "a", InstanceId: "1", Timestamp: 999},
+				&loggregator_v2.Envelope{SourceId: "a", InstanceId: "2", Timestamp: 999},
+				&loggregator_v2.Envelope{SourceId: "a", Timestamp: 1000},
+			)
+			stream := &spyExportServer{ctx: context.Background()}
+
+			err := p.ExportSourceId(&rpc.ReadRequest{
+				SourceId: "a",
+				EndTime:  2500,
+			}, stream)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(stream.envelopes).To(HaveLen(1003))
+			var instances []string
+			for _, e := range stream.envelopes[999:1002] {
+				instances = append(instances, e.InstanceId)
+			}
+			Expect(instances).To(ConsistOf("0", "1", "2"))
+			Expect(stream.envelopes[1002].Timestamp).To(Equal(int64(1000)))
+		})
+
+		It("moves past a page of envelopes that all share a timestamp", func() {
+			reader.envelopes = nil
+			for i := 0; i < 1200; i++ {
+				reader.envelopes = append(reader.envelopes, &loggregator_v2.Envelope{
+					SourceId:   "a",
+					InstanceId: strconv.Itoa(i),
+					Timestamp:  5,
+				})
+			}
+			reader.envelopes = append(reader.envelopes, &loggregator_v2.Envelope{SourceId: "a", Timestamp: 6})
+			stream := &spyExportServer{ctx: context.Background()}
+
+			err := p.ExportSourceId(&rpc.ReadRequest{
+				SourceId: "a",
+				EndTime:  10,
+			}, stream)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(stream.envelopes).To(HaveLen(1001))
+			Expect(stream.envelopes[1000].Timestamp).To(Equal(int64(6)))
+		})
+
+		It("honors the start and end of the request", func() {
+			stream := &spyExportServer{ctx: context.Background()}
+
+			err := p.ExportSourceId(&rpc.ReadRequest{
+				SourceId:  "a",
+				StartTime: 500,
+				EndTime:   1600,
+			}, stream)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(stream.envelopes).To(HaveLen(1100))
+			Expect(stream.envelopes[0].Timestamp).To(Equal(int64(500)))
+			Expect(stream.envelopes[1099].Timestamp).To(Equal(int64(1599)))
+		})
+
+		It("returns an error when a read fails", func() {
+			reader.err = errors.New("some-error")
+
+			err := p.ExportSourceId(&rpc.ReadRequest{SourceId: "a"}, &spyExportServer{ctx: context.Background()})
+			Expect(err).To(MatchError("some-error"))
+		})
+
+		It("rejects an empty source ID", func() {
+			err := p.ExportSourceId(&rpc.ReadRequest{}, &spyExportServer{ctx: context.Background()})
+			Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+		})
+	})
+})
+
+type spyPagedReader struct {
+	envelopes []*loggregator_v2.Envelope
+	reqs      []*rpc.ReadRequest
+	ctxs      []context.Context
+	err       error
+}
+
+func (s *spyPagedReader) Read(ctx context.Context, in *rpc.ReadRequest) (*rpc.ReadResponse, error) {
+	s.reqs = append(s.reqs, in)
+	s.ctxs = append(s.ctxs, ctx)
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	var batch []*loggregator_v2.Envelope
+	for _, e := range s.envelopes {
+		if e.Timestamp < in.StartTime || e.Timestamp >= in.EndTime {
+			continue
+		}
+		if len(batch) == int(in.Limit) {
+			break
+		}
+		batch = append(batch, e)
+	}
+
+	return &rpc.ReadResponse{
+		Envelopes: &loggregator_v2.EnvelopeBatch{Batch: batch},
+	}, nil
+}
+
+type spyExportServer struct {
+	grpc.ServerStream
+	ctx       context.Context
+	envelopes []*loggregator_v2.Envelope
+}
+
+func (s *spyExportServer) Context() context.Context {
+	return s.ctx
+}
+
+func (s *spyExportServer) Send(e *loggregator_v2.Envelope) error {
+	s.envelopes = append(s.envelopes, e)
+	return nil
+}
+
+type spyLocalStore struct {
+	sourceIDs []string
+	purged    int
+
+	diagnostics []store.SourceDiagnostics
+	limits      []int
+
+	paused    []string
+	durations []time.Duration
+	resume    time.Time
+}
+
+func (s *spyLocalStore) Purge(sourceID string) int {
+	s.sourceIDs = append(s.sourceIDs, sourceID)
+	return s.purged
+}
+
+func (s *spyLocalStore) Diagnostics(limit int) []store.SourceDiagnostics {
+	s.limits = append(s.limits, limit)
+	return s.diagnostics
+}
+
+func (s *spyLocalStore) Pause(sourceID string, d time.Duration) time.Time {
+	s.paused = append(s.paused, sourceID)
+	s.durations = append(s.durations, d)
+	return s.resume
+}
+
+type spyAdminClient struct {
+	sourceIDs []string
+	purged    int64
+	err       error
+
+	paused    []string
+	durations []time.Duration
+	resume    time.Time
+}
+
+func (s *spyAdminClient) PurgeSourceID(ctx context.Context, sourceID string, opts ...grpc.CallOption) (int64, error) {
+	s.sourceIDs = append(s.sourceIDs, sourceID)
+	return s.purged, s.err
+}
+
+func (s *spyAdminClient) PauseSourceID(ctx context.Context, sourceID string, d time.Duration, opts ...grpc.CallOption) (time.Time, error) {
+	s.paused = append(s.paused, sourceID)
+	s.durations = append(s.durations, d)
+	return s.resume, s.err
+}
@@ -0,0 +1,189 @@
+package routing
+
+import (
+	"context"
+	"log"
+	"sort"
+
+	rpc "code.cloudfoundry.org/go-log-cache/v3/rpc/logcache_v1"
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"code.cloudfoundry.org/log-cache/pkg/client"
+	"code.cloudfoundry.org/log-cache/pkg/rpc/logcachepb"
+)
+
+// AggregationServer is the server API for the aggregation service.
+type AggregationServer interface {
+	Aggregate(context.Context, *rpc.ReadRequest) (*logcachepb.AggregateResponse, error)
+}
+
+// RegisterAggregationServer registers the aggregation service on the given
+// gRPC server.
+func RegisterAggregationServer(s *grpc.Server, srv AggregationServer) {
+	s.RegisterService(&aggregationServiceDesc, srv)
+}
+
+var aggregationServiceDesc = grpc.ServiceDesc{
+	ServiceName: client.AggregationServiceName,
+	HandlerType: (*AggregationServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Aggregate",
+			Handler:    aggregateHandler,
+		},
+	},
+}
+
+func aggregateHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(rpc.ReadRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AggregationServer).Aggregate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: client.AggregateMethod,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AggregationServer).Aggregate(ctx, req.(*rpc.ReadRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Aggregator aggregates a metric by tag on the server, so that clients
+// such as dashboards do not have to read every envelope to do it.
+type Aggregator struct {
+	reader Reader
+	log    *log.Logger
+}
+
+// NewAggregator returns a new Aggregator that reads envelopes from the
+// given Reader, which is expected to route reads itself.
+func NewAggregator(reader Reader, log *log.Logger) *Aggregator {
+	return &Aggregator{
+		reader: reader,
+		log:    log,
+	}
+}
+
+type aggregate struct {
+	sum   float64
+	count int64
+}
+
+// counterIncrease is the increase of the total of a counter series over
+// the window of an aggregation.
+type counterIncrease struct {
+	group    string
+	last     uint64
+	increase float64
+}
+
+// Aggregate reads the counters and gauges of the request's source ID
+// between its start and end time whose names match its name filter, groups
+// them by the tag named in the GroupByMetadata and returns the sum, average
+// and count of their values per tag value, ordered by tag value. Each gauge
+// value counts once. Counters are cumulative, so each counter series
+// counts once with the increase of its total over the window. A total
+// lower than the previous one is a reset, as for counter rates. The
+// request's limit, order and envelope types are ignored.
+func (a *Aggregator) Aggregate(ctx context.Context, in *rpc.ReadRequest) (*logcachepb.AggregateResponse, error) {
+	if in.GetSourceId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "source ID is required")
+	}
+	if in.GetNameFilter() == "" {
+		return nil, status.Error(codes.InvalidArgument, "metric name is required")
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	groupBy := md.Get(client.GroupByMetadata)
+	if len(groupBy) == 0 || groupBy[0] == "" {
+		return nil, status.Error(codes.InvalidArgument, "tag to group by is required")
+	}
+
+	// Only the exact metric is read. Other read options of the incoming
+	// request must not change the values that are aggregated.
+	readCtx := metadata.NewIncomingContext(ctx, metadata.Pairs(client.MatchExactMetadata, "true"))
+
+	groups := make(map[string]*aggregate)
+	group := func(value string) *aggregate {
+		g, ok := groups[value]
+		if !ok {
+			g = &aggregate{}
+			groups[value] = g
+		}
+
+		return g
+	}
+
+	counters := make(map[string]*counterIncrease)
+	err := readPages(readCtx, a.reader, &rpc.ReadRequest{
+		SourceId:      in.GetSourceId(),
+		StartTime:     in.GetStartTime(),
+		EndTime:       in.GetEndTime(),
+		EnvelopeTypes: []rpc.EnvelopeType{rpc.EnvelopeType_COUNTER, rpc.EnvelopeType_GAUGE},
+		NameFilter:    in.GetNameFilter(),
+	}, func(batch []*loggregator_v2.Envelope) error {
+		for _, e := range batch {
+			if c := e.GetCounter(); c != nil {
+				key := counterKey(e)
+				ci, ok := counters[key]
+				if !ok {
+					counters[key] = &counterIncrease{group: e.GetTags()[groupBy[0]], last: c.GetTotal()}
+					continue
+				}
+
+				if c.GetTotal() >= ci.last {
+					ci.increase += float64(c.GetTotal() - ci.last)
+				} else {
+					ci.increase += float64(c.GetTotal())
+				}
+				ci.last = c.GetTotal()
+				continue
+			}
+
+			for _, v := range e.GetGauge().GetMetrics() {
+				g := group(e.GetTags()[groupBy[0]])
+				g.sum += v.GetValue()
+				g.count++
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		a.log.Printf("failed to aggregate %s: %s", in.GetSourceId(), err)
+		return nil, err
+	}
+
+	for _, ci := range counters {
+		g := group(ci.group)
+		g.sum += ci.increase
+		g.count++
+	}
+
+	values := make([]string, 0, len(groups))
+	for v := range groups {
+		values = append(values, v)
+	}
+	sort.Strings(values)
+
+	resp := &logcachepb.AggregateResponse{}
+	for _, v := range values {
+		g := groups[v]
+		resp.Groups = append(resp.Groups, &logcachepb.AggregateGroup{
+			Value: v,
+			Sum:   g.sum,
+			Avg:   g.sum / float64(g.count),
+			Count: g.count,
+		})
+	}
+
+	return resp, nil
+}
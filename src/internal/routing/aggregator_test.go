@@ -0,0 +1,186 @@
+package routing_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+
+	rpc "code.cloudfoundry.org/go-log-cache/v3/rpc/logcache_v1"
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"code.cloudfoundry.org/log-cache/internal/routing"
+	"code.cloudfoundry.org/log-cache/pkg/client"
+	"code.cloudfoundry.org/log-cache/pkg/rpc/logcachepb"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Aggregator", func() {
+	var (
+		reader *spyPagedReader
+		a      *routing.Aggregator
+		ctx    context.Context
+	)
+
+	counter := func(ts int64, az string, total uint64) *loggregator_v2.Envelope {
+		e := &loggregator_v2.Envelope{
+			SourceId:  "a",
+			Timestamp: ts,
+			Message: &loggregator_v2.Envelope_Counter{
+				Counter: &loggregator_v2.Counter{Name: "requests", Total: total},
+			},
+		}
+		if az != "" {
+			e.Tags = map[string]string{"az": az}
+		}
+
+		return e
+	}
+
+	fields := func(resp *logcachepb.AggregateResponse) []map[string]interface{} {
+		var groups []map[string]interface{}
+		for _, g := range resp.GetGroups() {
+			groups = append(groups, map[string]interface{}{
+				"value": g.GetValue(),
+				"sum":   g.GetSum(),
+				"avg":   g.GetAvg(),
+				"count": g.GetCount(),
+			})
+		}
+
+		return groups
+	}
+
+	BeforeEach(func() {
+		reader = &spyPagedReader{}
+		a = routing.NewAggregator(reader, log.New(io.Discard, "", 0))
+		ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs(client.GroupByMetadata, "az"))
+	})
+
+	It("sums the increase of counters per value of the tag", func() {
+		reader.envelopes = []*loggregator_v2.Envelope{
+			counter(1, "z1", 10),
+			counter(2, "z2", 5),
+			counter(3, "z1", 20),
+			counter(4, "z2", 7),
+			counter(5, "z1", 30),
+			counter(6, "", 4),
+		}
+
+		resp, err := a.Aggregate(ctx, &rpc.ReadRequest{
+			SourceId:   "a",
+			EndTime:    10,
+			NameFilter: "requests",
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(fields(resp)).To(Equal([]map[string]interface{}{
+			{"value": "", "sum": 0.0, "avg": 0.0, "count": int64(1)},
+			{"value": "z1", "sum": 20.0, "avg": 20.0, "count": int64(1)},
+			{"value": "z2", "sum": 2.0, "avg": 2.0, "count": int64(1)},
+		}))
+	})
+
+	It("counts each counter series once and handles resets", func() {
+		instance := func(id string, e *loggregator_v2.Envelope) *loggregator_v2.Envelope {
+			e.InstanceId = id
+			return e
+		}
+		reader.envelopes = []*loggregator_v2.Envelope{
+			instance("0", counter(1, "z1", 100)),
+			instance("1", counter(2, "z1", 50)),
+			instance("0", counter(3, "z1", 110)),
+			instance("0", counter(4, "z1", 5)),
+			instance("1", counter(5, "z1", 60)),
+			instance("0", counter(6, "z1", 15)),
+			instance("1", counter(7, "z1", 60)),
+		}
+
+		resp, err := a.Aggregate(ctx, &rpc.ReadRequest{
+			SourceId:   "a",
+			EndTime:    10,
+			NameFilter: "requests",
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(fields(resp)).To(Equal([]map[string]interface{}{
+			{"value": "z1", "sum": 35.0, "avg": 17.5, "count": int64(2)},
+		}))
+	})
+
+	It("aggregates gauge values", func() {
+		reader.envelopes = []*loggregator_v2.Envelope{
+			{
+				Timestamp: 1,
+				Tags:      map[string]string{"az": "z1"},
+				Message: &loggregator_v2.Envelope_Gauge{
+					Gauge: &loggregator_v2.Gauge{
+						Metrics: map[string]*loggregator_v2.GaugeValue{"cpu": {Value: 0.5}},
+					},
+				},
+			},
+			{
+				Timestamp: 2,
+				Tags:      map[string]string{"az": "z1"},
+				Message: &loggregator_v2.Envelope_Gauge{
+					Gauge: &loggregator_v2.Gauge{
+						Metrics: map[string]*loggregator_v2.GaugeValue{"cpu": {Value: 1.5}},
+					},
+				},
+			},
+		}
+
+		resp, err := a.Aggregate(ctx, &rpc.ReadRequest{SourceId: "a", EndTime: 10, NameFilter: "cpu"})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(fields(resp)).To(Equal([]map[string]interface{}{
+			{"value": "z1", "sum": 2.0, "avg": 1.0, "count": int64(2)},
+		}))
+	})
+
+	It("reads every page of the window for the exact metric", func() {
+		for i := int64(0); i < 2500; i++ {
+			reader.envelopes = append(reader.envelopes, counter(i, "z1", uint64(i)))
+		}
+
+		resp, err := a.Aggregate(ctx, &rpc.ReadRequest{
+			SourceId:   "a",
+			EndTime:    2500,
+			Limit:      10,
+			NameFilter: "requests",
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fields(resp)[0]["sum"]).To(Equal(2499.0))
+
+		Expect(reader.reqs).To(HaveLen(3))
+		Expect(reader.reqs[0].NameFilter).To(Equal("requests"))
+		Expect(reader.reqs[0].EnvelopeTypes).To(ConsistOf(rpc.EnvelopeType_COUNTER, rpc.EnvelopeType_GAUGE))
+
+		md, _ := metadata.FromIncomingContext(reader.ctxs[0])
+		Expect(md.Get(client.MatchExactMetadata)).To(ConsistOf("true"))
+		Expect(md.Get(client.GroupByMetadata)).To(BeEmpty())
+	})
+
+	It("returns an error when a read fails", func() {
+		reader.err = errors.New("some-error")
+
+		_, err := a.Aggregate(ctx, &rpc.ReadRequest{SourceId: "a", NameFilter: "requests"})
+		Expect(err).To(MatchError("some-error"))
+	})
+
+	It("requires a source ID, metric and tag", func() {
+		_, err := a.Aggregate(ctx, &rpc.ReadRequest{NameFilter: "requests"})
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+
+		_, err = a.Aggregate(ctx, &rpc.ReadRequest{SourceId: "a"})
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+
+		_, err = a.Aggregate(context.Background(), &rpc.ReadRequest{SourceId: "a", NameFilter: "requests"})
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+	})
+})
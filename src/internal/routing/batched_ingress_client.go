@@ -26,6 +26,13 @@ type BatchedIngressClient struct {
 	sendFailureMetric metrics.Counter
 
 	localOnly bool
+
+	retries      int
+	retryTimeout time.Duration
+	retryQueue   chan *rpc.SendRequest
+
+	fallback       rpc.IngressClient
+	fallbackMetric metrics.Counter
 }
 
 type BatchedIngressClientOption func(b *BatchedIngressClient)
@@ -34,6 +41,38 @@ func WithLocalOnlyDisabled(b *BatchedIngressClient) {
 	b.localOnly = false
 }
 
+// retryBackoff is how long a failed batch waits before its first retry.
+// The wait doubles with every further retry.
+const retryBackoff = 50 * time.Millisecond
+
+// retryQueueSize is the number of failed batches that may wait to be
+// retried.
+const retryQueueSize = 100
+
+// WithSendRetries returns a BatchedIngressClientOption that retries a batch
+// that failed to send up to retries times, giving each attempt timeout to
+// complete, so that a brief outage of the receiving node does not lose it.
+// Batches are retried in the background so that new batches are not held
+// up. A batch that fails while retryQueueSize batches are already waiting
+// to be retried is not retried. It defaults to a single attempt that times
+// out after 3 seconds.
+func WithSendRetries(retries int, timeout time.Duration) BatchedIngressClientOption {
+	return func(b *BatchedIngressClient) {
+		b.retries = retries
+		b.retryTimeout = timeout
+	}
+}
+
+// WithSendFallback returns a BatchedIngressClientOption that sends a batch
+// to c once every attempt to send it failed, counting its envelopes in
+// fallbackMetric. It defaults to dropping the batch.
+func WithSendFallback(c rpc.IngressClient, fallbackMetric metrics.Counter) BatchedIngressClientOption {
+	return func(b *BatchedIngressClient) {
+		b.fallback = c
+		b.fallbackMetric = fallbackMetric
+	}
+}
+
 // NewBatchedIngressClient returns a new BatchedIngressClient.
 func NewBatchedIngressClient(
 	size int,
@@ -62,6 +101,10 @@ func NewBatchedIngressClient(
 		opt(b)
 	}
 
+	if b.retries > 0 {
+		b.retryQueue = make(chan *rpc.SendRequest, retryQueueSize)
+		go b.retryLoop()
+	}
 	go b.start()
 
 	return b
@@ -95,14 +138,74 @@ func (b *BatchedIngressClient) write(batch []interface{}) {
 		e = append(e, i.(*loggregator_v2.Envelope))
 	}
 
-	ctx, _ := context.WithTimeout(context.Background(), 3*time.Second)
-	_, err := b.c.Send(ctx, &rpc.SendRequest{
+	req := &rpc.SendRequest{
 		LocalOnly: b.localOnly,
 		Envelopes: &loggregator_v2.EnvelopeBatch{Batch: e},
-	})
+	}
 
-	if err != nil {
-		b.log.Printf("failed to write %d envelopes: %s", len(e), err)
-		b.sendFailureMetric.Add(1)
+	err := b.send(req)
+	if err == nil {
+		return
 	}
+
+	if b.retries > 0 {
+		select {
+		case b.retryQueue <- req:
+			return
+		default:
+		}
+	}
+
+	b.fail(req, err)
+}
+
+// retryLoop retries the failed batches of the retry queue with a doubling
+// backoff.
+func (b *BatchedIngressClient) retryLoop() {
+	for req := range b.retryQueue {
+		var err error
+		backoff := retryBackoff
+		for attempt := 0; attempt < b.retries; attempt++ {
+			time.Sleep(backoff)
+			backoff *= 2
+
+			if err = b.send(req); err == nil {
+				break
+			}
+		}
+
+		if err != nil {
+			b.fail(req, err)
+		}
+	}
+}
+
+// fail gives up on sending the request to the client and sends it to the
+// fallback instead, if there is one.
+func (b *BatchedIngressClient) fail(req *rpc.SendRequest, err error) {
+	n := len(req.GetEnvelopes().GetBatch())
+	b.log.Printf("failed to write %d envelopes: %s", n, err)
+	b.sendFailureMetric.Add(1)
+
+	if b.fallback != nil {
+		if _, err := b.fallback.Send(context.Background(), req); err != nil {
+			b.log.Printf("failed to write %d envelopes to the fallback: %s", n, err)
+			return
+		}
+		b.fallbackMetric.Add(float64(n))
+	}
+}
+
+// send makes a single attempt to send the request.
+func (b *BatchedIngressClient) send(req *rpc.SendRequest) error {
+	timeout := 3 * time.Second
+	if b.retries > 0 {
+		timeout = b.retryTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	_, err := b.c.Send(ctx, req)
+	return err
 }
@@ -1,8 +1,10 @@
 package routing_test
 
 import (
+	"errors"
 	"io"
 	"log"
+	"sync"
 	"time"
 
 	"code.cloudfoundry.org/go-metric-registry/testhelpers"
@@ -12,6 +14,7 @@ import (
 	metrics "code.cloudfoundry.org/go-metric-registry"
 	"code.cloudfoundry.org/log-cache/internal/routing"
 	"golang.org/x/net/context"
+	"google.golang.org/grpc"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -114,6 +117,103 @@ var _ = Describe("BatchedIngressClient", func() {
 		}
 	})
 
+	Context("with retries", func() {
+		var fallback *spyIngressClient
+
+		send := func() {
+			_, err := c.Send(context.Background(), &rpc.SendRequest{
+				Envelopes: &loggregator_v2.EnvelopeBatch{
+					Batch: []*loggregator_v2.Envelope{
+						{Timestamp: 1},
+					},
+				},
+			})
+			Expect(err).ToNot(HaveOccurred())
+		}
+
+		BeforeEach(func() {
+			fallback = newSpyIngressClient()
+			c = routing.NewBatchedIngressClient(
+				1,
+				time.Hour,
+				ingressClient,
+				spyDropped,
+				m.NewCounter("send_failure", "some help text"),
+				log.New(io.Discard, "", 0),
+				routing.WithSendRetries(2, time.Second),
+				routing.WithSendFallback(fallback, m.NewCounter("fallback", "some help text")),
+			)
+		})
+
+		It("sends a batch to the peer once it recovers", func() {
+			ingressClient.mu.Lock()
+			ingressClient.failures = 1
+			ingressClient.mu.Unlock()
+
+			send()
+
+			Eventually(ingressClient.Requests).Should(HaveLen(2))
+			Expect(ingressClient.Requests()[1].Envelopes.Batch).To(ConsistOf(&loggregator_v2.Envelope{Timestamp: 1}))
+			Consistently(fallback.Requests).Should(BeEmpty())
+			Expect(m.GetMetricValue("send_failure", nil)).To(BeZero())
+		})
+
+		It("sends a batch to the fallback once every retry failed", func() {
+			ingressClient.mu.Lock()
+			ingressClient.failures = 3
+			ingressClient.mu.Unlock()
+
+			send()
+
+			Eventually(fallback.Requests).Should(HaveLen(1))
+			Expect(fallback.Requests()[0].Envelopes.Batch).To(ConsistOf(&loggregator_v2.Envelope{Timestamp: 1}))
+			Expect(ingressClient.Requests()).To(HaveLen(3))
+			Expect(m.GetMetricValue("fallback", nil)).To(Equal(1.0))
+			Expect(m.GetMetricValue("send_failure", nil)).To(Equal(1.0))
+		})
+	})
+
+	It("sends new batches while a failed batch waits to be retried", func() {
+		var timestamps []int64
+		var mu sync.Mutex
+		peer := routing.IngressClientFunc(func(ctx context.Context, r *rpc.SendRequest, opts ...grpc.CallOption) (*rpc.SendResponse, error) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			ts := r.GetEnvelopes().GetBatch()[0].GetTimestamp()
+			timestamps = append(timestamps, ts)
+			if ts == 1 {
+				return nil, errors.New("some-error")
+			}
+			return &rpc.SendResponse{}, nil
+		})
+		c = routing.NewBatchedIngressClient(
+			1,
+			time.Hour,
+			peer,
+			spyDropped,
+			m.NewCounter("send_failure", "some help text"),
+			log.New(io.Discard, "", 0),
+			routing.WithSendRetries(2, time.Second),
+		)
+
+		for _, ts := range []int64{1, 2} {
+			_, err := c.Send(context.Background(), &rpc.SendRequest{
+				Envelopes: &loggregator_v2.EnvelopeBatch{
+					Batch: []*loggregator_v2.Envelope{{Timestamp: ts}},
+				},
+			})
+			Expect(err).ToNot(HaveOccurred())
+		}
+
+		Eventually(func() []int64 {
+			mu.Lock()
+			defer mu.Unlock()
+			return append([]int64(nil), timestamps...)
+		}).Should(Equal([]int64{1, 2, 1, 1}))
+		Eventually(func() float64 { return m.GetMetricValue("send_failure", nil) }).Should(Equal(1.0))
+	})
+
 	It("sends envelopes with LocalOnly false with option", func() {
 		c = routing.NewBatchedIngressClient(
 			5,
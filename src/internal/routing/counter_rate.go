@@ -0,0 +1,91 @@
+package routing
+
+import (
+	"sort"
+	"strings"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+
+	"code.cloudfoundry.org/log-cache/pkg/client"
+)
+
+// counterRates replaces every counter envelope with a gauge envelope
+// holding the per second rate of the counter since the previous envelope of
+// the same counter. A total lower than the previous one is a reset, and the
+// new total is taken as the increase. The first envelope of each counter,
+// and envelopes with the same timestamp as the previous one, have no rate
+// and are dropped. Other envelopes are returned as is, in the same order.
+func counterRates(envelopes []*loggregator_v2.Envelope, descending bool) []*loggregator_v2.Envelope {
+	chronological := make([]int, len(envelopes))
+	for i := range chronological {
+		chronological[i] = i
+		if descending {
+			chronological[i] = len(envelopes) - 1 - i
+		}
+	}
+
+	rates := make([]*loggregator_v2.Envelope, len(envelopes))
+	previous := make(map[string]*loggregator_v2.Envelope)
+	for _, i := range chronological {
+		e := envelopes[i]
+		if e.GetCounter() == nil {
+			continue
+		}
+
+		key := counterKey(e)
+		prev, ok := previous[key]
+		previous[key] = e
+		if !ok || e.GetTimestamp() <= prev.GetTimestamp() {
+			continue
+		}
+
+		increase := float64(e.GetCounter().GetTotal())
+		if e.GetCounter().GetTotal() >= prev.GetCounter().GetTotal() {
+			increase -= float64(prev.GetCounter().GetTotal())
+		}
+		seconds := float64(e.GetTimestamp()-prev.GetTimestamp()) / 1e9
+
+		rates[i] = &loggregator_v2.Envelope{
+			Timestamp:  e.GetTimestamp(),
+			SourceId:   e.GetSourceId(),
+			InstanceId: e.GetInstanceId(),
+			Tags:       e.GetTags(),
+			Message: &loggregator_v2.Envelope_Gauge{
+				Gauge: &loggregator_v2.Gauge{
+					Metrics: map[string]*loggregator_v2.GaugeValue{
+						e.GetCounter().GetName(): {
+							Unit:  client.CounterRateUnit,
+							Value: increase / seconds,
+						},
+					},
+				},
+			},
+		}
+	}
+
+	var res []*loggregator_v2.Envelope
+	for i, e := range envelopes {
+		switch {
+		case rates[i] != nil:
+			res = append(res, rates[i])
+		case e.GetCounter() == nil:
+			res = append(res, e)
+		}
+	}
+
+	return res
+}
+
+// counterKey identifies a counter by its source, instance, name and tags.
+func counterKey(e *loggregator_v2.Envelope) string {
+	tags := make([]string, 0, len(e.GetTags()))
+	for k, v := range e.GetTags() {
+		tags = append(tags, k+"="+v)
+	}
+	sort.Strings(tags)
+
+	return strings.Join(
+		append([]string{e.GetSourceId(), e.GetInstanceId(), e.GetCounter().GetName()}, tags...),
+		"\xff",
+	)
+}
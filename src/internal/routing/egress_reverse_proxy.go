@@ -6,15 +6,24 @@ import (
 	"errors"
 	"log"
 	"math/big"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
 	"sync/atomic"
 	"time"
 	"unsafe"
 
 	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metrics "code.cloudfoundry.org/go-metric-registry"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 
 	rpc "code.cloudfoundry.org/go-log-cache/v3/rpc/logcache_v1"
 	"google.golang.org/grpc/codes"
+
+	"code.cloudfoundry.org/log-cache/pkg/client"
 )
 
 // EgressReverseProxy is a reverse proxy for Egress requests.
@@ -28,6 +37,14 @@ type EgressReverseProxy struct {
 	localMetaCache    unsafe.Pointer
 	metaCacheDuration time.Duration
 
+	metaMu         sync.Mutex
+	remoteMetaCall *metaCall
+
+	routingFallback metrics.Counter
+
+	fanOut        bool
+	peerOpTimeout time.Duration
+
 	rpc.UnimplementedEgressServer
 }
 
@@ -55,11 +72,63 @@ func NewEgressReverseProxy(
 	return e
 }
 
-// Read will either read from the local node or remote nodes.
+// localOnlyKey marks a request that was fanned out by another node and must
+// only be served from the local store.
+const localOnlyKey = "log-cache-local-only"
+
+// localOnly reports whether the request is marked local only. A value that
+// is not a bool does not mark it, so that a malformed value can not narrow a
+// read to a single node.
+func localOnly(ctx context.Context) bool {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return false
+	}
+
+	values := md.Get(localOnlyKey)
+	if len(values) == 0 {
+		return false
+	}
+
+	b, err := strconv.ParseBool(values[0])
+	return err == nil && b
+}
+
+// Read will either read from the local node or remote nodes. Timestamps
+// are rebased on the node that received the Read, after reading.
 func (e *EgressReverseProxy) Read(ctx context.Context, in *rpc.ReadRequest) (*rpc.ReadResponse, error) {
-	idx := e.l(in.GetSourceId())
+	ctx = forwardReadFilters(ctx)
+
+	reference, err := rebaseTo(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := e.read(ctx, in)
+	if err != nil || reference == "" {
+		return resp, err
+	}
+
+	return e.rebase(ctx, in.GetSourceId(), reference, resp)
+}
+
+func (e *EgressReverseProxy) read(ctx context.Context, in *rpc.ReadRequest) (*rpc.ReadResponse, error) {
+	if e.fanOut {
+		if localOnly(ctx) {
+			return e.clients[e.localIdx].Read(ctx, in)
+		}
+
+		return e.fanOutRead(ctx, in)
+	}
+
+	idx := e.routableNodes(e.l(in.GetSourceId()))
 	if len(idx) == 0 {
-		return nil, status.Errorf(codes.Unavailable, "failed to find route for request. please try again")
+		if e.routingFallback == nil {
+			return nil, status.Errorf(codes.Unavailable, "failed to find route for request. please try again")
+		}
+
+		e.routingFallback.Add(1)
+		return e.clients[e.localIdx].Read(ctx, in)
 	}
 	for _, i := range idx {
 		if i == e.localIdx {
@@ -70,12 +139,241 @@ func (e *EgressReverseProxy) Read(ctx context.Context, in *rpc.ReadRequest) (*rp
 	return e.remoteRead(idx, ctx, in)
 }
 
+// forwardReadFilters copies the tag, has tags and unit filters, the limit
+// per type, the minimum severity, the cursor and the counter rate, newest,
+// latest per series, include spilled and match exact options of an incoming
+// Read to the outgoing context so that remote nodes apply them too. Rebasing
+// is left out because it is applied by the node that received the Read.
+func forwardReadFilters(ctx context.Context) context.Context {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ctx
+	}
+
+	for _, key := range []string{
+		client.TagFilterMetadata,
+		client.HasTagsMetadata,
+		client.UnitFilterMetadata,
+		client.LimitPerTypeMetadata,
+		client.MinSeverityMetadata,
+		client.CounterRateMetadata,
+		client.NewestMetadata,
+		client.LatestPerSeriesMetadata,
+		client.IncludeSpilledMetadata,
+		client.MatchExactMetadata,
+		client.CursorMetadata,
+	} {
+		for _, f := range md.Get(key) {
+			ctx = metadata.AppendToOutgoingContext(ctx, key, f)
+		}
+	}
+
+	return ctx
+}
+
+// fanOutRead reads the source ID from every node and merges the results,
+// honoring the order and limit of the request. The OldestTimestampTrailer of
+// the merged response is the oldest of the nodes' trailers.
+func (e *EgressReverseProxy) fanOutRead(ctx context.Context, in *rpc.ReadRequest) (*rpc.ReadResponse, error) {
+	if md, ok := metadata.FromIncomingContext(ctx); ok && len(md.Get(client.CursorMetadata)) > 0 {
+		return nil, status.Error(codes.InvalidArgument, "cursor is not supported when reads are served by every node")
+	}
+
+	batches := make([][]*loggregator_v2.Envelope, len(e.clients))
+	trailers := make([]metadata.MD, len(e.clients))
+	errs, incomplete := e.callPeers(ctx, func(ctx context.Context, i int) error {
+		if i == e.localIdx {
+			// The local store sets its trailers on the server stream
+			// instead of returning them.
+			resp, err := e.clients[i].Read(withCapturedTrailer(ctx, &trailers[i]), in)
+			batches[i] = resp.GetEnvelopes().GetBatch()
+			return err
+		}
+
+		ctx = metadata.AppendToOutgoingContext(ctx, localOnlyKey, "true")
+		resp, err := e.clients[i].Read(ctx, in, grpc.Trailer(&trailers[i]))
+		batches[i] = resp.GetEnvelopes().GetBatch()
+		return err
+	})
+	e.noteIncompletePeers(ctx, incomplete)
+
+	var (
+		envelopes []*loggregator_v2.Envelope
+		oldest    int64
+		limited   bool
+	)
+	for i, err := range errs {
+		if status.Code(err) == codes.Unavailable {
+			e.log.Printf("failed to read from node %d: %s", i, err)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		envelopes = append(envelopes, batches[i]...)
+
+		// The cursors of the nodes' pages are meaningless for the merged
+		// response, so only the oldest timestamp is kept.
+		if t, ok := client.OldestTimestamp(trailers[i]); ok && (!limited || t < oldest) {
+			oldest = t
+			limited = true
+		}
+	}
+	if limited {
+		//nolint:errcheck
+		grpc.SetTrailer(ctx, metadata.Pairs(client.OldestTimestampTrailer, strconv.FormatInt(oldest, 10)))
+	}
+
+	// Reads for the newest envelopes are limited newest first and then
+	// returned in ascending order, like a single node does.
+	newest := readNewest(ctx)
+	descending := in.GetDescending() || newest
+	sort.SliceStable(envelopes, func(i, j int) bool {
+		if descending {
+			return envelopes[i].GetTimestamp() > envelopes[j].GetTimestamp()
+		}
+		return envelopes[i].GetTimestamp() < envelopes[j].GetTimestamp()
+	})
+
+	limit := int(in.GetLimit())
+	if limit == 0 {
+		limit = 100
+	}
+	if limitPerType(ctx) {
+		envelopes = limitEachType(envelopes, in.GetEnvelopeTypes(), limit)
+	} else if len(envelopes) > limit {
+		envelopes = envelopes[:limit]
+	}
+	if newest {
+		slices.Reverse(envelopes)
+	}
+
+	return &rpc.ReadResponse{
+		Envelopes: &loggregator_v2.EnvelopeBatch{
+			Batch: envelopes,
+		},
+	}, nil
+}
+
+// withCapturedTrailer returns a context whose server stream joins the
+// trailers set on it into trailer instead of sending them.
+func withCapturedTrailer(ctx context.Context, trailer *metadata.MD) context.Context {
+	return grpc.NewContextWithServerTransportStream(ctx, trailerCapture{
+		ServerTransportStream: grpc.ServerTransportStreamFromContext(ctx),
+		trailer:               trailer,
+	})
+}
+
+type trailerCapture struct {
+	grpc.ServerTransportStream
+	trailer *metadata.MD
+}
+
+func (s trailerCapture) SetTrailer(md metadata.MD) error {
+	*s.trailer = metadata.Join(*s.trailer, md)
+	return nil
+}
+
+// limitPerType reports whether the incoming Read asked for its limit to
+// apply to each envelope type.
+func limitPerType(ctx context.Context) bool {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return false
+	}
+
+	v := md.Get(client.LimitPerTypeMetadata)
+	if len(v) != 1 {
+		return false
+	}
+	perType, _ := strconv.ParseBool(v[0])
+	return perType
+}
+
+// readNewest reports whether the incoming Read asked for the newest
+// envelopes in ascending order.
+func readNewest(ctx context.Context) bool {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return false
+	}
+
+	v := md.Get(client.NewestMetadata)
+	if len(v) != 1 {
+		return false
+	}
+	newest, _ := strconv.ParseBool(v[0])
+	return newest
+}
+
+// limitEachType keeps at most limit envelopes of each of the requested
+// envelope types. Without requested types the limit applies to all
+// envelopes together.
+func limitEachType(envelopes []*loggregator_v2.Envelope, types []rpc.EnvelopeType, limit int) []*loggregator_v2.Envelope {
+	counts := make(map[rpc.EnvelopeType]int)
+	for _, t := range types {
+		counts[t] = 0
+	}
+	if _, hasAny := counts[rpc.EnvelopeType_ANY]; hasAny || len(counts) == 0 {
+		return envelopes[:min(len(envelopes), limit)]
+	}
+
+	limited := envelopes[:0]
+	for _, e := range envelopes {
+		t := envelopeType(e)
+		if n, ok := counts[t]; ok && n < limit {
+			counts[t]++
+			limited = append(limited, e)
+		}
+	}
+
+	return limited
+}
+
+func envelopeType(e *loggregator_v2.Envelope) rpc.EnvelopeType {
+	switch e.GetMessage().(type) {
+	case *loggregator_v2.Envelope_Log:
+		return rpc.EnvelopeType_LOG
+	case *loggregator_v2.Envelope_Counter:
+		return rpc.EnvelopeType_COUNTER
+	case *loggregator_v2.Envelope_Gauge:
+		return rpc.EnvelopeType_GAUGE
+	case *loggregator_v2.Envelope_Timer:
+		return rpc.EnvelopeType_TIMER
+	case *loggregator_v2.Envelope_Event:
+		return rpc.EnvelopeType_EVENT
+	default:
+		return rpc.EnvelopeType_ANY
+	}
+}
+
+// routableNodes drops any node index that does not have a client, which
+// happens while the routing table is still being populated.
+func (e *EgressReverseProxy) routableNodes(idx []int) []int {
+	routable := idx[:0:0]
+	for _, i := range idx {
+		if i >= 0 && i < len(e.clients) {
+			routable = append(routable, i)
+		}
+	}
+
+	return routable
+}
+
 func (e *EgressReverseProxy) remoteRead(idx []int, ctx context.Context, in *rpc.ReadRequest) (*rpc.ReadResponse, error) {
 	nBig, err := rand.Int(rand.Reader, big.NewInt(int64(len(idx))))
 	if err != nil {
 		return nil, err
 	}
-	response, err := e.clients[idx[int(nBig.Int64())]].Read(ctx, in)
+	var trailer metadata.MD
+	response, err := e.clients[idx[int(nBig.Int64())]].Read(ctx, in, grpc.Trailer(&trailer))
+	for _, key := range []string{client.OldestTimestampTrailer, client.CursorTrailer} {
+		if values := trailer.Get(key); len(values) > 0 {
+			//nolint:errcheck
+			grpc.SetTrailer(ctx, metadata.Pairs(key, values[0]))
+		}
+	}
 	if status.Code(err) == codes.Unavailable {
 		return &rpc.ReadResponse{
 			Envelopes: &loggregator_v2.EnvelopeBatch{
@@ -114,12 +412,65 @@ func (e *EgressReverseProxy) localMeta(ctx context.Context, in *rpc.MetaRequest)
 	return metaInfo, nil
 }
 
+// remoteMeta gathers meta from every node. Concurrent requests that find
+// the cache expired share a single round of requests to the nodes: the
+// first one starts it and every request waits for its result.
 func (e *EgressReverseProxy) remoteMeta(ctx context.Context, in *rpc.MetaRequest) (*rpc.MetaResponse, error) {
 	cache := (*metaCache)(atomic.LoadPointer(&e.remoteMetaCache))
 	if !cache.expired() {
 		return cache.metaResp, nil
 	}
 
+	e.metaMu.Lock()
+	// A round may have filled the cache since it was checked.
+	cache = (*metaCache)(atomic.LoadPointer(&e.remoteMetaCache))
+	if !cache.expired() {
+		e.metaMu.Unlock()
+		return cache.metaResp, nil
+	}
+	call := e.remoteMetaCall
+	if call == nil {
+		call = &metaCall{done: make(chan struct{})}
+		e.remoteMetaCall = call
+		go e.runRemoteMeta(ctx, call)
+	}
+	e.metaMu.Unlock()
+
+	select {
+	case <-call.done:
+	case <-ctx.Done():
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+
+	e.noteIncompletePeers(ctx, call.incomplete)
+	return call.resp, call.err
+}
+
+// runRemoteMeta makes a shared round of Meta requests for the request
+// with ctx and hands the result to every request waiting for it. The round
+// is not canceled with that request since the others wait for it too.
+// callPeers bounds each node by the peer operation timeout; without one the
+// round keeps the deadline of ctx.
+func (e *EgressReverseProxy) runRemoteMeta(ctx context.Context, call *metaCall) {
+	roundCtx := context.WithoutCancel(ctx)
+	if deadline, ok := ctx.Deadline(); ok && e.peerOpTimeout == 0 {
+		var cancel context.CancelFunc
+		roundCtx, cancel = context.WithDeadline(roundCtx, deadline)
+		defer cancel()
+	}
+
+	call.resp, call.incomplete, call.err = e.gatherRemoteMeta(roundCtx)
+
+	e.metaMu.Lock()
+	e.remoteMetaCall = nil
+	e.metaMu.Unlock()
+	close(call.done)
+}
+
+// gatherRemoteMeta requests the local meta of every node and merges it. The
+// indexes of the nodes that exceeded the peer operation timeout are
+// returned as incomplete.
+func (e *EgressReverseProxy) gatherRemoteMeta(ctx context.Context) (*rpc.MetaResponse, []int, error) {
 	// Each remote should only fetch their local meta data.
 	req := &rpc.MetaRequest{
 		LocalOnly: true,
@@ -129,23 +480,42 @@ func (e *EgressReverseProxy) remoteMeta(ctx context.Context, in *rpc.MetaRequest
 		Meta: make(map[string]*rpc.MetaInfo),
 	}
 
-	var errs []error
-	for _, c := range e.clients {
-		resp, err := c.Meta(ctx, req)
+	resps := make([]*rpc.MetaResponse, len(e.clients))
+	errs, incomplete := e.callPeers(ctx, func(ctx context.Context, i int) error {
+		var err error
+		resps[i], err = e.clients[i].Meta(ctx, req)
+		return err
+	})
+
+	failed := len(incomplete)
+	for i, err := range errs {
 		if err != nil {
 			// TODO: Metric
 			e.log.Printf("failed to read meta data from remote node: %s", err)
-			errs = append(errs, err)
+			failed++
+			continue
+		}
+		if resps[i] == nil {
 			continue
 		}
 
-		for sourceID, mi := range resp.Meta {
+		for sourceID, mi := range resps[i].Meta {
+			if existing, ok := result.Meta[sourceID]; ok && e.fanOut {
+				result.Meta[sourceID] = mergeMetaInfo(existing, mi)
+				continue
+			}
 			result.Meta[sourceID] = mi
 		}
 	}
 
-	if len(errs) == len(e.clients) {
-		return nil, errors.New("failed to read meta data from remote node")
+	if failed == len(e.clients) {
+		return nil, incomplete, errors.New("failed to read meta data from remote node")
+	}
+
+	// Partial results are not cached so that the next request tries the
+	// missing nodes again.
+	if len(incomplete) > 0 {
+		return result, incomplete, nil
 	}
 
 	atomic.StorePointer(&e.remoteMetaCache, unsafe.Pointer(&metaCache{
@@ -154,19 +524,139 @@ func (e *EgressReverseProxy) remoteMeta(ctx context.Context, in *rpc.MetaRequest
 		metaResp:  result,
 	}))
 
-	return result, nil
+	return result, nil, nil
+}
+
+// callPeers calls f for every client at once and waits for all of them.
+// With a peer operation timeout each call gets its own deadline. The
+// indexes of the clients that exceeded it are returned as incomplete and
+// their errors are left nil.
+func (e *EgressReverseProxy) callPeers(ctx context.Context, f func(ctx context.Context, i int) error) ([]error, []int) {
+	errs := make([]error, len(e.clients))
+	timedOut := make([]bool, len(e.clients))
+
+	var wg sync.WaitGroup
+	for i := range e.clients {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			peerCtx := ctx
+			if e.peerOpTimeout > 0 {
+				var cancel context.CancelFunc
+				peerCtx, cancel = context.WithTimeout(ctx, e.peerOpTimeout)
+				defer cancel()
+			}
+
+			err := f(peerCtx, i)
+			if err != nil && peerCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+				timedOut[i] = true
+				return
+			}
+			errs[i] = err
+		}(i)
+	}
+	wg.Wait()
+
+	var incomplete []int
+	for i, t := range timedOut {
+		if t {
+			incomplete = append(incomplete, i)
+		}
+	}
+
+	return errs, incomplete
+}
+
+// noteIncompletePeers logs the nodes that exceeded the peer operation
+// timeout and reports them in the IncompletePeersTrailer.
+func (e *EgressReverseProxy) noteIncompletePeers(ctx context.Context, incomplete []int) {
+	if len(incomplete) == 0 {
+		return
+	}
+
+	e.log.Printf("returning partial results, nodes %v did not respond within %s", incomplete, e.peerOpTimeout)
+
+	trailer := metadata.MD{}
+	for _, i := range incomplete {
+		trailer.Append(client.IncompletePeersTrailer, strconv.Itoa(i))
+	}
+	// Not every caller is a gRPC server handler, so a failure to set the
+	// trailer is not an error.
+	//nolint:errcheck
+	grpc.SetTrailer(ctx, trailer)
+}
+
+// mergeMetaInfo combines the meta data of a source ID that is spread across
+// nodes.
+func mergeMetaInfo(a, b *rpc.MetaInfo) *rpc.MetaInfo {
+	merged := &rpc.MetaInfo{
+		Count:           a.GetCount() + b.GetCount(),
+		Expired:         a.GetExpired() + b.GetExpired(),
+		OldestTimestamp: a.GetOldestTimestamp(),
+		NewestTimestamp: a.GetNewestTimestamp(),
+	}
+	if b.GetOldestTimestamp() < merged.OldestTimestamp {
+		merged.OldestTimestamp = b.GetOldestTimestamp()
+	}
+	if b.GetNewestTimestamp() > merged.NewestTimestamp {
+		merged.NewestTimestamp = b.GetNewestTimestamp()
+	}
+
+	return merged
 }
 
 type EgressReverseProxyOption func(e *EgressReverseProxy)
 
 // WithMetaCacheDuration is a EgressReverseProxyOption to configure how long
-// to cache results from the Meta endpoint.
+// to cache results from the Meta endpoint. A duration of 0 disables the
+// cache, though concurrent requests still share their requests to other
+// nodes. Defaults to 1s.
 func WithMetaCacheDuration(d time.Duration) EgressReverseProxyOption {
 	return func(e *EgressReverseProxy) {
 		e.metaCacheDuration = d
 	}
 }
 
+// WithRoutingFallback is a EgressReverseProxyOption to serve reads from the
+// local node when the routing table can not resolve a node for the source
+// ID. Each fallback read increments the given counter. By default such
+// reads fail with Unavailable.
+func WithRoutingFallback(c metrics.Counter) EgressReverseProxyOption {
+	return func(e *EgressReverseProxy) {
+		e.routingFallback = c
+	}
+}
+
+// WithEgressInstanceIDSharding is a EgressReverseProxyOption to read from
+// every node and merge the results, for clusters that route envelopes with
+// WithIngressInstanceIDSharding.
+func WithEgressInstanceIDSharding() EgressReverseProxyOption {
+	return func(e *EgressReverseProxy) {
+		e.fanOut = true
+	}
+}
+
+// WithEgressTagRouting is a EgressReverseProxyOption to read from every
+// node and merge the results, for clusters that route envelopes with
+// WithIngressTagRouting.
+func WithEgressTagRouting() EgressReverseProxyOption {
+	return func(e *EgressReverseProxy) {
+		e.fanOut = true
+	}
+}
+
+// WithPeerOpTimeout is a EgressReverseProxyOption that bounds how long a
+// Read or Meta that gathers data from several nodes waits for each node.
+// Nodes that do not respond in time are left out of the response, logged
+// and reported in the IncompletePeersTrailer. By default every node is
+// waited for.
+func WithPeerOpTimeout(d time.Duration) EgressReverseProxyOption {
+	return func(e *EgressReverseProxy) {
+		e.peerOpTimeout = d
+	}
+}
+
 type metaCache struct {
 	duration  time.Duration
 	timestamp time.Time
@@ -180,3 +670,12 @@ func (c *metaCache) expired() bool {
 
 	return time.Now().After(c.timestamp.Add(c.duration))
 }
+
+// metaCall is a remote Meta in flight. Its result is set before done is
+// closed.
+type metaCall struct {
+	done       chan struct{}
+	resp       *rpc.MetaResponse
+	incomplete []int
+	err        error
+}
@@ -5,15 +5,20 @@ import (
 	"errors"
 	"io"
 	"log"
+	"sync"
 	"time"
 
 	"google.golang.org/grpc/status"
 
+	"code.cloudfoundry.org/go-metric-registry/testhelpers"
+
 	rpc "code.cloudfoundry.org/go-log-cache/v3/rpc/logcache_v1"
 	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
 	"code.cloudfoundry.org/log-cache/internal/routing"
+	"code.cloudfoundry.org/log-cache/pkg/client"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -124,6 +129,603 @@ var _ = Describe("EgressReverseProxy", func() {
 		Expect(status.Code(err)).To(Equal(codes.Unavailable))
 	})
 
+	Context("with a routing fallback", func() {
+		var m *testhelpers.SpyMetricsRegistry
+
+		BeforeEach(func() {
+			m = testhelpers.NewMetricsRegistry()
+			p = routing.NewEgressReverseProxy(spyLookup.Lookup, []rpc.EgressClient{
+				spyEgressLocalClient,
+				spyEgressRemoteClient1,
+			}, 0, log.New(io.Discard, "", 0),
+				routing.WithRoutingFallback(m.NewCounter("log_cache_routing_fallback", "some help text")),
+			)
+
+			spyEgressLocalClient.readResp = &rpc.ReadResponse{
+				Envelopes: &loggregator_v2.EnvelopeBatch{
+					Batch: []*loggregator_v2.Envelope{
+						{SourceId: "a", Timestamp: 1},
+					},
+				},
+			}
+		})
+
+		It("reads from the local node when the routing table is empty", func() {
+			resp, err := p.Read(context.Background(), &rpc.ReadRequest{
+				SourceId: "a",
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.Envelopes.Batch).To(HaveLen(1))
+			Expect(spyEgressLocalClient.reqs).To(HaveLen(1))
+			Expect(m.GetMetricValue("log_cache_routing_fallback", nil)).To(Equal(1.0))
+		})
+
+		It("reads from the local node when the routed node is not yet known", func() {
+			spyLookup.results["a"] = []int{2}
+
+			resp, err := p.Read(context.Background(), &rpc.ReadRequest{
+				SourceId: "a",
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.Envelopes.Batch).To(HaveLen(1))
+			Expect(spyEgressRemoteClient1.reqs).To(BeEmpty())
+			Expect(m.GetMetricValue("log_cache_routing_fallback", nil)).To(Equal(1.0))
+		})
+
+		It("does not fall back for a routable request", func() {
+			spyLookup.results["a"] = []int{1}
+
+			_, err := p.Read(context.Background(), &rpc.ReadRequest{
+				SourceId: "a",
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(spyEgressRemoteClient1.reqs).To(HaveLen(1))
+			Expect(m.GetMetricValue("log_cache_routing_fallback", nil)).To(BeZero())
+		})
+	})
+
+	It("forwards tag filters to a remote node", func() {
+		spyLookup.results["a"] = []int{1}
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("log-cache-tag-filter", "job:router"))
+
+		_, err := p.Read(ctx, &rpc.ReadRequest{
+			SourceId: "a",
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(spyEgressRemoteClient1.ctxs).To(HaveLen(1))
+		md, ok := metadata.FromOutgoingContext(spyEgressRemoteClient1.ctxs[0])
+		Expect(ok).To(BeTrue())
+		Expect(md.Get("log-cache-tag-filter")).To(ConsistOf("job:router"))
+	})
+
+	It("forwards the unit filter to a remote node", func() {
+		spyLookup.results["a"] = []int{1}
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("log-cache-unit-filter", "bytes"))
+
+		_, err := p.Read(ctx, &rpc.ReadRequest{
+			SourceId: "a",
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(spyEgressRemoteClient1.ctxs).To(HaveLen(1))
+		md, ok := metadata.FromOutgoingContext(spyEgressRemoteClient1.ctxs[0])
+		Expect(ok).To(BeTrue())
+		Expect(md.Get("log-cache-unit-filter")).To(ConsistOf("bytes"))
+	})
+
+	It("forwards the limit per type to a remote node", func() {
+		spyLookup.results["a"] = []int{1}
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("log-cache-limit-per-type", "true"))
+
+		_, err := p.Read(ctx, &rpc.ReadRequest{
+			SourceId: "a",
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(spyEgressRemoteClient1.ctxs).To(HaveLen(1))
+		md, ok := metadata.FromOutgoingContext(spyEgressRemoteClient1.ctxs[0])
+		Expect(ok).To(BeTrue())
+		Expect(md.Get("log-cache-limit-per-type")).To(ConsistOf("true"))
+	})
+
+	It("forwards the minimum severity to a remote node", func() {
+		spyLookup.results["a"] = []int{1}
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("log-cache-min-severity", "error"))
+
+		_, err := p.Read(ctx, &rpc.ReadRequest{
+			SourceId: "a",
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(spyEgressRemoteClient1.ctxs).To(HaveLen(1))
+		md, ok := metadata.FromOutgoingContext(spyEgressRemoteClient1.ctxs[0])
+		Expect(ok).To(BeTrue())
+		Expect(md.Get("log-cache-min-severity")).To(ConsistOf("error"))
+	})
+
+	It("forwards the counter rate option to a remote node", func() {
+		spyLookup.results["a"] = []int{1}
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("log-cache-counter-rate", "true"))
+
+		_, err := p.Read(ctx, &rpc.ReadRequest{
+			SourceId: "a",
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(spyEgressRemoteClient1.ctxs).To(HaveLen(1))
+		md, ok := metadata.FromOutgoingContext(spyEgressRemoteClient1.ctxs[0])
+		Expect(ok).To(BeTrue())
+		Expect(md.Get("log-cache-counter-rate")).To(ConsistOf("true"))
+	})
+
+	It("forwards the newest option to a remote node", func() {
+		spyLookup.results["a"] = []int{1}
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("log-cache-newest", "true"))
+
+		_, err := p.Read(ctx, &rpc.ReadRequest{
+			SourceId: "a",
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(spyEgressRemoteClient1.ctxs).To(HaveLen(1))
+		md, ok := metadata.FromOutgoingContext(spyEgressRemoteClient1.ctxs[0])
+		Expect(ok).To(BeTrue())
+		Expect(md.Get("log-cache-newest")).To(ConsistOf("true"))
+	})
+
+	It("forwards the include spilled option to a remote node", func() {
+		spyLookup.results["a"] = []int{1}
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("log-cache-include-spilled", "true"))
+
+		_, err := p.Read(ctx, &rpc.ReadRequest{
+			SourceId: "a",
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(spyEgressRemoteClient1.ctxs).To(HaveLen(1))
+		md, ok := metadata.FromOutgoingContext(spyEgressRemoteClient1.ctxs[0])
+		Expect(ok).To(BeTrue())
+		Expect(md.Get("log-cache-include-spilled")).To(ConsistOf("true"))
+	})
+
+	It("forwards the match exact option to a remote node", func() {
+		spyLookup.results["a"] = []int{1}
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("log-cache-match-exact", "true"))
+
+		_, err := p.Read(ctx, &rpc.ReadRequest{
+			SourceId: "a",
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(spyEgressRemoteClient1.ctxs).To(HaveLen(1))
+		md, ok := metadata.FromOutgoingContext(spyEgressRemoteClient1.ctxs[0])
+		Expect(ok).To(BeTrue())
+		Expect(md.Get("log-cache-match-exact")).To(ConsistOf("true"))
+	})
+
+	It("forwards the cursor to a remote node and returns its next cursor", func() {
+		spyLookup.results["a"] = []int{1}
+		spyEgressRemoteClient1.trailer = metadata.Pairs("log-cache-cursor", "next-cursor")
+		stream := &spyServerTransportStream{}
+		ctx := grpc.NewContextWithServerTransportStream(
+			metadata.NewIncomingContext(context.Background(), metadata.Pairs("log-cache-cursor", "some-cursor")),
+			stream,
+		)
+
+		_, err := p.Read(ctx, &rpc.ReadRequest{
+			SourceId: "a",
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(spyEgressRemoteClient1.ctxs).To(HaveLen(1))
+		md, ok := metadata.FromOutgoingContext(spyEgressRemoteClient1.ctxs[0])
+		Expect(ok).To(BeTrue())
+		Expect(md.Get("log-cache-cursor")).To(ConsistOf("some-cursor"))
+
+		cursor, ok := client.NextCursor(stream.trailer)
+		Expect(ok).To(BeTrue())
+		Expect(cursor).To(Equal("next-cursor"))
+	})
+
+	Context("rebasing to a reference source ID", func() {
+		var ctx context.Context
+
+		BeforeEach(func() {
+			ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs("log-cache-rebase-to", "b"))
+			spyLookup.results["a"] = []int{1}
+			spyLookup.results["b"] = []int{2}
+
+			// Source a's clock runs 1000ns behind source b's.
+			spyEgressRemoteClient1.metaResults = map[string]*rpc.MetaInfo{
+				"a": {NewestTimestamp: 2000},
+			}
+			spyEgressRemoteClient2.metaResults = map[string]*rpc.MetaInfo{
+				"b": {NewestTimestamp: 3000},
+			}
+		})
+
+		It("aligns the timestamps of two sources with offset clocks", func() {
+			spyEgressRemoteClient1.readResp = &rpc.ReadResponse{
+				Envelopes: &loggregator_v2.EnvelopeBatch{
+					Batch: []*loggregator_v2.Envelope{
+						{SourceId: "a", Timestamp: 1500},
+						{SourceId: "a", Timestamp: 2000},
+					},
+				},
+			}
+
+			resp, err := p.Read(ctx, &rpc.ReadRequest{SourceId: "a"})
+			Expect(err).ToNot(HaveOccurred())
+
+			var timestamps []int64
+			for _, e := range resp.GetEnvelopes().GetBatch() {
+				timestamps = append(timestamps, e.GetTimestamp())
+			}
+			Expect(timestamps).To(Equal([]int64{2500, 3000}))
+
+			// The envelopes read are not modified.
+			Expect(spyEgressRemoteClient1.readResp.Envelopes.Batch[1].GetTimestamp()).To(Equal(int64(2000)))
+		})
+
+		It("does not forward the reference source ID to a remote node", func() {
+			_, err := p.Read(ctx, &rpc.ReadRequest{SourceId: "a"})
+			Expect(err).ToNot(HaveOccurred())
+
+			md, _ := metadata.FromOutgoingContext(spyEgressRemoteClient1.ctxs[0])
+			Expect(md.Get("log-cache-rebase-to")).To(BeEmpty())
+		})
+
+		It("returns NotFound for an unknown reference source ID", func() {
+			spyEgressRemoteClient1.readResp = &rpc.ReadResponse{
+				Envelopes: &loggregator_v2.EnvelopeBatch{
+					Batch: []*loggregator_v2.Envelope{{SourceId: "a", Timestamp: 1500}},
+				},
+			}
+			ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs("log-cache-rebase-to", "c"))
+
+			_, err := p.Read(ctx, &rpc.ReadRequest{SourceId: "a"})
+			Expect(status.Code(err)).To(Equal(codes.NotFound))
+		})
+
+		It("rejects more than one reference source ID", func() {
+			ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs("log-cache-rebase-to", "b", "log-cache-rebase-to", "c"))
+
+			_, err := p.Read(ctx, &rpc.ReadRequest{SourceId: "a"})
+			Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+			Expect(spyEgressRemoteClient1.reqs).To(BeEmpty())
+		})
+	})
+
+	Context("with a peer operation timeout", func() {
+		var (
+			stream *spyServerTransportStream
+			ctx    context.Context
+		)
+
+		BeforeEach(func() {
+			stream = &spyServerTransportStream{}
+			ctx = grpc.NewContextWithServerTransportStream(context.Background(), stream)
+
+			p = routing.NewEgressReverseProxy(spyLookup.Lookup, []rpc.EgressClient{
+				spyEgressLocalClient,
+				spyEgressRemoteClient1,
+				spyEgressRemoteClient2,
+			}, 0, log.New(io.Discard, "", 0),
+				routing.WithEgressInstanceIDSharding(),
+				routing.WithPeerOpTimeout(100*time.Millisecond),
+			)
+
+			spyEgressRemoteClient2.delay = 10 * time.Second
+		})
+
+		It("returns the reads of the other nodes when a node is slow", func() {
+			spyEgressLocalClient.readResp = &rpc.ReadResponse{
+				Envelopes: &loggregator_v2.EnvelopeBatch{
+					Batch: []*loggregator_v2.Envelope{{SourceId: "a", Timestamp: 1}},
+				},
+			}
+			spyEgressRemoteClient1.readResp = &rpc.ReadResponse{
+				Envelopes: &loggregator_v2.EnvelopeBatch{
+					Batch: []*loggregator_v2.Envelope{{SourceId: "a", Timestamp: 2}},
+				},
+			}
+
+			start := time.Now()
+			resp, err := p.Read(ctx, &rpc.ReadRequest{
+				SourceId: "a",
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+
+			Expect(resp.Envelopes.Batch).To(HaveLen(2))
+			Expect(client.IncompletePeers(stream.trailer)).To(Equal([]int{2}))
+		})
+
+		It("returns the meta of the other nodes when a node is slow", func() {
+			spyEgressLocalClient.metaResults = map[string]*rpc.MetaInfo{
+				"a": {Count: 1},
+			}
+			spyEgressRemoteClient1.metaResults = map[string]*rpc.MetaInfo{
+				"b": {Count: 2},
+			}
+			spyEgressRemoteClient2.metaResults = map[string]*rpc.MetaInfo{
+				"c": {Count: 3},
+			}
+
+			start := time.Now()
+			resp, err := p.Meta(ctx, &rpc.MetaRequest{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+
+			Expect(resp.Meta).To(HaveKey("a"))
+			Expect(resp.Meta).To(HaveKey("b"))
+			Expect(resp.Meta).ToNot(HaveKey("c"))
+			Expect(client.IncompletePeers(stream.trailer)).To(Equal([]int{2}))
+		})
+
+		It("does not report incomplete nodes when every node responds", func() {
+			spyEgressRemoteClient2.delay = 0
+
+			_, err := p.Meta(ctx, &rpc.MetaRequest{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(client.IncompletePeers(stream.trailer)).To(BeEmpty())
+		})
+	})
+
+	It("reads from every node with tag routing", func() {
+		p = routing.NewEgressReverseProxy(spyLookup.Lookup, []rpc.EgressClient{
+			spyEgressLocalClient,
+			spyEgressRemoteClient1,
+			spyEgressRemoteClient2,
+		}, 0, log.New(io.Discard, "", 0),
+			routing.WithEgressTagRouting(),
+		)
+		spyLookup.results["a"] = []int{1}
+		spyEgressLocalClient.readResp = &rpc.ReadResponse{
+			Envelopes: &loggregator_v2.EnvelopeBatch{
+				Batch: []*loggregator_v2.Envelope{
+					{SourceId: "a", Timestamp: 1, Tags: map[string]string{"tenant": "t1"}},
+				},
+			},
+		}
+		spyEgressRemoteClient1.readResp = &rpc.ReadResponse{
+			Envelopes: &loggregator_v2.EnvelopeBatch{
+				Batch: []*loggregator_v2.Envelope{
+					{SourceId: "a", Timestamp: 2},
+				},
+			},
+		}
+		spyEgressRemoteClient2.readResp = &rpc.ReadResponse{Envelopes: &loggregator_v2.EnvelopeBatch{}}
+
+		resp, err := p.Read(context.Background(), &rpc.ReadRequest{
+			SourceId: "a",
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		var timestamps []int64
+		for _, e := range resp.Envelopes.Batch {
+			timestamps = append(timestamps, e.Timestamp)
+		}
+		Expect(timestamps).To(Equal([]int64{1, 2}))
+		Expect(spyEgressRemoteClient2.reqs).To(HaveLen(1))
+	})
+
+	Context("with instance ID sharding", func() {
+		BeforeEach(func() {
+			p = routing.NewEgressReverseProxy(spyLookup.Lookup, []rpc.EgressClient{
+				spyEgressLocalClient,
+				spyEgressRemoteClient1,
+				spyEgressRemoteClient2,
+			}, 0, log.New(io.Discard, "", 0),
+				routing.WithMetaCacheDuration(50*time.Millisecond),
+				routing.WithEgressInstanceIDSharding(),
+			)
+
+			spyEgressLocalClient.readResp = &rpc.ReadResponse{
+				Envelopes: &loggregator_v2.EnvelopeBatch{
+					Batch: []*loggregator_v2.Envelope{
+						{SourceId: "a", InstanceId: "0", Timestamp: 1},
+						{SourceId: "a", InstanceId: "0", Timestamp: 4},
+					},
+				},
+			}
+			spyEgressRemoteClient1.readResp = &rpc.ReadResponse{
+				Envelopes: &loggregator_v2.EnvelopeBatch{
+					Batch: []*loggregator_v2.Envelope{
+						{SourceId: "a", InstanceId: "1", Timestamp: 2},
+					},
+				},
+			}
+			spyEgressRemoteClient2.readResp = &rpc.ReadResponse{
+				Envelopes: &loggregator_v2.EnvelopeBatch{
+					Batch: []*loggregator_v2.Envelope{
+						{SourceId: "a", InstanceId: "2", Timestamp: 3},
+					},
+				},
+			}
+		})
+
+		It("reads from every node and merges the results", func() {
+			resp, err := p.Read(context.Background(), &rpc.ReadRequest{
+				SourceId: "a",
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			var timestamps []int64
+			for _, e := range resp.Envelopes.Batch {
+				timestamps = append(timestamps, e.Timestamp)
+			}
+			Expect(timestamps).To(Equal([]int64{1, 2, 3, 4}))
+
+			Expect(spyEgressRemoteClient1.reqs).To(HaveLen(1))
+			md, ok := metadata.FromOutgoingContext(spyEgressRemoteClient1.ctxs[0])
+			Expect(ok).To(BeTrue())
+			Expect(md.Get("log-cache-local-only")).To(ConsistOf("true"))
+		})
+
+		It("honors the order and limit of the request", func() {
+			resp, err := p.Read(context.Background(), &rpc.ReadRequest{
+				SourceId:   "a",
+				Descending: true,
+				Limit:      2,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			var timestamps []int64
+			for _, e := range resp.Envelopes.Batch {
+				timestamps = append(timestamps, e.Timestamp)
+			}
+			Expect(timestamps).To(Equal([]int64{4, 3}))
+		})
+
+		It("returns the newest envelopes in ascending order when asked to", func() {
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("log-cache-newest", "true"))
+			resp, err := p.Read(ctx, &rpc.ReadRequest{
+				SourceId: "a",
+				Limit:    2,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			var timestamps []int64
+			for _, e := range resp.Envelopes.Batch {
+				timestamps = append(timestamps, e.Timestamp)
+			}
+			Expect(timestamps).To(Equal([]int64{3, 4}))
+		})
+
+		It("applies the limit to each envelope type when asked to", func() {
+			spyEgressLocalClient.readResp = &rpc.ReadResponse{
+				Envelopes: &loggregator_v2.EnvelopeBatch{
+					Batch: []*loggregator_v2.Envelope{
+						{SourceId: "a", Timestamp: 1, Message: &loggregator_v2.Envelope_Log{Log: &loggregator_v2.Log{}}},
+						{SourceId: "a", Timestamp: 3, Message: &loggregator_v2.Envelope_Log{Log: &loggregator_v2.Log{}}},
+					},
+				},
+			}
+			spyEgressRemoteClient1.readResp = &rpc.ReadResponse{
+				Envelopes: &loggregator_v2.EnvelopeBatch{
+					Batch: []*loggregator_v2.Envelope{
+						{SourceId: "a", Timestamp: 2, Message: &loggregator_v2.Envelope_Log{Log: &loggregator_v2.Log{}}},
+						{SourceId: "a", Timestamp: 5, Message: &loggregator_v2.Envelope_Counter{Counter: &loggregator_v2.Counter{}}},
+					},
+				},
+			}
+			spyEgressRemoteClient2.readResp = &rpc.ReadResponse{
+				Envelopes: &loggregator_v2.EnvelopeBatch{
+					Batch: []*loggregator_v2.Envelope{
+						{SourceId: "a", Timestamp: 4, Message: &loggregator_v2.Envelope_Counter{Counter: &loggregator_v2.Counter{}}},
+						{SourceId: "a", Timestamp: 6, Message: &loggregator_v2.Envelope_Counter{Counter: &loggregator_v2.Counter{}}},
+					},
+				},
+			}
+
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("log-cache-limit-per-type", "true"))
+			resp, err := p.Read(ctx, &rpc.ReadRequest{
+				SourceId:      "a",
+				EnvelopeTypes: []rpc.EnvelopeType{rpc.EnvelopeType_LOG, rpc.EnvelopeType_COUNTER},
+				Limit:         2,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			var timestamps []int64
+			for _, e := range resp.Envelopes.Batch {
+				timestamps = append(timestamps, e.Timestamp)
+			}
+			Expect(timestamps).To(Equal([]int64{1, 2, 4, 5}))
+		})
+
+		It("rejects a cursor", func() {
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("log-cache-cursor", "some-cursor"))
+			_, err := p.Read(ctx, &rpc.ReadRequest{
+				SourceId: "a",
+			})
+			Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+		})
+
+		It("does not return the cursor of the local node", func() {
+			spyEgressLocalClient.trailer = metadata.Pairs("log-cache-cursor", "local-cursor")
+			stream := &spyServerTransportStream{}
+			ctx := grpc.NewContextWithServerTransportStream(context.Background(), stream)
+
+			_, err := p.Read(ctx, &rpc.ReadRequest{
+				SourceId: "a",
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			_, ok := client.NextCursor(stream.trailer)
+			Expect(ok).To(BeFalse())
+		})
+
+		It("returns the oldest timestamp of every node", func() {
+			spyEgressLocalClient.trailer = metadata.Pairs("log-cache-oldest-timestamp", "5")
+			spyEgressRemoteClient1.trailer = metadata.Pairs("log-cache-oldest-timestamp", "3")
+			stream := &spyServerTransportStream{}
+			ctx := grpc.NewContextWithServerTransportStream(context.Background(), stream)
+
+			_, err := p.Read(ctx, &rpc.ReadRequest{
+				SourceId: "a",
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			oldest, ok := client.OldestTimestamp(stream.trailer)
+			Expect(ok).To(BeTrue())
+			Expect(oldest).To(Equal(int64(3)))
+		})
+
+		It("only reads from the local node for a fanned out request", func() {
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("log-cache-local-only", "true"))
+			resp, err := p.Read(ctx, &rpc.ReadRequest{
+				SourceId: "a",
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.Envelopes.Batch).To(HaveLen(2))
+			Expect(spyEgressRemoteClient1.reqs).To(BeEmpty())
+			Expect(spyEgressRemoteClient2.reqs).To(BeEmpty())
+		})
+
+		DescribeTable("reads from every node when the local only value is not true", func(value string) {
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("log-cache-local-only", value))
+			resp, err := p.Read(ctx, &rpc.ReadRequest{
+				SourceId: "a",
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.Envelopes.Batch).To(HaveLen(4))
+		},
+			Entry("false", "false"),
+			Entry("not a bool", "x"),
+		)
+
+		It("skips unavailable nodes", func() {
+			spyEgressRemoteClient2.err = status.Error(codes.Unavailable, "unavailable")
+
+			resp, err := p.Read(context.Background(), &rpc.ReadRequest{
+				SourceId: "a",
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.Envelopes.Batch).To(HaveLen(3))
+		})
+
+		It("sums the meta of a source ID across nodes", func() {
+			spyEgressLocalClient.metaResults = map[string]*rpc.MetaInfo{
+				"a": {Count: 2, Expired: 1, OldestTimestamp: 1, NewestTimestamp: 4},
+			}
+			spyEgressRemoteClient1.metaResults = map[string]*rpc.MetaInfo{
+				"a": {Count: 1, OldestTimestamp: 2, NewestTimestamp: 2},
+			}
+			spyEgressRemoteClient2.metaResults = map[string]*rpc.MetaInfo{
+				"a": {Count: 1, Expired: 3, OldestTimestamp: 0, NewestTimestamp: 3},
+			}
+
+			resp, err := p.Meta(context.Background(), &rpc.MetaRequest{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.Meta["a"].Count).To(Equal(int64(4)))
+			Expect(resp.Meta["a"].Expired).To(Equal(int64(4)))
+			Expect(resp.Meta["a"].OldestTimestamp).To(Equal(int64(0)))
+			Expect(resp.Meta["a"].NewestTimestamp).To(Equal(int64(4)))
+		})
+	})
+
 	It("uses the given context", func() {
 		spyLookup.results["a"] = []int{0}
 
@@ -297,6 +899,89 @@ var _ = Describe("EgressReverseProxy", func() {
 		}, 2).Should(BeNumerically(">", 1))
 	})
 
+	It("shares one round of requests to the nodes between concurrent meta requests", func() {
+		spyEgressLocalClient.metaResults = map[string]*rpc.MetaInfo{"source-1": {Count: 1}}
+		spyEgressRemoteClient1.metaResults = map[string]*rpc.MetaInfo{"source-2": {Count: 2}}
+		for _, c := range []*spyEgressClient{spyEgressLocalClient, spyEgressRemoteClient1, spyEgressRemoteClient2} {
+			c.delay = 100 * time.Millisecond
+		}
+
+		resps := make([]*rpc.MetaResponse, 10)
+		errs := make([]error, 10)
+		var wg sync.WaitGroup
+		for i := range resps {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				resps[i], errs[i] = p.Meta(context.Background(), &rpc.MetaRequest{})
+			}(i)
+		}
+		wg.Wait()
+
+		for i := range resps {
+			Expect(errs[i]).ToNot(HaveOccurred())
+			Expect(resps[i].Meta).To(HaveLen(2))
+		}
+		Expect(spyEgressLocalClient.metaCalls).To(Equal(1))
+		Expect(spyEgressRemoteClient1.metaCalls).To(Equal(1))
+		Expect(spyEgressRemoteClient2.metaCalls).To(Equal(1))
+	})
+
+	It("finishes a shared meta request when the request that started it is canceled", func() {
+		spyEgressLocalClient.metaResults = map[string]*rpc.MetaInfo{"source-1": {Count: 1}}
+		spyEgressRemoteClient1.metaResults = map[string]*rpc.MetaInfo{"source-2": {Count: 2}}
+		for _, c := range []*spyEgressClient{spyEgressLocalClient, spyEgressRemoteClient1, spyEgressRemoteClient2} {
+			c.delay = 100 * time.Millisecond
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		firstErr := make(chan error, 1)
+		go func() {
+			_, err := p.Meta(ctx, &rpc.MetaRequest{})
+			firstErr <- err
+		}()
+		// Let the first request start the round of requests to the nodes.
+		time.Sleep(20 * time.Millisecond)
+
+		resps := make([]*rpc.MetaResponse, 10)
+		errs := make([]error, 10)
+		var wg sync.WaitGroup
+		for i := range resps {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				resps[i], errs[i] = p.Meta(context.Background(), &rpc.MetaRequest{})
+			}(i)
+		}
+		cancel()
+		wg.Wait()
+
+		Expect(status.Code(<-firstErr)).To(Equal(codes.Canceled))
+		for i := range resps {
+			Expect(errs[i]).ToNot(HaveOccurred())
+			Expect(resps[i].Meta).To(HaveLen(2))
+		}
+		Expect(spyEgressLocalClient.metaCalls).To(Equal(1))
+		Expect(spyEgressRemoteClient1.metaCalls).To(Equal(1))
+		Expect(spyEgressRemoteClient2.metaCalls).To(Equal(1))
+	})
+
+	It("stops waiting for a shared meta request when the context is done", func() {
+		spyEgressRemoteClient1.delay = time.Second
+
+		go func() {
+			//nolint:errcheck
+			p.Meta(context.Background(), &rpc.MetaRequest{})
+		}()
+		// Let the first request start the round of requests to the nodes.
+		time.Sleep(20 * time.Millisecond)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		_, err := p.Meta(ctx, &rpc.MetaRequest{})
+		Expect(status.Code(err)).To(Equal(codes.DeadlineExceeded))
+	})
+
 	It("uses the given context for meta", func() {
 		ctx, cancel := context.WithCancel(context.Background())
 		cancel()
@@ -331,10 +1016,19 @@ type spyEgressClient struct {
 	reqs     []*rpc.ReadRequest
 	err      error
 
+	// trailer is returned to a caller that captures it with grpc.Trailer,
+	// like a remote node, or else set on the server stream of the
+	// context, like the local store.
+	trailer metadata.MD
+
 	metaCalls    int
 	metaRequests []*rpc.MetaRequest
 	metaResults  map[string]*rpc.MetaInfo
 	metaErr      error
+
+	// delay makes every call wait, like a slow peer, unless the context
+	// is done first.
+	delay time.Duration
 }
 
 func newSpyEgressClient() *spyEgressClient {
@@ -346,13 +1040,47 @@ func newSpyEgressClient() *spyEgressClient {
 func (s *spyEgressClient) Read(ctx context.Context, in *rpc.ReadRequest, opts ...grpc.CallOption) (*rpc.ReadResponse, error) {
 	s.ctxs = append(s.ctxs, ctx)
 	s.reqs = append(s.reqs, in)
+	if err := s.wait(ctx); err != nil {
+		return nil, err
+	}
+	if s.trailer != nil {
+		s.setTrailer(ctx, opts)
+	}
 	return s.readResp, s.err
 }
 
+func (s *spyEgressClient) setTrailer(ctx context.Context, opts []grpc.CallOption) {
+	for _, o := range opts {
+		if t, ok := o.(grpc.TrailerCallOption); ok {
+			*t.TrailerAddr = s.trailer
+			return
+		}
+	}
+
+	//nolint:errcheck
+	grpc.SetTrailer(ctx, s.trailer)
+}
+
+func (s *spyEgressClient) wait(ctx context.Context) error {
+	if s.delay == 0 {
+		return nil
+	}
+
+	select {
+	case <-time.After(s.delay):
+		return nil
+	case <-ctx.Done():
+		return status.FromContextError(ctx.Err()).Err()
+	}
+}
+
 func (s *spyEgressClient) Meta(ctx context.Context, r *rpc.MetaRequest, opts ...grpc.CallOption) (*rpc.MetaResponse, error) {
 	s.metaCalls += 1
 	s.ctxs = append(s.ctxs, ctx)
 	s.metaRequests = append(s.metaRequests, r)
+	if err := s.wait(ctx); err != nil {
+		return nil, err
+	}
 	metaInfo := make(map[string]*rpc.MetaInfo)
 	for id, m := range s.metaResults {
 		metaInfo[id] = m
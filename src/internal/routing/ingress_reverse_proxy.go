@@ -7,6 +7,9 @@ import (
 	rpc "code.cloudfoundry.org/go-log-cache/v3/rpc/logcache_v1"
 	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"code.cloudfoundry.org/log-cache/pkg/client"
 )
 
 // IngressReverseProxy is a reverse proxy for Ingress requests.
@@ -16,6 +19,10 @@ type IngressReverseProxy struct {
 	l        Lookup
 	log      *log.Logger
 
+	instanceIDSharding bool
+	routingTag         string
+	underPressure      func() bool
+
 	rpc.UnimplementedIngressServer
 }
 
@@ -28,19 +35,80 @@ func NewIngressReverseProxy(
 	clients []rpc.IngressClient,
 	localIdx int,
 	log *log.Logger,
+	opts ...IngressReverseProxyOption,
 ) *IngressReverseProxy {
-
-	return &IngressReverseProxy{
+	p := &IngressReverseProxy{
 		clients:  clients,
 		localIdx: localIdx,
 		l:        l,
 		log:      log,
 	}
+
+	for _, o := range opts {
+		o(p)
+	}
+
+	return p
+}
+
+// IngressReverseProxyOption configures an IngressReverseProxy.
+type IngressReverseProxyOption func(p *IngressReverseProxy)
+
+// WithIngressInstanceIDSharding is an IngressReverseProxyOption to route
+// envelopes by their source ID and instance ID, so that the instances of a
+// single source are spread across nodes. Reads for a source then have to
+// fan out to every node (see WithEgressInstanceIDSharding).
+func WithIngressInstanceIDSharding() IngressReverseProxyOption {
+	return func(p *IngressReverseProxy) {
+		p.instanceIDSharding = true
+	}
+}
+
+// WithIngressTagRouting is an IngressReverseProxyOption to route envelopes
+// that have the given tag by its value instead of by their source ID, e.g.
+// so that all sources of a tenant are stored on the same node. Envelopes
+// without the tag are routed as before. Reads for a source then have to
+// fan out to every node (see WithEgressTagRouting).
+func WithIngressTagRouting(tag string) IngressReverseProxyOption {
+	return func(p *IngressReverseProxy) {
+		p.routingTag = tag
+	}
+}
+
+// WithIngressBackpressure is an IngressReverseProxyOption to set the
+// client.BackpressureHeader on Send responses while underPressure returns
+// true. It reflects the store of the node that received the Send, not of
+// the nodes the envelopes were routed to.
+func WithIngressBackpressure(underPressure func() bool) IngressReverseProxyOption {
+	return func(p *IngressReverseProxy) {
+		p.underPressure = underPressure
+	}
+}
+
+// TagShardKey returns the key an envelope is routed by when routing by the
+// given tag and value.
+func TagShardKey(tag, value string) string {
+	return tag + "=" + value
+}
+
+// InstanceShardKey returns the key an envelope is routed by when sharding
+// by instance ID.
+func InstanceShardKey(sourceID, instanceID string) string {
+	if instanceID == "" {
+		return sourceID
+	}
+
+	return sourceID + "/" + instanceID
 }
 
 // Send will send to either the local node or the correct remote node
 // according to its source ID.
 func (p *IngressReverseProxy) Send(ctx context.Context, r *rpc.SendRequest) (*rpc.SendResponse, error) {
+	if p.underPressure != nil && p.underPressure() {
+		//nolint:errcheck
+		grpc.SetHeader(ctx, metadata.Pairs(client.BackpressureHeader, "true"))
+	}
+
 	if r.LocalOnly {
 		return p.clients[p.localIdx].Send(ctx, r)
 	}
@@ -48,7 +116,7 @@ func (p *IngressReverseProxy) Send(ctx context.Context, r *rpc.SendRequest) (*rp
 	envelopesByNode := make(map[int][]*loggregator_v2.Envelope)
 
 	for _, e := range r.Envelopes.Batch {
-		for _, idx := range p.l(e.GetSourceId()) {
+		for _, idx := range p.l(p.shardKey(e)) {
 			envelopesByNode[idx] = append(envelopesByNode[idx], e)
 		}
 	}
@@ -70,6 +138,21 @@ func (p *IngressReverseProxy) Send(ctx context.Context, r *rpc.SendRequest) (*rp
 	return &rpc.SendResponse{}, nil
 }
 
+// shardKey returns the key e is routed by. The routing tag takes
+// precedence over instance ID sharding.
+func (p *IngressReverseProxy) shardKey(e *loggregator_v2.Envelope) string {
+	if p.routingTag != "" {
+		if value, ok := e.GetTags()[p.routingTag]; ok && value != "" {
+			return TagShardKey(p.routingTag, value)
+		}
+	}
+	if p.instanceIDSharding {
+		return InstanceShardKey(e.GetSourceId(), e.GetInstanceId())
+	}
+
+	return e.GetSourceId()
+}
+
 // IngressClientFunc transforms a function into an IngressClient.
 type IngressClientFunc func(ctx context.Context, r *rpc.SendRequest, opts ...grpc.CallOption) (*rpc.SendResponse, error)
 
@@ -10,6 +10,7 @@ import (
 	rpc "code.cloudfoundry.org/go-log-cache/v3/rpc/logcache_v1"
 	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
 	"code.cloudfoundry.org/log-cache/internal/routing"
+	"code.cloudfoundry.org/log-cache/pkg/client"
 	"google.golang.org/grpc"
 
 	. "github.com/onsi/ginkgo/v2"
@@ -104,6 +105,112 @@ var _ = Describe("IngressReverseProxy", func() {
 		Expect(spyIngressRemoteClient.reqs).To(BeEmpty())
 	})
 
+	It("routes by source and instance ID with instance ID sharding", func() {
+		p = routing.NewIngressReverseProxy(spyLookup.Lookup, []rpc.IngressClient{
+			spyIngressRemoteClient,
+			spyIngressLocalClient,
+		}, 1, log.New(io.Discard, "", 0),
+			routing.WithIngressInstanceIDSharding(),
+		)
+		spyLookup.results["a/0"] = []int{0}
+		spyLookup.results["a/1"] = []int{1}
+		spyLookup.results["b"] = []int{1}
+
+		_, err := p.Send(context.Background(), &rpc.SendRequest{
+			Envelopes: &loggregator_v2.EnvelopeBatch{
+				Batch: []*loggregator_v2.Envelope{
+					{SourceId: "a", InstanceId: "0", Timestamp: 1},
+					{SourceId: "a", InstanceId: "1", Timestamp: 2},
+					{SourceId: "b", Timestamp: 3},
+				},
+			},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(spyLookup.sourceIDs).To(ConsistOf("a/0", "a/1", "b"))
+		Expect(spyIngressRemoteClient.reqs).To(ConsistOf(
+			&rpc.SendRequest{
+				LocalOnly: true,
+				Envelopes: &loggregator_v2.EnvelopeBatch{
+					Batch: []*loggregator_v2.Envelope{
+						{SourceId: "a", InstanceId: "0", Timestamp: 1},
+					},
+				},
+			},
+		))
+		Expect(spyIngressLocalClient.reqs).To(ConsistOf(
+			&rpc.SendRequest{
+				LocalOnly: true,
+				Envelopes: &loggregator_v2.EnvelopeBatch{
+					Batch: []*loggregator_v2.Envelope{
+						{SourceId: "a", InstanceId: "1", Timestamp: 2},
+						{SourceId: "b", Timestamp: 3},
+					},
+				},
+			},
+		))
+	})
+
+	Context("with tag routing", func() {
+		BeforeEach(func() {
+			p = routing.NewIngressReverseProxy(spyLookup.Lookup, []rpc.IngressClient{
+				spyIngressRemoteClient,
+				spyIngressLocalClient,
+			}, 1, log.New(io.Discard, "", 0),
+				routing.WithIngressTagRouting("tenant"),
+			)
+		})
+
+		It("routes sources sharing a tag value to the same node", func() {
+			spyLookup.results["a"] = []int{0}
+			spyLookup.results["b"] = []int{1}
+			spyLookup.results["tenant=t1"] = []int{1}
+
+			_, err := p.Send(context.Background(), &rpc.SendRequest{
+				Envelopes: &loggregator_v2.EnvelopeBatch{
+					Batch: []*loggregator_v2.Envelope{
+						{SourceId: "a", Timestamp: 1, Tags: map[string]string{"tenant": "t1"}},
+						{SourceId: "b", Timestamp: 2, Tags: map[string]string{"tenant": "t1"}},
+					},
+				},
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(spyLookup.sourceIDs).To(ConsistOf("tenant=t1", "tenant=t1"))
+			Expect(spyIngressRemoteClient.reqs).To(BeEmpty())
+			Expect(spyIngressLocalClient.reqs).To(ConsistOf(
+				&rpc.SendRequest{
+					LocalOnly: true,
+					Envelopes: &loggregator_v2.EnvelopeBatch{
+						Batch: []*loggregator_v2.Envelope{
+							{SourceId: "a", Timestamp: 1, Tags: map[string]string{"tenant": "t1"}},
+							{SourceId: "b", Timestamp: 2, Tags: map[string]string{"tenant": "t1"}},
+						},
+					},
+				},
+			))
+		})
+
+		It("routes envelopes without the tag by source ID", func() {
+			spyLookup.results["a"] = []int{0}
+			spyLookup.results["b"] = []int{1}
+
+			_, err := p.Send(context.Background(), &rpc.SendRequest{
+				Envelopes: &loggregator_v2.EnvelopeBatch{
+					Batch: []*loggregator_v2.Envelope{
+						{SourceId: "a", Timestamp: 1},
+						{SourceId: "b", Timestamp: 2, Tags: map[string]string{"other": "t1"}},
+					},
+				},
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(spyLookup.sourceIDs).To(ConsistOf("a", "b"))
+			Expect(spyIngressRemoteClient.reqs).To(HaveLen(1))
+			Expect(spyIngressLocalClient.reqs).To(HaveLen(1))
+		})
+	})
+
 	It("survives an unroutable request", func() {
 		spyLookup.results["b"] = []int{1}
 
@@ -164,6 +271,67 @@ var _ = Describe("IngressReverseProxy", func() {
 		})
 		Expect(err).ToNot(HaveOccurred())
 	})
+
+	Context("with backpressure", func() {
+		var (
+			underPressure bool
+			stream        *spyServerTransportStream
+			ctx           context.Context
+		)
+
+		BeforeEach(func() {
+			underPressure = false
+			p = routing.NewIngressReverseProxy(spyLookup.Lookup, []rpc.IngressClient{
+				spyIngressRemoteClient,
+				spyIngressLocalClient,
+			}, 1, log.New(io.Discard, "", 0),
+				routing.WithIngressBackpressure(func() bool { return underPressure }),
+			)
+			spyLookup.results["a"] = []int{1}
+
+			stream = &spyServerTransportStream{}
+			ctx = grpc.NewContextWithServerTransportStream(context.Background(), stream)
+		})
+
+		It("sets the backpressure header while under pressure", func() {
+			underPressure = true
+
+			_, err := p.Send(ctx, &rpc.SendRequest{
+				Envelopes: &loggregator_v2.EnvelopeBatch{
+					Batch: []*loggregator_v2.Envelope{{SourceId: "a", Timestamp: 1}},
+				},
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(client.Backpressure(stream.header)).To(BeTrue())
+			Expect(spyIngressLocalClient.reqs).To(HaveLen(1))
+		})
+
+		It("sets the backpressure header on local only requests", func() {
+			underPressure = true
+
+			_, err := p.Send(ctx, &rpc.SendRequest{
+				LocalOnly: true,
+				Envelopes: &loggregator_v2.EnvelopeBatch{
+					Batch: []*loggregator_v2.Envelope{{SourceId: "a", Timestamp: 1}},
+				},
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(client.Backpressure(stream.header)).To(BeTrue())
+		})
+
+		It("does not set the backpressure header without pressure", func() {
+			_, err := p.Send(ctx, &rpc.SendRequest{
+				Envelopes: &loggregator_v2.EnvelopeBatch{
+					Batch: []*loggregator_v2.Envelope{{SourceId: "a", Timestamp: 1}},
+				},
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(client.Backpressure(stream.header)).To(BeFalse())
+		})
+	})
 })
 
 type spyLookup struct {
@@ -187,6 +355,9 @@ type spyIngressClient struct {
 	ctxs []context.Context
 	reqs []*rpc.SendRequest
 	err  error
+
+	// failures is the number of Sends that fail before they succeed.
+	failures int
 }
 
 func newSpyIngressClient() *spyIngressClient {
@@ -199,6 +370,11 @@ func (s *spyIngressClient) Send(ctx context.Context, in *rpc.SendRequest, opts .
 
 	s.ctxs = append(s.ctxs, ctx)
 	s.reqs = append(s.reqs, in)
+	if s.failures > 0 {
+		s.failures--
+		return nil, errors.New("some-error")
+	}
+
 	return &rpc.SendResponse{}, s.err
 }
 
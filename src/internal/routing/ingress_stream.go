@@ -0,0 +1,62 @@
+package routing
+
+import (
+	"io"
+
+	rpc "code.cloudfoundry.org/go-log-cache/v3/rpc/logcache_v1"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"code.cloudfoundry.org/log-cache/pkg/client"
+)
+
+// RegisterIngressServer registers the ingress service on the given gRPC
+// server. Alongside Send, it serves SendStream, which writes every batch
+// received on the stream through srv.Send.
+func RegisterIngressServer(s *grpc.Server, srv rpc.IngressServer) {
+	s.RegisterService(&ingressServiceDesc, srv)
+}
+
+var ingressServiceDesc = grpc.ServiceDesc{
+	ServiceName: rpc.Ingress_ServiceDesc.ServiceName,
+	HandlerType: (*rpc.IngressServer)(nil),
+	Methods:     rpc.Ingress_ServiceDesc.Methods,
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    client.SendStreamDesc.StreamName,
+			Handler:       sendStreamHandler,
+			ClientStreams: true,
+			ServerStreams: true,
+		},
+	},
+	Metadata: rpc.Ingress_ServiceDesc.Metadata,
+}
+
+// sendStreamHandler writes each batch as it arrives and acknowledges it
+// with the number of batches written so far. The first failed write ends
+// the stream with that error; the client is expected to resend anything
+// that was not acknowledged.
+func sendStreamHandler(srv interface{}, stream grpc.ServerStream) error {
+	ingress := srv.(rpc.IngressServer)
+
+	var written int64
+	for {
+		req := &rpc.SendRequest{}
+		err := stream.RecvMsg(req)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if _, err := ingress.Send(stream.Context(), req); err != nil {
+			return err
+		}
+		written++
+
+		if err := stream.SendMsg(wrapperspb.Int64(written)); err != nil {
+			return err
+		}
+	}
+}
@@ -1,45 +1,73 @@
 package routing
 
 import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"regexp"
+	"slices"
+	"strconv"
 	"time"
 
 	"code.cloudfoundry.org/go-log-cache/v3/rpc/logcache_v1"
 	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"code.cloudfoundry.org/log-cache/internal/cache/store"
+	"code.cloudfoundry.org/log-cache/pkg/client"
 )
 
 // LocalStoreReader accesses a store via gRPC calls. It handles converting the
 // requests into a form that the store understands for reading.
 type LocalStoreReader struct {
 	s StoreReader
+
+	maxReadWindow time.Duration
 }
 
 // StoreReader proxies to the log cache for getting envelopes or Log Cache
 // Metadata.
 type StoreReader interface {
-	// Gets envelopes from a local or remote Log Cache.
-	Get(
-		sourceID string,
-		start time.Time,
-		end time.Time,
-		envelopeTypes []logcache_v1.EnvelopeType,
-		nameFilter *regexp.Regexp,
-		limit int,
-		descending bool,
-	) []*loggregator_v2.Envelope
+	// Get gets the envelopes of a source ID selected by the query and the
+	// cursor of the last envelope it looked at.
+	Get(sourceID string, q store.Query) ([]*loggregator_v2.Envelope, int64)
 
 	// Meta gets the metadata from Log Cache instances in the cluster.
 	Meta() map[string]logcache_v1.MetaInfo
+
+	// OldestTimestamp returns the timestamp of the oldest envelope stored
+	// for the source ID.
+	OldestTimestamp(sourceID string) (int64, bool)
 }
 
 // NewLocalStoreReader creates and returns a new LocalStoreReader.
-func NewLocalStoreReader(s StoreReader) *LocalStoreReader {
-	return &LocalStoreReader{
+func NewLocalStoreReader(s StoreReader, opts ...LocalStoreReaderOption) *LocalStoreReader {
+	r := &LocalStoreReader{
 		s: s,
 	}
+
+	for _, o := range opts {
+		o(r)
+	}
+
+	return r
+}
+
+// LocalStoreReaderOption configures a LocalStoreReader.
+type LocalStoreReaderOption func(r *LocalStoreReader)
+
+// WithMaxReadWindow is a LocalStoreReaderOption that rejects reads whose
+// EndTime - StartTime exceeds d with codes.InvalidArgument. A value of 0
+// (the default) allows any window.
+func WithMaxReadWindow(d time.Duration) LocalStoreReaderOption {
+	return func(r *LocalStoreReader) {
+		r.maxReadWindow = d
+	}
 }
 
 // Read returns data from the store.
@@ -60,14 +88,108 @@ func (r *LocalStoreReader) Read(ctx context.Context, req *logcache_v1.ReadReques
 		req.EndTime = time.Now().UnixNano()
 	}
 
+	if r.maxReadWindow > 0 && time.Duration(req.EndTime-req.StartTime) > r.maxReadWindow {
+		return nil, status.Errorf(
+			codes.InvalidArgument,
+			"time range %s exceeds the maximum read window of %s, narrow StartTime and EndTime",
+			time.Duration(req.EndTime-req.StartTime), r.maxReadWindow,
+		)
+	}
+
 	if req.Limit == 0 {
 		req.Limit = 100
 	}
 
+	var (
+		err          error
+		matchExact   bool
+		tagFilters   map[string]*regexp.Regexp
+		unitFilter   string
+		minSeverity  int
+		limitPerType bool
+		counterRate  bool
+		newest       bool
+		latest       bool
+		spilled      bool
+		cursor       *int64
+	)
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		tagFilters, err = client.ParseTagFilters(md.Get(client.TagFilterMetadata))
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+
+		hasTags, err := client.ParseHasTags(md.Get(client.HasTagsMetadata))
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		tagFilters = withHasTags(tagFilters, hasTags)
+
+		unitFilter, _, err = singleMetadata(md, client.UnitFilterMetadata, "unit filter")
+		if err != nil {
+			return nil, err
+		}
+
+		severity, ok, err := singleMetadata(md, client.MinSeverityMetadata, "minimum severity")
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			minSeverity, err = client.ParseSeverity(severity)
+			if err != nil {
+				return nil, status.Error(codes.InvalidArgument, err.Error())
+			}
+		}
+
+		if limitPerType, err = singleBoolMetadata(md, client.LimitPerTypeMetadata, "limit per type"); err != nil {
+			return nil, err
+		}
+		if counterRate, err = singleBoolMetadata(md, client.CounterRateMetadata, "counter rate"); err != nil {
+			return nil, err
+		}
+		if newest, err = singleBoolMetadata(md, client.NewestMetadata, "newest"); err != nil {
+			return nil, err
+		}
+		if latest, err = singleBoolMetadata(md, client.LatestPerSeriesMetadata, "latest per series"); err != nil {
+			return nil, err
+		}
+		if spilled, err = singleBoolMetadata(md, client.IncludeSpilledMetadata, "include spilled"); err != nil {
+			return nil, err
+		}
+		if matchExact, err = singleBoolMetadata(md, client.MatchExactMetadata, "match exact"); err != nil {
+			return nil, err
+		}
+
+		if newest && req.Descending {
+			return nil, status.Error(codes.InvalidArgument, "newest cannot be combined with a descending read")
+		}
+
+		c, ok, err := singleMetadata(md, client.CursorMetadata, "cursor")
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			decoded, err := decodeCursor(c)
+			if err != nil {
+				return nil, status.Error(codes.InvalidArgument, err.Error())
+			}
+			cursor = &decoded
+		}
+		if cursor != nil && (limitPerType || newest || spilled) {
+			return nil, status.Error(codes.InvalidArgument, "cursor cannot be combined with limit per type, newest or include spilled")
+		}
+		if latest && (limitPerType || counterRate || cursor != nil) {
+			return nil, status.Error(codes.InvalidArgument, "latest per series cannot be combined with limit per type, counter rate or cursor")
+		}
+	}
+
 	var nameFilter *regexp.Regexp
-	var err error
 	if req.NameFilter != "" {
-		nameFilter, err = regexp.Compile(req.NameFilter)
+		pattern := req.NameFilter
+		if matchExact {
+			pattern = "^(?:" + pattern + ")$"
+		}
+		nameFilter, err = regexp.Compile(pattern)
 		if err != nil {
 			return nil, fmt.Errorf("Name filter must be a valid regular expression: %s", err)
 		}
@@ -79,24 +201,96 @@ func (r *LocalStoreReader) Read(ctx context.Context, req *logcache_v1.ReadReques
 			envelopeTypes = append(envelopeTypes, e)
 		}
 	}
-	envs := r.s.Get(
-		req.SourceId,
-		time.Unix(0, req.StartTime),
-		time.Unix(0, req.EndTime),
-		envelopeTypes,
-		nameFilter,
-		int(req.Limit),
-		req.Descending,
-	)
+	envs, next := r.s.Get(req.SourceId, store.Query{
+		Start:           time.Unix(0, req.StartTime),
+		End:             time.Unix(0, req.EndTime),
+		EnvelopeTypes:   envelopeTypes,
+		NameFilter:      nameFilter,
+		TagFilters:      tagFilters,
+		UnitFilter:      unitFilter,
+		MinSeverity:     minSeverity,
+		Limit:           int(req.Limit),
+		LimitPerType:    limitPerType,
+		IncludeSpilled:  spilled,
+		LatestPerSeries: latest,
+		Descending:      req.Descending || newest || latest,
+		Cursor:          cursor,
+	})
+	paged := !limitPerType && !newest && !spilled && !latest
+	if paged && len(envs) >= int(req.Limit) {
+		//nolint:errcheck
+		grpc.SetTrailer(ctx, metadata.Pairs(client.CursorTrailer, encodeCursor(next)))
+	}
+	if newest || (latest && !req.Descending) {
+		// The store returned the newest envelopes newest first.
+		slices.Reverse(envs)
+	}
+	if counterRate {
+		envs = counterRates(envs, req.Descending)
+	}
 	resp := &logcache_v1.ReadResponse{
 		Envelopes: &loggregator_v2.EnvelopeBatch{
 			Batch: envs,
 		},
 	}
 
+	if oldest, ok := r.s.OldestTimestamp(req.SourceId); ok && req.StartTime < oldest {
+		// Not every caller is a gRPC server handler, so a failure to set the
+		// trailer is not an error.
+		//nolint:errcheck
+		grpc.SetTrailer(ctx, metadata.Pairs(client.OldestTimestampTrailer, strconv.FormatInt(oldest, 10)))
+	}
+
 	return resp, nil
 }
 
+// singleMetadata returns the value of a metadata key that may be given at
+// most once and whether it was given. name describes the key in errors.
+func singleMetadata(md metadata.MD, key, name string) (string, bool, error) {
+	values := md.Get(key)
+	switch len(values) {
+	case 0:
+		return "", false, nil
+	case 1:
+		return values[0], true, nil
+	default:
+		return "", false, status.Errorf(codes.InvalidArgument, "%s may only be given once, got %d", name, len(values))
+	}
+}
+
+// singleBoolMetadata returns the value of a boolean metadata key that may be
+// given at most once. It is false if the key is not given.
+func singleBoolMetadata(md metadata.MD, key, name string) (bool, error) {
+	v, ok, err := singleMetadata(md, key, name)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, status.Errorf(codes.InvalidArgument, "%s must be true or false, got %q", name, v)
+	}
+
+	return b, nil
+}
+
+// encodeCursor returns the opaque form of a store cursor that is handed to
+// clients.
+func encodeCursor(c int64) string {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(c)) //#nosec G115
+	return base64.RawURLEncoding.EncodeToString(b[:])
+}
+
+func decodeCursor(s string) (int64, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) != 8 {
+		return 0, errors.New("invalid cursor")
+	}
+
+	return int64(binary.BigEndian.Uint64(b)), nil //#nosec G115
+}
+
 func (r *LocalStoreReader) Meta(ctx context.Context, req *logcache_v1.MetaRequest, opts ...grpc.CallOption) (*logcache_v1.MetaResponse, error) {
 	sourceIds := r.s.Meta()
 
@@ -114,3 +308,25 @@ func (r *LocalStoreReader) Meta(ctx context.Context, req *logcache_v1.MetaReques
 		Meta: metaInfo,
 	}, nil
 }
+
+// anyTagValue matches every tag value. The store only matches a tag filter
+// against envelopes that have the tag, so it filters by the presence of a
+// tag.
+var anyTagValue = regexp.MustCompile("")
+
+// withHasTags adds a filter that matches any value for each tag without a
+// tag filter of its own. A tag filter already requires the tag to be
+// present.
+func withHasTags(tagFilters map[string]*regexp.Regexp, tags []string) map[string]*regexp.Regexp {
+	for _, tag := range tags {
+		if _, ok := tagFilters[tag]; ok {
+			continue
+		}
+		if tagFilters == nil {
+			tagFilters = make(map[string]*regexp.Regexp, len(tags))
+		}
+		tagFilters[tag] = anyTagValue
+	}
+
+	return tagFilters
+}
@@ -6,8 +6,15 @@ import (
 
 	"code.cloudfoundry.org/go-log-cache/v3/rpc/logcache_v1"
 	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	"code.cloudfoundry.org/log-cache/internal/cache/store"
 	"code.cloudfoundry.org/log-cache/internal/routing"
+	"code.cloudfoundry.org/log-cache/pkg/client"
 	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -51,6 +58,121 @@ var _ = Describe("LocalStoreReader", func() {
 		Expect(spyStoreReader.descending).To(BeTrue())
 	})
 
+	Describe("retention trailer", func() {
+		var (
+			stream *spyServerTransportStream
+			ctx    context.Context
+		)
+
+		BeforeEach(func() {
+			stream = &spyServerTransportStream{}
+			ctx = grpc.NewContextWithServerTransportStream(context.Background(), stream)
+			spyStoreReader.oldest = 50
+			spyStoreReader.hasOldest = true
+		})
+
+		It("reports the oldest timestamp when reading from before it", func() {
+			_, err := r.Read(ctx, &logcache_v1.ReadRequest{
+				SourceId:  "some-source",
+				StartTime: 10,
+				EndTime:   100,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			oldest, ok := client.OldestTimestamp(stream.trailer)
+			Expect(ok).To(BeTrue())
+			Expect(oldest).To(Equal(int64(50)))
+		})
+
+		It("does not report the oldest timestamp when reading from after it", func() {
+			_, err := r.Read(ctx, &logcache_v1.ReadRequest{
+				SourceId:  "some-source",
+				StartTime: 50,
+				EndTime:   100,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			_, ok := client.OldestTimestamp(stream.trailer)
+			Expect(ok).To(BeFalse())
+		})
+
+		It("does not report the oldest timestamp for an unknown source", func() {
+			spyStoreReader.hasOldest = false
+
+			_, err := r.Read(ctx, &logcache_v1.ReadRequest{
+				SourceId: "some-source",
+				EndTime:  100,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stream.trailer).To(BeEmpty())
+		})
+	})
+
+	Describe("cursor", func() {
+		var (
+			stream *spyServerTransportStream
+			ctx    context.Context
+		)
+
+		BeforeEach(func() {
+			stream = &spyServerTransportStream{}
+			ctx = grpc.NewContextWithServerTransportStream(context.Background(), stream)
+			spyStoreReader.getEnvelopes = []*loggregator_v2.Envelope{
+				{Timestamp: 1},
+				{Timestamp: 2},
+			}
+			spyStoreReader.nextCursor = 7
+		})
+
+		It("returns a cursor that resumes the next read after the last envelope", func() {
+			_, err := r.Read(ctx, &logcache_v1.ReadRequest{
+				SourceId: "some-source",
+				Limit:    2,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(spyStoreReader.cursor).To(BeNil())
+
+			cursor, ok := client.NextCursor(stream.trailer)
+			Expect(ok).To(BeTrue())
+
+			_, err = r.Read(metadata.NewIncomingContext(ctx, metadata.Pairs("log-cache-cursor", cursor)), &logcache_v1.ReadRequest{
+				SourceId: "some-source",
+				Limit:    2,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(spyStoreReader.cursor).To(Equal(proto.Int64(7)))
+		})
+
+		It("does not return a cursor for the last page", func() {
+			_, err := r.Read(ctx, &logcache_v1.ReadRequest{
+				SourceId: "some-source",
+				Limit:    3,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			_, ok := client.NextCursor(stream.trailer)
+			Expect(ok).To(BeFalse())
+		})
+
+		It("returns an error for an invalid cursor", func() {
+			_, err := r.Read(metadata.NewIncomingContext(ctx, metadata.Pairs("log-cache-cursor", "not a cursor")), &logcache_v1.ReadRequest{
+				SourceId: "some-source",
+			})
+			Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+		})
+
+		DescribeTable("returns an error when combined with an option it cannot resume", func(key string) {
+			_, err := r.Read(metadata.NewIncomingContext(ctx, metadata.Pairs("log-cache-cursor", "AAAAAAAAAAc", key, "true")), &logcache_v1.ReadRequest{
+				SourceId: "some-source",
+			})
+			Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+		},
+			Entry("limit per type", "log-cache-limit-per-type"),
+			Entry("newest", "log-cache-newest"),
+			Entry("include spilled", "log-cache-include-spilled"),
+		)
+	})
+
 	It("does not set the envelope type for an ANY", func() {
 		_, err := r.Read(context.Background(), &logcache_v1.ReadRequest{
 			SourceId:      "some-source",
@@ -100,6 +222,33 @@ var _ = Describe("LocalStoreReader", func() {
 		Expect(spyStoreReader.nameFilter.String()).To(Equal(".*foo.*"))
 	})
 
+	It("anchors the name filter with the match exact option", func() {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+			client.MatchExactMetadata, "true",
+		))
+		_, err := r.Read(ctx, &logcache_v1.ReadRequest{
+			SourceId:   "some-source",
+			NameFilter: "cpu|memory",
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(spyStoreReader.nameFilter.MatchString("cpu")).To(BeTrue())
+		Expect(spyStoreReader.nameFilter.MatchString("memory")).To(BeTrue())
+		Expect(spyStoreReader.nameFilter.MatchString("cpu_total")).To(BeFalse())
+		Expect(spyStoreReader.nameFilter.MatchString("total_memory")).To(BeFalse())
+	})
+
+	It("returns an error for an invalid match exact option", func() {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+			client.MatchExactMetadata, "mostly",
+		))
+		_, err := r.Read(ctx, &logcache_v1.ReadRequest{
+			SourceId:   "some-source",
+			NameFilter: "cpu",
+		})
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+	})
+
 	It("returns an error if the end time is before the start time", func() {
 		_, err := r.Read(context.Background(), &logcache_v1.ReadRequest{
 			SourceId:      "some-source",
@@ -142,6 +291,505 @@ var _ = Describe("LocalStoreReader", func() {
 		Expect(err).To(HaveOccurred())
 	})
 
+	It("passes tag filters from the request metadata to the store", func() {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+			client.TagFilterMetadata, "deployment:^cf$",
+			client.TagFilterMetadata, "job:router|cell",
+		))
+		_, err := r.Read(ctx, &logcache_v1.ReadRequest{
+			SourceId: "some-source",
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(spyStoreReader.tagFilters).To(HaveLen(2))
+		Expect(spyStoreReader.tagFilters["deployment"].String()).To(Equal("^cf$"))
+		Expect(spyStoreReader.tagFilters["job"].String()).To(Equal("router|cell"))
+	})
+
+	It("passes has tags from the request metadata to the store as tag filters", func() {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+			client.HasTagsMetadata, "trace_id,deployment",
+			client.TagFilterMetadata, "deployment:^cf$",
+		))
+		_, err := r.Read(ctx, &logcache_v1.ReadRequest{
+			SourceId: "some-source",
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(spyStoreReader.tagFilters).To(HaveLen(2))
+		Expect(spyStoreReader.tagFilters["trace_id"].MatchString("any-value")).To(BeTrue())
+		Expect(spyStoreReader.tagFilters["deployment"].String()).To(Equal("^cf$"))
+	})
+
+	It("passes the unit filter from the request metadata to the store", func() {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+			client.UnitFilterMetadata, "bytes",
+		))
+		_, err := r.Read(ctx, &logcache_v1.ReadRequest{
+			SourceId: "some-source",
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(spyStoreReader.unitFilter).To(Equal("bytes"))
+	})
+
+	It("returns an error for more than one unit filter", func() {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+			client.UnitFilterMetadata, "bytes",
+			client.UnitFilterMetadata, "percentage",
+		))
+		_, err := r.Read(ctx, &logcache_v1.ReadRequest{
+			SourceId: "some-source",
+		})
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+	})
+
+	It("passes the minimum severity from the request metadata to the store", func() {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+			client.MinSeverityMetadata, "error",
+		))
+		_, err := r.Read(ctx, &logcache_v1.ReadRequest{
+			SourceId: "some-source",
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		expected, err := client.ParseSeverity("error")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(spyStoreReader.minSeverity).To(Equal(expected))
+	})
+
+	It("does not filter by severity by default", func() {
+		_, err := r.Read(context.Background(), &logcache_v1.ReadRequest{
+			SourceId: "some-source",
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(spyStoreReader.minSeverity).To(BeZero())
+	})
+
+	It("returns an error for an unknown severity", func() {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+			client.MinSeverityMetadata, "loud",
+		))
+		_, err := r.Read(ctx, &logcache_v1.ReadRequest{
+			SourceId: "some-source",
+		})
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+	})
+
+	It("returns an error for more than one minimum severity", func() {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+			client.MinSeverityMetadata, "info",
+			client.MinSeverityMetadata, "error",
+		))
+		_, err := r.Read(ctx, &logcache_v1.ReadRequest{
+			SourceId: "some-source",
+		})
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+	})
+
+	It("passes the limit per type from the request metadata to the store", func() {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+			client.LimitPerTypeMetadata, "true",
+		))
+		_, err := r.Read(ctx, &logcache_v1.ReadRequest{
+			SourceId: "some-source",
+			EnvelopeTypes: []logcache_v1.EnvelopeType{
+				logcache_v1.EnvelopeType_LOG,
+				logcache_v1.EnvelopeType_COUNTER,
+			},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(spyStoreReader.limitPerType).To(BeTrue())
+	})
+
+	It("passes the include spilled option from the request metadata to the store", func() {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+			client.IncludeSpilledMetadata, "true",
+		))
+		_, err := r.Read(ctx, &logcache_v1.ReadRequest{
+			SourceId: "some-source",
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(spyStoreReader.spilled).To(BeTrue())
+	})
+
+	It("does not include spilled envelopes by default", func() {
+		_, err := r.Read(context.Background(), &logcache_v1.ReadRequest{
+			SourceId: "some-source",
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(spyStoreReader.spilled).To(BeFalse())
+	})
+
+	It("returns an error for an invalid include spilled option", func() {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+			client.IncludeSpilledMetadata, "sometimes",
+		))
+		_, err := r.Read(ctx, &logcache_v1.ReadRequest{
+			SourceId: "some-source",
+		})
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+	})
+
+	It("does not limit per type by default", func() {
+		_, err := r.Read(context.Background(), &logcache_v1.ReadRequest{
+			SourceId: "some-source",
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(spyStoreReader.limitPerType).To(BeFalse())
+	})
+
+	It("returns an error for an invalid limit per type", func() {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+			client.LimitPerTypeMetadata, "sometimes",
+		))
+		_, err := r.Read(ctx, &logcache_v1.ReadRequest{
+			SourceId: "some-source",
+		})
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+	})
+
+	DescribeTable("returns an error for an option given more than once", func(key, value string) {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+			key, value,
+			key, value,
+		))
+		_, err := r.Read(ctx, &logcache_v1.ReadRequest{
+			SourceId: "some-source",
+		})
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+	},
+		Entry("unit filter", client.UnitFilterMetadata, "bytes"),
+		Entry("min severity", client.MinSeverityMetadata, "error"),
+		Entry("limit per type", client.LimitPerTypeMetadata, "true"),
+		Entry("counter rate", client.CounterRateMetadata, "true"),
+		Entry("newest", client.NewestMetadata, "true"),
+		Entry("latest per series", client.LatestPerSeriesMetadata, "true"),
+		Entry("include spilled", client.IncludeSpilledMetadata, "true"),
+		Entry("match exact", client.MatchExactMetadata, "true"),
+		Entry("cursor", client.CursorMetadata, "AAAAAAAAAAc"),
+	)
+
+	Describe("counter rates", func() {
+		counter := func(seconds int64, total uint64) *loggregator_v2.Envelope {
+			return &loggregator_v2.Envelope{
+				Timestamp: seconds * int64(time.Second),
+				SourceId:  "some-source",
+				Tags:      map[string]string{"job": "router"},
+				Message: &loggregator_v2.Envelope_Counter{
+					Counter: &loggregator_v2.Counter{Name: "requests", Total: total},
+				},
+			}
+		}
+
+		rates := func(envelopes []*loggregator_v2.Envelope) map[int64]float64 {
+			res := make(map[int64]float64)
+			for _, e := range envelopes {
+				v := e.GetGauge().GetMetrics()["requests"]
+				Expect(v).ToNot(BeNil())
+				Expect(v.GetUnit()).To(Equal(client.CounterRateUnit))
+				res[e.GetTimestamp()/int64(time.Second)] = v.GetValue()
+			}
+			return res
+		}
+
+		readRates := func(descending bool) []*loggregator_v2.Envelope {
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+				client.CounterRateMetadata, "true",
+			))
+			resp, err := r.Read(ctx, &logcache_v1.ReadRequest{
+				SourceId:   "some-source",
+				Descending: descending,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			return resp.GetEnvelopes().GetBatch()
+		}
+
+		It("returns the per second rate of a monotonic counter", func() {
+			spyStoreReader.getEnvelopes = []*loggregator_v2.Envelope{
+				counter(10, 100),
+				counter(20, 150),
+				counter(30, 250),
+				counter(35, 250),
+			}
+
+			Expect(rates(readRates(false))).To(Equal(map[int64]float64{
+				20: 5,
+				30: 10,
+				35: 0,
+			}))
+		})
+
+		It("takes the total after a reset as the increase", func() {
+			spyStoreReader.getEnvelopes = []*loggregator_v2.Envelope{
+				counter(10, 100),
+				counter(20, 200),
+				counter(30, 40),
+				counter(40, 90),
+			}
+
+			Expect(rates(readRates(false))).To(Equal(map[int64]float64{
+				20: 10,
+				30: 4,
+				40: 5,
+			}))
+		})
+
+		It("computes rates in chronological order for descending reads", func() {
+			spyStoreReader.getEnvelopes = []*loggregator_v2.Envelope{
+				counter(30, 40),
+				counter(20, 200),
+				counter(10, 100),
+			}
+
+			envelopes := readRates(true)
+			Expect(envelopes).To(HaveLen(2))
+			Expect(envelopes[0].GetTimestamp()).To(Equal(30 * int64(time.Second)))
+			Expect(rates(envelopes)).To(Equal(map[int64]float64{
+				20: 10,
+				30: 4,
+			}))
+		})
+
+		It("computes the rate of each counter separately", func() {
+			other := counter(20, 1000)
+			other.Tags = map[string]string{"job": "cell"}
+			spyStoreReader.getEnvelopes = []*loggregator_v2.Envelope{
+				counter(10, 100),
+				other,
+				counter(20, 200),
+			}
+
+			Expect(rates(readRates(false))).To(Equal(map[int64]float64{
+				20: 10,
+			}))
+		})
+
+		It("returns other envelopes unchanged", func() {
+			log := &loggregator_v2.Envelope{
+				Timestamp: 15 * int64(time.Second),
+				SourceId:  "some-source",
+				Message:   &loggregator_v2.Envelope_Log{Log: &loggregator_v2.Log{Payload: []byte("hi")}},
+			}
+			spyStoreReader.getEnvelopes = []*loggregator_v2.Envelope{
+				counter(10, 100),
+				log,
+				counter(20, 200),
+			}
+
+			envelopes := readRates(false)
+			Expect(envelopes).To(HaveLen(2))
+			Expect(envelopes[0]).To(Equal(log))
+			Expect(envelopes[1].GetGauge()).ToNot(BeNil())
+		})
+
+		It("returns counter totals by default", func() {
+			spyStoreReader.getEnvelopes = []*loggregator_v2.Envelope{
+				counter(10, 100),
+				counter(20, 200),
+			}
+
+			resp, err := r.Read(context.Background(), &logcache_v1.ReadRequest{
+				SourceId: "some-source",
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.GetEnvelopes().GetBatch()).To(Equal(spyStoreReader.getEnvelopes))
+		})
+
+		It("returns an error for an invalid counter rate", func() {
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+				client.CounterRateMetadata, "sometimes",
+			))
+			_, err := r.Read(ctx, &logcache_v1.ReadRequest{
+				SourceId: "some-source",
+			})
+			Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+		})
+	})
+
+	Describe("newest", func() {
+		newestCtx := func() context.Context {
+			return metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+				client.NewestMetadata, "true",
+			))
+		}
+
+		It("returns the newest envelopes in ascending order", func() {
+			spyStoreReader.getEnvelopes = []*loggregator_v2.Envelope{
+				{Timestamp: 5},
+				{Timestamp: 4},
+				{Timestamp: 3},
+			}
+
+			resp, err := r.Read(newestCtx(), &logcache_v1.ReadRequest{
+				SourceId: "some-source",
+				Limit:    3,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(spyStoreReader.descending).To(BeTrue())
+			Expect(spyStoreReader.limit).To(Equal(3))
+
+			var timestamps []int64
+			for _, e := range resp.GetEnvelopes().GetBatch() {
+				timestamps = append(timestamps, e.GetTimestamp())
+			}
+			Expect(timestamps).To(Equal([]int64{3, 4, 5}))
+		})
+
+		It("returns an error when combined with a descending read", func() {
+			_, err := r.Read(newestCtx(), &logcache_v1.ReadRequest{
+				SourceId:   "some-source",
+				Descending: true,
+			})
+			Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+		})
+
+		It("returns an error for an invalid newest option", func() {
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+				client.NewestMetadata, "sometimes",
+			))
+			_, err := r.Read(ctx, &logcache_v1.ReadRequest{
+				SourceId: "some-source",
+			})
+			Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+		})
+	})
+
+	Describe("latest per series", func() {
+		latestCtx := func(pairs ...string) context.Context {
+			return metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+				append([]string{client.LatestPerSeriesMetadata, "true"}, pairs...)...,
+			))
+		}
+
+		BeforeEach(func() {
+			spyStoreReader.getEnvelopes = []*loggregator_v2.Envelope{
+				{Timestamp: 5, Tags: map[string]string{"job": "router"}},
+				{Timestamp: 4, Tags: map[string]string{"job": "cell"}},
+			}
+		})
+
+		It("returns the latest envelope of each series in ascending order", func() {
+			resp, err := r.Read(latestCtx(client.IncludeSpilledMetadata, "true"), &logcache_v1.ReadRequest{
+				SourceId: "some-source",
+				Limit:    10,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(spyStoreReader.latest).To(BeTrue())
+			Expect(spyStoreReader.limit).To(Equal(10))
+			Expect(spyStoreReader.spilled).To(BeTrue())
+
+			var timestamps []int64
+			for _, e := range resp.GetEnvelopes().GetBatch() {
+				timestamps = append(timestamps, e.GetTimestamp())
+			}
+			Expect(timestamps).To(Equal([]int64{4, 5}))
+		})
+
+		It("returns the latest envelope of each series in descending order", func() {
+			resp, err := r.Read(latestCtx(), &logcache_v1.ReadRequest{
+				SourceId:   "some-source",
+				Descending: true,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			var timestamps []int64
+			for _, e := range resp.GetEnvelopes().GetBatch() {
+				timestamps = append(timestamps, e.GetTimestamp())
+			}
+			Expect(timestamps).To(Equal([]int64{5, 4}))
+		})
+
+		DescribeTable("returns an error when combined with another option", func(key, value string) {
+			_, err := r.Read(latestCtx(key, value), &logcache_v1.ReadRequest{
+				SourceId: "some-source",
+			})
+			Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+			Expect(spyStoreReader.latest).To(BeFalse())
+		},
+			Entry("limit per type", client.LimitPerTypeMetadata, "true"),
+			Entry("counter rate", client.CounterRateMetadata, "true"),
+			Entry("cursor", client.CursorMetadata, "AAAAAAAAAAc"),
+		)
+
+		It("returns an error for an invalid latest per series option", func() {
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+				client.LatestPerSeriesMetadata, "sometimes",
+			))
+			_, err := r.Read(ctx, &logcache_v1.ReadRequest{
+				SourceId: "some-source",
+			})
+			Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+		})
+	})
+
+	It("returns an error for an invalid tag filter", func() {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+			client.TagFilterMetadata, "deployment:[",
+		))
+		_, err := r.Read(ctx, &logcache_v1.ReadRequest{
+			SourceId: "some-source",
+		})
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+	})
+
+	It("returns an error for an empty has tags entry", func() {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+			client.HasTagsMetadata, "trace_id,",
+		))
+		_, err := r.Read(ctx, &logcache_v1.ReadRequest{
+			SourceId: "some-source",
+		})
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+	})
+
+	Describe("max read window", func() {
+		BeforeEach(func() {
+			r = routing.NewLocalStoreReader(
+				spyStoreReader,
+				routing.WithMaxReadWindow(time.Hour),
+			)
+		})
+
+		It("serves a read within the window", func() {
+			end := time.Now()
+			_, err := r.Read(context.Background(), &logcache_v1.ReadRequest{
+				SourceId:  "some-source",
+				StartTime: end.Add(-time.Hour).UnixNano(),
+				EndTime:   end.UnixNano(),
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(spyStoreReader.sourceID).To(Equal("some-source"))
+		})
+
+		It("rejects a read that exceeds the window", func() {
+			end := time.Now()
+			_, err := r.Read(context.Background(), &logcache_v1.ReadRequest{
+				SourceId:  "some-source",
+				StartTime: end.Add(-time.Hour - time.Nanosecond).UnixNano(),
+				EndTime:   end.UnixNano(),
+			})
+			Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+			Expect(err).To(MatchError(ContainSubstring("maximum read window of 1h0m0s")))
+			Expect(spyStoreReader.sourceID).To(BeEmpty())
+		})
+
+		It("rejects a read from the beginning of time", func() {
+			_, err := r.Read(context.Background(), &logcache_v1.ReadRequest{
+				SourceId: "some-source",
+			})
+			Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+		})
+	})
+
 	It("returns local source IDs from the store", func() {
 		spyStoreReader.metaResponse = map[string]logcache_v1.MetaInfo{
 			"source-1": {
@@ -190,35 +838,71 @@ type spyStoreReader struct {
 	end           time.Time
 	envelopeTypes []logcache_v1.EnvelopeType
 	limit         int
+	limitPerType  bool
+	spilled       bool
 	descending    bool
+	latest        bool
 	nameFilter    *regexp.Regexp
+	tagFilters    map[string]*regexp.Regexp
+	unitFilter    string
+	minSeverity   int
 	metaResponse  map[string]logcache_v1.MetaInfo
+	oldest        int64
+	hasOldest     bool
+	cursor        *int64
+	nextCursor    int64
 }
 
 func newSpyStoreReader() *spyStoreReader {
 	return &spyStoreReader{}
 }
 
-func (s *spyStoreReader) Get(
-	sourceID string,
-	start time.Time,
-	end time.Time,
-	envelopeTypes []logcache_v1.EnvelopeType,
-	nameFilter *regexp.Regexp,
-	limit int,
-	descending bool,
-) []*loggregator_v2.Envelope {
+func (s *spyStoreReader) Get(sourceID string, q store.Query) ([]*loggregator_v2.Envelope, int64) {
 	s.sourceID = sourceID
-	s.start = start
-	s.end = end
-	s.envelopeTypes = envelopeTypes
-	s.nameFilter = nameFilter
-	s.limit = limit
-	s.descending = descending
-
-	return s.getEnvelopes
+	s.tagFilters = q.TagFilters
+	s.unitFilter = q.UnitFilter
+	s.minSeverity = q.MinSeverity
+	s.start = q.Start
+	s.end = q.End
+	s.envelopeTypes = q.EnvelopeTypes
+	s.nameFilter = q.NameFilter
+	s.limit = q.Limit
+	s.limitPerType = q.LimitPerType
+	s.spilled = q.IncludeSpilled
+	s.latest = q.LatestPerSeries
+	s.descending = q.Descending
+	s.cursor = q.Cursor
+
+	return s.getEnvelopes, s.nextCursor
 }
 
 func (s *spyStoreReader) Meta() map[string]logcache_v1.MetaInfo {
 	return s.metaResponse
 }
+
+func (s *spyStoreReader) OldestTimestamp(sourceID string) (int64, bool) {
+	return s.oldest, s.hasOldest
+}
+
+type spyServerTransportStream struct {
+	header  metadata.MD
+	trailer metadata.MD
+}
+
+func (s *spyServerTransportStream) Method() string {
+	return "/logcache.v1.Egress/Read"
+}
+
+func (s *spyServerTransportStream) SetHeader(md metadata.MD) error {
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+
+func (s *spyServerTransportStream) SendHeader(md metadata.MD) error {
+	return nil
+}
+
+func (s *spyServerTransportStream) SetTrailer(md metadata.MD) error {
+	s.trailer = metadata.Join(s.trailer, md)
+	return nil
+}
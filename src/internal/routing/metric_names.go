@@ -0,0 +1,198 @@
+package routing
+
+import (
+	"context"
+	"log"
+	"sort"
+	"time"
+
+	rpc "code.cloudfoundry.org/go-log-cache/v3/rpc/logcache_v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"code.cloudfoundry.org/log-cache/internal/cache/store"
+	"code.cloudfoundry.org/log-cache/pkg/client"
+	"code.cloudfoundry.org/log-cache/pkg/rpc/logcachepb"
+)
+
+// MetricNamesServer is the server API for the metric names service.
+type MetricNamesServer interface {
+	MetricNames(context.Context, *rpc.ReadRequest) (*logcachepb.MetricNamesResponse, error)
+}
+
+// RegisterMetricNamesServer registers the metric names service on the given
+// gRPC server.
+func RegisterMetricNamesServer(s *grpc.Server, srv MetricNamesServer) {
+	s.RegisterService(&metricNamesServiceDesc, srv)
+}
+
+var metricNamesServiceDesc = grpc.ServiceDesc{
+	ServiceName: client.MetricNamesServiceName,
+	HandlerType: (*MetricNamesServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "MetricNames",
+			Handler:    metricNamesHandler,
+		},
+	},
+}
+
+func metricNamesHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(rpc.ReadRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MetricNamesServer).MetricNames(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: client.MetricNamesMethod,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MetricNamesServer).MetricNames(ctx, req.(*rpc.ReadRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// MetricNamesClient looks up metric names on a remote node.
+type MetricNamesClient interface {
+	MetricNames(ctx context.Context, sourceID string, start, end time.Time, limit int, opts ...grpc.CallOption) ([]client.MetricName, error)
+}
+
+// MetricNamesStore is the local store metric names are looked up in.
+type MetricNamesStore interface {
+	MetricNames(sourceID string, start, end time.Time, limit int) []store.MetricName
+}
+
+const (
+	// defaultMetricNamesLimit is the number of names returned when the
+	// request does not say, the same as for reads.
+	defaultMetricNamesLimit = 100
+
+	// maxMetricNamesLimit bounds the size of a metric names response.
+	maxMetricNamesLimit = 1000
+)
+
+// MetricNamesReverseProxy looks up the metric names of a source ID on the
+// nodes that own it, so that clients such as metric discovery UIs do not
+// have to read every envelope to enumerate them.
+type MetricNamesReverseProxy struct {
+	l        Lookup
+	clients  []MetricNamesClient
+	localIdx int
+	local    MetricNamesStore
+	log      *log.Logger
+}
+
+// NewMetricNamesReverseProxy returns a new MetricNamesReverseProxy. The
+// client at localIdx is ignored; lookups on the local node go to the
+// MetricNamesStore instead.
+func NewMetricNamesReverseProxy(
+	l Lookup,
+	clients []MetricNamesClient,
+	localIdx int,
+	local MetricNamesStore,
+	log *log.Logger,
+) *MetricNamesReverseProxy {
+	return &MetricNamesReverseProxy{
+		l:        l,
+		clients:  clients,
+		localIdx: localIdx,
+		local:    local,
+		log:      log,
+	}
+}
+
+// MetricNames returns the distinct names of the counters, gauge metrics and
+// timers of the request's source ID between its start and end time, most
+// recently seen first, up to its limit. The request's order, envelope types
+// and name filter are ignored.
+func (m *MetricNamesReverseProxy) MetricNames(ctx context.Context, in *rpc.ReadRequest) (*logcachepb.MetricNamesResponse, error) {
+	if in.GetSourceId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "source ID is required")
+	}
+	if in.GetLimit() < 0 || in.GetLimit() > maxMetricNamesLimit {
+		return nil, status.Errorf(codes.InvalidArgument, "limit must be between 0 and %d", maxMetricNamesLimit)
+	}
+
+	limit := int(in.GetLimit())
+	if limit == 0 {
+		limit = defaultMetricNamesLimit
+	}
+	start := time.Unix(0, in.GetStartTime())
+	end := time.Now()
+	if in.GetEndTime() != 0 {
+		end = time.Unix(0, in.GetEndTime())
+	}
+
+	if localOnly(ctx) {
+		return metricNamesResponse(m.local.MetricNames(in.GetSourceId(), start, end, limit)), nil
+	}
+
+	idx := m.l(in.GetSourceId())
+	if len(idx) == 0 {
+		return nil, status.Errorf(codes.Unavailable, "failed to find route for request. please try again")
+	}
+
+	remoteCtx := metadata.AppendToOutgoingContext(ctx, localOnlyKey, "true")
+
+	var names []store.MetricName
+	for _, i := range idx {
+		if i == m.localIdx {
+			names = append(names, m.local.MetricNames(in.GetSourceId(), start, end, limit)...)
+			continue
+		}
+
+		n, err := m.clients[i].MetricNames(remoteCtx, in.GetSourceId(), start, end, limit)
+		if err != nil {
+			m.log.Printf("failed to look up metric names of %s on node %d: %s", in.GetSourceId(), i, err)
+			return nil, err
+		}
+		for _, name := range n {
+			names = append(names, store.MetricName{Name: name.Name, Timestamp: name.Timestamp})
+		}
+	}
+
+	return metricNamesResponse(newestMetricNames(names, limit)), nil
+}
+
+// newestMetricNames merges the names found on several nodes, keeping the
+// newest timestamp of each, and returns up to limit of them, most recently
+// seen first.
+func newestMetricNames(names []store.MetricName, limit int) []store.MetricName {
+	newest := make(map[string]int64, len(names))
+	for _, n := range names {
+		if ts, ok := newest[n.Name]; !ok || n.Timestamp > ts {
+			newest[n.Name] = n.Timestamp
+		}
+	}
+
+	merged := make([]store.MetricName, 0, len(newest))
+	for name, ts := range newest {
+		merged = append(merged, store.MetricName{Name: name, Timestamp: ts})
+	}
+	sort.Slice(merged, func(i, j int) bool {
+		if merged[i].Timestamp != merged[j].Timestamp {
+			return merged[i].Timestamp > merged[j].Timestamp
+		}
+
+		return merged[i].Name < merged[j].Name
+	})
+
+	return merged[:min(len(merged), limit)]
+}
+
+func metricNamesResponse(names []store.MetricName) *logcachepb.MetricNamesResponse {
+	resp := &logcachepb.MetricNamesResponse{}
+	for _, n := range names {
+		resp.Names = append(resp.Names, &logcachepb.MetricName{
+			Name:      n.Name,
+			Timestamp: n.Timestamp,
+		})
+	}
+
+	return resp
+}
@@ -0,0 +1,173 @@
+package routing_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"time"
+
+	rpc "code.cloudfoundry.org/go-log-cache/v3/rpc/logcache_v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"code.cloudfoundry.org/log-cache/internal/cache/store"
+	"code.cloudfoundry.org/log-cache/internal/routing"
+	"code.cloudfoundry.org/log-cache/pkg/client"
+	"code.cloudfoundry.org/log-cache/pkg/rpc/logcachepb"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("MetricNamesReverseProxy", func() {
+	var (
+		lookup *spyLookup
+		local  *spyMetricNamesStore
+		remote *spyMetricNamesClient
+		p      *routing.MetricNamesReverseProxy
+	)
+
+	names := func(resp *logcachepb.MetricNamesResponse) []map[string]interface{} {
+		var ns []map[string]interface{}
+		for _, n := range resp.GetNames() {
+			ns = append(ns, map[string]interface{}{
+				"name":      n.GetName(),
+				"timestamp": n.GetTimestamp(),
+			})
+		}
+
+		return ns
+	}
+
+	BeforeEach(func() {
+		lookup = newSpyLookup()
+		local = &spyMetricNamesStore{}
+		remote = &spyMetricNamesClient{}
+		p = routing.NewMetricNamesReverseProxy(
+			lookup.Lookup,
+			[]routing.MetricNamesClient{nil, remote},
+			0,
+			local,
+			log.New(io.Discard, "", 0),
+		)
+	})
+
+	It("looks up locally owned source IDs in the local store", func() {
+		lookup.results["a"] = []int{0}
+		local.names = []store.MetricName{
+			{Name: "latency", Timestamp: 6},
+			{Name: "cpu", Timestamp: 5},
+			{Name: "requests", Timestamp: 3},
+		}
+
+		resp, err := p.MetricNames(context.Background(), &rpc.ReadRequest{
+			SourceId:  "a",
+			StartTime: 1,
+			EndTime:   10,
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(names(resp)).To(Equal([]map[string]interface{}{
+			{"name": "latency", "timestamp": int64(6)},
+			{"name": "cpu", "timestamp": int64(5)},
+			{"name": "requests", "timestamp": int64(3)},
+		}))
+
+		Expect(local.sourceIDs).To(ConsistOf("a"))
+		Expect(local.starts).To(ConsistOf(time.Unix(0, 1)))
+		Expect(local.ends).To(ConsistOf(time.Unix(0, 10)))
+		Expect(local.limits).To(ConsistOf(100))
+		Expect(remote.sourceIDs).To(BeEmpty())
+	})
+
+	It("merges the names found on every owning node, newest first", func() {
+		lookup.results["a"] = []int{0, 1}
+		local.names = []store.MetricName{
+			{Name: "cpu", Timestamp: 5},
+			{Name: "requests", Timestamp: 3},
+		}
+		remote.names = []client.MetricName{
+			{Name: "requests", Timestamp: 7},
+			{Name: "latency", Timestamp: 4},
+		}
+
+		resp, err := p.MetricNames(context.Background(), &rpc.ReadRequest{
+			SourceId: "a",
+			Limit:    2,
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(names(resp)).To(Equal([]map[string]interface{}{
+			{"name": "requests", "timestamp": int64(7)},
+			{"name": "cpu", "timestamp": int64(5)},
+		}))
+
+		Expect(remote.limits).To(ConsistOf(2))
+		md, _ := metadata.FromOutgoingContext(remote.ctxs[0])
+		Expect(md.Get("log-cache-local-only")).To(ConsistOf("true"))
+	})
+
+	It("only looks in the local store for requests fanned out by another node", func() {
+		lookup.results["a"] = []int{1}
+
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("log-cache-local-only", "true"))
+		_, err := p.MetricNames(ctx, &rpc.ReadRequest{SourceId: "a"})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(local.sourceIDs).To(ConsistOf("a"))
+		Expect(remote.sourceIDs).To(BeEmpty())
+	})
+
+	It("returns an error when a remote node fails", func() {
+		lookup.results["a"] = []int{1}
+		remote.err = errors.New("some-error")
+
+		_, err := p.MetricNames(context.Background(), &rpc.ReadRequest{SourceId: "a"})
+		Expect(err).To(MatchError("some-error"))
+	})
+
+	It("validates the request", func() {
+		lookup.results["a"] = []int{0}
+
+		_, err := p.MetricNames(context.Background(), &rpc.ReadRequest{})
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+
+		_, err = p.MetricNames(context.Background(), &rpc.ReadRequest{SourceId: "a", Limit: 1001})
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+
+		_, err = p.MetricNames(context.Background(), &rpc.ReadRequest{SourceId: "b"})
+		Expect(status.Code(err)).To(Equal(codes.Unavailable))
+	})
+})
+
+type spyMetricNamesStore struct {
+	sourceIDs []string
+	starts    []time.Time
+	ends      []time.Time
+	limits    []int
+	names     []store.MetricName
+}
+
+func (s *spyMetricNamesStore) MetricNames(sourceID string, start, end time.Time, limit int) []store.MetricName {
+	s.sourceIDs = append(s.sourceIDs, sourceID)
+	s.starts = append(s.starts, start)
+	s.ends = append(s.ends, end)
+	s.limits = append(s.limits, limit)
+	return s.names
+}
+
+type spyMetricNamesClient struct {
+	ctxs      []context.Context
+	sourceIDs []string
+	limits    []int
+	names     []client.MetricName
+	err       error
+}
+
+func (s *spyMetricNamesClient) MetricNames(ctx context.Context, sourceID string, start, end time.Time, limit int, opts ...grpc.CallOption) ([]client.MetricName, error) {
+	s.ctxs = append(s.ctxs, ctx)
+	s.sourceIDs = append(s.sourceIDs, sourceID)
+	s.limits = append(s.limits, limit)
+	return s.names, s.err
+}
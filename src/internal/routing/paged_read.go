@@ -0,0 +1,96 @@
+package routing
+
+import (
+	"context"
+	"time"
+
+	rpc "code.cloudfoundry.org/go-log-cache/v3/rpc/logcache_v1"
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	"google.golang.org/protobuf/proto"
+)
+
+// readPageSize is the number of envelopes requested per read while paging
+// through a time range. It is the largest limit a Read accepts.
+const readPageSize = 1000
+
+// readPages reads every envelope of the request between its start and end
+// time, oldest first, and passes them to f one page at a time. A zero end
+// time reads up to now. The limit and order of the request are ignored.
+//
+// Envelopes of different nodes can share a timestamp, so each page after
+// the first starts at the last timestamp of the previous one and the
+// envelopes already passed to f at that timestamp are dropped. A page whose
+// envelopes all share a single timestamp cannot be paged through, so the
+// next page starts after it.
+func readPages(ctx context.Context, r Reader, in *rpc.ReadRequest, f func([]*loggregator_v2.Envelope) error) error {
+	end := in.GetEndTime()
+	if end == 0 {
+		end = time.Now().UnixNano()
+	}
+
+	var (
+		start = in.GetStartTime()
+		// seen counts the envelopes at the start timestamp that were
+		// already passed to f.
+		seen map[string]int
+	)
+	for start < end {
+		resp, err := r.Read(ctx, &rpc.ReadRequest{
+			SourceId:      in.GetSourceId(),
+			StartTime:     start,
+			EndTime:       end,
+			Limit:         readPageSize,
+			EnvelopeTypes: in.GetEnvelopeTypes(),
+			NameFilter:    in.GetNameFilter(),
+		})
+		if err != nil {
+			return err
+		}
+
+		batch := resp.GetEnvelopes().GetBatch()
+		unseen := make([]*loggregator_v2.Envelope, 0, len(batch))
+		inPage := make(map[string]int)
+		for _, e := range batch {
+			if e.GetTimestamp() == start {
+				key := envelopeKey(e)
+				inPage[key]++
+				if inPage[key] <= seen[key] {
+					continue
+				}
+			}
+			unseen = append(unseen, e)
+		}
+
+		if err := f(unseen); err != nil {
+			return err
+		}
+
+		if len(batch) < readPageSize {
+			return nil
+		}
+
+		last := batch[len(batch)-1].GetTimestamp()
+		if last == start {
+			start++
+			seen = nil
+			continue
+		}
+
+		start = last
+		seen = make(map[string]int)
+		for _, e := range batch {
+			if e.GetTimestamp() == last {
+				seen[envelopeKey(e)]++
+			}
+		}
+	}
+
+	return nil
+}
+
+// envelopeKey identifies an envelope by its content, which is the same
+// whichever read returned it.
+func envelopeKey(e *loggregator_v2.Envelope) string {
+	b, _ := proto.MarshalOptions{Deterministic: true}.Marshal(e)
+	return string(b)
+}
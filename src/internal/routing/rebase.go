@@ -0,0 +1,78 @@
+package routing
+
+import (
+	"context"
+
+	rpc "code.cloudfoundry.org/go-log-cache/v3/rpc/logcache_v1"
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"code.cloudfoundry.org/log-cache/pkg/client"
+)
+
+// rebaseTo returns the reference source ID the incoming Read asked its
+// timestamps to be rebased to, if any.
+func rebaseTo(ctx context.Context) (string, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", nil
+	}
+
+	v := md.Get(client.RebaseToMetadata)
+	switch {
+	case len(v) == 0:
+		return "", nil
+	case len(v) > 1:
+		return "", status.Errorf(codes.InvalidArgument, "only one %s is allowed", client.RebaseToParam)
+	case v[0] == "":
+		return "", status.Errorf(codes.InvalidArgument, "%s must not be empty", client.RebaseToParam)
+	}
+
+	return v[0], nil
+}
+
+// rebase shifts the timestamps of the envelopes in resp so that the newest
+// timestamp of the source ID lines up with the newest timestamp of the
+// reference source ID. The newest timestamps are taken from Meta, which
+// covers every node. The envelopes are copied since they may be shared
+// with the store.
+func (e *EgressReverseProxy) rebase(ctx context.Context, sourceID, reference string, resp *rpc.ReadResponse) (*rpc.ReadResponse, error) {
+	batch := resp.GetEnvelopes().GetBatch()
+	if len(batch) == 0 {
+		return resp, nil
+	}
+
+	meta, err := e.remoteMeta(ctx, &rpc.MetaRequest{})
+	if err != nil {
+		return nil, err
+	}
+	ref, ok := meta.GetMeta()[reference]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "no envelopes for %s source ID %q", client.RebaseToParam, reference)
+	}
+	src, ok := meta.GetMeta()[sourceID]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "no envelopes for source ID %q", sourceID)
+	}
+
+	offset := ref.GetNewestTimestamp() - src.GetNewestTimestamp()
+	rebased := make([]*loggregator_v2.Envelope, len(batch))
+	for i, env := range batch {
+		rebased[i] = &loggregator_v2.Envelope{
+			Timestamp:      env.GetTimestamp() + offset,
+			SourceId:       env.GetSourceId(),
+			InstanceId:     env.GetInstanceId(),
+			DeprecatedTags: env.GetDeprecatedTags(),
+			Tags:           env.GetTags(),
+			Message:        env.GetMessage(),
+		}
+	}
+
+	return &rpc.ReadResponse{
+		Envelopes: &loggregator_v2.EnvelopeBatch{
+			Batch: rebased,
+		},
+	}, nil
+}
@@ -13,10 +13,23 @@ type RoutingTable struct {
 	replicationFactor uint
 	hasher            *jmphash.Hasher
 	table             []hostRange
+	salt              string
+}
+
+// RoutingTableOption configures a RoutingTable.
+type RoutingTableOption func(*RoutingTable)
+
+// WithRoutingSalt salts the hash of every item so that the same item maps
+// to different nodes in deployments with different salts. Every node in a
+// cluster must use the same salt. It defaults to no salt.
+func WithRoutingSalt(salt string) RoutingTableOption {
+	return func(t *RoutingTable) {
+		t.salt = salt
+	}
 }
 
 // NewRoutingTable returns a new RoutingTable.
-func NewRoutingTable(addrs []string, replicationFactor uint) (*RoutingTable, error) {
+func NewRoutingTable(addrs []string, replicationFactor uint, opts ...RoutingTableOption) (*RoutingTable, error) {
 	if replicationFactor == 0 {
 		return nil, errors.New("replication factor must be greater than 0")
 	}
@@ -36,13 +49,17 @@ func NewRoutingTable(addrs []string, replicationFactor uint) (*RoutingTable, err
 		hasher:            jmphash.NewHasher(len(addrs)),
 	}
 
+	for _, o := range opts {
+		o(t)
+	}
+
 	return t, nil
 }
 
 // Lookup takes a item, hash it and determine what node(s) it should be
 // routed to.
 func (t *RoutingTable) Lookup(item string) []int {
-	hashValue := xxhash.Sum64String(item)
+	hashValue := xxhash.Sum64String(t.salt + item)
 
 	node := t.hasher.Hash(hashValue)
 
@@ -1,6 +1,9 @@
 package routing_test
 
 import (
+	"fmt"
+	"reflect"
+
 	"code.cloudfoundry.org/log-cache/internal/routing"
 
 	. "github.com/onsi/ginkgo/v2"
@@ -30,6 +33,33 @@ var _ = Describe("RoutingTable", func() {
 		Expect(r.Lookup("400")).To(ConsistOf(0, 3, 2))
 	})
 
+	It("routes the same item independently under different salts", func() {
+		addrs := []string{"10.0.1.1", "10.0.1.2", "10.0.1.3", "10.0.1.4"}
+		unsalted, err := routing.NewRoutingTable(addrs, 1)
+		Expect(err).ToNot(HaveOccurred())
+		a, err := routing.NewRoutingTable(addrs, 1, routing.WithRoutingSalt("foundation-a"))
+		Expect(err).ToNot(HaveOccurred())
+		b, err := routing.NewRoutingTable(addrs, 1, routing.WithRoutingSalt("foundation-b"))
+		Expect(err).ToNot(HaveOccurred())
+		sameAsA, err := routing.NewRoutingTable(addrs, 1, routing.WithRoutingSalt("foundation-a"))
+		Expect(err).ToNot(HaveOccurred())
+
+		var differs bool
+		for i := 0; i < 100; i++ {
+			item := fmt.Sprintf("source-%d", i)
+			Expect(a.Lookup(item)).To(Equal(sameAsA.Lookup(item)))
+			if !reflect.DeepEqual(a.Lookup(item), b.Lookup(item)) {
+				differs = true
+			}
+		}
+		Expect(differs).To(BeTrue())
+
+		// An empty salt keeps the unsalted routing.
+		empty, err := routing.NewRoutingTable(addrs, 1, routing.WithRoutingSalt(""))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(empty.Lookup("400")).To(Equal(unsalted.Lookup("400")))
+	})
+
 	It("returns an error if replication factor is invalid", func() {
 		_, err := routing.NewRoutingTable([]string{"10.0.1.1", "10.0.1.2", "10.0.1.3", "10.0.1.4"}, 0)
 		Expect(err).To(HaveOccurred())
@@ -0,0 +1,31 @@
+// Package severity parses the severity of events, which Log Cache reads
+// from a tag of the event.
+package severity
+
+import (
+	"fmt"
+	"strings"
+)
+
+// levels are the known event severities, from least to most severe.
+var levels = map[string]int{
+	"debug":    1,
+	"info":     2,
+	"warn":     3,
+	"warning":  3,
+	"error":    4,
+	"critical": 5,
+	"fatal":    5,
+}
+
+// Parse returns the level of an event severity. Levels increase from debug,
+// info, warning (or warn) and error to critical (or fatal). Severities are
+// case insensitive.
+func Parse(severity string) (int, error) {
+	level, ok := levels[strings.ToLower(strings.TrimSpace(severity))]
+	if !ok {
+		return 0, fmt.Errorf("unknown severity %q, must be one of debug, info, warning, error or critical", severity)
+	}
+
+	return level, nil
+}
@@ -0,0 +1,13 @@
+package severity_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestSeverity(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Severity Suite")
+}
@@ -0,0 +1,39 @@
+package severity_test
+
+import (
+	"code.cloudfoundry.org/log-cache/internal/severity"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Parse", func() {
+	It("orders severities from debug to critical", func() {
+		var levels []int
+		for _, s := range []string{"debug", "info", "warning", "error", "critical"} {
+			level, err := severity.Parse(s)
+			Expect(err).ToNot(HaveOccurred())
+			levels = append(levels, level)
+		}
+
+		for i := 1; i < len(levels); i++ {
+			Expect(levels[i]).To(BeNumerically(">", levels[i-1]))
+		}
+	})
+
+	It("accepts aliases in any case", func() {
+		Expect(severity.Parse("WARN")).To(Equal(mustParse("warning")))
+		Expect(severity.Parse("Fatal")).To(Equal(mustParse("critical")))
+	})
+
+	It("rejects an unknown severity", func() {
+		_, err := severity.Parse("loud")
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+func mustParse(s string) int {
+	level, err := severity.Parse(s)
+	Expect(err).ToNot(HaveOccurred())
+	return level
+}
@@ -0,0 +1,69 @@
+package syslog
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+
+	"github.com/influxdata/go-syslog/v3"
+	"github.com/influxdata/go-syslog/v3/rfc5424"
+)
+
+// nonTransparentParser reads RFC 6587 non-transparent framed syslog messages,
+// where each message is terminated by a trailer byte rather than prefixed
+// with its length.
+type nonTransparentParser struct {
+	trailer          byte
+	maxMessageLength int
+	listener         syslog.ParserListener
+	machine          syslog.Machine
+}
+
+func newNonTransparentParser(trailer byte, maxMessageLength int, l syslog.ParserListener) *nonTransparentParser {
+	return &nonTransparentParser{
+		trailer:          trailer,
+		maxMessageLength: maxMessageLength,
+		listener:         l,
+		machine:          rfc5424.NewParser(),
+	}
+}
+
+// Parse reads messages from r until it returns an error, calling the listener
+// for each message.
+func (p *nonTransparentParser) Parse(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 4096), p.maxMessageLength+1)
+	scanner.Split(p.split)
+
+	for scanner.Scan() {
+		msg := scanner.Bytes()
+		if len(msg) == 0 {
+			continue
+		}
+
+		m, err := p.machine.Parse(msg)
+		p.listener(&syslog.Result{
+			Message: m,
+			Error:   err,
+		})
+	}
+}
+
+func (p *nonTransparentParser) split(data []byte, atEOF bool) (int, []byte, error) {
+	if i := bytes.IndexByte(data, p.trailer); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+
+	return 0, nil, nil
+}
+
+// validTrailer reports whether b can be used to terminate messages without
+// being confused with message content. Printable ASCII characters and spaces
+// are rejected because they routinely appear inside syslog messages.
+func validTrailer(b byte) bool {
+	return b < ' ' || b > '~'
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"log/slog"
 	"time"
 
 	"code.cloudfoundry.org/go-loggregator/v10"
@@ -19,6 +20,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	"golang.org/x/net/context"
 )
@@ -32,23 +34,32 @@ type Server struct {
 	syslogCert            string
 	syslogKey             string
 	idleTimeout           time.Duration
+	maxConnectionLifetime time.Duration
 	maxMessageLength      int
 	trimMessageWhitespace bool
+	maxConnections        int64
+	activeConnections     int64
 
-	ingress        metrics.Counter
-	invalidIngress metrics.Counter
+	nonTransparentFraming bool
+	trailer               byte
 
-	loggr *log.Logger
+	ingress             metrics.Counter
+	invalidIngress      metrics.Counter
+	activeConnGauge     metrics.Gauge
+	rejectedConnections metrics.Counter
+
+	loggr *slog.Logger
 }
 
 type MetricsRegistry interface {
 	NewCounter(name, helpText string, opts ...metrics.MetricOption) metrics.Counter
+	NewGauge(name, helpText string, opts ...metrics.MetricOption) metrics.Gauge
 }
 
 type ServerOption func(s *Server)
 
 func NewServer(
-	loggr *log.Logger,
+	loggr *slog.Logger,
 	m MetricsRegistry,
 	opts ...ServerOption,
 ) *Server {
@@ -58,12 +69,18 @@ func NewServer(
 		idleTimeout:           2 * time.Minute,
 		maxMessageLength:      65 * 1024, // Diego should never send logs bigger than 64Kib
 		trimMessageWhitespace: true,
+		trailer:               '\n',
 	}
 
 	for _, o := range opts {
 		o(s)
 	}
 
+	if !validTrailer(s.trailer) {
+		s.loggr.Warn("invalid non-transparent framing trailer, using LF", "trailer", fmt.Sprintf("%q", s.trailer))
+		s.trailer = '\n'
+	}
+
 	s.ingress = m.NewCounter(
 		"ingress",
 		"Total syslog messages ingressed successfully.",
@@ -72,6 +89,14 @@ func NewServer(
 		"invalid_ingress",
 		"Total number of syslog messages unable to be converted to valid envelopes.",
 	)
+	s.activeConnGauge = m.NewGauge(
+		"syslog_active_connections",
+		"Number of currently open syslog connections.",
+	)
+	s.rejectedConnections = m.NewCounter(
+		"syslog_connections_rejected",
+		"Total number of syslog connections closed because the connection limit was reached.",
+	)
 
 	return s
 }
@@ -113,6 +138,44 @@ func WithIdleTimeout(d time.Duration) ServerOption {
 	}
 }
 
+// WithMaxConnectionLifetime closes connections once they have been open for
+// the given duration, regardless of activity, so that clients reconnect and
+// are rebalanced. Messages already received are parsed before the connection
+// is closed. It defaults to 0, which leaves connections open indefinitely.
+func WithMaxConnectionLifetime(d time.Duration) ServerOption {
+	return func(s *Server) {
+		s.maxConnectionLifetime = d
+	}
+}
+
+// WithMaxConnections limits the number of concurrently open connections.
+// Connections beyond the limit are closed immediately after they are
+// accepted. It defaults to 0, which does not limit connections.
+func WithMaxConnections(n int) ServerOption {
+	return func(s *Server) {
+		s.maxConnections = int64(n)
+	}
+}
+
+// WithNonTransparentFraming configures the server to expect messages framed
+// by a trailer byte (RFC 6587) instead of octet counting. The trailer
+// defaults to LF.
+func WithNonTransparentFraming() ServerOption {
+	return func(s *Server) {
+		s.nonTransparentFraming = true
+	}
+}
+
+// WithNonTransparentFramingTrailer enables non-transparent framing with the
+// given trailer byte, e.g. NUL. Printable characters are rejected since they
+// can occur in message content; the server falls back to LF in that case.
+func WithNonTransparentFramingTrailer(b byte) ServerOption {
+	return func(s *Server) {
+		s.nonTransparentFraming = true
+		s.trailer = b
+	}
+}
+
 func (s *Server) Start() {
 	var l net.Listener
 	var err error
@@ -120,12 +183,12 @@ func (s *Server) Start() {
 		tlsConfig := s.buildTLSConfig()
 		l, err = tls.Listen("tcp", fmt.Sprintf(":%d", s.port), tlsConfig)
 		if err != nil {
-			s.loggr.Fatalf("unable to start syslog server: %s", err)
+			log.Fatalf("unable to start syslog server: %s", err)
 		}
 	} else {
 		l, err = net.Listen("tcp", fmt.Sprintf(":%d", s.port))
 		if err != nil {
-			s.loggr.Fatalf("unable to start syslog server: %s", err)
+			log.Fatalf("unable to start syslog server: %s", err)
 		}
 	}
 	defer s.Stop()
@@ -137,9 +200,18 @@ func (s *Server) Start() {
 	for {
 		c, err := l.Accept()
 		if err != nil {
-			s.loggr.Printf("syslog server no longer accepting connections: %s", err)
+			s.loggr.Info("syslog server no longer accepting connections", "error", err)
 			return
 		}
+
+		if s.maxConnections > 0 && atomic.LoadInt64(&s.activeConnections) >= s.maxConnections {
+			s.rejectedConnections.Add(1)
+			c.Close()
+			continue
+		}
+
+		atomic.AddInt64(&s.activeConnections, 1)
+		s.activeConnGauge.Add(1)
 		go s.handleConnection(c)
 	}
 }
@@ -156,47 +228,69 @@ func (s *Server) Stream(ctx context.Context, req *loggregator_v2.EgressBatchRequ
 }
 
 func (s *Server) handleConnection(conn net.Conn) {
-	defer conn.Close()
-	s.setReadDeadline(conn)
+	defer func() {
+		conn.Close()
+		atomic.AddInt64(&s.activeConnections, -1)
+		s.activeConnGauge.Add(-1)
+	}()
+
+	var expiry time.Time
+	if s.maxConnectionLifetime > 0 {
+		expiry = time.Now().Add(s.maxConnectionLifetime)
+	}
+	s.setReadDeadline(conn, expiry)
+
+	if s.nonTransparentFraming {
+		p := newNonTransparentParser(s.trailer, s.maxMessageLength, s.parseListenerForConnection(conn, expiry))
+		p.Parse(conn)
+		return
+	}
 
 	p := octetcounting.NewParser(
 		syslog.WithMaxMessageLength(s.maxMessageLength),
-		syslog.WithListener(s.parseListenerForConnection(conn)),
+		syslog.WithListener(s.parseListenerForConnection(conn, expiry)),
 	)
 	p.Parse(conn)
 }
 
-func (s *Server) parseListenerForConnection(conn net.Conn) syslog.ParserListener {
+func (s *Server) parseListenerForConnection(conn net.Conn, expiry time.Time) syslog.ParserListener {
 	return func(res *syslog.Result) {
 		s.parseListener(res)
-		s.setReadDeadline(conn)
+		s.setReadDeadline(conn, expiry)
 	}
 }
 
-func (s *Server) setReadDeadline(conn net.Conn) {
-	err := conn.SetReadDeadline(time.Now().Add(s.idleTimeout))
+// setReadDeadline extends the read deadline by the idle timeout, capped at
+// the connection expiry if there is one.
+func (s *Server) setReadDeadline(conn net.Conn, expiry time.Time) {
+	deadline := time.Now().Add(s.idleTimeout)
+	if !expiry.IsZero() && expiry.Before(deadline) {
+		deadline = expiry
+	}
+
+	err := conn.SetReadDeadline(deadline)
 	if err != nil {
-		s.loggr.Printf("syslog server could not set deadline on connection: %s", err)
+		s.loggr.Error("syslog server could not set deadline on connection", "error", err)
 	}
 }
 
 func (s *Server) parseListener(res *syslog.Result) {
 	if res.Error != nil {
 		s.invalidIngress.Add(1)
-		s.loggr.Printf("unable to parse syslog message: %s", res.Error)
+		s.loggr.Debug("unable to parse syslog message", "error", res.Error)
 		return
 	}
 
 	msg, ok := res.Message.(*rfc5424.SyslogMessage)
 	if !ok {
 		s.invalidIngress.Add(1)
-		s.loggr.Printf("invalid message format: not rfc5424")
+		s.loggr.Debug("invalid message format: not rfc5424")
 	}
 
 	env, err := s.convertToEnvelope(msg)
 	if err != nil {
 		s.invalidIngress.Add(1)
-		s.loggr.Printf("unable to convert syslog message to envelope: %s", err)
+		s.loggr.Debug("unable to convert syslog message to envelope", "error", err)
 		return
 	}
 
@@ -5,7 +5,7 @@ import (
 	"crypto/tls"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net"
 	"time"
 
@@ -47,7 +47,7 @@ var _ = Describe("Server", func() {
 	})
 
 	JustBeforeEach(func() {
-		l := log.New(GinkgoWriter, "", log.LstdFlags)
+		l := slog.New(slog.NewTextHandler(GinkgoWriter, nil))
 		server = syslog.NewServer(l, spyRegistry, serverOpts...)
 		go server.Start()
 	})
@@ -290,6 +290,181 @@ var _ = Describe("Server", func() {
 			clientConn.Close()
 		})
 
+		Context("with a max connection lifetime", func() {
+			BeforeEach(func() {
+				serverOpts = append(
+					serverOpts,
+					syslog.WithIdleTimeout(time.Minute),
+					syslog.WithMaxConnectionLifetime(300*time.Millisecond),
+				)
+			})
+
+			It("closes the connection after the lifetime even if writes are occurring", func() {
+				done := make(chan struct{})
+				defer close(done)
+				go func() {
+					for {
+						select {
+						case <-done:
+							return
+						case <-time.After(50 * time.Millisecond):
+							//nolint:errcheck
+							fmt.Fprint(clientConn, LOG_MSG)
+						}
+					}
+				}()
+
+				Eventually(func() error {
+					_, err := clientConn.Read(make([]byte, 1024))
+					return err
+				}, 2).Should(MatchError(io.EOF))
+				Expect(spyRegistry.GetMetric("ingress", nil).Value()).To(BeNumerically(">", 0))
+			})
+
+			It("accepts a new connection after closing the old one", func() {
+				Eventually(func() error {
+					_, err := clientConn.Read(make([]byte, 1024))
+					return err
+				}, 2).Should(MatchError(io.EOF))
+
+				newConn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", serverPort))
+				Expect(err).ToNot(HaveOccurred())
+				defer newConn.Close()
+
+				_, err = fmt.Fprint(newConn, LOG_MSG)
+				Expect(err).ToNot(HaveOccurred())
+				Eventually(func() float64 {
+					return spyRegistry.GetMetric("ingress", nil).Value()
+				}).Should(Equal(1.0))
+			})
+		})
+
+		Context("with max connections", func() {
+			BeforeEach(func() {
+				serverOpts = append(
+					serverOpts,
+					syslog.WithIdleTimeout(time.Minute),
+					syslog.WithMaxConnections(2),
+				)
+			})
+
+			It("rejects connections beyond the limit and keeps the others open", func() {
+				secondConn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", serverPort))
+				Expect(err).ToNot(HaveOccurred())
+				defer secondConn.Close()
+
+				Eventually(func() float64 {
+					return spyRegistry.GetMetric("syslog_active_connections", nil).Value()
+				}).Should(Equal(2.0))
+
+				thirdConn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", serverPort))
+				Expect(err).ToNot(HaveOccurred())
+				defer thirdConn.Close()
+
+				Eventually(func() error {
+					_, err := thirdConn.Read(make([]byte, 1024))
+					return err
+				}, 2).Should(MatchError(io.EOF))
+				Expect(spyRegistry.GetMetric("syslog_connections_rejected", nil).Value()).To(Equal(1.0))
+				Expect(spyRegistry.GetMetric("syslog_active_connections", nil).Value()).To(Equal(2.0))
+
+				_, err = fmt.Fprint(clientConn, LOG_MSG)
+				Expect(err).ToNot(HaveOccurred())
+				_, err = fmt.Fprint(secondConn, LOG_MSG)
+				Expect(err).ToNot(HaveOccurred())
+				Eventually(func() float64 {
+					return spyRegistry.GetMetric("ingress", nil).Value()
+				}).Should(Equal(2.0))
+			})
+
+			It("accepts a new connection once one is closed", func() {
+				secondConn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", serverPort))
+				Expect(err).ToNot(HaveOccurred())
+				Eventually(func() float64 {
+					return spyRegistry.GetMetric("syslog_active_connections", nil).Value()
+				}).Should(Equal(2.0))
+
+				secondConn.Close()
+				Eventually(func() float64 {
+					return spyRegistry.GetMetric("syslog_active_connections", nil).Value()
+				}).Should(Equal(1.0))
+
+				thirdConn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", serverPort))
+				Expect(err).ToNot(HaveOccurred())
+				defer thirdConn.Close()
+
+				_, err = fmt.Fprint(thirdConn, LOG_MSG)
+				Expect(err).ToNot(HaveOccurred())
+				Eventually(func() float64 {
+					return spyRegistry.GetMetric("ingress", nil).Value()
+				}).Should(Equal(1.0))
+				Expect(spyRegistry.GetMetric("syslog_connections_rejected", nil).Value()).To(Equal(0.0))
+			})
+		})
+
+		Context("with non-transparent framing", func() {
+			expected := &loggregator_v2.Envelope{
+				Tags: map[string]string{
+					"source_type": "actual-source-type",
+					"key":         "value",
+				},
+				InstanceId: "2",
+				Timestamp:  12345000,
+				SourceId:   "test-app-id",
+				Message: &loggregator_v2.Envelope_Log{
+					Log: &loggregator_v2.Log{
+						Payload: []byte("just a test"),
+						Type:    loggregator_v2.Log_OUT,
+					},
+				},
+			}
+			msg := `<14>1 1970-01-01T00:00:00.012345+00:00 test-hostname test-app-id [APP/2] - [tags@47450 key="value" source_type="actual-source-type"] just a test`
+
+			Context("with the default LF trailer", func() {
+				BeforeEach(func() {
+					serverOpts = append(serverOpts, syslog.WithNonTransparentFraming())
+				})
+
+				It("splits messages on LF", func() {
+					_, err := fmt.Fprint(clientConn, msg+"\n"+msg+"\n")
+					Expect(err).ToNot(HaveOccurred())
+
+					stream := server.Stream(context.Background(), &loggregator_v2.EgressBatchRequest{})
+					Expect(stream()).To(ConsistOf(expected))
+					Expect(stream()).To(ConsistOf(expected))
+				})
+			})
+
+			Context("with a custom trailer", func() {
+				BeforeEach(func() {
+					serverOpts = append(serverOpts, syslog.WithNonTransparentFramingTrailer(0))
+				})
+
+				It("splits messages on the trailer", func() {
+					_, err := fmt.Fprint(clientConn, msg+"\x00"+msg+"\x00")
+					Expect(err).ToNot(HaveOccurred())
+
+					stream := server.Stream(context.Background(), &loggregator_v2.EgressBatchRequest{})
+					Expect(stream()).To(ConsistOf(expected))
+					Expect(stream()).To(ConsistOf(expected))
+					Expect(spyRegistry.GetMetric("invalid_ingress", nil).Value()).To(BeZero())
+				})
+			})
+
+			Context("with a printable trailer", func() {
+				BeforeEach(func() {
+					serverOpts = append(serverOpts, syslog.WithNonTransparentFramingTrailer('t'))
+				})
+
+				It("falls back to LF", func() {
+					_, err := fmt.Fprint(clientConn, msg+"\n")
+					Expect(err).ToNot(HaveOccurred())
+
+					Expect(server.Stream(context.Background(), &loggregator_v2.EgressBatchRequest{})()).To(ConsistOf(expected))
+				})
+			})
+		})
+
 		It("accepts tcp connections", func() {
 			_, err := fmt.Fprint(clientConn, LOG_MSG)
 			Expect(err).ToNot(HaveOccurred())
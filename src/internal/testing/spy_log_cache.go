@@ -3,15 +3,18 @@ package testing
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"log"
 	"net"
 	"sync"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
 
 	rpc "code.cloudfoundry.org/go-log-cache/v3/rpc/logcache_v1"
 	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	"code.cloudfoundry.org/log-cache/internal/routing"
 )
 
 type SpyAgent struct {
@@ -79,13 +82,16 @@ type SpyLogCache struct {
 	localOnlyValues    []bool
 	envelopes          []*loggregator_v2.Envelope
 	readRequests       []*rpc.ReadRequest
+	readMetadata       []metadata.MD
 	queryRequests      []*rpc.PromQL_InstantQueryRequest
 	QueryError         error
+	QueryBlock         chan struct{}
 	rangeQueryRequests []*rpc.PromQL_RangeQueryRequest
 	ReadEnvelopes      map[string]func() []*loggregator_v2.Envelope
 	MetaResponses      map[string]*rpc.MetaInfo
 	tlsConfig          *tls.Config
 	value              float64
+	sendFailures       int
 	rpc.UnimplementedEgressServer
 	rpc.UnimplementedIngressServer
 	rpc.UnimplementedPromQLQuerierServer
@@ -117,7 +123,7 @@ func (s *SpyLogCache) Start() string {
 	} else {
 		srv = grpc.NewServer(grpc.Creds(credentials.NewTLS(s.tlsConfig)))
 	}
-	rpc.RegisterIngressServer(srv, s)
+	routing.RegisterIngressServer(srv, s)
 	rpc.RegisterEgressServer(srv, s)
 	rpc.RegisterPromQLQuerierServer(srv, s)
 
@@ -151,10 +157,31 @@ func (s *SpyLogCache) GetReadRequests() []*rpc.ReadRequest {
 	return r
 }
 
+// GetReadMetadata returns the incoming metadata of each Read.
+func (s *SpyLogCache) GetReadMetadata() []metadata.MD {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := make([]metadata.MD, len(s.readMetadata))
+	copy(r, s.readMetadata)
+	return r
+}
+
+// FailNextSends makes the next n calls to Send return an error.
+func (s *SpyLogCache) FailNextSends(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sendFailures = n
+}
+
 func (s *SpyLogCache) Send(ctx context.Context, r *rpc.SendRequest) (*rpc.SendResponse, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	if s.sendFailures > 0 {
+		s.sendFailures--
+		return nil, errors.New("send failure")
+	}
+
 	s.localOnlyValues = append(s.localOnlyValues, r.LocalOnly)
 
 	s.envelopes = append(s.envelopes, r.Envelopes.Batch...)
@@ -167,6 +194,8 @@ func (s *SpyLogCache) Read(ctx context.Context, r *rpc.ReadRequest) (*rpc.ReadRe
 	defer s.mu.Unlock()
 
 	s.readRequests = append(s.readRequests, r)
+	md, _ := metadata.FromIncomingContext(ctx)
+	s.readMetadata = append(s.readMetadata, md)
 
 	b := s.ReadEnvelopes[r.GetSourceId()]
 
@@ -190,9 +219,15 @@ func (s *SpyLogCache) Meta(ctx context.Context, r *rpc.MetaRequest) (*rpc.MetaRe
 
 func (s *SpyLogCache) InstantQuery(ctx context.Context, r *rpc.PromQL_InstantQueryRequest) (*rpc.PromQL_InstantQueryResult, error) {
 	s.mu.Lock()
-	defer s.mu.Unlock()
-
 	s.queryRequests = append(s.queryRequests, r)
+	s.mu.Unlock()
+
+	if s.QueryBlock != nil {
+		<-s.QueryBlock
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
 	return &rpc.PromQL_InstantQueryResult{
 		Result: &rpc.PromQL_InstantQueryResult_Scalar{
@@ -238,7 +273,7 @@ func (s *SpyLogCache) RangeQuery(ctx context.Context, r *rpc.PromQL_RangeQueryRe
 				},
 			},
 		},
-	}, nil
+	}, s.QueryError
 }
 
 func (s *SpyLogCache) GetRangeQueryRequests() []*rpc.PromQL_RangeQueryRequest {
@@ -0,0 +1,121 @@
+package tls
+
+import (
+	gotls "crypto/tls"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// CertReloader serves a certificate and key pair from disk and reloads it
+// when either file changes, so that rotated certificates are used for new
+// handshakes without restarting the process or closing the listener.
+type CertReloader struct {
+	certPath string
+	keyPath  string
+	log      *log.Logger
+
+	mu      sync.Mutex
+	cert    *gotls.Certificate
+	certMod fileVersion
+	keyMod  fileVersion
+}
+
+type fileVersion struct {
+	modTime time.Time
+	size    int64
+}
+
+// NewCertReloader loads the certificate and key pair at the given paths.
+func NewCertReloader(certPath, keyPath string, log *log.Logger) (*CertReloader, error) {
+	r := &CertReloader{
+		certPath: certPath,
+		keyPath:  keyPath,
+		log:      log,
+	}
+
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// GetCertificate can be used as the GetCertificate callback of a server
+// tls.Config.
+func (r *CertReloader) GetCertificate(*gotls.ClientHelloInfo) (*gotls.Certificate, error) {
+	return r.certificate(), nil
+}
+
+// GetClientCertificate can be used as the GetClientCertificate callback of
+// a client tls.Config.
+func (r *CertReloader) GetClientCertificate(*gotls.CertificateRequestInfo) (*gotls.Certificate, error) {
+	return r.certificate(), nil
+}
+
+// Apply replaces any static certificates in cfg with the reloaded one.
+func (r *CertReloader) Apply(cfg *gotls.Config) {
+	cfg.Certificates = nil
+	cfg.GetCertificate = r.GetCertificate
+	cfg.GetClientCertificate = r.GetClientCertificate
+}
+
+// certificate reloads the pair if either file has changed since it was
+// last read. A pair that fails to load, e.g. because only one of the files
+// has been replaced so far, is logged and the previous one kept.
+func (r *CertReloader) certificate() *gotls.Certificate {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	certMod, err := stat(r.certPath)
+	if err != nil {
+		r.log.Printf("failed to check %s for changes: %s", r.certPath, err)
+		return r.cert
+	}
+	keyMod, err := stat(r.keyPath)
+	if err != nil {
+		r.log.Printf("failed to check %s for changes: %s", r.keyPath, err)
+		return r.cert
+	}
+
+	if certMod != r.certMod || keyMod != r.keyMod {
+		if err := r.reload(); err != nil {
+			r.log.Printf("keeping previous certificate: %s", err)
+		}
+	}
+
+	return r.cert
+}
+
+func (r *CertReloader) reload() error {
+	certMod, err := stat(r.certPath)
+	if err != nil {
+		return err
+	}
+	keyMod, err := stat(r.keyPath)
+	if err != nil {
+		return err
+	}
+
+	cert, err := gotls.LoadX509KeyPair(r.certPath, r.keyPath)
+	if err != nil {
+		return fmt.Errorf("failed to load certificate %s: %w", r.certPath, err)
+	}
+
+	r.cert = &cert
+	r.certMod = certMod
+	r.keyMod = keyMod
+
+	return nil
+}
+
+func stat(path string) (fileVersion, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return fileVersion{}, err
+	}
+
+	return fileVersion{modTime: fi.ModTime(), size: fi.Size()}, nil
+}
@@ -0,0 +1,108 @@
+package tls_test
+
+import (
+	"crypto/tls"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/log-cache/internal/testing"
+	lctls "code.cloudfoundry.org/log-cache/internal/tls"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CertReloader", func() {
+	var (
+		certPath string
+		keyPath  string
+		lis      net.Listener
+	)
+
+	install := func(commonName string) {
+		copyFile(testing.LogCacheTestCerts.Cert(commonName), certPath)
+		copyFile(testing.LogCacheTestCerts.Key(commonName), keyPath)
+	}
+
+	servedCommonName := func() string {
+		conn, err := tls.Dial("tcp", lis.Addr().String(), &tls.Config{
+			InsecureSkipVerify: true, //nolint:gosec
+		})
+		Expect(err).ToNot(HaveOccurred())
+		defer conn.Close()
+
+		return conn.ConnectionState().PeerCertificates[0].Subject.CommonName
+	}
+
+	BeforeEach(func() {
+		dir := GinkgoT().TempDir()
+		certPath = filepath.Join(dir, "server.crt")
+		keyPath = filepath.Join(dir, "server.key")
+		install("log-cache")
+
+		r, err := lctls.NewCertReloader(certPath, keyPath, log.New(GinkgoWriter, "", 0))
+		Expect(err).ToNot(HaveOccurred())
+
+		cfg := &tls.Config{}
+		r.Apply(cfg)
+		lis, err = tls.Listen("tcp", "127.0.0.1:0", cfg)
+		Expect(err).ToNot(HaveOccurred())
+
+		go func() {
+			for {
+				conn, err := lis.Accept()
+				if err != nil {
+					return
+				}
+				go func() {
+					defer conn.Close()
+					_ = conn.(*tls.Conn).Handshake()
+				}()
+			}
+		}()
+	})
+
+	AfterEach(func() {
+		lis.Close()
+	})
+
+	It("serves the certificate from disk", func() {
+		Expect(servedCommonName()).To(Equal("log-cache"))
+	})
+
+	It("uses a rotated certificate for new handshakes", func() {
+		Expect(servedCommonName()).To(Equal("log-cache"))
+
+		install("log-cache-rotated")
+
+		Expect(servedCommonName()).To(Equal("log-cache-rotated"))
+	})
+
+	It("keeps the previous certificate if the new pair does not load", func() {
+		copyFile(testing.LogCacheTestCerts.Cert("log-cache-rotated"), certPath)
+
+		Expect(servedCommonName()).To(Equal("log-cache"))
+	})
+
+	It("returns an error if the pair can not be loaded initially", func() {
+		_, err := lctls.NewCertReloader(certPath, filepath.Join(GinkgoT().TempDir(), "missing.key"), log.New(io.Discard, "", 0))
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+// copyFile replaces dst with src and moves its modification time forward so
+// that the change is seen even on file systems with coarse timestamps.
+func copyFile(src, dst string) {
+	b, err := os.ReadFile(src)
+	Expect(err).ToNot(HaveOccurred())
+	Expect(os.WriteFile(dst, b, 0600)).To(Succeed())
+
+	fi, err := os.Stat(dst)
+	Expect(err).ToNot(HaveOccurred())
+	mod := fi.ModTime().Add(time.Second)
+	Expect(os.Chtimes(dst, mod, mod)).To(Succeed())
+}
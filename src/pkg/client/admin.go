@@ -0,0 +1,164 @@
+package client
+
+import (
+	"context"
+	"time"
+
+	rpc "code.cloudfoundry.org/go-log-cache/v3/rpc/logcache_v1"
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"code.cloudfoundry.org/log-cache/pkg/rpc/logcachepb"
+)
+
+const (
+	// AdminServiceName is the name of the Log Cache admin gRPC service.
+	AdminServiceName = "logcache.v1.Admin"
+
+	// PurgeSourceIDMethod is the full method name of the purge RPC.
+	PurgeSourceIDMethod = "/" + AdminServiceName + "/PurgeSourceId"
+
+	// ExportSourceIDMethod is the full method name of the export RPC.
+	ExportSourceIDMethod = "/" + AdminServiceName + "/ExportSourceId"
+
+	// DiagnosticsMethod is the full method name of the diagnostics RPC.
+	DiagnosticsMethod = "/" + AdminServiceName + "/Diagnostics"
+
+	// PauseSourceIDMethod is the full method name of the pause RPC.
+	PauseSourceIDMethod = "/" + AdminServiceName + "/PauseSourceId"
+)
+
+// ExportSourceIDDesc describes the export RPC. The client sends a single
+// ReadRequest and the server streams back every matching envelope.
+var ExportSourceIDDesc = grpc.StreamDesc{
+	StreamName:    "ExportSourceId",
+	ServerStreams: true,
+}
+
+// AdminClient calls the Log Cache admin gRPC service. The service is only
+// available on nodes started with admin enabled.
+type AdminClient struct {
+	conn grpc.ClientConnInterface
+}
+
+// NewAdminClient creates a new AdminClient. The connection should use the
+// same mutual TLS credentials as any other Log Cache node.
+func NewAdminClient(conn grpc.ClientConnInterface) *AdminClient {
+	return &AdminClient{
+		conn: conn,
+	}
+}
+
+// PurgeSourceID removes all envelopes stored for the given source ID and
+// returns how many were removed.
+func (c *AdminClient) PurgeSourceID(ctx context.Context, sourceID string, opts ...grpc.CallOption) (int64, error) {
+	resp := &wrapperspb.Int64Value{}
+	err := c.conn.Invoke(ctx, PurgeSourceIDMethod, wrapperspb.String(sourceID), resp, opts...)
+	if err != nil {
+		return 0, err
+	}
+
+	return resp.GetValue(), nil
+}
+
+// PauseSourceID drops every envelope written for the given source ID for
+// the duration d, without removing the envelopes already stored, and
+// returns the time at which envelopes are stored again. A d of 0 resumes a
+// paused source ID.
+func (c *AdminClient) PauseSourceID(ctx context.Context, sourceID string, d time.Duration, opts ...grpc.CallOption) (time.Time, error) {
+	req := &logcachepb.PauseSourceIdRequest{
+		SourceId: sourceID,
+		Duration: durationpb.New(d),
+	}
+
+	resp := &timestamppb.Timestamp{}
+	err := c.conn.Invoke(ctx, PauseSourceIDMethod, req, resp, opts...)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return resp.AsTime(), nil
+}
+
+// ExportSourceID streams every envelope for the given source ID with a
+// timestamp in [start, end). A zero end exports everything up to now.
+func (c *AdminClient) ExportSourceID(ctx context.Context, sourceID string, start, end time.Time, opts ...grpc.CallOption) (*ExportStream, error) {
+	s, err := c.conn.NewStream(ctx, &ExportSourceIDDesc, ExportSourceIDMethod, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &rpc.ReadRequest{
+		SourceId:  sourceID,
+		StartTime: start.UnixNano(),
+	}
+	if !end.IsZero() {
+		req.EndTime = end.UnixNano()
+	}
+
+	if err := s.SendMsg(req); err != nil {
+		return nil, err
+	}
+	if err := s.CloseSend(); err != nil {
+		return nil, err
+	}
+
+	return &ExportStream{ClientStream: s}, nil
+}
+
+// ExportStream is an open ExportSourceId stream.
+type ExportStream struct {
+	grpc.ClientStream
+}
+
+// Recv returns the next exported envelope. It returns io.EOF once every
+// envelope has been received.
+func (s *ExportStream) Recv() (*loggregator_v2.Envelope, error) {
+	e := &loggregator_v2.Envelope{}
+	if err := s.RecvMsg(e); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// SourceDiagnostics describes the envelopes a node holds for a source ID.
+type SourceDiagnostics struct {
+	SourceID string
+
+	// Size is the number of envelopes stored for the source ID.
+	Size int
+
+	// Depth is the depth of the tree the envelopes are stored in.
+	Depth int
+
+	OldestTimestamp int64
+	NewestTimestamp int64
+}
+
+// Diagnostics returns the limit source IDs holding the most envelopes on
+// the node the connection is to, largest first. A limit of 0 lets the node
+// choose.
+func (c *AdminClient) Diagnostics(ctx context.Context, limit uint32, opts ...grpc.CallOption) ([]SourceDiagnostics, error) {
+	resp := &logcachepb.DiagnosticsResponse{}
+	err := c.conn.Invoke(ctx, DiagnosticsMethod, wrapperspb.UInt32(limit), resp, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	diagnostics := make([]SourceDiagnostics, 0, len(resp.GetSources()))
+	for _, d := range resp.GetSources() {
+		diagnostics = append(diagnostics, SourceDiagnostics{
+			SourceID:        d.GetSourceId(),
+			Size:            int(d.GetSize()),
+			Depth:           int(d.GetDepth()),
+			OldestTimestamp: d.GetOldestTimestamp(),
+			NewestTimestamp: d.GetNewestTimestamp(),
+		})
+	}
+
+	return diagnostics, nil
+}
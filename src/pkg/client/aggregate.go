@@ -0,0 +1,85 @@
+package client
+
+import (
+	"context"
+	"regexp"
+	"time"
+
+	rpc "code.cloudfoundry.org/go-log-cache/v3/rpc/logcache_v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"code.cloudfoundry.org/log-cache/pkg/rpc/logcachepb"
+)
+
+const (
+	// AggregationServiceName is the name of the Log Cache aggregation gRPC
+	// service.
+	AggregationServiceName = "logcache.v1.Aggregation"
+
+	// AggregateMethod is the full method name of the aggregate RPC.
+	AggregateMethod = "/" + AggregationServiceName + "/Aggregate"
+
+	// GroupByMetadata is the gRPC metadata key holding the tag an Aggregate
+	// request groups envelopes by.
+	GroupByMetadata = "log-cache-group-by"
+)
+
+// AggregateGroup holds the aggregates of a metric over the envelopes that
+// share a value of the tag they were grouped by.
+type AggregateGroup struct {
+	// Value is the value of the tag. Envelopes without the tag are
+	// grouped under the empty value.
+	Value string
+
+	Sum   float64
+	Avg   float64
+	Count int64
+}
+
+// AggregationClient calls the Log Cache aggregation gRPC service.
+type AggregationClient struct {
+	conn grpc.ClientConnInterface
+}
+
+// NewAggregationClient creates a new AggregationClient.
+func NewAggregationClient(conn grpc.ClientConnInterface) *AggregationClient {
+	return &AggregationClient{
+		conn: conn,
+	}
+}
+
+// Aggregate groups the counter and gauge envelopes of the metric stored for
+// the source ID with a timestamp in [start, end) by the value of the
+// groupBy tag, and returns the sum, average and count of the metric for
+// each group, ordered by tag value. Each counter series contributes the
+// increase of its total over the window once. A zero end aggregates
+// everything up to now.
+func (c *AggregationClient) Aggregate(ctx context.Context, sourceID, metric, groupBy string, start, end time.Time, opts ...grpc.CallOption) ([]AggregateGroup, error) {
+	req := &rpc.ReadRequest{
+		SourceId:   sourceID,
+		StartTime:  start.UnixNano(),
+		NameFilter: regexp.QuoteMeta(metric),
+	}
+	if !end.IsZero() {
+		req.EndTime = end.UnixNano()
+	}
+
+	resp := &logcachepb.AggregateResponse{}
+	ctx = metadata.AppendToOutgoingContext(ctx, GroupByMetadata, groupBy)
+	if err := c.conn.Invoke(ctx, AggregateMethod, req, resp, opts...); err != nil {
+		return nil, err
+	}
+
+	groups := make([]AggregateGroup, 0, len(resp.GetGroups()))
+	for _, g := range resp.GetGroups() {
+		groups = append(groups, AggregateGroup{
+			Value: g.GetValue(),
+			Sum:   g.GetSum(),
+			Avg:   g.GetAvg(),
+			Count: g.GetCount(),
+		})
+	}
+
+	return groups, nil
+}
@@ -0,0 +1,104 @@
+// Package client provides helpers for tooling that talks to Log Cache.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// HTTPClient is used to make requests. It is expected to add authorization
+// to each request, e.g. an oauth2 client backed by UAA.
+type HTTPClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// AppNameResolver resolves app names to the source IDs Log Cache stores their
+// envelopes under, using the Cloud Controller v3 API.
+type AppNameResolver struct {
+	addr   string
+	client HTTPClient
+}
+
+// NewAppNameResolver creates a new AppNameResolver for the given Cloud
+// Controller address.
+func NewAppNameResolver(capiAddr string, c HTTPClient) *AppNameResolver {
+	return &AppNameResolver{
+		addr:   strings.TrimSuffix(capiAddr, "/"),
+		client: c,
+	}
+}
+
+// SourceIDs returns the source IDs for each of the given app names. An app
+// name can map to several source IDs when apps in different spaces share it.
+// Names with no matching app are absent from the result.
+func (r *AppNameResolver) SourceIDs(ctx context.Context, appNames []string) (map[string][]string, error) {
+	sourceIDs := make(map[string][]string)
+	if len(appNames) == 0 {
+		return sourceIDs, nil
+	}
+
+	u, err := url.Parse(r.addr + "/v3/apps")
+	if err != nil {
+		return nil, err
+	}
+
+	q := u.Query()
+	q.Set("names", strings.Join(appNames, ","))
+	q.Set("per_page", "5000")
+	u.RawQuery = q.Encode()
+
+	next := u.String()
+	for next != "" {
+		var page appsPage
+		if err := r.get(ctx, next, &page); err != nil {
+			return nil, err
+		}
+
+		for _, app := range page.Resources {
+			sourceIDs[app.Name] = append(sourceIDs[app.Name], app.GUID)
+		}
+		next = page.Pagination.Next.Href
+	}
+
+	return sourceIDs, nil
+}
+
+type appsPage struct {
+	Pagination struct {
+		Next struct {
+			Href string `json:"href"`
+		} `json:"next"`
+	} `json:"pagination"`
+	Resources []struct {
+		GUID string `json:"guid"`
+		Name string `json:"name"`
+	} `json:"resources"`
+}
+
+func (r *AppNameResolver) get(ctx context.Context, u string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		//nolint:errcheck
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d from %s", resp.StatusCode, req.URL.EscapedPath())
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
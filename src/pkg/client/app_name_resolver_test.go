@@ -0,0 +1,76 @@
+package client_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	"code.cloudfoundry.org/log-cache/pkg/client"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("AppNameResolver", func() {
+	var (
+		server   *httptest.Server
+		requests []*http.Request
+		resolver *client.AppNameResolver
+	)
+
+	BeforeEach(func() {
+		requests = nil
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests = append(requests, r)
+
+			if r.URL.Query().Get("page") == "2" {
+				fmt.Fprint(w, `{"pagination": {"next": null}, "resources": [{"guid": "app-guid-3", "name": "app-b"}]}`)
+				return
+			}
+
+			fmt.Fprintf(w, `{
+				"pagination": {"next": {"href": "%s/v3/apps?page=2"}},
+				"resources": [
+					{"guid": "app-guid-1", "name": "app-a"},
+					{"guid": "app-guid-2", "name": "app-a"}
+				]
+			}`, "http://"+r.Host)
+		}))
+
+		resolver = client.NewAppNameResolver(server.URL, http.DefaultClient)
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("resolves app names to source IDs across pages", func() {
+		sourceIDs, err := resolver.SourceIDs(context.Background(), []string{"app-a", "app-b"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(sourceIDs).To(Equal(map[string][]string{
+			"app-a": {"app-guid-1", "app-guid-2"},
+			"app-b": {"app-guid-3"},
+		}))
+
+		Expect(requests).To(HaveLen(2))
+		Expect(requests[0].URL.Path).To(Equal("/v3/apps"))
+		Expect(requests[0].URL.Query().Get("names")).To(Equal("app-a,app-b"))
+	})
+
+	It("does not make a request without app names", func() {
+		sourceIDs, err := resolver.SourceIDs(context.Background(), nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(sourceIDs).To(BeEmpty())
+		Expect(requests).To(BeEmpty())
+	})
+
+	It("returns an error for a non-200 response", func() {
+		server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+		})
+
+		_, err := resolver.SourceIDs(context.Background(), []string{"app-a"})
+		Expect(err).To(MatchError(ContainSubstring("401")))
+	})
+})
@@ -0,0 +1,103 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"time"
+
+	logcache "code.cloudfoundry.org/go-log-cache/v3"
+	"code.cloudfoundry.org/go-log-cache/v3/rpc/logcache_v1"
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+)
+
+// availabilityPageSize is the limit of each Read made to count heartbeats.
+const availabilityPageSize = 1000
+
+// Availability is the number of heartbeats received from a source ID over
+// a window compared to the number it was expected to emit.
+type Availability struct {
+	Received int
+	Expected int
+}
+
+// Fraction returns the share of expected heartbeats that were received,
+// from 0 to 1.
+func (a Availability) Fraction() float64 {
+	if a.Expected == 0 {
+		return 0
+	}
+
+	return float64(a.Received) / float64(a.Expected)
+}
+
+// HeartbeatAvailability measures the availability of a source ID that emits
+// a counter or gauge named metric every interval. The window [start..end)
+// is split into intervals and each one with at least one heartbeat counts
+// as received, so late or duplicate heartbeats do not count twice.
+func HeartbeatAvailability(
+	ctx context.Context,
+	r logcache.Reader,
+	sourceID string,
+	metric string,
+	interval time.Duration,
+	start time.Time,
+	end time.Time,
+) (Availability, error) {
+	if interval <= 0 {
+		return Availability{}, errors.New("heartbeat interval must be positive")
+	}
+	if !end.After(start) {
+		return Availability{}, errors.New("end must be after start")
+	}
+
+	window := end.Sub(start)
+	expected := int(window / interval)
+	if window%interval != 0 {
+		expected++
+	}
+
+	received := make(map[int64]bool)
+	cursor := start
+	for {
+		envelopes, err := r(ctx, sourceID, cursor,
+			logcache.WithEndTime(end),
+			logcache.WithLimit(availabilityPageSize),
+			logcache.WithEnvelopeTypes(logcache_v1.EnvelopeType_COUNTER, logcache_v1.EnvelopeType_GAUGE),
+			logcache.WithNameFilter("^"+regexp.QuoteMeta(metric)+"$"),
+		)
+		if err != nil {
+			return Availability{}, err
+		}
+		if len(envelopes) == 0 {
+			break
+		}
+
+		for _, e := range envelopes {
+			ts := e.GetTimestamp()
+			if ts < start.UnixNano() || ts >= end.UnixNano() || !isHeartbeat(e, metric) {
+				continue
+			}
+			received[(ts-start.UnixNano())/int64(interval)] = true
+		}
+
+		cursor = time.Unix(0, envelopes[len(envelopes)-1].GetTimestamp()+1)
+		if !cursor.Before(end) {
+			break
+		}
+	}
+
+	return Availability{
+		Received: len(received),
+		Expected: expected,
+	}, nil
+}
+
+func isHeartbeat(e *loggregator_v2.Envelope, metric string) bool {
+	if e.GetCounter().GetName() == metric {
+		return true
+	}
+	_, ok := e.GetGauge().GetMetrics()[metric]
+
+	return ok
+}
@@ -0,0 +1,144 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+
+	logcache "code.cloudfoundry.org/go-log-cache/v3"
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	"code.cloudfoundry.org/log-cache/pkg/client"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("HeartbeatAvailability", func() {
+	var (
+		start time.Time
+		end   time.Time
+	)
+
+	BeforeEach(func() {
+		start = time.Unix(1000, 0)
+		end = start.Add(100 * time.Second)
+	})
+
+	It("returns the fraction of expected heartbeats that were received", func() {
+		var envelopes []*loggregator_v2.Envelope
+		for i := 0; i < 10; i++ {
+			// Leave a gap of three missed heartbeats
+			if i >= 4 && i < 7 {
+				continue
+			}
+			envelopes = append(envelopes, heartbeat(start.Add(time.Duration(i)*10*time.Second+time.Second), "heartbeat"))
+		}
+
+		a, err := client.HeartbeatAvailability(context.Background(), fakeReader(envelopes), "some-source-id", "heartbeat", 10*time.Second, start, end)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(a.Received).To(Equal(7))
+		Expect(a.Expected).To(Equal(10))
+		Expect(a.Fraction()).To(BeNumerically("~", 0.7))
+	})
+
+	It("counts duplicate heartbeats within an interval once", func() {
+		envelopes := []*loggregator_v2.Envelope{
+			heartbeat(start, "heartbeat"),
+			heartbeat(start.Add(time.Second), "heartbeat"),
+			heartbeat(start.Add(2*time.Second), "heartbeat"),
+		}
+
+		a, err := client.HeartbeatAvailability(context.Background(), fakeReader(envelopes), "some-source-id", "heartbeat", 10*time.Second, start, end)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(a.Received).To(Equal(1))
+		Expect(a.Fraction()).To(BeNumerically("~", 0.1))
+	})
+
+	It("ignores other metrics", func() {
+		envelopes := []*loggregator_v2.Envelope{
+			heartbeat(start, "heartbeat"),
+			heartbeat(start.Add(10*time.Second), "other"),
+		}
+
+		a, err := client.HeartbeatAvailability(context.Background(), fakeReader(envelopes), "some-source-id", "heartbeat", 10*time.Second, start, end)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(a.Received).To(Equal(1))
+	})
+
+	It("reads the window in pages", func() {
+		var envelopes []*loggregator_v2.Envelope
+		for i := 0; i < 2500; i++ {
+			envelopes = append(envelopes, heartbeat(start.Add(time.Duration(i)*time.Second), "heartbeat"))
+		}
+
+		a, err := client.HeartbeatAvailability(context.Background(), fakeReader(envelopes), "some-source-id", "heartbeat", time.Second, start, start.Add(2500*time.Second))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(a.Received).To(Equal(2500))
+		Expect(a.Fraction()).To(Equal(1.0))
+	})
+
+	It("rounds a partial last interval up", func() {
+		a, err := client.HeartbeatAvailability(context.Background(), fakeReader(nil), "some-source-id", "heartbeat", 30*time.Second, start, end)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(a.Expected).To(Equal(4))
+		Expect(a.Fraction()).To(Equal(0.0))
+	})
+
+	It("returns an error from the reader", func() {
+		r := func(context.Context, string, time.Time, ...logcache.ReadOption) ([]*loggregator_v2.Envelope, error) {
+			return nil, errors.New("some-error")
+		}
+
+		_, err := client.HeartbeatAvailability(context.Background(), r, "some-source-id", "heartbeat", time.Second, start, end)
+		Expect(err).To(MatchError("some-error"))
+	})
+
+	It("rejects an invalid interval or window", func() {
+		_, err := client.HeartbeatAvailability(context.Background(), fakeReader(nil), "some-source-id", "heartbeat", 0, start, end)
+		Expect(err).To(HaveOccurred())
+
+		_, err = client.HeartbeatAvailability(context.Background(), fakeReader(nil), "some-source-id", "heartbeat", time.Second, end, start)
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+func heartbeat(t time.Time, name string) *loggregator_v2.Envelope {
+	return &loggregator_v2.Envelope{
+		SourceId:  "some-source-id",
+		Timestamp: t.UnixNano(),
+		Message: &loggregator_v2.Envelope_Counter{
+			Counter: &loggregator_v2.Counter{Name: name, Total: 1},
+		},
+	}
+}
+
+// fakeReader serves envelopes, sorted by timestamp, honoring the start
+// time, end time and limit of each read.
+func fakeReader(envelopes []*loggregator_v2.Envelope) logcache.Reader {
+	return func(_ context.Context, _ string, start time.Time, opts ...logcache.ReadOption) ([]*loggregator_v2.Envelope, error) {
+		u := &url.URL{}
+		q := url.Values{}
+		for _, o := range opts {
+			o(u, q)
+		}
+		endTime, err := strconv.ParseInt(q.Get("end_time"), 10, 64)
+		Expect(err).ToNot(HaveOccurred())
+		limit, err := strconv.Atoi(q.Get("limit"))
+		Expect(err).ToNot(HaveOccurred())
+
+		var result []*loggregator_v2.Envelope
+		for _, e := range envelopes {
+			if e.GetTimestamp() < start.UnixNano() || e.GetTimestamp() >= endTime {
+				continue
+			}
+			if len(result) == limit {
+				break
+			}
+			result = append(result, e)
+		}
+
+		return result, nil
+	}
+}
@@ -0,0 +1,23 @@
+package client
+
+import (
+	"google.golang.org/grpc/metadata"
+)
+
+// BackpressureHeader is the gRPC header set on a Send response when the
+// store of the node that received it is pruning heavily. Envelopes written
+// while it is set are likely to be evicted soon after, so writers should
+// slow down or sample.
+const BackpressureHeader = "log-cache-backpressure"
+
+// Backpressure reports whether a Send response asked the writer to slow
+// down, from its header captured with grpc.Header.
+func Backpressure(header metadata.MD) bool {
+	for _, v := range header.Get(BackpressureHeader) {
+		if v == "true" {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,107 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	logcache "code.cloudfoundry.org/go-log-cache/v3"
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+)
+
+var (
+	// ErrInvalidAddr is returned by NewClient for an address that can not
+	// be used to reach Log Cache.
+	ErrInvalidAddr = errors.New("invalid Log Cache address")
+
+	// ErrInvalidSourceID is returned by Read for a source ID that can not
+	// be stored by Log Cache.
+	ErrInvalidSourceID = errors.New("invalid source ID")
+)
+
+// Client is a go-log-cache client that validates its address and the source
+// IDs it reads before making any request, so that misconfiguration surfaces
+// as a descriptive error instead of a failed request.
+type Client struct {
+	*logcache.Client
+}
+
+// NewClient validates addr and creates a new Client. addr is either a base
+// URL with an http or https scheme, or a host:port pair when the client is
+// configured with logcache.WithViaGRPC.
+func NewClient(addr string, opts ...logcache.ClientOption) (*Client, error) {
+	if err := ValidateAddr(addr); err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		Client: logcache.NewClient(addr, opts...),
+	}, nil
+}
+
+// Read validates the source ID and reads from Log Cache.
+func (c *Client) Read(ctx context.Context, sourceID string, start time.Time, opts ...logcache.ReadOption) ([]*loggregator_v2.Envelope, error) {
+	if err := ValidateSourceID(sourceID); err != nil {
+		return nil, err
+	}
+
+	return c.Client.Read(ctx, sourceID, start, opts...)
+}
+
+// ValidateAddr checks that addr is an http(s) URL with a host or a host:port
+// pair with a numeric port.
+func ValidateAddr(addr string) error {
+	if addr == "" {
+		return fmt.Errorf("%w: address is empty", ErrInvalidAddr)
+	}
+	if strings.IndexFunc(addr, unicode.IsSpace) >= 0 {
+		return fmt.Errorf("%w: %q contains whitespace", ErrInvalidAddr, addr)
+	}
+
+	if strings.Contains(addr, "://") {
+		u, err := url.Parse(addr)
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidAddr, err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return fmt.Errorf("%w: %q has scheme %q, expected http or https", ErrInvalidAddr, addr, u.Scheme)
+		}
+		if u.Host == "" {
+			return fmt.Errorf("%w: %q has no host", ErrInvalidAddr, addr)
+		}
+		return nil
+	}
+
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("%w: %q is neither a URL nor host:port", ErrInvalidAddr, addr)
+	}
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return fmt.Errorf("%w: %q has an invalid port %q", ErrInvalidAddr, addr, port)
+	}
+
+	return nil
+}
+
+// ValidateSourceID checks that sourceID is not empty and does not contain
+// whitespace or control characters. Anything else, including app GUIDs,
+// component names and slashes, is accepted.
+func ValidateSourceID(sourceID string) error {
+	if sourceID == "" {
+		return fmt.Errorf("%w: source ID is empty", ErrInvalidSourceID)
+	}
+
+	for _, r := range sourceID {
+		if unicode.IsSpace(r) || unicode.IsControl(r) {
+			return fmt.Errorf("%w: %q contains %q", ErrInvalidSourceID, sourceID, r)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,33 @@
+package client_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestClient(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Client Suite")
+}
+
+// newReadServer starts a Log Cache HTTP API that reports a modern version
+// and sends the query parameters of each read to the returned channel.
+func newReadServer() (*httptest.Server, <-chan url.Values) {
+	queries := make(chan url.Values, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v1/info" {
+			_, _ = w.Write([]byte(`{"version":"3.0.0"}`))
+			return
+		}
+		queries <- r.URL.Query()
+		_, _ = w.Write([]byte(`{}`))
+	}))
+
+	return server, queries
+}
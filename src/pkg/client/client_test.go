@@ -0,0 +1,91 @@
+package client_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+
+	"code.cloudfoundry.org/log-cache/pkg/client"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Client", func() {
+	var (
+		server   *httptest.Server
+		requests int64
+	)
+
+	BeforeEach(func() {
+		atomic.StoreInt64(&requests, 0)
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt64(&requests, 1)
+			if r.URL.Path == "/api/v1/info" {
+				fmt.Fprint(w, `{"version":"3.0.0"}`)
+				return
+			}
+			fmt.Fprint(w, `{"envelopes":{"batch":[]}}`)
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("reads from a valid address", func() {
+		c, err := client.NewClient(server.URL)
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = c.Read(context.Background(), "d3a2b9f0-4a2b-4c6f-9d1e-2f3a4b5c6d7e", time.Unix(0, 0))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(atomic.LoadInt64(&requests)).ToNot(BeZero())
+	})
+
+	DescribeTable("rejects a malformed address",
+		func(addr string) {
+			_, err := client.NewClient(addr)
+			Expect(err).To(MatchError(client.ErrInvalidAddr))
+		},
+		Entry("empty", ""),
+		Entry("no port", "-:-invalid"),
+		Entry("whitespace", "http://log cache"),
+		Entry("unknown scheme", "ftp://log-cache.example.com"),
+		Entry("no host", "https://"),
+		Entry("host only", "log-cache"),
+	)
+
+	DescribeTable("accepts a valid address",
+		func(addr string) {
+			_, err := client.NewClient(addr)
+			Expect(err).ToNot(HaveOccurred())
+		},
+		Entry("https URL", "https://log-cache.example.com"),
+		Entry("http URL with port", "http://localhost:8080"),
+		Entry("host and port", "localhost:8080"),
+		Entry("IPv6 host and port", "[::1]:8080"),
+	)
+
+	DescribeTable("rejects an invalid source ID before making a request",
+		func(sourceID string) {
+			c, err := client.NewClient(server.URL)
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = c.Read(context.Background(), sourceID, time.Unix(0, 0))
+			Expect(err).To(MatchError(client.ErrInvalidSourceID))
+			Expect(atomic.LoadInt64(&requests)).To(BeZero())
+		},
+		Entry("empty", ""),
+		Entry("whitespace", "some source"),
+		Entry("trailing newline", "some-source\n"),
+	)
+
+	It("accepts component source IDs", func() {
+		Expect(client.ValidateSourceID("doppler")).To(Succeed())
+		Expect(client.ValidateSourceID("log-cache_nozzle.0")).To(Succeed())
+		Expect(client.ValidateSourceID("some-source/id")).To(Succeed())
+	})
+})
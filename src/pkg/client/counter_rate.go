@@ -0,0 +1,42 @@
+package client
+
+import (
+	"context"
+
+	logcache "code.cloudfoundry.org/go-log-cache/v3"
+)
+
+const (
+	// CounterRateMetadata is the gRPC metadata key that makes a Read return
+	// the rate of counters instead of their totals. Each counter envelope is
+	// replaced by a gauge envelope with the per second rate of the counter
+	// since its previous envelope in the result, under the name of the
+	// counter and with the unit CounterRateUnit. Counter resets are taken
+	// into account. The first envelope of each counter has no previous
+	// envelope and is skipped, so a Read of n counter envelopes returns up
+	// to n-1 rates. Its value is "true" or "false". Via the gateway it is
+	// set with the counter_rate query parameter.
+	CounterRateMetadata = "log-cache-counter-rate"
+
+	// CounterRateParam is the gateway query parameter for
+	// CounterRateMetadata.
+	CounterRateParam = "counter_rate"
+
+	// CounterRateUnit is the unit of the gauge metrics holding counter
+	// rates.
+	CounterRateUnit = "per_second"
+)
+
+var counterRateOption = readParam{CounterRateParam, CounterRateMetadata}
+
+// WithCounterRate returns a ReadOption that reads the rate of counters
+// instead of their totals.
+func WithCounterRate() logcache.ReadOption {
+	return counterRateOption.set("true")
+}
+
+// AppendCounterRate returns a context that reads the rate of counters
+// instead of their totals.
+func AppendCounterRate(ctx context.Context) context.Context {
+	return counterRateOption.appendTo(ctx, "true")
+}
@@ -0,0 +1,54 @@
+package client
+
+import (
+	"context"
+
+	logcache "code.cloudfoundry.org/go-log-cache/v3"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// CursorTrailer is the gRPC trailer set on a Read response that
+	// returned as many envelopes as its limit. Its value is an opaque
+	// cursor for the position of the last envelope. Via the gateway it is
+	// returned as the Grpc-Trailer-Log-Cache-Cursor header.
+	CursorTrailer = "log-cache-cursor"
+
+	// CursorMetadata is the gRPC metadata key that makes a Read resume
+	// after the position of a cursor from a previous Read of the same
+	// source ID, start time, end time and order. Unlike advancing the start
+	// time, envelopes that share a timestamp are neither skipped nor
+	// returned twice. It cannot be combined with the limit per type, newest
+	// or include spilled options. Via the gateway it is set with the cursor
+	// query parameter.
+	CursorMetadata = "log-cache-cursor"
+
+	// CursorParam is the gateway query parameter for CursorMetadata.
+	CursorParam = "cursor"
+)
+
+var cursorOption = readParam{CursorParam, CursorMetadata}
+
+// WithCursor returns a ReadOption that resumes a Read after the given
+// cursor.
+func WithCursor(cursor string) logcache.ReadOption {
+	return cursorOption.set(cursor)
+}
+
+// AppendCursor returns a context that resumes a gRPC Read after the given
+// cursor.
+func AppendCursor(ctx context.Context, cursor string) context.Context {
+	return cursorOption.appendTo(ctx, cursor)
+}
+
+// NextCursor returns the cursor to read the next page with from the
+// trailer of a Read call, captured with grpc.Trailer. It returns false if
+// the Read returned the last page.
+func NextCursor(trailer metadata.MD) (string, bool) {
+	values := trailer.Get(CursorTrailer)
+	if len(values) == 0 {
+		return "", false
+	}
+
+	return values[0], true
+}
@@ -0,0 +1,20 @@
+package client_test
+
+import (
+	"code.cloudfoundry.org/log-cache/pkg/client"
+	"google.golang.org/grpc/metadata"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Cursor", func() {
+	It("returns the next cursor from a Read trailer", func() {
+		cursor, ok := client.NextCursor(metadata.Pairs(client.CursorTrailer, "some-cursor"))
+		Expect(ok).To(BeTrue())
+		Expect(cursor).To(Equal("some-cursor"))
+
+		_, ok = client.NextCursor(metadata.MD{})
+		Expect(ok).To(BeFalse())
+	})
+})
@@ -0,0 +1,49 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	logcache "code.cloudfoundry.org/go-log-cache/v3"
+)
+
+const (
+	// HasTagsMetadata is the gRPC metadata key that restricts a Read to
+	// envelopes that have every given tag, whatever its value. Each value is
+	// a comma separated list of tag names. Via the gateway it is set with the
+	// has_tags query parameter.
+	HasTagsMetadata = "log-cache-has-tags"
+
+	// HasTagsParam is the gateway query parameter for HasTagsMetadata.
+	HasTagsParam = "has_tags"
+)
+
+var hasTagsOption = readParam{HasTagsParam, HasTagsMetadata}
+
+// WithHasTags returns a ReadOption that only reads envelopes that have all
+// of the given tags.
+func WithHasTags(tags ...string) logcache.ReadOption {
+	return hasTagsOption.add(strings.Join(tags, ","))
+}
+
+// AppendHasTags returns a context that only reads envelopes that have all
+// of the given tags.
+func AppendHasTags(ctx context.Context, tags ...string) context.Context {
+	return hasTagsOption.appendTo(ctx, strings.Join(tags, ","))
+}
+
+// ParseHasTags returns the tag names in comma separated lists of tags.
+func ParseHasTags(values []string) ([]string, error) {
+	var tags []string
+	for _, v := range values {
+		for _, tag := range strings.Split(v, ",") {
+			if tag == "" {
+				return nil, fmt.Errorf("has tags %q must not contain an empty tag name", v)
+			}
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags, nil
+}
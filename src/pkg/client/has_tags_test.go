@@ -0,0 +1,25 @@
+package client_test
+
+import (
+	"code.cloudfoundry.org/log-cache/pkg/client"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Has tags", func() {
+	It("parses lists of tags", func() {
+		tags, err := client.ParseHasTags([]string{"trace_id,span_id", "job"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(tags).To(Equal([]string{"trace_id", "span_id", "job"}))
+	})
+
+	DescribeTable("rejects empty tag names", func(value string) {
+		_, err := client.ParseHasTags([]string{value})
+		Expect(err).To(HaveOccurred())
+	},
+		Entry("empty value", ""),
+		Entry("trailing comma", "trace_id,"),
+		Entry("empty element", "trace_id,,span_id"),
+	)
+})
@@ -0,0 +1,34 @@
+package client
+
+import (
+	"context"
+
+	logcache "code.cloudfoundry.org/go-log-cache/v3"
+)
+
+const (
+	// IncludeSpilledMetadata is the gRPC metadata key that makes a Read
+	// return envelopes that were pruned from memory to the disk spillover,
+	// if the node has one, along with the envelopes in memory. Reading
+	// spilled envelopes is slower because they are read from disk. Its
+	// value is "true" or "false". Via the gateway it is set with the
+	// include_spilled query parameter.
+	IncludeSpilledMetadata = "log-cache-include-spilled"
+
+	// IncludeSpilledParam is the gateway query parameter for
+	// IncludeSpilledMetadata.
+	IncludeSpilledParam = "include_spilled"
+)
+
+var includeSpilledOption = readParam{IncludeSpilledParam, IncludeSpilledMetadata}
+
+// WithIncludeSpilled returns a ReadOption that reads spilled envelopes
+// too.
+func WithIncludeSpilled() logcache.ReadOption {
+	return includeSpilledOption.set("true")
+}
+
+// AppendIncludeSpilled returns a context that reads spilled envelopes too.
+func AppendIncludeSpilled(ctx context.Context) context.Context {
+	return includeSpilledOption.appendTo(ctx, "true")
+}
@@ -0,0 +1,31 @@
+package client
+
+import (
+	"strconv"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// IncompletePeersTrailer is the gRPC trailer set on a Read or Meta response
+// that had to gather data from several nodes when some of them did not
+// respond within the peer operation timeout. The response only holds the
+// data of the other nodes. Its values are the indexes of the nodes that
+// did not respond. Via the gateway it is returned as the
+// Grpc-Trailer-Log-Cache-Incomplete-Peers header.
+const IncompletePeersTrailer = "log-cache-incomplete-peers"
+
+// IncompletePeers returns the indexes of the nodes missing from a Read or
+// Meta response, from its trailer captured with grpc.Trailer. It returns
+// nil if the response is complete.
+func IncompletePeers(trailer metadata.MD) []int {
+	var peers []int
+	for _, v := range trailer.Get(IncompletePeersTrailer) {
+		i, err := strconv.Atoi(v)
+		if err != nil {
+			continue
+		}
+		peers = append(peers, i)
+	}
+
+	return peers
+}
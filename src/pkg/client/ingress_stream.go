@@ -0,0 +1,66 @@
+package client
+
+import (
+	"context"
+
+	rpc "code.cloudfoundry.org/go-log-cache/v3/rpc/logcache_v1"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// SendStreamMethod is the full method name of the streaming ingress RPC.
+const SendStreamMethod = "/logcache.v1.Ingress/SendStream"
+
+// SendStreamDesc describes the streaming ingress RPC. The client sends
+// batches and the server replies with acknowledgements.
+var SendStreamDesc = grpc.StreamDesc{
+	StreamName:    "SendStream",
+	ClientStreams: true,
+	ServerStreams: true,
+}
+
+// IngressStreamClient opens streams to write many batches to Log Cache over
+// a single RPC. Nodes that predate SendStream reply with codes.Unimplemented.
+type IngressStreamClient struct {
+	conn grpc.ClientConnInterface
+}
+
+// NewIngressStreamClient creates a new IngressStreamClient.
+func NewIngressStreamClient(conn grpc.ClientConnInterface) *IngressStreamClient {
+	return &IngressStreamClient{
+		conn: conn,
+	}
+}
+
+// SendStream opens a new stream. The stream is closed when the given
+// context is cancelled.
+func (c *IngressStreamClient) SendStream(ctx context.Context, opts ...grpc.CallOption) (*IngressSendStream, error) {
+	s, err := c.conn.NewStream(ctx, &SendStreamDesc, SendStreamMethod, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &IngressSendStream{ClientStream: s}, nil
+}
+
+// IngressSendStream is an open SendStream.
+type IngressSendStream struct {
+	grpc.ClientStream
+}
+
+// Send writes a batch to the stream. It does not wait for the batch to be
+// acknowledged.
+func (s *IngressSendStream) Send(req *rpc.SendRequest) error {
+	return s.SendMsg(req)
+}
+
+// Recv blocks until the server acknowledges written batches. It returns the
+// total number of batches written on this stream so far.
+func (s *IngressSendStream) Recv() (int64, error) {
+	ack := &wrapperspb.Int64Value{}
+	if err := s.RecvMsg(ack); err != nil {
+		return 0, err
+	}
+
+	return ack.GetValue(), nil
+}
@@ -0,0 +1,36 @@
+package client
+
+import (
+	"context"
+
+	logcache "code.cloudfoundry.org/go-log-cache/v3"
+)
+
+const (
+	// LatestPerSeriesMetadata is the gRPC metadata key that makes a Read
+	// return only the newest envelope in the time range of each series, up
+	// to the limit of series. A series is the envelopes that share a type,
+	// metric names, instance ID and tags. It cannot be combined with the
+	// limit per type, counter rate or cursor options. Its value is "true" or
+	// "false". Via the gateway it is set with the latest_per_series query
+	// parameter.
+	LatestPerSeriesMetadata = "log-cache-latest-per-series"
+
+	// LatestPerSeriesParam is the gateway query parameter for
+	// LatestPerSeriesMetadata.
+	LatestPerSeriesParam = "latest_per_series"
+)
+
+var latestPerSeriesOption = readParam{LatestPerSeriesParam, LatestPerSeriesMetadata}
+
+// WithLatestPerSeries returns a ReadOption that reads only the newest
+// envelope of each series.
+func WithLatestPerSeries() logcache.ReadOption {
+	return latestPerSeriesOption.set("true")
+}
+
+// AppendLatestPerSeries returns a context that reads only the newest
+// envelope of each series.
+func AppendLatestPerSeries(ctx context.Context) context.Context {
+	return latestPerSeriesOption.appendTo(ctx, "true")
+}
@@ -0,0 +1,33 @@
+package client
+
+import (
+	"context"
+
+	logcache "code.cloudfoundry.org/go-log-cache/v3"
+)
+
+const (
+	// LimitPerTypeMetadata is the gRPC metadata key that applies the limit
+	// of a Read to each requested envelope type instead of to the combined
+	// result, e.g. up to limit logs and up to limit counters. Its value is
+	// "true" or "false". It has no effect unless envelope types are given.
+	// Via the gateway it is set with the limit_per_type query parameter.
+	LimitPerTypeMetadata = "log-cache-limit-per-type"
+
+	// LimitPerTypeParam is the gateway query parameter for LimitPerTypeMetadata.
+	LimitPerTypeParam = "limit_per_type"
+)
+
+var limitPerTypeOption = readParam{LimitPerTypeParam, LimitPerTypeMetadata}
+
+// WithLimitPerType returns a ReadOption that applies the limit to each
+// requested envelope type.
+func WithLimitPerType() logcache.ReadOption {
+	return limitPerTypeOption.set("true")
+}
+
+// AppendLimitPerType returns a context that applies the limit to each
+// requested envelope type.
+func AppendLimitPerType(ctx context.Context) context.Context {
+	return limitPerTypeOption.appendTo(ctx, "true")
+}
@@ -0,0 +1,34 @@
+package client
+
+import (
+	"context"
+
+	logcache "code.cloudfoundry.org/go-log-cache/v3"
+)
+
+const (
+	// MatchExactMetadata is the gRPC metadata key that makes the name
+	// filter of a Read match whole metric names, like a PromQL __name__
+	// matcher, instead of any part of them. Without it a name filter of
+	// "cpu" also matches "cpu_total". The name filter is still a regular
+	// expression. Its value is "true" or "false". Via the gateway it is set
+	// with the match_exact query parameter.
+	MatchExactMetadata = "log-cache-match-exact"
+
+	// MatchExactParam is the gateway query parameter for MatchExactMetadata.
+	MatchExactParam = "match_exact"
+)
+
+var matchExactOption = readParam{MatchExactParam, MatchExactMetadata}
+
+// WithMatchExact returns a ReadOption that makes the name filter match
+// whole metric names.
+func WithMatchExact() logcache.ReadOption {
+	return matchExactOption.set("true")
+}
+
+// AppendMatchExact returns a context that makes the name filter match
+// whole metric names.
+func AppendMatchExact(ctx context.Context) context.Context {
+	return matchExactOption.appendTo(ctx, "true")
+}
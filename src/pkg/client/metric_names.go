@@ -0,0 +1,69 @@
+package client
+
+import (
+	"context"
+	"time"
+
+	rpc "code.cloudfoundry.org/go-log-cache/v3/rpc/logcache_v1"
+	"google.golang.org/grpc"
+
+	"code.cloudfoundry.org/log-cache/pkg/rpc/logcachepb"
+)
+
+const (
+	// MetricNamesServiceName is the name of the Log Cache metric names gRPC
+	// service.
+	MetricNamesServiceName = "logcache.v1.MetricNames"
+
+	// MetricNamesMethod is the full method name of the metric names RPC.
+	MetricNamesMethod = "/" + MetricNamesServiceName + "/MetricNames"
+)
+
+// MetricName is the name of a counter, gauge metric or timer and the
+// timestamp, in nanoseconds, of the newest envelope it was seen in.
+type MetricName struct {
+	Name      string
+	Timestamp int64
+}
+
+// MetricNamesClient calls the Log Cache metric names gRPC service.
+type MetricNamesClient struct {
+	conn grpc.ClientConnInterface
+}
+
+// NewMetricNamesClient creates a new MetricNamesClient.
+func NewMetricNamesClient(conn grpc.ClientConnInterface) *MetricNamesClient {
+	return &MetricNamesClient{
+		conn: conn,
+	}
+}
+
+// MetricNames returns up to limit distinct names of the counters, gauge
+// metrics and timers stored for the source ID with a timestamp in
+// [start, end), most recently seen first. A zero end looks at everything
+// up to now and a zero limit returns up to 100 names.
+func (c *MetricNamesClient) MetricNames(ctx context.Context, sourceID string, start, end time.Time, limit int, opts ...grpc.CallOption) ([]MetricName, error) {
+	req := &rpc.ReadRequest{
+		SourceId:  sourceID,
+		StartTime: start.UnixNano(),
+		Limit:     int64(limit),
+	}
+	if !end.IsZero() {
+		req.EndTime = end.UnixNano()
+	}
+
+	resp := &logcachepb.MetricNamesResponse{}
+	if err := c.conn.Invoke(ctx, MetricNamesMethod, req, resp, opts...); err != nil {
+		return nil, err
+	}
+
+	names := make([]MetricName, 0, len(resp.GetNames()))
+	for _, n := range resp.GetNames() {
+		names = append(names, MetricName{
+			Name:      n.GetName(),
+			Timestamp: n.GetTimestamp(),
+		})
+	}
+
+	return names, nil
+}
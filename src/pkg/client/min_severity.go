@@ -0,0 +1,43 @@
+package client
+
+import (
+	"context"
+
+	logcache "code.cloudfoundry.org/go-log-cache/v3"
+
+	"code.cloudfoundry.org/log-cache/internal/severity"
+)
+
+const (
+	// MinSeverityMetadata is the gRPC metadata key that restricts a Read to
+	// events with at least the given severity, e.g. "warning". The severity
+	// of an event is read from its severity tag, see ParseSeverity. All
+	// other envelopes, and events without a known severity, are skipped.
+	// Via the gateway it is set with the min_severity query parameter.
+	MinSeverityMetadata = "log-cache-min-severity"
+
+	// MinSeverityParam is the gateway query parameter for the minimum
+	// event severity.
+	MinSeverityParam = "min_severity"
+)
+
+var minSeverityOption = readParam{MinSeverityParam, MinSeverityMetadata}
+
+// WithMinSeverity returns a ReadOption that only reads events with at
+// least the given severity.
+func WithMinSeverity(severity string) logcache.ReadOption {
+	return minSeverityOption.set(severity)
+}
+
+// AppendMinSeverity returns a context that only reads events with at least
+// the given severity.
+func AppendMinSeverity(ctx context.Context, severity string) context.Context {
+	return minSeverityOption.appendTo(ctx, severity)
+}
+
+// ParseSeverity returns the level of an event severity. Levels increase
+// from debug, info, warning (or warn) and error to critical (or fatal).
+// Severities are case insensitive.
+func ParseSeverity(s string) (int, error) {
+	return severity.Parse(s)
+}
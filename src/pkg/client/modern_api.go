@@ -0,0 +1,55 @@
+package client
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	logcache "code.cloudfoundry.org/go-log-cache/v3"
+)
+
+const infoPath = "/api/v1/info"
+
+// WithAssumeModernAPI returns a ClientOption for clients that talk to a Log
+// Cache known to serve the /api/v1 endpoints. The go-log-cache client
+// normally requests /api/v1/info before its first Read or Meta to pick the
+// API path; with this option the probe is answered locally, so only the
+// actual request is sent. It replaces any HTTP client configured with
+// WithHTTPClient; use AssumeModernAPI to wrap a custom HTTP client instead.
+func WithAssumeModernAPI() logcache.ClientOption {
+	return logcache.WithHTTPClient(AssumeModernAPI(&http.Client{
+		Timeout: 5 * time.Second,
+	}))
+}
+
+// AssumeModernAPI wraps h so that requests for /api/v1/info are answered
+// locally with the first version serving /api/v1. Any other request is
+// passed to h. As a result LogCacheVersion no longer reports the real
+// version and LogCacheVMUptime returns an error.
+func AssumeModernAPI(h logcache.HTTPClient) logcache.HTTPClient {
+	return modernAPIClient{h: h}
+}
+
+type modernAPIClient struct {
+	h logcache.HTTPClient
+}
+
+func (c modernAPIClient) Do(req *http.Request) (*http.Response, error) {
+	if req.URL.Path != infoPath {
+		return c.h.Do(req)
+	}
+
+	body := `{"version":"` + logcache.FIRST_LOG_CACHE_VERSION_AFTER_API_MOVE.String() + `"}`
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
@@ -0,0 +1,86 @@
+package client_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	logcache "code.cloudfoundry.org/go-log-cache/v3"
+	"code.cloudfoundry.org/log-cache/pkg/client"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("AssumeModernAPI", func() {
+	var (
+		server *httptest.Server
+
+		mu    sync.Mutex
+		paths []string
+	)
+
+	requestedPaths := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), paths...)
+	}
+
+	BeforeEach(func() {
+		paths = nil
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			paths = append(paths, r.URL.Path)
+			mu.Unlock()
+
+			switch r.URL.Path {
+			case "/api/v1/info":
+				fmt.Fprint(w, `{"version":"3.0.0"}`)
+			case "/api/v1/meta":
+				fmt.Fprint(w, `{"meta":{"some-source-id":{"count":"1"}}}`)
+			default:
+				fmt.Fprint(w, `{"envelopes":{"batch":[]}}`)
+			}
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("probes /api/v1/info without the option", func() {
+		c := logcache.NewClient(server.URL)
+
+		_, err := c.Read(context.Background(), "some-source-id", time.Unix(0, 0))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(requestedPaths()).To(Equal([]string{"/api/v1/info", "/api/v1/read/some-source-id"}))
+	})
+
+	It("makes a single request for a Read", func() {
+		c := logcache.NewClient(server.URL, client.WithAssumeModernAPI())
+
+		_, err := c.Read(context.Background(), "some-source-id", time.Unix(0, 0))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(requestedPaths()).To(Equal([]string{"/api/v1/read/some-source-id"}))
+	})
+
+	It("makes a single request for Meta", func() {
+		c := logcache.NewClient(server.URL, client.WithAssumeModernAPI())
+
+		meta, err := c.Meta(context.Background())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(meta).To(HaveKey("some-source-id"))
+		Expect(requestedPaths()).To(Equal([]string{"/api/v1/meta"}))
+	})
+
+	It("wraps a custom HTTP client", func() {
+		c := logcache.NewClient(server.URL, logcache.WithHTTPClient(client.AssumeModernAPI(http.DefaultClient)))
+
+		_, err := c.Read(context.Background(), "some-source-id", time.Unix(0, 0))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(requestedPaths()).To(Equal([]string{"/api/v1/read/some-source-id"}))
+	})
+})
@@ -0,0 +1,33 @@
+package client
+
+import (
+	"context"
+
+	logcache "code.cloudfoundry.org/go-log-cache/v3"
+)
+
+const (
+	// NewestMetadata is the gRPC metadata key that makes a Read return the
+	// newest envelopes in the time range, up to the limit, in ascending
+	// order. Without it an ascending Read returns the oldest envelopes. It
+	// cannot be combined with a descending Read. Its value is "true" or
+	// "false". Via the gateway it is set with the newest query parameter.
+	NewestMetadata = "log-cache-newest"
+
+	// NewestParam is the gateway query parameter for NewestMetadata.
+	NewestParam = "newest"
+)
+
+var newestOption = readParam{NewestParam, NewestMetadata}
+
+// WithNewest returns a ReadOption that reads the newest envelopes in
+// ascending order.
+func WithNewest() logcache.ReadOption {
+	return newestOption.set("true")
+}
+
+// AppendNewest returns a context that reads the newest envelopes in
+// ascending order.
+func AppendNewest(ctx context.Context) context.Context {
+	return newestOption.appendTo(ctx, "true")
+}
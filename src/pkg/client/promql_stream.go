@@ -0,0 +1,157 @@
+package client
+
+import (
+	"context"
+	"io"
+	"sort"
+
+	rpc "code.cloudfoundry.org/go-log-cache/v3/rpc/logcache_v1"
+	"google.golang.org/grpc"
+)
+
+// RangeQueryStreamMethod is the full method name of the streaming PromQL
+// range query RPC.
+const RangeQueryStreamMethod = "/logcache.v1.PromQLQuerier/RangeQueryStream"
+
+// RangeQueryStreamDesc describes the streaming PromQL range query RPC. The
+// client sends a single range query and the server replies with the result
+// of each consecutive sub-window of the range.
+var RangeQueryStreamDesc = grpc.StreamDesc{
+	StreamName:    "RangeQueryStream",
+	ServerStreams: true,
+}
+
+// PromQLStreamClient runs PromQL range queries whose results are streamed
+// in chunks, so that neither side holds the whole matrix of a very large
+// range at once. Nodes that predate RangeQueryStream reply with
+// codes.Unimplemented.
+type PromQLStreamClient struct {
+	conn grpc.ClientConnInterface
+}
+
+// NewPromQLStreamClient creates a new PromQLStreamClient.
+func NewPromQLStreamClient(conn grpc.ClientConnInterface) *PromQLStreamClient {
+	return &PromQLStreamClient{
+		conn: conn,
+	}
+}
+
+// StreamRangeQuery runs the range query and calls visit with the matrix of
+// each sub-window, in order. It stops early when visit returns false.
+func (c *PromQLStreamClient) StreamRangeQuery(
+	ctx context.Context,
+	req *rpc.PromQL_RangeQueryRequest,
+	visit func(*rpc.PromQL_Matrix) bool,
+	opts ...grpc.CallOption,
+) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	s, err := c.conn.NewStream(ctx, &RangeQueryStreamDesc, RangeQueryStreamMethod, opts...)
+	if err != nil {
+		return err
+	}
+	if err := s.SendMsg(req); err != nil {
+		return err
+	}
+	if err := s.CloseSend(); err != nil {
+		return err
+	}
+
+	for {
+		chunk := &rpc.PromQL_RangeQueryResult{}
+		err := s.RecvMsg(chunk)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if !visit(chunk.GetMatrix()) {
+			return nil
+		}
+	}
+}
+
+// RangeQuery runs the range query over a stream and reassembles the chunks
+// into a single result, the same as a PromQL range query would return.
+func (c *PromQLStreamClient) RangeQuery(
+	ctx context.Context,
+	req *rpc.PromQL_RangeQueryRequest,
+	opts ...grpc.CallOption,
+) (*rpc.PromQL_RangeQueryResult, error) {
+	var (
+		series []*rpc.PromQL_Series
+		byKey  = make(map[string]*rpc.PromQL_Series)
+	)
+	err := c.StreamRangeQuery(ctx, req, func(m *rpc.PromQL_Matrix) bool {
+		for _, s := range m.GetSeries() {
+			key := metricKey(s.GetMetric())
+			if existing, ok := byKey[key]; ok {
+				existing.Points = append(existing.Points, s.GetPoints()...)
+				continue
+			}
+
+			byKey[key] = s
+			series = append(series, s)
+		}
+		return true
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(series, func(i, j int) bool {
+		return compareMetrics(series[i].GetMetric(), series[j].GetMetric()) < 0
+	})
+
+	return &rpc.PromQL_RangeQueryResult{
+		Result: &rpc.PromQL_RangeQueryResult_Matrix{
+			Matrix: &rpc.PromQL_Matrix{
+				Series: series,
+			},
+		},
+	}, nil
+}
+
+func sortedLabelNames(metric map[string]string) []string {
+	names := make([]string, 0, len(metric))
+	for n := range metric {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func metricKey(metric map[string]string) string {
+	var key string
+	for _, n := range sortedLabelNames(metric) {
+		key += n + "\xff" + metric[n] + "\xff"
+	}
+
+	return key
+}
+
+// compareMetrics orders label sets the same way Prometheus orders series:
+// label by label in name order, then by the number of labels.
+func compareMetrics(a, b map[string]string) int {
+	an, bn := sortedLabelNames(a), sortedLabelNames(b)
+	for i := 0; i < len(an) && i < len(bn); i++ {
+		if an[i] != bn[i] {
+			if an[i] < bn[i] {
+				return -1
+			}
+			return 1
+		}
+		if a[an[i]] != b[bn[i]] {
+			if a[an[i]] < b[bn[i]] {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	return len(an) - len(bn)
+}
@@ -0,0 +1,71 @@
+package client
+
+import (
+	"context"
+	"net/url"
+
+	logcache "code.cloudfoundry.org/go-log-cache/v3"
+	"google.golang.org/grpc/metadata"
+)
+
+// readParam is a Read option that the ReadRequest has no field for. The
+// ReadRequest message is defined by go-log-cache, which this module vendors
+// and cannot change, so these options travel as gRPC metadata until
+// go-log-cache adds fields for them. Over HTTP an option is sent as the
+// query parameter param, which the gateway moves into the gRPC metadata key
+// md of the Read. The ReadOption of a readParam therefore only applies to
+// reads over HTTP; clients created with WithViaGRPC append the metadata to
+// the context of the Read instead.
+type readParam struct {
+	param string
+	md    string
+}
+
+// readParams are the Read options that the gateway moves into gRPC
+// metadata. A new Read option only needs an entry here.
+var readParams = []readParam{
+	tagFilterOption,
+	hasTagsOption,
+	unitFilterOption,
+	limitPerTypeOption,
+	minSeverityOption,
+	counterRateOption,
+	newestOption,
+	latestPerSeriesOption,
+	includeSpilledOption,
+	rebaseToOption,
+	matchExactOption,
+	cursorOption,
+}
+
+// ReadParamMetadata returns the gRPC metadata key of each Read query
+// parameter.
+func ReadParamMetadata() map[string]string {
+	m := make(map[string]string, len(readParams))
+	for _, p := range readParams {
+		m[p.param] = p.md
+	}
+
+	return m
+}
+
+// set returns a ReadOption that sets the query parameter to value.
+func (p readParam) set(value string) logcache.ReadOption {
+	return func(u *url.URL, q url.Values) {
+		q.Set(p.param, value)
+	}
+}
+
+// add returns a ReadOption that adds value to the query parameter, for
+// options that may be given more than once.
+func (p readParam) add(value string) logcache.ReadOption {
+	return func(u *url.URL, q url.Values) {
+		q.Add(p.param, value)
+	}
+}
+
+// appendTo returns a context that sets the metadata to value for a gRPC
+// Read.
+func (p readParam) appendTo(ctx context.Context, value string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, p.md, value)
+}
@@ -0,0 +1,72 @@
+package client_test
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	logcache "code.cloudfoundry.org/go-log-cache/v3"
+	"code.cloudfoundry.org/log-cache/pkg/client"
+	"google.golang.org/grpc/metadata"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Read options", func() {
+	DescribeTable("adds the option to an HTTP read", func(opt logcache.ReadOption, param, value string) {
+		server, queries := newReadServer()
+		defer server.Close()
+
+		_, err := logcache.NewClient(server.URL).Read(
+			context.Background(),
+			"some-source-id",
+			time.Unix(0, 0),
+			opt,
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		var q url.Values
+		Eventually(queries).Should(Receive(&q))
+		Expect(q[param]).To(ConsistOf(value))
+	},
+		Entry("tag filter", client.WithTagFilter("deployment", "^cf$"), "tag_filter", "deployment:^cf$"),
+		Entry("has tags", client.WithHasTags("trace_id", "span_id"), "has_tags", "trace_id,span_id"),
+		Entry("unit filter", client.WithUnitFilter("bytes"), "unit_filter", "bytes"),
+		Entry("min severity", client.WithMinSeverity("error"), "min_severity", "error"),
+		Entry("counter rate", client.WithCounterRate(), "counter_rate", "true"),
+		Entry("include spilled", client.WithIncludeSpilled(), "include_spilled", "true"),
+		Entry("match exact", client.WithMatchExact(), "match_exact", "true"),
+		Entry("cursor", client.WithCursor("some-cursor"), "cursor", "some-cursor"),
+		Entry("limit per type", client.WithLimitPerType(), "limit_per_type", "true"),
+		Entry("newest", client.WithNewest(), "newest", "true"),
+		Entry("latest per series", client.WithLatestPerSeries(), "latest_per_series", "true"),
+		Entry("rebase to", client.WithRebaseTo("reference-source-id"), "rebase_to", "reference-source-id"),
+	)
+
+	DescribeTable("adds the option to the outgoing gRPC metadata", func(ctx context.Context, key, value string) {
+		md, ok := metadata.FromOutgoingContext(ctx)
+		Expect(ok).To(BeTrue())
+		Expect(md.Get(key)).To(ConsistOf(value))
+	},
+		Entry("tag filter", client.AppendTagFilter(context.Background(), "deployment", "^cf$"), client.TagFilterMetadata, "deployment:^cf$"),
+		Entry("has tags", client.AppendHasTags(context.Background(), "trace_id", "span_id"), client.HasTagsMetadata, "trace_id,span_id"),
+		Entry("unit filter", client.AppendUnitFilter(context.Background(), "bytes"), client.UnitFilterMetadata, "bytes"),
+		Entry("min severity", client.AppendMinSeverity(context.Background(), "error"), client.MinSeverityMetadata, "error"),
+		Entry("counter rate", client.AppendCounterRate(context.Background()), client.CounterRateMetadata, "true"),
+		Entry("include spilled", client.AppendIncludeSpilled(context.Background()), client.IncludeSpilledMetadata, "true"),
+		Entry("match exact", client.AppendMatchExact(context.Background()), client.MatchExactMetadata, "true"),
+		Entry("cursor", client.AppendCursor(context.Background(), "some-cursor"), client.CursorMetadata, "some-cursor"),
+		Entry("limit per type", client.AppendLimitPerType(context.Background()), client.LimitPerTypeMetadata, "true"),
+		Entry("newest", client.AppendNewest(context.Background()), client.NewestMetadata, "true"),
+		Entry("latest per series", client.AppendLatestPerSeries(context.Background()), client.LatestPerSeriesMetadata, "true"),
+		Entry("rebase to", client.AppendRebaseTo(context.Background(), "reference-source-id"), client.RebaseToMetadata, "reference-source-id"),
+	)
+
+	It("maps each query parameter to its metadata key", func() {
+		params := client.ReadParamMetadata()
+		Expect(params).To(HaveLen(12))
+		Expect(params).To(HaveKeyWithValue(client.TagFilterParam, client.TagFilterMetadata))
+		Expect(params).To(HaveKeyWithValue(client.CursorParam, client.CursorMetadata))
+	})
+})
@@ -0,0 +1,36 @@
+package client
+
+import (
+	"context"
+
+	logcache "code.cloudfoundry.org/go-log-cache/v3"
+)
+
+const (
+	// RebaseToMetadata is the gRPC metadata key that makes a Read shift the
+	// timestamps of the returned envelopes by the difference between the
+	// newest timestamp of a reference source ID and that of the read
+	// source ID. Reads of sources whose clocks are skewed can then be
+	// aligned by rebasing them to the same reference. The start and end
+	// time of the Read still apply to the original timestamps. Its value is
+	// the reference source ID. Via the gateway it is set with the rebase_to
+	// query parameter.
+	RebaseToMetadata = "log-cache-rebase-to"
+
+	// RebaseToParam is the gateway query parameter for RebaseToMetadata.
+	RebaseToParam = "rebase_to"
+)
+
+var rebaseToOption = readParam{RebaseToParam, RebaseToMetadata}
+
+// WithRebaseTo returns a ReadOption that rebases the timestamps of the
+// returned envelopes to the clock of the reference source ID.
+func WithRebaseTo(sourceID string) logcache.ReadOption {
+	return rebaseToOption.set(sourceID)
+}
+
+// AppendRebaseTo returns a context that rebases the timestamps of the
+// returned envelopes to the clock of the reference source ID.
+func AppendRebaseTo(ctx context.Context, sourceID string) context.Context {
+	return rebaseToOption.appendTo(ctx, sourceID)
+}
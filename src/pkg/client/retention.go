@@ -0,0 +1,78 @@
+package client
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"code.cloudfoundry.org/go-log-cache/v3/rpc/logcache_v1"
+	"google.golang.org/grpc/metadata"
+)
+
+// OldestTimestampTrailer is the gRPC trailer set on a Read response when the
+// requested start time is before the oldest envelope Log Cache still holds
+// for the source ID. Its value is that oldest timestamp in nanoseconds. Via
+// the gateway it is returned as the Grpc-Trailer-Log-Cache-Oldest-Timestamp
+// header.
+const OldestTimestampTrailer = "log-cache-oldest-timestamp"
+
+// OldestTimestamp returns the oldest available timestamp from the trailer of
+// a Read call, captured with grpc.Trailer. It returns false if the result
+// was not limited by retention.
+func OldestTimestamp(trailer metadata.MD) (int64, bool) {
+	values := trailer.Get(OldestTimestampTrailer)
+	if len(values) == 0 {
+		return 0, false
+	}
+
+	t, err := strconv.ParseInt(values[0], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return t, true
+}
+
+// EffectiveRetentionParam is the query parameter of a Meta over HTTP that
+// adds an effective_retention_ms to each source ID, the milliseconds since
+// its oldest envelope. MetaInfo has no field for it, so clients that decode
+// Meta responses strictly, such as Client.Meta, must not set it.
+const EffectiveRetentionParam = "effective_retention"
+
+// EffectiveRetention returns how long Log Cache has held the oldest envelope
+// of a source ID at now. It is 0 for a source ID without envelopes.
+func EffectiveRetention(info *logcache_v1.MetaInfo, now time.Time) time.Duration {
+	oldest := info.GetOldestTimestamp()
+	if oldest <= 0 {
+		return 0
+	}
+
+	return max(now.Sub(time.Unix(0, oldest)), 0)
+}
+
+// AddEffectiveRetention adds the effective retention of each source ID in
+// resp to metaJSON, the JSON resp was marshaled to. Like the other 64 bit
+// integers of the JSON it is written as a string.
+func AddEffectiveRetention(metaJSON []byte, resp *logcache_v1.MetaResponse, now time.Time) ([]byte, error) {
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(metaJSON, &body); err != nil {
+		return nil, err
+	}
+	var meta map[string]map[string]json.RawMessage
+	if err := json.Unmarshal(body["meta"], &meta); err != nil {
+		return nil, err
+	}
+
+	for sourceID, info := range meta {
+		ms := EffectiveRetention(resp.GetMeta()[sourceID], now).Milliseconds()
+		info["effective_retention_ms"] = json.RawMessage(strconv.Quote(strconv.FormatInt(ms, 10)))
+	}
+
+	b, err := json.Marshal(meta)
+	if err != nil {
+		return nil, err
+	}
+	body["meta"] = b
+
+	return json.Marshal(body)
+}
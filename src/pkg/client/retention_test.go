@@ -0,0 +1,47 @@
+package client_test
+
+import (
+	"encoding/json"
+	"time"
+
+	"code.cloudfoundry.org/go-log-cache/v3/rpc/logcache_v1"
+	"code.cloudfoundry.org/log-cache/pkg/client"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Effective retention", func() {
+	now := time.Unix(1000, 0)
+
+	It("is the time since the oldest envelope", func() {
+		info := &logcache_v1.MetaInfo{OldestTimestamp: now.Add(-90 * time.Second).UnixNano()}
+		Expect(client.EffectiveRetention(info, now)).To(Equal(90 * time.Second))
+	})
+
+	It("is zero for a source ID without envelopes", func() {
+		Expect(client.EffectiveRetention(&logcache_v1.MetaInfo{}, now)).To(BeZero())
+		Expect(client.EffectiveRetention(nil, now)).To(BeZero())
+	})
+
+	It("adds the effective retention of each source ID to the JSON of a Meta", func() {
+		resp := &logcache_v1.MetaResponse{Meta: map[string]*logcache_v1.MetaInfo{
+			"a": {Count: 3, OldestTimestamp: now.Add(-time.Minute).UnixNano()},
+			"b": {},
+		}}
+		metaJSON, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(resp)
+		Expect(err).ToNot(HaveOccurred())
+
+		b, err := client.AddEffectiveRetention(metaJSON, resp, now)
+		Expect(err).ToNot(HaveOccurred())
+
+		var body struct {
+			Meta map[string]map[string]string `json:"meta"`
+		}
+		Expect(json.Unmarshal(b, &body)).To(Succeed())
+		Expect(body.Meta["a"]).To(HaveKeyWithValue("count", "3"))
+		Expect(body.Meta["a"]).To(HaveKeyWithValue("effective_retention_ms", "60000"))
+		Expect(body.Meta["b"]).To(HaveKeyWithValue("effective_retention_ms", "0"))
+	})
+})
@@ -0,0 +1,60 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	logcache "code.cloudfoundry.org/go-log-cache/v3"
+)
+
+const (
+	// TagFilterMetadata is the gRPC metadata key that restricts a Read to
+	// envelopes whose tags match. Each value has the form
+	// "<tag name>:<regular expression>" and every filter must match. Via the
+	// gateway it is set with the tag_filter query parameter.
+	TagFilterMetadata = "log-cache-tag-filter"
+
+	// TagFilterParam is the gateway query parameter for tag filters.
+	TagFilterParam = "tag_filter"
+)
+
+var tagFilterOption = readParam{TagFilterParam, TagFilterMetadata}
+
+// WithTagFilter returns a ReadOption that only reads envelopes with a tag
+// named tag whose value matches the regular expression pattern. It may be
+// given more than once.
+func WithTagFilter(tag, pattern string) logcache.ReadOption {
+	return tagFilterOption.add(tag + ":" + pattern)
+}
+
+// AppendTagFilter returns a context that only reads envelopes with a tag
+// named tag whose value matches the regular expression pattern.
+func AppendTagFilter(ctx context.Context, tag, pattern string) context.Context {
+	return tagFilterOption.appendTo(ctx, tag+":"+pattern)
+}
+
+// ParseTagFilters compiles tag filters of the form
+// "<tag name>:<regular expression>".
+func ParseTagFilters(filters []string) (map[string]*regexp.Regexp, error) {
+	if len(filters) == 0 {
+		return nil, nil
+	}
+
+	parsed := make(map[string]*regexp.Regexp, len(filters))
+	for _, f := range filters {
+		tag, pattern, ok := strings.Cut(f, ":")
+		if !ok || tag == "" {
+			return nil, fmt.Errorf("tag filter %q must be of the form <tag>:<regexp>", f)
+		}
+
+		r, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("tag filter for %q must be a valid regular expression: %s", tag, err)
+		}
+		parsed[tag] = r
+	}
+
+	return parsed, nil
+}
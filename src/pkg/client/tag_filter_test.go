@@ -0,0 +1,49 @@
+package client_test
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	logcache "code.cloudfoundry.org/go-log-cache/v3"
+	"code.cloudfoundry.org/log-cache/pkg/client"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Tag filters", func() {
+	It("adds every tag filter to an HTTP read", func() {
+		server, queries := newReadServer()
+		defer server.Close()
+
+		_, err := logcache.NewClient(server.URL).Read(
+			context.Background(),
+			"some-source-id",
+			time.Unix(0, 0),
+			client.WithTagFilter("deployment", "^cf$"),
+			client.WithTagFilter("job", "router|cell"),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		var q url.Values
+		Eventually(queries).Should(Receive(&q))
+		Expect(q["tag_filter"]).To(ConsistOf("deployment:^cf$", "job:router|cell"))
+	})
+
+	It("parses tag filters", func() {
+		filters, err := client.ParseTagFilters([]string{"deployment:^cf$", "url:https?://.*"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(filters).To(HaveLen(2))
+		Expect(filters["url"].MatchString("https://example.com")).To(BeTrue())
+	})
+
+	DescribeTable("rejects malformed tag filters", func(filter string) {
+		_, err := client.ParseTagFilters([]string{filter})
+		Expect(err).To(HaveOccurred())
+	},
+		Entry("no separator", "deployment"),
+		Entry("no tag name", ":^cf$"),
+		Entry("invalid regexp", "deployment:["),
+	)
+})
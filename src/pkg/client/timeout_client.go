@@ -0,0 +1,109 @@
+package client
+
+import (
+	"context"
+	"time"
+
+	logcache "code.cloudfoundry.org/go-log-cache/v3"
+	"code.cloudfoundry.org/go-log-cache/v3/rpc/logcache_v1"
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+)
+
+// LogCacheClient is the subset of the go-log-cache client wrapped by
+// TimeoutClient.
+type LogCacheClient interface {
+	Read(ctx context.Context, sourceID string, start time.Time, opts ...logcache.ReadOption) ([]*loggregator_v2.Envelope, error)
+	Meta(ctx context.Context) (map[string]*logcache_v1.MetaInfo, error)
+	PromQL(ctx context.Context, query string, opts ...logcache.PromQLOption) (*logcache_v1.PromQL_InstantQueryResult, error)
+	PromQLRange(ctx context.Context, query string, opts ...logcache.PromQLOption) (*logcache_v1.PromQL_RangeQueryResult, error)
+}
+
+// TimeoutClient wraps a LogCacheClient and applies a separate deadline to
+// each kind of request, independent of any timeout on the underlying
+// transport.
+type TimeoutClient struct {
+	c LogCacheClient
+
+	readTimeout   time.Duration
+	metaTimeout   time.Duration
+	promQLTimeout time.Duration
+}
+
+// TimeoutOption configures a TimeoutClient.
+type TimeoutOption func(*TimeoutClient)
+
+// WithReadTimeout returns a TimeoutOption that bounds each Read. It defaults
+// to no timeout.
+func WithReadTimeout(d time.Duration) TimeoutOption {
+	return func(c *TimeoutClient) {
+		c.readTimeout = d
+	}
+}
+
+// WithMetaTimeout returns a TimeoutOption that bounds each Meta request. It
+// defaults to no timeout.
+func WithMetaTimeout(d time.Duration) TimeoutOption {
+	return func(c *TimeoutClient) {
+		c.metaTimeout = d
+	}
+}
+
+// WithPromQLTimeout returns a TimeoutOption that bounds each instant and
+// range PromQL query. It defaults to no timeout.
+func WithPromQLTimeout(d time.Duration) TimeoutOption {
+	return func(c *TimeoutClient) {
+		c.promQLTimeout = d
+	}
+}
+
+// NewTimeoutClient creates a new TimeoutClient.
+func NewTimeoutClient(c LogCacheClient, opts ...TimeoutOption) *TimeoutClient {
+	tc := &TimeoutClient{c: c}
+
+	for _, o := range opts {
+		o(tc)
+	}
+
+	return tc
+}
+
+// Read calls Read on the wrapped client within the read timeout.
+func (c *TimeoutClient) Read(ctx context.Context, sourceID string, start time.Time, opts ...logcache.ReadOption) ([]*loggregator_v2.Envelope, error) {
+	ctx, cancel := withTimeout(ctx, c.readTimeout)
+	defer cancel()
+
+	return c.c.Read(ctx, sourceID, start, opts...)
+}
+
+// Meta calls Meta on the wrapped client within the meta timeout.
+func (c *TimeoutClient) Meta(ctx context.Context) (map[string]*logcache_v1.MetaInfo, error) {
+	ctx, cancel := withTimeout(ctx, c.metaTimeout)
+	defer cancel()
+
+	return c.c.Meta(ctx)
+}
+
+// PromQL calls PromQL on the wrapped client within the PromQL timeout.
+func (c *TimeoutClient) PromQL(ctx context.Context, query string, opts ...logcache.PromQLOption) (*logcache_v1.PromQL_InstantQueryResult, error) {
+	ctx, cancel := withTimeout(ctx, c.promQLTimeout)
+	defer cancel()
+
+	return c.c.PromQL(ctx, query, opts...)
+}
+
+// PromQLRange calls PromQLRange on the wrapped client within the PromQL
+// timeout.
+func (c *TimeoutClient) PromQLRange(ctx context.Context, query string, opts ...logcache.PromQLOption) (*logcache_v1.PromQL_RangeQueryResult, error) {
+	ctx, cancel := withTimeout(ctx, c.promQLTimeout)
+	defer cancel()
+
+	return c.c.PromQLRange(ctx, query, opts...)
+}
+
+func withTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, d)
+}
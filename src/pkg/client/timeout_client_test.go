@@ -0,0 +1,66 @@
+package client_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	logcache "code.cloudfoundry.org/go-log-cache/v3"
+	"code.cloudfoundry.org/log-cache/pkg/client"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("TimeoutClient", func() {
+	var (
+		server  *httptest.Server
+		release chan struct{}
+		c       *client.TimeoutClient
+	)
+
+	BeforeEach(func() {
+		release = make(chan struct{})
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/api/v1/info":
+				fmt.Fprint(w, `{"version":"3.0.0"}`)
+			case "/api/v1/meta":
+				time.Sleep(300 * time.Millisecond)
+				fmt.Fprint(w, `{"meta":{"some-source-id":{"count":"1"}}}`)
+			default:
+				select {
+				case <-release:
+				case <-r.Context().Done():
+				}
+				fmt.Fprint(w, `{}`)
+			}
+		}))
+
+		c = client.NewTimeoutClient(
+			logcache.NewClient(server.URL),
+			client.WithReadTimeout(100*time.Millisecond),
+			client.WithMetaTimeout(5*time.Second),
+		)
+	})
+
+	AfterEach(func() {
+		close(release)
+		server.Close()
+	})
+
+	It("cancels a blocking read after the read timeout", func() {
+		start := time.Now()
+		_, err := c.Read(context.Background(), "some-source-id", time.Unix(0, 0))
+		Expect(err).To(MatchError(ContainSubstring("context deadline exceeded")))
+		Expect(time.Since(start)).To(BeNumerically("<", 2*time.Second))
+	})
+
+	It("lets meta run longer than the read timeout", func() {
+		meta, err := c.Meta(context.Background())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(meta).To(HaveKey("some-source-id"))
+	})
+})
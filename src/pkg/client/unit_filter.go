@@ -0,0 +1,33 @@
+package client
+
+import (
+	"context"
+
+	logcache "code.cloudfoundry.org/go-log-cache/v3"
+)
+
+const (
+	// UnitFilterMetadata is the gRPC metadata key that restricts a Read to
+	// gauge metrics with the given unit, e.g. "bytes". Gauge metrics with a
+	// different unit are removed from each envelope and envelopes without
+	// matching metrics, including all non-gauge envelopes, are skipped. Via
+	// the gateway it is set with the unit_filter query parameter.
+	UnitFilterMetadata = "log-cache-unit-filter"
+
+	// UnitFilterParam is the gateway query parameter for the unit filter.
+	UnitFilterParam = "unit_filter"
+)
+
+var unitFilterOption = readParam{UnitFilterParam, UnitFilterMetadata}
+
+// WithUnitFilter returns a ReadOption that only reads gauge metrics with the
+// given unit.
+func WithUnitFilter(unit string) logcache.ReadOption {
+	return unitFilterOption.set(unit)
+}
+
+// AppendUnitFilter returns a context that only reads gauge metrics with the
+// given unit.
+func AppendUnitFilter(ctx context.Context, unit string) context.Context {
+	return unitFilterOption.appendTo(ctx, unit)
+}
@@ -0,0 +1,130 @@
+package client
+
+import (
+	"context"
+	"time"
+
+	logcache "code.cloudfoundry.org/go-log-cache/v3"
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+)
+
+// WalkOption configures Walk.
+type WalkOption func(c *walkConfig)
+
+type walkConfig struct {
+	prefetch int
+	opts     []logcache.WalkOption
+}
+
+// WithWalkPrefetch returns a WalkOption that reads up to n batches ahead
+// while the Visitor processes the current one, so that a walk over the
+// network does not wait for each read in turn. Batches are still visited
+// in order. Defaults to 0, which only reads a batch once the previous one
+// has been visited.
+func WithWalkPrefetch(n int) WalkOption {
+	return func(c *walkConfig) {
+		c.prefetch = n
+	}
+}
+
+// WithWalkOptions returns a WalkOption that passes the given options on to
+// logcache.Walk.
+func WithWalkOptions(opts ...logcache.WalkOption) WalkOption {
+	return func(c *walkConfig) {
+		c.opts = append(c.opts, opts...)
+	}
+}
+
+// Walk reads from Log Cache until the Visitor returns false, like
+// logcache.Walk, with the option to read ahead.
+func Walk(ctx context.Context, sourceID string, v logcache.Visitor, r logcache.Reader, opts ...WalkOption) {
+	c := &walkConfig{}
+	for _, o := range opts {
+		o(c)
+	}
+
+	if c.prefetch <= 0 {
+		logcache.Walk(ctx, sourceID, v, r, c.opts...)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	p := &prefetcher{r: r, n: c.prefetch}
+	logcache.Walk(ctx, sourceID, v, p.read, c.opts...)
+}
+
+// prefetcher is a logcache.Reader that, after each read, keeps reading the
+// batches that follow it in the background. Walk reads each batch from
+// right after the last envelope of the previous one, so the reads ahead
+// are what it asks for next unless it dropped envelopes from the end of a
+// batch. Reads ahead that turn out not to be needed are discarded.
+type prefetcher struct {
+	r logcache.Reader
+	n int
+
+	ahead  chan prefetched
+	cancel context.CancelFunc
+}
+
+type prefetched struct {
+	start int64
+	es    []*loggregator_v2.Envelope
+	err   error
+}
+
+func (p *prefetcher) read(ctx context.Context, sourceID string, start time.Time, opts ...logcache.ReadOption) ([]*loggregator_v2.Envelope, error) {
+	if p.ahead != nil {
+		b, ok := <-p.ahead
+		if ok && b.start == start.UnixNano() {
+			return b.es, b.err
+		}
+		p.stop()
+	}
+
+	es, err := p.r(ctx, sourceID, start, opts...)
+	if err == nil && len(es) > 0 {
+		p.readAhead(ctx, sourceID, nextStart(es), opts)
+	}
+
+	return es, err
+}
+
+// readAhead reads the batches from start on until a read fails or is
+// empty, keeping up to n of them that have not been asked for yet.
+func (p *prefetcher) readAhead(ctx context.Context, sourceID string, start int64, opts []logcache.ReadOption) {
+	ctx, p.cancel = context.WithCancel(ctx)
+	ahead := make(chan prefetched, p.n-1)
+	p.ahead = ahead
+
+	go func() {
+		defer close(ahead)
+
+		for {
+			es, err := p.r(ctx, sourceID, time.Unix(0, start), opts...)
+			select {
+			case ahead <- prefetched{start: start, es: es, err: err}:
+			case <-ctx.Done():
+				return
+			}
+
+			if err != nil || len(es) == 0 {
+				return
+			}
+			start = nextStart(es)
+		}
+	}()
+}
+
+func (p *prefetcher) stop() {
+	if p.cancel != nil {
+		p.cancel()
+	}
+	p.ahead = nil
+	p.cancel = nil
+}
+
+func nextStart(es []*loggregator_v2.Envelope) int64 {
+	return es[len(es)-1].GetTimestamp() + 1
+}
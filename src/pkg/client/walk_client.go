@@ -0,0 +1,82 @@
+package client
+
+import (
+	"context"
+
+	logcache "code.cloudfoundry.org/go-log-cache/v3"
+)
+
+// WalkClient runs Walks and Windows over a logcache.Reader and bounds how
+// many of them run at once, so that an application that starts many of
+// them does not open an unbounded number of read loops.
+type WalkClient struct {
+	r     logcache.Reader
+	slots chan struct{}
+}
+
+// WalkClientOption configures a WalkClient.
+type WalkClientOption func(*WalkClient)
+
+// WithMaxConcurrentWalks returns a WalkClientOption that lets at most n
+// Walks and Windows run at once. The others block until one of them
+// returns. It defaults to no limit.
+func WithMaxConcurrentWalks(n int) WalkClientOption {
+	return func(c *WalkClient) {
+		if n > 0 {
+			c.slots = make(chan struct{}, n)
+		}
+	}
+}
+
+// NewWalkClient creates a new WalkClient that reads with r.
+func NewWalkClient(r logcache.Reader, opts ...WalkClientOption) *WalkClient {
+	c := &WalkClient{r: r}
+
+	for _, o := range opts {
+		o(c)
+	}
+
+	return c
+}
+
+// Walk waits for a free slot and then walks the source ID like Walk. It
+// returns without walking if the context is done first.
+func (c *WalkClient) Walk(ctx context.Context, sourceID string, v logcache.Visitor, opts ...WalkOption) {
+	if !c.acquire(ctx) {
+		return
+	}
+	defer c.release()
+
+	Walk(ctx, sourceID, v, c.r, opts...)
+}
+
+// Window waits for a free slot and then runs logcache.Window over the
+// source ID. The slot is held until the Window returns. It returns without
+// running the Window if the context is done first.
+func (c *WalkClient) Window(ctx context.Context, sourceID string, v logcache.Visitor, opts ...logcache.WindowOption) {
+	if !c.acquire(ctx) {
+		return
+	}
+	defer c.release()
+
+	logcache.Window(ctx, v, logcache.BuildWalker(sourceID, c.r), opts...)
+}
+
+func (c *WalkClient) acquire(ctx context.Context) bool {
+	if c.slots == nil {
+		return true
+	}
+
+	select {
+	case c.slots <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (c *WalkClient) release() {
+	if c.slots != nil {
+		<-c.slots
+	}
+}
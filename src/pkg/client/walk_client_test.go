@@ -0,0 +1,88 @@
+package client_test
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	logcache "code.cloudfoundry.org/go-log-cache/v3"
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	"code.cloudfoundry.org/log-cache/pkg/client"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("WalkClient", func() {
+	var reads atomic.Int64
+
+	read := func(ctx context.Context, sourceID string, start time.Time, opts ...logcache.ReadOption) ([]*loggregator_v2.Envelope, error) {
+		reads.Add(1)
+		return []*loggregator_v2.Envelope{{Timestamp: 1}}, nil
+	}
+
+	BeforeEach(func() {
+		reads.Store(0)
+	})
+
+	// walk starts a Walk that visits one batch and then waits for done.
+	walk := func(c *client.WalkClient, ctx context.Context, done chan struct{}) chan struct{} {
+		finished := make(chan struct{})
+		go func() {
+			defer close(finished)
+			c.Walk(ctx, "some-source-id", func([]*loggregator_v2.Envelope) bool {
+				<-done
+				return false
+			})
+		}()
+
+		return finished
+	}
+
+	It("makes a walk beyond the maximum wait until another walk returns", func() {
+		c := client.NewWalkClient(read, client.WithMaxConcurrentWalks(2))
+
+		done := []chan struct{}{make(chan struct{}), make(chan struct{}), make(chan struct{})}
+		walk(c, context.Background(), done[0])
+		walk(c, context.Background(), done[1])
+		Eventually(reads.Load).Should(Equal(int64(2)))
+
+		third := walk(c, context.Background(), done[2])
+		Consistently(reads.Load, 100*time.Millisecond).Should(Equal(int64(2)))
+
+		close(done[0])
+		Eventually(reads.Load).Should(Equal(int64(3)))
+
+		close(done[1])
+		close(done[2])
+		Eventually(third).Should(BeClosed())
+	})
+
+	It("returns without walking when the context is done while waiting", func() {
+		c := client.NewWalkClient(read, client.WithMaxConcurrentWalks(1))
+
+		done := make(chan struct{})
+		defer close(done)
+		walk(c, context.Background(), done)
+		Eventually(reads.Load).Should(Equal(int64(1)))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		waiting := walk(c, ctx, done)
+		cancel()
+
+		Eventually(waiting).Should(BeClosed())
+		Expect(reads.Load()).To(Equal(int64(1)))
+	})
+
+	It("does not limit walks by default", func() {
+		c := client.NewWalkClient(read)
+
+		done := make(chan struct{})
+		defer close(done)
+		for i := 0; i < 5; i++ {
+			walk(c, context.Background(), done)
+		}
+
+		Eventually(reads.Load).Should(Equal(int64(5)))
+	})
+})
@@ -0,0 +1,102 @@
+package client_test
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	logcache "code.cloudfoundry.org/go-log-cache/v3"
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	"code.cloudfoundry.org/log-cache/pkg/client"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Walk", func() {
+	const delay = 50 * time.Millisecond
+
+	var reader *delayingReader
+
+	BeforeEach(func() {
+		reader = &delayingReader{delay: delay, batchSize: 2}
+		for i := int64(1); i <= 10; i++ {
+			reader.envelopes = append(reader.envelopes, &loggregator_v2.Envelope{Timestamp: i})
+		}
+	})
+
+	walk := func(opts ...client.WalkOption) ([]int64, time.Duration) {
+		var timestamps []int64
+		start := time.Now()
+		client.Walk(context.Background(), "some-source-id", func(es []*loggregator_v2.Envelope) bool {
+			time.Sleep(delay)
+			for _, e := range es {
+				timestamps = append(timestamps, e.GetTimestamp())
+			}
+			return true
+		}, reader.read, opts...)
+
+		return timestamps, time.Since(start)
+	}
+
+	It("walks every batch in order", func() {
+		timestamps, _ := walk()
+		Expect(timestamps).To(Equal([]int64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}))
+	})
+
+	It("reads ahead while the visitor processes a batch", func() {
+		_, sequential := walk()
+
+		timestamps, prefetched := walk(client.WithWalkPrefetch(2))
+		Expect(timestamps).To(Equal([]int64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}))
+		Expect(prefetched).To(BeNumerically("<", sequential*4/5))
+	})
+
+	It("passes options on to the walk", func() {
+		timestamps, _ := walk(
+			client.WithWalkPrefetch(1),
+			client.WithWalkOptions(logcache.WithWalkEndTime(time.Unix(0, 6))),
+		)
+		Expect(timestamps).To(Equal([]int64{1, 2, 3, 4, 5}))
+	})
+
+	It("stops when the visitor is done", func() {
+		var batches int
+		client.Walk(context.Background(), "some-source-id", func(es []*loggregator_v2.Envelope) bool {
+			batches++
+			return batches < 2
+		}, reader.read, client.WithWalkPrefetch(3))
+
+		Expect(batches).To(Equal(2))
+	})
+})
+
+// delayingReader serves batches of envelopes after a delay, like a read
+// over the network.
+type delayingReader struct {
+	delay     time.Duration
+	batchSize int
+
+	mu        sync.Mutex
+	envelopes []*loggregator_v2.Envelope
+}
+
+func (r *delayingReader) read(ctx context.Context, sourceID string, start time.Time, opts ...logcache.ReadOption) ([]*loggregator_v2.Envelope, error) {
+	select {
+	case <-time.After(r.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var batch []*loggregator_v2.Envelope
+	for _, e := range r.envelopes {
+		if e.GetTimestamp() >= start.UnixNano() && len(batch) < r.batchSize {
+			batch = append(batch, e)
+		}
+	}
+
+	return batch, nil
+}
@@ -11,15 +11,36 @@ import (
 )
 
 type PromqlMarshaler struct {
-	fallback runtime.Marshaler
+	fallback           runtime.Marshaler
+	timestampPrecision int
 }
 
-func NewPromqlMarshaler(fallback runtime.Marshaler) *PromqlMarshaler {
-	return &PromqlMarshaler{
-		fallback: fallback,
+// PromqlMarshalerOption configures a PromqlMarshaler.
+type PromqlMarshalerOption func(*PromqlMarshaler)
+
+// WithTimestampPrecision sets the number of decimal places used for
+// timestamps in scalar, vector and matrix results. Timestamps are always
+// JSON numbers; values are always strings. A negative precision uses the
+// fewest digits needed to represent the timestamp. It defaults to 3.
+func WithTimestampPrecision(digits int) PromqlMarshalerOption {
+	return func(m *PromqlMarshaler) {
+		m.timestampPrecision = digits
 	}
 }
 
+func NewPromqlMarshaler(fallback runtime.Marshaler, opts ...PromqlMarshalerOption) *PromqlMarshaler {
+	m := &PromqlMarshaler{
+		fallback:           fallback,
+		timestampPrecision: 3,
+	}
+
+	for _, o := range opts {
+		o(m)
+	}
+
+	return m
+}
+
 func (m *PromqlMarshaler) Marshal(v interface{}) ([]byte, error) {
 	switch q := v.(type) {
 	case *logcache_v1.PromQL_InstantQueryResult:
@@ -73,11 +94,16 @@ func (m *PromqlMarshaler) assembleInstantQueryResult(v *logcache_v1.PromQL_Insta
 
 	switch v.GetResult().(type) {
 	case *logcache_v1.PromQL_InstantQueryResult_Scalar:
-		data, err = assembleScalarResultData(v.GetScalar())
+		data, err = m.assembleScalarResultData(v.GetScalar())
 	case *logcache_v1.PromQL_InstantQueryResult_Vector:
-		data, err = assembleVectorResultData(v.GetVector())
+		data, err = m.assembleVectorResultData(v.GetVector())
 	case *logcache_v1.PromQL_InstantQueryResult_Matrix:
-		data, err = assembleMatrixResultData(v.GetMatrix())
+		data, err = m.assembleMatrixResultData(v.GetMatrix())
+	default:
+		// A result without a value matched no data. It is reported as an
+		// empty vector rather than with an empty resultType, which clients
+		// can not tell apart from a failure.
+		data, err = m.assembleVectorResultData(nil)
 	}
 
 	if err != nil {
@@ -96,7 +122,9 @@ func (m *PromqlMarshaler) assembleRangeQueryResult(v *logcache_v1.PromQL_RangeQu
 
 	switch v.GetResult().(type) {
 	case *logcache_v1.PromQL_RangeQueryResult_Matrix:
-		data, err = assembleMatrixResultData(v.GetMatrix())
+		data, err = m.assembleMatrixResultData(v.GetMatrix())
+	default:
+		data, err = m.assembleMatrixResultData(nil)
 	}
 
 	if err != nil {
@@ -109,8 +137,8 @@ func (m *PromqlMarshaler) assembleRangeQueryResult(v *logcache_v1.PromQL_RangeQu
 	}, nil
 }
 
-func assembleScalarResultData(v *logcache_v1.PromQL_Scalar) (resultData, error) {
-	point, err := assemblePoint(v.GetTime(), v.GetValue())
+func (m *PromqlMarshaler) assembleScalarResultData(v *logcache_v1.PromQL_Scalar) (resultData, error) {
+	point, err := m.assemblePoint(v.GetTime(), v.GetValue())
 	if err != nil {
 		return resultData{}, err
 	}
@@ -126,14 +154,14 @@ func assembleScalarResultData(v *logcache_v1.PromQL_Scalar) (resultData, error)
 	}, nil
 }
 
-func assembleVectorResultData(v *logcache_v1.PromQL_Vector) (resultData, error) {
+func (m *PromqlMarshaler) assembleVectorResultData(v *logcache_v1.PromQL_Vector) (resultData, error) {
 	// NOTE: This is required to make sure that JSON marshals an empty result
 	// set as `[]` and not `null`.
 	samples := make([]interface{}, 0)
 
 	for _, s := range v.GetSamples() {
 		p := s.GetPoint()
-		point, err := assemblePoint(p.GetTime(), p.GetValue())
+		point, err := m.assemblePoint(p.GetTime(), p.GetValue())
 		if err != nil {
 			return resultData{}, err
 		}
@@ -160,7 +188,7 @@ func assembleVectorResultData(v *logcache_v1.PromQL_Vector) (resultData, error)
 	}, nil
 }
 
-func assembleMatrixResultData(v *logcache_v1.PromQL_Matrix) (resultData, error) {
+func (m *PromqlMarshaler) assembleMatrixResultData(v *logcache_v1.PromQL_Matrix) (resultData, error) {
 	// NOTE: This is required to make sure that JSON marshals an empty result
 	// set as `[]` and not `null`.
 	result := make([]interface{}, 0)
@@ -168,7 +196,7 @@ func assembleMatrixResultData(v *logcache_v1.PromQL_Matrix) (resultData, error)
 	for _, s := range v.GetSeries() {
 		var values [][]interface{}
 		for _, p := range s.GetPoints() {
-			point, err := assemblePoint(p.GetTime(), p.GetValue())
+			point, err := m.assemblePoint(p.GetTime(), p.GetValue())
 			if err != nil {
 				return resultData{}, err
 			}
@@ -198,12 +226,12 @@ func assembleMatrixResultData(v *logcache_v1.PromQL_Matrix) (resultData, error)
 	}, nil
 }
 
-func assemblePoint(time string, value float64) ([]interface{}, error) {
+func (m *PromqlMarshaler) assemblePoint(time string, value float64) ([]interface{}, error) {
 	t, err := strconv.ParseFloat(time, 64)
 	if err != nil {
 		return nil, fmt.Errorf("couldn't parse float %s: %s", time, err.Error())
 	}
-	formattedTime := fmt.Sprintf("%.3f", t)
+	formattedTime := strconv.FormatFloat(t, 'f', m.timestampPrecision, 64)
 	return []interface{}{
 		json.RawMessage(formattedTime),
 		strconv.FormatFloat(value, 'f', -1, 64),
@@ -118,6 +118,21 @@ var _ = Describe("PromqlMarshaler", func() {
 			}`))
 		})
 
+		It("handles an instant query result without a value as an empty vector", func() {
+			marshaler := marshaler.NewPromqlMarshaler(&mockMarshaler{})
+
+			result, err := marshaler.Marshal(&logcache_v1.PromQL_InstantQueryResult{})
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result).To(MatchJSON(`{
+				"status": "success",
+				"data": {
+					"resultType": "vector",
+					"result": []
+				}
+			}`))
+		})
+
 		It("handles a vector instant query result with no tags", func() {
 			marshaler := marshaler.NewPromqlMarshaler(&mockMarshaler{})
 
@@ -207,8 +222,8 @@ var _ = Describe("PromqlMarshaler", func() {
 								"tag-name":   "tag-value"
 							},
 							"values": [
-								[ 1, "2.5" ],
-								[ 2, "3.5" ]
+								[ 1.000, "2.5" ],
+								[ 2.000, "3.5" ]
 							]
 						},
 						{
@@ -217,8 +232,8 @@ var _ = Describe("PromqlMarshaler", func() {
 								"tag-name2":   "tag-value2"
 							},
 							"values": [
-								[ 1, "4.5" ],
-								[ 2, "6.5" ]
+								[ 1.000, "4.5" ],
+								[ 2.000, "6.5" ]
 							]
 						}
 					]
@@ -281,8 +296,8 @@ var _ = Describe("PromqlMarshaler", func() {
 						{
 							"metric": {},
 							"values": [
-								[ 1, "2.5" ],
-								[ 2, "3.5" ]
+								[ 1.000, "2.5" ],
+								[ 2.000, "3.5" ]
 							]
 						}
 					]
@@ -346,8 +361,8 @@ var _ = Describe("PromqlMarshaler", func() {
 								"tag-name":   "tag-value"
 							},
 							"values": [
-								[ 1, "2.5" ],
-								[ 2, "3.5" ]
+								[ 1.000, "2.5" ],
+								[ 2.000, "3.5" ]
 							]
 						},
 						{
@@ -356,8 +371,8 @@ var _ = Describe("PromqlMarshaler", func() {
 								"tag-name2":   "tag-value2"
 							},
 							"values": [
-								[ 1, "4.5" ],
-								[ 2, "6.5" ]
+								[ 1.000, "4.5" ],
+								[ 2.000, "6.5" ]
 							]
 						}
 					]
@@ -386,6 +401,21 @@ var _ = Describe("PromqlMarshaler", func() {
 			}`))
 		})
 
+		It("handles a range query result without a value as an empty matrix", func() {
+			marshaler := marshaler.NewPromqlMarshaler(&mockMarshaler{})
+
+			result, err := marshaler.Marshal(&logcache_v1.PromQL_RangeQueryResult{})
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result).To(MatchJSON(`{
+				"status": "success",
+				"data": {
+					"resultType": "matrix",
+					"result": []
+				}
+			}`))
+		})
+
 		It("handles a matrix range query result with no tags", func() {
 			marshaler := marshaler.NewPromqlMarshaler(&mockMarshaler{})
 
@@ -419,8 +449,8 @@ var _ = Describe("PromqlMarshaler", func() {
 						{
 							"metric": {},
 							"values": [
-								[ 1, "2.5" ],
-								[ 2, "3.5" ]
+								[ 1.000, "2.5" ],
+								[ 2.000, "3.5" ]
 							]
 						}
 					]
@@ -460,6 +490,81 @@ var _ = Describe("PromqlMarshaler", func() {
 		})
 	})
 
+	Context("timestamp format", func() {
+		scalar := &logcache_v1.PromQL_InstantQueryResult{
+			Result: &logcache_v1.PromQL_InstantQueryResult_Scalar{
+				Scalar: &logcache_v1.PromQL_Scalar{Time: "1.5", Value: 2.5},
+			},
+		}
+		vector := &logcache_v1.PromQL_InstantQueryResult{
+			Result: &logcache_v1.PromQL_InstantQueryResult_Vector{
+				Vector: &logcache_v1.PromQL_Vector{
+					Samples: []*logcache_v1.PromQL_Sample{
+						{
+							Metric: map[string]string{"a": "b"},
+							Point:  &logcache_v1.PromQL_Point{Time: "1", Value: 2.5},
+						},
+					},
+				},
+			},
+		}
+		matrix := &logcache_v1.PromQL_RangeQueryResult{
+			Result: &logcache_v1.PromQL_RangeQueryResult_Matrix{
+				Matrix: &logcache_v1.PromQL_Matrix{
+					Series: []*logcache_v1.PromQL_Series{
+						{
+							Metric: map[string]string{"a": "b"},
+							Points: []*logcache_v1.PromQL_Point{
+								{Time: "1", Value: 2.5},
+								{Time: "2.25", Value: 3},
+							},
+						},
+					},
+				},
+			},
+		}
+
+		It("uses three decimal places by default", func() {
+			m := marshaler.NewPromqlMarshaler(&mockMarshaler{})
+
+			result, err := m.Marshal(scalar)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(result)).To(Equal(`{"status":"success","data":{"resultType":"scalar","result":[1.500,"2.5"]}}` + "\n"))
+
+			result, err = m.Marshal(vector)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(result)).To(Equal(`{"status":"success","data":{"resultType":"vector","result":[{"metric":{"a":"b"},"value":[1.000,"2.5"]}]}}` + "\n"))
+
+			result, err = m.Marshal(matrix)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(result)).To(Equal(`{"status":"success","data":{"resultType":"matrix","result":[{"metric":{"a":"b"},"values":[[1.000,"2.5"],[2.250,"3"]]}]}}` + "\n"))
+		})
+
+		It("uses the configured precision", func() {
+			m := marshaler.NewPromqlMarshaler(&mockMarshaler{}, marshaler.WithTimestampPrecision(1))
+
+			result, err := m.Marshal(scalar)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(result)).To(Equal(`{"status":"success","data":{"resultType":"scalar","result":[1.5,"2.5"]}}` + "\n"))
+
+			result, err = m.Marshal(vector)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(result)).To(Equal(`{"status":"success","data":{"resultType":"vector","result":[{"metric":{"a":"b"},"value":[1.0,"2.5"]}]}}` + "\n"))
+
+			result, err = m.Marshal(matrix)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(result)).To(Equal(`{"status":"success","data":{"resultType":"matrix","result":[{"metric":{"a":"b"},"values":[[1.0,"2.5"],[2.2,"3"]]}]}}` + "\n"))
+		})
+
+		It("uses the fewest digits needed with a negative precision", func() {
+			m := marshaler.NewPromqlMarshaler(&mockMarshaler{}, marshaler.WithTimestampPrecision(-1))
+
+			result, err := m.Marshal(matrix)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(result)).To(Equal(`{"status":"success","data":{"resultType":"matrix","result":[{"metric":{"a":"b"},"values":[[1,"2.5"],[2.25,"3"]]}]}}` + "\n"))
+		})
+	})
+
 	Context("NewEncoder()", func() {
 		It("can encode to a writer", func() {
 			encoded := bytes.NewBuffer(nil)
@@ -550,7 +655,7 @@ var _ = Describe("PromqlMarshaler", func() {
 								"deployment": "cf",
 								"tag-name2":   "tag-value2"
 							},
-							"value": [ 2, "3.5" ]
+							"value": [ 2.000, "3.5" ]
 						}
 					]
 				}
@@ -588,7 +693,7 @@ var _ = Describe("PromqlMarshaler", func() {
 							},
 							"values": [
 								[ 1.987, "2.5" ],
-								[ 2, "3.5" ]
+								[ 2.000, "3.5" ]
 							]
 						},
 						{
@@ -597,8 +702,8 @@ var _ = Describe("PromqlMarshaler", func() {
 								"tag-name2":   "tag-value2"
 							},
 							"values": [
-								[ 1, "4.5" ],
-								[ 2, "6.5" ]
+								[ 1.000, "4.5" ],
+								[ 2.000, "6.5" ]
 							]
 						}
 					]
@@ -643,7 +748,7 @@ var _ = Describe("PromqlMarshaler", func() {
 							},
 							"values": [
 								[ 1.987, "2.5" ],
-								[ 2, "3.5" ]
+								[ 2.000, "3.5" ]
 							]
 						},
 						{
@@ -652,8 +757,8 @@ var _ = Describe("PromqlMarshaler", func() {
 								"tag-name2":   "tag-value2"
 							},
 							"values": [
-								[ 1, "4.5" ],
-								[ 2, "6.5" ]
+								[ 1.000, "4.5" ],
+								[ 2.000, "6.5" ]
 							]
 						}
 					]
@@ -0,0 +1,295 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.4
+// 	protoc        (unknown)
+// source: pkg/rpc/logcachepb/admin.proto
+
+package logcachepb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	durationpb "google.golang.org/protobuf/types/known/durationpb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// PauseSourceIdRequest asks to drop the envelopes written for a source ID
+// for a duration.
+type PauseSourceIdRequest struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	SourceId string                 `protobuf:"bytes,1,opt,name=source_id,json=sourceId,proto3" json:"source_id,omitempty"`
+	// duration is how long envelopes are dropped for. A duration of 0
+	// resumes the source ID.
+	Duration      *durationpb.Duration `protobuf:"bytes,2,opt,name=duration,proto3" json:"duration,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PauseSourceIdRequest) Reset() {
+	*x = PauseSourceIdRequest{}
+	mi := &file_pkg_rpc_logcachepb_admin_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PauseSourceIdRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PauseSourceIdRequest) ProtoMessage() {}
+
+func (x *PauseSourceIdRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_rpc_logcachepb_admin_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PauseSourceIdRequest.ProtoReflect.Descriptor instead.
+func (*PauseSourceIdRequest) Descriptor() ([]byte, []int) {
+	return file_pkg_rpc_logcachepb_admin_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *PauseSourceIdRequest) GetSourceId() string {
+	if x != nil {
+		return x.SourceId
+	}
+	return ""
+}
+
+func (x *PauseSourceIdRequest) GetDuration() *durationpb.Duration {
+	if x != nil {
+		return x.Duration
+	}
+	return nil
+}
+
+// SourceDiagnostics describes the envelopes a node holds for a source ID.
+type SourceDiagnostics struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	SourceId string                 `protobuf:"bytes,1,opt,name=source_id,json=sourceId,proto3" json:"source_id,omitempty"`
+	// size is the number of envelopes stored for the source ID.
+	Size int64 `protobuf:"varint,2,opt,name=size,proto3" json:"size,omitempty"`
+	// depth is the depth of the tree the envelopes are stored in.
+	Depth int64 `protobuf:"varint,3,opt,name=depth,proto3" json:"depth,omitempty"`
+	// oldest_timestamp and newest_timestamp are in nanoseconds.
+	OldestTimestamp int64 `protobuf:"varint,4,opt,name=oldest_timestamp,json=oldestTimestamp,proto3" json:"oldest_timestamp,omitempty"`
+	NewestTimestamp int64 `protobuf:"varint,5,opt,name=newest_timestamp,json=newestTimestamp,proto3" json:"newest_timestamp,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *SourceDiagnostics) Reset() {
+	*x = SourceDiagnostics{}
+	mi := &file_pkg_rpc_logcachepb_admin_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SourceDiagnostics) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SourceDiagnostics) ProtoMessage() {}
+
+func (x *SourceDiagnostics) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_rpc_logcachepb_admin_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SourceDiagnostics.ProtoReflect.Descriptor instead.
+func (*SourceDiagnostics) Descriptor() ([]byte, []int) {
+	return file_pkg_rpc_logcachepb_admin_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *SourceDiagnostics) GetSourceId() string {
+	if x != nil {
+		return x.SourceId
+	}
+	return ""
+}
+
+func (x *SourceDiagnostics) GetSize() int64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *SourceDiagnostics) GetDepth() int64 {
+	if x != nil {
+		return x.Depth
+	}
+	return 0
+}
+
+func (x *SourceDiagnostics) GetOldestTimestamp() int64 {
+	if x != nil {
+		return x.OldestTimestamp
+	}
+	return 0
+}
+
+func (x *SourceDiagnostics) GetNewestTimestamp() int64 {
+	if x != nil {
+		return x.NewestTimestamp
+	}
+	return 0
+}
+
+// DiagnosticsResponse lists the source IDs holding the most envelopes on a
+// node, largest first.
+type DiagnosticsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Sources       []*SourceDiagnostics   `protobuf:"bytes,1,rep,name=sources,proto3" json:"sources,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DiagnosticsResponse) Reset() {
+	*x = DiagnosticsResponse{}
+	mi := &file_pkg_rpc_logcachepb_admin_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DiagnosticsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DiagnosticsResponse) ProtoMessage() {}
+
+func (x *DiagnosticsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_rpc_logcachepb_admin_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DiagnosticsResponse.ProtoReflect.Descriptor instead.
+func (*DiagnosticsResponse) Descriptor() ([]byte, []int) {
+	return file_pkg_rpc_logcachepb_admin_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *DiagnosticsResponse) GetSources() []*SourceDiagnostics {
+	if x != nil {
+		return x.Sources
+	}
+	return nil
+}
+
+var File_pkg_rpc_logcachepb_admin_proto protoreflect.FileDescriptor
+
+var file_pkg_rpc_logcachepb_admin_proto_rawDesc = string([]byte{
+	0x0a, 0x1e, 0x70, 0x6b, 0x67, 0x2f, 0x72, 0x70, 0x63, 0x2f, 0x6c, 0x6f, 0x67, 0x63, 0x61, 0x63,
+	0x68, 0x65, 0x70, 0x62, 0x2f, 0x61, 0x64, 0x6d, 0x69, 0x6e, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f,
+	0x12, 0x0b, 0x6c, 0x6f, 0x67, 0x63, 0x61, 0x63, 0x68, 0x65, 0x2e, 0x76, 0x31, 0x1a, 0x1e, 0x67,
+	0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2f, 0x64,
+	0x75, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0x6a, 0x0a,
+	0x14, 0x50, 0x61, 0x75, 0x73, 0x65, 0x53, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x49, 0x64, 0x52, 0x65,
+	0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x1b, 0x0a, 0x09, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x5f,
+	0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65,
+	0x49, 0x64, 0x12, 0x35, 0x0a, 0x08, 0x64, 0x75, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x02,
+	0x20, 0x01, 0x28, 0x0b, 0x32, 0x19, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72,
+	0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x44, 0x75, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x52,
+	0x08, 0x64, 0x75, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x22, 0xb0, 0x01, 0x0a, 0x11, 0x53, 0x6f,
+	0x75, 0x72, 0x63, 0x65, 0x44, 0x69, 0x61, 0x67, 0x6e, 0x6f, 0x73, 0x74, 0x69, 0x63, 0x73, 0x12,
+	0x1b, 0x0a, 0x09, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x08, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x49, 0x64, 0x12, 0x12, 0x0a, 0x04,
+	0x73, 0x69, 0x7a, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x03, 0x52, 0x04, 0x73, 0x69, 0x7a, 0x65,
+	0x12, 0x14, 0x0a, 0x05, 0x64, 0x65, 0x70, 0x74, 0x68, 0x18, 0x03, 0x20, 0x01, 0x28, 0x03, 0x52,
+	0x05, 0x64, 0x65, 0x70, 0x74, 0x68, 0x12, 0x29, 0x0a, 0x10, 0x6f, 0x6c, 0x64, 0x65, 0x73, 0x74,
+	0x5f, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x18, 0x04, 0x20, 0x01, 0x28, 0x03,
+	0x52, 0x0f, 0x6f, 0x6c, 0x64, 0x65, 0x73, 0x74, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d,
+	0x70, 0x12, 0x29, 0x0a, 0x10, 0x6e, 0x65, 0x77, 0x65, 0x73, 0x74, 0x5f, 0x74, 0x69, 0x6d, 0x65,
+	0x73, 0x74, 0x61, 0x6d, 0x70, 0x18, 0x05, 0x20, 0x01, 0x28, 0x03, 0x52, 0x0f, 0x6e, 0x65, 0x77,
+	0x65, 0x73, 0x74, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x22, 0x4f, 0x0a, 0x13,
+	0x44, 0x69, 0x61, 0x67, 0x6e, 0x6f, 0x73, 0x74, 0x69, 0x63, 0x73, 0x52, 0x65, 0x73, 0x70, 0x6f,
+	0x6e, 0x73, 0x65, 0x12, 0x38, 0x0a, 0x07, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x73, 0x18, 0x01,
+	0x20, 0x03, 0x28, 0x0b, 0x32, 0x1e, 0x2e, 0x6c, 0x6f, 0x67, 0x63, 0x61, 0x63, 0x68, 0x65, 0x2e,
+	0x76, 0x31, 0x2e, 0x53, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x44, 0x69, 0x61, 0x67, 0x6e, 0x6f, 0x73,
+	0x74, 0x69, 0x63, 0x73, 0x52, 0x07, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x73, 0x42, 0x34, 0x5a,
+	0x32, 0x63, 0x6f, 0x64, 0x65, 0x2e, 0x63, 0x6c, 0x6f, 0x75, 0x64, 0x66, 0x6f, 0x75, 0x6e, 0x64,
+	0x72, 0x79, 0x2e, 0x6f, 0x72, 0x67, 0x2f, 0x6c, 0x6f, 0x67, 0x2d, 0x63, 0x61, 0x63, 0x68, 0x65,
+	0x2f, 0x70, 0x6b, 0x67, 0x2f, 0x72, 0x70, 0x63, 0x2f, 0x6c, 0x6f, 0x67, 0x63, 0x61, 0x63, 0x68,
+	0x65, 0x70, 0x62, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+})
+
+var (
+	file_pkg_rpc_logcachepb_admin_proto_rawDescOnce sync.Once
+	file_pkg_rpc_logcachepb_admin_proto_rawDescData []byte
+)
+
+func file_pkg_rpc_logcachepb_admin_proto_rawDescGZIP() []byte {
+	file_pkg_rpc_logcachepb_admin_proto_rawDescOnce.Do(func() {
+		file_pkg_rpc_logcachepb_admin_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_pkg_rpc_logcachepb_admin_proto_rawDesc), len(file_pkg_rpc_logcachepb_admin_proto_rawDesc)))
+	})
+	return file_pkg_rpc_logcachepb_admin_proto_rawDescData
+}
+
+var file_pkg_rpc_logcachepb_admin_proto_msgTypes = make([]protoimpl.MessageInfo, 3)
+var file_pkg_rpc_logcachepb_admin_proto_goTypes = []any{
+	(*PauseSourceIdRequest)(nil), // 0: logcache.v1.PauseSourceIdRequest
+	(*SourceDiagnostics)(nil),    // 1: logcache.v1.SourceDiagnostics
+	(*DiagnosticsResponse)(nil),  // 2: logcache.v1.DiagnosticsResponse
+	(*durationpb.Duration)(nil),  // 3: google.protobuf.Duration
+}
+var file_pkg_rpc_logcachepb_admin_proto_depIdxs = []int32{
+	3, // 0: logcache.v1.PauseSourceIdRequest.duration:type_name -> google.protobuf.Duration
+	1, // 1: logcache.v1.DiagnosticsResponse.sources:type_name -> logcache.v1.SourceDiagnostics
+	2, // [2:2] is the sub-list for method output_type
+	2, // [2:2] is the sub-list for method input_type
+	2, // [2:2] is the sub-list for extension type_name
+	2, // [2:2] is the sub-list for extension extendee
+	0, // [0:2] is the sub-list for field type_name
+}
+
+func init() { file_pkg_rpc_logcachepb_admin_proto_init() }
+func file_pkg_rpc_logcachepb_admin_proto_init() {
+	if File_pkg_rpc_logcachepb_admin_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_pkg_rpc_logcachepb_admin_proto_rawDesc), len(file_pkg_rpc_logcachepb_admin_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   3,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_pkg_rpc_logcachepb_admin_proto_goTypes,
+		DependencyIndexes: file_pkg_rpc_logcachepb_admin_proto_depIdxs,
+		MessageInfos:      file_pkg_rpc_logcachepb_admin_proto_msgTypes,
+	}.Build()
+	File_pkg_rpc_logcachepb_admin_proto = out.File
+	file_pkg_rpc_logcachepb_admin_proto_goTypes = nil
+	file_pkg_rpc_logcachepb_admin_proto_depIdxs = nil
+}
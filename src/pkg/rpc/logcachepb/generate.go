@@ -0,0 +1,6 @@
+// Package logcachepb holds the messages of the Log Cache gRPC services that
+// are not part of go-log-cache: admin, aggregation and metric names. The
+// services themselves are registered by hand in internal/routing.
+package logcachepb
+
+//go:generate protoc -I ../../.. --go_out=../../.. --go_opt=paths=source_relative pkg/rpc/logcachepb/admin.proto pkg/rpc/logcachepb/aggregation.proto pkg/rpc/logcachepb/metric_names.proto
@@ -0,0 +1,194 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.4
+// 	protoc        (unknown)
+// source: pkg/rpc/logcachepb/metric_names.proto
+
+package logcachepb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// MetricName is the name of a counter, gauge metric or timer.
+type MetricName struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Name  string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	// timestamp is the timestamp, in nanoseconds, of the newest envelope the
+	// name was seen in.
+	Timestamp     int64 `protobuf:"varint,2,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MetricName) Reset() {
+	*x = MetricName{}
+	mi := &file_pkg_rpc_logcachepb_metric_names_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MetricName) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MetricName) ProtoMessage() {}
+
+func (x *MetricName) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_rpc_logcachepb_metric_names_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MetricName.ProtoReflect.Descriptor instead.
+func (*MetricName) Descriptor() ([]byte, []int) {
+	return file_pkg_rpc_logcachepb_metric_names_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *MetricName) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *MetricName) GetTimestamp() int64 {
+	if x != nil {
+		return x.Timestamp
+	}
+	return 0
+}
+
+// MetricNamesResponse lists the distinct metric names of a source ID, most
+// recently seen first.
+type MetricNamesResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Names         []*MetricName          `protobuf:"bytes,1,rep,name=names,proto3" json:"names,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MetricNamesResponse) Reset() {
+	*x = MetricNamesResponse{}
+	mi := &file_pkg_rpc_logcachepb_metric_names_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MetricNamesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MetricNamesResponse) ProtoMessage() {}
+
+func (x *MetricNamesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_rpc_logcachepb_metric_names_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MetricNamesResponse.ProtoReflect.Descriptor instead.
+func (*MetricNamesResponse) Descriptor() ([]byte, []int) {
+	return file_pkg_rpc_logcachepb_metric_names_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *MetricNamesResponse) GetNames() []*MetricName {
+	if x != nil {
+		return x.Names
+	}
+	return nil
+}
+
+var File_pkg_rpc_logcachepb_metric_names_proto protoreflect.FileDescriptor
+
+var file_pkg_rpc_logcachepb_metric_names_proto_rawDesc = string([]byte{
+	0x0a, 0x25, 0x70, 0x6b, 0x67, 0x2f, 0x72, 0x70, 0x63, 0x2f, 0x6c, 0x6f, 0x67, 0x63, 0x61, 0x63,
+	0x68, 0x65, 0x70, 0x62, 0x2f, 0x6d, 0x65, 0x74, 0x72, 0x69, 0x63, 0x5f, 0x6e, 0x61, 0x6d, 0x65,
+	0x73, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x0b, 0x6c, 0x6f, 0x67, 0x63, 0x61, 0x63, 0x68,
+	0x65, 0x2e, 0x76, 0x31, 0x22, 0x3e, 0x0a, 0x0a, 0x4d, 0x65, 0x74, 0x72, 0x69, 0x63, 0x4e, 0x61,
+	0x6d, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x12, 0x1c, 0x0a, 0x09, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x74,
+	0x61, 0x6d, 0x70, 0x18, 0x02, 0x20, 0x01, 0x28, 0x03, 0x52, 0x09, 0x74, 0x69, 0x6d, 0x65, 0x73,
+	0x74, 0x61, 0x6d, 0x70, 0x22, 0x44, 0x0a, 0x13, 0x4d, 0x65, 0x74, 0x72, 0x69, 0x63, 0x4e, 0x61,
+	0x6d, 0x65, 0x73, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x2d, 0x0a, 0x05, 0x6e,
+	0x61, 0x6d, 0x65, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x17, 0x2e, 0x6c, 0x6f, 0x67,
+	0x63, 0x61, 0x63, 0x68, 0x65, 0x2e, 0x76, 0x31, 0x2e, 0x4d, 0x65, 0x74, 0x72, 0x69, 0x63, 0x4e,
+	0x61, 0x6d, 0x65, 0x52, 0x05, 0x6e, 0x61, 0x6d, 0x65, 0x73, 0x42, 0x34, 0x5a, 0x32, 0x63, 0x6f,
+	0x64, 0x65, 0x2e, 0x63, 0x6c, 0x6f, 0x75, 0x64, 0x66, 0x6f, 0x75, 0x6e, 0x64, 0x72, 0x79, 0x2e,
+	0x6f, 0x72, 0x67, 0x2f, 0x6c, 0x6f, 0x67, 0x2d, 0x63, 0x61, 0x63, 0x68, 0x65, 0x2f, 0x70, 0x6b,
+	0x67, 0x2f, 0x72, 0x70, 0x63, 0x2f, 0x6c, 0x6f, 0x67, 0x63, 0x61, 0x63, 0x68, 0x65, 0x70, 0x62,
+	0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+})
+
+var (
+	file_pkg_rpc_logcachepb_metric_names_proto_rawDescOnce sync.Once
+	file_pkg_rpc_logcachepb_metric_names_proto_rawDescData []byte
+)
+
+func file_pkg_rpc_logcachepb_metric_names_proto_rawDescGZIP() []byte {
+	file_pkg_rpc_logcachepb_metric_names_proto_rawDescOnce.Do(func() {
+		file_pkg_rpc_logcachepb_metric_names_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_pkg_rpc_logcachepb_metric_names_proto_rawDesc), len(file_pkg_rpc_logcachepb_metric_names_proto_rawDesc)))
+	})
+	return file_pkg_rpc_logcachepb_metric_names_proto_rawDescData
+}
+
+var file_pkg_rpc_logcachepb_metric_names_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_pkg_rpc_logcachepb_metric_names_proto_goTypes = []any{
+	(*MetricName)(nil),          // 0: logcache.v1.MetricName
+	(*MetricNamesResponse)(nil), // 1: logcache.v1.MetricNamesResponse
+}
+var file_pkg_rpc_logcachepb_metric_names_proto_depIdxs = []int32{
+	0, // 0: logcache.v1.MetricNamesResponse.names:type_name -> logcache.v1.MetricName
+	1, // [1:1] is the sub-list for method output_type
+	1, // [1:1] is the sub-list for method input_type
+	1, // [1:1] is the sub-list for extension type_name
+	1, // [1:1] is the sub-list for extension extendee
+	0, // [0:1] is the sub-list for field type_name
+}
+
+func init() { file_pkg_rpc_logcachepb_metric_names_proto_init() }
+func file_pkg_rpc_logcachepb_metric_names_proto_init() {
+	if File_pkg_rpc_logcachepb_metric_names_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_pkg_rpc_logcachepb_metric_names_proto_rawDesc), len(file_pkg_rpc_logcachepb_metric_names_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   2,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_pkg_rpc_logcachepb_metric_names_proto_goTypes,
+		DependencyIndexes: file_pkg_rpc_logcachepb_metric_names_proto_depIdxs,
+		MessageInfos:      file_pkg_rpc_logcachepb_metric_names_proto_msgTypes,
+	}.Build()
+	File_pkg_rpc_logcachepb_metric_names_proto = out.File
+	file_pkg_rpc_logcachepb_metric_names_proto_goTypes = nil
+	file_pkg_rpc_logcachepb_metric_names_proto_depIdxs = nil
+}